@@ -1,3 +1,5 @@
+//go:build ignore
+
 // Simple build test to verify the basic structure compiles
 package main
 
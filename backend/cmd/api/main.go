@@ -1,29 +1,51 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"time"
 
+	engineconfig "citadel-agent/backend/config"
 	"citadel-agent/backend/internal/api/handlers"
+	"citadel-agent/backend/internal/api/middleware"
 	"citadel-agent/backend/internal/config"
 	"citadel-agent/backend/internal/nodes"
+	"citadel-agent/backend/internal/nodes/ai"
+	"citadel-agent/backend/internal/nodes/builtin"
 	"citadel-agent/backend/internal/workflow/core/engine"
+	workflowmiddleware "citadel-agent/backend/internal/workflow/core/middleware"
+	"citadel-agent/backend/pkg/cors"
+	"citadel-agent/backend/pkg/database"
+	"citadel-agent/backend/pkg/metrics"
+	"citadel-agent/backend/pkg/profiling"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
+	startTime := time.Now()
+
+	configPath := flag.String("config", "", "path to the configuration file (default: app.env)")
+	flag.Parse()
+
+	// Load configuration and refuse to start on any invalid setting
+	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
@@ -39,39 +61,181 @@ func main() {
 	app.Use(recover.New())
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: cfg.CORSAllowedOrigins,
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
-	}))
+		AllowOrigins:     strings.Split(cfg.CORSAllowedOrigins, ","),
+		AllowMethods:     []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.IdempotencyKeyHeader},
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           3600,
+	}).Fiber())
 
 	// Initialize node factory and register all node types
 	nodeFactory := nodes.GetNodeFactory()
 
+	// Initialize storage selected by storage_driver. Postgres uses the
+	// connection pool from the db_* settings, which /health also checks.
+	var storage engine.Storage
+	var db *database.Pool
+	if cfg.StorageDriver == engine.StoragePostgres {
+		db, err = database.NewPool(context.Background(), cfg.DatabasePool())
+		if err != nil {
+			log.Fatalf("Failed to initialize %s storage: %v", cfg.StorageDriver, err)
+		}
+		defer db.Close()
+		postgresStorage := engine.NewPostgresStorage(db)
+		codec, err := engine.NewStateCodec(engine.PersistenceConfig{
+			Compression:   cfg.PersistenceCompression,
+			Encryption:    cfg.PersistenceEncryption,
+			EncryptionKey: cfg.PersistenceEncryptionKey,
+		})
+		if err != nil {
+			log.Fatalf("Invalid persistence settings: %v", err)
+		}
+		postgresStorage.SetStateCodec(codec)
+		storage = postgresStorage
+	} else {
+		storage = engine.NewMemoryStorage()
+	}
+	log.Printf("Using %s storage", cfg.StorageDriver)
+
+	// Record the token usage of AI nodes next to the executions and hold
+	// users to ai_token_budget
+	var usageStore ai.UsageStore = ai.NewMemoryUsageStore()
+	if db != nil {
+		usageStore = ai.NewPostgresUsageStore(db)
+	}
+	ai.SetUsageTracker(ai.NewUsageTracker(usageStore, cfg.AITokenBudget))
+
+	// Initialize engine logger; level follows log_level
+	loggingConfig := engineconfig.DefaultEngineConfig().LoggingConfig
+	loggingConfig.Level = cfg.LogLevel
+	engineLogger, err := engine.NewSlogLogger(loggingConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer engineLogger.Close()
+
 	// Initialize workflow engine
-	// Note: For now, we'll use a simple in-memory implementation
 	_ = engine.NewEngine(&engine.Config{
 		Parallelism:  10,
-		Logger:       nil, // Initialize logger here
-		Storage:      nil, // Initialize storage here
+		Logger:       engineLogger,
+		Storage:      storage,
 		NodeRegistry: nodeFactory,
 	}) // TODO: Use workflowEngine when workflow routes are implemented
 
-	// API Routes
+	// Circuit breakers of the calls nodes make to external hosts and AI
+	// providers
+	breakers := workflowmiddleware.OutboundCircuitBreakers()
+	breakers.Configure(workflowmiddleware.CircuitBreakerConfig{
+		MaxFailures:  cfg.CircuitBreakerThreshold,
+		ResetTimeout: cfg.CircuitBreakerResetTimeout,
+	}, cfg.CircuitBreakerEnabled)
+
+	// Prometheus metrics, served without authentication like /health
+	var authMetrics middleware.AuthMetrics
+	if cfg.PrometheusEnabled {
+		serverMetrics := metrics.New()
+		authMetrics = serverMetrics
+		breakers.OnStateChange(func(endpoint string, from, to workflowmiddleware.CircuitState) {
+			serverMetrics.RecordCircuitBreakerState(endpoint, to.String())
+		})
+		app.Get(cfg.MetricsEndpoint, adaptor.HTTPHandler(serverMetrics.Handler()))
+	}
+
+	// API Routes, rate limited per client IP when enabled
 	api := app.Group("/api/v1")
+	if cfg.RateLimitEnabled {
+		window := time.Duration(cfg.RateLimitWindow) * time.Second
+		trustedProxies := strings.Split(cfg.TrustedProxies, ",")
+		store := newRateLimitStore(cfg)
+		api.Use(middleware.RateLimit(middleware.RateLimitConfig{
+			Max:            cfg.RateLimitRequests,
+			Window:         window,
+			Store:          store,
+			TrustedProxies: trustedProxies,
+		}))
+		// Authentication endpoints get a stricter quota of their own
+		api.Use("/auth", middleware.RateLimit(middleware.RateLimitConfig{
+			Max:            cfg.AuthRateLimitRequests,
+			Window:         window,
+			Store:          store,
+			KeyPrefix:      "auth",
+			TrustedProxies: trustedProxies,
+		}))
+	}
+
+	// Require a JWT on API routes except the public ones
+	var profilingAuth *middleware.JWTAuth
+	if cfg.JWTSecret != "" {
+		jwtConfig := middleware.JWTConfig{
+			Secret:      cfg.JWTSecret,
+			Algorithm:   cfg.JWTAlgorithm,
+			PublicPaths: strings.Split(cfg.AuthPublicPaths, ","),
+			Metrics:     authMetrics,
+		}
+		if cfg.JWTBlacklistEnabled {
+			jwtConfig.Blacklist = newTokenBlacklist(cfg)
+		}
+		auth, err := middleware.NewJWTAuth(jwtConfig)
+		if err != nil {
+			log.Fatalf("Failed to configure authentication: %v", err)
+		}
+		api.Use(auth.Fiber())
+		if cfg.JWTBlacklistEnabled {
+			api.Post("/auth/logout", auth.Logout())
+		}
+		profilingAuth = auth
+	} else {
+		log.Println("jwt_secret is not set; API authentication is disabled")
+	}
+
+	// pprof profiles, behind authentication and never in production unless
+	// allowed
+	profilingConfig := profiling.Config{
+		Enabled:           cfg.ProfilingEnabled,
+		Endpoint:          strings.TrimRight(cfg.ProfilingEndpoint, "/"),
+		AllowInProduction: cfg.AllowProfilingInProduction,
+	}
+	if profilingConfig.Active(cfg.AppEnv) {
+		var profiles http.Handler = profiling.Handler(profilingConfig.Endpoint)
+		if profilingAuth != nil {
+			profiles = profilingAuth.HTTP(profiles)
+		}
+		app.All(profilingConfig.Endpoint, adaptor.HTTPHandler(profiles))
+		app.All(profilingConfig.Endpoint+"/*", adaptor.HTTPHandler(profiles))
+		log.Printf("Serving profiles on %s/", profilingConfig.Endpoint)
+	} else if profilingConfig.Enabled {
+		log.Println("Profiling is disabled in production; set allow_profiling_in_production to enable it")
+	}
 
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
+		if db != nil {
+			if err := db.HealthCheck(c.Context()); err != nil {
+				log.Printf("Health check failed: %v", err)
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"status":  "unhealthy",
+					"service": "citadel-api",
+					"error":   "Database connection failed",
+				})
+			}
+		}
 		return c.JSON(fiber.Map{
 			"status":                "ok",
 			"service":               "citadel-api",
 			"version":               "1.0.0",
 			"timestamp":             time.Now().Unix(),
+			"uptime":                time.Since(startTime).Round(time.Second).String(),
 			"node_types_registered": len(nodeFactory.ListNodeTypes()),
 		})
 	})
 
-	// Simple workflow execution route
-	api.Post("/workflows/execute", func(c *fiber.Ctx) error {
+	// Simple workflow execution route; retries carrying the same
+	// Idempotency-Key get the original execution back
+	idempotency := middleware.Idempotency(middleware.IdempotencyConfig{
+		Store: newIdempotencyStore(cfg),
+		TTL:   cfg.IdempotencyTTL,
+	})
+	api.Post("/workflows/execute", idempotency, func(c *fiber.Ctx) error {
 		var req struct {
 			WorkflowID string                 `json:"workflow_id"`
 			Inputs     map[string]interface{} `json:"inputs"`
@@ -90,15 +254,15 @@ func main() {
 		})
 	})
 
-	// Simple nodes route
+	// Node types with their metadata, grouped by category; ?category=
+	// limits them to one
+	nodeTypes := engine.NewNodeTypeRegistry()
+	builtin.Register(nodeTypes, nil)
 	api.Get("/nodes", func(c *fiber.Ctx) error {
-		nodeTypes := nodeFactory.ListNodeTypes()
-		return c.JSON(fiber.Map{
-			"success":    true,
-			"node_types": nodeTypes,
-			"count":      len(nodeTypes),
-			"timestamp":  time.Now().Unix(),
-		})
+		catalog := handlers.NodeCatalog(nodeTypes, c.Query("category"))
+		catalog["success"] = true
+		catalog["timestamp"] = time.Now().Unix()
+		return c.JSON(catalog)
 	})
 
 	// New Node Registry API
@@ -136,9 +300,66 @@ func main() {
 	}
 
 	log.Printf("Starting Citadel API server on port %s", port)
+	if cfg.SSLEnabled {
+		log.Fatal(app.ListenTLS(":"+port, cfg.SSLCertFile, cfg.SSLKeyFile))
+	}
 	log.Fatal(app.Listen(":" + port))
 }
 
+// newRateLimitStore returns the Redis rate limit store when rate_limit_store
+// is "redis" and Redis is reachable, and an in-memory store otherwise
+func newRateLimitStore(cfg *config.Config) middleware.RateLimitStore {
+	if cfg.RateLimitStore != "redis" {
+		return middleware.NewMemoryRateLimitStore()
+	}
+
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		log.Printf("Redis unavailable for rate limiting, using in-memory limits: %v", err)
+		return middleware.NewMemoryRateLimitStore()
+	}
+	return middleware.NewRedisRateLimitStore(client)
+}
+
+// newTokenBlacklist returns a Redis token blacklist, so that a logout applies
+// to every instance, or an in-memory one when Redis is unreachable
+func newTokenBlacklist(cfg *config.Config) middleware.TokenBlacklist {
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		log.Printf("Redis unavailable for the token blacklist, revocations are kept in memory: %v", err)
+		return middleware.NewMemoryTokenBlacklist()
+	}
+	return middleware.NewRedisTokenBlacklist(client)
+}
+
+// newIdempotencyStore returns a Redis idempotency store, so that a retry
+// reaching another instance is recognised, or an in-memory one when Redis is
+// unreachable
+func newIdempotencyStore(cfg *config.Config) middleware.IdempotencyStore {
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		log.Printf("Redis unavailable for idempotency keys, keeping them in memory: %v", err)
+		return middleware.NewMemoryIdempotencyStore()
+	}
+	return middleware.NewRedisIdempotencyStore(client)
+}
+
+// newRedisClient connects to the configured Redis and checks that it answers
+func newRedisClient(cfg *config.Config) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.RedisHost, cfg.RedisPort),
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
 // startBrowser opens the default browser to the given URL
 func startBrowser(url string) {
 	var err error
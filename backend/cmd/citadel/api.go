@@ -0,0 +1,166 @@
+// backend/cmd/citadel/api.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultAPIURL is used when CITADEL_API_URL is not set
+const defaultAPIURL = "http://localhost:8080"
+
+// apiKeyEnv names the variable holding an API key, used instead of the
+// stored CLI credentials, e.g. by CI jobs that cannot log in interactively
+const apiKeyEnv = "CITADEL_API_KEY"
+
+// errNotLoggedIn is returned when no usable CLI credentials are stored
+var errNotLoggedIn = errors.New("not logged in, please run 'citadel-agent-cli login' or set " + apiKeyEnv)
+
+// cliCredentials mirrors the credentials file written by the login command
+type cliCredentials struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// apiClient talks to a running Citadel Agent API server
+type apiClient struct {
+	baseURL    string
+	scheme     string // of the Authorization header, "Bearer" or "ApiKey"
+	token      string
+	httpClient *http.Client
+}
+
+// apiError is returned when the server answers with a non-2xx status
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// newAPIClient creates a client authenticated with the API key in
+// CITADEL_API_KEY or else with the stored CLI credentials
+func newAPIClient() (*apiClient, error) {
+	client := &apiClient{
+		baseURL:    apiBaseURL(),
+		scheme:     "ApiKey",
+		token:      strings.TrimSpace(os.Getenv(apiKeyEnv)),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	if client.token != "" {
+		return client, nil
+	}
+
+	token, err := loadAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	client.scheme = "Bearer"
+	client.token = token
+	return client, nil
+}
+
+// apiBaseURL returns the API server address without a trailing slash
+func apiBaseURL() string {
+	baseURL := os.Getenv("CITADEL_API_URL")
+	if baseURL == "" {
+		baseURL = defaultAPIURL
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+// loadAccessToken reads the access token saved by the login command
+func loadAccessToken() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(usr.HomeDir, ".config", "citadel-agent", "creds"))
+	if err != nil {
+		return "", errNotLoggedIn
+	}
+
+	var creds cliCredentials
+	if err := json.Unmarshal(data, &creds); err != nil || creds.AccessToken == "" {
+		return "", errNotLoggedIn
+	}
+
+	if !creds.Expiry.IsZero() && time.Now().After(creds.Expiry) {
+		return "", fmt.Errorf("access token expired, please re-login with 'citadel-agent-cli login'")
+	}
+
+	return creds.AccessToken, nil
+}
+
+// do sends a request to the API server. body is encoded as JSON when non-nil
+// and the response is decoded into out when out is non-nil.
+func (c *apiClient) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", c.scheme+" "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach Citadel Agent at %s (is the server running? start it with 'citadel start'): %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &apiError{StatusCode: resp.StatusCode, Message: errorMessage(respBody)}
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// errorMessage extracts the "error" field from a JSON error body, falling
+// back to the raw body text
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error != "" {
+		return payload.Error
+	}
+	return strings.TrimSpace(string(body))
+}
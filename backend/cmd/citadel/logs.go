@@ -0,0 +1,127 @@
+// backend/cmd/citadel/logs.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// logFilePath is where startServer writes server output
+	logFilePath = "citadel.log"
+
+	// logPollInterval controls how often --follow checks for new output
+	logPollInterval = 500 * time.Millisecond
+)
+
+func showLogs(lines int, follow bool) {
+	file, err := os.Open(logFilePath)
+	if err != nil {
+		fmt.Println("❌ Log file not found. Server may not be running.")
+		return
+	}
+	defer func() { file.Close() }()
+
+	// Baca N baris terakhir dari log
+	tail, err := lastLines(file, lines)
+	if err != nil {
+		fmt.Printf("❌ Error reading log file: %v\n", err)
+		return
+	}
+
+	fmt.Printf("📋 Citadel Agent Logs (last %d lines):\n", lines)
+	fmt.Println("=======================================")
+	for _, line := range tail {
+		fmt.Println(line)
+	}
+
+	if !follow {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := followLog(ctx, &file, os.Stdout); err != nil {
+		fmt.Printf("❌ Error following log file: %v\n", err)
+	}
+}
+
+// lastLines reads the file to the end and returns at most n trailing lines
+func lastLines(file *os.File, n int) ([]string, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if n >= 0 && len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// followLog copies data appended to the log file to out until ctx is done.
+// When the file is truncated it is read again from the start, and when it is
+// replaced (for example by log rotation) the new file is opened.
+func followLog(ctx context.Context, file **os.File, out io.Writer) error {
+	offset, err := (*file).Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := (*file).Stat()
+		if err != nil {
+			return err
+		}
+
+		onDisk, err := os.Stat(logFilePath)
+		switch {
+		case err != nil:
+			// File is being rotated; keep reading the old one until it reappears
+		case !os.SameFile(current, onDisk):
+			reopened, err := os.Open(logFilePath)
+			if err != nil {
+				continue
+			}
+			// Drain whatever was written to the old file before switching
+			if _, err := io.Copy(out, *file); err != nil {
+				reopened.Close()
+				return err
+			}
+			(*file).Close()
+			*file = reopened
+			offset = 0
+			continue
+		case onDisk.Size() < offset:
+			// File was truncated in place
+			if offset, err = (*file).Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		n, err := io.Copy(out, *file)
+		if err != nil {
+			return err
+		}
+		offset += n
+	}
+}
@@ -1,23 +1,18 @@
-// cmd/citadel/main.go
+// backend/cmd/citadel/main.go
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"os/exec"
-	"os/signal"
-	"strconv"
-	"strings"
-	"syscall"
 	"time"
 
-	"citadel-agent/backend/internal/workflow/models"
-	"citadel-agent/backend/internal/workflow/engine"
+	"citadel-agent/backend/internal/nodes/builtin"
+	"citadel-agent/backend/internal/workflow/core/engine"
 )
 
 func main() {
@@ -38,17 +33,39 @@ func main() {
 	case "restart":
 		restartServer()
 	case "status":
-		checkStatus()
+		fs := flag.NewFlagSet("status", flag.ExitOnError)
+		jsonOutput := fs.Bool("json", false, "print machine-readable status")
+		fs.Parse(os.Args[2:])
+		checkStatus(*jsonOutput)
 	case "update":
 		updateAgent()
 	case "deploy":
-		if len(os.Args) < 3 {
-			fmt.Println("❌ Usage: citadel deploy <workflow-file>")
+		fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "validate and test-run the workflow locally without deploying it")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() < 1 {
+			fmt.Println("❌ Usage: citadel deploy [--dry-run] <workflow-file>")
 			os.Exit(1)
 		}
-		deployWorkflow(os.Args[2])
+		deployWorkflow(fs.Arg(0), *dryRun)
+	case "workflow":
+		runWorkflowCommand(os.Args[2:])
+	case "validate":
+		fs := flag.NewFlagSet("validate", flag.ExitOnError)
+		allowLoops := fs.Bool("allow-loops", false, "allow cycles between nodes")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() < 1 {
+			fmt.Println("❌ Usage: citadel validate [--allow-loops] <workflow-file>")
+			os.Exit(1)
+		}
+		validateWorkflowFile(fs.Arg(0), *allowLoops)
 	case "logs":
-		showLogs()
+		fs := flag.NewFlagSet("logs", flag.ExitOnError)
+		lines := fs.Int("lines", 50, "number of trailing lines to show")
+		follow := fs.Bool("follow", false, "keep printing new log lines until interrupted")
+		fs.BoolVar(follow, "f", false, "shorthand for --follow")
+		fs.Parse(os.Args[2:])
+		showLogs(*lines, *follow)
 	case "version":
 		showVersion()
 	case "help", "-h", "--help":
@@ -71,6 +88,8 @@ func showHelp() {
 	fmt.Println("  status        - Check the status of Citadel Agent")
 	fmt.Println("  update        - Update Citadel Agent to latest version")
 	fmt.Println("  deploy        - Deploy workflow to Citadel Agent")
+	fmt.Println("  validate      - Validate a workflow file without executing it")
+	fmt.Println("  workflow      - List or inspect workflows on the server")
 	fmt.Println("  logs          - Show server logs")
 	fmt.Println("  version       - Show Citadel Agent version")
 	fmt.Println("  help          - Show this help message")
@@ -79,7 +98,16 @@ func showHelp() {
 	fmt.Println("  citadel test")
 	fmt.Println("  citadel start")
 	fmt.Println("  citadel status")
+	fmt.Println("  citadel status --json")
 	fmt.Println("  citadel deploy workflow.json")
+	fmt.Println("  citadel deploy --dry-run workflow.json")
+	fmt.Println("  citadel validate workflow.json")
+	fmt.Println("  citadel logs --follow --lines 100")
+	fmt.Println("  citadel workflow list --status active")
+	fmt.Println("  citadel workflow get <id>")
+	fmt.Println("")
+	fmt.Println("Commands talking to the server use the credentials of 'citadel-agent-cli login',")
+	fmt.Println("or the API key in CITADEL_API_KEY when it is set.")
 	fmt.Println("")
 }
 
@@ -88,20 +116,17 @@ func runTests() {
 	fmt.Println("==================================")
 
 	// Membuat instance dari workflow engine untuk test
-	workflowEngine := engine.NewEngine()
-	
+	workflowEngine := engine.NewWorkflowExecutor(newNodeRegistry())
+
 	// Test membuat workflow sederhana
-	testWorkflow := &models.Workflow{
-		ID:          "test-workflow-1",
-		Name:        "Test Workflow",
-		Description: "This is a test workflow",
-		Status:      "active",
-		Nodes: []models.Node{
-			{
+	testWorkflow := &engine.Workflow{
+		ID:   "test-workflow-1",
+		Name: "Test Workflow",
+		Nodes: map[string]*engine.WorkflowNode{
+			"node-1": {
 				ID:   "node-1",
-				Name: "Start Node",
 				Type: "http_request",
-				Parameters: map[string]interface{}{
+				Config: map[string]interface{}{
 					"url":    "https://httpbin.org/get",
 					"method": "GET",
 				},
@@ -112,14 +137,14 @@ func runTests() {
 	fmt.Printf("✅ Created test workflow: %s\n", testWorkflow.Name)
 	fmt.Printf("✅ Workflow has %d nodes\n", len(testWorkflow.Nodes))
 	fmt.Printf("✅ Workflow engine initialized\n")
-	
-	// Test eksekusi workflow (ini akan berjalan di background)
+
+	// Test eksekusi workflow
 	ctx := context.Background()
-	execution, err := workflowEngine.ExecuteWorkflow(ctx, testWorkflow)
+	run, err := workflowEngine.Run(ctx, testWorkflow, nil)
 	if err != nil {
 		fmt.Printf("⚠️  Workflow execution test failed: %v\n", err)
 	} else {
-		fmt.Printf("✅ Workflow execution started: %s\n", execution.ID)
+		fmt.Printf("✅ Workflow execution completed with %d result(s)\n", len(run.Results))
 	}
 
 	fmt.Println("✅ Tests completed successfully!")
@@ -127,7 +152,7 @@ func runTests() {
 
 func startServer() {
 	fmt.Println("🚀 Starting Citadel Agent server...")
-	
+
 	// Cek apakah server sudah berjalan
 	if serverIsRunning() {
 		fmt.Println("❌ Citadel Agent is already running")
@@ -137,7 +162,7 @@ func startServer() {
 	// Jalankan server di background
 	cmd := exec.Command("go", "run", "cmd/api/main.go")
 	cmd.Dir = "backend"
-	
+
 	// Arahkan output ke file log
 	logFile, err := os.OpenFile("citadel.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -145,10 +170,10 @@ func startServer() {
 		os.Exit(1)
 	}
 	defer logFile.Close()
-	
+
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
-	
+
 	err = cmd.Start()
 	if err != nil {
 		fmt.Printf("❌ Error starting server: %v\n", err)
@@ -170,14 +195,14 @@ func startServer() {
 
 func stopServer() {
 	fmt.Println("🛑 Stopping Citadel Agent server...")
-	
+
 	pid := getServerPID()
 	if pid == 0 {
 		fmt.Println("❌ Citadel Agent is not running")
 		return
 	}
 
-	// Kirim sinyal SIGTERM untuk shutdown yang graceful
+	// Minta proses untuk shutdown secara graceful
 	p, err := os.FindProcess(pid)
 	if err != nil {
 		fmt.Printf("❌ Error finding process: %v\n", err)
@@ -185,7 +210,7 @@ func stopServer() {
 		return
 	}
 
-	err = p.Signal(syscall.SIGTERM)
+	err = terminateProcess(p)
 	if err != nil {
 		fmt.Printf("❌ Error stopping process: %v\n", err)
 		os.Remove(".citadel.pid")
@@ -200,9 +225,9 @@ func stopServer() {
 	for {
 		select {
 		case <-timeout:
-			// Jika timeout, kirim SIGKILL
+			// Jika timeout, hentikan paksa
 			fmt.Println("⚠️  Force killing process...")
-			p.Signal(syscall.SIGKILL)
+			killProcess(p)
 			os.Remove(".citadel.pid")
 			fmt.Println("✅ Citadel Agent stopped")
 			return
@@ -224,23 +249,14 @@ func restartServer() {
 	startServer()
 }
 
-func checkStatus() {
-	if serverIsRunning() {
-		pid := getServerPID()
-		fmt.Printf("✅ Citadel Agent is running (PID: %d)\n", pid)
-	} else {
-		fmt.Println("❌ Citadel Agent is not running")
-	}
-}
-
 func updateAgent() {
 	fmt.Println("🔄 Updating Citadel Agent...")
-	
+
 	// Dalam implementasi nyata, ini akan:
 	// 1. Pull dari repo git
 	// 2. Update dependencies
 	// 3. Rebuild binary
-	
+
 	fmt.Println("🔄 Fetching latest changes...")
 	cmd := exec.Command("git", "pull", "origin", "main")
 	cmd.Dir = "."
@@ -249,7 +265,7 @@ func updateAgent() {
 		fmt.Printf("⚠️  Git pull failed: %v\n", err)
 		fmt.Printf("Output: %s\n", string(output))
 	}
-	
+
 	fmt.Println("🔄 Updating dependencies...")
 	cmd = exec.Command("go", "mod", "tidy")
 	cmd.Dir = "backend"
@@ -258,79 +274,90 @@ func updateAgent() {
 		fmt.Printf("⚠️  Dependency update failed: %v\n", err)
 		fmt.Printf("Output: %s\n", string(output))
 	}
-	
+
 	fmt.Println("✅ Citadel Agent updated!")
 }
 
-func deployWorkflow(workflowFile string) {
+func deployWorkflow(workflowFile string, dryRun bool) {
 	fmt.Printf("📦 Deploying workflow: %s\n", workflowFile)
-	
-	// Baca file workflow
-	file, err := os.Open(workflowFile)
+
+	workflow, err := loadWorkflow(workflowFile)
 	if err != nil {
-		fmt.Printf("❌ Error opening workflow file: %v\n", err)
+		fmt.Printf("❌ %v\n", err)
 		os.Exit(1)
 	}
-	defer file.Close()
 
-	// Parse JSON workflow
-	bytes, err := io.ReadAll(file)
-	if err != nil {
-		fmt.Printf("❌ Error reading workflow file: %v\n", err)
-		os.Exit(1)
+	fmt.Printf("✅ Workflow '%s' loaded with %d nodes\n", workflow.Name, len(workflow.Nodes))
+
+	if dryRun {
+		// Dry run: validasi dan jalankan workflow secara lokal tanpa menyimpan ke server.
+		// Node dengan side effect di-stub, seperti ?dry_run=true di server.
+		registry := newNodeRegistry()
+		if errs := validateWorkflow(registry, workflow, false); len(errs) > 0 {
+			fmt.Printf("⚠️  Workflow validation failed with %d error(s):\n", len(errs))
+			for _, e := range errs {
+				fmt.Printf("  - %s\n", e)
+			}
+			os.Exit(1)
+		}
+
+		run, err := engine.NewWorkflowExecutor(registry).Simulate(context.Background(), workflow, nil, engine.Simulation{})
+		if err != nil {
+			fmt.Printf("⚠️  Local test execution failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Dry run passed, %d node(s) ran locally, %d stubbed\n", len(run.Results), len(run.Stubbed))
+		fmt.Println("ℹ️  Workflow was not deployed (--dry-run)")
+		return
 	}
 
-	var workflow models.Workflow
-	err = json.Unmarshal(bytes, &workflow)
+	workflowID, err := deploy(mustAPIClient(), workflow)
 	if err != nil {
-		fmt.Printf("❌ Error parsing workflow JSON: %v\n", err)
+		fmt.Printf("❌ Error deploying workflow: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Dalam implementasi nyata, ini akan mengirim ke API server
-	// Untuk sekarang, kita cek validasi sederhana
-	fmt.Printf("✅ Workflow '%s' loaded with %d nodes\n", workflow.Name, len(workflow.Nodes))
-	
-	// Test workflow engine
-	workflowEngine := engine.NewEngine()
-	ctx := context.Background()
-	
-	execution, err := workflowEngine.ExecuteWorkflow(ctx, &workflow)
-	if err != nil {
-		fmt.Printf("⚠️  Workflow validation failed: %v\n", err)
-	} else {
-		fmt.Printf("✅ Workflow deployed and test execution started: %s\n", execution.ID)
-	}
-	
-	fmt.Println("✅ Workflow deployment completed!")
+	fmt.Printf("✅ Workflow deployed with ID: %s\n", workflowID)
 }
 
-func showLogs() {
-	file, err := os.Open("citadel.log")
+// loadWorkflow reads a workflow file in the format of the API server:
+// nodes keyed by ID, each with its type and config, and the edges between
+// them
+func loadWorkflow(workflowFile string) (*engine.Workflow, error) {
+	data, err := os.ReadFile(workflowFile)
 	if err != nil {
-		fmt.Println("❌ Log file not found. Server may not be running.")
-		return
+		return nil, fmt.Errorf("error reading workflow file: %w", err)
 	}
-	defer file.Close()
 
-	// Baca 50 baris terakhir dari log
-	scanner := bufio.NewScanner(file)
-	var lines []string
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	var workflow engine.Workflow
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return nil, fmt.Errorf("error parsing workflow JSON: %w", err)
 	}
+	return &workflow, nil
+}
 
-	// Ambil 50 baris terakhir
-	start := 0
-	if len(lines) > 50 {
-		start = len(lines) - 50
+// deploy posts workflow to the API server and returns the ID the server
+// assigned it
+func deploy(client *apiClient, workflow *engine.Workflow) (string, error) {
+	var created map[string]interface{}
+	if err := client.do(http.MethodPost, "/api/workflows", workflow, &created); err != nil {
+		return "", err
 	}
 
-	fmt.Println("📋 Citadel Agent Logs (last 50 lines):")
-	fmt.Println("=======================================")
-	for i := start; i < len(lines); i++ {
-		fmt.Println(lines[i])
+	for _, key := range []string{"id", "workflow_id"} {
+		if id, ok := created[key]; ok && id != nil {
+			return fmt.Sprint(id), nil
+		}
 	}
+	return workflow.ID, nil
+}
+
+// newNodeRegistry returns a registry of the built-in node types, as the API
+// server registers them, so workflows are checked and run as it would
+func newNodeRegistry() *engine.NodeTypeRegistryImpl {
+	registry := engine.NewNodeTypeRegistry()
+	builtin.Register(registry, nil)
+	return registry
 }
 
 func showVersion() {
@@ -352,29 +379,18 @@ func getServerPID() int {
 	if err != nil {
 		return 0
 	}
-	
+
 	// Periksa apakah proses masih berjalan
 	if !processExists(pid) {
 		// Hapus PID file jika proses tidak berjalan
 		os.Remove(".citadel.pid")
 		return 0
 	}
-	
-	return pid
-}
 
-func processExists(pid int) bool {
-	p, err := os.FindProcess(pid)
-	if err != nil {
-		return false
-	}
-	
-	// Pada Unix, kita bisa mengirim sinyal 0 untuk cek eksistensi proses
-	err = p.Signal(syscall.Signal(0))
-	return err == nil
+	return pid
 }
 
 func serverIsRunning() bool {
 	pid := getServerPID()
 	return pid != 0
-}
\ No newline at end of file
+}
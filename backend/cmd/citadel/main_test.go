@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"citadel-agent/backend/internal/api/handlers"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeployIsAcceptedByServer deploys a workflow file through the handler
+// the API server routes POST /api/workflows to
+func TestDeployIsAcceptedByServer(t *testing.T) {
+	workflowHandler := handlers.NewWorkflowHandler(engine.NewWorkflowExecutor(newNodeRegistry()))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/workflows", workflowHandler.DeployWorkflowHandler)
+	mux.HandleFunc(handlers.WorkflowPathPrefix, workflowHandler.WorkflowByIDHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	workflowFile := filepath.Join(t.TempDir(), "workflow.json")
+	require.NoError(t, os.WriteFile(workflowFile, []byte(`{
+		"name": "Greeting",
+		"nodes": {
+			"greet": {"id": "greet", "type": "logger", "config": {"message": "hello"}},
+			"shape": {"id": "shape", "type": "data_transformer", "config": {}}
+		},
+		"edges": [{"id": "e1", "source": "greet", "target": "shape"}]
+	}`), 0o600))
+
+	workflow, err := loadWorkflow(workflowFile)
+	require.NoError(t, err)
+
+	client := &apiClient{baseURL: server.URL, httpClient: server.Client()}
+	workflowID, err := deploy(client, workflow)
+	require.NoError(t, err)
+	require.NotEmpty(t, workflowID)
+
+	var deployed struct {
+		Workflow struct {
+			Name  string                          `json:"name"`
+			Nodes map[string]*engine.WorkflowNode `json:"nodes"`
+			Edges []engine.WorkflowEdge           `json:"edges"`
+		} `json:"workflow"`
+	}
+	require.NoError(t, client.do(http.MethodGet, "/api/workflows/"+workflowID, nil, &deployed))
+	assert.Equal(t, "Greeting", deployed.Workflow.Name)
+	require.Contains(t, deployed.Workflow.Nodes, "greet")
+	assert.Equal(t, "hello", deployed.Workflow.Nodes["greet"].Config["message"])
+	assert.Len(t, deployed.Workflow.Edges, 1)
+}
+
+func TestDeployReportsRejection(t *testing.T) {
+	workflowHandler := handlers.NewWorkflowHandler(engine.NewWorkflowExecutor(newNodeRegistry()))
+	server := httptest.NewServer(http.HandlerFunc(workflowHandler.DeployWorkflowHandler))
+	defer server.Close()
+
+	workflow := &engine.Workflow{
+		Nodes: map[string]*engine.WorkflowNode{"greet": {ID: "greet", Type: "logger"}},
+		Edges: []engine.WorkflowEdge{{ID: "e1", Source: "greet", Target: "missing"}},
+	}
+	client := &apiClient{baseURL: server.URL, httpClient: server.Client()}
+	_, err := deploy(client, workflow)
+
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+// backend/cmd/citadel/process_unix.go
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// Pada Unix, kita bisa mengirim sinyal 0 untuk cek eksistensi proses
+	err = p.Signal(syscall.Signal(0))
+	return err == nil
+}
+
+// terminateProcess asks the process to shut down gracefully
+func terminateProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// killProcess stops the process immediately
+func killProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGKILL)
+}
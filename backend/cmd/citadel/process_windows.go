@@ -0,0 +1,49 @@
+//go:build windows
+
+// backend/cmd/citadel/process_windows.go
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+const (
+	// processQueryLimitedInformation is enough access to read an exit code
+	processQueryLimitedInformation = 0x1000
+
+	// stillActive is the exit code reported for processes that are still running
+	stillActive = 259
+)
+
+func processExists(pid int) bool {
+	// FindProcess always succeeds on Windows, so ask for the exit code instead
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+
+	return exitCode == stillActive
+}
+
+// terminateProcess asks the process tree to shut down. Windows has no SIGTERM,
+// so taskkill without /F is used to request a graceful close.
+func terminateProcess(p *os.Process) error {
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(p.Pid)).Run()
+}
+
+// killProcess stops the process tree immediately
+func killProcess(p *os.Process) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run(); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// backend/cmd/citadel/status.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// healthTimeout bounds the /health request so a hung server doesn't hang the CLI
+const healthTimeout = 3 * time.Second
+
+// statusReport is the machine-readable output of `citadel status --json`
+type statusReport struct {
+	Running bool                   `json:"running"`
+	PID     int                    `json:"pid,omitempty"`
+	Healthy bool                   `json:"healthy"`
+	APIURL  string                 `json:"api_url"`
+	Health  map[string]interface{} `json:"health,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+func checkStatus(jsonOutput bool) {
+	report := statusReport{
+		PID:    getServerPID(),
+		APIURL: apiBaseURL(),
+	}
+	report.Running = report.PID != 0
+
+	health, err := fetchHealth(report.APIURL)
+	report.Health = health
+	if err != nil {
+		report.Error = err.Error()
+	} else {
+		report.Healthy = health["status"] == "ok"
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printStatus(report)
+	}
+
+	if !report.Running || !report.Healthy {
+		os.Exit(1)
+	}
+}
+
+func printStatus(report statusReport) {
+	switch {
+	case report.Running && report.Healthy:
+		fmt.Printf("✅ Citadel Agent is running (PID: %d) and healthy\n", report.PID)
+	case report.Running:
+		fmt.Printf("⚠️  Citadel Agent process is running (PID: %d) but unhealthy\n", report.PID)
+	case report.Healthy:
+		fmt.Println("⚠️  Citadel Agent is not managed by this CLI, but a server is responding")
+	default:
+		fmt.Println("❌ Citadel Agent is not running")
+	}
+
+	if report.Error != "" {
+		fmt.Printf("   Health check (%s/health): %s\n", report.APIURL, report.Error)
+		return
+	}
+
+	if report.Health != nil {
+		fmt.Printf("   Health check (%s/health):\n", report.APIURL)
+		keys := make([]string, 0, len(report.Health))
+		for key := range report.Health {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("   %-22s %v\n", key+":", report.Health[key])
+		}
+	}
+}
+
+// fetchHealth calls the server's /health endpoint and returns its payload
+func fetchHealth(baseURL string) (map[string]interface{}, error) {
+	client := &http.Client{Timeout: healthTimeout}
+
+	resp, err := client.Get(baseURL + "/health")
+	if err != nil {
+		return nil, fmt.Errorf("server not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var health map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf("invalid health response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return health, fmt.Errorf("server returned HTTP %d", resp.StatusCode)
+	}
+
+	return health, nil
+}
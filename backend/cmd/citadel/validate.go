@@ -0,0 +1,190 @@
+// backend/cmd/citadel/validate.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"citadel-agent/backend/internal/nodes/trigger"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// validationError describes a single problem found in a workflow file
+type validationError struct {
+	NodeID  string
+	Message string
+}
+
+func (e validationError) String() string {
+	if e.NodeID == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("node %s: %s", e.NodeID, e.Message)
+}
+
+func validateWorkflowFile(workflowFile string, allowLoops bool) {
+	fmt.Printf("🔍 Validating workflow: %s\n", workflowFile)
+
+	workflow, err := loadWorkflow(workflowFile)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	errs := validateWorkflow(newNodeRegistry(), workflow, allowLoops)
+	if len(errs) > 0 {
+		fmt.Printf("❌ Workflow '%s' has %d validation error(s):\n", workflow.Name, len(errs))
+		for _, e := range errs {
+			fmt.Printf("  - %s\n", e)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ Workflow '%s' is valid (%d nodes)\n", workflow.Name, len(workflow.Nodes))
+}
+
+// validateWorkflow checks workflow as the API server does when it is
+// deployed: node types must be registered, configs written for older
+// versions of them must migrate, triggers and the other nodes must accept
+// their configs, and edges must connect existing nodes with valid mappings.
+// Unless allowLoops is set, the edges must also form no cycle. Node configs
+// are migrated in place.
+func validateWorkflow(registry *engine.NodeTypeRegistryImpl, workflow *engine.Workflow, allowLoops bool) []validationError {
+	var errs []validationError
+
+	if len(workflow.Nodes) == 0 {
+		errs = append(errs, validationError{Message: "workflow has no nodes"})
+	}
+
+	// Check nodes in a stable order so errors are reported deterministically
+	nodeIDs := make(map[string]bool, len(workflow.Nodes))
+	for nodeID := range workflow.Nodes {
+		nodeIDs[nodeID] = true
+	}
+	creators := make(map[string]func() types.NodeInstance, len(nodeIDs))
+	for _, nodeID := range sortedKeys(nodeIDs) {
+		node := workflow.Nodes[nodeID]
+		if node == nil || node.Type == "" {
+			errs = append(errs, validationError{NodeID: nodeID, Message: "node has no type"})
+			continue
+		}
+
+		creator, ok := registry.GetNodeType(node.Type)
+		if !ok {
+			errs = append(errs, validationError{NodeID: nodeID, Message: fmt.Sprintf("unknown node type %q", node.Type)})
+			continue
+		}
+		creators[nodeID] = creator
+	}
+
+	// Configs are only checked once migrated to the registered versions
+	if _, err := engine.MigrateWorkflow(registry, workflow); err != nil {
+		errs = append(errs, validationError{Message: err.Error()})
+	} else {
+		for _, nodeID := range sortedKeys(nodeIDs) {
+			creator, ok := creators[nodeID]
+			if !ok {
+				continue
+			}
+			node := workflow.Nodes[nodeID]
+			if err := trigger.ValidateConfig(node.Type, node.Config); err != nil {
+				errs = append(errs, validationError{NodeID: nodeID, Message: fmt.Sprintf("invalid trigger: %v", err)})
+				continue
+			}
+			// Node constructors reject configurations missing required parameters
+			if err := checkConfig(creator, node.Config); err != nil {
+				errs = append(errs, validationError{NodeID: nodeID, Message: fmt.Sprintf("invalid config: %v", err)})
+			}
+		}
+	}
+
+	// Build adjacency list, reporting edges to unknown nodes
+	adjacency := make(map[string][]string)
+	for _, edge := range workflow.Edges {
+		valid := true
+		for _, end := range []string{edge.Source, edge.Target} {
+			if workflow.Nodes[end] == nil {
+				errs = append(errs, validationError{Message: fmt.Sprintf("edge %s references unknown node %q", edge.ID, end)})
+				valid = false
+			}
+		}
+		if err := engine.ValidateEdgeMapping(edge.Mapping); err != nil {
+			errs = append(errs, validationError{Message: fmt.Sprintf("edge %s has an invalid mapping: %v", edge.ID, err)})
+		}
+		if valid {
+			adjacency[edge.Source] = append(adjacency[edge.Source], edge.Target)
+		}
+	}
+
+	if !allowLoops {
+		if cycle := findCycle(nodeIDs, adjacency); cycle != "" {
+			errs = append(errs, validationError{NodeID: cycle, Message: "node is part of a cycle (use --allow-loops to permit loops)"})
+		}
+	}
+
+	return errs
+}
+
+// checkConfig initializes a node of the type creator makes with config, as
+// the executor does before running it
+func checkConfig(creator func() types.NodeInstance, config map[string]interface{}) error {
+	instance := creator()
+	defer instance.Close()
+	if err := instance.Initialize(config); err != nil {
+		return err
+	}
+	return instance.Validate()
+}
+
+// sortedKeys returns the keys of set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// findCycle returns the ID of a node on a cycle, or an empty string if the
+// graph is acyclic
+func findCycle(nodeIDs map[string]bool, adjacency map[string][]string) string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	// Iterate in a stable order so the reported node is deterministic
+	ids := sortedKeys(nodeIDs)
+
+	state := make(map[string]int, len(ids))
+	var visit func(id string) string
+	visit = func(id string) string {
+		state[id] = visiting
+		for _, next := range adjacency[id] {
+			switch state[next] {
+			case visiting:
+				return next
+			case unvisited:
+				if found := visit(next); found != "" {
+					return found
+				}
+			}
+		}
+		state[id] = done
+		return ""
+	}
+
+	for _, id := range ids {
+		if state[id] == unvisited {
+			if found := visit(id); found != "" {
+				return found
+			}
+		}
+	}
+
+	return ""
+}
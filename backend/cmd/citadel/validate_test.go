@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseWorkflow(t *testing.T, data string) *engine.Workflow {
+	var workflow engine.Workflow
+	require.NoError(t, json.Unmarshal([]byte(data), &workflow))
+	return &workflow
+}
+
+func TestValidateAcceptsServerNodeTypes(t *testing.T) {
+	workflow := parseWorkflow(t, `{
+		"name": "Routing",
+		"nodes": {
+			"hook":  {"id": "hook", "type": "webhook_trigger", "config": {"path": "orders"}},
+			"check": {"id": "check", "type": "if_else", "config": {"field": "total", "operator": "greater_than", "value": 100}},
+			"log":   {"id": "log", "type": "logger", "config": {}}
+		},
+		"edges": [
+			{"id": "e1", "source": "hook", "target": "check"},
+			{"id": "e2", "source": "check", "target": "log", "source_handle": "true", "mapping": {"total": "source.total"}}
+		]
+	}`)
+
+	assert.Empty(t, validateWorkflow(newNodeRegistry(), workflow, false))
+}
+
+func TestValidateReportsUnknownNodeType(t *testing.T) {
+	workflow := parseWorkflow(t, `{"nodes": {"a": {"id": "a", "type": "teleport"}}}`)
+
+	errs := validateWorkflow(newNodeRegistry(), workflow, false)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "a", errs[0].NodeID)
+	assert.Contains(t, errs[0].Message, `unknown node type "teleport"`)
+}
+
+func TestValidateReportsUnknownReference(t *testing.T) {
+	workflow := parseWorkflow(t, `{
+		"nodes": {"a": {"id": "a", "type": "logger"}},
+		"edges": [{"id": "e1", "source": "a", "target": "ghost"}]
+	}`)
+
+	errs := validateWorkflow(newNodeRegistry(), workflow, false)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, `edge e1 references unknown node "ghost"`)
+}
+
+func TestValidateReportsCycle(t *testing.T) {
+	workflow := parseWorkflow(t, `{
+		"nodes": {
+			"a": {"id": "a", "type": "logger"},
+			"b": {"id": "b", "type": "logger"}
+		},
+		"edges": [
+			{"id": "e1", "source": "a", "target": "b"},
+			{"id": "e2", "source": "b", "target": "a"}
+		]
+	}`)
+
+	errs := validateWorkflow(newNodeRegistry(), workflow, false)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "cycle")
+
+	assert.Empty(t, validateWorkflow(newNodeRegistry(), workflow, true))
+}
+
+func TestValidateReportsInvalidTriggerAndMapping(t *testing.T) {
+	workflow := parseWorkflow(t, `{
+		"nodes": {
+			"tick": {"id": "tick", "type": "schedule_trigger", "config": {"cron": "0 25 * * *"}},
+			"log":  {"id": "log", "type": "logger"}
+		},
+		"edges": [{"id": "e1", "source": "tick", "target": "log", "mapping": {"x": "nope("}}]
+	}`)
+
+	errs := validateWorkflow(newNodeRegistry(), workflow, false)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "tick", errs[0].NodeID)
+	assert.Contains(t, errs[0].Message, "invalid trigger")
+	assert.Contains(t, errs[1].Message, "edge e1 has an invalid mapping")
+}
@@ -0,0 +1,134 @@
+// backend/cmd/citadel/workflow.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+)
+
+// workflowSummary is the subset of workflow fields shown by `workflow list`
+type workflowSummary struct {
+	ID     interface{} `json:"id"`
+	Name   string      `json:"name"`
+	Status string      `json:"status"`
+}
+
+func runWorkflowCommand(args []string) {
+	if len(args) < 1 {
+		printWorkflowUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("workflow list", flag.ExitOnError)
+		status := fs.String("status", "", "only show workflows with this status")
+		fs.Parse(args[1:])
+		listWorkflows(*status)
+	case "get":
+		if len(args) < 2 {
+			fmt.Println("❌ Usage: citadel workflow get <id>")
+			os.Exit(1)
+		}
+		getWorkflow(args[1])
+	default:
+		fmt.Printf("❌ Unknown workflow command: %s\n", args[0])
+		printWorkflowUsage()
+		os.Exit(1)
+	}
+}
+
+func printWorkflowUsage() {
+	fmt.Println("Usage: citadel workflow [list [--status <status>] | get <id>]")
+}
+
+func listWorkflows(status string) {
+	client := mustAPIClient()
+
+	path := "/api/workflows"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+
+	var raw json.RawMessage
+	if err := client.do(http.MethodGet, path, nil, &raw); err != nil {
+		fmt.Printf("❌ Error listing workflows: %v\n", err)
+		os.Exit(1)
+	}
+
+	workflows, err := decodeWorkflowList(raw)
+	if err != nil {
+		fmt.Printf("❌ Error parsing workflow list: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(workflows) == 0 {
+		fmt.Println("No workflows found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS")
+	for _, wf := range workflows {
+		fmt.Fprintf(w, "%v\t%s\t%s\n", wf.ID, wf.Name, wf.Status)
+	}
+	w.Flush()
+}
+
+// decodeWorkflowList accepts either a bare array or an object wrapping the
+// array in a "workflows" or "data" field
+func decodeWorkflowList(raw json.RawMessage) ([]workflowSummary, error) {
+	var workflows []workflowSummary
+	if err := json.Unmarshal(raw, &workflows); err == nil {
+		return workflows, nil
+	}
+
+	var wrapped struct {
+		Workflows []workflowSummary `json:"workflows"`
+		Data      []workflowSummary `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Workflows != nil {
+		return wrapped.Workflows, nil
+	}
+	return wrapped.Data, nil
+}
+
+func getWorkflow(id string) {
+	client := mustAPIClient()
+
+	var workflow json.RawMessage
+	err := client.do(http.MethodGet, "/api/workflows/"+url.PathEscape(id), nil, &workflow)
+	if err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			fmt.Printf("❌ Workflow %s not found\n", id)
+		} else {
+			fmt.Printf("❌ Error fetching workflow: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(workflow)
+}
+
+// mustAPIClient returns an authenticated API client or exits with a hint
+// on how to log in
+func mustAPIClient() *apiClient {
+	client, err := newAPIClient()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	return client
+}
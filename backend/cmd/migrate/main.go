@@ -1,15 +1,47 @@
+// Command migrate applies the versioned SQL migrations of the database.
+//
+// Migrations are read from the directory given by -path, which defaults to
+// CITADEL_DATABASE_MIGRATION_PATH (config.Database.MigrationPath) or
+// ./migrations. Each migration is a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql; applied versions are
+// recorded in the schema_migrations table.
+//
+// Usage:
+//
+//	migrate up          apply every pending migration
+//	migrate down [n]    roll back the last n migrations (default 1)
+//	migrate version     print the current version
+//	migrate force <v>   set the version after repairing a failed migration
 package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"citadel-agent/backend/pkg/database"
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
 func main() {
+	path := flag.String("path", getEnvOrDefault("CITADEL_DATABASE_MIGRATION_PATH", "./migrations"), "directory of the migration files")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: migrate [-path dir] up | down [n] | version | force <version>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	// Get database URL from environment or use default
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -19,98 +51,127 @@ func main() {
 		dbUser := getEnvOrDefault("DB_USER", "postgres")
 		dbPassword := getEnvOrDefault("DB_PASSWORD", "postgres")
 		dbName := getEnvOrDefault("DB_NAME", "citadel_agent")
-		
+
 		dbURL = "postgresql://" + dbUser + ":" + dbPassword + "@" + dbHost + ":" + dbPort + "/" + dbName
 	}
 
-	// Connect to database
-	pool, err := pgxpool.New(
-		context.Background(),
-		dbURL,
-	)
+	// Connect to database, with the pool settings from CITADEL_DATABASE_*
+	dbConfig := database.FromEnv(database.DefaultConfig())
+	dbConfig.URL = dbURL
+	pool, err := database.NewPool(context.Background(), dbConfig)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer pool.Close()
 
-	fmt.Println("Running migrations...")
-
-	// In a real implementation, you would run actual database migrations here
-	// For now, this is a placeholder that just confirms connection
-	err = runMigrations(pool)
+	m, err := newMigrator(pool, *path)
 	if err != nil {
-		log.Fatal("Failed to run migrations:", err)
+		log.Fatal("Failed to load migrations:", err)
 	}
+	defer m.Close()
 
-	fmt.Println("Migrations completed successfully!")
+	if err := run(m, flag.Args()); err != nil {
+		log.Fatal(err)
+	}
 }
 
-// runMigrations runs actual database migrations
-func runMigrations(pool *pgxpool.Pool) error {
-	// Execute migration queries
-	queries := []string{
-		// Create users table if not exists
-		`CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			username VARCHAR(255) UNIQUE NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			first_name VARCHAR(255),
-			last_name VARCHAR(255),
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Create workflows table if not exists
-		`CREATE TABLE IF NOT EXISTS workflows (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			description TEXT,
-			definition JSONB,
-			status VARCHAR(50) DEFAULT 'active',
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Create nodes table if not exists
-		`CREATE TABLE IF NOT EXISTS nodes (
-			id SERIAL PRIMARY KEY,
-			workflow_id INTEGER REFERENCES workflows(id) ON DELETE CASCADE,
-			type VARCHAR(255) NOT NULL,
-			config JSONB,
-			status VARCHAR(50) DEFAULT 'pending',
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Create executions table if not exists
-		`CREATE TABLE IF NOT EXISTS executions (
-			id SERIAL PRIMARY KEY,
-			workflow_id INTEGER REFERENCES workflows(id) ON DELETE CASCADE,
-			status VARCHAR(50) DEFAULT 'running',
-			result JSONB,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)`,
+// newMigrator reads the migrations in dir, to be applied to the database of
+// pool
+func newMigrator(pool *database.Pool, dir string) (*migrate.Migrate, error) {
+	source, err := iofs.New(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	// Each migration runs as a single statement batch, which PostgreSQL
+	// applies in one transaction; the files also wrap themselves in
+	// BEGIN/COMMIT. Leave those out only for statements that cannot run in a
+	// transaction, such as CREATE INDEX CONCURRENTLY.
+	driver, err := pgxmigrate.WithInstance(stdlib.OpenDBFromPool(pool.Pool), &pgxmigrate.Config{})
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "pgx5", driver)
+	if err != nil {
+		return nil, err
 	}
+	m.Log = logger{}
+	return m, nil
+}
+
+// run executes a migrate subcommand
+func run(m *migrate.Migrate, args []string) error {
+	switch args[0] {
+	case "up":
+		fmt.Println("Running migrations...")
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+		fmt.Println("Migrations completed successfully!")
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down takes a positive number of migrations, got %q", args[1])
+			}
+			steps = n
+		}
+		fmt.Printf("Rolling back %d migration(s)...\n", steps)
+		if err := m.Steps(-steps); err != nil {
+			return fmt.Errorf("failed to roll back migrations: %w", err)
+		}
+		fmt.Println("Rollback completed successfully!")
 
-	for _, query := range queries {
-		_, err := pool.Exec(
-			context.Background(),
-			query,
-		)
+	case "version":
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Println("No migrations applied")
+			return nil
+		}
 		if err != nil {
-			return fmt.Errorf("failed to execute migration query: %w", err)
+			return fmt.Errorf("failed to read version: %w", err)
 		}
-	}
+		if dirty {
+			fmt.Printf("%d (dirty: the migration failed, repair the database then run force)\n", version)
+			return nil
+		}
+		fmt.Println(version)
+
+	case "force":
+		if len(args) < 2 {
+			return errors.New("force takes the version to record")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := m.Force(version); err != nil {
+			return fmt.Errorf("failed to force version: %w", err)
+		}
+		fmt.Printf("Version set to %d\n", version)
 
+	default:
+		return fmt.Errorf("unknown command %q, expected up, down, version or force", args[0])
+	}
 	return nil
 }
 
+// logger prints each applied migration
+type logger struct{}
+
+func (logger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (logger) Verbose() bool {
+	return false
+}
+
 // getEnvOrDefault returns the environment variable value or a default if not set
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrationsHaveUpAndDown checks that every migration can be applied and
+// rolled back
+func TestMigrationsHaveUpAndDown(t *testing.T) {
+	source, err := iofs.New(os.DirFS("../../migrations"), ".")
+	require.NoError(t, err)
+	defer source.Close()
+
+	var versions []uint
+	version, err := source.First()
+	for err == nil {
+		versions = append(versions, version)
+		for name, read := range map[string]func(uint) (io.ReadCloser, string, error){"up": source.ReadUp, "down": source.ReadDown} {
+			r, identifier, err := read(version)
+			require.NoError(t, err, "migration %d has no %s file", version, name)
+			body, err := io.ReadAll(r)
+			r.Close()
+			require.NoError(t, err)
+			assert.NotEmpty(t, body, "%d_%s.%s.sql is empty", version, identifier, name)
+		}
+		version, err = source.Next(version)
+	}
+	require.True(t, errors.Is(err, os.ErrNotExist), "unexpected error: %v", err)
+	require.NotEmpty(t, versions)
+	assert.Equal(t, uint(1), versions[0])
+}
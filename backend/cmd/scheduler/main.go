@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"citadel-agent/backend/internal/scheduler"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func main() {
+	// Get database URL from environment or use default
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		// Build from environment variables
+		dbHost := getEnvOrDefault("DB_HOST", "localhost")
+		dbPort := getEnvOrDefault("DB_PORT", "5432")
+		dbUser := getEnvOrDefault("DB_USER", "postgres")
+		dbPassword := getEnvOrDefault("DB_PASSWORD", "postgres")
+		dbName := getEnvOrDefault("DB_NAME", "citadel_agent")
+
+		dbURL = "postgresql://" + dbUser + ":" + dbPassword + "@" + dbHost + ":" + dbPort + "/" + dbName
+	}
+
+	pollInterval, err := time.ParseDuration(getEnvOrDefault("SCHEDULER_POLL_INTERVAL", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid SCHEDULER_POLL_INTERVAL: %v", err)
+	}
+
+	overlap, err := scheduler.ParseOverlapPolicy(getEnvOrDefault("SCHEDULER_OVERLAP_POLICY", "skip"))
+	if err != nil {
+		log.Fatalf("Invalid SCHEDULER_OVERLAP_POLICY: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Connect to database
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer pool.Close()
+
+	sched := scheduler.New(
+		scheduler.NewPostgresStore(pool),
+		scheduler.NewPostgresRunner(pool),
+		scheduler.Config{
+			PollInterval: pollInterval,
+			Overlap:      overlap,
+		},
+	)
+
+	fmt.Printf("Scheduler started (poll interval %s, overlap policy %s)\n", pollInterval, overlap)
+
+	if err := sched.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatal("Scheduler stopped:", err)
+	}
+
+	fmt.Println("Scheduler stopped")
+}
+
+// getEnvOrDefault returns the environment variable value or a default if not set
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
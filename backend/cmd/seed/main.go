@@ -2,15 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"citadel-agent/backend/pkg/accounts"
+	"citadel-agent/backend/pkg/database"
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
+	workflowCount := flag.Int("workflows", 1, "number of sample workflows to create, e.g. for load testing")
+	flag.Parse()
+	if *workflowCount < 0 {
+		log.Fatal("-workflows must not be negative")
+	}
+
 	// Get database URL from environment or use default
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -24,8 +34,10 @@ func main() {
 		dbURL = "postgresql://" + dbUser + ":" + dbPassword + "@" + dbHost + ":" + dbPort + "/" + dbName
 	}
 
-	// Connect to database
-	pool, err := pgxpool.New(context.Background(), dbURL)
+	// Connect to database, with the pool settings from CITADEL_DATABASE_*
+	dbConfig := database.FromEnv(database.DefaultConfig())
+	dbConfig.URL = dbURL
+	pool, err := database.NewPool(context.Background(), dbConfig)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -34,7 +46,7 @@ func main() {
 	fmt.Println("Seeding database...")
 
 	// Seed the database
-	err = seedDatabase(pool)
+	err = seedDatabase(pool, *workflowCount)
 	if err != nil {
 		log.Fatal("Failed to seed database:", err)
 	}
@@ -43,7 +55,7 @@ func main() {
 }
 
 // seedDatabase adds initial data to the database
-func seedDatabase(pool *pgxpool.Pool) error {
+func seedDatabase(pool *database.Pool, workflowCount int) error {
 	ctx := context.Background()
 
 	// Create default admin user
@@ -77,41 +89,98 @@ func seedDatabase(pool *pgxpool.Pool) error {
 		adminLastName = "User"
 	}
 
+	// The admin user gets the admin role, also when it exists already
 	_, err = pool.Exec(ctx, `
-		INSERT INTO users (email, username, password_hash, first_name, last_name)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (email) DO NOTHING`,
+		INSERT INTO users (email, username, password_hash, first_name, last_name, roles)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (email) DO UPDATE SET roles = EXCLUDED.roles`,
 		adminEmail,
 		adminUsername,
 		string(hashedPassword),
 		adminFirstName,
 		adminLastName,
+		[]string{accounts.RoleAdmin},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create admin user: %w", err)
 	}
 
-	// Create sample workflow
-	_, err = pool.Exec(ctx, `
-		INSERT INTO workflows (name, description, definition, status) 
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (name) DO NOTHING`,
-		"Sample Workflow",
-		"A basic workflow for testing",
-		`{"nodes": []}`,
-		"active",
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create sample workflow: %w", err)
+	// Create the sample workflows with their nodes and a past execution.
+	// Workflow names are not unique, so existing ones are looked up by name.
+	for i := 1; i <= workflowCount; i++ {
+		name := "Sample Workflow"
+		if i > 1 {
+			name = fmt.Sprintf("Sample Workflow %d", i)
+		}
+		if err := seedWorkflow(ctx, pool, name); err != nil {
+			return fmt.Errorf("failed to create sample workflow %q: %w", name, err)
+		}
 	}
 
 	// Add more seed data as needed
-	fmt.Println("Created admin user: admin@citadel-agent.com with password 'admin123'")
-	fmt.Println("Created sample workflow: 'Sample Workflow'")
+	fmt.Printf("Created admin user: %s\n", adminEmail)
+	fmt.Printf("Created %d sample workflow(s)\n", workflowCount)
 
 	return nil
 }
 
+// sampleDefinition is the definition of the sample workflows: a single
+// logger node
+const sampleDefinition = `{"nodes": [{"id": "log", "type": "logger", "name": "Log", "config": {"level": "info", "message": "Hello from Citadel"}}], "connections": []}`
+
+// seedWorkflow creates the workflow called name unless it exists, then adds
+// its nodes and a sample execution if it has none. Running the seed again
+// leaves existing rows alone.
+func seedWorkflow(ctx context.Context, pool *database.Pool, name string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var workflowID int64
+	err = tx.QueryRow(ctx, `SELECT id FROM workflows WHERE name = $1 ORDER BY id LIMIT 1`, name).Scan(&workflowID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO workflows (name, description, definition, status)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`,
+			name,
+			"A basic workflow for testing",
+			sampleDefinition,
+			"active",
+		).Scan(&workflowID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO nodes (workflow_id, type, config)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM nodes WHERE workflow_id = $1)`,
+		workflowID,
+		"logger",
+		`{"level": "info", "message": "Hello from Citadel"}`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create nodes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO executions (workflow_id, status, triggered_by, definition, started_at, completed_at)
+		SELECT $1, 'succeeded', 'seed', $2, NOW() - INTERVAL '1 minute', NOW()
+		WHERE NOT EXISTS (SELECT 1 FROM executions WHERE workflow_id = $1)`,
+		workflowID,
+		sampleDefinition,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create execution: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
 // getEnvOrDefault returns the environment variable value or a default if not set
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
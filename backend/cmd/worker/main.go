@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"citadel-agent/backend/internal/credentials"
+	"citadel-agent/backend/internal/nodes/builtin"
+	"citadel-agent/backend/internal/plugins"
+	"citadel-agent/backend/internal/worker"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+func main() {
+	// Get database URL from environment or use default
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		// Build from environment variables
+		dbHost := getEnvOrDefault("DB_HOST", "localhost")
+		dbPort := getEnvOrDefault("DB_PORT", "5432")
+		dbUser := getEnvOrDefault("DB_USER", "postgres")
+		dbPassword := getEnvOrDefault("DB_PASSWORD", "postgres")
+		dbName := getEnvOrDefault("DB_NAME", "citadel_agent")
+
+		dbURL = "postgresql://" + dbUser + ":" + dbPassword + "@" + dbHost + ":" + dbPort + "/" + dbName
+	}
+
+	config := worker.FromEnv(worker.DefaultConfig())
+	queueType := getEnvOrDefault("CITADEL_WORKER_TASK_QUEUE_TYPE", worker.QueueDatabase)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Connect to database, which holds the workflows in either case
+	dbConfig := database.FromEnv(database.DefaultConfig())
+	dbConfig.URL = dbURL
+	pool, err := database.NewPool(ctx, dbConfig)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer pool.Close()
+
+	lease := config.Lease()
+
+	var queue worker.Queue
+	switch queueType {
+	case worker.QueueDatabase:
+		queue = worker.NewPostgresQueue(pool, lease)
+	case worker.QueueRedis:
+		client := redis.NewClient(builtin.RedisOptions(getEnvOrDefault("REDIS_URL", os.Getenv("REDIS_ADDR"))))
+		defer client.Close()
+		if err := client.Ping(ctx).Err(); err != nil {
+			log.Fatal("Failed to connect to Redis:", err)
+		}
+		queue = worker.NewRedisQueue(client, worker.DefaultRedisPrefix, lease, worker.DefaultRetention)
+	default:
+		log.Fatalf("Invalid CITADEL_WORKER_TASK_QUEUE_TYPE %q: must be %s or %s", queueType, worker.QueueDatabase, worker.QueueRedis)
+	}
+
+	// Run the same node types as the API server
+	registry := engine.NewNodeTypeRegistry()
+	builtin.Register(registry, builtin.NewMessageBroker(os.Getenv("RABBITMQ_URL")))
+
+	pluginManager := plugins.NewNodeManagerWithOptions(plugins.FromEnv(plugins.DefaultOptions()))
+	defer pluginManager.Close()
+	go pluginManager.Run(ctx, registry)
+
+	executor := engine.NewWorkflowExecutor(registry)
+
+	// Credentials shared with the API server, when a master key is set
+	if masterKey := os.Getenv("CREDENTIALS_MASTER_KEY"); masterKey != "" {
+		cipher, err := credentials.NewCipher(masterKey)
+		if err != nil {
+			log.Fatal("Invalid CREDENTIALS_MASTER_KEY:", err)
+		}
+		executor.SetCredentials(credentials.NewVault(credentials.NewPostgresStore(pool), cipher))
+	}
+
+	runner := worker.NewWorkflowRunner(executor, worker.NewPostgresWorkflows(pool))
+	w := worker.New(queue, runner, config)
+
+	fmt.Printf("Worker started (%s queue, pool size %d, max concurrent tasks %d)\n", queueType, config.PoolSize, config.MaxConcurrentTasks)
+
+	if err := w.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatal("Worker stopped:", err)
+	}
+
+	fmt.Println("Worker stopped")
+}
+
+// getEnvOrDefault returns the environment variable value or a default if not set
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
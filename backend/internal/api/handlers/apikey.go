@@ -1,205 +1,137 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
-	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
-	"gorm.io/gorm"
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/auth"
 )
 
-// APIKeyHandler handles API key operations
+// APIKeysPath is the route users manage their API keys under
+const APIKeysPath = "/api/v1/apikeys"
+
+// APIKeyHandler lets users issue, list and revoke the API keys machine
+// clients authenticate with. A key is only returned when it is issued.
 type APIKeyHandler struct {
-	db *gorm.DB
+	keys *auth.APIKeyService
 }
 
 // NewAPIKeyHandler creates a new API key handler
-func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
-	return &APIKeyHandler{db: db}
+func NewAPIKeyHandler(keys *auth.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
 }
 
-// CreateAPIKey creates a new API key
-// POST /api/v1/apikeys
-func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-
-	// Parse request
-	var req struct {
-		Name        string     `json:"name" validate:"required,min=3,max=100"`
-		Permissions []string   `json:"permissions"`
-		ExpiresAt   *time.Time `json:"expires_at"`
-	}
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
-	}
+// apiKeyRequest is the body of issue requests
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is a duration such as "720h"; keys without one never expire
+	ExpiresIn string `json:"expires_in"`
+}
 
-	// Generate API key
-	// In production, use crypto/rand
-	key := "cta_" + uuid.New().String() // Simplified for now
-
-	// Create API key record
-	apiKey := map[string]interface{}{
-		"id":          uuid.New().String(),
-		"user_id":     userID,
-		"name":        req.Name,
-		"key":         key,
-		"key_prefix":  key[:8],
-		"permissions": req.Permissions,
-		"expires_at":  req.ExpiresAt,
-		"created_at":  time.Now(),
-		"updated_at":  time.Now(),
+// ServeHTTP serves GET and POST /api/v1/apikeys and DELETE
+// /api/v1/apikeys/{id}. Keys belong to the authenticated user.
+func (kh *APIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
 	}
 
-	// Save to database
-	err := h.db.Exec(`
-		INSERT INTO api_keys (id, user_id, name, key, key_prefix, permissions, expires_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, apiKey["id"], apiKey["user_id"], apiKey["name"], apiKey["key"],
-		apiKey["key_prefix"], apiKey["permissions"], apiKey["expires_at"],
-		apiKey["created_at"], apiKey["updated_at"])
-
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create API key",
-		})
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, APIKeysPath), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		kh.ListAPIKeysHandler(w, r, userID)
+	case id == "" && r.Method == http.MethodPost:
+		kh.CreateAPIKeyHandler(w, r, userID)
+	case id == "":
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	case r.Method == http.MethodDelete:
+		kh.RevokeAPIKeyHandler(w, r, userID, id)
+	default:
+		w.Header().Set("Allow", "DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 	}
-
-	// Return response with full key (only time it's shown)
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"id":          apiKey["id"],
-		"name":        apiKey["name"],
-		"key":         key, // Full key only shown on creation
-		"key_prefix":  apiKey["key_prefix"],
-		"permissions": apiKey["permissions"],
-		"expires_at":  apiKey["expires_at"],
-		"created_at":  apiKey["created_at"],
-	})
 }
 
-// ListAPIKeys lists all API keys for the current user
-// GET /api/v1/apikeys
-func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-
-	var keys []map[string]interface{}
-	err := h.db.Exec(`
-		SELECT id, name, key_prefix, permissions, expires_at, last_used_at, created_at
-		FROM api_keys
-		WHERE user_id = $1 AND deleted_at IS NULL
-		ORDER BY created_at DESC
-	`, userID)
-
+// ListAPIKeysHandler returns the user's keys without their secrets
+func (kh *APIKeyHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	keys, err := kh.keys.List(r.Context(), userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch API keys",
-		})
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list API keys: %v", err))
+		return
 	}
 
-	return c.JSON(fiber.Map{
-		"keys": keys,
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"api_keys": keys,
+		"count":    len(keys),
 	})
 }
 
-// GetAPIKey gets a specific API key
-// GET /api/v1/apikeys/:id
-func (h *APIKeyHandler) GetAPIKey(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	keyID := c.Params("id")
-
-	var key map[string]interface{}
-	err := h.db.Exec(`
-		SELECT id, name, key_prefix, permissions, expires_at, last_used_at, created_at
-		FROM api_keys
-		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
-	`, keyID, userID)
-
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "API key not found",
-		})
+// CreateAPIKeyHandler issues a key, which acts with the roles of the user,
+// returning it this once. A request made with an API key can only issue
+// keys with scopes that key has itself.
+func (kh *APIKeyHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request, userID string) {
+	var req apiKeyRequest
+	if !decodeBody(w, r, &req, "Invalid API key request") {
+		return
 	}
 
-	return c.JSON(key)
-}
-
-// RevokeAPIKey revokes (soft deletes) an API key
-// DELETE /api/v1/apikeys/:id
-func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	keyID := c.Params("id")
+	if callerScopes, ok := middleware.APIKeyScopesFromContext(r.Context()); ok {
+		for _, scope := range req.Scopes {
+			if !middleware.ScopesAllow(callerScopes, scope) {
+				writeJSONError(w, http.StatusForbidden, fmt.Sprintf("The API key of this request lacks scope %q", scope))
+				return
+			}
+		}
+	}
 
-	err := h.db.Exec(`
-		UPDATE api_keys
-		SET deleted_at = $1
-		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
-	`, time.Now(), keyID, userID)
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid expires_in %q", req.ExpiresIn))
+			return
+		}
+	}
 
+	secret, key, err := kh.keys.Issue(r.Context(), userID, req.Name, req.Scopes, ttl)
+	if errors.Is(err, auth.ErrAPIKeyName) || errors.Is(err, auth.ErrAPIKeyScopes) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to revoke API key",
-		})
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to issue API key: %v", err))
+		return
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "API key revoked successfully",
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"api_key": key,
+		"key":     secret,
 	})
 }
 
-// RotateAPIKey rotates an API key (creates new, revokes old)
-// PUT /api/v1/apikeys/:id/rotate
-func (h *APIKeyHandler) RotateAPIKey(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	keyID := c.Params("id")
-
-	// Get old key details
-	var oldKey struct {
-		Name        string
-		Permissions []string
-		ExpiresAt   *time.Time
+// RevokeAPIKeyHandler revokes one of the user's keys
+func (kh *APIKeyHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request, userID, id string) {
+	err := kh.keys.Revoke(r.Context(), userID, id)
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		writeJSONError(w, http.StatusNotFound, "API key not found")
+		return
 	}
-
-	err := h.db.Exec(`
-		SELECT name, permissions, expires_at
-		FROM api_keys
-		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
-	`, keyID, userID)
-
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "API key not found",
-		})
-	}
-
-	// Generate new key
-	newKey := "cta_" + uuid.New().String()
-	newKeyID := uuid.New().String()
-
-	// Create new key
-	err = h.db.Exec(`
-		INSERT INTO api_keys (id, user_id, name, key, key_prefix, permissions, expires_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, newKeyID, userID, oldKey.Name+" (rotated)", newKey, newKey[:8],
-		oldKey.Permissions, oldKey.ExpiresAt, time.Now(), time.Now())
-
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create new API key",
-		})
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke API key: %v", err))
+		return
 	}
 
-	// Revoke old key
-	h.db.Exec(`
-		UPDATE api_keys SET deleted_at = $1 WHERE id = $2
-	`, time.Now(), keyID)
-
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"id":         newKeyID,
-		"name":       oldKey.Name + " (rotated)",
-		"key":        newKey, // Full key only shown on creation
-		"key_prefix": newKey[:8],
-		"created_at": time.Now(),
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
 	})
 }
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/auth"
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAPIKeyHandlerShowsKeysOnce(t *testing.T) {
+	ctx := context.Background()
+	authenticator := accounts.NewAuthenticator(accounts.NewMemoryStore(), bcrypt.MinCost)
+	service := auth.NewAPIKeyService(auth.NewMemoryAPIKeyStore(), authenticator)
+	handler := NewAPIKeyHandler(service)
+	alice, err := authenticator.Register(ctx, "alice@example.com", "", "correct horse")
+	require.NoError(t, err)
+	require.NoError(t, authenticator.SetRoles(ctx, alice.ID, []string{accounts.RoleEditor}))
+	aliceID := strconv.FormatInt(alice.ID, 10)
+
+	serve := func(userID, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if userID != "" {
+			req = req.WithContext(middleware.WithUserID(req.Context(), userID))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(aliceID, http.MethodPost, APIKeysPath, `{"name":"ci","scopes":["workflows:write"],"expires_in":"720h"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Key    string       `json:"key"`
+		APIKey *auth.APIKey `json:"api_key"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotNil(t, created.APIKey.ExpiresAt)
+	grant, err := service.ValidateAPIKey(ctx, created.Key)
+	require.NoError(t, err)
+	assert.Equal(t, aliceID, grant.UserID)
+	assert.Equal(t, []string{accounts.RoleEditor}, grant.Roles, "keys have the roles of their owner")
+
+	rec = serve(aliceID, http.MethodGet, APIKeysPath, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), created.APIKey.ID)
+	assert.NotContains(t, rec.Body.String(), created.Key)
+	assert.NotContains(t, serve("bob", http.MethodGet, APIKeysPath, "").Body.String(), created.APIKey.ID)
+
+	assert.Equal(t, http.StatusBadRequest, serve(aliceID, http.MethodPost, APIKeysPath, `{"name":"ci","scopes":["everything"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(aliceID, http.MethodPost, APIKeysPath, `{"name":"ci","scopes":["*"],"expires_in":"soon"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("", http.MethodGet, APIKeysPath, "").Code)
+
+	assert.Equal(t, http.StatusNotFound, serve("bob", http.MethodDelete, APIKeysPath+"/"+created.APIKey.ID, "").Code)
+	assert.Equal(t, http.StatusOK, serve(aliceID, http.MethodDelete, APIKeysPath+"/"+created.APIKey.ID, "").Code)
+	_, err = service.ValidateAPIKey(ctx, created.Key)
+	assert.ErrorIs(t, err, auth.ErrAPIKeyInvalid)
+}
+
+func TestAPIKeysCannotIssueBroaderKeys(t *testing.T) {
+	ctx := context.Background()
+	authenticator := accounts.NewAuthenticator(accounts.NewMemoryStore(), bcrypt.MinCost)
+	service := auth.NewAPIKeyService(auth.NewMemoryAPIKeyStore(), authenticator)
+	handler := NewAPIKeyHandler(service)
+	jwtAuth, err := middleware.NewJWTAuth(middleware.JWTConfig{Secret: strings.Repeat("s", 32), APIKeys: service})
+	require.NoError(t, err)
+	withKey := jwtAuth.HTTP(handler)
+	alice, err := authenticator.Register(ctx, "alice@example.com", "", "correct horse")
+	require.NoError(t, err)
+	aliceID := strconv.FormatInt(alice.ID, 10)
+
+	key, _, err := service.Issue(ctx, aliceID, "ci", []string{"apikeys:write", "workflows:*"}, 0)
+	require.NoError(t, err)
+	issue := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, APIKeysPath, strings.NewReader(body))
+		req.Header.Set("Authorization", "ApiKey "+key)
+		rec := httptest.NewRecorder()
+		withKey.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, issue(`{"name":"wide","scopes":["*"]}`).Code)
+	rec := issue(`{"name":"admin","scopes":["workflows:read","admin:write"]}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "admin:write")
+	assert.Equal(t, http.StatusCreated, issue(`{"name":"narrow","scopes":["workflows:read","apikeys:write"]}`).Code)
+
+	// Requests authenticated otherwise are not limited by key scopes
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, APIKeysPath, strings.NewReader(`{"name":"wide","scopes":["*"]}`))
+	handler.ServeHTTP(rec, req.WithContext(middleware.WithUserID(req.Context(), aliceID)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"citadel-agent/backend/internal/credentials"
+)
+
+// CredentialsPath is the route credentials are managed under
+const CredentialsPath = "/api/v1/credentials"
+
+// CredentialsHandler manages the credentials node configs refer to as
+// {{credentials.<name>}}. Values can be written but are never returned.
+type CredentialsHandler struct {
+	vault *credentials.Vault
+}
+
+// NewCredentialsHandler creates a new credentials handler
+func NewCredentialsHandler(vault *credentials.Vault) *CredentialsHandler {
+	return &CredentialsHandler{vault: vault}
+}
+
+// credentialRequest is the body of create and update requests
+type credentialRequest struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Description string `json:"description"`
+}
+
+// ServeHTTP serves GET and POST /api/v1/credentials and GET, PUT and DELETE
+// /api/v1/credentials/{name}
+func (ch *CredentialsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, CredentialsPath), "/")
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		ch.ListCredentialsHandler(w, r)
+	case name == "" && r.Method == http.MethodPost:
+		ch.CreateCredentialHandler(w, r)
+	case name == "":
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	case r.Method == http.MethodGet:
+		ch.GetCredentialHandler(w, r, name)
+	case r.Method == http.MethodPut:
+		ch.UpdateCredentialHandler(w, r, name)
+	case r.Method == http.MethodDelete:
+		ch.DeleteCredentialHandler(w, r, name)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ListCredentialsHandler returns the credentials without their values
+func (ch *CredentialsHandler) ListCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := ch.vault.List(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list credentials: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"credentials": list,
+		"count":       len(list),
+	})
+}
+
+// CreateCredentialHandler stores a new credential
+func (ch *CredentialsHandler) CreateCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	var req credentialRequest
+	if !decodeBody(w, r, &req, "Invalid credential") {
+		return
+	}
+
+	credential := &credentials.Credential{Name: req.Name, Value: req.Value, Description: req.Description}
+	if err := credential.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err := ch.vault.Create(r.Context(), credential)
+	if errors.Is(err, credentials.ErrExists) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("Credential %s already exists", req.Name))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create credential: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":    true,
+		"credential": credential,
+	})
+}
+
+// GetCredentialHandler returns a credential without its value
+func (ch *CredentialsHandler) GetCredentialHandler(w http.ResponseWriter, r *http.Request, name string) {
+	credential, err := ch.vault.Get(r.Context(), name)
+	if errors.Is(err, credentials.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get credential: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"credential": credential,
+	})
+}
+
+// UpdateCredentialHandler replaces the value and description of a
+// credential
+func (ch *CredentialsHandler) UpdateCredentialHandler(w http.ResponseWriter, r *http.Request, name string) {
+	var req credentialRequest
+	if !decodeBody(w, r, &req, "Invalid credential") {
+		return
+	}
+
+	credential := &credentials.Credential{Name: name, Value: req.Value, Description: req.Description}
+	if err := credential.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err := ch.vault.Update(r.Context(), credential)
+	if errors.Is(err, credentials.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update credential: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"credential": credential,
+	})
+}
+
+// DeleteCredentialHandler removes a credential
+func (ch *CredentialsHandler) DeleteCredentialHandler(w http.ResponseWriter, r *http.Request, name string) {
+	err := ch.vault.Delete(r.Context(), name)
+	if errors.Is(err, credentials.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete credential: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"citadel-agent/backend/internal/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsHandlerNeverReturnsValues(t *testing.T) {
+	cipher, err := credentials.NewCipher(strings.Repeat("k", credentials.MinMasterKeyLength))
+	require.NoError(t, err)
+	vault := credentials.NewVault(credentials.NewMemoryStore(), cipher)
+	handler := NewCredentialsHandler(vault)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, CredentialsPath, `{"name":"github_token","value":"ghp_secret"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "ghp_secret")
+
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, CredentialsPath, `{"name":"github_token","value":"x"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, CredentialsPath, `{"name":"bad name","value":"x"}`).Code)
+
+	rec = serve(http.MethodGet, CredentialsPath, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "github_token")
+	assert.NotContains(t, rec.Body.String(), "ghp_secret")
+
+	rec = serve(http.MethodPut, CredentialsPath+"/github_token", `{"value":"ghp_rotated"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "ghp_rotated")
+	value, err := vault.ResolveCredential(context.Background(), "github_token")
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_rotated", value)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, CredentialsPath+"/github_token", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, CredentialsPath+"/github_token", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPatch, CredentialsPath+"/github_token", "").Code)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"citadel-agent/backend/internal/worker"
+)
+
+// DeadLetterPath is the route the dead-letter queue of the workers is
+// served under
+const DeadLetterPath = "/api/v1/admin/dead-letters"
+
+// DeadLetterHandler lists the jobs the workers gave up on and queues them
+// again
+type DeadLetterHandler struct {
+	queue worker.DeadLetterQueue
+}
+
+// NewDeadLetterHandler creates a new dead-letter handler
+func NewDeadLetterHandler(queue worker.DeadLetterQueue) *DeadLetterHandler {
+	return &DeadLetterHandler{queue: queue}
+}
+
+// ServeHTTP serves GET /api/v1/admin/dead-letters and POST
+// /api/v1/admin/dead-letters/{id}/requeue
+func (dh *DeadLetterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, DeadLetterPath), "/"), "/")
+	switch {
+	case id == "":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		dh.ListDeadLettersHandler(w, r)
+	case action == "requeue":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		dh.RequeueHandler(w, r, id)
+	default:
+		writeJSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// ListDeadLettersHandler returns the dead-lettered jobs, oldest first, with
+// the failures of their attempts
+func (dh *DeadLetterHandler) ListDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	letters, err := dh.queue.DeadLetters(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list dead letters: %v", err))
+		return
+	}
+	if letters == nil {
+		letters = []*worker.DeadLetter{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"dead_letters": letters,
+		"count":        len(letters),
+	})
+}
+
+// RequeueHandler moves a dead-lettered job back to the queue
+func (dh *DeadLetterHandler) RequeueHandler(w http.ResponseWriter, r *http.Request, id string) {
+	job, err := dh.queue.Requeue(r.Context(), id)
+	if errors.Is(err, worker.ErrJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Dead letter not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to requeue job: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
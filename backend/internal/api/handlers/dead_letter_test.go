@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/worker"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterHandlerListsAndRequeues(t *testing.T) {
+	ctx := context.Background()
+	queue := worker.NewMemoryQueue(time.Minute)
+	require.NoError(t, queue.Enqueue(ctx, &worker.Job{WorkflowID: "wf"}))
+	job, err := queue.Dequeue(ctx, "worker")
+	require.NoError(t, err)
+	require.NoError(t, queue.DeadLetter(ctx, job, errors.New("boom")))
+	handler := NewDeadLetterHandler(queue)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DeadLetterPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		DeadLetters []worker.DeadLetter `json:"dead_letters"`
+		Count       int                 `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Count)
+	assert.Equal(t, job.ID, list.DeadLetters[0].Job.ID)
+	assert.Equal(t, "boom", list.DeadLetters[0].Reason)
+	require.Len(t, list.DeadLetters[0].Job.Failures, 1)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, DeadLetterPath+"/"+job.ID+"/requeue", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	requeued, err := queue.Job(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionQueued, requeued.Status)
+
+	// It is no longer dead-lettered
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, DeadLetterPath+"/"+job.ID+"/requeue", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, DeadLetterPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
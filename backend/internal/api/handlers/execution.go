@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// ExecutionPathPrefix is the route prefix executions are served under
+const ExecutionPathPrefix = "/api/v1/executions/"
+
+// ExecutionHandler reports on and cancels workflow executions. It relies on
+// the executor's execution store, where every run is recorded.
+type ExecutionHandler struct {
+	executor *engine.WorkflowExecutor
+}
+
+// NewExecutionHandler creates a new execution handler
+func NewExecutionHandler(executor *engine.WorkflowExecutor) *ExecutionHandler {
+	return &ExecutionHandler{executor: executor}
+}
+
+// ServeHTTP serves GET /api/v1/executions/{id}, GET
+// /api/v1/executions/{id}/events and POST /api/v1/executions/{id}/cancel
+func (eh *ExecutionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, ExecutionPathPrefix), "/"), "/")
+	switch {
+	case id == "":
+		writeJSONError(w, http.StatusNotFound, "Execution not found")
+	case action == "":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		eh.GetExecutionHandler(w, r, id)
+	case action == "cancel":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		eh.CancelExecutionHandler(w, r, id)
+	case action == "events":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		eh.StreamExecutionHandler(w, r, id)
+	default:
+		writeJSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// GetExecutionHandler returns the status of an execution along with the
+// results, timings and errors of the nodes that have run so far
+func (eh *ExecutionHandler) GetExecutionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	execution, err := eh.executor.GetExecution(r.Context(), id)
+	if errors.Is(err, engine.ErrExecutionNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Execution not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load execution: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"execution": execution,
+	})
+}
+
+// CancelExecutionHandler cancels a running execution. The node in flight is
+// told to stop through its context and the execution ends with status
+// cancelled shortly after, so the response is 202 Accepted. Executions that
+// already finished, or were interrupted along with a previous process, are a
+// 409 Conflict.
+func (eh *ExecutionHandler) CancelExecutionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	err := eh.executor.CancelExecution(r.Context(), id)
+	switch {
+	case errors.Is(err, engine.ErrExecutionNotFound):
+		writeJSONError(w, http.StatusNotFound, "Execution not found")
+	case errors.Is(err, engine.ErrExecutionNotRunning):
+		message := "Execution is not running"
+		if execution, err := eh.executor.GetExecution(r.Context(), id); err == nil {
+			message = fmt.Sprintf("Execution is not running (status %s)", execution.Status)
+		}
+		writeJSONError(w, http.StatusConflict, message)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to cancel execution: %v", err))
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"success":      true,
+			"execution_id": id,
+			"status":       "cancelling",
+		})
+	}
+}
+
+// sseKeepAlive is how often an idle event stream sends a comment, so that
+// proxies do not close it
+const sseKeepAlive = 15 * time.Second
+
+// StreamExecutionHandler streams the progress of an execution as
+// Server-Sent Events: node_started, node_completed and node_failed as the
+// nodes run, then execution_finished, after which the stream ends. Events
+// from before the request are not replayed; the execution itself has the
+// results so far. A finished execution only gets its execution_finished
+// event.
+func (eh *ExecutionHandler) StreamExecutionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	// Subscribe before reading the status, so the end of a running
+	// execution cannot be missed
+	events, unsubscribe := eh.executor.Events().Subscribe(id)
+	defer unsubscribe()
+
+	execution, err := eh.executor.GetExecution(r.Context(), id)
+	if errors.Is(err, engine.ErrExecutionNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Execution not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load execution: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if execution.Status != types.ExecutionRunning {
+		writeEvent(w, engine.ExecutionEvent{
+			Type:        engine.EventExecutionFinished,
+			ExecutionID: execution.ID,
+			WorkflowID:  execution.WorkflowID,
+			Status:      string(execution.Status),
+			Error:       execution.Error,
+			Timestamp:   time.Now(),
+		})
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			// The client went away
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				// Finished, or the client fell too far behind
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, event engine.ExecutionEvent) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
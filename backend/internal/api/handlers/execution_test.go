@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitNode runs until its context is cancelled, reporting when it started
+type waitNode struct {
+	started chan struct{}
+}
+
+func (n *waitNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	close(n.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (n *waitNode) GetType() string { return "wait" }
+func (n *waitNode) GetID() string   { return "wait" }
+
+func serveExecution(handler *ExecutionHandler, method, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	var decoded map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &decoded)
+	return rec, decoded
+}
+
+func TestCancelRunningExecution(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	node := &waitNode{started: make(chan struct{})}
+	meta := types.NodeMetadata{ID: "wait"}
+	require.NoError(t, registry.RegisterNodeType("wait", engine.AdaptNode(func(map[string]interface{}) (interfaces.NodeInstance, error) { return node, nil }, meta), meta))
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	handler := NewExecutionHandler(executor)
+
+	id, err := executor.Start(context.Background(), &engine.Workflow{
+		ID:    "wf1",
+		Nodes: map[string]*engine.WorkflowNode{"w": {ID: "w", Type: "wait"}},
+	}, nil)
+	require.NoError(t, err)
+	<-node.started
+
+	rec, decoded := serveExecution(handler, http.MethodGet, ExecutionPathPrefix+id)
+	require.Equal(t, http.StatusOK, rec.Code)
+	execution := decoded["execution"].(map[string]interface{})
+	assert.Equal(t, "running", execution["status"])
+	assert.Equal(t, "running", execution["node_results"].(map[string]interface{})["w"].(map[string]interface{})["status"])
+
+	rec, _ = serveExecution(handler, http.MethodGet, ExecutionPathPrefix+id+"/cancel")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec, decoded = serveExecution(handler, http.MethodPost, ExecutionPathPrefix+id+"/cancel")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, id, decoded["execution_id"])
+
+	require.Eventually(t, func() bool {
+		_, decoded := serveExecution(handler, http.MethodGet, ExecutionPathPrefix+id)
+		return decoded["execution"].(map[string]interface{})["status"] == "cancelled"
+	}, time.Second, time.Millisecond)
+	_, decoded = serveExecution(handler, http.MethodGet, ExecutionPathPrefix+id)
+	execution = decoded["execution"].(map[string]interface{})
+	assert.NotEmpty(t, execution["completed_at"])
+	assert.Contains(t, execution["error"], "context canceled")
+
+	rec, decoded = serveExecution(handler, http.MethodPost, ExecutionPathPrefix+id+"/cancel")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, decoded["error"], "cancelled")
+
+	rec, _ = serveExecution(handler, http.MethodGet, ExecutionPathPrefix+"exec_404")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = serveExecution(handler, http.MethodPost, ExecutionPathPrefix+"exec_404/cancel")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// stepNode completes immediately, or fails when configured to
+type stepNode struct {
+	fail bool
+}
+
+func (n *stepNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	if n.fail {
+		return nil, errors.New("step failed")
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (n *stepNode) GetType() string { return "step" }
+func (n *stepNode) GetID() string   { return "step" }
+
+func TestStreamExecutionEvents(t *testing.T) {
+	// Nodes are constructed once the gate opens, so the stream is
+	// subscribed before the first event
+	gate := make(chan struct{})
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "step"}
+	require.NoError(t, registry.RegisterNodeType("step", engine.AdaptNode(func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		<-gate
+		fail, _ := config["fail"].(bool)
+		return &stepNode{fail: fail}, nil
+	}, meta), meta))
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(engine.RetryPolicy{})
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	server := httptest.NewServer(NewExecutionHandler(executor))
+	t.Cleanup(server.Close)
+
+	id, err := executor.Start(context.Background(), &engine.Workflow{
+		ID: "wf1",
+		Nodes: map[string]*engine.WorkflowNode{
+			"a": {ID: "a", Type: "step"},
+			"b": {ID: "b", Type: "step"},
+			"c": {ID: "c", Type: "step", Config: map[string]interface{}{"fail": true}},
+		},
+		Edges: []engine.WorkflowEdge{
+			{ID: "e1", Source: "a", Target: "b"},
+			{ID: "e2", Source: "b", Target: "c"},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	resp, err := http.Get(server.URL + ExecutionPathPrefix + id + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	close(gate)
+
+	// The stream ends after the final event
+	var received []string
+	var last engine.ExecutionEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			last = engine.ExecutionEvent{}
+			require.NoError(t, json.Unmarshal([]byte(data), &last))
+			received = append(received, string(last.Type)+" "+last.NodeID)
+		}
+	}
+	assert.Equal(t, []string{
+		"node_started a", "node_completed a",
+		"node_started b", "node_completed b",
+		"node_started c", "node_failed c",
+		"execution_finished ",
+	}, received)
+	assert.Equal(t, "failed", last.Status)
+	assert.Equal(t, id, last.ExecutionID)
+
+	// A finished execution gets its final event right away
+	resp, err = http.Get(server.URL + ExecutionPathPrefix + id + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	scanner = bufio.NewScanner(resp.Body)
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "event: execution_finished", scanner.Text())
+}
+
+func TestStreamExecutionEventsWithStreamToken(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "step"}
+	require.NoError(t, registry.RegisterNodeType("step", engine.AdaptNode(func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		return &stepNode{}, nil
+	}, meta), meta))
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	run, err := executor.Run(context.Background(), &engine.Workflow{
+		ID:    "wf1",
+		Nodes: map[string]*engine.WorkflowNode{"a": {ID: "a", Type: "step"}},
+	}, nil)
+	require.NoError(t, err)
+
+	// Browsers open the stream with EventSource, which cannot set headers
+	auth, err := middleware.NewJWTAuth(middleware.JWTConfig{
+		Secret:      "test-secret-at-least-32-characters!!",
+		StreamPaths: []string{ExecutionPathPrefix + "*"},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(auth.HTTP(NewExecutionHandler(executor)))
+	t.Cleanup(server.Close)
+	events := server.URL + ExecutionPathPrefix + run.ExecutionID + "/events"
+
+	resp, err := http.Get(events)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	token, err := auth.IssueStreamToken("user-1", "viewer")
+	require.NoError(t, err)
+	resp, err = http.Get(events + "?access_token=" + token)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	scanner := bufio.NewScanner(resp.Body)
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "event: execution_finished", scanner.Text())
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+)
+
+// HealthPath is the route health checks and `citadel status` call
+const HealthPath = "/health"
+
+// HealthHandler reports that the server is up, for how long and with how
+// many node types
+type HealthHandler struct {
+	registry *engine.NodeTypeRegistryImpl
+	started  time.Time
+}
+
+// NewHealthHandler creates a health handler whose uptime starts now
+func NewHealthHandler(registry *engine.NodeTypeRegistryImpl) *HealthHandler {
+	return &HealthHandler{registry: registry, started: time.Now()}
+}
+
+// ServeHTTP serves GET /health
+func (hh *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":                "ok",
+		"service":               "citadel-api",
+		"timestamp":             time.Now().Unix(),
+		"uptime":                time.Since(hh.started).Round(time.Second).String(),
+		"node_types_registered": len(hh.registry.ListNodeTypes()),
+	})
+}
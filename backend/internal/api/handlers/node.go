@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 
 	"citadel-agent/backend/internal/workflow/core/engine"
 	"citadel-agent/backend/internal/workflow/core/types"
@@ -23,15 +24,35 @@ func NewNodeHandler(registry *engine.NodeTypeRegistryImpl) *NodeHandler {
 	}
 }
 
-// ListNodesHandler returns all available node types
+// ListNodesHandler returns the available node types with their metadata,
+// grouped by category, for the frontend palette and property panel. The
+// category query parameter limits them to a single category.
 func (nh *NodeHandler) ListNodesHandler(w http.ResponseWriter, r *http.Request) {
-	nodeTypes := nh.registry.ListNodeTypes()
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"nodes": nodeTypes,
-		"count": len(nodeTypes),
-	})
+	json.NewEncoder(w).Encode(NodeCatalog(nh.registry, r.URL.Query().Get("category")))
+}
+
+// NodeCatalog lists the node types of registry in category, or all of them
+// when it is empty, sorted by ID and grouped by category
+func NodeCatalog(registry *engine.NodeTypeRegistryImpl, category string) map[string]interface{} {
+	nodeTypes := make([]types.NodeMetadata, 0)
+	categories := make(map[string][]types.NodeMetadata)
+	for _, metadata := range registry.ListNodeTypes() {
+		if category != "" && metadata.Category != category {
+			continue
+		}
+		nodeTypes = append(nodeTypes, metadata)
+	}
+	sort.Slice(nodeTypes, func(i, j int) bool { return nodeTypes[i].ID < nodeTypes[j].ID })
+	for _, metadata := range nodeTypes {
+		categories[metadata.Category] = append(categories[metadata.Category], metadata)
+	}
+
+	return map[string]interface{}{
+		"nodes":      nodeTypes,
+		"categories": categories,
+		"count":      len(nodeTypes),
+	}
 }
 
 // GetNodeHandler returns details for a specific node type
@@ -65,23 +86,27 @@ func (nh *NodeHandler) RegisterNodeHandler(w http.ResponseWriter, r *http.Reques
 		Inputs      map[string]interface{} `json:"inputs"`
 		Outputs     map[string]interface{} `json:"outputs"`
 		Icon        string                 `json:"icon"`
+		// JSON Schemas of the node's input and output data
+		InputSchema  map[string]interface{} `json:"input_schema"`
+		OutputSchema map[string]interface{} `json:"output_schema"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		http.Error(w, "Invalid node configuration", http.StatusBadRequest)
+	if !decodeBody(w, r, &config, "Invalid node configuration") {
 		return
 	}
 
 	// For now, we just register a mock node
 	// In a real implementation, we would need to load and register an actual node implementation
 	metadata := types.NodeMetadata{
-		ID:          config.ID,
-		Name:        config.Name,
-		Category:    config.Category,
-		Description: config.Description,
-		Inputs:      config.Inputs,
-		Outputs:     config.Outputs,
-		Icon:        config.Icon,
+		ID:           config.ID,
+		Name:         config.Name,
+		Category:     config.Category,
+		Description:  config.Description,
+		Inputs:       config.Inputs,
+		Outputs:      config.Outputs,
+		Icon:         config.Icon,
+		InputSchema:  config.InputSchema,
+		OutputSchema: config.OutputSchema,
 	}
 
 	// Register the node type (with a mock creator function)
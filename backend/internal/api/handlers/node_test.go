@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citadel-agent/backend/internal/nodes/builtin"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListNodesHandlerExposesSchemas(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("send_email", nil, types.NodeMetadata{
+		ID: "send_email",
+		InputSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []string{"to"},
+		},
+		OutputSchema: map[string]interface{}{"type": "object"},
+	}))
+	handler := NewNodeHandler(registry)
+
+	rec := httptest.NewRecorder()
+	handler.ListNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/nodes", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Nodes []types.NodeMetadata `json:"nodes"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Nodes, 1)
+	assert.Equal(t, map[string]interface{}{"type": "object", "required": []interface{}{"to"}}, body.Nodes[0].InputSchema)
+	assert.Equal(t, map[string]interface{}{"type": "object"}, body.Nodes[0].OutputSchema)
+}
+
+func TestListNodesHandlerGroupsBuiltinNodesByCategory(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	builtin.Register(registry, nil)
+	handler := NewNodeHandler(registry)
+
+	rec := httptest.NewRecorder()
+	handler.ListNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/registry/nodes?category=http", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Nodes      []types.NodeMetadata            `json:"nodes"`
+		Categories map[string][]types.NodeMetadata `json:"categories"`
+		Count      int                             `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, len(body.Nodes), body.Count)
+	assert.Len(t, body.Categories, 1, "other categories are filtered out")
+	assert.Len(t, body.Categories["http"], body.Count)
+
+	var httpRequest *types.NodeMetadata
+	for i, node := range body.Nodes {
+		assert.Equal(t, "http", node.Category)
+		if node.ID == "http_request" {
+			httpRequest = &body.Nodes[i]
+		}
+	}
+	require.NotNil(t, httpRequest)
+	assert.Equal(t, "HTTP Request", httpRequest.Name)
+	assert.NotEmpty(t, httpRequest.Description)
+
+	properties, ok := httpRequest.Inputs["properties"].(map[string]interface{})
+	require.True(t, ok, "the parameters of the HTTP node are described")
+	method := properties["method"].(map[string]interface{})
+	assert.Equal(t, "GET", method["default"])
+	assert.Contains(t, method["enum"], "POST")
+	assert.Equal(t, "string", properties["url"].(map[string]interface{})["type"])
+	assert.Equal(t, []interface{}{"url"}, httpRequest.Inputs["required"])
+	assert.NotEmpty(t, httpRequest.OutputSchema)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"citadel-agent/backend/internal/plugins"
+)
+
+// AdminPathPrefix is the route administration endpoints are served under
+const AdminPathPrefix = "/api/v1/admin"
+
+// PluginAdminPath is the route plugin administration is served under
+const PluginAdminPath = AdminPathPrefix + "/plugins"
+
+// PluginHandler reports on the plugins of a node manager
+type PluginHandler struct {
+	manager *plugins.NodeManager
+}
+
+// NewPluginHandler creates a new plugin handler
+func NewPluginHandler(manager *plugins.NodeManager) *PluginHandler {
+	return &PluginHandler{manager: manager}
+}
+
+// ListPluginsHandler serves GET /api/v1/admin/plugins: the loaded plugins
+// and the signature check of every plugin file found, including the ones
+// that were refused
+func (ph *PluginHandler) ListPluginsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"plugins":       ph.manager.Plugins(),
+		"verifications": ph.manager.Verifications(),
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"citadel-agent/backend/internal/plugins"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPluginsReportsVerifications(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tampered"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tampered"+plugins.SignatureExtension), []byte("bm90IGEgc2lnbmF0dXJl\n"), 0o644))
+
+	manager := plugins.NewNodeManagerWithOptions(plugins.Options{Directories: []string{dir}})
+	defer manager.Close()
+	require.Len(t, manager.Scan(engine.NewNodeTypeRegistry()), 1)
+	handler := NewPluginHandler(manager)
+
+	rec := httptest.NewRecorder()
+	handler.ListPluginsHandler(rec, httptest.NewRequest(http.MethodGet, PluginAdminPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Plugins       []plugins.NodeMetadata `json:"plugins"`
+		Verifications []plugins.Verification `json:"verifications"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Empty(t, body.Plugins)
+	require.Len(t, body.Verifications, 1)
+	assert.Equal(t, plugins.VerificationInvalid, body.Verifications[0].Status)
+	assert.Contains(t, body.Verifications[0].Error, "malformed signature file")
+
+	rec = httptest.NewRecorder()
+	handler.ListPluginsHandler(rec, httptest.NewRequest(http.MethodPost, PluginAdminPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"citadel-agent/backend/internal/nodes/queue"
+	"citadel-agent/backend/internal/workflow/core/engine"
+)
+
+// QueueConsumers starts a workflow per message of the queues named by the
+// workflow's message_queue consume nodes. Deploying a workflow starts its
+// consumers and deleting it stops them.
+//
+// With manual acks a message is acknowledged once its workflow succeeds. A
+// failed one is requeued the first time and rejected, so dead-lettered if
+// the queue is set up to, when it fails again.
+type QueueConsumers struct {
+	executor  *engine.WorkflowExecutor
+	broker    queue.Broker
+	mu        sync.Mutex
+	consumers map[string][]context.CancelFunc // by workflow ID
+	wg        sync.WaitGroup
+}
+
+// NewQueueConsumers creates the consumers of workflows on broker. broker
+// may be nil, in which case workflows with consume nodes are rejected.
+func NewQueueConsumers(executor *engine.WorkflowExecutor, broker queue.Broker) *QueueConsumers {
+	return &QueueConsumers{
+		executor:  executor,
+		broker:    broker,
+		consumers: make(map[string][]context.CancelFunc),
+	}
+}
+
+// RegisterWorkflow starts the consumers of a deployed workflow, replacing
+// those of a previous version of it
+func (qc *QueueConsumers) RegisterWorkflow(workflow *engine.Workflow) error {
+	var nodes []*queue.MessageQueueNode
+	for nodeID, node := range workflow.Nodes {
+		if node.Type != queue.MessageQueueNodeType {
+			continue
+		}
+		instance, err := queue.NewMessageQueueNode(nil)(node.Config)
+		if err != nil {
+			return fmt.Errorf("invalid message queue node %s: %w", nodeID, err)
+		}
+		if mq := instance.(*queue.MessageQueueNode); mq.Operation() == queue.OperationConsume {
+			nodes = append(nodes, mq)
+		}
+	}
+	if len(nodes) > 0 && qc.broker == nil {
+		return fmt.Errorf("workflow %s consumes messages but no message broker is configured", workflow.ID)
+	}
+
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	qc.stopLocked(workflow.ID)
+	for _, node := range nodes {
+		ctx, cancel := context.WithCancel(context.Background())
+		qc.consumers[workflow.ID] = append(qc.consumers[workflow.ID], cancel)
+		qc.wg.Add(1)
+		go func(node *queue.MessageQueueNode) {
+			defer qc.wg.Done()
+			qc.consume(ctx, workflow, node)
+		}(node)
+	}
+	return nil
+}
+
+// UnregisterWorkflow stops the consumers of a workflow. Workflows already
+// started by them run to completion.
+func (qc *QueueConsumers) UnregisterWorkflow(workflowID string) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	qc.stopLocked(workflowID)
+}
+
+func (qc *QueueConsumers) stopLocked(workflowID string) {
+	for _, cancel := range qc.consumers[workflowID] {
+		cancel()
+	}
+	delete(qc.consumers, workflowID)
+}
+
+// Close stops every consumer and waits for the workflows they started
+func (qc *QueueConsumers) Close() {
+	qc.mu.Lock()
+	for workflowID := range qc.consumers {
+		qc.stopLocked(workflowID)
+	}
+	qc.mu.Unlock()
+	qc.wg.Wait()
+}
+
+// consume runs the workflow for the messages of node's queue, at most
+// node.BatchSize() at a time, until ctx is done
+func (qc *QueueConsumers) consume(ctx context.Context, workflow *engine.Workflow, node *queue.MessageQueueNode) {
+	batch := make(chan struct{}, node.BatchSize())
+	err := qc.broker.Consume(ctx, node.Queue(), node.BatchSize(), func(d *queue.Delivery) {
+		select {
+		case batch <- struct{}{}:
+		case <-ctx.Done():
+			d.Nack(true)
+			return
+		}
+		qc.wg.Add(1)
+		go func() {
+			defer func() {
+				<-batch
+				qc.wg.Done()
+			}()
+			qc.process(workflow, node, d)
+		}()
+	})
+	if err != nil {
+		log.Printf("Consumer of queue %s for workflow %s stopped: %v", node.Queue(), workflow.ID, err)
+	}
+}
+
+// process runs the workflow for one message and settles it
+func (qc *QueueConsumers) process(workflow *engine.Workflow, node *queue.MessageQueueNode, d *queue.Delivery) {
+	if node.AckMode() == queue.AckAuto {
+		if err := d.Ack(); err != nil {
+			log.Printf("Failed to acknowledge message of queue %s: %v", d.Queue, err)
+			return
+		}
+	}
+
+	_, err := qc.executor.Run(context.Background(), workflow, queue.DeliveryInputs(d))
+	if node.AckMode() == queue.AckAuto {
+		if err != nil {
+			log.Printf("Workflow %s failed for a message of queue %s: %v", workflow.ID, d.Queue, err)
+		}
+		return
+	}
+
+	if err == nil {
+		err = d.Ack()
+	} else {
+		log.Printf("Workflow %s failed for a message of queue %s (redelivered: %t): %v", workflow.ID, d.Queue, d.Redelivered, err)
+		err = d.Nack(!d.Redelivered)
+	}
+	if err != nil {
+		// The message is delivered again once the broker notices
+		log.Printf("Failed to settle message of queue %s: %v", d.Queue, err)
+	}
+}
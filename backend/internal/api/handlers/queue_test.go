@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/nodes/queue"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBroker is a Broker whose queues are channels. Requeued messages
+// are delivered again, marked redelivered.
+type memoryBroker struct {
+	mu     sync.Mutex
+	queues map[string]chan *queue.Delivery
+	acked  []string
+	dead   []string
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{queues: make(map[string]chan *queue.Delivery)}
+}
+
+func (b *memoryBroker) queue(name string) chan *queue.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.queues[name] == nil {
+		b.queues[name] = make(chan *queue.Delivery, 100)
+	}
+	return b.queues[name]
+}
+
+func (b *memoryBroker) deliver(name string, msg queue.Message, redelivered bool) {
+	d := queue.NewDelivery(name, msg, func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.acked = append(b.acked, string(msg.Body))
+		return nil
+	}, func(requeue bool) error {
+		if requeue {
+			b.deliver(name, msg, true)
+			return nil
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.dead = append(b.dead, string(msg.Body))
+		return nil
+	})
+	d.Redelivered = redelivered
+	b.queue(name) <- d
+}
+
+func (b *memoryBroker) Publish(ctx context.Context, name string, msg queue.Message) error {
+	b.deliver(name, msg, false)
+	return nil
+}
+
+func (b *memoryBroker) Consume(ctx context.Context, name string, prefetch int, handle func(*queue.Delivery)) error {
+	deliveries := b.queue(name)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d := <-deliveries:
+			handle(d)
+		}
+	}
+}
+
+func (b *memoryBroker) Close() error { return nil }
+
+func (b *memoryBroker) settled() (acked, dead []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.acked...), append([]string(nil), b.dead...)
+}
+
+// orderNode fails for orders marked "fail", on their first delivery only
+// unless marked "always"
+type orderNode struct {
+	mu        sync.Mutex
+	processed []string
+}
+
+func (n *orderNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	body, _ := inputs["body"].(map[string]interface{})
+	redelivered, _ := inputs["redelivered"].(bool)
+	if fail, _ := body["fail"].(string); fail == "always" || fail == "once" && !redelivered {
+		return nil, errors.New("order rejected")
+	}
+	id, _ := json.Marshal(body["id"])
+	n.mu.Lock()
+	n.processed = append(n.processed, string(id))
+	n.mu.Unlock()
+	return map[string]interface{}{}, nil
+}
+
+func (n *orderNode) GetType() string { return "order" }
+func (n *orderNode) GetID() string   { return "order" }
+
+func (n *orderNode) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.processed)
+}
+
+func newQueueConsumers(t *testing.T, broker queue.Broker, orders *orderNode) *WorkflowHandler {
+	t.Helper()
+	registry := engine.NewNodeTypeRegistry()
+	for _, nt := range []struct {
+		constructor engine.NodeConstructor
+		id          string
+	}{
+		{queue.NewMessageQueueNode(broker), queue.MessageQueueNodeType},
+		{func(map[string]interface{}) (interfaces.NodeInstance, error) { return orders, nil }, "order"},
+	} {
+		meta := types.NodeMetadata{ID: nt.id}
+		require.NoError(t, registry.RegisterNodeType(nt.id, engine.AdaptNode(nt.constructor, meta), meta))
+	}
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(engine.RetryPolicy{})
+
+	consumers := NewQueueConsumers(executor, broker)
+	t.Cleanup(consumers.Close)
+	return NewWorkflowHandler(executor, consumers)
+}
+
+const orderWorkflow = `{"id":"orders","nodes":{
+	"in":{"id":"in","type":"message_queue","config":{"operation":"consume","queue":"orders","ack":"%s","batch_size":4}},
+	"order":{"id":"order","type":"order"}
+},"edges":[{"id":"e1","source":"in","target":"order"}]}`
+
+func TestQueueConsumersProcessMessagesAtLeastOnce(t *testing.T) {
+	broker := newMemoryBroker()
+	orders := &orderNode{}
+	workflows := newQueueConsumers(t, broker, orders)
+
+	rec := serveWorkflow(workflows, http.MethodPost, "/api/workflows", fmt.Sprintf(orderWorkflow, queue.AckManual))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	for _, body := range []string{`{"id":1}`, `{"id":2,"fail":"once"}`, `{"id":3,"fail":"always"}`} {
+		require.NoError(t, broker.Publish(context.Background(), "orders", queue.Message{Body: []byte(body), ContentType: "application/json"}))
+	}
+
+	// The order failing once is retried; the one always failing is dead
+	// lettered after its redelivery
+	require.Eventually(t, func() bool {
+		acked, dead := broker.settled()
+		return len(acked) == 2 && len(dead) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	acked, dead := broker.settled()
+	assert.ElementsMatch(t, []string{`{"id":1}`, `{"id":2,"fail":"once"}`}, acked)
+	assert.Equal(t, []string{`{"id":3,"fail":"always"}`}, dead)
+	assert.Equal(t, 2, orders.count())
+
+	// Deleting the workflow stops its consumer
+	rec = serveWorkflow(workflows, http.MethodDelete, "/api/workflows/orders", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, broker.Publish(context.Background(), "orders", queue.Message{Body: []byte(`{"id":4}`)}))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, orders.count())
+}
+
+func TestQueueConsumersAutoAck(t *testing.T) {
+	broker := newMemoryBroker()
+	orders := &orderNode{}
+	workflows := newQueueConsumers(t, broker, orders)
+
+	rec := serveWorkflow(workflows, http.MethodPost, "/api/workflows", fmt.Sprintf(orderWorkflow, queue.AckAuto))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	// Messages are acknowledged on receipt, so a failure is not retried
+	require.NoError(t, broker.Publish(context.Background(), "orders", queue.Message{Body: []byte(`{"id":1,"fail":"once"}`)}))
+	require.Eventually(t, func() bool {
+		acked, _ := broker.settled()
+		return len(acked) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, orders.count())
+	_, dead := broker.settled()
+	assert.Empty(t, dead)
+}
+
+func TestQueueConsumersRequireBroker(t *testing.T) {
+	workflows := newQueueConsumers(t, nil, &orderNode{})
+	rec := serveWorkflow(workflows, http.MethodPost, "/api/workflows", fmt.Sprintf(orderWorkflow, queue.AckManual))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no message broker is configured")
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"citadel-agent/backend/internal/temporal"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// TemporalExecutionPath is the route executions are started on through the
+// Temporal service, and the prefix of the routes of each execution
+const TemporalExecutionPath = "/api/v1/temporal/executions"
+
+// TemporalService starts, signals, queries and cancels executions, e.g.
+// temporal.Service, which runs them on Temporal or in process when
+// Temporal is not reachable
+type TemporalService interface {
+	Start(ctx context.Context, workflow *engine.Workflow, inputs map[string]interface{}) (string, error)
+	Signal(ctx context.Context, executionID, nodeID string, response types.PromptResponse) error
+	Query(ctx context.Context, executionID string) (*types.Execution, error)
+	Cancel(ctx context.Context, executionID string) error
+}
+
+// TemporalHandler serves the executions of deployed workflows run through
+// a TemporalService
+type TemporalHandler struct {
+	service   TemporalService
+	workflows *WorkflowHandler
+}
+
+// NewTemporalHandler creates a handler starting the workflows deployed
+// through workflows on service
+func NewTemporalHandler(service TemporalService, workflows *WorkflowHandler) *TemporalHandler {
+	return &TemporalHandler{service: service, workflows: workflows}
+}
+
+// ServeHTTP serves POST /api/v1/temporal/executions,
+// GET /api/v1/temporal/executions/{id},
+// POST /api/v1/temporal/executions/{id}/signal and
+// POST /api/v1/temporal/executions/{id}/cancel
+func (th *TemporalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, TemporalExecutionPath), "/"), "/")
+	method := http.MethodPost
+	if id != "" && action == "" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	switch {
+	case id == "":
+		th.StartExecutionHandler(w, r)
+	case action == "":
+		th.QueryExecutionHandler(w, r, id)
+	case action == "signal":
+		th.SignalExecutionHandler(w, r, id)
+	case action == "cancel":
+		th.CancelExecutionHandler(w, r, id)
+	default:
+		writeJSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// StartExecutionHandler starts an execution of a deployed workflow, given
+// as {"workflow_id": ..., "inputs": {...}}. "temporal" tells whether it runs
+// on Temporal or, with Temporal unreachable, in process.
+func (th *TemporalHandler) StartExecutionHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		WorkflowID string                 `json:"workflow_id"`
+		Inputs     map[string]interface{} `json:"inputs"`
+	}
+	if !decodeBody(w, r, &req, "Invalid request body") {
+		return
+	}
+	deployed, exists := th.workflows.lookup(req.WorkflowID)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "Workflow not found")
+		return
+	}
+	if req.Inputs == nil {
+		req.Inputs = make(map[string]interface{})
+	}
+
+	id, err := th.service.Start(runContext(r.Context()), deployed.Workflow, req.Inputs)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to start execution: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success":      true,
+		"execution_id": id,
+		"workflow_id":  req.WorkflowID,
+		"temporal":     strings.HasPrefix(id, temporal.ExecutionIDPrefix),
+	})
+}
+
+// QueryExecutionHandler returns the status of an execution along with the
+// results of the nodes that have run so far
+func (th *TemporalHandler) QueryExecutionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	execution, err := th.service.Query(r.Context(), id)
+	if err != nil {
+		writeTemporalError(w, err, "Failed to query execution")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"execution": execution,
+	})
+}
+
+// SignalExecutionHandler answers the prompt of a node waiting for a person,
+// given as {"node_id": ..., "approved": ..., "comment": ..., "data": {...}}
+func (th *TemporalHandler) SignalExecutionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		NodeID string `json:"node_id"`
+		types.PromptResponse
+	}
+	if !decodeBody(w, r, &req, "Invalid request body") {
+		return
+	}
+	if req.NodeID == "" {
+		writeJSONError(w, http.StatusBadRequest, "node_id is required")
+		return
+	}
+
+	if err := th.service.Signal(r.Context(), id, req.NodeID, req.PromptResponse); err != nil {
+		writeTemporalError(w, err, "Failed to signal execution")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success":      true,
+		"execution_id": id,
+		"node_id":      req.NodeID,
+	})
+}
+
+// CancelExecutionHandler cancels a running execution. It ends with status
+// cancelled once the node in flight has stopped, so the response is 202
+// Accepted.
+func (th *TemporalHandler) CancelExecutionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if err := th.service.Cancel(r.Context(), id); err != nil {
+		writeTemporalError(w, err, "Failed to cancel execution")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success":      true,
+		"execution_id": id,
+		"status":       "cancelling",
+	})
+}
+
+// writeTemporalError answers with the status matching err
+func writeTemporalError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, engine.ErrExecutionNotFound):
+		writeJSONError(w, http.StatusNotFound, "Execution not found")
+	case errors.Is(err, engine.ErrExecutionNotRunning):
+		writeJSONError(w, http.StatusConflict, "Execution is not running")
+	case errors.Is(err, engine.ErrPromptNotFound):
+		writeJSONError(w, http.StatusConflict, "Node is not waiting for a response")
+	case errors.Is(err, temporal.ErrUnavailable):
+		writeJSONError(w, http.StatusServiceUnavailable, "Temporal is not reachable")
+	default:
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %v", message, err))
+	}
+}
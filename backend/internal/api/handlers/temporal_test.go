@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/temporal"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveTemporal(handler *TemporalHandler, method, target, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	var decoded map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &decoded)
+	return rec, decoded
+}
+
+func TestTemporalExecutionRoutes(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "approval"}
+	require.NoError(t, registry.RegisterNodeType("approval", engine.AdaptNode(utility.NewApprovalNode, meta), meta))
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	workflows := NewWorkflowHandler(executor)
+	workflows.add(&engine.Workflow{
+		ID:    "refund",
+		Nodes: map[string]*engine.WorkflowNode{"review": {ID: "review", Type: "approval"}},
+	}, nil)
+
+	// Without Temporal, executions run in process
+	handler := NewTemporalHandler(temporal.NewService(nil, temporal.DefaultConfig(), executor), workflows)
+
+	rec, decoded := serveTemporal(handler, http.MethodPost, TemporalExecutionPath, `{"workflow_id": "refund"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	assert.Equal(t, false, decoded["temporal"])
+	id := decoded["execution_id"].(string)
+	path := TemporalExecutionPath + "/" + id
+
+	require.Eventually(t, func() bool {
+		rec, _ := serveTemporal(handler, http.MethodPost, path+"/signal", `{"node_id": "review", "approved": true, "comment": "ok"}`)
+		return rec.Code == http.StatusAccepted
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, decoded := serveTemporal(handler, http.MethodGet, path, "")
+		execution, _ := decoded["execution"].(map[string]interface{})
+		return execution["status"] == string(types.ExecutionSucceeded)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rec, _ = serveTemporal(handler, http.MethodPost, path+"/cancel", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec, _ = serveTemporal(handler, http.MethodPost, path+"/signal", `{"node_id": "review"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec, _ = serveTemporal(handler, http.MethodPost, path+"/signal", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, _ = serveTemporal(handler, http.MethodPost, TemporalExecutionPath, `{"workflow_id": "missing"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = serveTemporal(handler, http.MethodGet, TemporalExecutionPath+"/exec_missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = serveTemporal(handler, http.MethodGet, TemporalExecutionPath+"/"+temporal.ExecutionIDPrefix+"1", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec, _ = serveTemporal(handler, http.MethodGet, TemporalExecutionPath, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/nodes/trigger"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/pkg/tracecontext"
+)
+
+// WebhookPathPrefix is the route prefix inbound webhooks are served under
+const WebhookPathPrefix = "/api/v1/webhooks/"
+
+// maxWebhookBodySize bounds the request body read for a webhook
+const maxWebhookBodySize = 10 << 20
+
+// webhookTrigger is a registered webhook_trigger node
+type webhookTrigger struct {
+	workflow *engine.Workflow
+	nodeID   string
+	node     *trigger.WebhookTriggerNode
+}
+
+// WebhookHandler routes inbound webhooks to the workflows that declare a
+// matching webhook_trigger node
+type WebhookHandler struct {
+	executor *engine.WorkflowExecutor
+	mu       sync.RWMutex
+	triggers map[string]*webhookTrigger // keyed by workflow ID + "/" + path
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(executor *engine.WorkflowExecutor) *WebhookHandler {
+	return &WebhookHandler{
+		executor: executor,
+		triggers: make(map[string]*webhookTrigger),
+	}
+}
+
+// RegisterWorkflow registers the webhook triggers of a deployed workflow,
+// replacing any registered for a previous version of it
+func (wh *WebhookHandler) RegisterWorkflow(workflow *engine.Workflow) error {
+	triggers := make(map[string]*webhookTrigger)
+	for nodeID, node := range workflow.Nodes {
+		if node.Type != trigger.WebhookTriggerNodeType {
+			continue
+		}
+
+		instance, err := trigger.NewWebhookTriggerNode(node.Config)
+		if err != nil {
+			return fmt.Errorf("invalid webhook trigger %s: %w", nodeID, err)
+		}
+		webhookNode := instance.(*trigger.WebhookTriggerNode)
+
+		key := workflow.ID + "/" + webhookNode.Path()
+		if _, exists := triggers[key]; exists {
+			return fmt.Errorf("duplicate webhook path %q in workflow %s", webhookNode.Path(), workflow.ID)
+		}
+		triggers[key] = &webhookTrigger{workflow: workflow, nodeID: nodeID, node: webhookNode}
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	wh.unregisterLocked(workflow.ID)
+	for key, t := range triggers {
+		wh.triggers[key] = t
+	}
+	return nil
+}
+
+// UnregisterWorkflow removes the webhook triggers of a workflow
+func (wh *WebhookHandler) UnregisterWorkflow(workflowID string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	wh.unregisterLocked(workflowID)
+}
+
+func (wh *WebhookHandler) unregisterLocked(workflowID string) {
+	for key, t := range wh.triggers {
+		if t.workflow.ID == workflowID {
+			delete(wh.triggers, key)
+		}
+	}
+}
+
+// HandleWebhook handles POST /api/v1/webhooks/{workflow_id}/{path}. The
+// workflow runs with the request body, headers and query as its input; the
+// response carries the execution ID, and the results too when the trigger
+// is configured with wait_for_completion.
+func (wh *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, WebhookPathPrefix), "/")
+	wh.mu.RLock()
+	t, exists := wh.triggers[key]
+	wh.mu.RUnlock()
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+
+	if err := t.node.Verify(body, r.Header); err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	inputs := webhookInputs(r, body)
+
+	// Runs continue the trace of the caller, if it sent one
+	ctx := tracecontext.Extract(r.Context(), r.Header)
+
+	if !t.node.WaitForCompletion() {
+		// The execution ID can be polled on /api/v1/executions/{id}
+		executionID, err := wh.executor.Start(ctx, t.workflow, inputs)
+		if err != nil {
+			log.Printf("Failed to start webhook execution of workflow %s: %v", t.workflow.ID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to start workflow execution")
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"success":      true,
+			"execution_id": executionID,
+			"workflow_id":  t.workflow.ID,
+			"status":       "running",
+		})
+		return
+	}
+
+	run, err := wh.executor.Run(ctx, t.workflow, inputs)
+	executionID := ""
+	if run != nil {
+		executionID = run.ExecutionID
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success":      false,
+			"execution_id": executionID,
+			"workflow_id":  t.workflow.ID,
+			"status":       "failed",
+			"error":        err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"execution_id": executionID,
+		"workflow_id":  t.workflow.ID,
+		"status":       "completed",
+		"results":      run.Results,
+	})
+}
+
+// webhookInputs builds the trigger input from a request. JSON bodies are
+// decoded; anything else is passed on as a string.
+func webhookInputs(r *http.Request, body []byte) map[string]interface{} {
+	var payload interface{} = string(body)
+	var decoded interface{}
+	if len(body) > 0 && json.Unmarshal(body, &decoded) == nil {
+		payload = decoded
+	}
+
+	headers := make(map[string]interface{}, len(r.Header))
+	for name := range r.Header {
+		headers[name] = r.Header.Get(name)
+	}
+
+	query := make(map[string]interface{})
+	for name := range r.URL.Query() {
+		query[name] = r.URL.Query().Get(name)
+	}
+
+	return map[string]interface{}{
+		"body":        payload,
+		"headers":     headers,
+		"query":       query,
+		"method":      r.Method,
+		"received_at": time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
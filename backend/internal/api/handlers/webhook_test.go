@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citadel-agent/backend/internal/nodes/trigger"
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"citadel-agent/backend/pkg/tracecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "s3cret"
+
+func newWebhookServer(t *testing.T, triggerConfig map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	registry := engine.NewNodeTypeRegistry()
+	for _, nt := range []struct {
+		constructor engine.NodeConstructor
+		id          string
+	}{
+		{trigger.NewWebhookTriggerNode, trigger.WebhookTriggerNodeType},
+		{utility.NewTemplateNode, "template"},
+	} {
+		meta := types.NodeMetadata{ID: nt.id}
+		require.NoError(t, registry.RegisterNodeType(nt.id, engine.AdaptNode(nt.constructor, meta), meta))
+	}
+
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	webhooks := NewWebhookHandler(executor)
+	require.NoError(t, webhooks.RegisterWorkflow(&engine.Workflow{
+		ID: "wf1",
+		Nodes: map[string]*engine.WorkflowNode{
+			"hook":  {ID: "hook", Type: trigger.WebhookTriggerNodeType, Config: triggerConfig},
+			"greet": {ID: "greet", Type: "template", Config: map[string]interface{}{"template": "hello {{ .body.name }} ({{ .query.source }})"}},
+		},
+		Edges: []engine.WorkflowEdge{{ID: "e1", Source: "hook", Target: "greet"}},
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebhookPathPrefix, webhooks.HandleWebhook)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postWebhook(t *testing.T, url string, body []byte, header http.Header) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&decoded))
+	return resp, decoded
+}
+
+func sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookWithValidSignatureRunsWorkflow(t *testing.T) {
+	server := newWebhookServer(t, map[string]interface{}{
+		"path":                "orders/created",
+		"secret":              testWebhookSecret,
+		"wait_for_completion": true,
+	})
+	body := []byte(`{"name":"Ada"}`)
+
+	resp, decoded := postWebhook(t, server.URL+"/api/v1/webhooks/wf1/orders/created?source=shop", body, http.Header{
+		trigger.DefaultSignatureHeader: {sign(body)},
+	})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "completed", decoded["status"])
+	assert.NotEmpty(t, decoded["execution_id"])
+	results := decoded["results"].(map[string]interface{})
+	assert.Equal(t, "hello Ada (shop)", results["greet"].(map[string]interface{})["output"])
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	server := newWebhookServer(t, map[string]interface{}{
+		"path":   "orders/created",
+		"secret": testWebhookSecret,
+	})
+	body := []byte(`{"name":"Ada"}`)
+	url := server.URL + "/api/v1/webhooks/wf1/orders/created"
+
+	resp, _ := postWebhook(t, url, body, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = postWebhook(t, url, body, http.Header{trigger.DefaultSignatureHeader: {sign([]byte(`{"name":"Eve"}`))}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestWebhookAsyncReturnsExecutionID(t *testing.T) {
+	server := newWebhookServer(t, map[string]interface{}{
+		"path":         "ping",
+		"secret":       testWebhookSecret,
+		"verification": trigger.VerifyToken,
+	})
+
+	resp, decoded := postWebhook(t, server.URL+"/api/v1/webhooks/wf1/ping", []byte(`{}`), http.Header{
+		trigger.DefaultTokenHeader: {testWebhookSecret},
+	})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "running", decoded["status"])
+	assert.NotEmpty(t, decoded["execution_id"])
+
+	resp, _ = postWebhook(t, server.URL+"/api/v1/webhooks/wf1/ping", []byte(`{}`), http.Header{
+		trigger.DefaultTokenHeader: {"wrong"},
+	})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestWebhookUnknownRoute(t *testing.T) {
+	server := newWebhookServer(t, map[string]interface{}{"path": "ping"})
+
+	resp, _ := postWebhook(t, server.URL+"/api/v1/webhooks/wf2/ping", []byte(`{}`), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhookContinuesCallerTrace(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: trigger.WebhookTriggerNodeType}
+	require.NoError(t, registry.RegisterNodeType(meta.ID, engine.AdaptNode(trigger.NewWebhookTriggerNode, meta), meta))
+	recorder := engine.NewSpanRecorder()
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetTracer(recorder)
+	webhooks := NewWebhookHandler(executor)
+	require.NoError(t, webhooks.RegisterWorkflow(&engine.Workflow{
+		ID: "wf1",
+		Nodes: map[string]*engine.WorkflowNode{
+			"hook": {ID: "hook", Type: trigger.WebhookTriggerNodeType, Config: map[string]interface{}{"path": "ping", "wait_for_completion": true}},
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, WebhookPathPrefix+"wf1/ping", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set(tracecontext.Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	webhooks.HandleWebhook(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	spans := recorder.Spans()
+	require.NotEmpty(t, spans)
+	assert.Equal(t, engine.SpanWorkflowRun, spans[0].Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentID)
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketPath is the route of the WebSocket gateway
+const WebSocketPath = "/api/v1/ws"
+
+// Gateway message types. Clients send subscribe, unsubscribe, trigger and
+// approve; the gateway answers each with ack or error, and sends event for
+// every event of a subscribed execution.
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsTrigger     = "trigger"
+	wsApprove     = "approve"
+	wsEvent       = "event"
+	wsAck         = "ack"
+	wsError       = "error"
+)
+
+// Gateway connection timing: clients must answer pings within wsPongWait
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+// maxWSMessageSize bounds a single client message
+const maxWSMessageSize = 1 << 20
+
+// wsMessage is the JSON frame exchanged in both directions. ID is chosen by
+// the client and echoed in the ack or error answering the message.
+//
+//	{"type":"subscribe","id":"1","execution_id":"exec_1"}
+//	{"type":"unsubscribe","id":"2","execution_id":"exec_1"}
+//	{"type":"trigger","id":"3","workflow_id":"wf1","inputs":{...}}
+//	{"type":"approve","id":"4","prompt_id":"prompt_1","approved":true,"comment":"..."}
+//	{"type":"event","execution_id":"exec_1","event":{...}}
+type wsMessage struct {
+	Type        string                 `json:"type"`
+	ID          string                 `json:"id,omitempty"`
+	ExecutionID string                 `json:"execution_id,omitempty"`
+	WorkflowID  string                 `json:"workflow_id,omitempty"`
+	Inputs      map[string]interface{} `json:"inputs,omitempty"`
+	PromptID    string                 `json:"prompt_id,omitempty"`
+	Approved    bool                   `json:"approved,omitempty"`
+	Comment     string                 `json:"comment,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Event       *engine.ExecutionEvent `json:"event,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// WebSocketHandler is a gateway through which one connection can watch
+// several executions, trigger deployed workflows and answer the prompts of
+// approval nodes. It serves the execution events of the executor's event
+// bus and the prompts of its interaction manager.
+type WebSocketHandler struct {
+	executor  *engine.WorkflowExecutor
+	workflows *WorkflowHandler
+	upgrader  websocket.Upgrader
+}
+
+// NewWebSocketHandler creates a gateway triggering the workflows deployed
+// through workflows. Cross-origin connections are accepted when allowOrigin
+// accepts their Origin; a nil allowOrigin only accepts same-origin ones.
+func NewWebSocketHandler(executor *engine.WorkflowExecutor, workflows *WorkflowHandler, allowOrigin func(origin string) bool) *WebSocketHandler {
+	wh := &WebSocketHandler{executor: executor, workflows: workflows}
+	if allowOrigin != nil {
+		wh.upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || allowOrigin(origin)
+		}
+	}
+	return wh
+}
+
+// ServeHTTP upgrades the request and serves the connection until the client
+// goes away, ending its subscriptions. Authenticated users below the editor
+// role can only watch executions, as can API keys without the
+// workflows:write scope to trigger and executions:write to approve.
+// Browsers cannot set an Authorization
+// header on the handshake, so they authenticate with a stream token in its
+// access_token query parameter, see middleware.JWTConfig.StreamPaths.
+func (wh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, authenticated := middleware.UserIDFromContext(r.Context())
+	readOnly := authenticated && !middleware.HasRole(r.Context(), accounts.RoleEditor)
+	scopes, scoped := middleware.APIKeyScopesFromContext(r.Context())
+
+	conn, err := wh.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+
+	c := &wsConn{
+		gateway:       wh,
+		conn:          conn,
+		readOnly:      readOnly,
+		scopes:        scopes,
+		scoped:        scoped,
+		userID:        userID,
+		subscriptions: make(map[string]func()),
+		done:          make(chan struct{}),
+	}
+	go c.keepAlive()
+	c.readLoop()
+
+	close(c.done)
+	c.unsubscribeAll()
+	conn.Close()
+}
+
+// wsConn is a single gateway connection
+type wsConn struct {
+	gateway  *WebSocketHandler
+	conn     *websocket.Conn
+	readOnly bool       // refuses trigger and approve
+	scopes   []string   // of the API key the connection was opened with
+	scoped   bool       // whether scopes limit trigger and approve
+	userID   string     // the authenticated user triggered runs are started for
+	writeMu  sync.Mutex // gorilla/websocket allows one writer at a time
+	done     chan struct{}
+
+	mu            sync.Mutex
+	subscriptions map[string]func() // unsubscribe functions by execution ID
+}
+
+// readLoop handles client messages until the connection fails or the
+// client stops answering pings
+func (c *wsConn) readLoop() {
+	c.conn.SetReadLimit(maxWSMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket connection closed: %v", err)
+			}
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.send(wsMessage{Type: wsError, Error: "Invalid message format"})
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+// keepAlive pings the client until the connection is done
+func (c *wsConn) keepAlive() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send writes a message; failures surface as read errors in readLoop
+func (c *wsConn) send(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	c.conn.WriteJSON(msg)
+}
+
+func (c *wsConn) ack(msg wsMessage, executionID string) {
+	c.send(wsMessage{Type: wsAck, ID: msg.ID, ExecutionID: executionID})
+}
+
+func (c *wsConn) fail(msg wsMessage, message string) {
+	c.send(wsMessage{Type: wsError, ID: msg.ID, ExecutionID: msg.ExecutionID, Error: message})
+}
+
+// wsScopes are the API key scopes of the messages that change state
+var wsScopes = map[string]string{
+	wsTrigger: "workflows:write",
+	wsApprove: "executions:write",
+}
+
+func (c *wsConn) handle(msg wsMessage) {
+	if scope, ok := wsScopes[msg.Type]; ok {
+		if c.readOnly {
+			c.fail(msg, "This requires the "+accounts.RoleEditor+" role")
+			return
+		}
+		if c.scoped && !middleware.ScopesAllow(c.scopes, scope) {
+			c.fail(msg, "This requires the "+scope+" scope")
+			return
+		}
+	}
+
+	switch msg.Type {
+	case wsSubscribe:
+		c.subscribe(msg)
+	case wsUnsubscribe:
+		c.unsubscribe(msg.ExecutionID)
+		c.ack(msg, msg.ExecutionID)
+	case wsTrigger:
+		c.trigger(msg)
+	case wsApprove:
+		c.approve(msg)
+	default:
+		c.fail(msg, "Unknown message type "+msg.Type)
+	}
+}
+
+// subscribe starts forwarding the events of an execution. A finished
+// execution only gets its execution_finished event; the pending prompts of
+// a running one are sent again, so a client that connects late can answer
+// them.
+func (c *wsConn) subscribe(msg wsMessage) {
+	id := msg.ExecutionID
+	c.mu.Lock()
+	_, subscribed := c.subscriptions[id]
+	c.mu.Unlock()
+	if subscribed {
+		c.ack(msg, id)
+		return
+	}
+
+	// Subscribe before reading the status, so the end of a running
+	// execution cannot be missed
+	events, unsubscribe := c.gateway.executor.Events().Subscribe(id)
+	execution, err := c.gateway.executor.GetExecution(context.Background(), id)
+	if err != nil {
+		unsubscribe()
+		if errors.Is(err, engine.ErrExecutionNotFound) {
+			c.fail(msg, "Execution not found")
+		} else {
+			c.fail(msg, "Failed to load execution: "+err.Error())
+		}
+		return
+	}
+
+	c.ack(msg, id)
+	if execution.Status != types.ExecutionRunning {
+		unsubscribe()
+		c.sendEvent(engine.ExecutionEvent{
+			Type:        engine.EventExecutionFinished,
+			ExecutionID: execution.ID,
+			WorkflowID:  execution.WorkflowID,
+			Status:      string(execution.Status),
+			Error:       execution.Error,
+			Timestamp:   time.Now(),
+		})
+		return
+	}
+
+	c.track(id, events, unsubscribe)
+	for _, prompt := range c.gateway.executor.Interactions().Pending(id) {
+		c.sendEvent(engine.PromptEvent(prompt))
+	}
+}
+
+// trigger starts a deployed workflow and subscribes to its execution
+func (c *wsConn) trigger(msg wsMessage) {
+	deployed, exists := c.gateway.workflows.lookup(msg.WorkflowID)
+	if !exists {
+		c.fail(msg, "Workflow not found")
+		return
+	}
+
+	inputs := msg.Inputs
+	if inputs == nil {
+		inputs = make(map[string]interface{})
+	}
+	id, events, unsubscribe, err := c.gateway.executor.StartAndSubscribe(engine.ContextWithUserID(context.Background(), c.userID), deployed.Workflow, inputs)
+	if err != nil {
+		c.fail(msg, "Failed to start workflow execution: "+err.Error())
+		return
+	}
+	c.ack(msg, id)
+	c.track(id, events, unsubscribe)
+}
+
+// approve answers the prompt of an approval node
+func (c *wsConn) approve(msg wsMessage) {
+	err := c.gateway.executor.Interactions().Respond(msg.PromptID, types.PromptResponse{
+		Approved: msg.Approved,
+		Comment:  msg.Comment,
+		Data:     msg.Data,
+	})
+	if errors.Is(err, engine.ErrPromptNotFound) {
+		c.fail(msg, "Prompt not found or already answered")
+		return
+	}
+	c.ack(msg, msg.ExecutionID)
+}
+
+// track forwards the events of a subscription until it ends
+func (c *wsConn) track(id string, events <-chan engine.ExecutionEvent, unsubscribe func()) {
+	c.mu.Lock()
+	c.subscriptions[id] = unsubscribe
+	c.mu.Unlock()
+
+	go func() {
+		finished := false
+		for event := range events {
+			finished = event.Type == engine.EventExecutionFinished
+			c.sendEvent(event)
+		}
+
+		c.mu.Lock()
+		_, active := c.subscriptions[id]
+		delete(c.subscriptions, id)
+		c.mu.Unlock()
+		if active && !finished {
+			// The bus dropped the subscription since the client fell behind
+			c.send(wsMessage{Type: wsError, ExecutionID: id, Error: "Subscription ended as events could not be delivered in time; subscribe again"})
+		}
+	}()
+}
+
+func (c *wsConn) sendEvent(event engine.ExecutionEvent) {
+	c.send(wsMessage{Type: wsEvent, ExecutionID: event.ExecutionID, Event: &event})
+}
+
+// unsubscribe ends the subscription to an execution, if any
+func (c *wsConn) unsubscribe(id string) {
+	c.mu.Lock()
+	unsubscribe, ok := c.subscriptions[id]
+	delete(c.subscriptions, id)
+	c.mu.Unlock()
+	if ok {
+		unsubscribe()
+	}
+}
+
+func (c *wsConn) unsubscribeAll() {
+	c.mu.Lock()
+	subscriptions := c.subscriptions
+	c.subscriptions = make(map[string]func())
+	c.mu.Unlock()
+	for _, unsubscribe := range subscriptions {
+		unsubscribe()
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGatewayServer serves a gateway with workflow wf1 deployed. With roles,
+// connections are authenticated as a user with them.
+func newGatewayServer(t *testing.T, roles ...string) *httptest.Server {
+	t.Helper()
+	var gateway http.Handler = newGateway(t)
+	if roles != nil {
+		gateway = authenticated(gateway, roles, nil)
+	}
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// authenticated authenticates the requests to next as user-1 with roles and,
+// unless nil, an API key with scopes
+func authenticated(next http.Handler, roles, scopes []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := middleware.WithRoles(middleware.WithUserID(r.Context(), "user-1"), roles)
+		if scopes != nil {
+			ctx = middleware.WithAPIKeyScopes(ctx, scopes)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newGateway returns a gateway with workflow wf1 deployed
+func newGateway(t *testing.T) *WebSocketHandler {
+	t.Helper()
+
+	registry := engine.NewNodeTypeRegistry()
+	for _, nt := range []struct {
+		constructor engine.NodeConstructor
+		id          string
+	}{
+		{utility.NewApprovalNode, "approval"},
+		{func(map[string]interface{}) (interfaces.NodeInstance, error) { return &stepNode{}, nil }, "step"},
+	} {
+		meta := types.NodeMetadata{ID: nt.id}
+		require.NoError(t, registry.RegisterNodeType(nt.id, engine.AdaptNode(nt.constructor, meta), meta))
+	}
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	workflows := NewWorkflowHandler(executor)
+
+	rec := serveWorkflow(workflows, http.MethodPost, "/api/workflows", `{"id":"wf1","nodes":{
+		"ask":{"id":"ask","type":"approval","config":{"message":"Ship order {{ .order }}?"}},
+		"ship":{"id":"ship","type":"step"}
+	},"edges":[{"id":"e1","source":"ask","target":"ship","source_handle":"approved"}]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	return NewWebSocketHandler(executor, workflows, nil)
+}
+
+func dialGateway(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+WebSocketPath, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	var msg wsMessage
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestGatewayTriggerAndApprove(t *testing.T) {
+	server := newGatewayServer(t)
+	conn := dialGateway(t, server)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsTrigger, ID: "1", WorkflowID: "wf1", Inputs: map[string]interface{}{"order": 42}}))
+	ack := readMessage(t, conn)
+	require.Equal(t, wsAck, ack.Type)
+	assert.Equal(t, "1", ack.ID)
+	executionID := ack.ExecutionID
+	require.NotEmpty(t, executionID)
+
+	msg := readMessage(t, conn)
+	require.Equal(t, wsEvent, msg.Type)
+	assert.Equal(t, engine.EventNodeStarted, msg.Event.Type)
+	prompt := readMessage(t, conn)
+	require.Equal(t, engine.EventPromptRequested, prompt.Event.Type)
+	assert.Equal(t, executionID, prompt.ExecutionID)
+	assert.Equal(t, "Ship order 42?", prompt.Event.Message)
+
+	// A second client subscribing late is shown the pending prompt
+	watcher := dialGateway(t, server)
+	require.NoError(t, watcher.WriteJSON(wsMessage{Type: wsSubscribe, ID: "w1", ExecutionID: executionID}))
+	assert.Equal(t, wsAck, readMessage(t, watcher).Type)
+	assert.Equal(t, prompt.Event.PromptID, readMessage(t, watcher).Event.PromptID)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsApprove, ID: "2", PromptID: prompt.Event.PromptID, Approved: true}))
+
+	for _, c := range []*websocket.Conn{conn, watcher} {
+		var received []string
+		for len(received) == 0 || received[len(received)-1] != string(engine.EventExecutionFinished) {
+			msg := readMessage(t, c)
+			if msg.Type == wsEvent {
+				received = append(received, string(msg.Event.Type))
+				if msg.Event.Type == engine.EventExecutionFinished {
+					assert.Equal(t, string(types.ExecutionSucceeded), msg.Event.Status)
+				}
+			}
+		}
+		assert.Equal(t, []string{"node_completed", "node_started", "node_completed", "execution_finished"}, received)
+	}
+
+	// The prompt was answered, and a finished execution only gets its
+	// final event
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsApprove, ID: "3", PromptID: prompt.Event.PromptID}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, wsError, msg.Type)
+	assert.Equal(t, "3", msg.ID)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsSubscribe, ID: "4", ExecutionID: executionID}))
+	assert.Equal(t, wsAck, readMessage(t, conn).Type)
+	msg = readMessage(t, conn)
+	assert.Equal(t, engine.EventExecutionFinished, msg.Event.Type)
+}
+
+func TestGatewayRejectsUnknownTargets(t *testing.T) {
+	conn := dialGateway(t, newGatewayServer(t))
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsSubscribe, ID: "1", ExecutionID: "exec_404"}))
+	msg := readMessage(t, conn)
+	assert.Equal(t, wsError, msg.Type)
+	assert.Equal(t, "Execution not found", msg.Error)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsTrigger, ID: "2", WorkflowID: "missing"}))
+	assert.Equal(t, "Workflow not found", readMessage(t, conn).Error)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	assert.Equal(t, wsError, readMessage(t, conn).Type)
+}
+
+func TestGatewayViewersCanOnlyWatch(t *testing.T) {
+	conn := dialGateway(t, newGatewayServer(t, accounts.RoleViewer))
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsTrigger, ID: "1", WorkflowID: "wf1"}))
+	msg := readMessage(t, conn)
+	assert.Equal(t, wsError, msg.Type)
+	assert.Equal(t, "This requires the editor role", msg.Error)
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsApprove, ID: "2", PromptID: "prompt_1"}))
+	assert.Equal(t, "This requires the editor role", readMessage(t, conn).Error)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsSubscribe, ID: "3", ExecutionID: "exec_404"}))
+	assert.Equal(t, "Execution not found", readMessage(t, conn).Error)
+
+	editor := dialGateway(t, newGatewayServer(t, accounts.RoleEditor))
+	require.NoError(t, editor.WriteJSON(wsMessage{Type: wsTrigger, ID: "1", WorkflowID: "wf1"}))
+	assert.Equal(t, wsAck, readMessage(t, editor).Type)
+}
+
+func TestGatewayHoldsAPIKeysToTheirScopes(t *testing.T) {
+	editor := []string{accounts.RoleEditor}
+	readOnly := httptest.NewServer(authenticated(newGateway(t), editor, []string{"ws:read", "executions:read"}))
+	t.Cleanup(readOnly.Close)
+	conn := dialGateway(t, readOnly)
+
+	// The key's owner is an editor, but the key cannot write
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsTrigger, ID: "1", WorkflowID: "wf1"}))
+	msg := readMessage(t, conn)
+	assert.Equal(t, wsError, msg.Type)
+	assert.Equal(t, "This requires the workflows:write scope", msg.Error)
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsApprove, ID: "2", PromptID: "prompt_1"}))
+	assert.Equal(t, "This requires the executions:write scope", readMessage(t, conn).Error)
+
+	writer := httptest.NewServer(authenticated(newGateway(t), editor, []string{"ws:read", "workflows:write"}))
+	t.Cleanup(writer.Close)
+	conn = dialGateway(t, writer)
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsTrigger, ID: "1", WorkflowID: "wf1"}))
+	assert.Equal(t, wsAck, readMessage(t, conn).Type)
+}
+
+func TestGatewayHandshakeWithStreamToken(t *testing.T) {
+	auth, err := middleware.NewJWTAuth(middleware.JWTConfig{
+		Secret:      "test-secret-at-least-32-characters!!",
+		StreamPaths: []string{WebSocketPath},
+	})
+	require.NoError(t, err)
+	executor := engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry())
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	mux := http.NewServeMux()
+	mux.Handle(WebSocketPath, NewWebSocketHandler(executor, NewWorkflowHandler(executor), nil))
+	server := httptest.NewServer(auth.HTTP(mux))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + WebSocketPath
+
+	// Browsers cannot send the token in a header
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	session, err := auth.IssueToken("user-1", time.Hour, accounts.RoleViewer)
+	require.NoError(t, err)
+	_, resp, err = websocket.DefaultDialer.Dial(url+"?access_token="+session, nil)
+	require.Error(t, err, "only stream tokens are taken from the query")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	token, err := auth.IssueStreamToken("user-1", accounts.RoleViewer)
+	require.NoError(t, err)
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	// The connection acts with the roles of the token
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsTrigger, ID: "1", WorkflowID: "wf1"}))
+	assert.Equal(t, "This requires the editor role", readMessage(t, conn).Error)
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsSubscribe, ID: "2", ExecutionID: "exec_404"}))
+	assert.Equal(t, "Execution not found", readMessage(t, conn).Error)
+}
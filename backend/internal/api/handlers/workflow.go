@@ -1,29 +1,164 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/nodes/trigger"
 	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
 )
 
+// WorkflowPathPrefix is the route prefix of single workflows,
+// e.g. /api/workflows/{id}
+const WorkflowPathPrefix = "/api/workflows/"
+
+// WorkflowImportPath is the route workflow exports are imported on
+const WorkflowImportPath = "/api/workflows/import"
+
+// workflowExportSuffix follows the ID of a workflow in the route of its
+// export, /api/workflows/{id}/export
+const workflowExportSuffix = "/export"
+
+// TriggerRegistry is notified when a workflow is deployed so it can route the
+// workflow's triggers, e.g. WebhookHandler
+type TriggerRegistry interface {
+	RegisterWorkflow(workflow *engine.Workflow) error
+	UnregisterWorkflow(workflowID string)
+}
+
+// deployedWorkflow is a workflow along with its lifecycle. Deleted workflows
+// are kept, with status "deleted", but no longer listed or triggered.
+type deployedWorkflow struct {
+	*engine.Workflow
+	Status    types.WorkflowStatus `json:"status"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	// Migrations are those that upgraded the node configs of the workflow
+	// when it was deployed
+	Migrations []engine.MigrationRecord `json:"migrations,omitempty"`
+}
+
 // WorkflowHandler handles workflow-related API requests
 type WorkflowHandler struct {
-	executor *engine.WorkflowExecutor
+	executor  *engine.WorkflowExecutor
+	triggers  []TriggerRegistry
+	mu        sync.RWMutex
+	workflows map[string]*deployedWorkflow
 }
 
 // NewWorkflowHandler creates a new workflow handler
-func NewWorkflowHandler(executor *engine.WorkflowExecutor) *WorkflowHandler {
+func NewWorkflowHandler(executor *engine.WorkflowExecutor, triggers ...TriggerRegistry) *WorkflowHandler {
 	return &WorkflowHandler{
-		executor: executor,
+		executor:  executor,
+		triggers:  triggers,
+		workflows: make(map[string]*deployedWorkflow),
+	}
+}
+
+// validateWorkflow checks the nodes and edges of a workflow, migrates the
+// configs of nodes written for older versions of their types, then
+// registers its triggers. It returns the migrations that ran. When a
+// registry refuses the triggers, those that took them drop them again,
+// along with the triggers of any previous definition of the workflow.
+func (wh *WorkflowHandler) validateWorkflow(workflow *engine.Workflow) ([]engine.MigrationRecord, error) {
+	for nodeID, node := range workflow.Nodes {
+		if node == nil || node.Type == "" {
+			return nil, fmt.Errorf("node %s has no type", nodeID)
+		}
+	}
+	migrations, err := engine.MigrateWorkflow(wh.executor.Registry(), workflow)
+	if err != nil {
+		return nil, err
+	}
+	for nodeID, node := range workflow.Nodes {
+		if err := trigger.ValidateConfig(node.Type, node.Config); err != nil {
+			return nil, fmt.Errorf("invalid trigger %s: %w", nodeID, err)
+		}
+	}
+	for _, edge := range workflow.Edges {
+		if workflow.Nodes[edge.Source] == nil || workflow.Nodes[edge.Target] == nil {
+			return nil, fmt.Errorf("edge %s connects unknown nodes %q and %q", edge.ID, edge.Source, edge.Target)
+		}
+		if err := engine.ValidateEdgeMapping(edge.Mapping); err != nil {
+			return nil, fmt.Errorf("edge %s has an invalid mapping: %w", edge.ID, err)
+		}
+	}
+
+	for i, registry := range wh.triggers {
+		if err := registry.RegisterWorkflow(workflow); err != nil {
+			// Leave none of the workflow's triggers routed
+			for _, registered := range wh.triggers[:i] {
+				registered.UnregisterWorkflow(workflow.ID)
+			}
+			return nil, fmt.Errorf("invalid workflow triggers: %w", err)
+		}
 	}
+	return migrations, nil
 }
 
-// ExecuteWorkflowHandler handles workflow execution requests
+// DeployWorkflowHandler deploys a workflow and registers its triggers. A
+// workflow whose nodes or triggers are invalid is rejected.
+func (wh *WorkflowHandler) DeployWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	var workflow engine.Workflow
+	if !decodeBody(w, r, &workflow, "Invalid workflow format") {
+		return
+	}
+	if workflow.ID == "" {
+		workflow.ID = fmt.Sprintf("wf_%d", time.Now().UnixNano())
+	}
+
+	migrations, err := wh.validateWorkflow(&workflow)
+	if err != nil {
+		// Keep routing the triggers of a workflow deployed under the same ID
+		if existing, exists := wh.lookup(workflow.ID); exists {
+			wh.reregister(existing.Workflow)
+		}
+		http.Error(w, fmt.Sprintf("Invalid workflow: %v", err), http.StatusBadRequest)
+		return
+	}
+	wh.add(&workflow, migrations)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"id":          workflow.ID,
+		"workflow_id": workflow.ID,
+	})
+}
+
+// add stores a new, validated workflow as active
+func (wh *WorkflowHandler) add(workflow *engine.Workflow, migrations []engine.MigrationRecord) {
+	now := time.Now()
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	wh.workflows[workflow.ID] = &deployedWorkflow{
+		Workflow:   workflow,
+		Status:     types.WorkflowActive,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Migrations: migrations,
+	}
+}
+
+// ExecuteWorkflowHandler handles workflow execution requests. With
+// ?dry_run=true the workflow is simulated: nodes with side effects are
+// stubbed, and listed in "stubbed", instead of being executed. With
+// ?record=true the calls of external nodes are recorded under the returned
+// "recording_id", and with ?replay=<recording_id> they return the recorded
+// outputs instead of calling their services.
 func (wh *WorkflowHandler) ExecuteWorkflowHandler(w http.ResponseWriter, r *http.Request) {
 	var workflow engine.Workflow
-	if err := json.NewDecoder(r.Body).Decode(&workflow); err != nil {
-		http.Error(w, "Invalid workflow format", http.StatusBadRequest)
+	if !decodeBody(w, r, &workflow, "Invalid workflow format") {
 		return
 	}
 
@@ -35,7 +170,47 @@ func (wh *WorkflowHandler) ExecuteWorkflowHandler(w http.ResponseWriter, r *http
 	}
 
 	// Execute workflow
-	ctx := r.Context()
+	ctx := runContext(r.Context())
+	if r.URL.Query().Get("dry_run") == "true" {
+		run, err := wh.executor.Simulate(ctx, &workflow, inputs, engine.Simulation{})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Workflow simulation failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		stubbed := run.Stubbed
+		if stubbed == nil {
+			stubbed = []string{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":     true,
+			"dry_run":     true,
+			"results":     run.Results,
+			"stubbed":     stubbed,
+			"workflow_id": workflow.ID,
+		})
+		return
+	}
+	if recordingID := r.URL.Query().Get("replay"); recordingID != "" || r.URL.Query().Get("record") == "true" {
+		var run *engine.WorkflowRun
+		var err error
+		if recordingID != "" {
+			run, err = wh.executor.Replay(ctx, &workflow, inputs, recordingID)
+		} else {
+			run, err = wh.executor.Record(ctx, &workflow, inputs)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Workflow execution failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":      true,
+			"recording_id": run.RecordingID,
+			"replayed":     recordingID != "",
+			"results":      run.Results,
+			"workflow_id":  workflow.ID,
+		})
+		return
+	}
 	results, err := wh.executor.ExecuteWorkflow(ctx, &workflow, inputs)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Workflow execution failed: %v", err), http.StatusInternalServerError)
@@ -51,10 +226,226 @@ func (wh *WorkflowHandler) ExecuteWorkflowHandler(w http.ResponseWriter, r *http
 	})
 }
 
+// WorkflowByIDHandler serves GET, PUT and DELETE /api/workflows/{id} and
+// GET /api/workflows/{id}/export
+func (wh *WorkflowHandler) WorkflowByIDHandler(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), workflowExportSuffix) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		wh.ExportWorkflowHandler(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		wh.GetWorkflowHandler(w, r)
+	case http.MethodPut:
+		wh.UpdateWorkflowHandler(w, r)
+	case http.MethodDelete:
+		wh.DeleteWorkflowHandler(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// workflowID returns the {id} of /api/workflows/{id}
+func workflowID(r *http.Request) string {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, WorkflowPathPrefix), "/")
+	if strings.Contains(id, "/") {
+		return ""
+	}
+	return id
+}
+
+// lookup returns the workflow with id unless it is unknown or deleted
+func (wh *WorkflowHandler) lookup(id string) (*deployedWorkflow, bool) {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+	deployed, exists := wh.workflows[id]
+	if !exists || deployed.Status == types.WorkflowDeleted {
+		return nil, false
+	}
+	return deployed, true
+}
+
 // GetWorkflowHandler returns a workflow by ID
 func (wh *WorkflowHandler) GetWorkflowHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement retrieving a workflow from storage
-	http.Error(w, "Not implemented", http.StatusNotImplemented)
+	deployed, exists := wh.lookup(workflowID(r))
+	if !exists {
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"workflow": deployed,
+	})
+}
+
+// UpdateWorkflowHandler replaces the definition of a workflow, validating it
+// as on deploy. A workflow with running executions is only updated with
+// ?force=true; those executions finish with the previous definition.
+func (wh *WorkflowHandler) UpdateWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	id := workflowID(r)
+	existing, exists := wh.lookup(id)
+	if !exists {
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return
+	}
+
+	var workflow engine.Workflow
+	if !decodeBody(w, r, &workflow, "Invalid workflow format") {
+		return
+	}
+	workflow.ID = id
+
+	if active := wh.executor.ActiveExecutions(id); active > 0 && r.URL.Query().Get("force") != "true" {
+		http.Error(w, fmt.Sprintf("Workflow has %d running execution(s); retry with force=true to update it anyway", active), http.StatusConflict)
+		return
+	}
+
+	migrations, err := wh.validateWorkflow(&workflow)
+	if err != nil {
+		// Keep routing the triggers of the current definition
+		wh.reregister(existing.Workflow)
+		http.Error(w, fmt.Sprintf("Invalid workflow: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	wh.mu.Lock()
+	wh.workflows[id] = &deployedWorkflow{
+		Workflow:   &workflow,
+		Status:     existing.Status,
+		CreatedAt:  existing.CreatedAt,
+		UpdatedAt:  time.Now(),
+		Migrations: migrations,
+	}
+	wh.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"id":          id,
+		"workflow_id": id,
+	})
+}
+
+// reregister restores the triggers of workflow after registering another
+// definition of it failed part way
+func (wh *WorkflowHandler) reregister(workflow *engine.Workflow) {
+	for _, registry := range wh.triggers {
+		if err := registry.RegisterWorkflow(workflow); err != nil {
+			registry.UnregisterWorkflow(workflow.ID)
+		}
+	}
+}
+
+// DeleteWorkflowHandler soft-deletes a workflow: it is marked deleted, its
+// triggers stop and it is no longer listed
+func (wh *WorkflowHandler) DeleteWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	id := workflowID(r)
+
+	wh.mu.Lock()
+	deployed, exists := wh.workflows[id]
+	if !exists || deployed.Status == types.WorkflowDeleted {
+		wh.mu.Unlock()
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return
+	}
+	deleted := *deployed
+	deleted.Status = types.WorkflowDeleted
+	deleted.UpdatedAt = time.Now()
+	wh.workflows[id] = &deleted
+	wh.mu.Unlock()
+
+	for _, registry := range wh.triggers {
+		registry.UnregisterWorkflow(id)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"id":      id,
+		"status":  types.WorkflowDeleted,
+	})
+}
+
+// ExportWorkflowHandler returns the export of a workflow, in the format
+// ImportWorkflowHandler takes. Credentials are exported by name only.
+func (wh *WorkflowHandler) ExportWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.Trim(strings.TrimPrefix(r.URL.Path, WorkflowPathPrefix), "/"), workflowExportSuffix)
+	if strings.Contains(id, "/") {
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return
+	}
+	deployed, exists := wh.lookup(id)
+	if !exists {
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return
+	}
+
+	export, err := engine.ExportWorkflow(wh.executor.Registry(), deployed.Workflow)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Workflow cannot be exported: %v", err))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".json"))
+	writeJSON(w, http.StatusOK, export)
+}
+
+// workflowImport is the body of import requests: an export, plus the local
+// credentials its credentials are bound to
+type workflowImport struct {
+	engine.WorkflowExport
+	CredentialBindings map[string]string `json:"credential_bindings"`
+}
+
+// ImportWorkflowHandler deploys the workflow of an export under a new ID.
+// Exports using node types that are not registered, or not in a compatible
+// version, are rejected. Until every credential the workflow refers to is
+// bound in credential_bindings, it answers 422 with the credentials to bind.
+func (wh *WorkflowHandler) ImportWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req workflowImport
+	if !decodeBody(w, r, &req, "Invalid workflow export") {
+		return
+	}
+
+	id := fmt.Sprintf("wf_%d", time.Now().UnixNano())
+	workflow, err := engine.ImportWorkflow(wh.executor.Registry(), &req.WorkflowExport, id, req.CredentialBindings)
+	var unbound *engine.UnboundCredentialsError
+	if errors.As(err, &unbound) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success":     false,
+			"error":       "Bind the credentials of the workflow in credential_bindings",
+			"credentials": unbound.Names,
+		})
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid workflow export: %v", err))
+		return
+	}
+
+	migrations, err := wh.validateWorkflow(workflow)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid workflow: %v", err))
+		return
+	}
+	wh.add(workflow, migrations)
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":       true,
+		"id":            workflow.ID,
+		"workflow_id":   workflow.ID,
+		"imported_from": req.Workflow.ID,
+	})
 }
 
 // SaveWorkflowHandler saves a workflow
@@ -63,8 +454,63 @@ func (wh *WorkflowHandler) SaveWorkflowHandler(w http.ResponseWriter, r *http.Re
 	http.Error(w, "Not implemented", http.StatusNotImplemented)
 }
 
-// ListWorkflowsHandler lists all available workflows
+// ListWorkflowsHandler lists the deployed workflows, oldest first. Deleted
+// workflows are left out unless ?include_deleted=true. With ?status= only
+// workflows with that status are listed, deleted ones included when asked
+// for.
 func (wh *WorkflowHandler) ListWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement listing workflows from storage
-	http.Error(w, "Not implemented", http.StatusNotImplemented)
-}
\ No newline at end of file
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	status := types.WorkflowStatus(r.URL.Query().Get("status"))
+
+	wh.mu.RLock()
+	workflows := make([]*deployedWorkflow, 0, len(wh.workflows))
+	for _, deployed := range wh.workflows {
+		if status != "" {
+			if deployed.Status == status {
+				workflows = append(workflows, deployed)
+			}
+		} else if deployed.Status != types.WorkflowDeleted || includeDeleted {
+			workflows = append(workflows, deployed)
+		}
+	}
+	wh.mu.RUnlock()
+
+	sort.Slice(workflows, func(i, j int) bool {
+		if !workflows[i].CreatedAt.Equal(workflows[j].CreatedAt) {
+			return workflows[i].CreatedAt.Before(workflows[j].CreatedAt)
+		}
+		return workflows[i].ID < workflows[j].ID
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"workflows": workflows,
+		"count":     len(workflows),
+	})
+}
+
+// runContext returns ctx carrying the authenticated user, whose quotas the
+// nodes of runs started with it are held to
+func runContext(ctx context.Context) context.Context {
+	if userID, ok := middleware.UserIDFromContext(ctx); ok {
+		return engine.ContextWithUserID(ctx, userID)
+	}
+	return ctx
+}
+
+// decodeBody decodes the JSON request body into v. When it cannot, it
+// answers 413 for bodies over the request size limit and 400 with message
+// otherwise, and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, message string) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+	} else {
+		http.Error(w, message, http.StatusBadRequest)
+	}
+	return false
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/auth"
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDeployRejectsInvalidSchedule(t *testing.T) {
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+
+	deploy := func(cron string) *httptest.ResponseRecorder {
+		body := `{"id":"wf1","nodes":{"tick":{"id":"tick","type":"schedule_trigger","config":{"cron":"` + cron + `","timezone":"Europe/Berlin"}}}}`
+		rec := httptest.NewRecorder()
+		handler.DeployWorkflowHandler(rec, httptest.NewRequest(http.MethodPost, "/api/workflows", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := deploy("0 25 * * *")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid cron expression")
+
+	rec = deploy("@every 5m")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+// blockingNode runs until release is closed
+type blockingNode struct {
+	release chan struct{}
+}
+
+func (n *blockingNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	select {
+	case <-n.release:
+	case <-ctx.Done():
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (n *blockingNode) GetType() string { return "block" }
+func (n *blockingNode) GetID() string   { return "block" }
+
+func serveWorkflow(handler *WorkflowHandler, method, target, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc(WorkflowPathPrefix, handler.WorkflowByIDHandler)
+	mux.HandleFunc(WorkflowImportPath, handler.ImportWorkflowHandler)
+	mux.HandleFunc("/api/workflows", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			handler.DeployWorkflowHandler(w, r)
+			return
+		}
+		handler.ListWorkflowsHandler(w, r)
+	})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestUpdateRevalidatesWorkflow(t *testing.T) {
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+	rec := serveWorkflow(handler, http.MethodPost, "/api/workflows", `{"id":"wf1","name":"v1","nodes":{"tick":{"id":"tick","type":"schedule_trigger","config":{"cron":"@every 5m"}}}}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1", `{"name":"v2","nodes":{"tick":{"id":"tick","type":"schedule_trigger","config":{"cron":"0 25 * * *"}}}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid cron expression")
+
+	rec = serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1", `{"name":"v2","nodes":{"a":{"id":"a","type":"logger"}},"edges":[{"id":"e1","source":"a","target":"missing"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown nodes")
+
+	// The previous definition is kept
+	rec = serveWorkflow(handler, http.MethodGet, "/api/workflows/wf1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"v1"`)
+
+	rec = serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1", `{"id":"ignored","name":"v2","nodes":{"a":{"id":"a","type":"logger"}}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serveWorkflow(handler, http.MethodGet, "/api/workflows/wf1", "")
+	assert.Contains(t, rec.Body.String(), `"name":"v2"`)
+
+	rec = serveWorkflow(handler, http.MethodPut, "/api/workflows/unknown", `{"name":"v2"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUpdateConflictsWithRunningExecutions(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	node := &blockingNode{release: make(chan struct{})}
+	meta := types.NodeMetadata{ID: "block"}
+	require.NoError(t, registry.RegisterNodeType("block", engine.AdaptNode(func(map[string]interface{}) (interfaces.NodeInstance, error) { return node, nil }, meta), meta))
+	executor := engine.NewWorkflowExecutor(registry)
+	handler := NewWorkflowHandler(executor)
+
+	definition := `{"id":"wf1","nodes":{"b":{"id":"b","type":"block"}}}`
+	require.Equal(t, http.StatusCreated, serveWorkflow(handler, http.MethodPost, "/api/workflows", definition).Code)
+
+	var workflow engine.Workflow
+	require.NoError(t, json.Unmarshal([]byte(definition), &workflow))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		executor.ExecuteWorkflow(context.Background(), &workflow, nil)
+	}()
+	require.Eventually(t, func() bool { return executor.ActiveExecutions("wf1") == 1 }, time.Second, time.Millisecond)
+
+	rec := serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1", definition)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1?force=true", definition)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	close(node.release)
+	<-done
+	assert.Equal(t, 0, executor.ActiveExecutions("wf1"))
+	rec = serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1", definition)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestDeletedWorkflowsAreNotListed(t *testing.T) {
+	webhooks := NewWebhookHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()), webhooks)
+	for _, body := range []string{
+		`{"id":"wf1","nodes":{"hook":{"id":"hook","type":"webhook_trigger","config":{"path":"orders"}}}}`,
+		`{"id":"wf2","nodes":{}}`,
+	} {
+		require.Equal(t, http.StatusCreated, serveWorkflow(handler, http.MethodPost, "/api/workflows", body).Code)
+	}
+
+	rec := serveWorkflow(handler, http.MethodDelete, "/api/workflows/wf1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"deleted"`)
+
+	list := func(target string) []string {
+		rec := serveWorkflow(handler, http.MethodGet, target, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Workflows []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"workflows"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		var ids []string
+		for _, w := range body.Workflows {
+			ids = append(ids, w.ID+":"+w.Status)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"wf2:active"}, list("/api/workflows"))
+	assert.Equal(t, []string{"wf1:deleted", "wf2:active"}, list("/api/workflows?include_deleted=true"))
+
+	// ?status= lists only the workflows with that status
+	assert.Equal(t, []string{"wf2:active"}, list("/api/workflows?status=active"))
+	assert.Equal(t, []string{"wf1:deleted"}, list("/api/workflows?status=deleted"))
+	assert.Empty(t, list("/api/workflows?status=archived"))
+
+	// A deleted workflow is gone for every other route, triggers included
+	assert.Equal(t, http.StatusNotFound, serveWorkflow(handler, http.MethodGet, "/api/workflows/wf1", "").Code)
+	assert.Equal(t, http.StatusNotFound, serveWorkflow(handler, http.MethodDelete, "/api/workflows/wf1", "").Code)
+	assert.Equal(t, http.StatusNotFound, serveWorkflow(handler, http.MethodPut, "/api/workflows/wf1", `{}`).Code)
+	webhooks.mu.RLock()
+	assert.Empty(t, webhooks.triggers)
+	webhooks.mu.RUnlock()
+}
+
+func TestRejectedDeployLeavesNoTriggers(t *testing.T) {
+	executor := engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry())
+	webhooks := NewWebhookHandler(executor)
+	consumers := NewQueueConsumers(executor, nil)
+	t.Cleanup(consumers.Close)
+	handler := NewWorkflowHandler(executor, webhooks, consumers)
+
+	webhook := func() int {
+		rec := httptest.NewRecorder()
+		webhooks.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, WebhookPathPrefix+"wfx/p", strings.NewReader(`{}`)))
+		return rec.Code
+	}
+	hook := `"hook":{"id":"hook","type":"webhook_trigger","config":{"path":"p"}}`
+	consume := `"in":{"id":"in","type":"message_queue","config":{"operation":"consume","queue":"orders"}}`
+
+	// The webhook registry takes the workflow, the queue consumers refuse it
+	rec := serveWorkflow(handler, http.MethodPost, "/api/workflows", `{"id":"wfx","nodes":{`+hook+`,`+consume+`}}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no message broker is configured")
+	assert.Equal(t, http.StatusNotFound, webhook())
+
+	// A rejected redeploy keeps the triggers of the deployed definition
+	rec = serveWorkflow(handler, http.MethodPost, "/api/workflows", `{"id":"wfx","name":"v1","nodes":{`+hook+`}}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serveWorkflow(handler, http.MethodPost, "/api/workflows", `{"id":"wfx","name":"v2","nodes":{`+hook+`,`+consume+`}}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	webhooks.mu.RLock()
+	routed, exists := webhooks.triggers["wfx/p"]
+	webhooks.mu.RUnlock()
+	require.True(t, exists)
+	assert.Equal(t, "v1", routed.workflow.Name)
+}
+
+func TestDeployRejectsOversizedBodies(t *testing.T) {
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+	limited := middleware.LimitRequestBody(64, http.HandlerFunc(handler.DeployWorkflowHandler))
+	body := `{"id":"wf1","name":"` + strings.Repeat("x", 128) + `","nodes":{}}`
+
+	rec := httptest.NewRecorder()
+	limited.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/workflows", strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// Bodies of unknown length are cut off while decoding
+	req := httptest.NewRequest(http.MethodPost, "/api/workflows", strings.NewReader(body))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	limited.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestExportedWorkflowsCanBeImported(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "block", Version: "1.2.0"}
+	require.NoError(t, registry.RegisterNodeType("block", engine.AdaptNode(func(map[string]interface{}) (interfaces.NodeInstance, error) { return &blockingNode{}, nil }, meta), meta))
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(registry))
+
+	definition := `{"id":"wf1","name":"sync","nodes":{"a":{"id":"a","type":"block","config":{"token":"Bearer {{credentials.github}}"}},"b":{"id":"b","type":"block"}},"edges":[{"id":"e1","source":"a","target":"b"}]}`
+	require.Equal(t, http.StatusCreated, serveWorkflow(handler, http.MethodPost, "/api/workflows", definition).Code)
+
+	rec := serveWorkflow(handler, http.MethodGet, "/api/workflows/wf1/export", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var export map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &export))
+	assert.EqualValues(t, engine.ExportFormatVersion, export["format_version"])
+	assert.Equal(t, map[string]interface{}{"block": "1.2.0"}, export["node_types"])
+	assert.Equal(t, []interface{}{"github"}, export["credentials"])
+
+	// The credentials have to be bound first
+	rec = serveWorkflow(handler, http.MethodPost, WorkflowImportPath, rec.Body.String())
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"credentials":["github"]`)
+
+	export["credential_bindings"] = map[string]string{"github": "github_prod"}
+	body, err := json.Marshal(export)
+	require.NoError(t, err)
+	rec = serveWorkflow(handler, http.MethodPost, WorkflowImportPath, string(body))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var imported struct {
+		ID           string `json:"id"`
+		ImportedFrom string `json:"imported_from"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &imported))
+	assert.NotEqual(t, "wf1", imported.ID)
+	assert.Equal(t, "wf1", imported.ImportedFrom)
+
+	rec = serveWorkflow(handler, http.MethodGet, "/api/workflows/"+imported.ID, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got struct {
+		Workflow engine.Workflow `json:"workflow"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "sync", got.Workflow.Name)
+	assert.Equal(t, "Bearer {{credentials.github_prod}}", got.Workflow.Nodes["a"].Config["token"])
+	assert.Equal(t, []engine.WorkflowEdge{{ID: "e1", Source: "a", Target: "b"}}, got.Workflow.Edges)
+
+	assert.Equal(t, http.StatusNotFound, serveWorkflow(handler, http.MethodGet, "/api/workflows/missing/export", "").Code)
+}
+
+func TestImportRejectsUnknownNodeTypes(t *testing.T) {
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+
+	rec := serveWorkflow(handler, http.MethodPost, WorkflowImportPath, `{"format_version":1,"workflow":{"id":"wf1","nodes":{"x":{"id":"x","type":"teleport"}}},"node_types":{"teleport":"1.0.0"}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown type teleport")
+
+	rec = serveWorkflow(handler, http.MethodGet, "/api/workflows", "")
+	assert.Contains(t, rec.Body.String(), `"count":0`)
+}
+
+// sendNode counts the messages it sends
+type sendNode struct {
+	sent *int
+}
+
+func (n *sendNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	*n.sent++
+	return map[string]interface{}{"sent": true}, nil
+}
+
+func (n *sendNode) GetType() string { return "send" }
+func (n *sendNode) GetID() string   { return "send" }
+
+func TestDryRunDoesNotExecuteSideEffects(t *testing.T) {
+	var sent int
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "send", SideEffects: true}
+	require.NoError(t, registry.RegisterNodeType("send", engine.AdaptNode(func(map[string]interface{}) (interfaces.NodeInstance, error) { return &sendNode{sent: &sent}, nil }, meta), meta))
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(registry))
+
+	execute := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ExecuteWorkflowHandler(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"id":"wf1","nodes":{"s":{"id":"s","type":"send"}}}`)))
+		return rec
+	}
+
+	rec := execute("/api/workflows/execute?dry_run=true")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		DryRun  bool                   `json:"dry_run"`
+		Stubbed []string               `json:"stubbed"`
+		Results map[string]interface{} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, body.DryRun)
+	assert.Equal(t, []string{"s"}, body.Stubbed)
+	assert.Equal(t, map[string]interface{}{"simulated": true}, body.Results["s"])
+	assert.Zero(t, sent)
+
+	rec = execute("/api/workflows/execute")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, 1, sent)
+}
+
+// userNode records the user the run it executes in was started for
+type userNode struct {
+	userID *string
+}
+
+func (n *userNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	*n.userID = engine.UserIDFromContext(ctx)
+	return map[string]interface{}{}, nil
+}
+
+func (n *userNode) GetType() string { return "user" }
+func (n *userNode) GetID() string   { return "user" }
+
+func TestExecutionsRunAsTheAuthenticatedUser(t *testing.T) {
+	var userID string
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "user"}
+	require.NoError(t, registry.RegisterNodeType("user", engine.AdaptNode(func(map[string]interface{}) (interfaces.NodeInstance, error) { return &userNode{userID: &userID}, nil }, meta), meta))
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(registry))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/workflows/execute", strings.NewReader(`{"id":"wf1","nodes":{"u":{"id":"u","type":"user"}}}`))
+	req = req.WithContext(middleware.WithUserID(req.Context(), "alice"))
+	rec := httptest.NewRecorder()
+	handler.ExecuteWorkflowHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "alice", userID)
+}
+
+func TestDeployRejectsInvalidEdgeMappings(t *testing.T) {
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+	nodes := `"nodes":{"a":{"id":"a","type":"logger"},"b":{"id":"b","type":"logger"}}`
+
+	rec := serveWorkflow(handler, http.MethodPost, "/api/workflows", `{"id":"wf1",`+nodes+`,"edges":[{"id":"e1","source":"a","target":"b","mapping":{"userId":"source.user.id +"}}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "edge e1 has an invalid mapping")
+
+	rec = serveWorkflow(handler, http.MethodPost, "/api/workflows", `{"id":"wf1",`+nodes+`,"edges":[{"id":"e1","source":"a","target":"b","mapping":{"userId":"source.user.id ?? 0"}}]}`)
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+}
+
+func TestRecordAndReplayExecution(t *testing.T) {
+	var sent int
+	registry := engine.NewNodeTypeRegistry()
+	meta := types.NodeMetadata{ID: "send", External: true}
+	require.NoError(t, registry.RegisterNodeType("send", engine.AdaptNode(func(map[string]interface{}) (interfaces.NodeInstance, error) { return &sendNode{sent: &sent}, nil }, meta), meta))
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetCallStore(engine.NewMemoryCallStore(), 0)
+	handler := NewWorkflowHandler(executor)
+
+	type response struct {
+		RecordingID string                 `json:"recording_id"`
+		Replayed    bool                   `json:"replayed"`
+		Results     map[string]interface{} `json:"results"`
+	}
+	execute := func(target string) response {
+		rec := httptest.NewRecorder()
+		handler.ExecuteWorkflowHandler(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"id":"wf1","nodes":{"s":{"id":"s","type":"send"}}}`)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var body response
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body
+	}
+
+	recorded := execute("/api/workflows/execute?record=true")
+	require.NotEmpty(t, recorded.RecordingID)
+	assert.False(t, recorded.Replayed)
+	assert.Equal(t, 1, sent)
+
+	replayed := execute("/api/workflows/execute?replay=" + recorded.RecordingID)
+	assert.True(t, replayed.Replayed)
+	assert.Equal(t, recorded.RecordingID, replayed.RecordingID)
+	assert.Equal(t, map[string]interface{}{"sent": true}, replayed.Results["s"])
+	assert.Equal(t, 1, sent, "replayed calls are not made")
+}
+
+func TestWorkflowRoutesEnforceRoles(t *testing.T) {
+	auth, err := middleware.NewJWTAuth(middleware.JWTConfig{Secret: strings.Repeat("s", 32)})
+	require.NoError(t, err)
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+	routes := auth.HTTP(middleware.RequireRoleByMethod(accounts.RoleViewer, accounts.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			handler.DeployWorkflowHandler(w, r)
+			return
+		}
+		handler.ListWorkflowsHandler(w, r)
+	})))
+
+	serve := func(method, body string, roles ...string) *httptest.ResponseRecorder {
+		token, err := auth.IssueToken("user-1", time.Hour, roles...)
+		require.NoError(t, err)
+		req := httptest.NewRequest(method, "/api/workflows", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, `{"id":"wf1","nodes":{}}`, accounts.RoleViewer)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "editor")
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "", accounts.RoleViewer).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "").Code, "tokens without roles get nothing")
+
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, `{"id":"wf1","nodes":{}}`, accounts.RoleAdmin).Code)
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, `{"id":"wf2","nodes":{}}`, accounts.RoleEditor).Code)
+}
+
+func TestWorkflowRoutesEnforceAccountRoles(t *testing.T) {
+	ctx := context.Background()
+	secret := strings.Repeat("s", 32)
+	authenticator := accounts.NewAuthenticator(accounts.NewMemoryStore(), bcrypt.MinCost)
+	apiKeys := auth.NewAPIKeyService(auth.NewMemoryAPIKeyStore(), authenticator)
+	jwtAuth, err := middleware.NewJWTAuth(middleware.JWTConfig{Secret: secret, Blacklist: middleware.NewMemoryTokenBlacklist(), APIKeys: apiKeys})
+	require.NoError(t, err)
+	handler := NewWorkflowHandler(engine.NewWorkflowExecutor(engine.NewNodeTypeRegistry()))
+	routes := jwtAuth.HTTP(middleware.RequireRoleByMethod(accounts.RoleViewer, accounts.RoleEditor, http.HandlerFunc(handler.DeployWorkflowHandler)))
+
+	deploy := func(authorization, id string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/workflows", strings.NewReader(`{"id":"`+id+`","nodes":{}}`))
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	login := func() string {
+		account, err := authenticator.Login(ctx, "ada@example.com", "correct horse")
+		require.NoError(t, err)
+		token, err := accounts.AccessToken(account, false, []byte(secret), time.Hour)
+		require.NoError(t, err)
+		return "Bearer " + token
+	}
+
+	// Logins of the lite server carry the account's roles
+	account, err := authenticator.Register(ctx, "ada@example.com", "", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, deploy(login(), "wf1"), "new accounts are viewers")
+	require.NoError(t, authenticator.SetRoles(ctx, account.ID, []string{accounts.RoleEditor}))
+	assert.Equal(t, http.StatusCreated, deploy(login(), "wf1"))
+
+	// API keys act with the owner's current roles
+	key, _, err := apiKeys.Issue(ctx, strconv.FormatInt(account.ID, 10), "ci", []string{"workflows:write"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, deploy("ApiKey "+key, "wf2"))
+	require.NoError(t, authenticator.SetRoles(ctx, account.ID, []string{accounts.RoleViewer}))
+	assert.Equal(t, http.StatusForbidden, deploy("ApiKey "+key, "wf3"))
+}
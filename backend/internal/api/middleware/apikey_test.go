@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticAPIKeys accepts the keys it maps to their scopes, for user "bot"
+// with the editor role
+type staticAPIKeys map[string][]string
+
+func (k staticAPIKeys) ValidateAPIKey(ctx context.Context, key string) (*APIKeyGrant, error) {
+	if key == "cta_down" {
+		return nil, errors.New("database unavailable")
+	}
+	scopes, ok := k[key]
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	return &APIKeyGrant{UserID: "bot", Scopes: scopes, Roles: []string{"editor"}}, nil
+}
+
+func TestRequiredScope(t *testing.T) {
+	assert.Equal(t, "workflows:read", RequiredScope(http.MethodGet, "/api/v1/workflows/wf1"))
+	assert.Equal(t, "workflows:write", RequiredScope(http.MethodPost, "/api/workflows"))
+	assert.Equal(t, "executions:write", RequiredScope(http.MethodDelete, "/api/v1/executions/e1"))
+	assert.Equal(t, "apikeys:read", RequiredScope(http.MethodHead, "/api/v1/apikeys"))
+	assert.Equal(t, "ws:read", RequiredScope(http.MethodGet, "/ws"))
+
+	assert.True(t, ScopesAllow([]string{"workflows:read"}, "workflows:read"))
+	assert.False(t, ScopesAllow([]string{"workflows:read"}, "workflows:write"))
+	assert.True(t, ScopesAllow([]string{"workflows:*"}, "workflows:write"))
+	assert.True(t, ScopesAllow([]string{"*"}, "credentials:write"))
+	assert.False(t, ScopesAllow(nil, "workflows:read"))
+
+	assert.True(t, ValidScope("workflows:write"))
+	assert.False(t, ValidScope("workflows"))
+	assert.False(t, ValidScope("workflows:delete"))
+	assert.False(t, ValidScope("*:read"))
+}
+
+func TestJWTAcceptsScopedAPIKeys(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret, APIKeys: staticAPIKeys{"cta_deploy": {"workflows:*", "executions:read"}}})
+	require.NoError(t, err)
+	handler := auth.HTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		w.Write([]byte(userID))
+	}))
+
+	serve := func(method, path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/api/workflows", "ApiKey cta_deploy")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bot", rec.Body.String())
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/executions/e1", "apikey cta_deploy").Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/api/v1/executions/e1", "ApiKey cta_deploy").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/credentials", "ApiKey cta_deploy").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/workflows", "ApiKey cta_unknown").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/api/workflows", "Bearer cta_deploy").Code, "keys are not bearer tokens")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/api/workflows", "ApiKey cta_down").Code)
+
+	// Without a validator the scheme is not accepted at all
+	plain, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/workflows", nil)
+	req.Header.Set("Authorization", "ApiKey cta_deploy")
+	plain.HTTP(handler).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestStreamTokensOfAPIKeysKeepTheirScopes(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{
+		Secret:      testJWTSecret,
+		APIKeys:     staticAPIKeys{"cta_watch": {"stream-token:write", "ws:read"}},
+		StreamPaths: []string{"/api/v1/ws", "/api/v1/executions/*"},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/stream-token", nil)
+	req.Header.Set("Authorization", "ApiKey cta_watch")
+	rec := httptest.NewRecorder()
+	auth.HTTP(http.HandlerFunc(auth.StreamTokenHTTP)).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var issued struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+
+	handler := auth.HTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes, _ := APIKeyScopesFromContext(r.Context())
+		w.Write([]byte(strings.Join(scopes, ",")))
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+"?access_token="+issued.Token, nil))
+		return rec
+	}
+
+	rec = serve("/api/v1/ws")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "stream-token:write,ws:read", rec.Body.String(), "the stream is limited as the key is")
+	assert.Equal(t, http.StatusForbidden, serve("/api/v1/executions/e1/events").Code, "the key cannot read executions")
+}
@@ -7,15 +7,18 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// AuditStore executes the statements that record audit entries
+type AuditStore interface {
+	Exec(query string, args ...interface{}) error
+}
+
 // AuditMiddleware logs all requests for audit purposes
 type AuditMiddleware struct {
-	db interface {
-		Exec(query string, args ...interface{}) error
-	}
+	db AuditStore
 }
 
 // NewAuditMiddleware creates a new audit middleware
-func NewAuditMiddleware(db interface{}) *AuditMiddleware {
+func NewAuditMiddleware(db AuditStore) *AuditMiddleware {
 	return &AuditMiddleware{db: db}
 }
 
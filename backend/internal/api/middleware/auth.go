@@ -9,20 +9,21 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// PermissionChecker looks up the permissions granted to a user
+type PermissionChecker interface {
+	HasPermission(userID string, permission string) (bool, error)
+	GetUserPermissions(userID string) ([]string, error)
+}
+
 // AuthMiddleware handles both JWT and API key authentication
 type AuthMiddleware struct {
 	jwtSecret     string
-	apiKeyService interface {
-		ValidateAPIKey(key string) (string, error)
-	}
-	rbacService interface {
-		HasPermission(userID string, permission string) (bool, error)
-		GetUserPermissions(userID string) ([]string, error)
-	}
+	apiKeyService APIKeyValidator
+	rbacService   PermissionChecker
 }
 
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(jwtSecret string, apiKeyService, rbacService interface{}) *AuthMiddleware {
+func NewAuthMiddleware(jwtSecret string, apiKeyService APIKeyValidator, rbacService PermissionChecker) *AuthMiddleware {
 	return &AuthMiddleware{
 		jwtSecret:     jwtSecret,
 		apiKeyService: apiKeyService,
@@ -54,15 +55,21 @@ func (m *AuthMiddleware) Authenticate() fiber.Handler {
 // authenticateWithAPIKey validates API key and sets user context
 func (m *AuthMiddleware) authenticateWithAPIKey(c *fiber.Ctx, apiKey string) error {
 	// Validate API key
-	userID, err := m.apiKeyService.ValidateAPIKey(apiKey)
+	grant, err := m.apiKeyService.ValidateAPIKey(c.UserContext(), apiKey)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{
 			"error": "Invalid API key",
 		})
 	}
+	if !ScopesAllow(grant.Scopes, RequiredScope(c.Method(), c.Path())) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": ErrInsufficientScope.Error(),
+		})
+	}
 
 	// Set user context
-	c.Locals("userID", userID)
+	c.Locals("userID", grant.UserID)
+	c.Locals("roles", grant.Roles)
 	c.Locals("authType", "apikey")
 
 	return c.Next()
@@ -212,8 +219,11 @@ func (m *AuthMiddleware) RequireAllPermissions(permissions ...string) fiber.Hand
 
 // extractAPIKey extracts API key from Authorization header or query parameter
 func extractAPIKey(c *fiber.Ctx) string {
-	// Try Authorization header first (Bearer token)
+	// Try Authorization header first (ApiKey or Bearer scheme)
 	auth := c.Get("Authorization")
+	if key := apiKeyToken(auth); key != "" {
+		return key
+	}
 	if strings.HasPrefix(auth, "Bearer ") {
 		token := strings.TrimPrefix(auth, "Bearer ")
 		// Check if it's an API key (starts with cta_)
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBlacklist records revoked tokens by their JTI ("jwt id") claim until
+// they would have expired anyway
+type TokenBlacklist interface {
+	// Revoke blacklists jti until expiresAt
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsRevoked reports whether jti has been revoked
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// MemoryTokenBlacklist keeps revoked tokens in process memory. Revocations
+// are not shared between instances; use RedisTokenBlacklist for that.
+type MemoryTokenBlacklist struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	now     func() time.Time
+}
+
+// NewMemoryTokenBlacklist creates an empty in-memory token blacklist
+func NewMemoryTokenBlacklist() *MemoryTokenBlacklist {
+	return &MemoryTokenBlacklist{
+		revoked: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Revoke implements TokenBlacklist
+func (b *MemoryTokenBlacklist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	// Expired entries can go, the token is rejected for its expiry anyway
+	for id, exp := range b.revoked {
+		if !now.Before(exp) {
+			delete(b.revoked, id)
+		}
+	}
+	if now.Before(expiresAt) {
+		b.revoked[jti] = expiresAt
+	}
+	return nil
+}
+
+// IsRevoked implements TokenBlacklist
+func (b *MemoryTokenBlacklist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	exp, ok := b.revoked[jti]
+	return ok && b.now().Before(exp), nil
+}
+
+// RedisTokenBlacklist keeps revoked tokens in Redis so that a logout applies
+// to all instances. Each entry expires with the token it revokes.
+type RedisTokenBlacklist struct {
+	client redis.UniversalClient
+}
+
+// NewRedisTokenBlacklist creates a Redis-backed token blacklist
+func NewRedisTokenBlacklist(client redis.UniversalClient) *RedisTokenBlacklist {
+	return &RedisTokenBlacklist{client: client}
+}
+
+// Revoke implements TokenBlacklist
+func (b *RedisTokenBlacklist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return b.client.Set(ctx, blacklistKey(jti), 1, ttl).Err()
+}
+
+// IsRevoked implements TokenBlacklist
+func (b *RedisTokenBlacklist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := b.client.Exists(ctx, blacklistKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func blacklistKey(jti string) string {
+	return "jwt:blacklist:" + jti
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// DefaultMaxRequestBodySize bounds request bodies unless configured
+// otherwise, like api.max_request_size of the application config
+const DefaultMaxRequestBodySize = 10 << 20
+
+// LimitRequestBody wraps next so that request bodies over max bytes cannot
+// be read. Requests declaring a longer body are refused with 413 up front;
+// reading past the limit of others fails with an *http.MaxBytesError,
+// which handlers answer with 413 too.
+func LimitRequestBody(max int64, next http.Handler) http.Handler {
+	if max <= 0 {
+		max = DefaultMaxRequestBodySize
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
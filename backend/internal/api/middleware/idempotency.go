@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyKeyHeader is the header clients set to make a request safe to
+// retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the keys kept in the store
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is what is kept for an idempotency key: a fingerprint
+// of the request that first used it and, once that request finished, its
+// response
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore keeps idempotency records until their TTL expires
+type IdempotencyStore interface {
+	// Reserve records key for a request with the given fingerprint unless
+	// it is already taken. It returns the existing record and false when it
+	// is, or the new record and true.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error)
+	// Complete stores the response of the request that reserved key
+	Complete(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Release forgets key, so that the request can be retried with it
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyConfig holds idempotency configuration
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+	TTL   time.Duration // how long a key is remembered
+}
+
+// Idempotency returns a Fiber handler that replays the response of a
+// request sent again with the same Idempotency-Key header within TTL,
+// instead of handling it twice. A key reused with a different method, path
+// or body, or while the first request is still being handled, gets 409.
+// Keys are scoped to the authenticated user. Requests without the header,
+// and failed requests, which release their key, are handled as usual. If
+// the store fails the request is let through.
+func Idempotency(config IdempotencyConfig) fiber.Handler {
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Idempotency-Key is too long",
+			})
+		}
+
+		ctx := c.UserContext()
+		storeKey := idempotencyKey(c, key)
+		fingerprint := requestFingerprint(c)
+
+		record, reserved, err := config.Store.Reserve(ctx, storeKey, fingerprint, config.TTL)
+		if err != nil {
+			log.Printf("Idempotency store unavailable, handling request: %v", err)
+			return c.Next()
+		}
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Idempotency-Key was already used for a different request",
+				})
+			case !record.Completed:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "A request with this Idempotency-Key is still in progress",
+				})
+			}
+			c.Set("Idempotent-Replayed", "true")
+			if record.ContentType != "" {
+				c.Set(fiber.HeaderContentType, record.ContentType)
+			}
+			return c.Status(record.Status).Send(record.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			config.release(ctx, storeKey)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			config.release(ctx, storeKey)
+			return nil
+		}
+
+		record.Completed = true
+		record.Status = status
+		record.ContentType = string(c.Response().Header.ContentType())
+		record.Body = append([]byte(nil), c.Response().Body()...)
+		if err := config.Store.Complete(ctx, storeKey, record, config.TTL); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+			config.release(ctx, storeKey)
+		}
+		return nil
+	}
+}
+
+func (config IdempotencyConfig) release(ctx context.Context, key string) {
+	if err := config.Store.Release(ctx, key); err != nil {
+		log.Printf("Failed to release idempotency key: %v", err)
+	}
+}
+
+// idempotencyKey scopes key to the user, so that users cannot see each
+// other's responses by guessing keys
+func idempotencyKey(c *fiber.Ctx, key string) string {
+	userID, _ := c.Locals("userID").(string)
+	return "idempotency:" + userID + ":" + key
+}
+
+// requestFingerprint hashes what makes two requests the same
+func requestFingerprint(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Path()))
+	hash.Write([]byte{0})
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// MemoryIdempotencyStore keeps idempotency records in process memory.
+// Records are not shared between instances; use RedisIdempotencyStore for
+// that.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*memoryIdempotencyRecord
+	now     func() time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory idempotency store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]*memoryIdempotencyRecord),
+		now:     time.Now,
+	}
+}
+
+// Reserve implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	// Expired records can go, their keys are free again
+	for k, r := range s.records {
+		if !now.Before(r.expiresAt) {
+			delete(s.records, k)
+		}
+	}
+
+	if existing, ok := s.records[key]; ok {
+		record := existing.record
+		return &record, false, nil
+	}
+	s.records[key] = &memoryIdempotencyRecord{
+		record:    IdempotencyRecord{Fingerprint: fingerprint},
+		expiresAt: now.Add(ttl),
+	}
+	return &IdempotencyRecord{Fingerprint: fingerprint}, true, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = &memoryIdempotencyRecord{record: *record, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// RedisIdempotencyStore keeps idempotency records in Redis so that a retry
+// reaching another instance is recognised too. Each record expires with its
+// TTL.
+type RedisIdempotencyStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisIdempotencyStore creates a Redis-backed idempotency store
+func NewRedisIdempotencyStore(client redis.UniversalClient) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client}
+}
+
+// Reserve implements IdempotencyStore
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	record := &IdempotencyRecord{Fingerprint: fingerprint}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// SET NX fails with redis.Nil when another request took the key first
+	err = s.client.SetArgs(ctx, key, data, redis.SetArgs{Mode: "NX", TTL: ttl}).Err()
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return nil, false, err
+	}
+
+	existing, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Expired or released in between, try again
+		return s.Reserve(ctx, key, fingerprint, ttl)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var stored IdempotencyRecord
+	if err := json.Unmarshal(existing, &stored); err != nil {
+		return nil, false, err
+	}
+	return &stored, false, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, data, ttl).Err()
+}
+
+// Release implements IdempotencyStore
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIdempotentApp serves an execute route that starts a new execution on
+// every call it handles
+func newIdempotentApp(config IdempotencyConfig) (*fiber.App, *int32) {
+	var executions int32
+	app := fiber.New()
+	app.Post("/execute", Idempotency(config), func(c *fiber.Ctx) error {
+		if strings.Contains(string(c.Body()), "fail") {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed"})
+		}
+		id := atomic.AddInt32(&executions, 1)
+		return c.JSON(fiber.Map{"execution_id": fmt.Sprintf("exec_%d", id)})
+	})
+	return app, &executions
+}
+
+type executeResponse struct {
+	status      int
+	replayed    bool
+	executionID string
+}
+
+func execute(t *testing.T, app *fiber.App, key, body string) executeResponse {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/execute", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var payload struct {
+		ExecutionID string `json:"execution_id"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&payload)
+	return executeResponse{
+		status:      resp.StatusCode,
+		replayed:    resp.Header.Get("Idempotent-Replayed") == "true",
+		executionID: payload.ExecutionID,
+	}
+}
+
+func idempotencyStores(t *testing.T) map[string]IdempotencyStore {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return map[string]IdempotencyStore{
+		"memory": NewMemoryIdempotencyStore(),
+		"redis":  NewRedisIdempotencyStore(client),
+	}
+}
+
+func TestIdempotencyReplaysDuplicateKey(t *testing.T) {
+	for name, store := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			app, executions := newIdempotentApp(IdempotencyConfig{Store: store, TTL: time.Hour})
+
+			first := execute(t, app, "key-1", `{"workflow_id":"wf"}`)
+			second := execute(t, app, "key-1", `{"workflow_id":"wf"}`)
+
+			assert.Equal(t, fiber.StatusOK, first.status)
+			assert.False(t, first.replayed)
+			assert.Equal(t, fiber.StatusOK, second.status)
+			assert.True(t, second.replayed)
+			assert.Equal(t, first.executionID, second.executionID)
+			assert.Equal(t, int32(1), atomic.LoadInt32(executions))
+
+			// Another key, or none, starts another execution
+			assert.NotEqual(t, first.executionID, execute(t, app, "key-2", `{"workflow_id":"wf"}`).executionID)
+			assert.NotEqual(t, first.executionID, execute(t, app, "", `{"workflow_id":"wf"}`).executionID)
+		})
+	}
+}
+
+func TestIdempotencyRejectsKeyReusedWithDifferentBody(t *testing.T) {
+	for name, store := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			app, executions := newIdempotentApp(IdempotencyConfig{Store: store, TTL: time.Hour})
+
+			assert.Equal(t, fiber.StatusOK, execute(t, app, "key-1", `{"workflow_id":"wf"}`).status)
+			assert.Equal(t, fiber.StatusConflict, execute(t, app, "key-1", `{"workflow_id":"other"}`).status)
+			assert.Equal(t, int32(1), atomic.LoadInt32(executions))
+		})
+	}
+}
+
+func TestIdempotencyReleasesKeyOfFailedRequest(t *testing.T) {
+	app, executions := newIdempotentApp(IdempotencyConfig{TTL: time.Hour})
+
+	assert.Equal(t, fiber.StatusInternalServerError, execute(t, app, "key-1", `{"fail":true}`).status)
+	assert.Equal(t, fiber.StatusOK, execute(t, app, "key-1", `{"workflow_id":"wf"}`).status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(executions))
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		store := NewMemoryIdempotencyStore()
+		store.now = func() time.Time { return now }
+		app, executions := newIdempotentApp(IdempotencyConfig{Store: store, TTL: time.Minute})
+
+		first := execute(t, app, "key-1", `{"workflow_id":"wf"}`)
+		now = now.Add(time.Minute)
+		second := execute(t, app, "key-1", `{"workflow_id":"other"}`)
+
+		assert.Equal(t, fiber.StatusOK, second.status)
+		assert.NotEqual(t, first.executionID, second.executionID)
+		assert.Equal(t, int32(2), atomic.LoadInt32(executions))
+		assert.Len(t, store.records, 1)
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer client.Close()
+		app, executions := newIdempotentApp(IdempotencyConfig{Store: NewRedisIdempotencyStore(client), TTL: time.Minute})
+
+		first := execute(t, app, "key-1", `{"workflow_id":"wf"}`)
+		server.FastForward(time.Minute)
+		second := execute(t, app, "key-1", `{"workflow_id":"wf"}`)
+
+		assert.Equal(t, fiber.StatusOK, second.status)
+		assert.False(t, second.replayed)
+		assert.NotEqual(t, first.executionID, second.executionID)
+		assert.Equal(t, int32(2), atomic.LoadInt32(executions))
+	})
+}
+
+func TestIdempotencyKeysAreScopedPerUser(t *testing.T) {
+	var executions int32
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", c.Get("X-User"))
+		return c.Next()
+	})
+	app.Post("/execute", Idempotency(IdempotencyConfig{}), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"execution_id": fmt.Sprintf("exec_%d", atomic.AddInt32(&executions, 1))})
+	})
+
+	for _, user := range []string{"alice", "bob"} {
+		req := httptest.NewRequest("POST", "/execute", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		req.Header.Set("X-User", user)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&executions))
+}
@@ -0,0 +1,490 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// DefaultPublicPaths are reachable without a token: the root, health checks
+// and the login/OAuth endpoints
+var DefaultPublicPaths = []string{"/", "/health", "/auth/*"}
+
+// JWTConfig holds JWT authentication configuration
+type JWTConfig struct {
+	Secret    string
+	Algorithm string // HS256 (default), HS384 or HS512
+	// PublicPaths are exact paths, or prefixes when they end in "*"
+	PublicPaths []string
+	// Blacklist enables logout: revoked tokens are rejected and tokens
+	// without a "jti" claim are not accepted
+	Blacklist TokenBlacklist
+	// Metrics, when set, counts authentication successes and failures
+	Metrics AuthMetrics
+	// APIKeys, when set, also accepts "Authorization: ApiKey <key>"
+	// headers for requests within the key's scopes
+	APIKeys APIKeyValidator
+	// StreamPaths are the paths of event streams, matched like PublicPaths,
+	// which browsers open without an Authorization header. GET requests to
+	// them may pass a stream token (see IssueStreamToken) in the
+	// access_token query parameter instead.
+	StreamPaths []string
+}
+
+// AuthMetrics counts authentication attempts by method, "jwt" or "apikey"
+type AuthMetrics interface {
+	RecordAuth(method string, success bool)
+}
+
+// JWTAuth validates "Authorization: Bearer" tokens signed with a shared
+// secret, and optionally API keys, and records the authenticated user ID
+// for handlers
+type JWTAuth struct {
+	secret      []byte
+	algorithm   string
+	publicPaths []string
+	blacklist   TokenBlacklist
+	metrics     AuthMetrics
+	apiKeys     APIKeyValidator
+	streamPaths []string
+}
+
+// StreamTokenTTL is how long stream tokens can be used to open a stream
+const StreamTokenTTL = time.Minute
+
+// streamAudience is the "aud" claim of stream tokens, which are only
+// accepted from the query of StreamPaths
+const streamAudience = "citadel-stream"
+
+// NewJWTAuth creates a JWT authenticator. A secret is required.
+func NewJWTAuth(config JWTConfig) (*JWTAuth, error) {
+	if config.Secret == "" {
+		return nil, errors.New("jwt secret is required")
+	}
+
+	algorithm := strings.ToUpper(config.Algorithm)
+	if algorithm == "" {
+		algorithm = jwt.SigningMethodHS256.Alg()
+	}
+	switch algorithm {
+	case jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg():
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm: %s", config.Algorithm)
+	}
+
+	publicPaths := config.PublicPaths
+	if publicPaths == nil {
+		publicPaths = DefaultPublicPaths
+	}
+
+	return &JWTAuth{
+		secret:      []byte(config.Secret),
+		algorithm:   algorithm,
+		publicPaths: publicPaths,
+		blacklist:   config.Blacklist,
+		metrics:     config.Metrics,
+		apiKeys:     config.APIKeys,
+		streamPaths: config.StreamPaths,
+	}, nil
+}
+
+// Errors returned by ValidateToken
+var (
+	ErrMissingToken = errors.New("missing authentication token")
+	ErrTokenExpired = errors.New("token has expired")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// ErrRevocationDisabled is returned by Revoke when no blacklist is configured
+var ErrRevocationDisabled = errors.New("token revocation is not enabled")
+
+// IssueToken signs a token for userID with roles that expires after ttl.
+// Every token gets a unique "jti" claim so that it can be revoked on its
+// own.
+func (a *JWTAuth) IssueToken(userID string, ttl time.Duration, roles ...string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"jti": uuid.NewString(),
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	return jwt.NewWithClaims(jwt.GetSigningMethod(a.algorithm), claims).SignedString(a.secret)
+}
+
+// IssueStreamToken signs a token for userID with roles that can only be
+// used to open the event streams of StreamPaths, for StreamTokenTTL. Since
+// it is passed in the URL, where it may be logged, it is short-lived and
+// not accepted anywhere else.
+func (a *JWTAuth) IssueStreamToken(userID string, roles ...string) (string, error) {
+	return a.issueStreamToken(userID, nil, roles)
+}
+
+// IssueScopedStreamToken signs a stream token as IssueStreamToken does,
+// limited to scopes as the API key it is issued to is
+func (a *JWTAuth) IssueScopedStreamToken(userID string, scopes []string, roles ...string) (string, error) {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return a.issueStreamToken(userID, scopes, roles)
+}
+
+// issueStreamToken signs a stream token, with a "scopes" claim unless
+// scopes is nil
+func (a *JWTAuth) issueStreamToken(userID string, scopes, roles []string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"jti": uuid.NewString(),
+		"aud": streamAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(StreamTokenTTL).Unix(),
+	}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	if scopes != nil {
+		claims["scopes"] = scopes
+	}
+	return jwt.NewWithClaims(jwt.GetSigningMethod(a.algorithm), claims).SignedString(a.secret)
+}
+
+// ValidateToken checks a token's signature, algorithm, expiry and, with a
+// blacklist, revocation, and returns the user ID from its "user_id" or "sub"
+// claim. Stream tokens are rejected.
+func (a *JWTAuth) ValidateToken(ctx context.Context, tokenString string) (string, jwt.MapClaims, error) {
+	return a.validate(ctx, tokenString, false)
+}
+
+// ValidateStreamToken checks a stream token as ValidateToken checks other
+// tokens
+func (a *JWTAuth) ValidateStreamToken(ctx context.Context, tokenString string) (string, jwt.MapClaims, error) {
+	return a.validate(ctx, tokenString, true)
+}
+
+// validate checks a stream token when stream is set, and any other token
+// otherwise
+func (a *JWTAuth) validate(ctx context.Context, tokenString string, stream bool) (string, jwt.MapClaims, error) {
+	if tokenString == "" {
+		return "", nil, ErrMissingToken
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{a.algorithm}), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return "", nil, ErrTokenExpired
+	}
+	if err != nil {
+		return "", nil, ErrInvalidToken
+	}
+	if audience, _ := claims.GetAudience(); slices.Contains(audience, streamAudience) != stream {
+		return "", nil, ErrInvalidToken
+	}
+
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		userID, _ = claims["sub"].(string)
+	}
+	if userID == "" {
+		return "", nil, ErrInvalidToken
+	}
+
+	if a.blacklist != nil {
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			return "", nil, ErrInvalidToken
+		}
+		revoked, err := a.blacklist.IsRevoked(ctx, jti)
+		if err != nil {
+			return "", nil, fmt.Errorf("checking token revocation: %w", err)
+		}
+		if revoked {
+			return "", nil, ErrTokenRevoked
+		}
+	}
+	return userID, claims, nil
+}
+
+// Revoke validates a token and blacklists its JTI for the rest of its
+// lifetime
+func (a *JWTAuth) Revoke(ctx context.Context, tokenString string) error {
+	if a.blacklist == nil {
+		return ErrRevocationDisabled
+	}
+	_, claims, err := a.ValidateToken(ctx, tokenString)
+	if err != nil {
+		return err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return ErrInvalidToken
+	}
+	return a.blacklist.Revoke(ctx, claims["jti"].(string), expiresAt.Time)
+}
+
+// authErrorStatus maps a token validation error to an HTTP status. Failing
+// to reach the blacklist is not the client's fault.
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrMissingToken), errors.Is(err, ErrTokenExpired),
+		errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenRevoked),
+		errors.Is(err, ErrInvalidAPIKey):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInsufficientScope):
+		return http.StatusForbidden
+	case errors.Is(err, ErrRevocationDisabled):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// IsPublic reports whether path can be reached without a token
+func (a *JWTAuth) IsPublic(path string) bool {
+	return matchPath(a.publicPaths, path)
+}
+
+// matchPath reports whether path is one of paths, or below one of those
+// ending in "*"
+func matchPath(paths []string, path string) bool {
+	for _, candidate := range paths {
+		if prefix, ok := strings.CutSuffix(candidate, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStream reports whether path is an event stream that can be opened with
+// a stream token
+func (a *JWTAuth) IsStream(path string) bool {
+	return matchPath(a.streamPaths, path)
+}
+
+// authentication is who a request is authenticated as
+type authentication struct {
+	userID string
+	roles  []string
+	claims jwt.MapClaims // nil for API keys
+	scopes []string      // of API keys and the stream tokens issued to them
+	scoped bool          // whether scopes limit the request
+	method string        // "jwt" or "apikey"
+}
+
+// authenticate checks the Authorization header of a request: a bearer
+// token or, with API keys enabled, an "ApiKey" key, which must grant the
+// scope of the request. Without a header, GET requests to event streams
+// are checked for a stream token in query, which must grant the scope of
+// the request when it was issued to an API key.
+func (a *JWTAuth) authenticate(ctx context.Context, method, path, header, query string) (authentication, error) {
+	if header == "" && query != "" && method == http.MethodGet && a.IsStream(path) {
+		userID, claims, err := a.ValidateStreamToken(ctx, query)
+		if err != nil {
+			return authentication{method: "jwt"}, err
+		}
+		authn := authentication{userID: userID, roles: rolesClaim(claims), claims: claims, method: "jwt"}
+		if scopes, ok := scopesClaim(claims); ok {
+			if !ScopesAllow(scopes, RequiredScope(method, path)) {
+				return authentication{method: "jwt"}, ErrInsufficientScope
+			}
+			authn.scopes, authn.scoped = scopes, true
+		}
+		return authn, nil
+	}
+
+	if key := apiKeyToken(header); key != "" && a.apiKeys != nil {
+		grant, err := a.apiKeys.ValidateAPIKey(ctx, key)
+		if err == nil && !ScopesAllow(grant.Scopes, RequiredScope(method, path)) {
+			err = ErrInsufficientScope
+		}
+		if err != nil {
+			return authentication{method: "apikey"}, err
+		}
+		return authentication{userID: grant.UserID, roles: grant.Roles, scopes: grant.Scopes, scoped: true, method: "apikey"}, nil
+	}
+
+	userID, claims, err := a.ValidateToken(ctx, bearerToken(header))
+	if err != nil {
+		return authentication{method: "jwt"}, err
+	}
+	return authentication{userID: userID, roles: rolesClaim(claims), claims: claims, method: "jwt"}, nil
+}
+
+// withAuthentication returns a context carrying the user ID and roles of
+// authn, and the scopes of its API key
+func withAuthentication(ctx context.Context, authn authentication) context.Context {
+	ctx = WithRoles(WithUserID(ctx, authn.userID), authn.roles)
+	if authn.scoped {
+		ctx = WithAPIKeyScopes(ctx, authn.scopes)
+	}
+	return ctx
+}
+
+// Fiber returns a Fiber handler that rejects requests to non-public routes
+// without a valid token or API key. The user ID and roles are stored in
+// Locals("userID") and Locals("roles") and in the user context, see
+// UserIDFromContext and RolesFromContext.
+func (a *JWTAuth) Fiber() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodOptions || a.IsPublic(c.Path()) {
+			return c.Next()
+		}
+
+		authn, err := a.authenticate(c.UserContext(), c.Method(), c.Path(), c.Get(fiber.HeaderAuthorization), c.Query(streamTokenParam))
+		a.recordAuth(authn.method, err)
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+			return c.Status(authErrorStatus(err)).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		c.Locals("userID", authn.userID)
+		c.Locals("roles", authn.roles)
+		c.Locals("authType", authn.method)
+		c.Locals("claims", authn.claims)
+		c.SetUserContext(withAuthentication(c.UserContext(), authn))
+		return c.Next()
+	}
+}
+
+// HTTP wraps a net/http handler, rejecting requests to non-public paths
+// without a valid token or API key. The user ID and roles are added to the
+// request context.
+func (a *JWTAuth) HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || a.IsPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authn, err := a.authenticate(r.Context(), r.Method, r.URL.Path, r.Header.Get("Authorization"), r.URL.Query().Get(streamTokenParam))
+		a.recordAuth(authn.method, err)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withAuthentication(r.Context(), authn)))
+	})
+}
+
+// Logout returns a Fiber handler that revokes the request's bearer token.
+// It validates the token itself, so it also works on a public route.
+func (a *JWTAuth) Logout() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := a.Revoke(c.UserContext(), bearerToken(c.Get(fiber.HeaderAuthorization))); err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+			return c.Status(authErrorStatus(err)).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// LogoutHTTP is the net/http counterpart of Logout
+func (a *JWTAuth) LogoutHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.Revoke(r.Context(), bearerToken(r.Header.Get("Authorization"))); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StreamTokenHTTP issues a stream token to the authenticated user of a POST
+// request, with their roles. Browsers open event streams with it, see
+// JWTConfig.StreamPaths. Tokens issued to API keys keep the key's scopes.
+func (a *JWTAuth) StreamTokenHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeAuthError(w, ErrMissingToken)
+		return
+	}
+	var token string
+	var err error
+	if scopes, ok := APIKeyScopesFromContext(r.Context()); ok {
+		token, err = a.IssueScopedStreamToken(userID, scopes, RolesFromContext(r.Context())...)
+	} else {
+		token, err = a.IssueStreamToken(userID, RolesFromContext(r.Context())...)
+	}
+	if err != nil {
+		http.Error(w, "Failed to issue stream token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_in": int(StreamTokenTTL.Seconds()),
+	})
+}
+
+// writeAuthError writes a JSON authentication error response
+func writeAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(authErrorStatus(err))
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// recordAuth counts a credential check of the middleware
+func (a *JWTAuth) recordAuth(method string, err error) {
+	if a.metrics != nil {
+		a.metrics.RecordAuth(method, err == nil)
+	}
+}
+
+// streamTokenParam is the query parameter of stream tokens
+const streamTokenParam = "access_token"
+
+// bearerToken returns the token of a "Bearer <token>" header value
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type userIDContextKey struct{}
+
+// WithUserID returns a context carrying the authenticated user ID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDContextKey{}, userID)
+}
+
+// UserIDFromContext returns the authenticated user ID stored by the JWT
+// middleware
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDContextKey{}).(string)
+	return userID, ok && userID != ""
+}
@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testJWTSecret = "test-secret-at-least-32-characters!!"
+
+func signToken(t *testing.T, method jwt.SigningMethod, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	return token
+}
+
+func newJWTApp(t *testing.T) *fiber.App {
+	t.Helper()
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(auth.Fiber())
+	app.Get("/health", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/api/workflows", func(c *fiber.Ctx) error {
+		userID, _ := UserIDFromContext(c.UserContext())
+		return c.SendString(userID)
+	})
+	return app
+}
+
+func getWithToken(t *testing.T, app *fiber.App, path, token string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestJWTAcceptsValidToken(t *testing.T) {
+	token := signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	status, body := getWithToken(t, newJWTApp(t), "/api/workflows", token)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "user-42", body)
+}
+
+func TestJWTRejectsExpiredToken(t *testing.T) {
+	token := signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user-42",
+		"exp":     time.Now().Add(-time.Minute).Unix(),
+	})
+
+	status, body := getWithToken(t, newJWTApp(t), "/api/workflows", token)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Contains(t, body, ErrTokenExpired.Error())
+}
+
+func TestJWTRejectsMissingToken(t *testing.T) {
+	status, body := getWithToken(t, newJWTApp(t), "/api/workflows", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Contains(t, body, ErrMissingToken.Error())
+
+	// Public routes need no token
+	status, _ = getWithToken(t, newJWTApp(t), "/health", "")
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestJWTRejectsMalformedOrForeignTokens(t *testing.T) {
+	app := newJWTApp(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	status, _ := getWithToken(t, app, "/api/workflows", "not-a-jwt")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// Signed with the wrong algorithm
+	status, _ = getWithToken(t, app, "/api/workflows", signToken(t, jwt.SigningMethodHS512, jwt.MapClaims{"sub": "u", "exp": exp}))
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// No expiry, and no user
+	status, _ = getWithToken(t, app, "/api/workflows", signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u"}))
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = getWithToken(t, app, "/api/workflows", signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{"exp": exp}))
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestJWTHTTPMiddleware(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret, PublicPaths: []string{"/api/v1/webhooks/*"}})
+	require.NoError(t, err)
+
+	handler := auth.HTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		io.WriteString(w, userID)
+	}))
+
+	token := signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-7", "exp": time.Now().Add(time.Hour).Unix()})
+	req := httptest.NewRequest("GET", "/api/workflows", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user-7", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/workflows", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/webhooks/wf/orders", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestNewJWTAuthValidatesConfig(t *testing.T) {
+	_, err := NewJWTAuth(JWTConfig{})
+	assert.Error(t, err)
+
+	_, err = NewJWTAuth(JWTConfig{Secret: testJWTSecret, Algorithm: "RS256"})
+	assert.Error(t, err)
+}
+
+func TestJWTLogoutRevokesToken(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret, Blacklist: NewMemoryTokenBlacklist()})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(auth.Fiber())
+	app.Post("/auth/logout", auth.Logout())
+	app.Get("/api/workflows", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	token, err := auth.IssueToken("user-42", time.Hour)
+	require.NoError(t, err)
+	other, err := auth.IssueToken("user-42", time.Hour)
+	require.NoError(t, err)
+
+	status, _ := getWithToken(t, app, "/api/workflows", token)
+	assert.Equal(t, fiber.StatusOK, status)
+
+	req := httptest.NewRequest("POST", "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+
+	status, body := getWithToken(t, app, "/api/workflows", token)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Contains(t, body, ErrTokenRevoked.Error())
+
+	// Other sessions of the same user stay valid
+	status, _ = getWithToken(t, app, "/api/workflows", other)
+	assert.Equal(t, fiber.StatusOK, status)
+
+	// Logging out requires a valid token even though /auth/* is public
+	resp, err = app.Test(httptest.NewRequest("POST", "/auth/logout", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestJWTBlacklistRequiresJTI(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret, Blacklist: NewMemoryTokenBlacklist()})
+	require.NoError(t, err)
+
+	token := signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u", "exp": time.Now().Add(time.Hour).Unix()})
+	_, _, err = auth.ValidateToken(context.Background(), token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Without a blacklist there is nothing to revoke against
+	auth, err = NewJWTAuth(JWTConfig{Secret: testJWTSecret})
+	require.NoError(t, err)
+	assert.ErrorIs(t, auth.Revoke(context.Background(), token), ErrRevocationDisabled)
+}
+
+func TestJWTAcceptsAccountTokens(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret, Blacklist: NewMemoryTokenBlacklist()})
+	require.NoError(t, err)
+
+	// Tokens of the lite server's logins, which must pass the blacklist
+	account := &accounts.Account{ID: 42, Email: "ada@example.com", Roles: []string{accounts.RoleEditor}}
+	token, err := accounts.AccessToken(account, true, []byte(testJWTSecret), time.Hour)
+	require.NoError(t, err)
+
+	userID, claims, err := auth.ValidateToken(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, "42", userID)
+	assert.Equal(t, []string{accounts.RoleEditor}, rolesClaim(claims))
+
+	// and can be revoked like the server's own
+	require.NoError(t, auth.Revoke(context.Background(), token))
+	_, _, err = auth.ValidateToken(context.Background(), token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestMemoryTokenBlacklistExpiresWithToken(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	blacklist := NewMemoryTokenBlacklist()
+	blacklist.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, blacklist.Revoke(ctx, "jti-1", now.Add(time.Minute)))
+	revoked, err := blacklist.IsRevoked(ctx, "jti-1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	now = now.Add(time.Minute)
+	revoked, _ = blacklist.IsRevoked(ctx, "jti-1")
+	assert.False(t, revoked)
+
+	// Revoking an already expired token keeps nothing around
+	require.NoError(t, blacklist.Revoke(ctx, "jti-2", now.Add(-time.Second)))
+	assert.Empty(t, blacklist.revoked)
+}
+
+func TestJWTAcceptsStreamTokensOnStreamsOnly(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{
+		Secret:      testJWTSecret,
+		Blacklist:   NewMemoryTokenBlacklist(),
+		StreamPaths: []string{"/api/v1/executions/*"},
+	})
+	require.NoError(t, err)
+	handler := auth.HTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		io.WriteString(w, userID+" "+strings.Join(RolesFromContext(r.Context()), ","))
+	}))
+	serve := func(method, target, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A signed in user gets a stream token with their roles
+	session, err := auth.IssueToken("user-7", time.Hour, "viewer")
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	auth.StreamTokenHTTP(rec, httptest.NewRequest("POST", "/api/v1/stream-token", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/stream-token", nil)
+	req.Header.Set("Authorization", "Bearer "+session)
+	auth.HTTP(http.HandlerFunc(auth.StreamTokenHTTP)).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var issued struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	assert.Equal(t, 60, issued.ExpiresIn)
+
+	// It opens streams from the query
+	rec = serve("GET", "/api/v1/executions/exec_1/events?access_token="+issued.Token, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user-7 viewer", rec.Body.String())
+
+	// But nothing else
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/api/workflows?access_token="+issued.Token, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("POST", "/api/v1/executions/exec_1/cancel?access_token="+issued.Token, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/api/v1/executions/exec_1", issued.Token).Code)
+
+	// And other tokens are not taken from the query
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/api/v1/executions/exec_1/events?access_token="+session, "").Code)
+
+	// Stream tokens expire quickly
+	expired := signToken(t, jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-7", "jti": "j1", "aud": "citadel-stream", "exp": time.Now().Add(-time.Second).Unix(),
+	})
+	rec = serve("GET", "/api/v1/executions/exec_1/events?access_token="+expired, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrTokenExpired.Error())
+}
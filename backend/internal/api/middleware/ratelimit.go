@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitStore counts requests per key in fixed windows
+type RateLimitStore interface {
+	// Increment counts a request for key and returns the number of requests
+	// in the current window and the time until the window resets. A new
+	// window of the given length starts with the first request after the
+	// previous one expired.
+	Increment(ctx context.Context, key string, window time.Duration) (count int, resetIn time.Duration, err error)
+}
+
+// RateLimitConfig holds rate limiting configuration
+type RateLimitConfig struct {
+	Max            int           // requests allowed per window
+	Window         time.Duration // length of a window
+	Store          RateLimitStore
+	KeyPrefix      string   // separates the quotas of differently limited routes
+	TrustedProxies []string // IPs or CIDRs whose X-Forwarded-For is believed
+	KeyFunc        func(c *fiber.Ctx) string
+}
+
+// RateLimit returns a Fiber handler that allows Max requests per Window for
+// each client, keyed by client IP unless KeyFunc is set. Requests over the
+// quota get 429 with a Retry-After header. If the store fails the request is
+// let through, so an unavailable Redis does not take the API down.
+func RateLimit(config RateLimitConfig) fiber.Handler {
+	if config.Max <= 0 {
+		config.Max = 100
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "global"
+	}
+	if config.KeyFunc == nil {
+		trusted := ParseTrustedProxies(config.TrustedProxies)
+		config.KeyFunc = func(c *fiber.Ctx) string {
+			return ClientIP(c, trusted)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		key := "ratelimit:" + config.KeyPrefix + ":" + config.KeyFunc(c)
+		count, resetIn, err := config.Store.Increment(c.UserContext(), key, config.Window)
+		if err != nil {
+			log.Printf("Rate limiter unavailable, allowing request: %v", err)
+			return c.Next()
+		}
+
+		remaining := config.Max - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		resetSeconds := int(math.Ceil(resetIn.Seconds()))
+		c.Set("X-RateLimit-Limit", strconv.Itoa(config.Max))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Set("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+
+		if count > config.Max {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(resetSeconds))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "Rate limit exceeded",
+				"retry_after": resetSeconds,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// TrustedProxies is a parsed list of trusted proxy addresses
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses IPs and CIDRs, skipping invalid entries
+func ParseTrustedProxies(proxies []string) TrustedProxies {
+	var trusted TrustedProxies
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			} else {
+				log.Printf("Ignoring invalid trusted proxy: %s", proxy)
+			}
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(proxy); err == nil {
+			trusted = append(trusted, ipNet)
+		} else {
+			log.Printf("Ignoring invalid trusted proxy: %s", proxy)
+		}
+	}
+	return trusted
+}
+
+// Contains reports whether ip belongs to a trusted proxy
+func (t TrustedProxies) Contains(ip net.IP) bool {
+	for _, ipNet := range t {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent the request. The
+// X-Forwarded-For header is only believed when the connection comes from a
+// trusted proxy; it is then read from the right, skipping further trusted
+// proxies, so a client cannot choose its address by sending the header
+// itself.
+func ClientIP(c *fiber.Ctx, trusted TrustedProxies) string {
+	remote := c.Context().RemoteIP()
+	if len(trusted) == 0 || !trusted.Contains(remote) {
+		return remote.String()
+	}
+
+	hops := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	client := remote.String()
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// MemoryRateLimitStore keeps request counts in process memory. Limits are
+// not shared between instances; use RedisRateLimitStore for that.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type rateWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		windows: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// Increment implements RateLimitStore
+func (s *MemoryRateLimitStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	// Drop expired windows now and then so idle clients don't accumulate
+	if now.Sub(s.lastSweep) >= window {
+		for k, w := range s.windows {
+			if !now.Before(w.resetAt) {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.resetAt.Sub(now), nil
+}
+
+// incrementScript increments a counter and starts its window on the first
+// request. The expiry is also set when missing, e.g. after a failover.
+var incrementScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if count == 1 or ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// RedisRateLimitStore keeps request counts in Redis so that all instances
+// share the same limits
+type RedisRateLimitStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisRateLimitStore creates a Redis-backed rate limit store
+func NewRedisRateLimitStore(client redis.UniversalClient) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+// Increment implements RateLimitStore
+func (s *RedisRateLimitStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	result, err := incrementScript.Run(ctx, s.client, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(result) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+	return int(result[0]), time.Duration(result[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitedApp(config RateLimitConfig) *fiber.App {
+	app := fiber.New()
+	app.Use(RateLimit(config))
+	app.Get("/ping", func(c *fiber.Ctx) error { return c.SendString("pong") })
+	return app
+}
+
+func TestRateLimitRejectsRequestsOverQuota(t *testing.T) {
+	app := newRateLimitedApp(RateLimitConfig{Max: 2, Window: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/ping", nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/ping", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get(fiber.HeaderRetryAfter))
+	assert.Equal(t, "0", resp.Header.Get("X-RateLimit-Remaining"))
+}
+
+func TestRateLimitKeysByForwardedClientFromTrustedProxy(t *testing.T) {
+	// Test requests come from 0.0.0.0, which plays the proxy here
+	app := newRateLimitedApp(RateLimitConfig{Max: 1, Window: time.Minute, TrustedProxies: []string{"0.0.0.0"}})
+
+	request := func(forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusOK, request("203.0.113.1"))
+	assert.Equal(t, fiber.StatusOK, request("203.0.113.2"))
+	assert.Equal(t, fiber.StatusTooManyRequests, request("203.0.113.1"))
+
+	// A spoofed leftmost entry does not change the client the proxy saw
+	assert.Equal(t, fiber.StatusTooManyRequests, request("198.51.100.7, 203.0.113.2"))
+}
+
+func TestRateLimitIgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	app := newRateLimitedApp(RateLimitConfig{Max: 1, Window: time.Minute, TrustedProxies: []string{"10.0.0.0/8"}})
+
+	for i, want := range []int{fiber.StatusOK, fiber.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, net.IPv4(203, 0, 113, byte(i)).String())
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode)
+	}
+}
+
+func TestRateLimitQuotasAreSeparatePerPrefix(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	app := fiber.New()
+	app.Use(RateLimit(RateLimitConfig{Max: 10, Window: time.Minute, Store: store}))
+	app.Use("/auth", RateLimit(RateLimitConfig{Max: 1, Window: time.Minute, Store: store, KeyPrefix: "auth"}))
+	app.Post("/auth/login", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+	app.Get("/ping", func(c *fiber.Ctx) error { return c.SendString("pong") })
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/auth/login", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/auth/login", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/ping", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestMemoryRateLimitStoreStartsNewWindow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	count, resetIn, err := store.Increment(context.Background(), "k", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, time.Minute, resetIn)
+
+	now = now.Add(45 * time.Second)
+	count, resetIn, _ = store.Increment(context.Background(), "k", time.Minute)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 15*time.Second, resetIn)
+
+	now = now.Add(15 * time.Second)
+	count, _, _ = store.Increment(context.Background(), "k", time.Minute)
+	assert.Equal(t, 1, count)
+}
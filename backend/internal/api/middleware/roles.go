@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type rolesContextKey struct{}
+
+// WithRoles returns a context carrying the roles of the authenticated user
+func WithRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, rolesContextKey{}, roles)
+}
+
+// RolesFromContext returns the roles stored by the JWT middleware: those of
+// the token's "roles" claim, or the current roles of an API key's owner
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(rolesContextKey{}).([]string)
+	return roles
+}
+
+// HasRole reports whether the authenticated user has role or a role above
+// it, see accounts.HasRole
+func HasRole(ctx context.Context, role string) bool {
+	return accounts.HasRole(RolesFromContext(ctx), role)
+}
+
+// RequireRole wraps a handler that needs role, rejecting other requests
+// with 403. It must run after JWTAuth.HTTP.
+func RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(r.Context(), role) {
+			writeRoleError(w, role)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRoleByMethod wraps a handler that needs read for GET and HEAD
+// requests and write for the others
+func RequireRoleByMethod(read, write string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			role = read
+		}
+		if !HasRole(r.Context(), role) {
+			writeRoleError(w, role)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeRoleError writes the JSON 403 response of a missing role
+func writeRoleError(w http.ResponseWriter, role string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": "this requires the " + role + " role",
+		"role":  role,
+	})
+}
+
+// rolesClaim returns the roles of a token's "roles" claim
+func rolesClaim(claims jwt.MapClaims) []string {
+	values, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(values))
+	for _, value := range values {
+		if role, ok := value.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// scopesClaim returns the "scopes" claim of the stream tokens issued to API
+// keys, and false for tokens without one
+func scopesClaim(claims jwt.MapClaims) ([]string, bool) {
+	values, ok := claims["scopes"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	scopes := make([]string, 0, len(values))
+	for _, value := range values {
+		if scope, ok := value.(string); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret, APIKeys: staticAPIKeys{"cta_deploy": {"*"}}})
+	require.NoError(t, err)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(RolesFromContext(r.Context()), ",")))
+	})
+	admin := auth.HTTP(RequireRole("admin", ok))
+	editor := auth.HTTP(RequireRole("editor", ok))
+
+	serve := func(handler http.Handler, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/plugins", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(roles ...string) string {
+		token, err := auth.IssueToken("user-1", time.Hour, roles...)
+		require.NoError(t, err)
+		return "Bearer " + token
+	}
+
+	rec := serve(admin, bearer("admin"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "admin", rec.Body.String())
+	assert.Equal(t, http.StatusOK, serve(editor, bearer("admin")).Code, "admins can do what editors can")
+
+	rec = serve(admin, bearer("viewer", "editor"))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.JSONEq(t, `{"error":"this requires the admin role","role":"admin"}`, rec.Body.String())
+	assert.Equal(t, http.StatusForbidden, serve(admin, bearer()).Code)
+
+	// API keys have the roles of their owner
+	assert.Equal(t, http.StatusOK, serve(editor, "ApiKey cta_deploy").Code)
+	assert.Equal(t, http.StatusForbidden, serve(admin, "ApiKey cta_deploy").Code)
+
+	// Without authentication nothing is allowed
+	rec = httptest.NewRecorder()
+	RequireRole("viewer", ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/workflows", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestFiberStoresRoles(t *testing.T) {
+	auth, err := NewJWTAuth(JWTConfig{Secret: testJWTSecret})
+	require.NoError(t, err)
+	app := fiber.New()
+	app.Use(auth.Fiber())
+	app.Get("/api/workflows", func(c *fiber.Ctx) error {
+		if !HasRole(c.UserContext(), "viewer") {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.JSON(c.Locals("roles"))
+	})
+
+	token, err := auth.IssueToken("user-1", time.Hour, "editor")
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/api/workflows", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -3,205 +3,181 @@ package auth
 import (
 	"context"
 	"crypto/rand"
-	"crypto/subtle"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
-	"gorm.io/gorm"
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/google/uuid"
 )
 
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognise
+const APIKeyPrefix = "cta_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear to tell keys
+// apart in listings
+const apiKeyDisplayLength = 12
+
 var (
 	ErrAPIKeyNotFound = errors.New("API key not found")
-	ErrAPIKeyExpired  = errors.New("API key expired")
-	ErrAPIKeyInvalid  = errors.New("invalid API key")
+	ErrAPIKeyName     = errors.New("API key name is required")
+	ErrAPIKeyScopes   = errors.New("invalid API key scopes")
 )
 
-// APIKeyService handles API key operations
-type APIKeyService struct {
-	db *gorm.DB
+// ErrAPIKeyInvalid is returned for unknown, revoked and expired keys. It is
+// the middleware's error, which answers 401 for it.
+var ErrAPIKeyInvalid = middleware.ErrInvalidAPIKey
+
+// APIKey describes an issued key. The key itself is only returned once, by
+// Issue; stores keep its SHA-256 hash.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
-// NewAPIKeyService creates a new API key service
-func NewAPIKeyService(db *gorm.DB) *APIKeyService {
-	return &APIKeyService{db: db}
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
 }
 
-// ValidateAPIKey validates an API key and returns the associated user ID
-func (s *APIKeyService) ValidateAPIKey(key string) (string, error) {
-	var apiKey struct {
-		ID        string
-		UserID    string
-		Key       string
-		ExpiresAt *time.Time
-		DeletedAt *time.Time
-	}
-
-	err := s.db.Table("api_keys").
-		Select("id, user_id, key, expires_at, deleted_at").
-		Where("key = ?", key).
-		Where("deleted_at IS NULL").
-		First(&apiKey).Error
-
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", ErrAPIKeyNotFound
-		}
-		return "", err
-	}
-
-	// Check if expired
-	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
-		return "", ErrAPIKeyExpired
-	}
-
-	// Constant-time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) != 1 {
-		return "", ErrAPIKeyInvalid
-	}
-
-	// Update last used timestamp asynchronously with proper error handling
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		err := s.db.WithContext(ctx).Exec(
-			"UPDATE api_keys SET last_used_at = ? WHERE id = ?",
-			time.Now(), apiKey.ID,
-		).Error
+// APIKeyStore persists API keys by the hash of their secret
+type APIKeyStore interface {
+	Create(ctx context.Context, key *APIKey, hash string) error
+	// FindByHash returns ErrAPIKeyNotFound for unknown hashes
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	// List returns the keys of a user, newest first
+	List(ctx context.Context, userID string) ([]*APIKey, error)
+	// Revoke returns ErrAPIKeyNotFound unless the user has an unrevoked key
+	// with that ID
+	Revoke(ctx context.Context, userID, id string, at time.Time) error
+	Touch(ctx context.Context, id string, at time.Time) error
+}
 
-		if err != nil {
-			// Log error but don't fail the authentication
-			// In production, use proper logger
-			log.Printf("Failed to update API key last_used_at: %v", err)
-		}
-	}()
+// RoleLookup returns the current roles of a user, or accounts.ErrNotFound
+// for users that no longer exist. accounts.Authenticator implements it.
+type RoleLookup interface {
+	Roles(ctx context.Context, userID string) ([]string, error)
+}
 
-	return apiKey.UserID, nil
+// APIKeyService issues, checks and revokes API keys
+type APIKeyService struct {
+	store APIKeyStore
+	roles RoleLookup
+	now   func() time.Time
 }
 
-// GetAPIKeyPermissions returns the permissions associated with an API key
-func (s *APIKeyService) GetAPIKeyPermissions(key string) ([]string, error) {
-	var permissions []string
-	err := s.db.Table("api_keys").
-		Select("permissions").
-		Where("key = ?", key).
-		Where("deleted_at IS NULL").
-		Pluck("permissions", &permissions).Error
+// NewAPIKeyService creates an API key service on store. Requests made with
+// a key have the roles roles returns for its owner at the time, so keys
+// follow their owner's role changes.
+func NewAPIKeyService(store APIKeyStore, roles RoleLookup) *APIKeyService {
+	return &APIKeyService{store: store, roles: roles, now: time.Now}
+}
 
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrAPIKeyNotFound
+// Issue creates a key for userID granting scopes, e.g. "workflows:read",
+// that expires after ttl, or never when ttl is 0. The returned key is not
+// stored and cannot be shown again.
+func (s *APIKeyService) Issue(ctx context.Context, userID, name string, scopes []string, ttl time.Duration) (string, *APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrAPIKeyName
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one is required", ErrAPIKeyScopes)
+	}
+	for _, scope := range scopes {
+		if !middleware.ValidScope(scope) {
+			return "", nil, fmt.Errorf("%w: %q, want <resource>:read, <resource>:write, <resource>:* or *", ErrAPIKeyScopes, scope)
 		}
-		return nil, err
 	}
 
-	return permissions, nil
-}
-
-// HasAPIKeyPermission checks if an API key has a specific permission
-func (s *APIKeyService) HasAPIKeyPermission(key string, permission string) (bool, error) {
-	permissions, err := s.GetAPIKeyPermissions(key)
+	secret, err := generateAPIKey()
 	if err != nil {
-		return false, err
+		return "", nil, fmt.Errorf("generating API key: %w", err)
 	}
-
-	// Check for admin permission
-	if contains(permissions, "admin:*") {
-		return true, nil
+	now := s.now().UTC()
+	key := &APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:apiKeyDisplayLength],
+		Scopes:    append([]string(nil), scopes...),
+		CreatedAt: now,
 	}
-
-	// Check for specific permission
-	return contains(permissions, permission), nil
-}
-
-// RevokeAPIKey revokes an API key (soft delete)
-func (s *APIKeyService) RevokeAPIKey(keyID string, userID string) error {
-	return s.db.Exec(
-		"UPDATE api_keys SET deleted_at = ? WHERE id = ? AND user_id = ?",
-		time.Now(), keyID, userID,
-	).Error
-}
-
-// ListUserAPIKeys lists all API keys for a user
-func (s *APIKeyService) ListUserAPIKeys(userID string) ([]map[string]interface{}, error) {
-	var keys []map[string]interface{}
-	err := s.db.Table("api_keys").
-		Select("id, name, key_prefix, permissions, expires_at, last_used_at, created_at").
-		Where("user_id = ?", userID).
-		Where("deleted_at IS NULL").
-		Find(&keys).Error
-
-	return keys, err
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.store.Create(ctx, key, hashAPIKey(secret)); err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
 }
 
-// RotateAPIKey rotates an API key (creates new key, revokes old one)
-func (s *APIKeyService) RotateAPIKey(keyID string, userID string) (string, error) {
-	// Get old key details
-	var oldKey struct {
-		Name        string
-		Permissions []string
-		ExpiresAt   *time.Time
+// ValidateAPIKey returns the owner, scopes and the owner's current roles of
+// an active key, and records that it was used. Keys of users that no longer
+// exist are invalid. It implements middleware.APIKeyValidator.
+func (s *APIKeyService) ValidateAPIKey(ctx context.Context, secret string) (*middleware.APIKeyGrant, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
 	}
-
-	err := s.db.Table("api_keys").
-		Select("name, permissions, expires_at").
-		Where("id = ?", keyID).
-		Where("user_id = ?", userID).
-		Where("deleted_at IS NULL").
-		First(&oldKey).Error
-
-	if err != nil {
-		return "", err
+	key, err := s.store.FindByHash(ctx, hashAPIKey(secret))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrAPIKeyInvalid
 	}
-
-	// Generate new API key
-	newKey, err := generateAPIKey()
 	if err != nil {
-		return "", fmt.Errorf("failed to generate new API key: %w", err)
+		return nil, err
 	}
-
-	// Generate key prefix for display (first 8 characters)
-	keyPrefix := newKey[:8]
-
-	// Create new key with same details
-	newKeyData := map[string]interface{}{
-		"user_id":     userID,
-		"key":         newKey,
-		"key_prefix":  keyPrefix,
-		"name":        oldKey.Name + " (rotated)",
-		"permissions": oldKey.Permissions,
-		"expires_at":  oldKey.ExpiresAt,
-		"created_at":  time.Now(),
+	now := s.now().UTC()
+	if !key.Active(now) {
+		return nil, ErrAPIKeyInvalid
 	}
-
-	// Insert new key
-	if err := s.db.Table("api_keys").Create(newKeyData).Error; err != nil {
-		return "", fmt.Errorf("failed to create new API key: %w", err)
+	roles, err := s.roles.Roles(ctx, key.UserID)
+	if errors.Is(err, accounts.ErrNotFound) {
+		return nil, ErrAPIKeyInvalid
 	}
-
-	// Revoke old key
-	err = s.RevokeAPIKey(keyID, userID)
 	if err != nil {
-		// Log error but still return new key
-		log.Printf("Warning: failed to revoke old API key %s: %v", keyID, err)
+		return nil, fmt.Errorf("looking up API key roles: %w", err)
 	}
+	if err := s.store.Touch(ctx, key.ID, now); err != nil {
+		return nil, fmt.Errorf("recording API key use: %w", err)
+	}
+	return &middleware.APIKeyGrant{UserID: key.UserID, Scopes: key.Scopes, Roles: roles}, nil
+}
+
+// List returns the keys of a user, without their secrets
+func (s *APIKeyService) List(ctx context.Context, userID string) ([]*APIKey, error) {
+	return s.store.List(ctx, userID)
+}
 
-	return newKey, nil
+// Revoke disables one of a user's keys for good
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id string) error {
+	return s.store.Revoke(ctx, userID, id, s.now().UTC())
 }
 
-// generateAPIKey generates a cryptographically secure API key
+// generateAPIKey returns APIKeyPrefix followed by 32 random bytes
 func generateAPIKey() (string, error) {
-	// Generate 32 random bytes
 	b := make([]byte, 32)
-	_, err := rand.Read(b)
-	if err != nil {
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	// Encode as base64 and add prefix
-	key := "cta_" + base64.URLEncoding.EncodeToString(b)
-	return key, nil
+// hashAPIKey is the hex SHA-256 of a key. Keys are random enough that a
+// fast unsalted hash is safe, and it lets keys be looked up by hash.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/jackc/pgx/v5"
+)
+
+// MemoryAPIKeyStore keeps API keys in process memory. They are lost on
+// restart; use PostgresAPIKeyStore to keep them.
+type MemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]*APIKey
+	hashes map[string]string // hash -> key ID
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[string]*APIKey), hashes: make(map[string]string)}
+}
+
+// Create implements APIKeyStore
+func (s *MemoryAPIKeyStore) Create(ctx context.Context, key *APIKey, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *key
+	s.keys[key.ID] = &stored
+	s.hashes[hash] = key.ID
+	return nil
+}
+
+// FindByHash implements APIKeyStore
+func (s *MemoryAPIKeyStore) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.hashes[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	key := *s.keys[id]
+	return &key, nil
+}
+
+// List implements APIKeyStore
+func (s *MemoryAPIKeyStore) List(ctx context.Context, userID string) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*APIKey
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// Revoke implements APIKeyStore
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, userID, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return ErrAPIKeyNotFound
+	}
+	key.RevokedAt = &at
+	return nil
+}
+
+// Touch implements APIKeyStore
+func (s *MemoryAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; ok {
+		key.LastUsedAt = &at
+	}
+	return nil
+}
+
+// PostgresAPIKeyStore keeps API keys in the api_keys table
+type PostgresAPIKeyStore struct {
+	pool engine.PostgresPool
+}
+
+// NewPostgresAPIKeyStore creates an API key store on pool
+func NewPostgresAPIKeyStore(pool engine.PostgresPool) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{pool: pool}
+}
+
+const apiKeyColumns = `id, user_id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+// scanAPIKey reads a row of apiKeyColumns
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	key := &APIKey{}
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes,
+		&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Create implements APIKeyStore
+func (s *PostgresAPIKeyStore) Create(ctx context.Context, key *APIKey, hash string) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO api_keys (id, user_id, name, key_prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.ID, key.UserID, key.Name, key.Prefix, hash, key.Scopes, key.ExpiresAt, key.CreatedAt,
+	)
+	return err
+}
+
+// FindByHash implements APIKeyStore
+func (s *PostgresAPIKeyStore) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	key, err := scanAPIKey(s.pool.QueryRow(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`,
+		hash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// List implements APIKeyStore
+func (s *PostgresAPIKeyStore) List(ctx context.Context, userID string) ([]*APIKey, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE user_id = $1 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke implements APIKeyStore
+func (s *PostgresAPIKeyStore) Revoke(ctx context.Context, userID, id string, at time.Time) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID, at,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Touch implements APIKeyStore
+func (s *PostgresAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := s.pool.Exec(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, at)
+	return err
+}
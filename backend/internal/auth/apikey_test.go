@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/pkg/accounts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// userRoles is a RoleLookup of the roles of each user ID
+type userRoles map[string][]string
+
+func (u userRoles) Roles(ctx context.Context, userID string) ([]string, error) {
+	roles, ok := u[userID]
+	if !ok {
+		return nil, accounts.ErrNotFound
+	}
+	return roles, nil
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	service := NewAPIKeyService(store, userRoles{"alice": {accounts.RoleEditor}})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	secret, key, err := service.Issue(ctx, "alice", "ci deploys", []string{"workflows:write"}, 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	assert.Nil(t, key.ExpiresAt)
+
+	// Only the hash is kept
+	_, err = store.FindByHash(ctx, secret)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	_, err = store.FindByHash(ctx, hashAPIKey(secret))
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	grant, err := service.ValidateAPIKey(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, &middleware.APIKeyGrant{UserID: "alice", Scopes: []string{"workflows:write"}, Roles: []string{accounts.RoleEditor}}, grant)
+	keys, err := service.List(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+	assert.Equal(t, now, *keys[0].LastUsedAt)
+
+	_, err = service.ValidateAPIKey(ctx, secret+"x")
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+	_, err = service.ValidateAPIKey(ctx, "not-a-key")
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+
+	assert.ErrorIs(t, service.Revoke(ctx, "bob", key.ID), ErrAPIKeyNotFound, "keys are revoked by their owner only")
+	require.NoError(t, service.Revoke(ctx, "alice", key.ID))
+	_, err = service.ValidateAPIKey(ctx, secret)
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+	assert.ErrorIs(t, service.Revoke(ctx, "alice", key.ID), ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	ctx := context.Background()
+	service := NewAPIKeyService(NewMemoryAPIKeyStore(), userRoles{"alice": {accounts.RoleEditor}})
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	secret, _, err := service.Issue(ctx, "alice", "short-lived", []string{"*"}, time.Hour)
+	require.NoError(t, err)
+	_, err = service.ValidateAPIKey(ctx, secret)
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	_, err = service.ValidateAPIKey(ctx, secret)
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+}
+
+func TestAPIKeysFollowOwnerRoles(t *testing.T) {
+	ctx := context.Background()
+	roles := userRoles{"alice": {accounts.RoleAdmin}}
+	service := NewAPIKeyService(NewMemoryAPIKeyStore(), roles)
+	secret, _, err := service.Issue(ctx, "alice", "ci", []string{"*"}, 0)
+	require.NoError(t, err)
+
+	grant, err := service.ValidateAPIKey(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, []string{accounts.RoleAdmin}, grant.Roles)
+
+	// Demoted owners' keys lose their rights too
+	roles["alice"] = []string{accounts.RoleViewer}
+	grant, err = service.ValidateAPIKey(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, []string{accounts.RoleViewer}, grant.Roles)
+
+	delete(roles, "alice")
+	_, err = service.ValidateAPIKey(ctx, secret)
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+}
+
+func TestAPIKeyIssueValidatesRequest(t *testing.T) {
+	service := NewAPIKeyService(NewMemoryAPIKeyStore(), userRoles{"alice": {accounts.RoleEditor}})
+	_, _, err := service.Issue(context.Background(), "alice", " ", []string{"*"}, 0)
+	assert.ErrorIs(t, err, ErrAPIKeyName)
+	_, _, err = service.Issue(context.Background(), "alice", "ci", nil, 0)
+	assert.ErrorIs(t, err, ErrAPIKeyScopes)
+	_, _, err = service.Issue(context.Background(), "alice", "ci", []string{"workflows:delete"}, 0)
+	assert.ErrorIs(t, err, ErrAPIKeyScopes)
+}
+
+func TestAPIKeysThroughMiddleware(t *testing.T) {
+	ctx := context.Background()
+	service := NewAPIKeyService(NewMemoryAPIKeyStore(), userRoles{"alice": {accounts.RoleEditor}})
+	jwtAuth, err := middleware.NewJWTAuth(middleware.JWTConfig{Secret: strings.Repeat("s", 32), APIKeys: service})
+	require.NoError(t, err)
+	handler := jwtAuth.HTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method, path, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "ApiKey "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	reader, _, err := service.Issue(ctx, "alice", "dashboard", []string{"workflows:read"}, 0)
+	require.NoError(t, err)
+	deployer, deployKey, err := service.Issue(ctx, "alice", "ci", []string{"workflows:*"}, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/workflows", reader))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/workflows", reader))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/workflows", deployer))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/v1/credentials", deployer))
+
+	require.NoError(t, service.Revoke(ctx, "alice", deployKey.ID))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/api/workflows", deployer))
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"citadel-agent/backend/pkg/database"
 	"github.com/spf13/viper"
 )
 
@@ -15,6 +22,11 @@ type Config struct {
 	AppDebug    bool   `mapstructure:"app_debug"`
 	AppTimezone string `mapstructure:"app_timezone"`
 
+	// TLS; the certificate and key files must exist when enabled
+	SSLEnabled  bool   `mapstructure:"ssl_enabled"`
+	SSLCertFile string `mapstructure:"ssl_cert_file"`
+	SSLKeyFile  string `mapstructure:"ssl_key_file"`
+
 	// Database
 	DBHost     string `mapstructure:"db_host"`
 	DBPort     int    `mapstructure:"db_port"`
@@ -23,6 +35,23 @@ type Config struct {
 	DBName     string `mapstructure:"db_name"`
 	DBSSLMode  string `mapstructure:"db_ssl_mode"`
 
+	// Connection pool; db_query_timeout bounds each query
+	DBMaxOpenConns    int           `mapstructure:"db_max_open_conns"`
+	DBMaxIdleConns    int           `mapstructure:"db_max_idle_conns"`
+	DBConnMaxLifetime time.Duration `mapstructure:"db_conn_max_lifetime"`
+	DBQueryTimeout    time.Duration `mapstructure:"db_query_timeout"`
+
+	// Storage of workflows and executions: "memory" or "postgres"
+	StorageDriver string `mapstructure:"storage_driver"`
+	// DatabaseURL overrides the individual DB settings when set
+	DatabaseURL string `mapstructure:"database_url"`
+	// Compress and/or encrypt the trigger inputs and node outputs postgres
+	// storage keeps, like workflow.persistence of the engine configuration;
+	// encryption needs a key of at least 32 characters
+	PersistenceCompression   bool   `mapstructure:"workflow_persistence_compression"`
+	PersistenceEncryption    bool   `mapstructure:"workflow_persistence_encryption"`
+	PersistenceEncryptionKey string `mapstructure:"workflow_persistence_encryption_key"`
+
 	// Redis
 	RedisHost     string `mapstructure:"redis_host"`
 	RedisPort     int    `mapstructure:"redis_port"`
@@ -34,6 +63,12 @@ type Config struct {
 	JWTExpiresIn        time.Duration `mapstructure:"jwt_expires_in"`
 	JWTRefreshSecret    string        `mapstructure:"jwt_refresh_secret"`
 	JWTRefreshExpiresIn time.Duration `mapstructure:"jwt_refresh_expires_in"`
+	JWTAlgorithm        string        `mapstructure:"jwt_algorithm"`
+	// Keep revoked tokens in Redis so /auth/logout invalidates them
+	JWTBlacklistEnabled bool `mapstructure:"jwt_blacklist_enabled"`
+	// Comma-separated routes reachable without a token; a trailing "*"
+	// matches a prefix
+	AuthPublicPaths string `mapstructure:"auth_public_paths"`
 
 	// Temporal
 	TemporalAddress   string `mapstructure:"temporal_address"`
@@ -42,14 +77,27 @@ type Config struct {
 	// Security
 	SecureCookies      bool   `mapstructure:"secure_cookies"`
 	CORSAllowedOrigins string `mapstructure:"cors_allowed_origins"`
+	RateLimitEnabled   bool   `mapstructure:"rate_limit_enabled"`
 	RateLimitRequests  int    `mapstructure:"rate_limit_requests"`
-	RateLimitWindow    int    `mapstructure:"rate_limit_window"`
+	RateLimitWindow    int    `mapstructure:"rate_limit_window"` // seconds
+	// Let allowed origins send cookies and Authorization headers
+	CORSAllowCredentials bool `mapstructure:"cors_allow_credentials"`
+	// Requests per window allowed on authentication endpoints
+	AuthRateLimitRequests int `mapstructure:"auth_rate_limit_requests"`
+	// Where request counts are kept: "memory" or "redis" (shared by instances)
+	RateLimitStore string `mapstructure:"rate_limit_store"`
+	// Comma-separated IPs or CIDRs of proxies whose X-Forwarded-For is trusted
+	TrustedProxies string `mapstructure:"trusted_proxies"`
+	// How long an Idempotency-Key is remembered
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
 
 	// AI Models
 	AILlamaModelPath   string `mapstructure:"ai_llama_model_path"`
 	AIMistralModelPath string `mapstructure:"ai_mistral_model_path"`
 	AIClipModelPath    string `mapstructure:"ai_clip_model_path"`
 	AIWhisperModelPath string `mapstructure:"ai_whisper_model_path"`
+	// Tokens each user may spend on AI model requests; 0 is unlimited
+	AITokenBudget int64 `mapstructure:"ai_token_budget"`
 
 	// File Uploads
 	MaxUploadSize    string `mapstructure:"max_upload_size"`
@@ -61,6 +109,13 @@ type Config struct {
 	GrafanaEnabled    bool   `mapstructure:"grafana_enabled"`
 	LogLevel          string `mapstructure:"log_level"`
 	LokiURL           string `mapstructure:"loki_url"`
+	// Path Prometheus metrics are served on when prometheus_enabled
+	MetricsEndpoint string `mapstructure:"metrics_endpoint"`
+	// pprof profiles, never served in production unless
+	// allow_profiling_in_production is set
+	ProfilingEnabled           bool   `mapstructure:"profiling_enabled"`
+	ProfilingEndpoint          string `mapstructure:"profiling_endpoint"`
+	AllowProfilingInProduction bool   `mapstructure:"allow_profiling_in_production"`
 
 	// Workflow Engine
 	MaxConcurrentExecutions int           `mapstructure:"max_concurrent_executions"`
@@ -71,15 +126,28 @@ type Config struct {
 	EnableProfiling         bool          `mapstructure:"enable_profiling"`
 	EnableCaching           bool          `mapstructure:"enable_caching"`
 	CacheTTL                time.Duration `mapstructure:"cache_ttl"`
+	// Stop calling an external host or AI provider for
+	// circuit_breaker_reset_timeout once circuit_breaker_threshold calls
+	// in a row have failed
+	CircuitBreakerEnabled      bool          `mapstructure:"circuit_breaker_enabled"`
+	CircuitBreakerThreshold    int           `mapstructure:"circuit_breaker_threshold"`
+	CircuitBreakerResetTimeout time.Duration `mapstructure:"circuit_breaker_reset_timeout"`
 }
 
-// LoadConfig loads the application configuration
-func LoadConfig() (*Config, error) {
-	viper.SetConfigName("app")
-	viper.SetConfigType("env")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./configs")
-	viper.AddConfigPath("./config")
+// LoadConfig loads the application configuration from configPath, or from
+// app.env in the working directory, ./configs or ./config when it is empty,
+// overridden by CITADEL_* environment variables. The result is not
+// validated; call Validate before using it.
+func LoadConfig(configPath string) (*Config, error) {
+	if configPath != "" {
+		viper.SetConfigFile(configPath)
+	} else {
+		viper.SetConfigName("app")
+		viper.SetConfigType("env")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("./configs")
+		viper.AddConfigPath("./config")
+	}
 
 	// Set default values
 	viper.SetDefault("app_name", "Citadel Agent")
@@ -88,12 +156,26 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("app_debug", true)
 	viper.SetDefault("app_timezone", "UTC")
 
+	viper.SetDefault("ssl_enabled", false)
+	viper.SetDefault("ssl_cert_file", "")
+	viper.SetDefault("ssl_key_file", "")
+
 	viper.SetDefault("db_host", "localhost")
 	viper.SetDefault("db_port", 5432)
 	viper.SetDefault("db_user", "postgres")
 	viper.SetDefault("db_password", "")
 	viper.SetDefault("db_name", "citadel_agent")
 	viper.SetDefault("db_ssl_mode", "disable")
+	viper.SetDefault("db_max_open_conns", 25)
+	viper.SetDefault("db_max_idle_conns", 5)
+	viper.SetDefault("db_conn_max_lifetime", "5m")
+	viper.SetDefault("db_query_timeout", "30s")
+
+	viper.SetDefault("storage_driver", "memory")
+	viper.SetDefault("database_url", "")
+	viper.SetDefault("workflow_persistence_compression", false)
+	viper.SetDefault("workflow_persistence_encryption", false)
+	viper.SetDefault("workflow_persistence_encryption_key", "")
 
 	viper.SetDefault("redis_host", "localhost")
 	viper.SetDefault("redis_port", 6379)
@@ -105,14 +187,25 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("jwt_expires_in", "24h")
 	viper.SetDefault("jwt_refresh_secret", "")
 	viper.SetDefault("jwt_refresh_expires_in", "720h")
+	viper.SetDefault("jwt_algorithm", "HS256")
+	viper.SetDefault("jwt_blacklist_enabled", true)
+	viper.SetDefault("auth_public_paths", "/,/health,/auth/*,/api/v1/auth/*")
 
 	viper.SetDefault("temporal_address", "localhost:7233")
 	viper.SetDefault("temporal_namespace", "default")
 
 	viper.SetDefault("secure_cookies", false)
 	viper.SetDefault("cors_allowed_origins", "*")
+	viper.SetDefault("cors_allow_credentials", false)
+	viper.SetDefault("rate_limit_enabled", true)
 	viper.SetDefault("rate_limit_requests", 100)
 	viper.SetDefault("rate_limit_window", 60)
+	viper.SetDefault("auth_rate_limit_requests", 10)
+	viper.SetDefault("rate_limit_store", "memory")
+	viper.SetDefault("trusted_proxies", "127.0.0.1,::1")
+	viper.SetDefault("idempotency_ttl", "24h")
+
+	viper.SetDefault("ai_token_budget", 0)
 
 	viper.SetDefault("max_upload_size", "10MB") // Reduced from 100MB
 	viper.SetDefault("allowed_file_types", "json,csv,txt,pdf,doc,docx,xlsx")
@@ -122,6 +215,10 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("grafana_enabled", true)
 	viper.SetDefault("log_level", "info")
 	viper.SetDefault("loki_url", "")
+	viper.SetDefault("metrics_endpoint", "/metrics")
+	viper.SetDefault("profiling_enabled", false)
+	viper.SetDefault("profiling_endpoint", "/debug/pprof")
+	viper.SetDefault("allow_profiling_in_production", false)
 
 	viper.SetDefault("max_concurrent_executions", 100)
 	viper.SetDefault("max_concurrent_nodes", 50)
@@ -131,14 +228,20 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("enable_profiling", false)
 	viper.SetDefault("enable_caching", true)
 	viper.SetDefault("cache_ttl", "1h")
+	viper.SetDefault("circuit_breaker_enabled", true)
+	viper.SetDefault("circuit_breaker_threshold", 5)
+	viper.SetDefault("circuit_breaker_reset_timeout", "60s")
 
 	// Set environment variable prefix
 	viper.SetEnvPrefix("CITADEL")
 	viper.AutomaticEnv()
 
-	// Read config file
+	// Read config file. Without an explicit path a missing file is fine.
 	if err := viper.ReadInConfig(); err != nil {
-		// Config file not found, that's ok
+		var notFound viper.ConfigFileNotFoundError
+		if configPath != "" || !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
 	}
 
 	var config Config
@@ -146,25 +249,138 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
-	// Validate critical configuration
-	if err := validateConfig(&config); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
-	}
-
 	return &config, nil
 }
 
-// validateConfig validates critical configuration values
-func validateConfig(cfg *Config) error {
-	// Validate JWT secrets in production
-	if cfg.AppEnv == "production" {
-		if cfg.JWTSecret == "" || len(cfg.JWTSecret) < 32 {
-			return fmt.Errorf("jwt_secret must be set and at least 32 characters in production")
+// Validate checks the configuration and reports every problem found, one
+// per line, rather than stopping at the first
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.AppPort); err != nil || port < 1 || port > 65535 {
+		fail("app_port must be a port between 1 and 65535, got %q", c.AppPort)
+	}
+
+	// JWT secrets must be set in production
+	if c.AppEnv == "production" {
+		if len(c.JWTSecret) < 32 {
+			fail("jwt_secret must be set and at least 32 characters in production")
+		}
+		if len(c.JWTRefreshSecret) < 32 {
+			fail("jwt_refresh_secret must be set and at least 32 characters in production")
+		}
+	}
+	switch c.JWTAlgorithm {
+	case "HS256", "HS384", "HS512":
+	default:
+		fail("jwt_algorithm must be HS256, HS384 or HS512, got %q", c.JWTAlgorithm)
+	}
+
+	switch c.StorageDriver {
+	case "memory":
+	case "postgres":
+		if c.DBMaxOpenConns < 1 {
+			fail("db_max_open_conns must be at least 1, got %d", c.DBMaxOpenConns)
 		}
-		if cfg.JWTRefreshSecret == "" || len(cfg.JWTRefreshSecret) < 32 {
-			return fmt.Errorf("jwt_refresh_secret must be set and at least 32 characters in production")
+		if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+			fail("db_max_idle_conns must be between 0 and db_max_open_conns, got %d", c.DBMaxIdleConns)
 		}
+	default:
+		fail("storage_driver must be \"memory\" or \"postgres\", got %q", c.StorageDriver)
+	}
+	if c.PersistenceEncryption && len(c.PersistenceEncryptionKey) < 32 {
+		fail("workflow_persistence_encryption_key must be at least 32 characters when workflow_persistence_encryption is set")
+	}
+
+	if c.RedisHost == "" {
+		fail("redis_host must be set")
+	} else if strings.Contains(c.RedisHost, ":") && net.ParseIP(c.RedisHost) == nil {
+		fail("redis_host must be a host name or IP without a port, got %q", c.RedisHost)
+	}
+	if c.RedisPort < 1 || c.RedisPort > 65535 {
+		fail("redis_port must be between 1 and 65535, got %d", c.RedisPort)
+	}
+	switch c.RateLimitStore {
+	case "memory", "redis":
+	default:
+		fail("rate_limit_store must be \"memory\" or \"redis\", got %q", c.RateLimitStore)
 	}
 
+	if c.CORSAllowCredentials {
+		for _, origin := range strings.Split(c.CORSAllowedOrigins, ",") {
+			if strings.TrimSpace(origin) == "*" {
+				fail("cors_allow_credentials cannot be set when cors_allowed_origins includes \"*\"")
+				break
+			}
+		}
+	}
+
+	if c.AITokenBudget < 0 {
+		fail("ai_token_budget must be 0 (unlimited) or more, got %d", c.AITokenBudget)
+	}
+
+	if c.CircuitBreakerEnabled {
+		if c.CircuitBreakerThreshold < 1 {
+			fail("circuit_breaker_threshold must be at least 1, got %d", c.CircuitBreakerThreshold)
+		}
+		if c.CircuitBreakerResetTimeout <= 0 {
+			fail("circuit_breaker_reset_timeout must be positive, got %s", c.CircuitBreakerResetTimeout)
+		}
+	}
+
+	if c.SSLEnabled {
+		if err := checkFile(c.SSLCertFile); err != nil {
+			fail("ssl_cert_file: %v", err)
+		}
+		if err := checkFile(c.SSLKeyFile); err != nil {
+			fail("ssl_key_file: %v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkFile verifies that path names an existing file
+func checkFile(path string) error {
+	if path == "" {
+		return errors.New("must be set when SSL is enabled")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
 	return nil
 }
+
+// DatabaseDSN returns the Postgres connection string, built from the DB
+// settings unless database_url is set
+func (c *Config) DatabaseDSN() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.DBUser, c.DBPassword),
+		Host:     fmt.Sprintf("%s:%d", c.DBHost, c.DBPort),
+		Path:     "/" + c.DBName,
+		RawQuery: url.Values{"sslmode": {c.DBSSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// DatabasePool returns the settings of the Postgres connection pool
+func (c *Config) DatabasePool() database.Config {
+	return database.Config{
+		URL:             c.DatabaseDSN(),
+		MaxOpenConns:    c.DBMaxOpenConns,
+		MaxIdleConns:    c.DBMaxIdleConns,
+		ConnMaxLifetime: c.DBConnMaxLifetime,
+		QueryTimeout:    c.DBQueryTimeout,
+	}
+}
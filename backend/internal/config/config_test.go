@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() *Config {
+	return &Config{
+		AppEnv:         "development",
+		AppPort:        "8080",
+		JWTAlgorithm:   "HS256",
+		StorageDriver:  "memory",
+		RedisHost:      "localhost",
+		RedisPort:      6379,
+		RateLimitStore: "memory",
+	}
+}
+
+func TestValidateAcceptsDefaults(t *testing.T) {
+	assert.NoError(t, validConfig().Validate())
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.AppEnv = "production"
+	cfg.RedisHost = "redis.internal:6379"
+	cfg.StorageDriver = "mysql"
+	cfg.SSLEnabled = true
+	cfg.SSLCertFile = filepath.Join(t.TempDir(), "missing.pem")
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{"jwt_secret", "jwt_refresh_secret", "redis_host", "storage_driver", "ssl_cert_file", "ssl_key_file"} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestValidateRejectsCredentialsForAnyOrigin(t *testing.T) {
+	cfg := validConfig()
+	cfg.CORSAllowedOrigins = "https://app.example.com, *"
+	cfg.CORSAllowCredentials = true
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cors_allow_credentials")
+
+	cfg.CORSAllowedOrigins = "https://app.example.com"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidatePoolSettingsWithPostgres(t *testing.T) {
+	cfg := validConfig()
+	cfg.StorageDriver = "postgres"
+	cfg.DBMaxOpenConns = 10
+	cfg.DBMaxIdleConns = 20
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "db_max_idle_conns")
+
+	cfg.DBMaxIdleConns = 5
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidatePersistenceEncryptionNeedsKey(t *testing.T) {
+	cfg := validConfig()
+	cfg.PersistenceEncryption = true
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "persistence_encryption_key")
+
+	cfg.PersistenceEncryptionKey = "0123456789abcdef0123456789abcdef"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateAcceptsExistingSSLFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := validConfig()
+	cfg.SSLEnabled = true
+	cfg.SSLCertFile = filepath.Join(dir, "cert.pem")
+	cfg.SSLKeyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(cfg.SSLCertFile, []byte("cert"), 0600))
+	require.NoError(t, os.WriteFile(cfg.SSLKeyFile, []byte("key"), 0600))
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.RedisHost = "::1"
+	assert.NoError(t, cfg.Validate(), "IPv6 addresses contain colons")
+}
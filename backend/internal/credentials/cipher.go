@@ -0,0 +1,16 @@
+package credentials
+
+import "citadel-agent/backend/pkg/secretbox"
+
+// MinMasterKeyLength is the shortest master key accepted
+const MinMasterKeyLength = secretbox.MinMasterKeyLength
+
+// Cipher encrypts credential values with AES-256-GCM under a key derived
+// from the master key
+type Cipher = secretbox.Cipher
+
+// NewCipher creates a cipher from a master key of at least
+// MinMasterKeyLength characters
+func NewCipher(masterKey string) (*Cipher, error) {
+	return secretbox.NewCipher(masterKey)
+}
@@ -0,0 +1,180 @@
+// Package credentials keeps the secrets node configs refer to with
+// {{credentials.<name>}}, encrypted with a master key, so that they are
+// never part of a workflow definition.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for credentials that do not exist
+	ErrNotFound = errors.New("credential not found")
+	// ErrExists is returned when creating a credential whose name is taken
+	ErrExists = errors.New("credential already exists")
+)
+
+// validName is what a credential name may contain, so that it can be
+// referred to as {{credentials.<name>}}
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Credential is a named secret. Its value is never serialized, so listing
+// credentials does not disclose them.
+type Credential struct {
+	Name        string    `json:"name"`
+	Value       string    `json:"-"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks the name and value of the credential
+func (c *Credential) Validate() error {
+	if !validName.MatchString(c.Name) {
+		return fmt.Errorf("invalid credential name %q: use letters, digits, '_' and '-'", c.Name)
+	}
+	if c.Value == "" {
+		return fmt.Errorf("credential %s has no value", c.Name)
+	}
+	return nil
+}
+
+// Record is a credential as stored, with its value encrypted
+type Record struct {
+	Name        string
+	Ciphertext  []byte
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Store keeps encrypted credentials
+type Store interface {
+	// Create stores a new credential, or returns ErrExists
+	Create(ctx context.Context, rec *Record) error
+	// Update replaces the value and description of a credential, or returns
+	// ErrNotFound
+	Update(ctx context.Context, rec *Record) error
+	// Get returns a credential, or ErrNotFound
+	Get(ctx context.Context, name string) (*Record, error)
+	// List returns all credentials ordered by name
+	List(ctx context.Context) ([]*Record, error)
+	// Delete removes a credential, or returns ErrNotFound
+	Delete(ctx context.Context, name string) error
+}
+
+// Vault encrypts credentials into a Store and decrypts them for the engine
+type Vault struct {
+	store  Store
+	cipher *Cipher
+	now    func() time.Time
+}
+
+// NewVault creates a vault keeping credentials in store, encrypted with
+// cipher
+func NewVault(store Store, cipher *Cipher) *Vault {
+	return &Vault{store: store, cipher: cipher, now: time.Now}
+}
+
+// Create stores a new credential
+func (v *Vault) Create(ctx context.Context, credential *Credential) error {
+	if err := credential.Validate(); err != nil {
+		return err
+	}
+	rec, err := v.seal(credential)
+	if err != nil {
+		return err
+	}
+	rec.CreatedAt = v.now().UTC()
+	rec.UpdatedAt = rec.CreatedAt
+	if err := v.store.Create(ctx, rec); err != nil {
+		return err
+	}
+	credential.CreatedAt, credential.UpdatedAt = rec.CreatedAt, rec.UpdatedAt
+	return nil
+}
+
+// Update replaces the value and description of a credential
+func (v *Vault) Update(ctx context.Context, credential *Credential) error {
+	if err := credential.Validate(); err != nil {
+		return err
+	}
+	rec, err := v.seal(credential)
+	if err != nil {
+		return err
+	}
+	rec.UpdatedAt = v.now().UTC()
+	if err := v.store.Update(ctx, rec); err != nil {
+		return err
+	}
+	credential.UpdatedAt = rec.UpdatedAt
+	return nil
+}
+
+// Get returns a credential with its decrypted value
+func (v *Vault) Get(ctx context.Context, name string) (*Credential, error) {
+	rec, err := v.store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	value, err := v.cipher.Decrypt(rec.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credential %s: %w", name, err)
+	}
+	credential := metadata(rec)
+	credential.Value = string(value)
+	return credential, nil
+}
+
+// List returns the credentials without their values
+func (v *Vault) List(ctx context.Context) ([]*Credential, error) {
+	records, err := v.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	credentials := make([]*Credential, len(records))
+	for i, rec := range records {
+		credentials[i] = metadata(rec)
+	}
+	return credentials, nil
+}
+
+// Delete removes a credential
+func (v *Vault) Delete(ctx context.Context, name string) error {
+	return v.store.Delete(ctx, name)
+}
+
+// ResolveCredential returns the value of a credential. It implements
+// engine.CredentialResolver.
+func (v *Vault) ResolveCredential(ctx context.Context, name string) (string, error) {
+	credential, err := v.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return credential.Value, nil
+}
+
+func (v *Vault) seal(credential *Credential) (*Record, error) {
+	ciphertext, err := v.cipher.Encrypt([]byte(credential.Value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credential %s: %w", credential.Name, err)
+	}
+	return &Record{
+		Name:        credential.Name,
+		Ciphertext:  ciphertext,
+		Description: credential.Description,
+	}, nil
+}
+
+func metadata(rec *Record) *Credential {
+	return &Credential{
+		Name:        rec.Name,
+		Description: rec.Description,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+}
@@ -0,0 +1,82 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMasterKey = "0123456789abcdef0123456789abcdef"
+
+func newTestVault(t *testing.T) (*Vault, *MemoryStore) {
+	t.Helper()
+	cipher, err := NewCipher(testMasterKey)
+	require.NoError(t, err)
+	store := NewMemoryStore()
+	return NewVault(store, cipher), store
+}
+
+func TestVaultEncryptsCredentialsAtRest(t *testing.T) {
+	ctx := context.Background()
+	vault, store := newTestVault(t)
+
+	require.NoError(t, vault.Create(ctx, &Credential{Name: "github_token", Value: "ghp_secret", Description: "CI"}))
+
+	rec, err := store.Get(ctx, "github_token")
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(rec.Ciphertext, []byte("ghp_secret")))
+
+	value, err := vault.ResolveCredential(ctx, "github_token")
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_secret", value)
+
+	// Another master key cannot read it
+	other, err := NewCipher(strings.Repeat("x", MinMasterKeyLength))
+	require.NoError(t, err)
+	_, err = NewVault(store, other).ResolveCredential(ctx, "github_token")
+	assert.Error(t, err)
+}
+
+func TestVaultCRUD(t *testing.T) {
+	ctx := context.Background()
+	vault, _ := newTestVault(t)
+
+	require.NoError(t, vault.Create(ctx, &Credential{Name: "b", Value: "1"}))
+	require.NoError(t, vault.Create(ctx, &Credential{Name: "a", Value: "2"}))
+	assert.ErrorIs(t, vault.Create(ctx, &Credential{Name: "a", Value: "3"}), ErrExists)
+
+	require.NoError(t, vault.Update(ctx, &Credential{Name: "a", Value: "4", Description: "rotated"}))
+	credential, err := vault.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "4", credential.Value)
+	assert.Equal(t, "rotated", credential.Description)
+	assert.False(t, credential.CreatedAt.IsZero())
+
+	list, err := vault.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "a", list[0].Name)
+	assert.Empty(t, list[0].Value, "listing does not decrypt values")
+
+	require.NoError(t, vault.Delete(ctx, "a"))
+	_, err = vault.ResolveCredential(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, vault.Delete(ctx, "a"), ErrNotFound)
+	assert.ErrorIs(t, vault.Update(ctx, &Credential{Name: "a", Value: "5"}), ErrNotFound)
+}
+
+func TestCredentialValidate(t *testing.T) {
+	assert.NoError(t, (&Credential{Name: "github_token-2", Value: "x"}).Validate())
+	assert.Error(t, (&Credential{Name: "github.token", Value: "x"}).Validate())
+	assert.Error(t, (&Credential{Name: "", Value: "x"}).Validate())
+	assert.Error(t, (&Credential{Name: "token"}).Validate())
+}
+
+func TestNewCipherRejectsShortKey(t *testing.T) {
+	_, err := NewCipher("short")
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/jackc/pgx/v5"
+)
+
+// MemoryStore keeps credentials in process memory. They are lost on
+// restart; use PostgresStore to keep them.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryStore creates an empty in-memory credential store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+// Create implements Store
+func (s *MemoryStore) Create(ctx context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[rec.Name]; ok {
+		return ErrExists
+	}
+	stored := *rec
+	s.records[rec.Name] = &stored
+	return nil
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(ctx context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.records[rec.Name]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Ciphertext = rec.Ciphertext
+	existing.Description = rec.Description
+	existing.UpdatedAt = rec.UpdatedAt
+	rec.CreatedAt = existing.CreatedAt
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(ctx context.Context, name string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	stored := *rec
+	return &stored, nil
+}
+
+// List implements Store
+func (s *MemoryStore) List(ctx context.Context) ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*Record, 0, len(s.records))
+	for _, rec := range s.records {
+		stored := *rec
+		records = append(records, &stored)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.records, name)
+	return nil
+}
+
+// PostgresStore keeps credentials in the credentials table
+type PostgresStore struct {
+	pool engine.PostgresPool
+}
+
+// NewPostgresStore creates a credential store on pool
+func NewPostgresStore(pool engine.PostgresPool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+// Create implements Store
+func (s *PostgresStore) Create(ctx context.Context, rec *Record) error {
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO credentials (name, encrypted_value, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO NOTHING`,
+		rec.Name, rec.Ciphertext, rec.Description, rec.CreatedAt, rec.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+// Update implements Store
+func (s *PostgresStore) Update(ctx context.Context, rec *Record) error {
+	err := s.pool.QueryRow(ctx, `
+		UPDATE credentials
+		SET encrypted_value = $2, description = $3, updated_at = $4
+		WHERE name = $1
+		RETURNING created_at`,
+		rec.Name, rec.Ciphertext, rec.Description, rec.UpdatedAt,
+	).Scan(&rec.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Get implements Store
+func (s *PostgresStore) Get(ctx context.Context, name string) (*Record, error) {
+	rec := &Record{Name: name}
+	err := s.pool.QueryRow(ctx, `
+		SELECT encrypted_value, description, created_at, updated_at
+		FROM credentials WHERE name = $1`,
+		name,
+	).Scan(&rec.Ciphertext, &rec.Description, &rec.CreatedAt, &rec.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List implements Store
+func (s *PostgresStore) List(ctx context.Context) ([]*Record, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT name, encrypted_value, description, created_at, updated_at
+		FROM credentials ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		rec := &Record{}
+		if err := rows.Scan(&rec.Name, &rec.Ciphertext, &rec.Description, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// Delete implements Store
+func (s *PostgresStore) Delete(ctx context.Context, name string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM credentials WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
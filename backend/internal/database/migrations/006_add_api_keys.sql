@@ -1,28 +0,0 @@
--- Migration: 006_add_api_keys
--- Description: Add table for API keys
--- Created: 2024-01-24
-
--- Create api_keys table
-CREATE TABLE IF NOT EXISTS api_keys (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id UUID NOT NULL,
-    name VARCHAR(100) NOT NULL,
-    key VARCHAR(255) UNIQUE NOT NULL,
-    key_prefix VARCHAR(10) NOT NULL,
-    permissions TEXT[] DEFAULT '{}',
-    expires_at TIMESTAMP,
-    last_used_at TIMESTAMP,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    deleted_at TIMESTAMP
-);
-
--- Create indexes
-CREATE INDEX idx_api_keys_user_id ON api_keys(user_id) WHERE deleted_at IS NULL;
-CREATE INDEX idx_api_keys_key ON api_keys(key) WHERE deleted_at IS NULL;
-CREATE INDEX idx_api_keys_key_prefix ON api_keys(key_prefix) WHERE deleted_at IS NULL;
-
--- Add comment
-COMMENT ON TABLE api_keys IS 'API keys for programmatic access';
-COMMENT ON COLUMN api_keys.key IS 'Full API key (never expose in responses except on creation)';
-COMMENT ON COLUMN api_keys.key_prefix IS 'First 8 characters of key for display purposes';
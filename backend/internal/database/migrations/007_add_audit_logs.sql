@@ -1,34 +0,0 @@
--- Migration: 007_add_audit_logs
--- Description: Add table for audit logging
--- Created: 2024-01-24
-
--- Create audit_logs table
-CREATE TABLE IF NOT EXISTS audit_logs (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id UUID,
-    action VARCHAR(100) NOT NULL,
-    resource VARCHAR(50) NOT NULL,
-    resource_id VARCHAR(255),
-    changes JSONB,
-    ip_address VARCHAR(45),
-    user_agent TEXT,
-    status VARCHAR(20) NOT NULL,
-    error_msg TEXT,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW()
-);
-
--- Create indexes for efficient querying
-CREATE INDEX idx_audit_logs_user_id ON audit_logs(user_id);
-CREATE INDEX idx_audit_logs_action ON audit_logs(action);
-CREATE INDEX idx_audit_logs_resource ON audit_logs(resource);
-CREATE INDEX idx_audit_logs_resource_id ON audit_logs(resource_id);
-CREATE INDEX idx_audit_logs_status ON audit_logs(status);
-CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at DESC);
-
--- Create composite index for common queries
-CREATE INDEX idx_audit_logs_user_action ON audit_logs(user_id, action, created_at DESC);
-
--- Add comment
-COMMENT ON TABLE audit_logs IS 'Comprehensive audit trail of all user actions';
-COMMENT ON COLUMN audit_logs.changes IS 'JSON object containing request/response details';
-COMMENT ON COLUMN audit_logs.status IS 'success or failure';
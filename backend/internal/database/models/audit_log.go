@@ -11,7 +11,7 @@ import (
 // AuditLog represents an audit trail entry
 type AuditLog struct {
 	ID         string         `gorm:"type:uuid;primaryKey" json:"id"`
-	UserID     string         `gorm:"type:uuid;index" json:"user_id"`
+	UserID     string         `gorm:"index" json:"user_id"`
 	Action     string         `gorm:"index;not null" json:"action"` // e.g., "workflow.create", "user.delete"
 	Resource   string         `gorm:"not null" json:"resource"`     // e.g., "workflow", "user", "apikey"
 	ResourceID string         `gorm:"index" json:"resource_id"`
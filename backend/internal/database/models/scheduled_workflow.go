@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// ScheduledWorkflow represents a cron schedule attached to a workflow
+type ScheduledWorkflow struct {
+	ID             int64      `gorm:"primaryKey" json:"id"`
+	WorkflowID     int64      `gorm:"index;not null" json:"workflow_id"`
+	NodeID         *int64     `gorm:"uniqueIndex" json:"node_id,omitempty"` // schedule_trigger node the schedule was discovered from
+	CronExpression string     `gorm:"not null" json:"cron_expression"`      // 5-field cron or descriptor such as "@every 5m"
+	Timezone       string     `gorm:"not null;default:UTC" json:"timezone"`
+	Enabled        bool       `gorm:"default:true" json:"enabled"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	NextRunAt      *time.Time `gorm:"index" json:"next_run_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// IsDue reports whether the schedule should fire at the given time
+func (s *ScheduledWorkflow) IsDue(now time.Time) bool {
+	return s.Enabled && s.NextRunAt != nil && !s.NextRunAt.After(now)
+}
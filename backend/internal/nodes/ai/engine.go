@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/nodes/base"
+	"citadel-agent/backend/internal/workflow/core/engine"
+)
+
+// NewOpenAINode returns a constructor running the node made by newNode, such
+// as NewOpenAIGPT4Node, in the WorkflowExecutor. Its token usage is recorded
+// for, and limited by the budget of, the user the run was started for.
+func NewOpenAINode(newNode func() base.Node) engine.NodeConstructor {
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := newNode()
+		if err := node.Validate(config); err != nil {
+			return nil, err
+		}
+		return &engineNode{node: node, config: config}, nil
+	}
+}
+
+// engineNode runs a base.Node as an interfaces.NodeInstance
+type engineNode struct {
+	node   base.Node
+	config map[string]interface{}
+}
+
+// Execute runs the node with the user and execution carried by ctx
+func (n *engineNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	result, err := n.node.Execute(&base.ExecutionContext{
+		ExecutionID: engine.ExecutionIDFromContext(ctx),
+		UserID:      engine.UserIDFromContext(ctx),
+		Variables:   n.config,
+		Context:     ctx,
+		Logger:      engineLogger{engine.LoggerFromContext(ctx)},
+		StartTime:   time.Now(),
+	}, inputs)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, errors.New(result.Error)
+	}
+	return result.Data, nil
+}
+
+// GetType returns the node's metadata ID
+func (n *engineNode) GetType() string {
+	return n.node.GetMetadata().ID
+}
+
+// GetID returns the node's metadata ID
+func (n *engineNode) GetID() string {
+	return n.node.GetMetadata().ID
+}
+
+// engineLogger writes the records of a base.Node to the executor's logger
+type engineLogger struct {
+	logger engine.Logger
+}
+
+func (l engineLogger) Debug(msg string, fields map[string]interface{}) {
+	l.logger.Debug(msg, fields)
+}
+
+func (l engineLogger) Info(msg string, fields map[string]interface{}) {
+	l.logger.Info(msg, fields)
+}
+
+func (l engineLogger) Warn(msg string, fields map[string]interface{}) {
+	l.logger.Warn(msg, fields)
+}
+
+func (l engineLogger) Error(msg string, err error, fields map[string]interface{}) {
+	if err != nil {
+		merged := map[string]interface{}{"error": err}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		fields = merged
+	}
+	l.logger.Error(msg, fields)
+}
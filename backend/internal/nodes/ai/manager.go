@@ -2,7 +2,11 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	nodeerrors "citadel-agent/backend/pkg/errors"
 )
 
 // ModelType represents the type of AI model
@@ -48,12 +52,16 @@ type Provider interface {
 // Manager manages AI providers and routing
 type Manager struct {
 	providers map[ProviderType]Provider
+	// breakers stop requests to providers that keep failing
+	breakers *middleware.CircuitBreakers
 }
 
-// NewManager creates a new AI manager
+// NewManager creates a new AI manager. Its requests go through the
+// outbound circuit breakers of the process, one per provider.
 func NewManager() *Manager {
 	return &Manager{
 		providers: make(map[ProviderType]Provider),
+		breakers:  middleware.OutboundCircuitBreakers(),
 	}
 }
 
@@ -71,5 +79,24 @@ func (m *Manager) Generate(ctx context.Context, req Request) (*Response, error)
 		return nil, fmt.Errorf("provider %s not found", req.Provider)
 	}
 
-	return provider.Generate(ctx, req)
+	breaker := m.breakers.Get("ai:" + string(req.Provider))
+	if err := breaker.Allow(); err != nil {
+		return nil, nodeerrors.NewCircuitOpenError(fmt.Sprintf("not calling AI provider %s, which keeps failing", req.Provider), err)
+	}
+	resp, err := provider.Generate(ctx, req)
+	breaker.Done(serviceError(err))
+	return resp, err
+}
+
+// serviceError returns err for the circuit breakers when it may say the
+// service is failing. Requests the service refused, with an error that is
+// not retryable, and canceled ones are not held against it.
+func serviceError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	if nodeerrors.CodeOf(err) != "" && !nodeerrors.IsRetryable(err) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,46 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingProvider fails every request with err
+type failingProvider struct {
+	err   error
+	calls int
+}
+
+func (p *failingProvider) Generate(ctx context.Context, req Request) (*Response, error) {
+	p.calls++
+	return nil, p.err
+}
+
+func TestManagerOpensCircuitOfFailingProvider(t *testing.T) {
+	manager := NewManager()
+	manager.breakers = middleware.NewCircuitBreakers(middleware.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute})
+	down := &failingProvider{err: nodeerrors.NewResourceError("overloaded", nil)}
+	manager.RegisterProvider(ProviderOpenAI, down)
+
+	for i := 0; i < 2; i++ {
+		_, err := manager.Generate(context.Background(), Request{Provider: ProviderOpenAI})
+		assert.Equal(t, nodeerrors.CodeResource, nodeerrors.CodeOf(err))
+	}
+	_, err := manager.Generate(context.Background(), Request{Provider: ProviderOpenAI})
+	assert.Equal(t, nodeerrors.CodeCircuit, nodeerrors.CodeOf(err))
+	assert.Equal(t, 2, down.calls)
+
+	// Requests the provider refuses say nothing about its health
+	refusing := &failingProvider{err: nodeerrors.NewAuthError("bad key", nil)}
+	manager.RegisterProvider(ProviderLocal, refusing)
+	for i := 0; i < 3; i++ {
+		_, err := manager.Generate(context.Background(), Request{Provider: ProviderLocal})
+		assert.Equal(t, nodeerrors.CodeAuth, nodeerrors.CodeOf(err))
+	}
+	assert.Equal(t, 3, refusing.calls)
+}
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"citadel-agent/backend/internal/nodes/base"
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	nodeerrors "citadel-agent/backend/pkg/errors"
 )
 
 // OpenAINode implements OpenAI API integration
@@ -241,7 +243,13 @@ func (n *OpenAINode) Execute(ctx *base.ExecutionContext, inputs map[string]inter
 	}
 
 	if prompt == "" {
-		err := fmt.Errorf("prompt is required")
+		err := nodeerrors.NewValidationError("prompt is required", nil)
+		return base.CreateErrorResult(err, time.Since(startTime)), err
+	}
+
+	// Refuse users who have used up their token budget
+	tracker := GetUsageTracker()
+	if err := tracker.CheckBudget(ctx.Context, ctx.UserID); err != nil {
 		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
 
@@ -280,9 +288,18 @@ func (n *OpenAINode) Execute(ctx *base.ExecutionContext, inputs map[string]inter
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+config.APIKey)
 
+	// Fail fast while OpenAI keeps failing
+	breaker := middleware.OutboundCircuitBreakers().Get(req.URL.Host)
+	if err := breaker.Allow(); err != nil {
+		err = nodeerrors.NewCircuitOpenError("not calling OpenAI, which keeps failing", err)
+		return base.CreateErrorResult(err, time.Since(startTime)), err
+	}
+
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
+		err = nodeerrors.FromTransport("OpenAI request failed", err)
+		breaker.Done(serviceError(err))
 		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
 	defer resp.Body.Close()
@@ -290,13 +307,16 @@ func (n *OpenAINode) Execute(ctx *base.ExecutionContext, inputs map[string]inter
 	// Read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		breaker.Done(serviceError(err))
 		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("OpenAI API error: %s", string(body))
+		err := nodeerrors.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("OpenAI API error: %s", string(body)))
+		breaker.Done(serviceError(err))
 		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
+	breaker.Done(nil)
 
 	// Parse response
 	var apiResp OpenAIResponse
@@ -304,6 +324,19 @@ func (n *OpenAINode) Execute(ctx *base.ExecutionContext, inputs map[string]inter
 		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
 
+	// Tokens are billed even when no choice comes back
+	usage := TokenUsage{
+		PromptTokens:     int64(apiResp.Usage.PromptTokens),
+		CompletionTokens: int64(apiResp.Usage.CompletionTokens),
+		TotalTokens:      int64(apiResp.Usage.TotalTokens),
+	}
+	if err := tracker.Record(ctx.Context, ctx.ExecutionID, ctx.UserID, usage); err != nil {
+		ctx.Logger.Warn("Failed to record OpenAI token usage", map[string]interface{}{
+			"execution_id": ctx.ExecutionID,
+			"error":        err.Error(),
+		})
+	}
+
 	if len(apiResp.Choices) == 0 {
 		err := fmt.Errorf("no response from OpenAI")
 		return base.CreateErrorResult(err, time.Since(startTime)), err
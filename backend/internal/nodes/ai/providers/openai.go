@@ -10,6 +10,7 @@ import (
 	"os"
 
 	"citadel-agent/backend/internal/nodes/ai"
+	nodeerrors "citadel-agent/backend/pkg/errors"
 )
 
 // OpenAIProvider implements the AI Provider interface for OpenAI
@@ -29,7 +30,7 @@ func NewOpenAIProvider() *OpenAIProvider {
 // Generate generates text using OpenAI
 func (p *OpenAIProvider) Generate(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	if p.apiKey == "" {
-		return nil, fmt.Errorf("OpenAI API key not set")
+		return nil, nodeerrors.NewAuthError("OpenAI API key not set", nil)
 	}
 
 	url := "https://api.openai.com/v1/chat/completions"
@@ -53,14 +54,14 @@ func (p *OpenAIProvider) Generate(ctx context.Context, req ai.Request) (*ai.Resp
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, nodeerrors.FromTransport("OpenAI request failed", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("OpenAI API error: %s", string(body))
+		return nil, nodeerrors.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("OpenAI API error: %s", string(body)))
 	}
 
 	// Simplified response parsing
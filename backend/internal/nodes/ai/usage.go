@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+)
+
+// TokenUsage counts the tokens of model requests
+type TokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// Add adds other to u
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// UsageStore accumulates the token usage of model requests per execution
+// and per user
+type UsageStore interface {
+	// Add records the usage of a request made by executionID for userID
+	Add(ctx context.Context, executionID, userID string, usage TokenUsage) error
+	// ExecutionUsage returns the usage of all requests of an execution
+	ExecutionUsage(ctx context.Context, executionID string) (TokenUsage, error)
+	// UserUsage returns the usage of all requests made for a user
+	UserUsage(ctx context.Context, userID string) (TokenUsage, error)
+}
+
+// MemoryUsageStore keeps token usage in process memory. It is lost on
+// restart; use PostgresUsageStore to keep it.
+type MemoryUsageStore struct {
+	mu         sync.RWMutex
+	executions map[string]TokenUsage
+	users      map[string]TokenUsage
+}
+
+// NewMemoryUsageStore creates an empty in-memory usage store
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{
+		executions: make(map[string]TokenUsage),
+		users:      make(map[string]TokenUsage),
+	}
+}
+
+// Add implements UsageStore
+func (s *MemoryUsageStore) Add(ctx context.Context, executionID, userID string, usage TokenUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if executionID != "" {
+		total := s.executions[executionID]
+		total.Add(usage)
+		s.executions[executionID] = total
+	}
+	if userID != "" {
+		total := s.users[userID]
+		total.Add(usage)
+		s.users[userID] = total
+	}
+	return nil
+}
+
+// ExecutionUsage implements UsageStore
+func (s *MemoryUsageStore) ExecutionUsage(ctx context.Context, executionID string) (TokenUsage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.executions[executionID], nil
+}
+
+// UserUsage implements UsageStore
+func (s *MemoryUsageStore) UserUsage(ctx context.Context, userID string) (TokenUsage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[userID], nil
+}
+
+// PostgresUsageStore keeps token usage in the ai_token_usage table, one row
+// per request
+type PostgresUsageStore struct {
+	pool engine.PostgresPool
+}
+
+// NewPostgresUsageStore creates a usage store on pool
+func NewPostgresUsageStore(pool engine.PostgresPool) *PostgresUsageStore {
+	return &PostgresUsageStore{pool: pool}
+}
+
+// Add implements UsageStore
+func (s *PostgresUsageStore) Add(ctx context.Context, executionID, userID string, usage TokenUsage) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO ai_token_usage (execution_id, user_id, prompt_tokens, completion_tokens, total_tokens)
+		VALUES ($1, $2, $3, $4, $5)`,
+		executionID, userID, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens,
+	)
+	return err
+}
+
+// ExecutionUsage implements UsageStore
+func (s *PostgresUsageStore) ExecutionUsage(ctx context.Context, executionID string) (TokenUsage, error) {
+	return s.sum(ctx, "execution_id", executionID)
+}
+
+// UserUsage implements UsageStore
+func (s *PostgresUsageStore) UserUsage(ctx context.Context, userID string) (TokenUsage, error) {
+	return s.sum(ctx, "user_id", userID)
+}
+
+// sum adds up the usage of the rows whose column is value
+func (s *PostgresUsageStore) sum(ctx context.Context, column, value string) (TokenUsage, error) {
+	var usage TokenUsage
+	err := s.pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0)
+		FROM ai_token_usage WHERE `+column+` = $1`,
+		value,
+	).Scan(&usage.PromptTokens, &usage.CompletionTokens, &usage.TotalTokens)
+	return usage, err
+}
+
+// UsageTracker records the token usage of AI nodes and holds each user to a
+// budget of total tokens
+type UsageTracker struct {
+	store UsageStore
+	// budget is the number of tokens each user may use; 0 is unlimited
+	budget int64
+}
+
+// NewUsageTracker creates a tracker recording usage in store. A budget of 0
+// leaves users unlimited.
+func NewUsageTracker(store UsageStore, budget int64) *UsageTracker {
+	return &UsageTracker{store: store, budget: budget}
+}
+
+// CheckBudget returns a quota exceeded error when userID has used up their
+// token budget. Requests without a user are not limited.
+func (t *UsageTracker) CheckBudget(ctx context.Context, userID string) error {
+	if t.budget <= 0 || userID == "" {
+		return nil
+	}
+	usage, err := t.store.UserUsage(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to read token usage: %w", err)
+	}
+	if usage.TotalTokens >= t.budget {
+		return nodeerrors.NewQuotaExceededError(
+			fmt.Sprintf("user %s has used %d of their %d AI tokens", userID, usage.TotalTokens, t.budget), nil)
+	}
+	return nil
+}
+
+// Record adds the usage of a request made by executionID for userID
+func (t *UsageTracker) Record(ctx context.Context, executionID, userID string, usage TokenUsage) error {
+	return t.store.Add(ctx, executionID, userID, usage)
+}
+
+// ExecutionUsage returns the usage of all requests of an execution
+func (t *UsageTracker) ExecutionUsage(ctx context.Context, executionID string) (TokenUsage, error) {
+	return t.store.ExecutionUsage(ctx, executionID)
+}
+
+// UserUsage returns the usage of all requests made for a user
+func (t *UsageTracker) UserUsage(ctx context.Context, userID string) (TokenUsage, error) {
+	return t.store.UserUsage(ctx, userID)
+}
+
+var (
+	usageTrackerMu sync.RWMutex
+	usageTracker   = NewUsageTracker(NewMemoryUsageStore(), 0)
+)
+
+// SetUsageTracker sets the tracker the AI nodes record their usage with.
+// By default usage is kept in memory and unlimited.
+func SetUsageTracker(tracker *UsageTracker) {
+	usageTrackerMu.Lock()
+	defer usageTrackerMu.Unlock()
+	usageTracker = tracker
+}
+
+// GetUsageTracker returns the tracker the AI nodes record their usage with
+func GetUsageTracker() *UsageTracker {
+	usageTrackerMu.RLock()
+	defer usageTrackerMu.RUnlock()
+	return usageTracker
+}
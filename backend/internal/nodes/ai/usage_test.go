@@ -0,0 +1,101 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"citadel-agent/backend/internal/nodes/base"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAccumulatesPerExecutionAndUser(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewUsageTracker(NewMemoryUsageStore(), 0)
+
+	require.NoError(t, tracker.Record(ctx, "exec-1", "alice", TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}))
+	require.NoError(t, tracker.Record(ctx, "exec-1", "alice", TokenUsage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30}))
+	require.NoError(t, tracker.Record(ctx, "exec-2", "alice", TokenUsage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}))
+	require.NoError(t, tracker.Record(ctx, "exec-3", "bob", TokenUsage{PromptTokens: 7, CompletionTokens: 0, TotalTokens: 7}))
+
+	usage, err := tracker.ExecutionUsage(ctx, "exec-1")
+	require.NoError(t, err)
+	assert.Equal(t, TokenUsage{PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45}, usage)
+
+	usage, err = tracker.UserUsage(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, TokenUsage{PromptTokens: 31, CompletionTokens: 16, TotalTokens: 47}, usage)
+
+	usage, err = tracker.UserUsage(ctx, "carol")
+	require.NoError(t, err)
+	assert.Equal(t, TokenUsage{}, usage)
+}
+
+func TestUsageBudgetGuard(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewUsageTracker(NewMemoryUsageStore(), 100)
+
+	assert.NoError(t, tracker.CheckBudget(ctx, "alice"))
+	require.NoError(t, tracker.Record(ctx, "exec-1", "alice", TokenUsage{TotalTokens: 99}))
+	assert.NoError(t, tracker.CheckBudget(ctx, "alice"), "one token left")
+
+	require.NoError(t, tracker.Record(ctx, "exec-1", "alice", TokenUsage{TotalTokens: 1}))
+	err := tracker.CheckBudget(ctx, "alice")
+	assert.Equal(t, nodeerrors.CodeQuota, nodeerrors.CodeOf(err))
+	assert.False(t, nodeerrors.IsRetryable(err))
+
+	assert.NoError(t, tracker.CheckBudget(ctx, "bob"), "budgets are per user")
+	assert.NoError(t, tracker.CheckBudget(ctx, ""), "requests without a user are not limited")
+
+	unlimited := NewUsageTracker(NewMemoryUsageStore(), 0)
+	require.NoError(t, unlimited.Record(ctx, "exec-1", "alice", TokenUsage{TotalTokens: 1 << 40}))
+	assert.NoError(t, unlimited.CheckBudget(ctx, "alice"))
+}
+
+func TestOpenAINodeRefusesUsersOverBudget(t *testing.T) {
+	tracker := NewUsageTracker(NewMemoryUsageStore(), 10)
+	require.NoError(t, tracker.Record(context.Background(), "exec-1", "alice", TokenUsage{TotalTokens: 10}))
+	previous := GetUsageTracker()
+	SetUsageTracker(tracker)
+	defer SetUsageTracker(previous)
+
+	// The budget is checked before any request is made
+	node := NewOpenAIGPT4Node()
+	result, err := node.Execute(&base.ExecutionContext{
+		ExecutionID: "exec-2",
+		UserID:      "alice",
+		Variables:   map[string]interface{}{"api_key": "unused", "model": "gpt-4"},
+		Context:     context.Background(),
+	}, map[string]interface{}{"prompt": "hello"})
+	assert.Equal(t, nodeerrors.CodeQuota, nodeerrors.CodeOf(err))
+	require.NotNil(t, result)
+	assert.False(t, result.Success)
+}
+
+func TestExecutorHoldsRunsToTheirUsersBudget(t *testing.T) {
+	tracker := NewUsageTracker(NewMemoryUsageStore(), 10)
+	require.NoError(t, tracker.Record(context.Background(), "exec-1", "alice", TokenUsage{TotalTokens: 10}))
+	previous := GetUsageTracker()
+	SetUsageTracker(tracker)
+	defer SetUsageTracker(previous)
+
+	registry := engine.NewNodeTypeRegistry()
+	metadata := types.NodeMetadata{ID: "openai_gpt4", Name: "OpenAI GPT-4", External: true}
+	require.NoError(t, registry.RegisterNodeType(metadata.ID, engine.AdaptNode(NewOpenAINode(NewOpenAIGPT4Node), metadata), metadata))
+	executor := engine.NewWorkflowExecutor(registry)
+
+	workflow := &engine.Workflow{
+		ID: "wf-1",
+		Nodes: map[string]*engine.WorkflowNode{
+			"ask": {ID: "ask", Type: "openai_gpt4", Config: map[string]interface{}{"api_key": "unused", "model": "gpt-4", "prompt": "hello"}},
+		},
+	}
+
+	// The budget is checked before any request is made
+	ctx := engine.ContextWithUserID(context.Background(), "alice")
+	_, err := executor.Run(ctx, workflow, map[string]interface{}{})
+	assert.Equal(t, nodeerrors.CodeQuota, nodeerrors.CodeOf(err))
+}
@@ -0,0 +1,338 @@
+// Package builtin registers the node types that ship with Citadel Agent,
+// configured from the environment, so the API server and the worker run the
+// same nodes.
+package builtin
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/nodes/ai"
+	"citadel-agent/backend/internal/nodes/command"
+	"citadel-agent/backend/internal/nodes/database"
+	grpcnode "citadel-agent/backend/internal/nodes/grpc"
+	httpnode "citadel-agent/backend/internal/nodes/http"
+	"citadel-agent/backend/internal/nodes/integration/storage"
+	"citadel-agent/backend/internal/nodes/queue"
+	"citadel-agent/backend/internal/nodes/trigger"
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"citadel-agent/backend/pkg/resources"
+	"github.com/redis/go-redis/v9"
+)
+
+// nodeType is a node type to register
+type nodeType struct {
+	constructor engine.NodeConstructor
+	metadata    types.NodeMetadata
+}
+
+// Register registers the built-in node types with registry. Message queue
+// nodes publish to and consume from broker, which may be nil. The exec node
+// is only registered when CITADEL_EXEC_ENABLED is true. The environment
+// variables configuring the nodes are described with their options below.
+func Register(registry *engine.NodeTypeRegistryImpl, broker queue.Broker) {
+	nodeTypes := []nodeType{
+		// Register the HTTP Request node
+		{httpnode.NewHTTPRequestNodeWithOptions(httpRequestOptions()), types.NodeMetadata{ID: "http_request", Name: "HTTP Request", Category: "http", Description: "Make HTTP requests", Inputs: httpRequestParameters, OutputSchema: httpResponseSchema, External: true}},
+		// Register the GraphQL node
+		{httpnode.NewGraphQLNode, types.NodeMetadata{ID: "graphql", Name: "GraphQL", Category: "http", Description: "Send GraphQL queries and mutations", External: true}},
+		// Register the gRPC node
+		{grpcnode.NewGRPCNode, types.NodeMetadata{ID: "grpc", Name: "gRPC", Category: "http", Description: "Make unary gRPC calls", SideEffects: true, External: true}},
+		// Register the JavaScript node
+		{utility.NewJavaScriptNodeWithOptions(scriptOptions()), types.NodeMetadata{ID: "javascript", Name: "JavaScript", Category: "utility", Description: "Run a JavaScript snippet against the incoming data"}},
+		// Register the WASM node
+		{utility.NewWasmNodeWithOptions(wasmOptions()), types.NodeMetadata{ID: "wasm", Name: "WASM", Category: "utility", Description: "Run a WebAssembly module against the incoming data"}},
+		// Register the Logger node
+		{utility.NewLoggerNode, types.NodeMetadata{ID: "logger", Name: "Logger", Category: "utility", Description: "Log data passing through the workflow"}},
+		// Register the Data Transformer node
+		{utility.NewTransformerNode, types.NodeMetadata{ID: "data_transformer", Name: "Data Transformer", Category: "utility", Description: "Transform data between nodes", Inputs: transformerParameters}},
+		// Register the Date node
+		{utility.NewDateNode, types.NodeMetadata{ID: "date", Name: "Date", Category: "utility", Description: "Convert, shift and compare dates across time zones"}},
+		// Register the If/Else node
+		{utility.NewIfElseNode, types.NodeMetadata{ID: "if_else", Name: "If/Else", Category: "flow", Description: "Route execution based on a condition"}},
+		// Register the Switch node
+		{utility.NewSwitchNode, types.NodeMetadata{ID: "switch", Name: "Switch", Category: "flow", Description: "Route execution to the first matching case"}},
+		// Register the For Each node
+		{utility.NewForEachNode, types.NodeMetadata{ID: "for_each", Name: "For Each", Category: "flow", Description: "Iterate over a collection"}},
+		// Register the While node
+		{utility.NewWhileNodeWithOptions(whileOptions()), types.NodeMetadata{ID: "while", Name: "While", Category: "flow", Description: "Repeat a body while a condition holds"}},
+		// Register the Merge node
+		{utility.NewMergeNode, types.NodeMetadata{ID: "merge", Name: "Merge", Category: "flow", Description: "Combine the outputs of parallel branches"}},
+		// Register the Approval node
+		{utility.NewApprovalNode, types.NodeMetadata{ID: "approval", Name: "Approval", Category: "flow", Description: "Wait for a person to approve or reject"}},
+		// Register the OpenAI GPT-4 node
+		{ai.NewOpenAINode(ai.NewOpenAIGPT4Node), types.NodeMetadata{ID: "openai_gpt4", Name: "OpenAI GPT-4", Category: "ai", Description: "Generate text with GPT-4", External: true}},
+		// Register the OpenAI GPT-3.5 node
+		{ai.NewOpenAINode(ai.NewOpenAIGPT35Node), types.NodeMetadata{ID: "openai_gpt35", Name: "OpenAI GPT-3.5", Category: "ai", Description: "Generate text with GPT-3.5 Turbo", External: true}},
+		// Register the Redis node
+		{database.NewRedisNode(RedisOptions(os.Getenv("REDIS_URL"))), types.NodeMetadata{ID: "redis", Name: "Redis", Category: "database", Description: "Read and write Redis keys, lists and channels", External: true}},
+		// Register the Storage node
+		{storage.NewStorageNode(storageOptions()), types.NodeMetadata{ID: "storage", Name: "Storage", Category: "storage", Description: "Read, write, list and delete files in local or S3-compatible storage"}},
+		// Register the Message Queue node
+		{queue.NewMessageQueueNode(broker), types.NodeMetadata{ID: queue.MessageQueueNodeType, Name: "Message Queue", Category: "integration", Description: "Publish to a RabbitMQ queue, or start the workflow for each of its messages"}},
+		// Register the Webhook Trigger node
+		{trigger.NewWebhookTriggerNode, types.NodeMetadata{ID: trigger.WebhookTriggerNodeType, Name: "Webhook Trigger", Category: "trigger", Description: "Start the workflow from an inbound HTTP request"}},
+		// Register the Schedule Trigger node
+		{trigger.NewScheduleTriggerNode, types.NodeMetadata{ID: trigger.ScheduleTriggerNodeType, Name: "Schedule Trigger", Category: "trigger", Description: "Start the workflow on a cron schedule"}},
+	}
+
+	// Register the Exec node only when enabled, since it runs commands on
+	// the host unless sandboxed
+	if os.Getenv("CITADEL_EXEC_ENABLED") == "true" {
+		nodeTypes = append(nodeTypes, nodeType{command.NewExecNodeWithOptions(execOptions()), types.NodeMetadata{ID: "exec", Name: "Exec", Category: "utility", Description: "Run an external command", SideEffects: true}})
+	}
+
+	for _, nt := range nodeTypes {
+		if err := registry.RegisterNodeType(nt.metadata.ID, engine.AdaptNode(nt.constructor, nt.metadata), nt.metadata); err != nil {
+			log.Printf("Failed to register node type %s: %v", nt.metadata.ID, err)
+		}
+	}
+
+	log.Printf("Registered %d node types", len(registry.ListNodeTypes()))
+}
+
+// httpRequestParameters is the configuration of the HTTP request node, with
+// the defaults it applies to parameters left unset
+var httpRequestParameters = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"url"},
+	"properties": map[string]interface{}{
+		"method": map[string]interface{}{
+			"type":    "string",
+			"title":   "Method",
+			"enum":    []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+			"default": "GET",
+		},
+		"url":          map[string]interface{}{"type": "string", "title": "URL"},
+		"headers":      map[string]interface{}{"type": "object", "title": "Headers"},
+		"query_params": map[string]interface{}{"type": "object", "title": "Query Parameters"},
+		"body":         map[string]interface{}{"title": "Body"},
+		"body_type": map[string]interface{}{
+			"type":        "string",
+			"title":       "Body Type",
+			"enum":        []string{httpnode.BodyTypeJSON, httpnode.BodyTypeForm, httpnode.BodyTypeRaw},
+			"description": "Defaults to raw for string bodies and json otherwise",
+		},
+		"timeout": map[string]interface{}{
+			"type":    "number",
+			"title":   "Timeout (seconds)",
+			"default": httpnode.DefaultTimeout.Seconds(),
+		},
+		"auth_type":        map[string]interface{}{"type": "string", "title": "Authentication", "enum": []string{"bearer", "api_key", "basic"}},
+		"auth_value":       map[string]interface{}{"type": "string", "title": "Credentials"},
+		"follow_redirects": map[string]interface{}{"type": "boolean", "title": "Follow Redirects", "default": true},
+		"max_redirects":    map[string]interface{}{"type": "integer", "title": "Max Redirects", "default": httpnode.DefaultMaxRedirects},
+		"proxy":            map[string]interface{}{"type": "string", "title": "Proxy URL"},
+		"fail_on_error":    map[string]interface{}{"type": "boolean", "title": "Fail on HTTP Errors", "default": false},
+		"max_response_bytes": map[string]interface{}{
+			"type":    "integer",
+			"title":   "Max Response Size (bytes)",
+			"default": httpnode.DefaultMaxResponseBytes,
+		},
+		"stream_to_file": map[string]interface{}{"type": "string", "title": "Stream to File"},
+	},
+}
+
+// transformerParameters is the configuration of the data transformer node.
+// Its operations and their parameters depend on the transform type.
+var transformerParameters = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"transform_type": map[string]interface{}{
+			"type":        "string",
+			"title":       "Transform",
+			"enum":        utility.TransformTypes,
+			"description": "Data passes through unchanged without a transform",
+		},
+		"mapping":    map[string]interface{}{"type": "object", "title": "Field Mapping", "description": "Output field per input field, for mapping transforms"},
+		"expression": map[string]interface{}{"type": "string", "title": "Expression", "description": "JSONPath, jq-style or gjson expression, for expression transforms"},
+		"operation": map[string]interface{}{
+			"type":        "string",
+			"title":       "Operation",
+			"enum":        utility.CustomOperations,
+			"description": "Required for custom transforms",
+		},
+		"parameters": map[string]interface{}{
+			"type":  "object",
+			"title": "Parameters",
+			"properties": map[string]interface{}{
+				"operations": map[string]interface{}{
+					"type":        "array",
+					"title":       "String Operations",
+					"description": "Applied in order by string_operations; replace requires from and to",
+					"items": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"operation"},
+						"properties": map[string]interface{}{
+							"operation": map[string]interface{}{"type": "string", "enum": utility.StringOperations},
+							"from":      map[string]interface{}{"type": "string"},
+							"to":        map[string]interface{}{"type": "string"},
+						},
+					},
+				},
+				"filters":      map[string]interface{}{"type": "array", "title": "Filters", "description": "Field conditions for filtering transforms"},
+				"separator":    map[string]interface{}{"type": "string", "title": "Key Separator", "default": "."},
+				"max_depth":    map[string]interface{}{"type": "integer", "title": "Max Depth", "default": 0},
+				"format":       map[string]interface{}{"type": "string", "title": "Format", "enum": []string{utility.FormatJSON, utility.FormatYAML, utility.FormatCSV}},
+				"header":       map[string]interface{}{"type": "boolean", "title": "CSV Header", "default": true},
+				"delimiter":    map[string]interface{}{"type": "string", "title": "CSV Delimiter", "default": ","},
+				"coerce_types": map[string]interface{}{"type": "boolean", "title": "Coerce CSV Types", "default": false},
+				"columns":      map[string]interface{}{"type": "array", "title": "CSV Columns", "items": map[string]interface{}{"type": "string"}},
+				"indent":       map[string]interface{}{"type": "string", "title": "JSON Indent"},
+			},
+		},
+	},
+}
+
+// httpResponseSchema is the output of the HTTP request node. Responses
+// streamed to a file have its path and size in place of a body.
+var httpResponseSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"status_code", "status", "headers", "method", "url", "truncated"},
+	"properties": map[string]interface{}{
+		"status_code": map[string]interface{}{"type": "integer"},
+		"status":      map[string]interface{}{"type": "string"},
+		"headers":     map[string]interface{}{"type": "object"},
+		"method":      map[string]interface{}{"type": "string"},
+		"url":         map[string]interface{}{"type": "string"},
+		"body":        map[string]interface{}{},
+		"truncated":   map[string]interface{}{"type": "boolean"},
+		"file":        map[string]interface{}{"type": "string"},
+		"size":        map[string]interface{}{"type": "integer"},
+	},
+}
+
+// RedisOptions parses redisURL, which may also be a plain host:port,
+// defaulting to a local Redis when it is empty
+func RedisOptions(redisURL string) *redis.Options {
+	if redisURL == "" {
+		return &redis.Options{Addr: "localhost:6379"}
+	}
+	if !strings.Contains(redisURL, "://") {
+		return &redis.Options{Addr: redisURL, Password: os.Getenv("REDIS_PASSWORD")}
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		log.Fatalf("Invalid REDIS_URL: %v", err)
+	}
+	return opts
+}
+
+// httpRequestOptions configures the HTTP request node from
+// CITADEL_WORKFLOW_TIMEOUT_POLICY_HTTP_TIMEOUT, the environment variable of
+// workflow.timeout_policy.http_timeout in the application config. Responses
+// are streamed to files in the local root of the storage node, and requests
+// go through the outbound circuit breakers of the process.
+func httpRequestOptions() httpnode.RequestOptions {
+	timeout, _ := time.ParseDuration(os.Getenv("CITADEL_WORKFLOW_TIMEOUT_POLICY_HTTP_TIMEOUT"))
+	return httpnode.RequestOptions{
+		Timeout:         timeout,
+		Files:           storage.NewLocalBackend(storageOptions().LocalRoot),
+		CircuitBreakers: middleware.OutboundCircuitBreakers(),
+	}
+}
+
+// scriptOptions configures the JavaScript node from
+// CITADEL_WORKFLOW_TIMEOUT_POLICY_SCRIPT_TIMEOUT, the environment variable of
+// workflow.timeout_policy.script_timeout in the application config
+func scriptOptions() utility.ScriptOptions {
+	timeout, _ := time.ParseDuration(os.Getenv("CITADEL_WORKFLOW_TIMEOUT_POLICY_SCRIPT_TIMEOUT"))
+	return utility.ScriptOptions{Timeout: timeout}
+}
+
+// wasmOptions configures the WASM node from the environment variables of
+// sandbox and worker.resource_limits.max_memory_per_task in the
+// application config
+func wasmOptions() utility.WasmOptions {
+	timeout, _ := time.ParseDuration(os.Getenv("CITADEL_SANDBOX_TIMEOUT"))
+	limits, err := resources.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid resource limits: %v", err)
+	}
+	root := os.Getenv("CITADEL_SANDBOX_WASM_ROOT")
+	if root == "" {
+		root = "data/wasm"
+	}
+	return utility.WasmOptions{
+		Timeout:   timeout,
+		MaxMemory: limits.Memory,
+		Permissions: utility.WasmPermissions{
+			FileSystem:      os.Getenv("CITADEL_SANDBOX_RUNTIME_PERMISSIONS_FILE_SYSTEM") == "true",
+			Root:            root,
+			EnvironmentVars: os.Getenv("CITADEL_SANDBOX_RUNTIME_PERMISSIONS_ENVIRONMENT_VARS") == "true",
+		},
+	}
+}
+
+// whileOptions configures the while node from CITADEL_WORKFLOW_MAX_DEPTH,
+// the environment variable of workflow.max_depth in the application config
+func whileOptions() utility.WhileOptions {
+	maxIterations, _ := strconv.Atoi(os.Getenv("CITADEL_WORKFLOW_MAX_DEPTH"))
+	return utility.WhileOptions{MaxIterations: maxIterations}
+}
+
+// execOptions configures the exec node from the environment variables of
+// sandbox and worker.resource_limits in the application config, plus
+// CITADEL_SANDBOX_IMAGE, the container image of nodes that set none, and
+// CITADEL_SANDBOX_ALLOWED_IMAGES, a comma-separated list of the others
+// nodes may choose
+func execOptions() command.ExecOptions {
+	limits, err := resources.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid resource limits: %v", err)
+	}
+	var allowedImages []string
+	for _, image := range strings.Split(os.Getenv("CITADEL_SANDBOX_ALLOWED_IMAGES"), ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			allowedImages = append(allowedImages, image)
+		}
+	}
+	return command.ExecOptions{
+		Sandbox: command.SandboxOptions{
+			Enabled:          os.Getenv("CITADEL_SANDBOX_ENABLED") == "true",
+			Type:             os.Getenv("CITADEL_SANDBOX_TYPE"),
+			ContainerRuntime: os.Getenv("CITADEL_SANDBOX_CONTAINER_RUNTIME"),
+			Image:            os.Getenv("CITADEL_SANDBOX_IMAGE"),
+			AllowedImages:    allowedImages,
+			NetworkIsolation: os.Getenv("CITADEL_SANDBOX_NETWORK_ISOLATION") == "true",
+			ReadOnlyRoot:     os.Getenv("CITADEL_SANDBOX_READ_ONLY_ROOT") == "true",
+		},
+		Limits: limits,
+	}
+}
+
+// storageOptions configures the storage node from STORAGE_ROOT (data/storage
+// by default) and the S3_ENDPOINT, S3_REGION, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY and S3_USE_SSL of an S3-compatible service such as
+// MinIO; AWS S3 is used when S3_ENDPOINT is unset
+func storageOptions() storage.Options {
+	root := os.Getenv("STORAGE_ROOT")
+	if root == "" {
+		root = "data/storage"
+	}
+	return storage.Options{
+		LocalRoot: root,
+		S3: storage.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			UseSSL:          os.Getenv("S3_USE_SSL") != "false",
+		},
+	}
+}
+
+// NewMessageBroker returns a RabbitMQ broker for amqpURL, or nil when it is
+// empty, in which case message queue nodes cannot be used
+func NewMessageBroker(amqpURL string) queue.Broker {
+	if amqpURL == "" {
+		return nil
+	}
+	return queue.NewRabbitMQBroker(amqpURL)
+}
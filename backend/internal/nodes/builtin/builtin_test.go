@@ -0,0 +1,23 @@
+package builtin
+
+import (
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecNodeIsOptIn(t *testing.T) {
+	registry := engine.NewNodeTypeRegistry()
+	Register(registry, nil)
+	_, ok := registry.GetNodeType("exec")
+	assert.False(t, ok, "commands must not run on the host unless enabled")
+	_, ok = registry.GetNodeType("http_request")
+	assert.True(t, ok)
+
+	t.Setenv("CITADEL_EXEC_ENABLED", "true")
+	registry = engine.NewNodeTypeRegistry()
+	Register(registry, nil)
+	_, ok = registry.GetNodeType("exec")
+	assert.True(t, ok)
+}
@@ -0,0 +1,335 @@
+// Package command implements the exec node, which runs external commands,
+// optionally inside a sandbox
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/pkg/resources"
+)
+
+// DefaultTimeout bounds commands without a timeout of their own
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxOutputBytes bounds the stdout and stderr kept of a command
+// unless configured otherwise
+const DefaultMaxOutputBytes = 1 << 20
+
+// ErrSandboxUnavailable is returned when a command must run sandboxed but
+// the configured sandbox cannot be used on this host
+var ErrSandboxUnavailable = errors.New("sandbox is not available")
+
+// Sandbox types, as in sandbox.type of the application config
+const (
+	// SandboxContainer runs commands in a throwaway container
+	SandboxContainer = "container"
+	// SandboxNamespace runs commands in new Linux user, PID, mount, IPC,
+	// UTS and, with network isolation, network namespaces. It does not
+	// isolate the filesystem: commands can read and write whatever the
+	// server's user can, and /proc still shows the host's processes. A
+	// read-only root needs SandboxContainer.
+	SandboxNamespace = "namespace"
+	// SandboxProcess only applies the resource limits
+	SandboxProcess = "process"
+)
+
+// SandboxOptions mirror sandbox of the application config
+type SandboxOptions struct {
+	// Enabled runs every exec node in the sandbox; otherwise only nodes
+	// asking for it with their "sandbox" setting are
+	Enabled bool
+	// Type is SandboxContainer, SandboxNamespace or SandboxProcess
+	Type string
+	// ContainerRuntime runs containers: docker or podman
+	ContainerRuntime string
+	// Image is the container image of nodes that set none
+	Image string
+	// AllowedImages are the other images nodes may choose with their
+	// "image" setting; without them every node runs in Image
+	AllowedImages    []string
+	NetworkIsolation bool
+	ReadOnlyRoot     bool
+}
+
+// ExecOptions holds the server-wide settings of exec nodes
+type ExecOptions struct {
+	Sandbox SandboxOptions
+	// Limits are the per-task limits of worker.resource_limits. They are
+	// enforced by the container runtime, or otherwise by prlimit and by
+	// resources.Enforce, which kills commands over the memory limit and
+	// throttles them to the CPU limit.
+	Limits resources.Limits
+	// Timeout bounds commands whose node sets no timeout
+	Timeout time.Duration
+}
+
+// ExecNode runs an external command. The command and its arguments are
+// passed to the process as they are, never through a shell. Commands get
+// no environment of the server but PATH and the configured variables.
+type ExecNode struct {
+	id             string
+	nodeType       string
+	command        string
+	args           []string
+	env            map[string]string
+	workingDir     string
+	stdin          string
+	image          string
+	sandbox        bool
+	failOnError    bool
+	timeout        time.Duration
+	maxOutputBytes int64
+	options        ExecOptions
+	config         map[string]interface{}
+}
+
+// Initialize sets up the exec node with configuration
+func (e *ExecNode) Initialize(config map[string]interface{}) error {
+	e.config = config
+
+	command, ok := config["command"].(string)
+	if !ok || command == "" {
+		return fmt.Errorf("command is required")
+	}
+	e.command = command
+
+	args, err := stringList(config["args"])
+	if err != nil {
+		return fmt.Errorf("args %w", err)
+	}
+	e.args = args
+
+	e.env = make(map[string]string)
+	if env, ok := config["env"]; ok {
+		envMap, ok := env.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("env must be an object")
+		}
+		for k, v := range envMap {
+			e.env[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	e.workingDir, _ = config["working_dir"].(string)
+	e.stdin, _ = config["stdin"].(string)
+	e.image, _ = config["image"].(string)
+	if e.image == "" {
+		e.image = e.options.Sandbox.Image
+	} else if e.image != e.options.Sandbox.Image && !slices.Contains(e.options.Sandbox.AllowedImages, e.image) {
+		return fmt.Errorf("image %q is not one of the allowed sandbox images", e.image)
+	}
+	e.failOnError, _ = config["fail_on_error"].(bool)
+
+	e.sandbox = e.options.Sandbox.Enabled
+	if sandbox, ok := config["sandbox"]; ok {
+		s, ok := sandbox.(bool)
+		if !ok {
+			return fmt.Errorf("sandbox must be a boolean")
+		}
+		if !s && e.options.Sandbox.Enabled {
+			return fmt.Errorf("sandbox cannot be turned off, it is enabled for all exec nodes")
+		}
+		e.sandbox = s
+	}
+
+	e.timeout = e.options.Timeout
+	if e.timeout <= 0 {
+		e.timeout = DefaultTimeout
+	}
+	if timeout, ok := config["timeout"]; ok {
+		t, ok := timeout.(float64)
+		if !ok || t <= 0 {
+			return fmt.Errorf("timeout must be a positive number of seconds")
+		}
+		e.timeout = time.Duration(t * float64(time.Second))
+	}
+
+	e.maxOutputBytes = DefaultMaxOutputBytes
+	if maxOutput, ok := config["max_output_bytes"]; ok {
+		n, ok := maxOutput.(float64)
+		if !ok || n < 1 || n != float64(int64(n)) {
+			return fmt.Errorf("max_output_bytes must be a positive number of bytes")
+		}
+		e.maxOutputBytes = int64(n)
+	}
+
+	return nil
+}
+
+// Execute runs the command. The "args" input is appended to the configured
+// arguments and the "stdin" input replaces the configured stdin. A non-zero
+// exit code only fails the node with fail_on_error set.
+func (e *ExecNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	args := append([]string(nil), e.args...)
+	if inputArgs, ok := inputs["args"]; ok {
+		extra, err := stringList(inputArgs)
+		if err != nil {
+			return nil, fmt.Errorf("args %w", err)
+		}
+		args = append(args, extra...)
+	}
+	stdin := e.stdin
+	if s, ok := inputs["stdin"].(string); ok {
+		stdin = s
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	cmd, err := e.buildCommand(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout := &limitedBuffer{max: e.maxOutputBytes}
+	stderr := &limitedBuffer{max: e.maxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	violation, err := e.run(ctx, cmd)
+	duration := time.Since(start)
+
+	var exitErr *exec.ExitError
+	switch {
+	case violation != nil:
+		return nil, fmt.Errorf("command was killed: %w", violation)
+	case ctx.Err() != nil:
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("command timed out after %s: %w", e.timeout, ctx.Err())
+		}
+		return nil, ctx.Err()
+	case errors.As(err, &exitErr):
+		if e.failOnError {
+			return nil, fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+	case err != nil:
+		if e.sandbox && e.options.Sandbox.Type == SandboxNamespace && isNamespaceError(err) {
+			return nil, fmt.Errorf("%w: %v", ErrSandboxUnavailable, err)
+		}
+		return nil, fmt.Errorf("failed to run command: %w", err)
+	}
+
+	return map[string]interface{}{
+		"stdout":      stdout.String(),
+		"stderr":      stderr.String(),
+		"exit_code":   cmd.ProcessState.ExitCode(),
+		"truncated":   stdout.truncated || stderr.truncated,
+		"duration_ms": duration.Milliseconds(),
+	}, nil
+}
+
+// run runs cmd, keeping it within the resource limits unless it runs in a
+// container, whose runtime enforces them. It returns the violation of the
+// limits that got the command killed, if any, and the error of the command.
+func (e *ExecNode) run(ctx context.Context, cmd *exec.Cmd) (violation, err error) {
+	limits := e.options.Limits
+	if (e.sandbox && e.options.Sandbox.Type == SandboxContainer) || (limits.Memory <= 0 && limits.CPU <= 0) {
+		return nil, cmd.Run()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	enforceCtx, stopEnforcing := context.WithCancel(ctx)
+	enforced := make(chan error, 1)
+	go func() {
+		enforced <- resources.Enforce(enforceCtx, cmd.Process.Pid, limits)
+	}()
+
+	err = cmd.Wait()
+	stopEnforcing()
+	return <-enforced, err
+}
+
+// environment returns the environment of commands
+func (e *ExecNode) environment() []string {
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	for k, v := range e.env {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// stringList converts a list of strings from the configuration
+func stringList(value interface{}) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+	list := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+		list[i] = s
+	}
+	return list, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the
+// rest, so that a chatty command is not stopped by a broken pipe
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.buf.Len()); int64(len(p)) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// GetType returns the type of the node
+func (e *ExecNode) GetType() string {
+	return e.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (e *ExecNode) GetID() string {
+	return e.id
+}
+
+// NewExecNode creates a new exec node with the default options
+func NewExecNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return NewExecNodeWithOptions(ExecOptions{})(config)
+}
+
+// NewExecNodeWithOptions returns the constructor of exec nodes using
+// options
+func NewExecNodeWithOptions(options ExecOptions) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &ExecNode{
+			id:       fmt.Sprintf("exec_%d", time.Now().UnixNano()),
+			nodeType: "exec",
+			options:  options,
+		}
+
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	}
+}
@@ -0,0 +1,224 @@
+package command
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/pkg/resources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("tests run POSIX commands")
+	}
+}
+
+func TestExecNodeRunsCommand(t *testing.T) {
+	requireShell(t)
+	node, err := NewExecNode(map[string]interface{}{
+		"command": "echo",
+		// Arguments reach the command as they are, never through a shell
+		"args": []interface{}{"hello", "$HOME; rm -rf /"},
+	})
+	require.NoError(t, err)
+
+	outputs, err := node.Execute(context.Background(), map[string]interface{}{
+		"args": []interface{}{"`id`"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello $HOME; rm -rf / `id`\n", outputs["stdout"])
+	assert.Equal(t, "", outputs["stderr"])
+	assert.Equal(t, 0, outputs["exit_code"])
+	assert.Equal(t, false, outputs["truncated"])
+}
+
+func TestExecNodeEnvironmentAndStdin(t *testing.T) {
+	requireShell(t)
+	t.Setenv("CITADEL_EXEC_SECRET", "leaked")
+	node, err := NewExecNode(map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", `cat; echo "$GREETING${CITADEL_EXEC_SECRET}"`},
+		"env":     map[string]interface{}{"GREETING": "hi"},
+	})
+	require.NoError(t, err)
+
+	outputs, err := node.Execute(context.Background(), map[string]interface{}{"stdin": "from stdin\n"})
+	require.NoError(t, err)
+	assert.Equal(t, "from stdin\nhi\n", outputs["stdout"])
+}
+
+func TestExecNodeNonZeroExit(t *testing.T) {
+	requireShell(t)
+	config := map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", "echo failing >&2; exit 3"},
+	}
+	node, err := NewExecNode(config)
+	require.NoError(t, err)
+
+	outputs, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, outputs["exit_code"])
+	assert.Equal(t, "failing\n", outputs["stderr"])
+
+	config["fail_on_error"] = true
+	node, err = NewExecNode(config)
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited with code 3: failing")
+}
+
+func TestExecNodeTimeout(t *testing.T) {
+	requireShell(t)
+	// The child keeps the output open, so the whole process group must die
+	node, err := NewExecNode(map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", "sleep 10 & sleep 10"},
+		"timeout": 0.1,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecNodeOutputLimit(t *testing.T) {
+	requireShell(t)
+	node, err := NewExecNode(map[string]interface{}{
+		"command":          "sh",
+		"args":             []interface{}{"-c", "for i in $(seq 1000); do echo 0123456789; done"},
+		"max_output_bytes": float64(25),
+	})
+	require.NoError(t, err)
+
+	outputs, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789\n0123456789\n012", outputs["stdout"])
+	assert.Equal(t, true, outputs["truncated"])
+	assert.Equal(t, 0, outputs["exit_code"])
+}
+
+func TestExecNodeConfigValidation(t *testing.T) {
+	for name, config := range map[string]map[string]interface{}{
+		"missing command":  {},
+		"args not strings": {"command": "echo", "args": []interface{}{1.0}},
+		"bad timeout":      {"command": "echo", "timeout": -1.0},
+		"bad output limit": {"command": "echo", "max_output_bytes": 0.5},
+	} {
+		_, err := NewExecNode(config)
+		assert.Error(t, err, name)
+	}
+
+	// Sandboxing enabled for all nodes cannot be opted out of
+	_, err := NewExecNodeWithOptions(ExecOptions{
+		Sandbox: SandboxOptions{Enabled: true, Type: SandboxProcess},
+	})(map[string]interface{}{"command": "echo", "sandbox": false})
+	assert.Error(t, err)
+}
+
+func TestExecNodeRefusesUnavailableSandbox(t *testing.T) {
+	requireShell(t)
+	for name, sandbox := range map[string]SandboxOptions{
+		"missing runtime": {Enabled: true, Type: SandboxContainer, ContainerRuntime: "citadel-missing-runtime", Image: "alpine"},
+		"unknown type":    {Enabled: true, Type: "vm"},
+		"read-only root":  {Enabled: true, Type: SandboxNamespace, ReadOnlyRoot: true},
+	} {
+		node, err := NewExecNodeWithOptions(ExecOptions{Sandbox: sandbox})(map[string]interface{}{"command": "echo"})
+		require.NoError(t, err, name)
+		_, err = node.Execute(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrSandboxUnavailable, name)
+	}
+}
+
+func TestExecNodeRejectsContainerImages(t *testing.T) {
+	options := ExecOptions{Sandbox: SandboxOptions{
+		Enabled:          true,
+		Type:             SandboxContainer,
+		ContainerRuntime: "citadel-missing-runtime",
+		Image:            "alpine:3.20",
+		AllowedImages:    []string{"registry.example.com:5000/tools/curl@sha256:" + strings.Repeat("a", 64)},
+	}}
+	for _, image := range []string{"--privileged", "-v=/:/host", "ubuntu:latest"} {
+		_, err := NewExecNodeWithOptions(options)(map[string]interface{}{"command": "echo", "image": image})
+		assert.ErrorContains(t, err, "not one of the allowed sandbox images", image)
+	}
+
+	node, err := NewExecNodeWithOptions(options)(map[string]interface{}{"command": "echo", "image": options.Sandbox.AllowedImages[0]})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrSandboxUnavailable)
+
+	// Flag-shaped images are refused even when configured on the server
+	options.Sandbox.Image = "--privileged"
+	node, err = NewExecNodeWithOptions(options)(map[string]interface{}{"command": "echo"})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.EqualError(t, err, `invalid container image "--privileged"`)
+}
+
+func TestExecNodeNamespaceSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("namespaces are Linux only")
+	}
+	node, err := NewExecNodeWithOptions(ExecOptions{
+		Sandbox: SandboxOptions{Type: SandboxNamespace, NetworkIsolation: true},
+	})(map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", "echo $$"},
+		"sandbox": true,
+	})
+	require.NoError(t, err)
+
+	outputs, err := node.Execute(context.Background(), nil)
+	if err != nil {
+		require.ErrorIs(t, err, ErrSandboxUnavailable)
+		t.Skip("user namespaces are not available:", err)
+	}
+	// The command is the first process of its PID namespace
+	assert.Equal(t, "1\n", outputs["stdout"])
+}
+
+func TestExecNodeMemoryLimit(t *testing.T) {
+	requireShell(t)
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		t.Skip("prlimit is not installed")
+	}
+	node, err := NewExecNodeWithOptions(ExecOptions{
+		Limits: resources.Limits{Memory: 256 << 20},
+	})(map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", "ulimit -v"},
+	})
+	require.NoError(t, err)
+
+	outputs, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "262144", strings.TrimSpace(outputs["stdout"].(string)))
+}
+
+func TestExecNodeCPULimit(t *testing.T) {
+	requireShell(t)
+	node, err := NewExecNodeWithOptions(ExecOptions{
+		Limits: resources.Limits{CPU: 0.25},
+	})(map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", "echo hello"},
+	})
+	require.NoError(t, err)
+
+	// Commands within their limits run as usual
+	outputs, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", outputs["stdout"])
+	assert.Equal(t, 0, outputs["exit_code"])
+}
@@ -0,0 +1,111 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// imageReference matches container image references: an optional registry
+// host, lowercase path components, and an optional tag and digest
+var imageReference = regexp.MustCompile(`^` +
+	`(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?/)?` +
+	`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+	`(?::[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+
+// waitDelay is how long commands get to close their output after they
+// were killed, for children that inherited it
+const waitDelay = time.Second
+
+// buildCommand prepares the command for running, in the sandbox when the
+// node runs sandboxed
+func (e *ExecNode) buildCommand(ctx context.Context, args []string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if e.sandbox && e.options.Sandbox.Type == SandboxContainer {
+		var err error
+		if cmd, err = e.containerCommand(ctx, args); err != nil {
+			return nil, err
+		}
+	} else {
+		if e.sandbox && e.options.Sandbox.Type != SandboxNamespace && e.options.Sandbox.Type != SandboxProcess {
+			return nil, fmt.Errorf("%w: unknown sandbox type %q", ErrSandboxUnavailable, e.options.Sandbox.Type)
+		}
+		if e.sandbox && e.options.Sandbox.ReadOnlyRoot {
+			return nil, fmt.Errorf("%w: a read-only root needs the container sandbox", ErrSandboxUnavailable)
+		}
+
+		name, commandArgs := e.command, args
+		if memory := e.options.Limits.Memory; memory > 0 {
+			prlimit, err := exec.LookPath("prlimit")
+			if err == nil {
+				name, commandArgs = prlimit, append([]string{"--as=" + strconv.FormatInt(memory, 10), "--", e.command}, args...)
+			} else if e.sandbox {
+				return nil, fmt.Errorf("%w: prlimit is needed to limit memory", ErrSandboxUnavailable)
+			}
+		}
+		cmd = exec.CommandContext(ctx, name, commandArgs...)
+		cmd.Env = e.environment()
+		cmd.Dir = e.workingDir
+		if err := isolate(cmd, e.sandbox && e.options.Sandbox.Type == SandboxNamespace, e.options.Sandbox.NetworkIsolation); err != nil {
+			return nil, err
+		}
+	}
+	cmd.WaitDelay = waitDelay
+	return cmd, nil
+}
+
+// containerCommand runs the command in a throwaway container, which is
+// killed along with the runtime client when ctx is done
+func (e *ExecNode) containerCommand(ctx context.Context, args []string) (*exec.Cmd, error) {
+	runtime := e.options.Sandbox.ContainerRuntime
+	if runtime == "" {
+		runtime = "docker"
+	}
+	if e.image == "" {
+		return nil, fmt.Errorf("image is required to run in a container")
+	}
+	// The runtime would take an image such as "--privileged" for a flag
+	if !imageReference.MatchString(e.image) {
+		return nil, fmt.Errorf("invalid container image %q", e.image)
+	}
+	runtimePath, err := exec.LookPath(runtime)
+	if err != nil {
+		return nil, fmt.Errorf("%w: container runtime %s not found", ErrSandboxUnavailable, runtime)
+	}
+
+	name := fmt.Sprintf("citadel-exec-%d", time.Now().UnixNano())
+	runArgs := []string{"run", "--rm", "-i", "--name", name}
+	if e.options.Sandbox.NetworkIsolation {
+		runArgs = append(runArgs, "--network", "none")
+	}
+	if e.options.Sandbox.ReadOnlyRoot {
+		runArgs = append(runArgs, "--read-only")
+	}
+	if memory := e.options.Limits.Memory; memory > 0 {
+		runArgs = append(runArgs, "--memory", strconv.FormatInt(memory, 10))
+	}
+	if cpu := e.options.Limits.CPU; cpu > 0 {
+		runArgs = append(runArgs, "--cpus", strconv.FormatFloat(cpu, 'f', -1, 64))
+	}
+	if e.workingDir != "" {
+		runArgs = append(runArgs, "--workdir="+e.workingDir)
+	}
+	for k, v := range e.env {
+		runArgs = append(runArgs, "--env="+k+"="+v)
+	}
+	runArgs = append(runArgs, e.image, e.command)
+	runArgs = append(runArgs, args...)
+
+	cmd := exec.CommandContext(ctx, runtimePath, runArgs...)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	cmd.Cancel = func() error {
+		// Killing the client leaves the container running
+		exec.Command(runtimePath, "kill", name).Run()
+		return cmd.Process.Kill()
+	}
+	return cmd, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package command
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// isolate refuses namespaced commands, which need Linux
+func isolate(cmd *exec.Cmd, namespaced, isolateNetwork bool) error {
+	if namespaced {
+		return fmt.Errorf("%w: namespaces need Linux", ErrSandboxUnavailable)
+	}
+	return nil
+}
+
+// isNamespaceError is false without namespaces
+func isNamespaceError(err error) bool {
+	return false
+}
@@ -1,12 +1,10 @@
 package communication
 
 import (
-	"crypto/tls"
-	"fmt"
-	"net/smtp"
 	"time"
 
 	"citadel-agent/backend/internal/nodes/base"
+	"citadel-agent/backend/pkg/mailer"
 )
 
 // EmailNode implements email sending
@@ -140,71 +138,17 @@ func (n *EmailNode) Execute(ctx *base.ExecutionContext, inputs map[string]interf
 		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
 
-	// Build email message
-	message := fmt.Sprintf("From: %s\r\n", config.From)
-	message += fmt.Sprintf("To: %s\r\n", config.To[0])
-	message += fmt.Sprintf("Subject: %s\r\n", config.Subject)
-	message += "\r\n" + config.Body
-
-	// Setup authentication
-	auth := smtp.PlainAuth("", config.Username, config.Password, config.SMTPHost)
-
-	// Send email
-	addr := fmt.Sprintf("%s:%d", config.SMTPHost, config.SMTPPort)
-
-	var err error
-	if config.UseTLS {
-		// TLS connection
-		tlsConfig := &tls.Config{
-			ServerName: config.SMTPHost,
-		}
-
-		conn, err := tls.Dial("tcp", addr, tlsConfig)
-		if err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-		defer conn.Close()
-
-		client, err := smtp.NewClient(conn, config.SMTPHost)
-		if err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-		defer client.Quit()
-
-		if err = client.Auth(auth); err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-
-		if err = client.Mail(config.From); err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-
-		for _, to := range config.To {
-			if err = client.Rcpt(to); err != nil {
-				return base.CreateErrorResult(err, time.Since(startTime)), err
-			}
-		}
-
-		w, err := client.Data()
-		if err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-
-		_, err = w.Write([]byte(message))
-		if err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-
-		err = w.Close()
-		if err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
-	} else {
-		// Plain SMTP
-		err = smtp.SendMail(addr, auth, config.From, config.To, []byte(message))
-		if err != nil {
-			return base.CreateErrorResult(err, time.Since(startTime)), err
-		}
+	mailerConfig := mailer.Config{
+		Host:     config.SMTPHost,
+		Port:     config.SMTPPort,
+		Username: config.Username,
+		Password: config.Password,
+		From:     config.From,
+		UseTLS:   config.UseTLS,
+	}
+	message := mailer.Message{To: config.To, Subject: config.Subject, Body: config.Body}
+	if err := mailerConfig.Send(ctx.Context, message); err != nil {
+		return base.CreateErrorResult(err, time.Since(startTime)), err
 	}
 
 	result := map[string]interface{}{
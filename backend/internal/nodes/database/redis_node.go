@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Operations of the redis node
+const (
+	RedisGet     = "get"
+	RedisSet     = "set"
+	RedisDel     = "del"
+	RedisIncr    = "incr"
+	RedisLPush   = "lpush"
+	RedisRPop    = "rpop"
+	RedisPublish = "publish"
+)
+
+// RedisOperationNode runs one Redis command per execution. All redis nodes
+// built by the same NewRedisNode constructor share its connection pool.
+//
+// Reading a missing key (get, or rpop on an empty list) is not an error: the
+// output has found=false and a nil value. Connection and command failures
+// are returned as errors.
+type RedisOperationNode struct {
+	id           string
+	nodeType     string
+	client       *redis.Client
+	operation    string
+	key          string
+	value        interface{}
+	channel      string
+	ttl          time.Duration
+	onlyIfAbsent bool
+	by           int64
+	config       map[string]interface{}
+}
+
+// Initialize sets up the redis node with configuration. "key" and "value"
+// (and "channel" for publish) may also come from the input, which takes
+// precedence.
+func (rn *RedisOperationNode) Initialize(config map[string]interface{}) error {
+	rn.config = config
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case RedisGet, RedisSet, RedisDel, RedisIncr, RedisLPush, RedisRPop, RedisPublish:
+		rn.operation = operation
+	default:
+		return fmt.Errorf("operation must be one of get, set, del, incr, lpush, rpop or publish, got %q", operation)
+	}
+
+	if key, ok := config["key"]; ok {
+		k, ok := key.(string)
+		if !ok {
+			return fmt.Errorf("key must be a string")
+		}
+		rn.key = k
+	}
+	if channel, ok := config["channel"]; ok {
+		c, ok := channel.(string)
+		if !ok {
+			return fmt.Errorf("channel must be a string")
+		}
+		rn.channel = c
+	}
+	rn.value = config["value"]
+
+	if ttl, ok := config["ttl"]; ok {
+		seconds, ok := ttl.(float64)
+		if !ok || seconds < 0 {
+			return fmt.Errorf("ttl must be a non-negative number of seconds")
+		}
+		rn.ttl = time.Duration(seconds * float64(time.Second))
+	}
+
+	if onlyIfAbsent, ok := config["only_if_absent"]; ok {
+		b, ok := onlyIfAbsent.(bool)
+		if !ok {
+			return fmt.Errorf("only_if_absent must be a boolean")
+		}
+		rn.onlyIfAbsent = b
+	}
+
+	rn.by = 1
+	if by, ok := config["by"]; ok {
+		n, ok := by.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("by must be an integer")
+		}
+		rn.by = int64(n)
+	}
+
+	return nil
+}
+
+// Execute runs the configured command
+func (rn *RedisOperationNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	key := rn.key
+	if k, ok := inputs["key"].(string); ok && k != "" {
+		key = k
+	}
+	value := rn.value
+	if v, ok := inputs["value"]; ok {
+		value = v
+	}
+
+	if rn.operation == RedisPublish {
+		channel := rn.channel
+		if c, ok := inputs["channel"].(string); ok && c != "" {
+			channel = c
+		}
+		if channel == "" {
+			return nil, nodeerrors.NewValidationError("publish requires a channel", nil)
+		}
+		message, err := redisValue(value)
+		if err != nil {
+			return nil, err
+		}
+		receivers, err := rn.client.Publish(ctx, channel, message).Result()
+		if err != nil {
+			return nil, redisError("redis publish failed", err)
+		}
+		return map[string]interface{}{"channel": channel, "receivers": receivers}, nil
+	}
+
+	if key == "" {
+		return nil, nodeerrors.NewValidationError(rn.operation+" requires a key", nil)
+	}
+
+	switch rn.operation {
+	case RedisGet:
+		value, err := rn.client.Get(ctx, key).Result()
+		return found(key, value, err)
+
+	case RedisSet:
+		v, err := redisValue(value)
+		if err != nil {
+			return nil, err
+		}
+		stored := true
+		if rn.onlyIfAbsent {
+			stored, err = rn.client.SetNX(ctx, key, v, rn.ttl).Result()
+		} else {
+			err = rn.client.Set(ctx, key, v, rn.ttl).Err()
+		}
+		if err != nil {
+			return nil, redisError("redis set failed", err)
+		}
+		return map[string]interface{}{"key": key, "stored": stored}, nil
+
+	case RedisDel:
+		deleted, err := rn.client.Del(ctx, key).Result()
+		if err != nil {
+			return nil, redisError("redis del failed", err)
+		}
+		return map[string]interface{}{"key": key, "deleted": deleted}, nil
+
+	case RedisIncr:
+		n, err := rn.client.IncrBy(ctx, key, rn.by).Result()
+		if err != nil {
+			return nil, redisError("redis incr failed", err)
+		}
+		return map[string]interface{}{"key": key, "value": n}, nil
+
+	case RedisLPush:
+		v, err := redisValue(value)
+		if err != nil {
+			return nil, err
+		}
+		length, err := rn.client.LPush(ctx, key, v).Result()
+		if err != nil {
+			return nil, redisError("redis lpush failed", err)
+		}
+		return map[string]interface{}{"key": key, "length": length}, nil
+
+	case RedisRPop:
+		value, err := rn.client.RPop(ctx, key).Result()
+		return found(key, value, err)
+	}
+
+	return nil, fmt.Errorf("unsupported operation: %s", rn.operation)
+}
+
+// found builds the output of a read, where a missing key is not an error
+func found(key, value string, err error) (map[string]interface{}, error) {
+	if errors.Is(err, redis.Nil) {
+		return map[string]interface{}{"key": key, "found": false, "value": nil}, nil
+	}
+	if err != nil {
+		return nil, redisError("redis read failed", err)
+	}
+	return map[string]interface{}{"key": key, "found": true, "value": value}, nil
+}
+
+// redisError classifies the error of a command: refused credentials, a
+// server that cannot take commands right now, a command the server
+// rejected, or else a failure to reach the server
+func redisError(message string, err error) error {
+	switch {
+	case redis.IsAuthError(err), redis.IsPermissionError(err):
+		return nodeerrors.NewAuthError(message, err)
+	case redis.IsLoadingError(err), redis.IsOOMError(err), redis.IsMaxClientsError(err),
+		redis.IsTryAgainError(err), redis.IsClusterDownError(err), redis.IsMasterDownError(err):
+		return nodeerrors.NewResourceError(message, err)
+	}
+	var serverErr redis.Error
+	if errors.As(err, &serverErr) {
+		return nodeerrors.NewValidationError(message, err)
+	}
+	return nodeerrors.FromTransport(message, err)
+}
+
+// redisValue converts a value to what is stored: strings as they are and
+// anything else as JSON
+func redisValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nodeerrors.NewValidationError("a value is required", nil)
+	case string:
+		return v, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", nodeerrors.NewValidationError("value cannot be encoded", err)
+		}
+		return string(data), nil
+	}
+}
+
+// HasSideEffects reports whether the operation writes, as all but get do
+func (rn *RedisOperationNode) HasSideEffects() bool {
+	return rn.operation != RedisGet
+}
+
+// GetType returns the type of the node
+func (rn *RedisOperationNode) GetType() string {
+	return rn.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (rn *RedisOperationNode) GetID() string {
+	return rn.id
+}
+
+// NewRedisNode returns the constructor of redis nodes connecting with
+// options, e.g. config.RedisConfig.GetRedisOptions(). The client is created
+// on first use and shared by the nodes it constructs.
+func NewRedisNode(options *redis.Options) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	var once sync.Once
+	var client *redis.Client
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		once.Do(func() { client = redis.NewClient(options) })
+
+		node := &RedisOperationNode{
+			id:       fmt.Sprintf("redis_%d", time.Now().UnixNano()),
+			nodeType: "redis",
+			client:   client,
+		}
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
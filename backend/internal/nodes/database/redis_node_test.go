@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisNodeOperations(t *testing.T) {
+	server := miniredis.RunT(t)
+	newNode := NewRedisNode(&redis.Options{Addr: server.Addr()})
+	run := func(config map[string]interface{}, inputs map[string]interface{}) (map[string]interface{}, error) {
+		node, err := newNode(config)
+		require.NoError(t, err)
+		return node.Execute(context.Background(), inputs)
+	}
+	exec := func(config map[string]interface{}) map[string]interface{} {
+		out, err := run(config, nil)
+		require.NoError(t, err)
+		return out
+	}
+
+	out := exec(map[string]interface{}{"operation": "get", "key": "missing"})
+	assert.Equal(t, false, out["found"])
+	assert.Nil(t, out["value"])
+
+	out = exec(map[string]interface{}{"operation": "set", "key": "greeting", "value": "hello", "ttl": 60.0})
+	assert.Equal(t, true, out["stored"])
+	assert.Equal(t, time.Minute, server.TTL("greeting"))
+	out = exec(map[string]interface{}{"operation": "get", "key": "greeting"})
+	assert.Equal(t, true, out["found"])
+	assert.Equal(t, "hello", out["value"])
+
+	// Deduplication: only the first set of a key succeeds
+	dedupe := map[string]interface{}{"operation": "set", "value": "seen", "only_if_absent": true}
+	out, err := run(dedupe, map[string]interface{}{"key": "order:1"})
+	require.NoError(t, err)
+	assert.Equal(t, true, out["stored"])
+	out, err = run(dedupe, map[string]interface{}{"key": "order:1"})
+	require.NoError(t, err)
+	assert.Equal(t, false, out["stored"])
+
+	exec(map[string]interface{}{"operation": "incr", "key": "counter"})
+	out = exec(map[string]interface{}{"operation": "incr", "key": "counter", "by": 5.0})
+	assert.Equal(t, int64(6), out["value"])
+
+	out = exec(map[string]interface{}{"operation": "del", "key": "counter"})
+	assert.Equal(t, int64(1), out["deleted"])
+
+	// Lists are queues: lpush then rpop returns items oldest first
+	exec(map[string]interface{}{"operation": "lpush", "key": "jobs", "value": map[string]interface{}{"id": 1.0}})
+	out = exec(map[string]interface{}{"operation": "lpush", "key": "jobs", "value": "second"})
+	assert.Equal(t, int64(2), out["length"])
+	out = exec(map[string]interface{}{"operation": "rpop", "key": "jobs"})
+	assert.Equal(t, `{"id":1}`, out["value"])
+	exec(map[string]interface{}{"operation": "rpop", "key": "jobs"})
+	out = exec(map[string]interface{}{"operation": "rpop", "key": "jobs"})
+	assert.Equal(t, false, out["found"])
+
+	subscriber := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer subscriber.Close()
+	sub := subscriber.Subscribe(context.Background(), "events")
+	defer sub.Close()
+	_, err = sub.Receive(context.Background())
+	require.NoError(t, err)
+	out = exec(map[string]interface{}{"operation": "publish", "channel": "events", "value": "ping"})
+	assert.Equal(t, int64(1), out["receivers"])
+}
+
+func TestRedisNodeErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	newNode := NewRedisNode(&redis.Options{Addr: server.Addr()})
+
+	_, err := newNode(map[string]interface{}{"operation": "flushall"})
+	assert.Error(t, err)
+	_, err = newNode(map[string]interface{}{"operation": "set", "ttl": -1.0})
+	assert.Error(t, err)
+
+	node, err := newNode(map[string]interface{}{"operation": "get"})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorContains(t, err, "requires a key")
+
+	// A server failure is an error, unlike a missing key
+	node, err = newNode(map[string]interface{}{"operation": "get", "key": "k"})
+	require.NoError(t, err)
+	server.SetError("LOADING")
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorContains(t, err, "redis read failed")
+}
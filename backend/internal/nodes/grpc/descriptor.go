@@ -0,0 +1,140 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// parseDescriptorSet decodes a base64 encoded FileDescriptorSet, as written
+// by protoc --descriptor_set_out --include_imports
+func parseDescriptorSet(encoded string) (*protoregistry.Files, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor_set must be base64 encoded: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("descriptor_set is not a FileDescriptorSet: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor_set is invalid: %w", err)
+	}
+	return files, nil
+}
+
+// reflectFiles asks the server, through gRPC server reflection, for the file
+// defining service and the files it depends on
+func reflectFiles(ctx context.Context, conn grpc.ClientConnInterface, service string) (*protoregistry.Files, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	request := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	var pending []string
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, reflectionError(stream, err)
+		}
+		response, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if errResponse := response.GetErrorResponse(); errResponse != nil {
+			return nil, fmt.Errorf("server reflection failed: %s", errResponse.GetErrorMessage())
+		}
+
+		// The server may send a file together with some of its dependencies
+		for _, data := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, file); err != nil {
+				return nil, fmt.Errorf("server reflection returned an invalid descriptor: %w", err)
+			}
+			if seen[file.GetName()] {
+				continue
+			}
+			seen[file.GetName()] = true
+			set.File = append(set.File, file)
+			pending = append(pending, file.GetDependency()...)
+		}
+
+		request = nil
+		for len(pending) > 0 && request == nil {
+			name := pending[0]
+			pending = pending[1:]
+			if seen[name] {
+				continue
+			}
+			// Well-known types are compiled in, so they need no round trip
+			if known, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil {
+				seen[name] = true
+				set.File = append(set.File, protodesc.ToFileDescriptorProto(known))
+				pending = append(pending, fileImports(known)...)
+				continue
+			}
+			request = &reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			}
+		}
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("server reflection returned invalid descriptors: %w", err)
+	}
+	return files, nil
+}
+
+// reflectionError returns the status of a reflection stream that failed to
+// send, which gRPC reports by Recv
+func reflectionError(stream reflectionpb.ServerReflection_ServerReflectionInfoClient, err error) error {
+	if err != io.EOF {
+		return err
+	}
+	_, err = stream.Recv()
+	return err
+}
+
+func fileImports(file protoreflect.FileDescriptor) []string {
+	imports := make([]string, file.Imports().Len())
+	for i := range imports {
+		imports[i] = file.Imports().Get(i).Path()
+	}
+	return imports
+}
+
+// findMethod looks up the method of a service in files
+func findMethod(files *protoregistry.Files, service, method string) (protoreflect.MethodDescriptor, error) {
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", service)
+	}
+	sd, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, method)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s/%s is streaming; only unary calls are supported", service, method)
+	}
+	return md, nil
+}
@@ -0,0 +1,269 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCNode performs a unary gRPC call. The request and response messages
+// are described by the configured descriptor_set or, without one, fetched
+// from the server through gRPC server reflection.
+//
+// The request is JSON in the protobuf JSON mapping; the response is
+// returned the same way, with fields named as in the .proto file. Calls
+// carry the deadline of the node execution (see engine.TimeoutPolicy),
+// shortened by the timeout config when set.
+type GRPCNode struct {
+	id        string
+	nodeType  string
+	target    string
+	service   string
+	method    string
+	request   interface{}
+	files     *protoregistry.Files
+	tlsConfig *tls.Config
+	metadata  map[string]string
+	timeout   time.Duration
+	config    map[string]interface{}
+}
+
+// Initialize sets up the gRPC node with configuration
+func (g *GRPCNode) Initialize(config map[string]interface{}) error {
+	g.config = config
+
+	target, ok := config["target"].(string)
+	if !ok || target == "" {
+		return fmt.Errorf("target is required")
+	}
+	g.target = target
+
+	method, _ := config["method"].(string)
+	service, name, err := splitMethod(method)
+	if err != nil {
+		return err
+	}
+	g.service, g.method = service, name
+
+	g.request = config["request"]
+
+	if set, ok := config["descriptor_set"]; ok {
+		encoded, ok := set.(string)
+		if !ok {
+			return fmt.Errorf("descriptor_set must be a string")
+		}
+		files, err := parseDescriptorSet(encoded)
+		if err != nil {
+			return err
+		}
+		if _, err := findMethod(files, g.service, g.method); err != nil {
+			return err
+		}
+		g.files = files
+	}
+
+	if useTLS, _ := config["tls"].(bool); useTLS {
+		g.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if serverName, ok := config["server_name"].(string); ok {
+			g.tlsConfig.ServerName = serverName
+		}
+		if skip, ok := config["insecure_skip_verify"].(bool); ok {
+			g.tlsConfig.InsecureSkipVerify = skip
+		}
+	}
+
+	g.metadata, err = metadataStrings(config["metadata"])
+	if err != nil {
+		return err
+	}
+
+	if timeout, ok := config["timeout"]; ok {
+		t, ok := timeout.(float64)
+		if !ok || t <= 0 {
+			return fmt.Errorf("timeout must be a positive number of seconds")
+		}
+		g.timeout = time.Duration(t * float64(time.Second))
+	}
+
+	return nil
+}
+
+// splitMethod splits a method name given as "package.Service/Method",
+// optionally with a leading slash, or as "package.Service.Method"
+func splitMethod(method string) (service, name string, err error) {
+	method = strings.TrimPrefix(method, "/")
+	i := strings.LastIndex(method, "/")
+	if i < 0 {
+		i = strings.LastIndex(method, ".")
+	}
+	if i <= 0 || i == len(method)-1 {
+		return "", "", fmt.Errorf("method must be given as package.Service/Method, got %q", method)
+	}
+	return method[:i], method[i+1:], nil
+}
+
+// metadataStrings converts a metadata object to header values
+func metadataStrings(value interface{}) (map[string]string, error) {
+	md := make(map[string]string)
+	if value == nil {
+		return md, nil
+	}
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("metadata must be an object")
+	}
+	for key, v := range values {
+		if s, ok := v.(string); ok {
+			md[strings.ToLower(key)] = s
+		} else {
+			md[strings.ToLower(key)] = fmt.Sprintf("%v", v)
+		}
+	}
+	return md, nil
+}
+
+// Execute performs the call. The "request" input replaces the configured
+// request and the "metadata" input is added to the configured metadata.
+func (g *GRPCNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	request := g.request
+	if r, ok := inputs["request"]; ok {
+		request = r
+	}
+	md, err := metadataStrings(inputs["metadata"])
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range g.metadata {
+		if _, ok := md[key]; !ok {
+			md[key] = value
+		}
+	}
+
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	creds := insecure.NewCredentials()
+	if g.tlsConfig != nil {
+		creds = credentials.NewTLS(g.tlsConfig)
+	}
+	conn, err := grpc.NewClient(g.target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %s: %w", g.target, err)
+	}
+	defer conn.Close()
+
+	files := g.files
+	if files == nil {
+		if files, err = reflectFiles(ctx, conn, g.service); err != nil {
+			return nil, callError("server reflection of "+g.service, err)
+		}
+	}
+	method, err := findMethod(files, g.service, g.method)
+	if err != nil {
+		return nil, err
+	}
+
+	req := dynamicpb.NewMessage(method.Input())
+	if request != nil {
+		data, ok := request.(string)
+		if !ok {
+			encoded, err := json.Marshal(request)
+			if err != nil {
+				return nil, fmt.Errorf("request cannot be encoded: %w", err)
+			}
+			data = string(encoded)
+		}
+		if err := protojson.Unmarshal([]byte(data), req); err != nil {
+			return nil, fmt.Errorf("request does not match %s: %w", method.Input().FullName(), err)
+		}
+	}
+
+	var header, trailer metadata.MD
+	resp := dynamicpb.NewMessage(method.Output())
+	ctx = metadata.NewOutgoingContext(ctx, metadata.New(md))
+	fullMethod := "/" + g.service + "/" + g.method
+	if err := conn.Invoke(ctx, fullMethod, req, resp, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+		return nil, callError("grpc call "+fullMethod, err)
+	}
+
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("response cannot be decoded: %w", err)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("response cannot be decoded: %w", err)
+	}
+
+	return map[string]interface{}{
+		"response": response,
+		"headers":  metadataOutput(header),
+		"trailers": metadataOutput(trailer),
+	}, nil
+}
+
+// callError describes a failed call. Unavailable servers and exceeded
+// deadlines are reported so that the retry policy recognizes them.
+func callError(action string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("%s failed: %w", action, err)
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%s failed: %s: %w", action, st.Message(), context.DeadlineExceeded)
+	case codes.Unavailable:
+		return fmt.Errorf("%s failed: service unavailable: %s", action, st.Message())
+	default:
+		return fmt.Errorf("%s failed: %s: %s", action, st.Code(), st.Message())
+	}
+}
+
+func metadataOutput(md metadata.MD) map[string]interface{} {
+	output := make(map[string]interface{}, len(md))
+	for key, values := range md {
+		output[key] = strings.Join(values, ", ")
+	}
+	return output
+}
+
+// GetType returns the type of the node
+func (g *GRPCNode) GetType() string {
+	return g.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (g *GRPCNode) GetID() string {
+	return g.id
+}
+
+// NewGRPCNode creates a new gRPC node
+func NewGRPCNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &GRPCNode{
+		id:       fmt.Sprintf("grpc_%d", time.Now().UnixNano()),
+		nodeType: "grpc",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
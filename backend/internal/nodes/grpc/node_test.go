@@ -0,0 +1,187 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// startServer runs a health service with server reflection. Calls echo the
+// x-request-id metadata and whether they have a deadline as headers, and
+// calls with x-delay metadata block until their deadline.
+func startServer(t *testing.T, opts ...grpc.ServerOption) string {
+	t.Helper()
+	opts = append(opts, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		_, hasDeadline := ctx.Deadline()
+		header := metadata.Pairs("x-has-deadline", map[bool]string{true: "yes", false: "no"}[hasDeadline])
+		if id := md.Get("x-request-id"); len(id) > 0 {
+			header.Set("x-request-id", id...)
+		}
+		grpc.SetHeader(ctx, header)
+		if len(md.Get("x-delay")) > 0 {
+			<-ctx.Done()
+		}
+		return handler(ctx, req)
+	}))
+	server := grpc.NewServer(opts...)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func healthDescriptorSet(t *testing.T) string {
+	t.Helper()
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	data, err := proto.Marshal(set)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func call(t *testing.T, config, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := NewGRPCNode(config)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return node.Execute(ctx, inputs)
+}
+
+func TestGRPCNodeReflection(t *testing.T) {
+	target := startServer(t)
+
+	out, err := call(t, map[string]interface{}{
+		"target":   target,
+		"method":   "grpc.health.v1.Health/Check",
+		"metadata": map[string]interface{}{"X-Request-ID": "configured"},
+	}, map[string]interface{}{
+		"request":  map[string]interface{}{"service": "orders"},
+		"metadata": map[string]interface{}{"x-request-id": "from-input"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"status": "NOT_SERVING"}, out["response"])
+	headers := out["headers"].(map[string]interface{})
+	assert.Equal(t, "from-input", headers["x-request-id"])
+	assert.Equal(t, "yes", headers["x-has-deadline"])
+}
+
+func TestGRPCNodeDescriptorSet(t *testing.T) {
+	target := startServer(t)
+	descriptorSet := healthDescriptorSet(t)
+
+	out, err := call(t, map[string]interface{}{
+		"target":         target,
+		"method":         "/grpc.health.v1.Health/Check",
+		"descriptor_set": descriptorSet,
+		"request":        `{"service": ""}`,
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"status": "SERVING"}, out["response"])
+
+	// Status errors carry the code and message of the server
+	_, err = call(t, map[string]interface{}{
+		"target":         target,
+		"method":         "grpc.health.v1.Health.Check",
+		"descriptor_set": descriptorSet,
+		"request":        map[string]interface{}{"service": "unknown"},
+	}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NotFound")
+
+	_, err = call(t, map[string]interface{}{
+		"target":         target,
+		"method":         "grpc.health.v1.Health/Check",
+		"descriptor_set": descriptorSet,
+		"request":        map[string]interface{}{"colour": "blue"},
+	}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "request does not match grpc.health.v1.HealthCheckRequest")
+}
+
+func TestGRPCNodeDeadline(t *testing.T) {
+	target := startServer(t)
+
+	start := time.Now()
+	_, err := call(t, map[string]interface{}{
+		"target":   target,
+		"method":   "grpc.health.v1.Health/Check",
+		"metadata": map[string]interface{}{"x-delay": "1"},
+		"timeout":  0.2,
+	}, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err.Error())
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// An unreachable server is reported as unavailable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := listener.Addr().String()
+	listener.Close()
+	_, err = call(t, map[string]interface{}{"target": closed, "method": "grpc.health.v1.Health/Check"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "service unavailable")
+}
+
+func TestGRPCNodeTLS(t *testing.T) {
+	cert := httptest.NewTLSServer(nil)
+	cert.Close()
+	target := startServer(t, grpc.Creds(credentials.NewServerTLSFromCert(&cert.TLS.Certificates[0])))
+
+	config := map[string]interface{}{
+		"target": target,
+		"method": "grpc.health.v1.Health/Check",
+		"tls":    true,
+	}
+	// The test certificate is self-signed
+	_, err := call(t, config, nil)
+	require.Error(t, err)
+
+	config["insecure_skip_verify"] = true
+	out, err := call(t, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"status": "SERVING"}, out["response"])
+}
+
+func TestGRPCNodeConfig(t *testing.T) {
+	descriptorSet := healthDescriptorSet(t)
+	for _, tc := range []struct {
+		config map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"method": "grpc.health.v1.Health/Check"}, "target is required"},
+		{map[string]interface{}{"target": "localhost:50051", "method": "Check"}, "method must be given as package.Service/Method"},
+		{map[string]interface{}{"target": "localhost:50051", "method": "grpc.health.v1.Health/Check", "descriptor_set": "not base64"}, "descriptor_set must be base64 encoded"},
+		{map[string]interface{}{"target": "localhost:50051", "method": "grpc.health.v1.Health/Watch", "descriptor_set": descriptorSet}, "only unary calls are supported"},
+		{map[string]interface{}{"target": "localhost:50051", "method": "grpc.health.v1.Health/Ping", "descriptor_set": descriptorSet}, "has no method Ping"},
+		{map[string]interface{}{"target": "localhost:50051", "method": "grpc.health.v1.Health/Check", "timeout": -1.0}, "timeout must be a positive number"},
+	} {
+		_, err := NewGRPCNode(tc.config)
+		require.Error(t, err, tc.err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"citadel-agent/backend/pkg/tracecontext"
 )
 
 // ClientConfig holds configuration for the HTTP client
@@ -62,6 +64,7 @@ func (c *Client) Request(ctx context.Context, method, url string, headers map[st
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	tracecontext.Inject(ctx, req.Header)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -0,0 +1,260 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+)
+
+// GraphQLNode sends a GraphQL query or mutation to an endpoint.
+//
+// GraphQL errors do not fail the node: they are returned in "errors", next
+// to "data", so that downstream nodes can branch on them. Only transport
+// failures, and HTTP errors without a GraphQL response, fail the node.
+//
+// With persisted set, the query is first sent as its SHA-256 hash only,
+// following the automatic persisted queries protocol, and again in full
+// when the server does not know the hash. query_hash sends a query the
+// server has already persisted, without the query itself.
+type GraphQLNode struct {
+	id            string
+	nodeType      string
+	endpoint      string
+	query         string
+	queryHash     string
+	persisted     bool
+	operationName string
+	variables     map[string]interface{}
+	headers       map[string]string
+	authType      string
+	authValue     string
+	timeout       time.Duration
+	config        map[string]interface{}
+}
+
+// persistedQueryNotFound is the error returned for unknown query hashes
+const persistedQueryNotFound = "PersistedQueryNotFound"
+
+// Initialize sets up the GraphQL node with configuration
+func (g *GraphQLNode) Initialize(config map[string]interface{}) error {
+	g.config = config
+
+	endpoint, ok := config["endpoint"].(string)
+	if !ok || endpoint == "" {
+		return fmt.Errorf("endpoint is required")
+	}
+	g.endpoint = endpoint
+
+	if query, ok := config["query"]; ok {
+		if g.query, ok = query.(string); !ok {
+			return fmt.Errorf("query must be a string")
+		}
+	}
+	if queryHash, ok := config["query_hash"]; ok {
+		if g.queryHash, ok = queryHash.(string); !ok {
+			return fmt.Errorf("query_hash must be a string")
+		}
+	}
+	if g.query == "" && g.queryHash == "" {
+		return fmt.Errorf("query or query_hash is required")
+	}
+	if g.query != "" {
+		sum := sha256.Sum256([]byte(g.query))
+		hash := hex.EncodeToString(sum[:])
+		if g.queryHash != "" && g.queryHash != hash {
+			return fmt.Errorf("query_hash does not match the query")
+		}
+		g.queryHash = hash
+		g.persisted, _ = config["persisted"].(bool)
+	}
+
+	if operationName, ok := config["operation_name"]; ok {
+		if g.operationName, ok = operationName.(string); !ok {
+			return fmt.Errorf("operation_name must be a string")
+		}
+	}
+
+	if variables, ok := config["variables"]; ok {
+		if g.variables, ok = variables.(map[string]interface{}); !ok {
+			return fmt.Errorf("variables must be an object")
+		}
+	}
+
+	g.headers = make(map[string]string)
+	if headers, ok := config["headers"]; ok {
+		hMap, ok := headers.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("headers must be an object")
+		}
+		for k, v := range hMap {
+			if vStr, ok := v.(string); ok {
+				g.headers[k] = vStr
+			} else {
+				g.headers[k] = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+
+	g.authType, _ = config["auth_type"].(string)
+	g.authValue, _ = config["auth_value"].(string)
+
+	g.timeout = 30 * time.Second
+	if timeout, ok := config["timeout"]; ok {
+		t, ok := timeout.(float64)
+		if !ok {
+			return fmt.Errorf("timeout must be a number")
+		}
+		g.timeout = time.Duration(t) * time.Second
+	}
+
+	return nil
+}
+
+// graphQLResponse is the body of a GraphQL response
+type graphQLResponse struct {
+	Data       interface{}              `json:"data"`
+	Errors     []map[string]interface{} `json:"errors"`
+	Extensions map[string]interface{}   `json:"extensions"`
+}
+
+// Execute sends the query. The "variables" input is merged over the
+// configured variables.
+func (g *GraphQLNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	variables := make(map[string]interface{}, len(g.variables))
+	for name, value := range g.variables {
+		variables[name] = value
+	}
+	if v, ok := inputs["variables"]; ok {
+		vMap, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nodeerrors.NewValidationError("variables must be an object", nil)
+		}
+		for name, value := range vMap {
+			variables[name] = value
+		}
+	}
+
+	headers := make(map[string]string, len(g.headers)+2)
+	for k, v := range g.headers {
+		headers[k] = v
+	}
+	headers["Accept"] = "application/graphql-response+json, application/json"
+	if authorization := authorizationHeader(g.authType, g.authValue); authorization != "" {
+		headers["Authorization"] = authorization
+	}
+
+	body := map[string]interface{}{"variables": variables}
+	if g.operationName != "" {
+		body["operationName"] = g.operationName
+	}
+	if g.persisted || g.query == "" {
+		body["extensions"] = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": g.queryHash},
+		}
+	} else {
+		body["query"] = g.query
+	}
+
+	client := NewClient(ClientConfig{Timeout: g.timeout})
+	statusCode, result, err := g.send(ctx, client, headers, body)
+	if err == nil && g.persisted && isPersistedQueryNotFound(result) {
+		// Register the query with the server along with running it
+		body["query"] = g.query
+		statusCode, result, err = g.send(ctx, client, headers, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	graphQLErrors := make([]interface{}, len(result.Errors))
+	for i, e := range result.Errors {
+		graphQLErrors[i] = e
+	}
+	output := map[string]interface{}{
+		"data":        result.Data,
+		"errors":      graphQLErrors,
+		"has_errors":  len(graphQLErrors) > 0,
+		"status_code": statusCode,
+	}
+	if result.Extensions != nil {
+		output["extensions"] = result.Extensions
+	}
+	return output, nil
+}
+
+// send posts one request, failing unless the server answers with a GraphQL
+// response
+func (g *GraphQLNode) send(ctx context.Context, client *Client, headers map[string]string, body map[string]interface{}) (int, *graphQLResponse, error) {
+	resp, err := client.Request(ctx, http.MethodPost, g.endpoint, headers, body)
+	if err != nil {
+		return 0, nil, nodeerrors.FromTransport("graphql request failed", err)
+	}
+
+	var result graphQLResponse
+	decodeErr := json.Unmarshal(resp.Body, &result)
+	if decodeErr == nil && (result.Data != nil || len(result.Errors) > 0) {
+		return resp.StatusCode, &result, nil
+	}
+	if resp.StatusCode >= 300 {
+		return 0, nil, nodeerrors.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("graphql request failed: HTTP %d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
+	}
+	if decodeErr != nil {
+		return 0, nil, fmt.Errorf("graphql response is not JSON: %w", decodeErr)
+	}
+	return 0, nil, fmt.Errorf("graphql response has neither data nor errors")
+}
+
+// isPersistedQueryNotFound reports whether the server did not know the hash
+// of a persisted query
+func isPersistedQueryNotFound(result *graphQLResponse) bool {
+	for _, e := range result.Errors {
+		if e["message"] == persistedQueryNotFound {
+			return true
+		}
+		if extensions, ok := e["extensions"].(map[string]interface{}); ok && extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSideEffects reports whether the operation may be a mutation. Persisted
+// queries sent by hash alone cannot be told apart, so they count as one.
+func (g *GraphQLNode) HasSideEffects() bool {
+	if g.query == "" {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(g.query), "mutation")
+}
+
+// GetType returns the type of the node
+func (g *GraphQLNode) GetType() string {
+	return g.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (g *GraphQLNode) GetID() string {
+	return g.id
+}
+
+// NewGraphQLNode creates a new GraphQL node
+func NewGraphQLNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &GraphQLNode{
+		id:       fmt.Sprintf("graphql_%d", time.Now().UnixNano()),
+		nodeType: "graphql",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
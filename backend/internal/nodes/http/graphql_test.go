@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphQLServer answers the queries it knows, remembering persisted ones
+// by hash, and counts the requests it gets
+type graphQLServer struct {
+	mu        sync.Mutex
+	persisted map[string]string
+	requests  int
+}
+
+func (s *graphQLServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Query      string                 `json:"query"`
+		Variables  map[string]interface{} `json:"variables"`
+		Extensions struct {
+			PersistedQuery struct {
+				SHA256Hash string `json:"sha256Hash"`
+			} `json:"persistedQuery"`
+		} `json:"extensions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	query := body.Query
+	if hash := body.Extensions.PersistedQuery.SHA256Hash; hash != "" {
+		if query == "" {
+			query = s.persisted[hash]
+		} else {
+			s.persisted[hash] = query
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case query == "":
+		w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+	case strings.Contains(query, "unavailable"):
+		http.Error(w, "upstream down", http.StatusServiceUnavailable)
+	case strings.Contains(query, "syntax error"):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":[{"message":"Syntax Error: Unexpected Name \"syntax\""}]}`))
+	case strings.Contains(query, "hero"):
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"hero": map[string]interface{}{
+				"name":          "R2-D2",
+				"episode":       body.Variables["episode"],
+				"authorization": r.Header.Get("Authorization"),
+			}},
+		})
+	default:
+		w.Write([]byte(`{"data":{"hero":null},"errors":[{"message":"Cannot query field \"villain\"","path":["villain"]}]}`))
+	}
+}
+
+func (s *graphQLServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func executeGraphQL(t *testing.T, config, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := NewGraphQLNode(config)
+	require.NoError(t, err)
+	return node.Execute(context.Background(), inputs)
+}
+
+func TestGraphQLNodeDataAndErrors(t *testing.T) {
+	server := httptest.NewServer(&graphQLServer{persisted: map[string]string{}})
+	defer server.Close()
+
+	out, err := executeGraphQL(t, map[string]interface{}{
+		"endpoint":   server.URL,
+		"query":      "query Hero($episode: Episode) { hero(episode: $episode) { name } }",
+		"variables":  map[string]interface{}{"episode": "NEWHOPE"},
+		"auth_type":  "bearer",
+		"auth_value": "secret",
+	}, map[string]interface{}{"variables": map[string]interface{}{"episode": "JEDI"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"hero": map[string]interface{}{
+		"name": "R2-D2", "episode": "JEDI", "authorization": "Bearer secret",
+	}}, out["data"])
+	assert.Equal(t, []interface{}{}, out["errors"])
+	assert.Equal(t, false, out["has_errors"])
+
+	// GraphQL errors are returned, with whatever data there is, rather
+	// than failing the node
+	out, err = executeGraphQL(t, map[string]interface{}{"endpoint": server.URL, "query": "{ villain { name } }"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"hero": nil}, out["data"])
+	assert.Equal(t, true, out["has_errors"])
+	require.Len(t, out["errors"], 1)
+	assert.Equal(t, `Cannot query field "villain"`, out["errors"].([]interface{})[0].(map[string]interface{})["message"])
+
+	// So are those sent with an HTTP error status
+	out, err = executeGraphQL(t, map[string]interface{}{"endpoint": server.URL, "query": "syntax error"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, out["has_errors"])
+	assert.Equal(t, http.StatusBadRequest, out["status_code"])
+	assert.Nil(t, out["data"])
+
+	// HTTP failures without a GraphQL response fail the node
+	_, err = executeGraphQL(t, map[string]interface{}{"endpoint": server.URL, "query": "{ unavailable }"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP 503 Service Unavailable")
+}
+
+func TestGraphQLNodePersistedQueries(t *testing.T) {
+	handler := &graphQLServer{persisted: map[string]string{}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	query := "{ hero { name } }"
+	config := map[string]interface{}{"endpoint": server.URL, "query": query, "persisted": true}
+
+	// The first call registers the query after its hash is not found
+	out, err := executeGraphQL(t, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, out["has_errors"])
+	assert.Equal(t, 2, handler.requestCount())
+
+	// Later ones send the hash only
+	out, err = executeGraphQL(t, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "R2-D2", out["data"].(map[string]interface{})["hero"].(map[string]interface{})["name"])
+	assert.Equal(t, 3, handler.requestCount())
+
+	sum := sha256.Sum256([]byte(query))
+	out, err = executeGraphQL(t, map[string]interface{}{"endpoint": server.URL, "query_hash": hex.EncodeToString(sum[:])}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, out["has_errors"])
+
+	// A hash the server does not know cannot be retried without the query
+	out, err = executeGraphQL(t, map[string]interface{}{"endpoint": server.URL, "query_hash": "unknown"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, out["has_errors"])
+	assert.Equal(t, 5, handler.requestCount())
+}
+
+func TestGraphQLNodeConfig(t *testing.T) {
+	for _, tc := range []struct {
+		config map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"query": "{ hero }"}, "endpoint is required"},
+		{map[string]interface{}{"endpoint": "http://localhost"}, "query or query_hash is required"},
+		{map[string]interface{}{"endpoint": "http://localhost", "query": "{ hero }", "query_hash": "abc"}, "query_hash does not match the query"},
+		{map[string]interface{}{"endpoint": "http://localhost", "query": "{ hero }", "variables": "episode"}, "variables must be an object"},
+	} {
+		_, err := NewGraphQLNode(tc.config)
+		require.Error(t, err, tc.err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
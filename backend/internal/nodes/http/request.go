@@ -3,27 +3,76 @@ package http
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/nodes/integration/storage"
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"citadel-agent/backend/pkg/tracecontext"
 )
 
+// DefaultTimeout bounds HTTP requests without a configured timeout
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxRedirects is how many redirects are followed unless configured
+// otherwise
+const DefaultMaxRedirects = 10
+
+// DefaultMaxResponseBytes bounds the response bodies read into memory
+// unless configured otherwise
+const DefaultMaxResponseBytes = 10 << 20
+
+// Body types of the HTTP request node
+const (
+	BodyTypeJSON = "json"
+	BodyTypeForm = "form"
+	BodyTypeRaw  = "raw"
+)
+
+// RequestOptions holds the server-wide settings of HTTP request nodes
+type RequestOptions struct {
+	// Timeout bounds requests whose node sets no timeout; it mirrors
+	// workflow.timeout_policy.http_timeout of the application config
+	Timeout time.Duration
+	// Files is where stream_to_file writes responses; it is the local root
+	// of the storage node, which can pick the files up from there
+	Files storage.Backend
+	// CircuitBreakers stop requests to hosts that keep failing; without
+	// them every request is made
+	CircuitBreakers *middleware.CircuitBreakers
+}
+
 // HTTPRequestNode implements a node that makes HTTP requests
 type HTTPRequestNode struct {
-	id          string
-	nodeType    string
-	method      string
-	url         string
-	headers     map[string]string
-	body        string
-	timeout     time.Duration
-	authType    string
-	authValue   string
-	config      map[string]interface{}
+	id              string
+	nodeType        string
+	method          string
+	url             string
+	headers         map[string]string
+	queryParams     url.Values
+	body            interface{}
+	bodyType        string
+	timeout         time.Duration
+	authType        string
+	authValue       string
+	followRedirects bool
+	maxRedirects    int
+	proxy           *url.URL
+	failOnError     bool
+	maxResponse     int64
+	streamToFile    string
+	files           storage.Backend
+	breakers        *middleware.CircuitBreakers
+	config          map[string]interface{}
 }
 
 // Initialize sets up the HTTP request node with configuration
@@ -32,7 +81,7 @@ func (h *HTTPRequestNode) Initialize(config map[string]interface{}) error {
 
 	if method, ok := config["method"]; ok {
 		if m, ok := method.(string); ok {
-			h.method = m
+			h.method = strings.ToUpper(m)
 		} else {
 			return fmt.Errorf("method must be a string")
 		}
@@ -40,9 +89,9 @@ func (h *HTTPRequestNode) Initialize(config map[string]interface{}) error {
 		h.method = "GET" // default method
 	}
 
-	if url, ok := config["url"]; ok {
-		if u, ok := url.(string); ok {
-			h.url = u
+	if u, ok := config["url"]; ok {
+		if uStr, ok := u.(string); ok {
+			h.url = uStr
 		} else {
 			return fmt.Errorf("url must be a string")
 		}
@@ -67,29 +116,55 @@ func (h *HTTPRequestNode) Initialize(config map[string]interface{}) error {
 		h.headers = make(map[string]string)
 	}
 
-	if body, ok := config["body"]; ok {
-		if b, ok := body.(string); ok {
-			h.body = b
-		} else {
-			// Try to serialize the body if it's not a string
-			bodyBytes, err := json.Marshal(body)
-			if err != nil {
-				return fmt.Errorf("failed to serialize body: %v", err)
+	h.queryParams = url.Values{}
+	if params, ok := config["query_params"]; ok {
+		pMap, ok := params.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("query_params must be an object")
+		}
+		for k, v := range pMap {
+			// Arrays repeat the parameter
+			if values, ok := v.([]interface{}); ok {
+				for _, value := range values {
+					h.queryParams.Add(k, fmt.Sprintf("%v", value))
+				}
+			} else {
+				h.queryParams.Add(k, fmt.Sprintf("%v", v))
 			}
-			h.body = string(bodyBytes)
+		}
+	}
+
+	h.body = config["body"]
+	if _, ok := h.body.(string); ok {
+		h.bodyType = BodyTypeRaw
+	} else {
+		h.bodyType = BodyTypeJSON
+	}
+	if bodyType, ok := config["body_type"]; ok {
+		bt, _ := bodyType.(string)
+		switch bt {
+		case BodyTypeJSON, BodyTypeRaw:
+		case BodyTypeForm:
+			if _, ok := h.body.(map[string]interface{}); h.body != nil && !ok {
+				return fmt.Errorf("form bodies must be objects")
+			}
+		default:
+			return fmt.Errorf("body_type must be \"json\", \"form\" or \"raw\", got %v", bodyType)
+		}
+		h.bodyType = bt
+	}
+	if h.bodyType == BodyTypeRaw && h.body != nil {
+		if _, ok := h.body.(string); !ok {
+			return fmt.Errorf("raw bodies must be strings")
 		}
 	}
 
 	if timeout, ok := config["timeout"]; ok {
-		if t, ok := timeout.(float64); ok {
-			h.timeout = time.Duration(t) * time.Second
-		} else if t, ok := timeout.(int); ok {
-			h.timeout = time.Duration(t) * time.Second
+		if t, ok := timeout.(float64); ok && t > 0 {
+			h.timeout = time.Duration(t * float64(time.Second))
 		} else {
-			return fmt.Errorf("timeout must be a number")
+			return fmt.Errorf("timeout must be a positive number of seconds")
 		}
-	} else {
-		h.timeout = 30 * time.Second // default timeout
 	}
 
 	if authType, ok := config["auth_type"]; ok {
@@ -104,32 +179,143 @@ func (h *HTTPRequestNode) Initialize(config map[string]interface{}) error {
 		}
 	}
 
+	h.followRedirects = true
+	if follow, ok := config["follow_redirects"]; ok {
+		if h.followRedirects, ok = follow.(bool); !ok {
+			return fmt.Errorf("follow_redirects must be a boolean")
+		}
+	}
+	h.maxRedirects = DefaultMaxRedirects
+	if maxRedirects, ok := config["max_redirects"]; ok {
+		n, ok := maxRedirects.(float64)
+		if !ok || n < 0 || n != float64(int(n)) {
+			return fmt.Errorf("max_redirects must be a non-negative integer")
+		}
+		h.maxRedirects = int(n)
+	}
+
+	if proxy, ok := config["proxy"]; ok {
+		p, _ := proxy.(string)
+		proxyURL, err := url.Parse(p)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("proxy must be a URL, got %v", proxy)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("proxy scheme must be http, https, socks5 or socks5h, got %q", proxyURL.Scheme)
+		}
+		h.proxy = proxyURL
+	}
+
+	if failOnError, ok := config["fail_on_error"]; ok {
+		if h.failOnError, ok = failOnError.(bool); !ok {
+			return fmt.Errorf("fail_on_error must be a boolean")
+		}
+	}
+
+	if maxResponse, ok := config["max_response_bytes"]; ok {
+		n, ok := maxResponse.(float64)
+		if !ok || n < 1 || n != float64(int64(n)) {
+			return fmt.Errorf("max_response_bytes must be a positive number of bytes")
+		}
+		h.maxResponse = int64(n)
+	}
+
+	if streamToFile, ok := config["stream_to_file"]; ok {
+		if h.streamToFile, ok = streamToFile.(string); !ok || h.streamToFile == "" {
+			return fmt.Errorf("stream_to_file must be a file name")
+		}
+		if h.files == nil {
+			return fmt.Errorf("stream_to_file requires local storage to be configured")
+		}
+	}
+
 	return nil
 }
 
-// Execute runs the HTTP request
-func (h *HTTPRequestNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+// client returns the HTTP client making the node's requests
+func (h *HTTPRequestNode) client() *http.Client {
 	client := &http.Client{
 		Timeout: h.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !h.followRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > h.maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", h.maxRedirects)
+			}
+			return nil
+		},
+	}
+	if h.proxy != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(h.proxy)
+		client.Transport = transport
 	}
+	return client
+}
 
-	// Prepare request body
-	var bodyReader io.Reader
-	if h.body != "" {
-		bodyReader = bytes.NewBufferString(h.body)
-	} else if len(inputs) > 0 {
-		// If no explicit body, try to use inputs
-		inputBytes, err := json.Marshal(inputs)
+// requestBody encodes the configured body, or else the inputs of the node,
+// returning it with its default content type
+func (h *HTTPRequestNode) requestBody(inputs map[string]interface{}) (io.Reader, string, error) {
+	body, bodyType := h.body, h.bodyType
+	if body == nil {
+		// If no explicit body, try to use inputs; GET and HEAD requests
+		// carry none
+		if len(inputs) == 0 || h.method == http.MethodGet || h.method == http.MethodHead {
+			return nil, "", nil
+		}
+		body = inputs
+		if bodyType == BodyTypeRaw {
+			bodyType = BodyTypeJSON
+		}
+	}
+
+	switch bodyType {
+	case BodyTypeRaw:
+		return strings.NewReader(body.(string)), "application/json", nil
+	case BodyTypeForm:
+		form := url.Values{}
+		for k, v := range body.(map[string]interface{}) {
+			form.Set(k, fmt.Sprintf("%v", v))
+		}
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+	default:
+		bodyBytes, err := json.Marshal(body)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal input data: %v", err)
+			return nil, "", fmt.Errorf("failed to serialize body: %v", err)
 		}
-		bodyReader = bytes.NewBuffer(inputBytes)
+		return bytes.NewReader(bodyBytes), "application/json", nil
+	}
+}
+
+// Execute runs the HTTP request
+func (h *HTTPRequestNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	requestURL, err := url.Parse(h.url)
+	if err != nil {
+		return nil, nodeerrors.NewValidationError("invalid url", err)
+	}
+	if len(h.queryParams) > 0 {
+		query := requestURL.Query()
+		for k, values := range h.queryParams {
+			for _, v := range values {
+				query.Add(k, v)
+			}
+		}
+		requestURL.RawQuery = query.Encode()
+	}
+
+	// Prepare request body
+	bodyReader, contentType, err := h.requestBody(inputs)
+	if err != nil {
+		return nil, nodeerrors.NewValidationError("invalid request body", err)
 	}
 
 	// Create the request
-	req, err := http.NewRequestWithContext(ctx, h.method, h.url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, h.method, requestURL.String(), bodyReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, nodeerrors.NewValidationError("failed to create request", err)
 	}
 
 	// Set headers
@@ -138,36 +324,44 @@ func (h *HTTPRequestNode) Execute(ctx context.Context, inputs map[string]interfa
 	}
 
 	// Set content type if not already set and we have a body
-	if h.body != "" || len(inputs) > 0 {
-		if req.Header.Get("Content-Type") == "" {
-			req.Header.Set("Content-Type", "application/json")
-		}
+	if bodyReader != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
 	}
 
 	// Set up authentication if configured
-	if h.authType != "" && h.authValue != "" {
-		switch h.authType {
-		case "bearer":
-			req.Header.Set("Authorization", "Bearer "+h.authValue)
-		case "api_key":
-			req.Header.Set("Authorization", h.authValue)
-		case "basic":
-			// For basic auth, the auth_value should be in format "username:password"
-			req.Header.Set("Authorization", "Basic "+h.authValue)
-		}
+	if authorization := authorizationHeader(h.authType, h.authValue); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	// Continue the trace of the run in the called service
+	tracecontext.Inject(ctx, req.Header)
+
+	// Fail fast while the host keeps failing
+	breaker := h.breakers.Get(requestURL.Host)
+	if err := breaker.Allow(); err != nil {
+		return nil, nodeerrors.NewCircuitOpenError(fmt.Sprintf("not calling %s, which keeps failing", requestURL.Host), err)
 	}
 
 	// Make the request
-	resp, err := client.Do(req)
+	resp, err := h.client().Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %v", err)
+		// Requests the run canceled or timed out are not held against the host
+		if ctx.Err() != nil {
+			breaker.Done(nil)
+		} else {
+			breaker.Done(err)
+		}
+		return nil, nodeerrors.FromTransport("failed to execute request", err)
 	}
 	defer resp.Body.Close()
+	if serviceFailed(resp.StatusCode) {
+		breaker.Done(fmt.Errorf("HTTP %d", resp.StatusCode))
+	} else {
+		breaker.Done(nil)
+	}
 
-	// Read response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+	if h.failOnError && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return nil, nodeerrors.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("request failed: HTTP %d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
 	}
 
 	// Prepare response data
@@ -175,14 +369,119 @@ func (h *HTTPRequestNode) Execute(ctx context.Context, inputs map[string]interfa
 		"status_code": resp.StatusCode,
 		"status":      resp.Status,
 		"headers":     resp.Header,
-		"body":        string(respBody),
 		"method":      h.method,
-		"url":         h.url,
+		"url":         resp.Request.URL.String(),
+	}
+
+	// Read at most the limit of the response body; streamed responses are
+	// only limited when configured to be
+	limit := h.maxResponse
+	if limit == 0 && h.streamToFile == "" {
+		limit = DefaultMaxResponseBytes
+	}
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit)
+	}
+
+	if h.streamToFile != "" {
+		counter := &countingReader{r: body}
+		if err := h.files.Write(ctx, h.streamToFile, counter, -1, resp.Header.Get("Content-Type")); err != nil {
+			return nil, fmt.Errorf("failed to write response body to %s: %w", h.streamToFile, err)
+		}
+		result["file"] = h.streamToFile
+		result["size"] = counter.n
+		result["truncated"] = limit > 0 && counter.n == limit && hasMore(resp.Body)
+		return result, nil
+	}
+
+	// Read response body
+	respBody, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nodeerrors.FromTransport("failed to read response body", err)
+	}
+	truncated := int64(len(respBody)) == limit && hasMore(resp.Body)
+	if truncated {
+		// A cut off document cannot be parsed
+		result["body"] = string(respBody)
+	} else {
+		result["body"] = parseBody(resp.Header.Get("Content-Type"), respBody)
 	}
+	result["truncated"] = truncated
 
 	return result, nil
 }
 
+// serviceFailed reports whether a response status says the service is
+// failing or overloaded, rather than refusing the request itself
+func serviceFailed(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// hasMore reports whether r has bytes left to read
+func hasMore(r io.Reader) bool {
+	var b [1]byte
+	n, _ := io.ReadFull(r, b[:])
+	return n > 0
+}
+
+// parseBody decodes JSON response bodies; others are returned as text
+func parseBody(contentType string, body []byte) interface{} {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		var parsed interface{}
+		if err := json.Unmarshal(body, &parsed); err == nil {
+			return parsed
+		}
+	}
+	return string(body)
+}
+
+// authorizationHeader returns the Authorization header of the auth_type and
+// auth_value config of the HTTP nodes, or "" when they are not set
+func authorizationHeader(authType, authValue string) string {
+	if authType == "" || authValue == "" {
+		return ""
+	}
+	switch authType {
+	case "bearer":
+		return "Bearer " + authValue
+	case "api_key":
+		return authValue
+	case "basic":
+		// For basic auth, the auth_value should be in format
+		// "username:password", or already base64 encoded
+		if strings.Contains(authValue, ":") {
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(authValue))
+		}
+		return "Basic " + authValue
+	}
+	return ""
+}
+
+// HasSideEffects reports whether the request may change the remote
+// resource, as every method but GET, HEAD and OPTIONS may, or writes the
+// response to a file
+func (h *HTTPRequestNode) HasSideEffects() bool {
+	switch h.method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return h.streamToFile != ""
+	}
+	return true
+}
+
 // GetType returns the type of the node
 func (h *HTTPRequestNode) GetType() string {
 	return h.nodeType
@@ -195,14 +494,29 @@ func (h *HTTPRequestNode) GetID() string {
 
 // NewHTTPRequestNode creates a new HTTP request node constructor for the registry
 func NewHTTPRequestNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
-	node := &HTTPRequestNode{
-		id:       fmt.Sprintf("http_%d", time.Now().UnixNano()),
-		nodeType: "http_request",
-	}
+	return NewHTTPRequestNodeWithOptions(RequestOptions{})(config)
+}
 
-	if err := node.Initialize(config); err != nil {
-		return nil, err
+// NewHTTPRequestNodeWithOptions returns the constructor of HTTP request
+// nodes using options
+func NewHTTPRequestNodeWithOptions(options RequestOptions) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &HTTPRequestNode{
+			id:       fmt.Sprintf("http_%d", time.Now().UnixNano()),
+			nodeType: "http_request",
+			timeout:  timeout,
+			files:    options.Files,
+			breakers: options.CircuitBreakers,
+		}
 
-	return node, nil
-}
\ No newline at end of file
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	}
+}
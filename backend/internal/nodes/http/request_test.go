@@ -0,0 +1,326 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/nodes/integration/storage"
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"citadel-agent/backend/pkg/tracecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler answers with the request it got
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"method":        r.Method,
+		"query":         r.URL.RawQuery,
+		"authorization": r.Header.Get("Authorization"),
+		"content_type":  r.Header.Get("Content-Type"),
+		"body":          string(body),
+	})
+}
+
+func executeHTTP(t *testing.T, config map[string]interface{}, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := NewHTTPRequestNode(config)
+	require.NoError(t, err)
+	return node.Execute(context.Background(), inputs)
+}
+
+func TestHTTPRequestNodeRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(echoHandler))
+	defer server.Close()
+
+	out, err := executeHTTP(t, map[string]interface{}{
+		"method":       "post",
+		"url":          server.URL + "/orders?source=api",
+		"query_params": map[string]interface{}{"tag": []interface{}{"a", "b"}, "limit": 10.0},
+		"body":         map[string]interface{}{"id": 1.0},
+		"auth_type":    "bearer",
+		"auth_value":   "token",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, out["status_code"])
+	assert.Equal(t, map[string]interface{}{
+		"method":        "POST",
+		"query":         "limit=10&source=api&tag=a&tag=b",
+		"authorization": "Bearer token",
+		"content_type":  "application/json",
+		"body":          `{"id":1}`,
+	}, out["body"])
+
+	// Basic credentials are encoded, form bodies URL encoded
+	out, err = executeHTTP(t, map[string]interface{}{
+		"method":     "PUT",
+		"url":        server.URL,
+		"body":       map[string]interface{}{"name": "citadel agent"},
+		"body_type":  "form",
+		"auth_type":  "basic",
+		"auth_value": "admin:secret",
+	}, nil)
+	require.NoError(t, err)
+	body := out["body"].(map[string]interface{})
+	assert.Equal(t, "Basic YWRtaW46c2VjcmV0", body["authorization"])
+	assert.Equal(t, "application/x-www-form-urlencoded", body["content_type"])
+	assert.Equal(t, "name=citadel+agent", body["body"])
+
+	// Raw bodies are sent as they are, and GET requests carry no inputs
+	out, err = executeHTTP(t, map[string]interface{}{
+		"method":  "POST",
+		"url":     server.URL,
+		"body":    "<order/>",
+		"headers": map[string]interface{}{"Content-Type": "application/xml"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<order/>", out["body"].(map[string]interface{})["body"])
+	assert.Equal(t, "application/xml", out["body"].(map[string]interface{})["content_type"])
+
+	out, err = executeHTTP(t, map[string]interface{}{"url": server.URL}, map[string]interface{}{"upstream": "output"})
+	require.NoError(t, err)
+	assert.Equal(t, "", out["body"].(map[string]interface{})["body"])
+}
+
+func TestHTTPRequestNodeRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/final", echoHandler)
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.Handle("/moved", http.RedirectHandler("/final", http.StatusMovedPermanently))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	out, err := executeHTTP(t, map[string]interface{}{"url": server.URL + "/moved"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, out["status_code"])
+	assert.Equal(t, server.URL+"/final", out["url"])
+
+	out, err = executeHTTP(t, map[string]interface{}{"url": server.URL + "/moved", "follow_redirects": false}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, out["status_code"])
+	assert.Equal(t, "/final", out["headers"].(http.Header).Get("Location"))
+
+	_, err = executeHTTP(t, map[string]interface{}{"url": server.URL + "/loop", "max_redirects": 3.0}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stopped after 3 redirects")
+}
+
+func TestHTTPRequestNodeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := executeHTTP(t, map[string]interface{}{"url": server.URL, "timeout": 0.1}, nil)
+	require.Error(t, err)
+	var timeoutErr interface{ Timeout() bool }
+	require.True(t, errors.As(err, &timeoutErr) && timeoutErr.Timeout(), err.Error())
+
+	// Without a node timeout, the server-wide one applies
+	node, err := NewHTTPRequestNodeWithOptions(RequestOptions{Timeout: 100 * time.Millisecond})(map[string]interface{}{"url": server.URL})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestHTTPRequestNodeFailOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	out, err := executeHTTP(t, map[string]interface{}{"url": server.URL}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, out["status_code"])
+	assert.Equal(t, "down for maintenance\n", out["body"])
+
+	_, err = executeHTTP(t, map[string]interface{}{"url": server.URL, "fail_on_error": true}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP 503 Service Unavailable")
+}
+
+func TestHTTPRequestNodeProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("from proxy"))
+	}))
+	defer proxy.Close()
+
+	out, err := executeHTTP(t, map[string]interface{}{"url": "http://orders.internal/list", "proxy": proxy.URL}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from proxy", out["body"])
+	assert.Equal(t, "http://orders.internal/list", proxied)
+
+	_, err = NewHTTPRequestNode(map[string]interface{}{"url": "http://orders.internal", "proxy": "ftp://proxy:21"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "proxy scheme must be")
+}
+
+func TestHTTPRequestNodeResponseLimit(t *testing.T) {
+	payload := `{"items":"` + strings.Repeat("x", 4096) + `"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	out, err := executeHTTP(t, map[string]interface{}{"url": server.URL}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, out["truncated"])
+	assert.IsType(t, map[string]interface{}{}, out["body"])
+
+	// Oversized bodies are cut off at the limit and left unparsed
+	out, err = executeHTTP(t, map[string]interface{}{"url": server.URL, "max_response_bytes": 1024.0}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, out["truncated"])
+	assert.Equal(t, payload[:1024], out["body"])
+
+	// A body of exactly the limit is whole
+	out, err = executeHTTP(t, map[string]interface{}{"url": server.URL, "max_response_bytes": float64(len(payload))}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, out["truncated"])
+
+	_, err = NewHTTPRequestNode(map[string]interface{}{"url": server.URL, "max_response_bytes": 0.5})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max_response_bytes must be a positive number of bytes")
+}
+
+func TestHTTPRequestNodeStreamToFile(t *testing.T) {
+	payload := strings.Repeat("0123456789", 2<<20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	newNode := NewHTTPRequestNodeWithOptions(RequestOptions{Files: storage.NewLocalBackend(root)})
+
+	// Streamed responses are not limited by default
+	node, err := newNode(map[string]interface{}{"url": server.URL, "stream_to_file": "downloads/large.txt"})
+	require.NoError(t, err)
+	out, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(payload)), out["size"])
+	assert.Equal(t, false, out["truncated"])
+	assert.NotContains(t, out, "body")
+	data, err := os.ReadFile(filepath.Join(root, "downloads", "large.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(data))
+
+	node, err = newNode(map[string]interface{}{"url": server.URL, "stream_to_file": "small.txt", "max_response_bytes": 100.0})
+	require.NoError(t, err)
+	out, err = node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), out["size"])
+	assert.Equal(t, true, out["truncated"])
+
+	_, err = NewHTTPRequestNode(map[string]interface{}{"url": server.URL, "stream_to_file": "large.txt"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream_to_file requires local storage to be configured")
+}
+
+func TestHTTPRequestNodeSideEffects(t *testing.T) {
+	for method, want := range map[string]bool{"": false, "get": false, "HEAD": false, "post": true, "DELETE": true} {
+		node, err := NewHTTPRequestNode(map[string]interface{}{"url": "https://example.com", "method": method})
+		require.NoError(t, err)
+		assert.Equal(t, want, node.(*HTTPRequestNode).HasSideEffects(), method)
+	}
+}
+
+func TestHTTPRequestNodePropagatesTraceContext(t *testing.T) {
+	traceparents := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get(tracecontext.Header)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	span := tracecontext.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	node, err := NewHTTPRequestNode(map[string]interface{}{"url": server.URL})
+	require.NoError(t, err)
+	_, err = node.Execute(tracecontext.ContextWithSpan(context.Background(), span), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", <-traceparents)
+}
+
+func TestHTTPRequestNodeCircuitBreaker(t *testing.T) {
+	var calls int
+	healthy := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	breakers := middleware.NewCircuitBreakers(middleware.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: 20 * time.Millisecond})
+	node, err := NewHTTPRequestNodeWithOptions(RequestOptions{CircuitBreakers: breakers})(map[string]interface{}{"url": server.URL})
+	require.NoError(t, err)
+
+	// Failed responses are still outputs, but they count against the host
+	for i := 0; i < 2; i++ {
+		out, err := node.Execute(context.Background(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, out["status_code"])
+	}
+
+	_, err = node.Execute(context.Background(), nil)
+	assert.Equal(t, nodeerrors.CodeCircuit, nodeerrors.CodeOf(err))
+	assert.ErrorIs(t, err, middleware.ErrCircuitOpen)
+	assert.Equal(t, 2, calls, "an open circuit makes no request")
+
+	healthy = true
+	time.Sleep(30 * time.Millisecond)
+	out, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, out["status_code"])
+	assert.Equal(t, middleware.StateClosed, breakers.States()[strings.TrimPrefix(server.URL, "http://")])
+}
+
+func TestHTTPRequestNodeCircuitBreakerIgnoresCanceledRequests(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	breakers := middleware.NewCircuitBreakers(middleware.CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Minute})
+	node, err := NewHTTPRequestNodeWithOptions(RequestOptions{CircuitBreakers: breakers})(map[string]interface{}{"url": server.URL})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		_, err := node.Execute(ctx, nil)
+		require.Error(t, err)
+		assert.NotEqual(t, nodeerrors.CodeCircuit, nodeerrors.CodeOf(err))
+	}
+	assert.Equal(t, middleware.StateClosed, breakers.States()[strings.TrimPrefix(server.URL, "http://")])
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound is returned when reading an object that does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object. ContentType is empty when the
+// backend does not know it.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Backend stores objects under slash-separated keys. Objects are streamed
+// in and out, never held in memory as a whole.
+type Backend interface {
+	// Read opens an object; the caller closes the reader
+	Read(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Write stores size bytes from r under key, replacing any object there
+	Write(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// List returns the objects whose key starts with prefix, in key order
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalBackend stores objects as files under a root directory
+type LocalBackend struct {
+	root string
+}
+
+// NewLocalBackend creates a backend storing files under root, which is
+// created on the first write
+func NewLocalBackend(root string) *LocalBackend {
+	return &LocalBackend{root: root}
+}
+
+// path returns the file of key. Keys are cleaned as absolute paths first,
+// so ".." cannot leave the root.
+func (lb *LocalBackend) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(lb.root, filepath.FromSlash(clean)), nil
+}
+
+// Read opens the file of key
+func (lb *LocalBackend) Read(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	name, err := lb.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return file, lb.info(key, stat), nil
+}
+
+// Write streams r into a temporary file, renamed over the file of key once
+// complete so readers never see a partial object
+func (lb *LocalBackend) Write(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := lb.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// List walks the root for files whose key starts with prefix
+func (lb *LocalBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(lb.root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && name == lb.root {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(lb.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, lb.info(key, stat))
+		return ctx.Err()
+	})
+	return objects, err
+}
+
+// Delete removes the file of key
+func (lb *LocalBackend) Delete(ctx context.Context, key string) error {
+	name, err := lb.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// info describes a file; its content type comes from the extension
+func (lb *LocalBackend) info(key string, stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: stat.ModTime(),
+	}
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// Operations of the storage node
+const (
+	OperationRead   = "read"
+	OperationWrite  = "write"
+	OperationList   = "list"
+	OperationDelete = "delete"
+)
+
+// DefaultMaxSize bounds the objects a storage node reads or writes unless
+// configured otherwise
+const DefaultMaxSize = 10 << 20
+
+// Options configures the storage nodes of a NewStorageNode constructor
+type Options struct {
+	// LocalRoot is the directory of the local backend. Files named by the
+	// "file" setting of a node are resolved in it too.
+	LocalRoot string
+	// S3 is the service of the s3 backend
+	S3 S3Config
+}
+
+// StorageNode reads, writes, lists and deletes objects of a local
+// directory or an S3 bucket.
+//
+// Content passes through the workflow as a string, base64-encoded when
+// "encoding" is "base64". Objects too large for that can be streamed to or
+// from a file under the local root instead, set with "file". Either way
+// objects over max_size bytes are refused.
+type StorageNode struct {
+	id          string
+	nodeType    string
+	backend     Backend
+	files       *LocalBackend
+	operation   string
+	key         string
+	prefix      string
+	content     interface{}
+	contentType string
+	encoding    string
+	file        string
+	maxSize     int64
+	config      map[string]interface{}
+}
+
+// Initialize sets up the storage node with configuration. "key", "prefix",
+// "content" and "file" may also come from the input, which takes
+// precedence.
+func (sn *StorageNode) Initialize(config map[string]interface{}, options Options) error {
+	sn.config = config
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case OperationRead, OperationWrite, OperationList, OperationDelete:
+		sn.operation = operation
+	default:
+		return fmt.Errorf("operation must be one of read, write, list or delete, got %q", operation)
+	}
+
+	for name, field := range map[string]*string{
+		"key":          &sn.key,
+		"prefix":       &sn.prefix,
+		"content_type": &sn.contentType,
+		"encoding":     &sn.encoding,
+		"file":         &sn.file,
+	} {
+		if value, ok := config[name]; ok {
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", name)
+			}
+			*field = s
+		}
+	}
+	if sn.encoding != "" && sn.encoding != "base64" {
+		return fmt.Errorf("encoding must be \"base64\" when set, got %q", sn.encoding)
+	}
+	sn.content = config["content"]
+
+	sn.maxSize = DefaultMaxSize
+	if maxSize, ok := config["max_size"]; ok {
+		n, ok := maxSize.(float64)
+		if !ok || n < 1 || n != float64(int64(n)) {
+			return fmt.Errorf("max_size must be a positive number of bytes")
+		}
+		sn.maxSize = int64(n)
+	}
+
+	if options.LocalRoot != "" {
+		sn.files = NewLocalBackend(options.LocalRoot)
+	}
+
+	backend, _ := config["backend"].(string)
+	switch backend {
+	case "", "local":
+		if sn.files == nil {
+			return fmt.Errorf("local storage is not configured")
+		}
+		sn.backend = sn.files
+	case "s3":
+		bucket, _ := config["bucket"].(string)
+		s3, err := NewS3Backend(options.S3, bucket)
+		if err != nil {
+			return err
+		}
+		sn.backend = s3
+	default:
+		return fmt.Errorf("backend must be \"local\" or \"s3\", got %q", backend)
+	}
+
+	return nil
+}
+
+// Execute runs the configured operation
+func (sn *StorageNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	key := stringInput(inputs, "key", sn.key)
+	file := stringInput(inputs, "file", sn.file)
+	if file != "" && sn.files == nil {
+		return nil, fmt.Errorf("file requires local storage to be configured")
+	}
+
+	if sn.operation == OperationList {
+		prefix := stringInput(inputs, "prefix", sn.prefix)
+		objects, err := sn.backend.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("listing objects failed: %w", err)
+		}
+		list := make([]interface{}, len(objects))
+		for i, object := range objects {
+			list[i] = map[string]interface{}{
+				"key":           object.Key,
+				"size":          object.Size,
+				"content_type":  object.ContentType,
+				"last_modified": object.LastModified.UTC().Format(time.RFC3339),
+			}
+		}
+		return map[string]interface{}{"prefix": prefix, "objects": list, "count": len(list)}, nil
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("%s requires a key", sn.operation)
+	}
+
+	switch sn.operation {
+	case OperationRead:
+		return sn.read(ctx, key, file)
+	case OperationWrite:
+		content := sn.content
+		if c, ok := inputs["content"]; ok {
+			content = c
+		}
+		return sn.write(ctx, key, file, content)
+	case OperationDelete:
+		if err := sn.backend.Delete(ctx, key); err != nil {
+			return nil, fmt.Errorf("deleting %s failed: %w", key, err)
+		}
+		return map[string]interface{}{"key": key, "deleted": true}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operation: %s", sn.operation)
+}
+
+// read returns an object as content, or streams it into file
+func (sn *StorageNode) read(ctx context.Context, key, file string) (map[string]interface{}, error) {
+	object, info, err := sn.backend.Read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %w", key, err)
+	}
+	defer object.Close()
+	if info.Size > sn.maxSize {
+		return nil, fmt.Errorf("object %s is %d bytes, over the limit of %d", key, info.Size, sn.maxSize)
+	}
+
+	body := bufio.NewReader(io.LimitReader(object, sn.maxSize))
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = detectContentType(key, body)
+	}
+	output := map[string]interface{}{"key": key, "size": info.Size, "content_type": contentType}
+
+	if file != "" {
+		if err := sn.files.Write(ctx, file, body, info.Size, ""); err != nil {
+			return nil, fmt.Errorf("writing %s to file %s failed: %w", key, file, err)
+		}
+		output["file"] = file
+		return output, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %w", key, err)
+	}
+	if sn.encoding == "base64" {
+		output["content"] = base64.StdEncoding.EncodeToString(data)
+	} else {
+		output["content"] = string(data)
+	}
+	return output, nil
+}
+
+// write stores content, or streams file, under key
+func (sn *StorageNode) write(ctx context.Context, key, file string, content interface{}) (map[string]interface{}, error) {
+	var body io.Reader
+	var size int64
+	contentType := sn.contentType
+
+	if file != "" {
+		source, info, err := sn.files.Read(ctx, file)
+		if err != nil {
+			return nil, fmt.Errorf("reading file %s failed: %w", file, err)
+		}
+		defer source.Close()
+		body, size = source, info.Size
+		if contentType == "" {
+			contentType = info.ContentType
+		}
+	} else {
+		data, err := sn.encode(content)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := content.(string); !ok && contentType == "" {
+			contentType = "application/json"
+		}
+		body, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	if size > sn.maxSize {
+		return nil, fmt.Errorf("content of %s is %d bytes, over the limit of %d", key, size, sn.maxSize)
+	}
+	if contentType == "" {
+		buffered := bufio.NewReader(body)
+		contentType = detectContentType(key, buffered)
+		body = buffered
+	}
+
+	if err := sn.backend.Write(ctx, key, body, size, contentType); err != nil {
+		return nil, fmt.Errorf("writing %s failed: %w", key, err)
+	}
+	return map[string]interface{}{"key": key, "size": size, "content_type": contentType}, nil
+}
+
+// encode converts content to the bytes stored: strings as they are (or
+// base64-decoded) and anything else as JSON
+func (sn *StorageNode) encode(content interface{}) ([]byte, error) {
+	switch c := content.(type) {
+	case nil:
+		return nil, fmt.Errorf("write requires content or a file")
+	case string:
+		if sn.encoding == "base64" {
+			data, err := base64.StdEncoding.DecodeString(c)
+			if err != nil {
+				return nil, fmt.Errorf("content is not valid base64: %w", err)
+			}
+			return data, nil
+		}
+		return []byte(c), nil
+	default:
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("content cannot be encoded: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// detectContentType guesses the content type of key from its extension,
+// or else from the first bytes of body
+func detectContentType(key string, body *bufio.Reader) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	head, _ := body.Peek(512)
+	return http.DetectContentType(head)
+}
+
+func stringInput(inputs map[string]interface{}, name, fallback string) string {
+	if s, ok := inputs[name].(string); ok && s != "" {
+		return s
+	}
+	return fallback
+}
+
+// HasSideEffects reports whether the operation writes or deletes an
+// object, or saves one to a configured local file
+func (sn *StorageNode) HasSideEffects() bool {
+	switch sn.operation {
+	case OperationWrite, OperationDelete:
+		return true
+	case OperationRead:
+		return sn.file != ""
+	}
+	return false
+}
+
+// GetType returns the type of the node
+func (sn *StorageNode) GetType() string {
+	return sn.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (sn *StorageNode) GetID() string {
+	return sn.id
+}
+
+// NewStorageNode returns the constructor of storage nodes using options
+func NewStorageNode(options Options) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &StorageNode{
+			id:       fmt.Sprintf("storage_%d", time.Now().UnixNano()),
+			nodeType: "storage",
+		}
+		if err := node.Initialize(config, options); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
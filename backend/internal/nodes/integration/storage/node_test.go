@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 serves the object requests of a single bucket from memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func newFakeS3(t *testing.T, bucket string) *httptest.Server {
+	fake := &fakeS3{bucket: bucket, objects: make(map[string]fakeObject)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.fail(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut:
+		data, err := readPayload(r)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// readPayload reads an upload, decoding the aws-chunked encoding clients
+// stream with over plain HTTP
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	body := bufio.NewReader(r.Body)
+	for {
+		header, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2) // data and CRLF
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type contents struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []contents
+	}{Name: f.bucket, Prefix: prefix, MaxKeys: 1000}
+	for key, object := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, contents{key, time.Now().UTC().Format(time.RFC3339), `"etag"`, len(object.data)})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+	}{Code: code})
+}
+
+// runStorage builds a storage node from config and executes it on inputs
+func runStorage(t *testing.T, newNode func(map[string]interface{}) (interfaces.NodeInstance, error), config, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := newNode(config)
+	require.NoError(t, err)
+	return node.Execute(context.Background(), inputs)
+}
+
+// exerciseBackend runs the operations every backend supports
+func exerciseBackend(t *testing.T, newNode func(map[string]interface{}) (interfaces.NodeInstance, error), base map[string]interface{}) {
+	t.Helper()
+	with := func(settings map[string]interface{}) map[string]interface{} {
+		config := make(map[string]interface{})
+		for k, v := range base {
+			config[k] = v
+		}
+		for k, v := range settings {
+			config[k] = v
+		}
+		return config
+	}
+
+	out, err := runStorage(t, newNode, with(map[string]interface{}{"operation": "write"}), map[string]interface{}{"key": "reports/q1.csv", "content": "region,total\nnorth,42\n"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(22), out["size"])
+	assert.Equal(t, "text/csv; charset=utf-8", out["content_type"])
+
+	out, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "write", "key": "reports/summary"}), map[string]interface{}{"content": map[string]interface{}{"total": 42}})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", out["content_type"])
+
+	out, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "write", "key": "images/logo", "encoding": "base64", "content": "iVBORw0KGgo="}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", out["content_type"])
+
+	out, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "read", "key": "reports/q1.csv"}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "region,total\nnorth,42\n", out["content"])
+	out, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "read", "key": "images/logo", "encoding": "base64"}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "iVBORw0KGgo=", out["content"])
+
+	out, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "list", "prefix": "reports/"}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, out["count"])
+	objects := out["objects"].([]interface{})
+	assert.Equal(t, "reports/q1.csv", objects[0].(map[string]interface{})["key"])
+	assert.Equal(t, "reports/summary", objects[1].(map[string]interface{})["key"])
+
+	// Objects over the size limit are refused either way
+	_, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "read", "key": "reports/q1.csv", "max_size": 10.0}), nil)
+	assert.ErrorContains(t, err, "over the limit")
+	_, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "write", "key": "big", "content": "too large", "max_size": 4.0}), nil)
+	assert.ErrorContains(t, err, "over the limit")
+
+	out, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "delete", "key": "reports/q1.csv"}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, out["deleted"])
+	_, err = runStorage(t, newNode, with(map[string]interface{}{"operation": "read", "key": "reports/q1.csv"}), nil)
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestStorageNodeLocal(t *testing.T) {
+	root := t.TempDir()
+	newNode := NewStorageNode(Options{LocalRoot: root})
+	exerciseBackend(t, newNode, map[string]interface{}{"backend": "local"})
+
+	// Keys cannot leave the root
+	_, err := runStorage(t, newNode, map[string]interface{}{"operation": "write", "key": "../../escape.txt", "content": "x"}, nil)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(root, "escape.txt"))
+}
+
+func TestStorageNodeS3(t *testing.T) {
+	server := newFakeS3(t, "citadel")
+	root := t.TempDir()
+	newNode := NewStorageNode(Options{LocalRoot: root, S3: S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+	}})
+	exerciseBackend(t, newNode, map[string]interface{}{"backend": "s3", "bucket": "citadel"})
+
+	// Large objects are streamed between files and the bucket
+	require.NoError(t, os.WriteFile(filepath.Join(root, "upload.txt"), []byte(strings.Repeat("a", 4096)), 0o644))
+	out, err := runStorage(t, newNode, map[string]interface{}{"backend": "s3", "bucket": "citadel", "operation": "write", "key": "archive/upload.txt", "file": "upload.txt"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4096), out["size"])
+	assert.Equal(t, "text/plain; charset=utf-8", out["content_type"])
+
+	out, err = runStorage(t, newNode, map[string]interface{}{"backend": "s3", "bucket": "citadel", "operation": "read", "key": "archive/upload.txt"}, map[string]interface{}{"file": "downloads/copy.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, "downloads/copy.txt", out["file"])
+	assert.NotContains(t, out, "content")
+	data, err := os.ReadFile(filepath.Join(root, "downloads", "copy.txt"))
+	require.NoError(t, err)
+	assert.Len(t, data, 4096)
+
+	_, err = runStorage(t, newNode, map[string]interface{}{"backend": "s3", "bucket": "other", "operation": "read", "key": "x"}, nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestStorageNodeConfig(t *testing.T) {
+	newNode := NewStorageNode(Options{})
+	for _, config := range []map[string]interface{}{
+		{"operation": "copy"},
+		{"operation": "read", "backend": "ftp"},
+		{"operation": "read"}, // no local root
+		{"operation": "read", "backend": "s3"},
+		{"operation": "read", "backend": "s3", "bucket": "b", "max_size": -1.0},
+		{"operation": "read", "backend": "s3", "bucket": "b", "encoding": "hex"},
+	} {
+		_, err := newNode(config)
+		assert.Error(t, err, "config %v", config)
+	}
+}
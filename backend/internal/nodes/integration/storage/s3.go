@@ -4,36 +4,107 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-// S3Client handles S3 storage operations
-type S3Client struct {
-	bucket    string
-	region    string
-	accessKey string
-	secretKey string
+// S3Config holds the connection settings of an S3-compatible service such
+// as AWS S3 or MinIO
+type S3Config struct {
+	// Endpoint is a host[:port], or a URL whose scheme decides UseSSL.
+	// AWS S3 is used when it is empty.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+// S3Backend stores objects in a bucket of an S3-compatible service
+type S3Backend struct {
+	client *minio.Client
+	bucket string
 }
 
-// NewS3Client creates a new S3 client
-func NewS3Client(bucket, region, accessKey, secretKey string) *S3Client {
-	return &S3Client{
-		bucket:    bucket,
-		region:    region,
-		accessKey: accessKey,
-		secretKey: secretKey,
+// NewS3Backend creates a backend storing objects in bucket
+func NewS3Backend(config S3Config, bucket string) (*S3Backend, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 storage requires a bucket")
+	}
+
+	endpoint, secure := config.Endpoint, config.UseSSL
+	if endpoint == "" {
+		endpoint, secure = "s3.amazonaws.com", true
+	} else if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		endpoint, secure = u.Host, u.Scheme == "https"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: secure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	return &S3Backend{client: client, bucket: bucket}, nil
+}
+
+// Read opens an object; its body is fetched as the reader is read
+func (sb *S3Backend) Read(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	object, err := sb.client.GetObject(ctx, sb.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, s3Error(key, err)
+	}
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, ObjectInfo{}, s3Error(key, err)
 	}
+	return object, s3Info(stat), nil
 }
 
-// Upload uploads a file to S3
-func (s *S3Client) Upload(ctx context.Context, key string, data io.Reader) error {
-	// This would use AWS SDK
-	// For now, placeholder implementation
-	return fmt.Errorf("S3 upload not fully implemented - requires AWS SDK")
+// Write uploads r as an object
+func (sb *S3Backend) Write(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := sb.client.PutObject(ctx, sb.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return s3Error(key, err)
 }
 
-// Download downloads a file from S3
-func (s *S3Client) Download(ctx context.Context, key string) ([]byte, error) {
-	// This would use AWS SDK
-	// For now, placeholder implementation
-	return nil, fmt.Errorf("S3 download not fully implemented - requires AWS SDK")
+// List returns the objects of the bucket under prefix
+func (sb *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for object := range sb.client.ListObjects(ctx, sb.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, s3Error(prefix, object.Err)
+		}
+		objects = append(objects, s3Info(object))
+	}
+	return objects, nil
+}
+
+// Delete removes an object
+func (sb *S3Backend) Delete(ctx context.Context, key string) error {
+	return s3Error(key, sb.client.RemoveObject(ctx, sb.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func s3Info(object minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          object.Key,
+		Size:         object.Size,
+		ContentType:  object.ContentType,
+		LastModified: object.LastModified,
+	}
+}
+
+// s3Error maps a missing object to ErrObjectNotFound
+func s3Error(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return fmt.Errorf("s3 request failed: %w", err)
 }
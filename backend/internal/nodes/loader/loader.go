@@ -93,6 +93,9 @@ func LoadAllNodes() error {
 	if err := register(validation.NewRegexValidatorNode); err != nil {
 		return err
 	}
+	if err := register(validation.NewFormatValidatorNode); err != nil {
+		return err
+	}
 
 	// 7. Communication Nodes
 	if err := register(communication.NewEmailNode); err != nil {
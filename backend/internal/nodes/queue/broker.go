@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"context"
+)
+
+// Message is a message published to a queue
+type Message struct {
+	Body        []byte
+	ContentType string
+	Headers     map[string]interface{}
+}
+
+// Delivery is a message received from a queue. Every delivery must be
+// settled once, with Ack or Nack; unsettled ones are delivered again when
+// the consumer goes away.
+type Delivery struct {
+	Message
+	Queue       string
+	MessageID   string
+	Redelivered bool
+
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+// NewDelivery creates a delivery settled through ack and nack, for Broker
+// implementations
+func NewDelivery(queue string, msg Message, ack func() error, nack func(requeue bool) error) *Delivery {
+	return &Delivery{Message: msg, Queue: queue, ack: ack, nack: nack}
+}
+
+// Ack acknowledges the delivery, removing the message from the queue
+func (d *Delivery) Ack() error {
+	return d.ack()
+}
+
+// Nack rejects the delivery. A requeued message is delivered again; other
+// ones are dropped, or dead-lettered when the broker is set up to.
+func (d *Delivery) Nack(requeue bool) error {
+	return d.nack(requeue)
+}
+
+// Broker publishes and consumes the messages of durable named queues
+type Broker interface {
+	// Publish sends a message to queue, returning once the broker has it
+	Publish(ctx context.Context, queue string, msg Message) error
+	// Consume hands the messages of queue to handle until ctx is done,
+	// with at most prefetch of them unsettled at a time. Lost connections
+	// are re-established; it returns an error only when consuming cannot
+	// go on.
+	Consume(ctx context.Context, queue string, prefetch int, handle func(*Delivery)) error
+	// Close releases the connection to the broker
+	Close() error
+}
@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// MessageQueueNodeType is the node type publishing to and consuming from
+// message queues
+const MessageQueueNodeType = "message_queue"
+
+// Operations of the message queue node
+const (
+	OperationPublish = "publish"
+	OperationConsume = "consume"
+)
+
+// Ack modes of consumers. With manual acks a message is acknowledged once
+// the workflow it started succeeds, so messages are processed at least
+// once; with auto acks it is acknowledged on receipt, at most once.
+const (
+	AckManual = "manual"
+	AckAuto   = "auto"
+)
+
+// DefaultBatchSize is how many messages a consumer processes at a time
+// unless configured otherwise
+const DefaultBatchSize = 1
+
+// MessageQueueNode publishes messages to a queue, or, with the consume
+// operation, is the trigger starting a workflow per message of a queue.
+//
+// A consume node is started by the queue consumers of the API (see
+// handlers.QueueConsumers) and passes the message on: body (decoded when
+// it is JSON), content_type, headers, message_id, redelivered and queue.
+type MessageQueueNode struct {
+	id          string
+	nodeType    string
+	broker      Broker
+	operation   string
+	queue       string
+	message     interface{}
+	contentType string
+	ackMode     string
+	batchSize   int
+	config      map[string]interface{}
+}
+
+// Initialize sets up the message queue node with configuration
+func (mq *MessageQueueNode) Initialize(config map[string]interface{}) error {
+	mq.config = config
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case OperationPublish, OperationConsume:
+		mq.operation = operation
+	default:
+		return fmt.Errorf("operation must be \"publish\" or \"consume\", got %q", operation)
+	}
+
+	queue, ok := config["queue"].(string)
+	if !ok || queue == "" {
+		return fmt.Errorf("queue is required")
+	}
+	mq.queue = queue
+
+	mq.message = config["message"]
+	if contentType, ok := config["content_type"]; ok {
+		ct, ok := contentType.(string)
+		if !ok {
+			return fmt.Errorf("content_type must be a string")
+		}
+		mq.contentType = ct
+	}
+
+	mq.ackMode = AckManual
+	if ack, ok := config["ack"]; ok {
+		a, _ := ack.(string)
+		if a != AckManual && a != AckAuto {
+			return fmt.Errorf("ack must be \"manual\" or \"auto\", got %v", ack)
+		}
+		mq.ackMode = a
+	}
+
+	mq.batchSize = DefaultBatchSize
+	if batchSize, ok := config["batch_size"]; ok {
+		n, ok := batchSize.(float64)
+		if !ok || n < 1 || n != float64(int(n)) {
+			return fmt.Errorf("batch_size must be a positive integer")
+		}
+		mq.batchSize = int(n)
+	}
+
+	return nil
+}
+
+// Operation returns "publish" or "consume"
+func (mq *MessageQueueNode) Operation() string {
+	return mq.operation
+}
+
+// HasSideEffects reports whether the node publishes
+func (mq *MessageQueueNode) HasSideEffects() bool {
+	return mq.operation == OperationPublish
+}
+
+// Queue returns the name of the queue
+func (mq *MessageQueueNode) Queue() string {
+	return mq.queue
+}
+
+// AckMode returns how consumed messages are acknowledged
+func (mq *MessageQueueNode) AckMode() string {
+	return mq.ackMode
+}
+
+// BatchSize returns how many messages are processed at a time
+func (mq *MessageQueueNode) BatchSize() int {
+	return mq.batchSize
+}
+
+// Execute publishes the message, or passes a consumed one on. The message
+// to publish is the "message" input, or else the configured one; strings
+// are sent as they are and anything else as JSON.
+func (mq *MessageQueueNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	if mq.operation == OperationConsume {
+		output := map[string]interface{}{"queue": mq.queue}
+		for _, key := range []string{"body", "content_type", "headers", "message_id", "redelivered", "received_at"} {
+			if value, ok := inputs[key]; ok {
+				output[key] = value
+			}
+		}
+		return output, nil
+	}
+
+	if mq.broker == nil {
+		return nil, fmt.Errorf("no message broker is configured")
+	}
+	message := mq.message
+	if m, ok := inputs["message"]; ok {
+		message = m
+	}
+
+	msg := Message{ContentType: mq.contentType}
+	switch m := message.(type) {
+	case nil:
+		return nil, fmt.Errorf("publish requires a message")
+	case string:
+		msg.Body = []byte(m)
+		if msg.ContentType == "" {
+			msg.ContentType = "text/plain"
+		}
+	default:
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("message cannot be encoded: %w", err)
+		}
+		msg.Body = data
+		if msg.ContentType == "" {
+			msg.ContentType = "application/json"
+		}
+	}
+
+	if err := mq.broker.Publish(ctx, mq.queue, msg); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"queue": mq.queue, "published": true, "size": len(msg.Body)}, nil
+}
+
+// DeliveryInputs builds the trigger input of a consumed message. JSON
+// bodies are decoded; anything else is passed on as a string.
+func DeliveryInputs(d *Delivery) map[string]interface{} {
+	var body interface{} = string(d.Body)
+	var decoded interface{}
+	if len(d.Body) > 0 && json.Unmarshal(d.Body, &decoded) == nil {
+		body = decoded
+	}
+
+	headers := make(map[string]interface{}, len(d.Headers))
+	for name, value := range d.Headers {
+		headers[name] = value
+	}
+
+	return map[string]interface{}{
+		"body":         body,
+		"content_type": d.ContentType,
+		"headers":      headers,
+		"message_id":   d.MessageID,
+		"redelivered":  d.Redelivered,
+		"received_at":  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// GetType returns the type of the node
+func (mq *MessageQueueNode) GetType() string {
+	return mq.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (mq *MessageQueueNode) GetID() string {
+	return mq.id
+}
+
+// NewMessageQueueNode returns the constructor of message queue nodes
+// publishing through broker, which may be nil when only consume nodes are
+// used
+func NewMessageQueueNode(broker Broker) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &MessageQueueNode{
+			id:       fmt.Sprintf("message_queue_%d", time.Now().UnixNano()),
+			nodeType: MessageQueueNodeType,
+			broker:   broker,
+		}
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRabbitMQPublishAndConsumeAtLeastOnce(t *testing.T) {
+	url := os.Getenv("TEST_RABBITMQ_URL")
+	if url == "" {
+		t.Skip("TEST_RABBITMQ_URL not set")
+	}
+	broker := NewRabbitMQBroker(url)
+	defer broker.Close()
+	queue := fmt.Sprintf("citadel_test_%d", time.Now().UnixNano())
+
+	publish, err := NewMessageQueueNode(broker)(map[string]interface{}{"operation": "publish", "queue": queue})
+	require.NoError(t, err)
+	out, err := publish.Execute(context.Background(), map[string]interface{}{"message": map[string]interface{}{"order": 42.0}})
+	require.NoError(t, err)
+	assert.Equal(t, true, out["published"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	deliveries := make(chan *Delivery, 2)
+	go broker.Consume(ctx, queue, 1, func(d *Delivery) { deliveries <- d })
+	next := func() *Delivery {
+		select {
+		case d := <-deliveries:
+			return d
+		case <-ctx.Done():
+			t.Fatal("no message received")
+			return nil
+		}
+	}
+
+	// A rejected message comes back, marked redelivered
+	first := next()
+	assert.False(t, first.Redelivered)
+	assert.Equal(t, "application/json", first.ContentType)
+	assert.Equal(t, map[string]interface{}{"order": 42.0}, DeliveryInputs(first)["body"])
+	require.NoError(t, first.Nack(true))
+
+	second := next()
+	assert.True(t, second.Redelivered)
+	assert.Equal(t, first.Body, second.Body)
+	require.NoError(t, second.Ack())
+
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery after ack: %s", d.Body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
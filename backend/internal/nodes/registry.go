@@ -9,6 +9,7 @@ import (
 	"citadel-agent/backend/internal/nodes/http"
 	"citadel-agent/backend/internal/nodes/integration"
 	"citadel-agent/backend/internal/nodes/security"
+	"citadel-agent/backend/internal/nodes/trigger"
 	"citadel-agent/backend/internal/nodes/utility"
 )
 
@@ -27,12 +28,17 @@ const (
 
 	// Utility Node Types
 	DataTransformerNodeType NodeType = "data_transformer"
+	TemplateNodeType        NodeType = "template"
 
 	// Security Node Types
 	EncryptionNodeType NodeType = "encryption"
 
 	// Integration Node Types
 	NotificationNodeType NodeType = "notification"
+
+	// Trigger Node Types
+	WebhookTriggerNodeType  NodeType = trigger.WebhookTriggerNodeType
+	ScheduleTriggerNodeType NodeType = trigger.ScheduleTriggerNodeType
 )
 
 // NodeFactory creates node instances based on type
@@ -65,8 +71,11 @@ func NewNodeFactory() *NodeFactory {
 	nf.registerNodeType(DatabaseQueryNodeType, database.NewDatabaseNode)
 	nf.registerNodeType(TextGeneratorNodeType, ai.NewTextGeneratorNode)
 	nf.registerNodeType(DataTransformerNodeType, utility.NewTransformerNode)
+	nf.registerNodeType(TemplateNodeType, utility.NewTemplateNode)
 	nf.registerNodeType(EncryptionNodeType, security.NewEncryptionNode)
 	nf.registerNodeType(NotificationNodeType, integration.NewNotificationNode)
+	nf.registerNodeType(WebhookTriggerNodeType, trigger.NewWebhookTriggerNode)
+	nf.registerNodeType(ScheduleTriggerNodeType, trigger.NewScheduleTriggerNode)
 
 	return nf
 }
@@ -5,6 +5,7 @@ import (
 
 	"citadel-agent/backend/internal/nodes/base"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // JWTSignNode implements JWT signing
@@ -100,6 +101,11 @@ func (n *JWTSignNode) Execute(ctx *base.ExecutionContext, inputs map[string]inte
 		}
 	}
 
+	// Give every token an ID so it can be revoked on its own
+	if _, ok := claims["jti"]; !ok {
+		claims["jti"] = uuid.NewString()
+	}
+
 	// Create token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -0,0 +1,106 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/scheduler"
+)
+
+// ScheduleTriggerNodeType is the node type that starts a workflow on a cron
+// schedule. The scheduler discovers these nodes in deployed workflows.
+const ScheduleTriggerNodeType = scheduler.ScheduleTriggerNodeType
+
+// ScheduleTriggerNode starts a workflow at the times given by a cron
+// expression such as "0 9 * * 1-5" or an interval such as "@every 5m"
+type ScheduleTriggerNode struct {
+	id       string
+	nodeType string
+	cron     string
+	timezone *time.Location
+	config   map[string]interface{}
+}
+
+// Initialize sets up the schedule trigger node with configuration
+func (st *ScheduleTriggerNode) Initialize(config map[string]interface{}) error {
+	st.config = config
+
+	cron, ok := config["cron"].(string)
+	if !ok || cron == "" {
+		return fmt.Errorf("cron is required")
+	}
+
+	timezone := ""
+	if tz, ok := config["timezone"]; ok {
+		if t, ok := tz.(string); ok {
+			timezone = t
+		} else {
+			return fmt.Errorf("timezone must be a string")
+		}
+	}
+
+	if err := scheduler.ValidateSchedule(cron, timezone); err != nil {
+		return err
+	}
+
+	st.cron = cron
+	st.timezone, _ = scheduler.LoadTimezone(timezone)
+	return nil
+}
+
+// NextFireTime returns the first activation strictly after from
+func (st *ScheduleTriggerNode) NextFireTime(from time.Time) (time.Time, error) {
+	return scheduler.NextRunTimeIn(st.cron, st.timezone.String(), from)
+}
+
+// Execute outputs the time the schedule fired for. The scheduler passes it
+// as "scheduled_time"; when the workflow is started some other way the
+// current time is used.
+func (st *ScheduleTriggerNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	scheduledTime := time.Now()
+	if value, ok := inputs["scheduled_time"].(string); ok {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scheduled_time: %w", err)
+		}
+		scheduledTime = parsed
+	}
+
+	output := map[string]interface{}{
+		"scheduled_time": scheduledTime.In(st.timezone).Format(time.RFC3339),
+		"cron":           st.cron,
+		"timezone":       st.timezone.String(),
+	}
+
+	if next, err := st.NextFireTime(scheduledTime); err == nil {
+		output["next_scheduled_time"] = next.In(st.timezone).Format(time.RFC3339)
+	}
+
+	return output, nil
+}
+
+// GetType returns the type of the node
+func (st *ScheduleTriggerNode) GetType() string {
+	return st.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (st *ScheduleTriggerNode) GetID() string {
+	return st.id
+}
+
+// NewScheduleTriggerNode creates a new schedule trigger node constructor for the registry
+func NewScheduleTriggerNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &ScheduleTriggerNode{
+		id:       fmt.Sprintf("schedule_trigger_%d", time.Now().UnixNano()),
+		nodeType: ScheduleTriggerNodeType,
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
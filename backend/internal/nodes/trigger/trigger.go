@@ -0,0 +1,32 @@
+package trigger
+
+import (
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// constructors of the trigger node types
+var constructors = map[string]func(config map[string]interface{}) (interfaces.NodeInstance, error){
+	WebhookTriggerNodeType:  NewWebhookTriggerNode,
+	ScheduleTriggerNodeType: NewScheduleTriggerNode,
+}
+
+// IsTrigger reports whether nodeType is a trigger node type
+func IsTrigger(nodeType string) bool {
+	_, ok := constructors[nodeType]
+	return ok
+}
+
+// ValidateConfig checks the configuration of a trigger node so that
+// workflows with invalid triggers are rejected when they are deployed. Other
+// node types are not checked.
+func ValidateConfig(nodeType string, config map[string]interface{}) error {
+	constructor, ok := constructors[nodeType]
+	if !ok {
+		return nil
+	}
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+	_, err := constructor(config)
+	return err
+}
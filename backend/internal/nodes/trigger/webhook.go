@@ -0,0 +1,190 @@
+package trigger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// WebhookTriggerNodeType is the node type that starts a workflow from an
+// inbound HTTP request
+const WebhookTriggerNodeType = "webhook_trigger"
+
+// Webhook verification modes
+const (
+	VerifyNone  = "none"
+	VerifyToken = "token"
+	VerifyHMAC  = "hmac_sha256"
+)
+
+// Default headers carrying the shared secret or the body signature
+const (
+	DefaultTokenHeader     = "X-Webhook-Token"
+	DefaultSignatureHeader = "X-Webhook-Signature"
+	hmacPrefix             = "sha256="
+)
+
+// ErrInvalidSignature is returned when a webhook request fails verification
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// WebhookTriggerNode starts a workflow when a request is received on
+// POST /api/v1/webhooks/{workflow_id}/{path}. The request body, headers and
+// query are the workflow's trigger input, and the node passes them on.
+type WebhookTriggerNode struct {
+	id                string
+	nodeType          string
+	path              string
+	secret            string
+	verification      string
+	signatureHeader   string
+	waitForCompletion bool
+	config            map[string]interface{}
+}
+
+// Initialize sets up the webhook trigger node with configuration
+func (wt *WebhookTriggerNode) Initialize(config map[string]interface{}) error {
+	wt.config = config
+
+	path, ok := config["path"].(string)
+	path = strings.Trim(path, "/")
+	if !ok || path == "" {
+		return fmt.Errorf("path is required")
+	}
+	wt.path = path
+
+	if secret, ok := config["secret"]; ok {
+		if s, ok := secret.(string); ok {
+			wt.secret = s
+		} else {
+			return fmt.Errorf("secret must be a string")
+		}
+	}
+
+	wt.verification = VerifyNone
+	if wt.secret != "" {
+		wt.verification = VerifyHMAC
+	}
+	if verification, ok := config["verification"]; ok {
+		v, ok := verification.(string)
+		if !ok {
+			return fmt.Errorf("verification must be a string")
+		}
+		switch v {
+		case VerifyNone, VerifyToken, VerifyHMAC:
+			wt.verification = v
+		default:
+			return fmt.Errorf("unsupported verification: %s", v)
+		}
+	}
+	if wt.verification != VerifyNone && wt.secret == "" {
+		return fmt.Errorf("secret is required for %s verification", wt.verification)
+	}
+
+	wt.signatureHeader = DefaultSignatureHeader
+	if wt.verification == VerifyToken {
+		wt.signatureHeader = DefaultTokenHeader
+	}
+	if header, ok := config["signature_header"]; ok {
+		if h, ok := header.(string); ok && h != "" {
+			wt.signatureHeader = h
+		} else {
+			return fmt.Errorf("signature_header must be a non-empty string")
+		}
+	}
+
+	if wait, ok := config["wait_for_completion"]; ok {
+		if w, ok := wait.(bool); ok {
+			wt.waitForCompletion = w
+		} else {
+			return fmt.Errorf("wait_for_completion must be a boolean")
+		}
+	}
+
+	return nil
+}
+
+// Path returns the webhook path, without leading or trailing slashes
+func (wt *WebhookTriggerNode) Path() string {
+	return wt.path
+}
+
+// WaitForCompletion reports whether the webhook responds only once the
+// workflow has finished
+func (wt *WebhookTriggerNode) WaitForCompletion() bool {
+	return wt.waitForCompletion
+}
+
+// Verify checks a request against the configured secret. With token
+// verification the header must equal the secret; with HMAC verification it
+// must hold the hex HMAC-SHA256 of the body, optionally prefixed "sha256=".
+func (wt *WebhookTriggerNode) Verify(body []byte, header http.Header) error {
+	value := header.Get(wt.signatureHeader)
+
+	switch wt.verification {
+	case VerifyNone:
+		return nil
+	case VerifyToken:
+		if subtle.ConstantTimeCompare([]byte(value), []byte(wt.secret)) != 1 {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		signature, err := hex.DecodeString(strings.TrimPrefix(value, hmacPrefix))
+		if err != nil || len(signature) == 0 {
+			return ErrInvalidSignature
+		}
+		mac := hmac.New(sha256.New, []byte(wt.secret))
+		mac.Write(body)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+}
+
+// Execute passes the trigger input (body, headers, query) on to the
+// downstream nodes
+func (wt *WebhookTriggerNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	output := map[string]interface{}{
+		"path": wt.path,
+	}
+	for _, key := range []string{"body", "headers", "query", "method", "received_at"} {
+		if value, ok := inputs[key]; ok {
+			output[key] = value
+		}
+	}
+	return output, nil
+}
+
+// GetType returns the type of the node
+func (wt *WebhookTriggerNode) GetType() string {
+	return wt.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (wt *WebhookTriggerNode) GetID() string {
+	return wt.id
+}
+
+// NewWebhookTriggerNode creates a new webhook trigger node constructor for the registry
+func NewWebhookTriggerNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &WebhookTriggerNode{
+		id:       fmt.Sprintf("webhook_trigger_%d", time.Now().UnixNano()),
+		nodeType: WebhookTriggerNodeType,
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
@@ -0,0 +1,99 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// ApprovalNode pauses the workflow until a person approves or rejects it.
+// Its output port is "approved" or "rejected", so downstream edges can
+// branch on the answer. Waiting counts towards the node timeout.
+type ApprovalNode struct {
+	id       string
+	nodeType string
+	message  string
+	prompt   func(ctx context.Context, message string) (types.PromptResponse, error)
+	config   map[string]interface{}
+}
+
+// Initialize sets up the approval node with configuration
+func (an *ApprovalNode) Initialize(config map[string]interface{}) error {
+	an.config = config
+
+	an.message = "Approval required"
+	if message, ok := config["message"]; ok {
+		msg, ok := message.(string)
+		if !ok {
+			return fmt.Errorf("message must be a string")
+		}
+		if _, err := parseTemplate(msg, false); err != nil {
+			return err
+		}
+		an.message = msg
+	}
+
+	return nil
+}
+
+// SetPromptFunc sets how the node asks for approval. The workflow executor
+// uses it to hand the prompt to its interaction manager.
+func (an *ApprovalNode) SetPromptFunc(fn func(ctx context.Context, message string) (types.PromptResponse, error)) {
+	an.prompt = fn
+}
+
+// Execute asks for approval, with the message rendered against the input,
+// and waits for the answer
+func (an *ApprovalNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	if an.prompt == nil {
+		return nil, fmt.Errorf("approval node requires a workflow executor that can prompt")
+	}
+
+	message, err := RenderTemplate(an.message, inputs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := an.prompt(ctx, message)
+	if err != nil {
+		return nil, fmt.Errorf("approval not given: %w", err)
+	}
+
+	branch := "rejected"
+	if response.Approved {
+		branch = "approved"
+	}
+	return map[string]interface{}{
+		"approved": response.Approved,
+		"comment":  response.Comment,
+		"data":     response.Data,
+		"branch":   branch,
+	}, nil
+}
+
+// GetType returns the type of the node
+func (an *ApprovalNode) GetType() string {
+	return an.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (an *ApprovalNode) GetID() string {
+	return an.id
+}
+
+// NewApprovalNode creates a new approval node constructor for the registry
+func NewApprovalNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &ApprovalNode{
+		id:       fmt.Sprintf("approval_%d", time.Now().UnixNano()),
+		nodeType: "approval",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
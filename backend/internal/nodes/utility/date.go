@@ -0,0 +1,315 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+	// The runtime images have no zoneinfo of their own
+	_ "time/tzdata"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// Operations of the date node
+const (
+	DateFormat          = "format"
+	DateAdd             = "add"
+	DateAddBusinessDays = "add_business_days"
+	DateDiff            = "diff"
+)
+
+// holidayLayout is the layout of the dates in the holidays of a date node
+const holidayLayout = "2006-01-02"
+
+// DateNode implements a node that parses, shifts and compares dates in an
+// IANA time zone.
+//
+// Dates are read from input fields as strings in the node's layout, as Unix
+// timestamps or as time.Time values; a missing date is the current time.
+// Strings without a zone are local times of the node's time zone. Local
+// times that do not exist, because the clocks were put forward, are moved
+// forward by the length of the gap; ambiguous ones, repeated because the
+// clocks were put back, are the earlier of the two.
+type DateNode struct {
+	id        string
+	nodeType  string
+	operation string
+	location  *time.Location
+	layout    string
+	dateField string
+	endField  string
+	days      int
+	hours     float64
+	minutes   float64
+	holidays  map[string]bool
+	config    map[string]interface{}
+}
+
+// Initialize sets up the date node with configuration
+func (d *DateNode) Initialize(config map[string]interface{}) error {
+	d.config = config
+
+	d.operation = DateFormat
+	if operation, ok := config["operation"]; ok {
+		op, ok := operation.(string)
+		if !ok {
+			return fmt.Errorf("operation must be a string")
+		}
+		switch op {
+		case DateFormat, DateAdd, DateAddBusinessDays, DateDiff:
+			d.operation = op
+		default:
+			return fmt.Errorf("unsupported operation: %s", op)
+		}
+	}
+
+	d.location = time.UTC
+	if timezone, ok := config["timezone"]; ok {
+		name, ok := timezone.(string)
+		if !ok {
+			return fmt.Errorf("timezone must be a string")
+		}
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("unknown timezone %q", name)
+		}
+		d.location = location
+	}
+
+	var err error
+	if d.layout, err = stringConfig(config, "layout", time.RFC3339); err != nil {
+		return err
+	}
+	if d.dateField, err = stringConfig(config, "date_field", "date"); err != nil {
+		return err
+	}
+	if d.endField, err = stringConfig(config, "end_field", "end"); err != nil {
+		return err
+	}
+
+	if days, ok := config["days"]; ok {
+		n, err := toFloat64(days)
+		if err != nil || n != math.Trunc(n) {
+			return fmt.Errorf("days must be an integer")
+		}
+		d.days = int(n)
+	}
+	if hours, ok := config["hours"]; ok {
+		if d.hours, err = toFloat64(hours); err != nil {
+			return fmt.Errorf("hours must be a number")
+		}
+	}
+	if minutes, ok := config["minutes"]; ok {
+		if d.minutes, err = toFloat64(minutes); err != nil {
+			return fmt.Errorf("minutes must be a number")
+		}
+	}
+
+	d.holidays = make(map[string]bool)
+	if holidays, ok := config["holidays"]; ok {
+		list, ok := holidays.([]interface{})
+		if !ok {
+			return fmt.Errorf("holidays must be a list of dates")
+		}
+		for _, holiday := range list {
+			s, _ := holiday.(string)
+			if _, err := time.Parse(holidayLayout, s); err != nil {
+				return fmt.Errorf("holiday %v is not a date in the %s format", holiday, holidayLayout)
+			}
+			d.holidays[s] = true
+		}
+	}
+
+	return nil
+}
+
+// stringConfig returns the string config value of key, or fallback
+func stringConfig(config map[string]interface{}, key, fallback string) (string, error) {
+	value, ok := config[key]
+	if !ok {
+		return fallback, nil
+	}
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("%s must be a non-empty string", key)
+	}
+	return s, nil
+}
+
+// Execute performs the date operation
+func (d *DateNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	date, err := d.readDate(inputs, d.dateField)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.operation {
+	case DateAdd:
+		// Days move the calendar date and keep the local time; hours and
+		// minutes are elapsed time
+		year, month, day := date.Date()
+		hour, min, sec := date.Clock()
+		date = resolveLocalTime(year, month, day+d.days, hour, min, sec, date.Nanosecond(), d.location)
+		date = date.Add(time.Duration((d.hours*60 + d.minutes) * float64(time.Minute)))
+	case DateAddBusinessDays:
+		date = d.addBusinessDays(date, d.days)
+	case DateDiff:
+		end, err := d.readDate(inputs, d.endField)
+		if err != nil {
+			return nil, err
+		}
+		return d.diff(date, end), nil
+	}
+
+	return d.describe(date), nil
+}
+
+// readDate reads the date in field of inputs, in the node's time zone
+func (d *DateNode) readDate(inputs map[string]interface{}, field string) (time.Time, error) {
+	value := lookupField(inputs, field)
+	switch v := value.(type) {
+	case nil:
+		return time.Now().In(d.location), nil
+	case time.Time:
+		return v.In(d.location), nil
+	case string:
+		return d.parse(v)
+	}
+	if seconds, err := toFloat64(value); err == nil {
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*1e9)).In(d.location), nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be a date string or a Unix timestamp, not %T", field, value)
+}
+
+// parse parses s in the node's layout. Strings without a zone are local
+// times of the node's time zone.
+func (d *DateNode) parse(s string) (time.Time, error) {
+	// Times parsed in this zone carried no zone of their own
+	noZone := time.FixedZone("", 1)
+	parsed, err := time.ParseInLocation(d.layout, s, noZone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %q does not match layout %q", s, d.layout)
+	}
+	if parsed.Location() != noZone {
+		return parsed.In(d.location), nil
+	}
+
+	year, month, day := parsed.Date()
+	hour, min, sec := parsed.Clock()
+	return resolveLocalTime(year, month, day, hour, min, sec, parsed.Nanosecond(), d.location), nil
+}
+
+// resolveLocalTime returns the instant of a local time in location, like
+// time.Date. Local times skipped by a transition are moved forward by the
+// length of the gap, and the earlier instant of repeated ones is chosen.
+func resolveLocalTime(year int, month time.Month, day, hour, min, sec, nsec int, location *time.Location) time.Time {
+	wall := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+
+	// A local time is valid with the offsets in force around it
+	_, before := wall.Add(-24 * time.Hour).In(location).Zone()
+	_, after := wall.Add(24 * time.Hour).In(location).Zone()
+
+	var resolved time.Time
+	for _, offset := range []int{before, after} {
+		candidate := wall.Add(-time.Duration(offset) * time.Second)
+		if _, actual := candidate.In(location).Zone(); actual != offset {
+			continue
+		}
+		if resolved.IsZero() || candidate.Before(resolved) {
+			resolved = candidate
+		}
+	}
+	if resolved.IsZero() {
+		// Within a gap: read with the offset before it, the local time is
+		// as far past the transition as it was meant to be
+		resolved = wall.Add(-time.Duration(before) * time.Second)
+	}
+	return resolved.In(location)
+}
+
+// addBusinessDays moves date by days business days, skipping weekends and
+// holidays and keeping its local time. With no days to add, dates that are
+// not business days are moved to the next one.
+func (d *DateNode) addBusinessDays(date time.Time, days int) time.Time {
+	step := 1
+	if days < 0 {
+		step, days = -1, -days
+	}
+
+	year, month, day := date.Date()
+	hour, min, sec := date.Clock()
+	for days > 0 || !d.isBusinessDay(time.Date(year, month, day, 0, 0, 0, 0, time.UTC)) {
+		day += step
+		if d.isBusinessDay(time.Date(year, month, day, 0, 0, 0, 0, time.UTC)) {
+			days--
+		}
+	}
+	return resolveLocalTime(year, month, day, hour, min, sec, date.Nanosecond(), d.location)
+}
+
+// isBusinessDay reports whether the calendar date of day is a weekday that
+// is not a holiday
+func (d *DateNode) isBusinessDay(day time.Time) bool {
+	weekday := day.Weekday()
+	return weekday != time.Saturday && weekday != time.Sunday && !d.holidays[day.Format(holidayLayout)]
+}
+
+// diff returns the time from start to end, both as elapsed time and as the
+// number of calendar days between their local dates
+func (d *DateNode) diff(start, end time.Time) map[string]interface{} {
+	elapsed := end.Sub(start)
+	startYear, startMonth, startDay := start.Date()
+	endYear, endMonth, endDay := end.Date()
+	startDate := time.Date(startYear, startMonth, startDay, 0, 0, 0, 0, time.UTC)
+	endDate := time.Date(endYear, endMonth, endDay, 0, 0, 0, 0, time.UTC)
+
+	return map[string]interface{}{
+		"duration": elapsed.String(),
+		"seconds":  elapsed.Seconds(),
+		"hours":    elapsed.Hours(),
+		"days":     int(endDate.Sub(startDate).Hours() / 24),
+		"start":    start.Format(d.layout),
+		"end":      end.Format(d.layout),
+		"timezone": d.location.String(),
+	}
+}
+
+// describe returns the output describing date
+func (d *DateNode) describe(date time.Time) map[string]interface{} {
+	zone, offset := date.Zone()
+	return map[string]interface{}{
+		"result":     date.Format(d.layout),
+		"iso":        date.Format(time.RFC3339),
+		"timestamp":  date.Unix(),
+		"timezone":   d.location.String(),
+		"zone":       zone,
+		"utc_offset": offset,
+		"weekday":    date.Weekday().String(),
+	}
+}
+
+// GetType returns the type of the node
+func (d *DateNode) GetType() string {
+	return d.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (d *DateNode) GetID() string {
+	return d.id
+}
+
+// NewDateNode creates a new date node constructor for the registry
+func NewDateNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &DateNode{
+		id:       fmt.Sprintf("date_%d", time.Now().UnixNano()),
+		nodeType: "date",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
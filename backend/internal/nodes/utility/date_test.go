@@ -0,0 +1,137 @@
+package utility
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func executeDate(t *testing.T, config map[string]interface{}, inputs map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	node, err := NewDateNode(config)
+	require.NoError(t, err)
+	output, err := node.Execute(context.Background(), inputs)
+	require.NoError(t, err)
+	return output
+}
+
+func TestDateConvertsBetweenTimezones(t *testing.T) {
+	tests := []struct {
+		timezone string
+		result   string
+		zone     string
+	}{
+		{"UTC", "2024-07-01T12:00:00Z", "UTC"},
+		{"Europe/Amsterdam", "2024-07-01T14:00:00+02:00", "CEST"},
+		{"America/New_York", "2024-07-01T08:00:00-04:00", "EDT"},
+		{"Asia/Kolkata", "2024-07-01T17:30:00+05:30", "IST"},
+	}
+
+	for _, tt := range tests {
+		output := executeDate(t, map[string]interface{}{"timezone": tt.timezone}, map[string]interface{}{"date": "2024-07-01T12:00:00Z"})
+		assert.Equal(t, tt.result, output["result"], tt.timezone)
+		assert.Equal(t, tt.zone, output["zone"], tt.timezone)
+		assert.Equal(t, int64(1719835200), output["timestamp"], tt.timezone)
+	}
+
+	// Dates without a zone are local times of the node's time zone
+	output := executeDate(t, map[string]interface{}{"timezone": "Asia/Tokyo", "layout": "2006-01-02 15:04"},
+		map[string]interface{}{"date": "2024-07-01 09:00"})
+	assert.Equal(t, "2024-07-01T09:00:00+09:00", output["iso"])
+	assert.Equal(t, 9*3600, output["utc_offset"])
+
+	_, err := NewDateNode(map[string]interface{}{"timezone": "Mars/Olympus_Mons"})
+	assert.EqualError(t, err, `unknown timezone "Mars/Olympus_Mons"`)
+}
+
+func TestDateResolvesLocalTimesAroundDST(t *testing.T) {
+	config := map[string]interface{}{"timezone": "America/New_York", "layout": "2006-01-02 15:04"}
+
+	// 02:30 does not exist on 10 March 2024: clocks went from 02:00 to 03:00
+	output := executeDate(t, config, map[string]interface{}{"date": "2024-03-10 02:30"})
+	assert.Equal(t, "2024-03-10T03:30:00-04:00", output["iso"])
+
+	// 01:30 happened twice on 3 November 2024; the first is in daylight time
+	output = executeDate(t, config, map[string]interface{}{"date": "2024-11-03 01:30"})
+	assert.Equal(t, "2024-11-03T01:30:00-04:00", output["iso"])
+
+	// Times on either side are unaffected
+	output = executeDate(t, config, map[string]interface{}{"date": "2024-11-03 02:30"})
+	assert.Equal(t, "2024-11-03T02:30:00-05:00", output["iso"])
+	output = executeDate(t, map[string]interface{}{"timezone": "Australia/Sydney", "layout": "2006-01-02 15:04"},
+		map[string]interface{}{"date": "2024-04-07 02:30"})
+	assert.Equal(t, "2024-04-07T02:30:00+11:00", output["iso"], "southern hemisphere overlap")
+}
+
+func TestDateAddKeepsLocalTimeAcrossDST(t *testing.T) {
+	config := map[string]interface{}{"timezone": "Europe/Amsterdam", "operation": DateAdd, "days": float64(1)}
+	output := executeDate(t, config, map[string]interface{}{"date": "2024-03-30T12:00:00+01:00"})
+	assert.Equal(t, "2024-03-31T12:00:00+02:00", output["result"], "a day is 23 hours here")
+
+	config = map[string]interface{}{"timezone": "Europe/Amsterdam", "operation": DateAdd, "hours": float64(24)}
+	output = executeDate(t, config, map[string]interface{}{"date": "2024-03-30T12:00:00+01:00"})
+	assert.Equal(t, "2024-03-31T13:00:00+02:00", output["result"], "hours are elapsed time")
+
+	config = map[string]interface{}{"operation": DateAdd, "days": float64(-1), "minutes": float64(90)}
+	output = executeDate(t, config, map[string]interface{}{"date": float64(1719835200)})
+	assert.Equal(t, "2024-06-30T13:30:00Z", output["result"])
+}
+
+func TestDateAddBusinessDays(t *testing.T) {
+	tests := []struct {
+		name     string
+		date     string
+		days     float64
+		holidays []interface{}
+		want     string
+		weekday  string
+	}{
+		{"within a week", "2024-07-01T09:00:00Z", 3, nil, "2024-07-04T09:00:00Z", "Thursday"},
+		{"over a weekend", "2024-07-05T09:00:00Z", 1, nil, "2024-07-08T09:00:00Z", "Monday"},
+		{"from a saturday", "2024-07-06T09:00:00Z", 1, nil, "2024-07-08T09:00:00Z", "Monday"},
+		{"zero days on a sunday", "2024-07-07T09:00:00Z", 0, nil, "2024-07-08T09:00:00Z", "Monday"},
+		{"backwards", "2024-07-08T09:00:00Z", -1, nil, "2024-07-05T09:00:00Z", "Friday"},
+		{"over holidays", "2024-12-24T09:00:00Z", 1, []interface{}{"2024-12-25", "2024-12-26"}, "2024-12-27T09:00:00Z", "Friday"},
+	}
+
+	for _, tt := range tests {
+		config := map[string]interface{}{"operation": DateAddBusinessDays, "days": tt.days}
+		if tt.holidays != nil {
+			config["holidays"] = tt.holidays
+		}
+		output := executeDate(t, config, map[string]interface{}{"date": tt.date})
+		assert.Equal(t, tt.want, output["result"], tt.name)
+		assert.Equal(t, tt.weekday, output["weekday"], tt.name)
+	}
+
+	// Business days are counted on the local calendar
+	output := executeDate(t, map[string]interface{}{"operation": DateAddBusinessDays, "days": float64(1), "timezone": "Asia/Tokyo"},
+		map[string]interface{}{"date": "2024-07-05T20:00:00Z"})
+	assert.Equal(t, "2024-07-08T05:00:00+09:00", output["result"], "Friday evening in UTC is Saturday in Tokyo")
+
+	_, err := NewDateNode(map[string]interface{}{"operation": DateAddBusinessDays, "holidays": []interface{}{"25/12/2024"}})
+	assert.Error(t, err)
+}
+
+func TestDateDiff(t *testing.T) {
+	config := map[string]interface{}{"operation": DateDiff, "timezone": "America/New_York", "layout": "2006-01-02 15:04"}
+	output := executeDate(t, config, map[string]interface{}{"date": "2024-03-09 12:00", "end": "2024-03-10 12:00"})
+	assert.Equal(t, "23h0m0s", output["duration"])
+	assert.Equal(t, float64(23*3600), output["seconds"])
+	assert.Equal(t, 1, output["days"])
+
+	output = executeDate(t, map[string]interface{}{"operation": DateDiff, "end_field": "deadline.at"}, map[string]interface{}{
+		"date":     "2024-07-02T00:00:00Z",
+		"deadline": map[string]interface{}{"at": "2024-07-01T18:00:00Z"},
+	})
+	assert.Equal(t, "-6h0m0s", output["duration"])
+	assert.Equal(t, -1, output["days"])
+
+	node, err := NewDateNode(config)
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), map[string]interface{}{"date": "tomorrow"})
+	assert.EqualError(t, err, `date "tomorrow" does not match layout "2006-01-02 15:04"`)
+}
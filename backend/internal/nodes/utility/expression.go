@@ -0,0 +1,124 @@
+package utility
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// jsonPathWildcard matches "[*]" (JSONPath) and "[]" (jq) array iterators
+	jsonPathWildcard = regexp.MustCompile(`\[\*?\]`)
+	// jsonPathIndex matches numeric array indexes such as "[0]"
+	jsonPathIndex = regexp.MustCompile(`\[(\d+)\]`)
+	// jsonPathQuotedKey matches bracketed keys such as "['name']" or ["name"]
+	jsonPathQuotedKey = regexp.MustCompile(`\[['"]([^'"\]]+)['"]\]`)
+	// jsonPathFilter matches filter expressions such as "[?(@.age > 30)]"
+	jsonPathFilter = regexp.MustCompile(`\[\?\((.*?)\)\]`)
+)
+
+// normalizeExpression converts JSONPath ("$.items[*].id") and jq-style
+// (".items[].id") expressions into gjson path syntax ("items.#.id").
+// Expressions already written in gjson syntax are returned unchanged.
+func normalizeExpression(expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return "", fmt.Errorf("expression cannot be empty")
+	}
+
+	if err := checkBalanced(expr); err != nil {
+		return "", fmt.Errorf("malformed expression %q: %w", expr, err)
+	}
+
+	if !strings.HasPrefix(expr, "$") && !strings.HasPrefix(expr, ".") {
+		return expr, nil
+	}
+
+	if strings.Contains(expr, "..") {
+		return "", fmt.Errorf("malformed expression %q: recursive descent is not supported", expr)
+	}
+
+	path := strings.TrimPrefix(expr, "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		// "$" and "." select the whole document
+		return "@this", nil
+	}
+
+	path = jsonPathFilter.ReplaceAllStringFunc(path, func(filter string) string {
+		cond := jsonPathFilter.FindStringSubmatch(filter)[1]
+		cond = strings.ReplaceAll(cond, "@.", "")
+		cond = strings.ReplaceAll(cond, "'", `"`)
+		return ".#(" + cond + ")#"
+	})
+	path = jsonPathQuotedKey.ReplaceAllString(path, ".$1")
+	path = jsonPathWildcard.ReplaceAllString(path, ".#")
+	path = jsonPathIndex.ReplaceAllString(path, ".$1")
+	path = strings.TrimPrefix(path, ".")
+
+	return path, nil
+}
+
+// checkBalanced verifies that brackets, braces, parentheses and quotes in the
+// expression are properly paired
+func checkBalanced(expr string) error {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	var stack []rune
+	var quote rune
+
+	for i, r := range expr {
+		if quote != 0 {
+			if r == quote && (i == 0 || expr[i-1] != '\\') {
+				quote = 0
+			}
+			continue
+		}
+
+		switch r {
+		case '"', '\'':
+			quote = r
+		case '(', '[', '{':
+			stack = append(stack, r)
+		case ')', ']', '}':
+			if len(stack) == 0 || stack[len(stack)-1] != pairs[r] {
+				return fmt.Errorf("unexpected %q at position %d", r, i)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if quote != 0 {
+		return fmt.Errorf("unterminated string")
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q", stack[len(stack)-1])
+	}
+
+	return nil
+}
+
+// evaluateExpression applies a JSONPath, jq-style or gjson expression to data.
+// Besides field extraction, gjson syntax supports array mapping
+// ("items.#.id"), filtering ("items.#(age>30)#") and building new object
+// shapes with renamed fields ("{name:user.name,ids:items.#.id}").
+func evaluateExpression(expr string, data interface{}) (interface{}, error) {
+	path, err := normalizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input data: %w", err)
+	}
+
+	result := gjson.GetBytes(raw, path)
+	if !result.Exists() {
+		return nil, nil
+	}
+
+	return result.Value(), nil
+}
@@ -0,0 +1,170 @@
+package utility
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flattenData converts nested maps and arrays into a single-level map. Map
+// keys are joined with separator ("user.address.city") and array elements
+// use bracketed indexes ("items[0].id"). Keys are limited to maxDepth
+// segments and anything nested deeper is kept as-is; a maxDepth of 0 means
+// unlimited.
+func flattenData(data map[string]interface{}, separator string, maxDepth int) map[string]interface{} {
+	output := make(map[string]interface{})
+	for key, value := range data {
+		flattenValue(output, key, value, separator, maxDepth, 1)
+	}
+	return output
+}
+
+func flattenValue(output map[string]interface{}, prefix string, value interface{}, separator string, maxDepth, depth int) {
+	if maxDepth > 0 && depth >= maxDepth {
+		output[prefix] = value
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			output[prefix] = v
+			return
+		}
+		for key, nested := range v {
+			flattenValue(output, prefix+separator+key, nested, separator, maxDepth, depth+1)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			output[prefix] = v
+			return
+		}
+		for i, nested := range v {
+			flattenValue(output, fmt.Sprintf("%s[%d]", prefix, i), nested, separator, maxDepth, depth+1)
+		}
+	default:
+		output[prefix] = value
+	}
+}
+
+// maxUnflattenIndex bounds array indexes accepted by unflatten so a single
+// key such as "items[999999999]" can't allocate a huge slice
+const maxUnflattenIndex = 100000
+
+// flattenKeySegment is one step of a flattened key: either a map key or an
+// array index
+type flattenKeySegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseFlattenKey splits a flattened key such as "items[0].id" into segments
+func parseFlattenKey(key, separator string) ([]flattenKeySegment, error) {
+	var segments []flattenKeySegment
+
+	for _, part := range strings.Split(key, separator) {
+		name := part
+		var indexes []int
+
+		// Peel off trailing [n] suffixes
+		for strings.HasSuffix(name, "]") {
+			open := strings.LastIndex(name, "[")
+			if open < 0 {
+				return nil, fmt.Errorf("invalid key %q: unmatched ']'", key)
+			}
+			index, err := strconv.Atoi(name[open+1 : len(name)-1])
+			if err != nil || index < 0 || index > maxUnflattenIndex {
+				return nil, fmt.Errorf("invalid key %q: bad array index %q", key, name[open:])
+			}
+			indexes = append([]int{index}, indexes...)
+			name = name[:open]
+		}
+
+		if name != "" {
+			segments = append(segments, flattenKeySegment{key: name})
+		} else if len(indexes) == 0 || len(segments) == 0 {
+			return nil, fmt.Errorf("invalid key %q: empty segment", key)
+		}
+		for _, index := range indexes {
+			segments = append(segments, flattenKeySegment{index: index, isIndex: true})
+		}
+	}
+
+	return segments, nil
+}
+
+// unflattenData is the inverse of flattenData: it rebuilds nested maps and
+// arrays from keys such as "user.address.city" and "items[0].id"
+func unflattenData(data map[string]interface{}, separator string) (map[string]interface{}, error) {
+	// Process keys in sorted order so conflicts are reported deterministically
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var root interface{} = make(map[string]interface{})
+	for _, key := range keys {
+		segments, err := parseFlattenKey(key, separator)
+		if err != nil {
+			return nil, err
+		}
+
+		root, err = setFlattenPath(root, segments, data[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", key, err)
+		}
+	}
+
+	return root.(map[string]interface{}), nil
+}
+
+// setFlattenPath stores value at the path described by segments inside
+// container, creating intermediate maps and arrays as needed. It returns the
+// possibly reallocated container.
+func setFlattenPath(container interface{}, segments []flattenKeySegment, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+
+	segment := segments[0]
+	if segment.isIndex {
+		var arr []interface{}
+		switch c := container.(type) {
+		case nil:
+		case []interface{}:
+			arr = c
+		default:
+			return nil, fmt.Errorf("cannot index into %T", container)
+		}
+		for len(arr) <= segment.index {
+			arr = append(arr, nil)
+		}
+
+		child, err := setFlattenPath(arr[segment.index], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		arr[segment.index] = child
+		return arr, nil
+	}
+
+	var obj map[string]interface{}
+	switch c := container.(type) {
+	case nil:
+		obj = make(map[string]interface{})
+	case map[string]interface{}:
+		obj = c
+	default:
+		return nil, fmt.Errorf("cannot set field %q on %T", segment.key, container)
+	}
+
+	child, err := setFlattenPath(obj[segment.key], segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	obj[segment.key] = child
+	return obj, nil
+}
@@ -3,6 +3,8 @@ package utility
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"citadel-agent/backend/internal/interfaces"
@@ -10,11 +12,20 @@ import (
 
 // ForEachNode implements a node that iterates over a collection
 type ForEachNode struct {
-	id            string
-	nodeType      string
-	collectionKey string
-	itemKey       string
-	config        map[string]interface{}
+	id              string
+	nodeType        string
+	collectionKey   string
+	itemKey         string
+	maxConcurrency  int
+	continueOnError bool
+	iterate         func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)
+	config          map[string]interface{}
+}
+
+// iterationError records a failed iteration
+type iterationError struct {
+	index int
+	err   error
 }
 
 // Initialize sets up the for each node with configuration
@@ -42,9 +53,33 @@ func (fe *ForEachNode) Initialize(config map[string]interface{}) error {
 		fe.itemKey = "item" // default item key
 	}
 
+	fe.maxConcurrency = 1
+	if maxConcurrency, ok := config["max_concurrency"]; ok {
+		n, err := toFloat64(maxConcurrency)
+		if err != nil || n < 1 || n != float64(int(n)) {
+			return fmt.Errorf("max_concurrency must be a positive integer")
+		}
+		fe.maxConcurrency = int(n)
+	}
+
+	if continueOnError, ok := config["continue_on_error"]; ok {
+		if c, ok := continueOnError.(bool); ok {
+			fe.continueOnError = c
+		} else {
+			return fmt.Errorf("continue_on_error must be a boolean")
+		}
+	}
+
 	return nil
 }
 
+// SetIterationFunc sets the loop body executed once per item. The workflow
+// executor uses it to run the nodes connected to the "body" output port.
+// Without a body, each iteration returns its item context.
+func (fe *ForEachNode) SetIterationFunc(fn func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)) {
+	fe.iterate = fn
+}
+
 // Execute iterates over the collection and processes each item
 func (fe *ForEachNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
 	var collection []interface{}
@@ -68,29 +103,84 @@ func (fe *ForEachNode) Execute(ctx context.Context, inputs map[string]interface{
 		collection = []interface{}{inputs}
 	}
 
-	// Process each item in the collection
-	results := make([]interface{}, 0, len(collection))
+	// Process each item in the collection, keeping results in input order
+	results := make([]interface{}, len(collection))
+	var (
+		mu     sync.Mutex
+		failed []iterationError
+	)
+
+	iterCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, fe.maxConcurrency)
+	var wg sync.WaitGroup
 
 	for i, item := range collection {
-		// Create a context for this iteration
-		itemContext := map[string]interface{}{
-			fe.itemKey: item,
-			"index":    i,
-			"total":    len(collection),
-			"first":    i == 0,
-			"last":     i == len(collection)-1,
+		select {
+		case sem <- struct{}{}:
+		case <-iterCtx.Done():
+		}
+		if iterCtx.Err() != nil {
+			break
 		}
 
-		// Add the original input data as well
-		itemContext["original_input"] = inputs
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Create a context for this iteration
+			itemContext := map[string]interface{}{
+				fe.itemKey: item,
+				"index":    i,
+				"total":    len(collection),
+				"first":    i == 0,
+				"last":     i == len(collection)-1,
+			}
+
+			// Add the original input data as well
+			itemContext["original_input"] = inputs
+
+			result, err := fe.runIteration(iterCtx, itemContext)
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, iterationError{index: i, err: err})
+				mu.Unlock()
+				if !fe.continueOnError {
+					cancel()
+				}
+				return
+			}
+
+			results[i] = result
+		}(i, item)
+	}
+	wg.Wait()
+
+	sort.Slice(failed, func(a, b int) bool { return failed[a].index < failed[b].index })
 
-		results = append(results, itemContext)
+	if len(failed) > 0 && !fe.continueOnError {
+		return nil, fmt.Errorf("iteration %d failed: %w", failed[0].index, failed[0].err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	errorList := make([]interface{}, 0, len(failed))
+	for _, f := range failed {
+		errorList = append(errorList, map[string]interface{}{
+			"index": f.index,
+			"error": f.err.Error(),
+		})
 	}
 
 	// Prepare output
 	output := map[string]interface{}{
 		"results":         results,
-		"processed_count": len(results),
+		"processed_count": len(collection) - len(failed),
+		"error_count":     len(failed),
+		"errors":          errorList,
 		"original_input":  inputs,
 		"collection_key":  fe.collectionKey,
 		"item_key":        fe.itemKey,
@@ -99,6 +189,21 @@ func (fe *ForEachNode) Execute(ctx context.Context, inputs map[string]interface{
 	return output, nil
 }
 
+// runIteration executes the loop body for one item
+func (fe *ForEachNode) runIteration(ctx context.Context, itemContext map[string]interface{}) (result map[string]interface{}, err error) {
+	if fe.iterate == nil {
+		return itemContext, nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("iteration panicked: %v", r)
+		}
+	}()
+
+	return fe.iterate(ctx, itemContext)
+}
+
 // GetType returns the type of the node
 func (fe *ForEachNode) GetType() string {
 	return fe.nodeType
@@ -0,0 +1,124 @@
+package utility
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestForEach(t *testing.T, config map[string]interface{}, body func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)) *ForEachNode {
+	t.Helper()
+
+	node, err := NewForEachNode(config)
+	require.NoError(t, err)
+
+	forEach := node.(*ForEachNode)
+	forEach.SetIterationFunc(body)
+	return forEach
+}
+
+func TestForEachSequentialCollectsResults(t *testing.T) {
+	var order []interface{}
+	node := newTestForEach(t, map[string]interface{}{"collection_key": "items", "item_key": "n"},
+		func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+			order = append(order, item["n"])
+			return map[string]interface{}{"double": item["n"].(int) * 2, "index": item["index"]}, nil
+		})
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{"items": []interface{}{1, 2, 3}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{1, 2, 3}, order)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"double": 2, "index": 0},
+		map[string]interface{}{"double": 4, "index": 1},
+		map[string]interface{}{"double": 6, "index": 2},
+	}, output["results"])
+	assert.Equal(t, 3, output["processed_count"])
+	assert.Equal(t, 0, output["error_count"])
+}
+
+func TestForEachConcurrentKeepsOrderAndBound(t *testing.T) {
+	var running, peak int32
+	node := newTestForEach(t, map[string]interface{}{"collection_key": "items", "max_concurrency": float64(3)},
+		func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+
+			// Later items finish first
+			time.Sleep(time.Duration(10-item["index"].(int)) * time.Millisecond)
+			return map[string]interface{}{"value": item["item"]}, nil
+		})
+
+	items := make([]interface{}, 10)
+	for i := range items {
+		items[i] = fmt.Sprintf("item-%d", i)
+	}
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{"items": items})
+	require.NoError(t, err)
+
+	results := output["results"].([]interface{})
+	require.Len(t, results, 10)
+	for i, result := range results {
+		assert.Equal(t, map[string]interface{}{"value": items[i]}, result)
+	}
+	assert.LessOrEqual(t, peak, int32(3))
+	assert.Greater(t, peak, int32(1))
+}
+
+func TestForEachContinueOnErrorAggregatesErrors(t *testing.T) {
+	body := func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+		if item["item"].(int)%2 == 0 {
+			return nil, errors.New("even item")
+		}
+		return map[string]interface{}{"ok": item["item"]}, nil
+	}
+
+	node := newTestForEach(t, map[string]interface{}{
+		"collection_key":    "items",
+		"max_concurrency":   2,
+		"continue_on_error": true,
+	}, body)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{"items": []interface{}{1, 2, 3, 4}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"ok": 1},
+		nil,
+		map[string]interface{}{"ok": 3},
+		nil,
+	}, output["results"])
+	assert.Equal(t, 2, output["processed_count"])
+	assert.Equal(t, 2, output["error_count"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"index": 1, "error": "even item"},
+		map[string]interface{}{"index": 3, "error": "even item"},
+	}, output["errors"])
+
+	abort := newTestForEach(t, map[string]interface{}{"collection_key": "items"}, body)
+	_, err = abort.Execute(context.Background(), map[string]interface{}{"items": []interface{}{1, 2, 3, 4}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "iteration 1 failed")
+}
+
+func TestForEachRejectsInvalidConcurrency(t *testing.T) {
+	_, err := NewForEachNode(map[string]interface{}{"max_concurrency": 0})
+	assert.Error(t, err)
+
+	_, err = NewForEachNode(map[string]interface{}{"continue_on_error": "yes"})
+	assert.Error(t, err)
+}
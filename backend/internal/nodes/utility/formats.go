@@ -0,0 +1,296 @@
+package utility
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats the data transformer parses and serializes
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+)
+
+// formatOptions holds the parameters of the parse and serialize transforms
+type formatOptions struct {
+	// header makes the first CSV record name the fields of the others, so
+	// that rows are objects rather than arrays
+	header bool
+	// delimiter separates CSV fields
+	delimiter rune
+	// coerce converts CSV fields that look like numbers, booleans or null
+	// to those types
+	coerce bool
+	// columns orders the CSV columns of serialized objects; by default
+	// they are the sorted keys of all rows
+	columns []string
+	// indent indents serialized JSON
+	indent string
+}
+
+// parseFormat parses text in format into the structured data used by nodes:
+// objects are map[string]interface{}, arrays []interface{} and numbers
+// float64
+func parseFormat(format, text string, options formatOptions) (interface{}, error) {
+	switch format {
+	case FormatJSON:
+		var data interface{}
+		if err := json.Unmarshal([]byte(text), &data); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line, column := position(text, syntaxErr.Offset)
+				return nil, fmt.Errorf("invalid JSON at line %d, column %d: %v", line, column, err)
+			}
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		return data, nil
+	case FormatYAML:
+		var data interface{}
+		if err := yaml.Unmarshal([]byte(text), &data); err != nil {
+			// yaml errors carry their line already
+			return nil, fmt.Errorf("invalid YAML: %v", strings.TrimPrefix(err.Error(), "yaml: "))
+		}
+		return normalizeYAML(data), nil
+	case FormatCSV:
+		return parseCSV(text, options)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// position returns the line and column of the byte at offset in text, both
+// counted from 1
+func position(text string, offset int64) (int, int) {
+	if offset > int64(len(text)) {
+		offset = int64(len(text))
+	}
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:])
+	if column == 0 {
+		column = 1
+	}
+	return line, column
+}
+
+// normalizeYAML converts decoded YAML to the types JSON decodes to
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return object
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return value
+}
+
+// parseCSV parses CSV records into arrays of fields, or objects keyed by
+// the header
+func parseCSV(text string, options formatOptions) (interface{}, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = options.delimiter
+	records, err := reader.ReadAll()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("invalid CSV at line %d, column %d: %v", parseErr.Line, parseErr.Column, parseErr.Err)
+		}
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+
+	field := func(s string) interface{} {
+		if options.coerce {
+			return coerceField(s)
+		}
+		return s
+	}
+
+	rows := make([]interface{}, 0, len(records))
+	if !options.header {
+		for _, record := range records {
+			row := make([]interface{}, len(record))
+			for i, s := range record {
+				row[i] = field(s)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if seen[name] {
+			return nil, fmt.Errorf("invalid CSV at line 1: duplicate column %q", name)
+		}
+		seen[name] = true
+	}
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			row[name] = field(record[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// coerceField converts a CSV field to a number, boolean or null when it
+// reads as one
+func coerceField(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil && strings.TrimSpace(s) == s {
+		return n
+	}
+	return s
+}
+
+// serializeFormat serializes data in format
+func serializeFormat(format string, data interface{}, options formatOptions) (string, error) {
+	switch format {
+	case FormatJSON:
+		var b []byte
+		var err error
+		if options.indent != "" {
+			b, err = json.MarshalIndent(data, "", options.indent)
+		} else {
+			b, err = json.Marshal(data)
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot serialize as JSON: %v", err)
+		}
+		return string(b), nil
+	case FormatYAML:
+		b, err := yaml.Marshal(data)
+		if err != nil {
+			return "", fmt.Errorf("cannot serialize as YAML: %v", err)
+		}
+		return string(b), nil
+	case FormatCSV:
+		return serializeCSV(data, options)
+	}
+	return "", fmt.Errorf("unsupported format: %s", format)
+}
+
+// serializeCSV writes an array of objects, or of arrays of fields, as CSV.
+// Objects are written below a header of their columns.
+func serializeCSV(data interface{}, options formatOptions) (string, error) {
+	rows, ok := data.([]interface{})
+	if !ok {
+		return "", fmt.Errorf("CSV can only be serialized from an array of rows")
+	}
+
+	var records [][]string
+	columns := options.columns
+	for i, row := range rows {
+		switch r := row.(type) {
+		case map[string]interface{}:
+			if columns == nil {
+				columns = csvColumns(rows)
+			}
+			record := make([]string, len(columns))
+			for j, column := range columns {
+				field, err := csvField(r[column])
+				if err != nil {
+					return "", fmt.Errorf("row %d, column %s: %v", i, column, err)
+				}
+				record[j] = field
+			}
+			records = append(records, record)
+		case []interface{}:
+			record := make([]string, len(r))
+			for j, value := range r {
+				field, err := csvField(value)
+				if err != nil {
+					return "", fmt.Errorf("row %d, column %d: %v", i, j, err)
+				}
+				record[j] = field
+			}
+			records = append(records, record)
+		default:
+			return "", fmt.Errorf("row %d is not an object or an array", i)
+		}
+	}
+	if columns != nil && options.header {
+		records = append([][]string{columns}, records...)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = options.delimiter
+	if err := writer.WriteAll(records); err != nil {
+		return "", fmt.Errorf("cannot serialize as CSV: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// csvColumns returns the sorted keys of the object rows
+func csvColumns(rows []interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range rows {
+		if object, ok := row.(map[string]interface{}); ok {
+			for key := range object {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// csvField formats a value as a CSV field; nested values are written as JSON
+func csvField(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool, int, int64:
+		return fmt.Sprint(v), nil
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
@@ -3,17 +3,21 @@ package utility
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	"citadel-agent/backend/internal/interfaces"
 )
 
-// IfElseNode implements a node that evaluates conditions and returns different outputs
+// IfElseNode implements a node that evaluates conditions and returns different outputs.
+// Its branch is "true" or "false", which downstream edges select as their
+// source handle.
 type IfElseNode struct {
 	id           string
 	nodeType     string
 	condition    string
+	field        string
 	leftValue    interface{}
 	operator     string
 	rightValue   interface{}
@@ -34,6 +38,14 @@ func (ie *IfElseNode) Initialize(config map[string]interface{}) error {
 		}
 	}
 
+	if field, ok := config["field"]; ok {
+		if f, ok := field.(string); ok {
+			ie.field = f
+		} else {
+			return fmt.Errorf("field must be a string")
+		}
+	}
+
 	if leftValue, ok := config["left_value"]; ok {
 		ie.leftValue = leftValue
 	}
@@ -48,6 +60,16 @@ func (ie *IfElseNode) Initialize(config map[string]interface{}) error {
 
 	if rightValue, ok := config["right_value"]; ok {
 		ie.rightValue = rightValue
+	} else if value, ok := config["value"]; ok {
+		ie.rightValue = value
+	}
+
+	if ie.operator == "regex" {
+		if pattern, ok := ie.rightValue.(string); ok && !strings.Contains(pattern, "{{") {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid regex pattern: %v", err)
+			}
+		}
 	}
 
 	if trueResult, ok := config["true_result"]; ok {
@@ -63,21 +85,7 @@ func (ie *IfElseNode) Initialize(config map[string]interface{}) error {
 
 // Execute evaluates the condition and returns appropriate result
 func (ie *IfElseNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
-	// If condition is provided as a string, evaluate it
-	// Otherwise, use the structured condition
-	var conditionResult bool
-
-	if ie.condition != "" {
-		// For now, we'll support simple template replacement in condition
-		// A more robust solution would involve a proper expression evaluator
-		conditionEvaluated := ie.replaceTemplateVariables(ie.condition, inputs)
-
-		// For this implementation, we'll check if the condition is truthy when evaluated
-		conditionResult = conditionEvaluated != "" && conditionEvaluated != "false" && conditionEvaluated != "0"
-	} else {
-		// Use structured condition with left operand, operator, and right operand
-		conditionResult = ie.evaluateStructuredCondition(inputs)
-	}
+	conditionResult := ie.evaluate(inputs)
 
 	// Prepare the result based on the condition
 	result := make(map[string]interface{})
@@ -95,12 +103,31 @@ func (ie *IfElseNode) Execute(ctx context.Context, inputs map[string]interface{}
 	return result, nil
 }
 
+// evaluate reports whether the condition holds for inputs
+func (ie *IfElseNode) evaluate(inputs map[string]interface{}) bool {
+	// If condition is provided as a string, evaluate it
+	// Otherwise, use the structured condition
+	if ie.condition != "" {
+		// For now, we'll support simple template replacement in condition
+		// A more robust solution would involve a proper expression evaluator
+		conditionEvaluated := ie.replaceTemplateVariables(ie.condition, inputs)
+
+		// For this implementation, we'll check if the condition is truthy when evaluated
+		return conditionEvaluated != "" && conditionEvaluated != "false" && conditionEvaluated != "0"
+	}
+
+	// Use structured condition with left operand, operator, and right operand
+	return ie.evaluateStructuredCondition(inputs)
+}
+
 // evaluateStructuredCondition evaluates the structured condition
 func (ie *IfElseNode) evaluateStructuredCondition(inputData map[string]interface{}) bool {
 	// Replace template variables in operands if they're strings
 	var leftVal, rightVal interface{}
 
-	if leftStr, isStr := ie.leftValue.(string); isStr {
+	if ie.field != "" {
+		leftVal = lookupField(inputData, ie.field)
+	} else if leftStr, isStr := ie.leftValue.(string); isStr {
 		leftVal = ie.replaceTemplateVariables(leftStr, inputData)
 	} else {
 		leftVal = ie.leftValue
@@ -136,6 +163,9 @@ func (ie *IfElseNode) evaluateStructuredCondition(inputData map[string]interface
 		return ie.isEmpty(leftVal)
 	case "is_null":
 		return leftVal == nil
+	case "regex":
+		matched, err := regexp.MatchString(fmt.Sprintf("%v", rightVal), fmt.Sprintf("%v", leftVal))
+		return err == nil && matched
 	default:
 		// Default to false for unknown operators
 		return false
@@ -278,6 +308,19 @@ func NewIfElseNode(config map[string]interface{}) (interfaces.NodeInstance, erro
 	return node, nil
 }
 
+// lookupField resolves a dotted path such as "user.address.city" in data
+func lookupField(data map[string]interface{}, path string) interface{} {
+	var current interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
 // containsSubstring checks if the main string contains the substring
 func containsSubstring(main, sub string) bool {
 	return len(sub) == 0 || len(main) >= len(sub) &&
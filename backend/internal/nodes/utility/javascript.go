@@ -0,0 +1,222 @@
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"github.com/dop251/goja"
+)
+
+// DefaultScriptTimeout bounds scripts unless configured otherwise, like
+// workflow.timeout_policy.script_timeout of the application config
+const DefaultScriptTimeout = 5 * time.Minute
+
+// maxScriptCallStackSize stops runaway recursion in scripts
+const maxScriptCallStackSize = 1024
+
+// ScriptOptions holds the server-wide settings of JavaScript nodes
+type ScriptOptions struct {
+	// Timeout bounds every script; nodes can only set a shorter one. It
+	// mirrors workflow.timeout_policy.script_timeout of the application
+	// config.
+	Timeout time.Duration
+}
+
+// JavaScriptNode runs a JavaScript snippet against the node inputs.
+//
+// The snippet is the body of a function with the inputs bound to "input";
+// what it returns is the "result" output. Scripts run in a fresh goja VM
+// per execution, with the ECMAScript builtins only: there is no require,
+// and no access to files, the network or the environment of the host.
+// console.log lines are collected in the "logs" output.
+type JavaScriptNode struct {
+	id         string
+	nodeType   string
+	code       string
+	program    *goja.Program
+	timeout    time.Duration
+	maxTimeout time.Duration
+	config     map[string]interface{}
+}
+
+// Initialize sets up the JavaScript node with configuration
+func (j *JavaScriptNode) Initialize(config map[string]interface{}) error {
+	j.config = config
+
+	code, ok := config["code"].(string)
+	if !ok || strings.TrimSpace(code) == "" {
+		return fmt.Errorf("code is required")
+	}
+	j.code = code
+
+	// Catch syntax errors when the node is created rather than on first run
+	program, err := goja.Compile("script", "(function (input) {\n"+code+"\n})", true)
+	if err != nil {
+		return fmt.Errorf("script has a syntax error: %w", err)
+	}
+	j.program = program
+
+	if j.maxTimeout <= 0 {
+		j.maxTimeout = DefaultScriptTimeout
+	}
+	j.timeout = j.maxTimeout
+	if timeout, ok := config["timeout"]; ok {
+		t, ok := timeout.(float64)
+		if !ok || t <= 0 {
+			return fmt.Errorf("timeout must be a positive number of seconds")
+		}
+		if d := time.Duration(t * float64(time.Second)); d < j.timeout {
+			j.timeout = d
+		}
+	}
+
+	return nil
+}
+
+// Execute runs the script. It is interrupted when its timeout passes or
+// ctx is done.
+func (j *JavaScriptNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(maxScriptCallStackSize)
+
+	logs := []interface{}{}
+	console := vm.NewObject()
+	console.Set("log", func(call goja.FunctionCall) goja.Value {
+		parts := make([]string, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			parts[i] = arg.String()
+		}
+		logs = append(logs, strings.Join(parts, " "))
+		return goja.Undefined()
+	})
+	vm.Set("console", console)
+
+	// Hand the inputs over as plain JavaScript values, so the script
+	// cannot change the data of other nodes
+	if inputs == nil {
+		inputs = map[string]interface{}{}
+	}
+	input, err := toScriptValue(vm, inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pass inputs to the script: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(ctx.Err())
+	})
+	defer stop()
+
+	fn, err := vm.RunProgram(j.program)
+	if err != nil {
+		return nil, scriptError(err, j.timeout)
+	}
+	call, _ := goja.AssertFunction(fn)
+	value, err := call(goja.Undefined(), input)
+	if err != nil {
+		return nil, scriptError(err, j.timeout)
+	}
+
+	result, err := fromScriptValue(vm, value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"result": result,
+		"logs":   logs,
+	}, nil
+}
+
+// toScriptValue copies data into the VM through JSON
+func toScriptValue(vm *goja.Runtime, data interface{}) (goja.Value, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	return parse(goja.Undefined(), vm.ToValue(string(encoded)))
+}
+
+// fromScriptValue copies a value out of the VM through JSON, so that
+// numbers come out as float64 like in the rest of the workflow
+func fromScriptValue(vm *goja.Runtime, value goja.Value) (interface{}, error) {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil, nil
+	}
+	stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+	encoded, err := stringify(goja.Undefined(), value)
+	if err != nil {
+		return nil, fmt.Errorf("script result cannot be converted to JSON: %w", err)
+	}
+	if goja.IsUndefined(encoded) {
+		return nil, fmt.Errorf("script result cannot be converted to JSON")
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(encoded.String()), &result); err != nil {
+		return nil, fmt.Errorf("script result cannot be converted to JSON: %w", err)
+	}
+	return result, nil
+}
+
+// scriptError describes an error thrown by or interrupting a script.
+// Scripts stopped by their timeout fail with context.DeadlineExceeded.
+func scriptError(err error, timeout time.Duration) error {
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if cause, ok := interrupted.Value().(error); ok {
+			if errors.Is(cause, context.DeadlineExceeded) {
+				return fmt.Errorf("script timed out after %s: %w", timeout, cause)
+			}
+			return fmt.Errorf("script was interrupted: %w", cause)
+		}
+	}
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		return fmt.Errorf("script failed: %s", exception.Error())
+	}
+	return fmt.Errorf("script failed: %w", err)
+}
+
+// GetType returns the type of the node
+func (j *JavaScriptNode) GetType() string {
+	return j.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (j *JavaScriptNode) GetID() string {
+	return j.id
+}
+
+// NewJavaScriptNode creates a new JavaScript node with the default options
+func NewJavaScriptNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return NewJavaScriptNodeWithOptions(ScriptOptions{})(config)
+}
+
+// NewJavaScriptNodeWithOptions returns the constructor of JavaScript nodes
+// using options
+func NewJavaScriptNodeWithOptions(options ScriptOptions) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = DefaultScriptTimeout
+	}
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &JavaScriptNode{
+			id:         fmt.Sprintf("javascript_%d", time.Now().UnixNano()),
+			nodeType:   "javascript",
+			maxTimeout: timeout,
+		}
+
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	}
+}
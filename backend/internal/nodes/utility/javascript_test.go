@@ -0,0 +1,88 @@
+package utility
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runScript(t *testing.T, config, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+	node, err := NewJavaScriptNode(config)
+	require.NoError(t, err)
+	return node.Execute(context.Background(), inputs)
+}
+
+func TestJavaScriptNodeTransformsData(t *testing.T) {
+	inputs := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": "a", "total": 12.5},
+			map[string]interface{}{"id": "b", "total": 30.0},
+		},
+	}
+	out, err := runScript(t, map[string]interface{}{"code": `
+		const large = input.orders.filter(o => o.total > 20);
+		console.log("large orders:", large.length);
+		input.orders.length = 0;
+		return { ids: large.map(o => o.id), sum: large.reduce((s, o) => s + o.total, 0) };
+	`}, inputs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ids": []interface{}{"b"}, "sum": 30.0}, out["result"])
+	assert.Equal(t, []interface{}{"large orders: 1"}, out["logs"])
+	// The script works on a copy of the inputs
+	assert.Len(t, inputs["orders"], 2)
+
+	out, err = runScript(t, map[string]interface{}{"code": "return input.missing"}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, out["result"])
+}
+
+func TestJavaScriptNodeTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := runScript(t, map[string]interface{}{"code": "while (true) {}", "timeout": 0.1}, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err.Error())
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// Nodes cannot extend the server-wide timeout
+	node, err := NewJavaScriptNodeWithOptions(ScriptOptions{Timeout: 100 * time.Millisecond})(map[string]interface{}{"code": "for (;;) {}", "timeout": 60.0})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err.Error())
+
+	// Cancelling the workflow stops the script too
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	node, err = NewJavaScriptNode(map[string]interface{}{"code": "for (;;) {}"})
+	require.NoError(t, err)
+	_, err = node.Execute(ctx, nil)
+	assert.True(t, errors.Is(err, context.Canceled), err.Error())
+}
+
+func TestJavaScriptNodeErrors(t *testing.T) {
+	_, err := NewJavaScriptNode(map[string]interface{}{"code": "return {"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "syntax error")
+
+	_, err = NewJavaScriptNode(map[string]interface{}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "code is required")
+
+	_, err = runScript(t, map[string]interface{}{"code": `throw new Error("bad order")`}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad order")
+
+	// There is no require, and no host access at all
+	for _, code := range []string{`return require("fs")`, `return process.env`, `return fetch("http://localhost")`} {
+		_, err = runScript(t, map[string]interface{}{"code": code}, nil)
+		require.Error(t, err, code)
+		assert.Contains(t, err.Error(), "is not defined")
+	}
+
+	_, err = runScript(t, map[string]interface{}{"code": "const f = () => f(); return f()"}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// Strategies of the merge node
+const (
+	// MergeAppend concatenates the arrays of the branches into one
+	MergeAppend = "append"
+	// MergeCombineObject shallow-merges the objects of the branches; later
+	// branches win
+	MergeCombineObject = "combine_object"
+	// MergeZip pairs up the items of the arrays of the branches by index
+	MergeZip = "zip"
+	// MergeWaitAll waits for every branch and keys their outputs by source
+	// node
+	MergeWaitAll = "wait_all"
+)
+
+// MergeBranchesKey is the input field the workflow executor delivers the
+// branches leading to a merge node in
+const MergeBranchesKey = "branches"
+
+// MergeNode implements a node that combines the outputs of the branches
+// leading to it. The workflow executor runs it once every branch has
+// finished, and delivers each branch's output separately.
+type MergeNode struct {
+	id              string
+	nodeType        string
+	strategy        string
+	key             string
+	continueOnError bool
+	config          map[string]interface{}
+}
+
+// mergeBranch is a branch that completed
+type mergeBranch struct {
+	source string
+	output map[string]interface{}
+}
+
+// Initialize sets up the merge node with configuration
+func (m *MergeNode) Initialize(config map[string]interface{}) error {
+	m.config = config
+
+	m.strategy = MergeWaitAll
+	if strategy, ok := config["strategy"]; ok {
+		s, ok := strategy.(string)
+		if !ok {
+			return fmt.Errorf("strategy must be a string")
+		}
+		switch s {
+		case MergeAppend, MergeCombineObject, MergeZip, MergeWaitAll:
+			m.strategy = s
+		default:
+			return fmt.Errorf("unsupported strategy: %s", s)
+		}
+	}
+
+	if key, ok := config["key"]; ok {
+		if k, ok := key.(string); ok {
+			m.key = k
+		} else {
+			return fmt.Errorf("key must be a string")
+		}
+	}
+	if m.strategy == MergeZip && m.key == "" {
+		return fmt.Errorf("key is required for the %s strategy", MergeZip)
+	}
+
+	if continueOnError, ok := config["continue_on_error"]; ok {
+		if c, ok := continueOnError.(bool); ok {
+			m.continueOnError = c
+		} else {
+			return fmt.Errorf("continue_on_error must be a boolean")
+		}
+	}
+
+	return nil
+}
+
+// ToleratesFailedBranches reports whether the workflow executor runs the
+// node when some of its branches fail. The failed branches are then left
+// out of the result and listed in "errors".
+func (m *MergeNode) ToleratesFailedBranches() bool {
+	return m.continueOnError
+}
+
+// Execute combines the branches according to the strategy
+func (m *MergeNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	rawBranches, ok := inputs[MergeBranchesKey].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no branches to merge; connect the branches to the node with edges")
+	}
+
+	branches := make([]mergeBranch, 0, len(rawBranches))
+	errorList := make([]interface{}, 0)
+	for _, raw := range rawBranches {
+		branch, _ := raw.(map[string]interface{})
+		source, _ := branch["source"].(string)
+		if branch["status"] == "failed" {
+			if !m.continueOnError {
+				return nil, fmt.Errorf("branch %s failed: %v", source, branch["error"])
+			}
+			errorList = append(errorList, map[string]interface{}{
+				"source": source,
+				"error":  branch["error"],
+			})
+			continue
+		}
+		output, _ := branch["output"].(map[string]interface{})
+		branches = append(branches, mergeBranch{source: source, output: output})
+	}
+
+	var result interface{}
+	switch m.strategy {
+	case MergeAppend:
+		result = m.appendBranches(branches)
+	case MergeCombineObject:
+		result = m.combineBranches(branches)
+	case MergeZip:
+		result = m.zipBranches(branches)
+	default:
+		result = waitAllBranches(branches)
+	}
+
+	return map[string]interface{}{
+		"result":       result,
+		"strategy":     m.strategy,
+		"branch_count": len(branches),
+		"error_count":  len(errorList),
+		"errors":       errorList,
+	}, nil
+}
+
+// value returns what the node merges of a branch's output: the field named
+// by key, or the whole output
+func (m *MergeNode) value(branch mergeBranch) (interface{}, bool) {
+	if m.key == "" {
+		return branch.output, branch.output != nil
+	}
+	value, ok := branch.output[m.key]
+	return value, ok
+}
+
+// appendBranches concatenates arrays; other values are appended as items
+func (m *MergeNode) appendBranches(branches []mergeBranch) []interface{} {
+	items := make([]interface{}, 0)
+	for _, branch := range branches {
+		value, ok := m.value(branch)
+		if !ok {
+			continue
+		}
+		if array, isArray := value.([]interface{}); isArray {
+			items = append(items, array...)
+		} else {
+			items = append(items, value)
+		}
+	}
+	return items
+}
+
+// combineBranches shallow-merges objects; other values are ignored
+func (m *MergeNode) combineBranches(branches []mergeBranch) map[string]interface{} {
+	combined := make(map[string]interface{})
+	for _, branch := range branches {
+		value, _ := m.value(branch)
+		if object, ok := value.(map[string]interface{}); ok {
+			for k, v := range object {
+				combined[k] = v
+			}
+		}
+	}
+	return combined
+}
+
+// zipBranches returns, for each index of the shortest array, the items at
+// that index keyed by source node
+func (m *MergeNode) zipBranches(branches []mergeBranch) []interface{} {
+	arrays := make([][]interface{}, len(branches))
+	length := -1
+	for i, branch := range branches {
+		value, _ := m.value(branch)
+		arrays[i], _ = value.([]interface{})
+		if length < 0 || len(arrays[i]) < length {
+			length = len(arrays[i])
+		}
+	}
+
+	zipped := make([]interface{}, 0, length)
+	for index := 0; index < length; index++ {
+		tuple := make(map[string]interface{}, len(branches))
+		for i, branch := range branches {
+			tuple[branch.source] = arrays[i][index]
+		}
+		zipped = append(zipped, tuple)
+	}
+	return zipped
+}
+
+// waitAllBranches keys the output of every branch by source node
+func waitAllBranches(branches []mergeBranch) map[string]interface{} {
+	outputs := make(map[string]interface{}, len(branches))
+	for _, branch := range branches {
+		outputs[branch.source] = branch.output
+	}
+	return outputs
+}
+
+// GetType returns the type of the node
+func (m *MergeNode) GetType() string {
+	return m.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (m *MergeNode) GetID() string {
+	return m.id
+}
+
+// NewMergeNode creates a new merge node constructor for the registry
+func NewMergeNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &MergeNode{
+		id:       fmt.Sprintf("merge_%d", time.Now().UnixNano()),
+		nodeType: "merge",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
@@ -0,0 +1,116 @@
+package utility
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// branches returns the merge node input holding the given branches
+func branches(entries ...map[string]interface{}) map[string]interface{} {
+	list := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		list[i] = entry
+	}
+	return map[string]interface{}{MergeBranchesKey: list}
+}
+
+func completedBranch(source string, output map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"source": source, "status": "completed", "output": output}
+}
+
+func failedBranch(source, err string) map[string]interface{} {
+	return map[string]interface{}{"source": source, "status": "failed", "error": err}
+}
+
+func executeMerge(t *testing.T, config map[string]interface{}, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+
+	node, err := NewMergeNode(config)
+	require.NoError(t, err)
+	return node.Execute(context.Background(), inputs)
+}
+
+func TestMergeAppendConcatenatesArrays(t *testing.T) {
+	output, err := executeMerge(t, map[string]interface{}{"strategy": MergeAppend, "key": "results"}, branches(
+		completedBranch("a", map[string]interface{}{"results": []interface{}{1, 2}}),
+		completedBranch("b", map[string]interface{}{"results": 3}),
+		completedBranch("c", map[string]interface{}{"other": true}),
+		completedBranch("d", map[string]interface{}{"results": []interface{}{4}}),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2, 3, 4}, output["result"])
+	assert.Equal(t, 4, output["branch_count"])
+
+	// Without a key, whole outputs are appended
+	output, err = executeMerge(t, map[string]interface{}{"strategy": MergeAppend}, branches(
+		completedBranch("a", map[string]interface{}{"n": 1}),
+		completedBranch("b", map[string]interface{}{"n": 2}),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"n": 1}, map[string]interface{}{"n": 2}}, output["result"])
+}
+
+func TestMergeCombineObjectLaterBranchesWin(t *testing.T) {
+	output, err := executeMerge(t, map[string]interface{}{"strategy": MergeCombineObject}, branches(
+		completedBranch("a", map[string]interface{}{"name": "Ada", "plan": "free"}),
+		completedBranch("b", map[string]interface{}{"plan": "pro", "seats": 3}),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Ada", "plan": "pro", "seats": 3}, output["result"])
+}
+
+func TestMergeZipPairsItemsByIndex(t *testing.T) {
+	output, err := executeMerge(t, map[string]interface{}{"strategy": MergeZip, "key": "values"}, branches(
+		completedBranch("names", map[string]interface{}{"values": []interface{}{"a", "b", "c"}}),
+		completedBranch("scores", map[string]interface{}{"values": []interface{}{1, 2}}),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"names": "a", "scores": 1},
+		map[string]interface{}{"names": "b", "scores": 2},
+	}, output["result"])
+
+	_, err = NewMergeNode(map[string]interface{}{"strategy": MergeZip})
+	assert.EqualError(t, err, "key is required for the zip strategy")
+}
+
+func TestMergeWaitAllKeysOutputsBySource(t *testing.T) {
+	output, err := executeMerge(t, map[string]interface{}{}, branches(
+		completedBranch("a", map[string]interface{}{"n": 1}),
+		completedBranch("b", map[string]interface{}{"n": 2}),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, MergeWaitAll, output["strategy"])
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"n": 1},
+		"b": map[string]interface{}{"n": 2},
+	}, output["result"])
+
+	_, err = executeMerge(t, map[string]interface{}{}, map[string]interface{}{"n": 1})
+	assert.Error(t, err)
+	_, err = NewMergeNode(map[string]interface{}{"strategy": "interleave"})
+	assert.EqualError(t, err, "unsupported strategy: interleave")
+}
+
+func TestMergeFailedBranches(t *testing.T) {
+	inputs := branches(
+		completedBranch("a", map[string]interface{}{"items": []interface{}{1}}),
+		failedBranch("b", "timeout"),
+	)
+
+	_, err := executeMerge(t, map[string]interface{}{"strategy": MergeAppend, "key": "items"}, inputs)
+	assert.EqualError(t, err, "branch b failed: timeout")
+
+	node, err := NewMergeNode(map[string]interface{}{"strategy": MergeAppend, "key": "items", "continue_on_error": true})
+	require.NoError(t, err)
+	assert.True(t, node.(*MergeNode).ToleratesFailedBranches())
+	output, err := node.Execute(context.Background(), inputs)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{1}, output["result"])
+	assert.Equal(t, 1, output["branch_count"])
+	assert.Equal(t, 1, output["error_count"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"source": "b", "error": "timeout"}}, output["errors"])
+}
@@ -0,0 +1,147 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// SwitchDefaultPort is the output port the switch node routes to when no
+// case matches and its default port is enabled
+const SwitchDefaultPort = "default"
+
+// SwitchNode implements a node that routes to one of several named output
+// ports. Its cases are checked in order, each like the condition of the
+// if_else node, and the first one that matches selects its port.
+type SwitchNode struct {
+	id          string
+	nodeType    string
+	field       string
+	cases       []switchCase
+	withDefault bool
+	config      map[string]interface{}
+}
+
+// switchCase is a condition and the port it routes to
+type switchCase struct {
+	port      string
+	condition IfElseNode
+}
+
+// Initialize sets up the switch node with configuration
+func (s *SwitchNode) Initialize(config map[string]interface{}) error {
+	s.config = config
+
+	if field, ok := config["field"]; ok {
+		if f, ok := field.(string); ok {
+			s.field = f
+		} else {
+			return fmt.Errorf("field must be a string")
+		}
+	}
+
+	if withDefault, ok := config["default"]; ok {
+		if d, ok := withDefault.(bool); ok {
+			s.withDefault = d
+		} else {
+			return fmt.Errorf("default must be a boolean")
+		}
+	}
+
+	rawCases, ok := config["cases"].([]interface{})
+	if !ok || len(rawCases) == 0 {
+		return fmt.Errorf("cases must be a non-empty list")
+	}
+
+	ports := make(map[string]bool, len(rawCases))
+	s.cases = make([]switchCase, 0, len(rawCases))
+	for i, rawCase := range rawCases {
+		caseConfig, ok := rawCase.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("case %d must be an object", i)
+		}
+
+		port, _ := caseConfig["port"].(string)
+		if port == "" {
+			return fmt.Errorf("case %d must have a port", i)
+		}
+		if port == SwitchDefaultPort {
+			return fmt.Errorf("case %d cannot use the %s port", i, SwitchDefaultPort)
+		}
+		if ports[port] {
+			return fmt.Errorf("case %d repeats port %s", i, port)
+		}
+		ports[port] = true
+
+		// Cases compare the switch's field unless they name their own
+		conditionConfig := make(map[string]interface{}, len(caseConfig)+1)
+		if s.field != "" {
+			conditionConfig["field"] = s.field
+		}
+		for k, v := range caseConfig {
+			conditionConfig[k] = v
+		}
+
+		c := switchCase{port: port}
+		if err := c.condition.Initialize(conditionConfig); err != nil {
+			return fmt.Errorf("case %d: %v", i, err)
+		}
+		if c.condition.condition == "" && c.condition.operator == "" {
+			return fmt.Errorf("case %d must have a condition or an operator", i)
+		}
+		s.cases = append(s.cases, c)
+	}
+
+	return nil
+}
+
+// Execute routes to the port of the first matching case
+func (s *SwitchNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"input_data": inputs,
+	}
+	if s.field != "" {
+		result["value"] = lookupField(inputs, s.field)
+	}
+
+	for i, c := range s.cases {
+		if c.condition.evaluate(inputs) {
+			result["branch"] = c.port
+			result["matched_case"] = i
+			return result, nil
+		}
+	}
+
+	if !s.withDefault {
+		return nil, fmt.Errorf("no case matched and the switch has no default port")
+	}
+	result["branch"] = SwitchDefaultPort
+	result["matched_case"] = -1
+	return result, nil
+}
+
+// GetType returns the type of the node
+func (s *SwitchNode) GetType() string {
+	return s.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (s *SwitchNode) GetID() string {
+	return s.id
+}
+
+// NewSwitchNode creates a new switch node constructor for the registry
+func NewSwitchNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &SwitchNode{
+		id:       fmt.Sprintf("switch_%d", time.Now().UnixNano()),
+		nodeType: "switch",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
@@ -0,0 +1,84 @@
+package utility
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tierCases route orders by total; the later cases overlap the earlier ones
+var tierCases = []interface{}{
+	map[string]interface{}{"port": "large", "operator": ">=", "value": float64(1000)},
+	map[string]interface{}{"port": "medium", "operator": ">=", "value": float64(100)},
+	map[string]interface{}{"port": "any", "operator": ">=", "value": float64(0)},
+}
+
+func executeSwitch(t *testing.T, config map[string]interface{}, inputs map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+
+	node, err := NewSwitchNode(config)
+	require.NoError(t, err)
+	return node.Execute(context.Background(), inputs)
+}
+
+func TestSwitchFirstMatchingCaseWins(t *testing.T) {
+	tests := []struct {
+		total  float64
+		branch string
+		index  int
+	}{
+		{5000, "large", 0},
+		{1000, "large", 0},
+		{250, "medium", 1},
+		{3, "any", 2},
+	}
+
+	for _, tt := range tests {
+		output, err := executeSwitch(t, map[string]interface{}{"field": "order.total", "cases": tierCases},
+			map[string]interface{}{"order": map[string]interface{}{"total": tt.total}})
+		require.NoError(t, err)
+		assert.Equal(t, tt.branch, output["branch"], tt.total)
+		assert.Equal(t, tt.index, output["matched_case"], tt.total)
+		assert.Equal(t, tt.total, output["value"])
+	}
+
+	// Cases can use conditions of their own
+	output, err := executeSwitch(t, map[string]interface{}{"field": "status", "cases": []interface{}{
+		map[string]interface{}{"port": "vip", "field": "vip", "operator": "==", "value": true},
+		map[string]interface{}{"port": "open", "operator": "==", "value": "open"},
+	}}, map[string]interface{}{"status": "open", "vip": true})
+	require.NoError(t, err)
+	assert.Equal(t, "vip", output["branch"])
+}
+
+func TestSwitchFallsBackToDefault(t *testing.T) {
+	output, err := executeSwitch(t, map[string]interface{}{"field": "order.total", "cases": tierCases[:2], "default": true},
+		map[string]interface{}{"order": map[string]interface{}{"total": float64(3)}})
+	require.NoError(t, err)
+	assert.Equal(t, SwitchDefaultPort, output["branch"])
+	assert.Equal(t, -1, output["matched_case"])
+}
+
+func TestSwitchWithoutDefaultFailsWhenNothingMatches(t *testing.T) {
+	_, err := executeSwitch(t, map[string]interface{}{"field": "order.total", "cases": tierCases[:2]},
+		map[string]interface{}{"order": map[string]interface{}{"total": float64(3)}})
+	assert.EqualError(t, err, "no case matched and the switch has no default port")
+}
+
+func TestSwitchValidatesCases(t *testing.T) {
+	for name, cases := range map[string]interface{}{
+		"no cases":      []interface{}{},
+		"not a list":    "large",
+		"no port":       []interface{}{map[string]interface{}{"operator": "==", "value": 1}},
+		"default port":  []interface{}{map[string]interface{}{"port": "default", "operator": "==", "value": 1}},
+		"repeated port": []interface{}{map[string]interface{}{"port": "a", "operator": "==", "value": 1}, map[string]interface{}{"port": "a", "operator": "==", "value": 2}},
+		"no comparison": []interface{}{map[string]interface{}{"port": "a"}},
+		"invalid regex": []interface{}{map[string]interface{}{"port": "a", "operator": "regex", "value": "("}},
+		"not an object": []interface{}{"a"},
+	} {
+		_, err := NewSwitchNode(map[string]interface{}{"field": "n", "cases": cases})
+		assert.Error(t, err, name)
+	}
+}
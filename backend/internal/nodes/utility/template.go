@@ -0,0 +1,143 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"github.com/Masterminds/sprig/v3"
+)
+
+// TemplateNode implements a node that renders Go templates against input data
+type TemplateNode struct {
+	id         string
+	nodeType   string
+	template   string
+	escapeHTML bool
+	config     map[string]interface{}
+}
+
+// Initialize sets up the template node with configuration
+func (tn *TemplateNode) Initialize(config map[string]interface{}) error {
+	tn.config = config
+
+	if tmpl, ok := config["template"]; ok {
+		if t, ok := tmpl.(string); ok {
+			tn.template = t
+		} else {
+			return fmt.Errorf("template must be a string")
+		}
+	}
+
+	if escapeHTML, ok := config["escape_html"]; ok {
+		if e, ok := escapeHTML.(bool); ok {
+			tn.escapeHTML = e
+		} else {
+			return fmt.Errorf("escape_html must be a boolean")
+		}
+	}
+
+	// Catch syntax errors when the node is created rather than on first run
+	if tn.template != "" {
+		if _, err := parseTemplate(tn.template, tn.escapeHTML); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Execute renders the template. The template can be overridden by the
+// "template" input, and the "data" input is used as the template context
+// (falling back to the full input map).
+func (tn *TemplateNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	tmpl := tn.template
+	if inputTmpl, ok := inputs["template"].(string); ok && inputTmpl != "" {
+		tmpl = inputTmpl
+	}
+	if tmpl == "" {
+		return nil, fmt.Errorf("template is required")
+	}
+
+	var data interface{} = inputs
+	if inputData, exists := inputs["data"]; exists {
+		data = inputData
+	}
+
+	rendered, err := RenderTemplate(tmpl, data, tn.escapeHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"output": rendered,
+	}, nil
+}
+
+// GetType returns the type of the node
+func (tn *TemplateNode) GetType() string {
+	return tn.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (tn *TemplateNode) GetID() string {
+	return tn.id
+}
+
+// NewTemplateNode creates a new template node constructor for the registry
+func NewTemplateNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	node := &TemplateNode{
+		id:       fmt.Sprintf("template_%d", time.Now().UnixNano()),
+		nodeType: "template",
+	}
+
+	if err := node.Initialize(config); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// renderer is the common subset of text/template and html/template
+type renderer interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parseTemplate parses tmpl with the sprig function set, using html/template
+// when escapeHTML is set. Errors include the line number, e.g.
+// `template: template:3: unexpected "}" in operand`.
+func parseTemplate(tmpl string, escapeHTML bool) (renderer, error) {
+	var (
+		t   renderer
+		err error
+	)
+	if escapeHTML {
+		t, err = htmltemplate.New("template").Funcs(sprig.HtmlFuncMap()).Parse(tmpl)
+	} else {
+		t, err = texttemplate.New("template").Funcs(sprig.TxtFuncMap()).Parse(tmpl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return t, nil
+}
+
+// RenderTemplate renders tmpl with data using text/template, or html/template
+// when escapeHTML is set. The sprig function set is available in both modes.
+func RenderTemplate(tmpl string, data interface{}, escapeHTML bool) (string, error) {
+	t, err := parseTemplate(tmpl, escapeHTML)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,56 @@
+package utility
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateRender(t *testing.T) {
+	node, err := NewTemplateNode(map[string]interface{}{
+		"template": `Hello {{ .user.name | upper }}, you have {{ len .items }} items`,
+	})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{
+		"data": map[string]interface{}{
+			"user":  map[string]interface{}{"name": "ada"},
+			"items": []interface{}{1, 2, 3},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello ADA, you have 3 items", output["output"])
+}
+
+func TestTemplateEscapeHTML(t *testing.T) {
+	node, err := NewTemplateNode(map[string]interface{}{
+		"template":    `<p>{{ .message }}</p>`,
+		"escape_html": true,
+	})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{
+		"message": "<script>alert(1)</script>",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>", output["output"])
+}
+
+func TestTemplateErrorsIncludeLine(t *testing.T) {
+	_, err := NewTemplateNode(map[string]interface{}{
+		"template": "line one\nline two {{ .name ",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template:2:")
+
+	node, err := NewTemplateNode(map[string]interface{}{
+		"template": "ok\n{{ index .items 5 }}",
+	})
+	require.NoError(t, err)
+
+	_, err = node.Execute(context.Background(), map[string]interface{}{"items": []interface{}{1}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template:2:")
+}
@@ -10,6 +10,17 @@ import (
 	"citadel-agent/backend/internal/interfaces"
 )
 
+// TransformTypes are the transform_type values of the data transformer;
+// without one, data passes through unchanged
+var TransformTypes = []string{"mapping", "filtering", "custom", "expression", "flatten", "unflatten", "parse", "serialize"}
+
+// CustomOperations are the operations of the custom transform type
+var CustomOperations = []string{"json_parse", "json_stringify", "string_operations"}
+
+// StringOperations are the operations of the string_operations custom
+// operation, set in its "operations" parameter
+var StringOperations = []string{"trim", "lowercase", "uppercase", "replace"}
+
 // DataTransformerNode implements a node that transforms data
 type DataTransformerNode struct {
 	id            string
@@ -17,7 +28,10 @@ type DataTransformerNode struct {
 	transformType string
 	mapping       map[string]string
 	operation     string
+	expression    string
 	parameters    map[string]interface{}
+	format        string
+	formatOptions formatOptions
 	config        map[string]interface{}
 }
 
@@ -43,21 +57,165 @@ func (dt *DataTransformerNode) Initialize(config map[string]interface{}) error {
 					dt.mapping[k] = fmt.Sprintf("%v", v)
 				}
 			}
+		} else {
+			return fmt.Errorf("mapping must be an object")
 		}
 	}
 
 	if operation, ok := config["operation"]; ok {
 		if op, ok := operation.(string); ok {
 			dt.operation = op
+		} else {
+			return fmt.Errorf("operation must be a string")
+		}
+	}
+
+	if expression, ok := config["expression"]; ok {
+		if expr, ok := expression.(string); ok {
+			dt.expression = expr
+		} else {
+			return fmt.Errorf("expression must be a string")
+		}
+	}
+
+	if dt.transformType == "expression" && dt.expression != "" {
+		if _, err := normalizeExpression(dt.expression); err != nil {
+			return err
 		}
 	}
 
 	if parameters, ok := config["parameters"]; ok {
 		if p, ok := parameters.(map[string]interface{}); ok {
 			dt.parameters = p
+		} else {
+			return fmt.Errorf("parameters must be an object")
 		}
 	}
 
+	return dt.validate()
+}
+
+// validate rejects configurations the transform would otherwise ignore
+func (dt *DataTransformerNode) validate() error {
+	if dt.transformType != "" && !containsString(TransformTypes, dt.transformType) {
+		return fmt.Errorf("unsupported transform_type: %s", dt.transformType)
+	}
+
+	switch dt.transformType {
+	case "parse", "serialize":
+		return dt.initFormat()
+	case "custom":
+		if dt.operation == "" {
+			return fmt.Errorf("custom transforms require an operation")
+		}
+		if !containsString(CustomOperations, dt.operation) {
+			return fmt.Errorf("unsupported operation: %s", dt.operation)
+		}
+		if dt.operation == "string_operations" {
+			return dt.validateStringOperations()
+		}
+	}
+	return nil
+}
+
+// validateStringOperations checks the operations parameter of the
+// string_operations custom operation
+func (dt *DataTransformerNode) validateStringOperations() error {
+	ops, exists := dt.parameters["operations"]
+	if !exists {
+		return fmt.Errorf("string_operations requires an operations parameter")
+	}
+	opList, ok := ops.([]interface{})
+	if !ok {
+		return fmt.Errorf("operations must be a list")
+	}
+
+	for i, op := range opList {
+		opMap, ok := op.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("string operation %d must be an object", i)
+		}
+		opName, _ := opMap["operation"].(string)
+		if !containsString(StringOperations, opName) {
+			return fmt.Errorf("string operation %d: unsupported operation %q", i, opName)
+		}
+		if opName == "replace" {
+			if from, exists := opMap["from"]; !exists || fmt.Sprintf("%v", from) == "" {
+				return fmt.Errorf("string operation %d: replace requires a non-empty from", i)
+			}
+			if _, exists := opMap["to"]; !exists {
+				return fmt.Errorf("string operation %d: replace requires to", i)
+			}
+		}
+	}
+	return nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// initFormat reads the format of the parse and serialize transforms and
+// its options from the parameters
+func (dt *DataTransformerNode) initFormat() error {
+	dt.format, _ = dt.parameters["format"].(string)
+	switch dt.format {
+	case FormatJSON, FormatYAML, FormatCSV:
+	case "":
+		return fmt.Errorf("%s requires a format parameter", dt.transformType)
+	default:
+		return fmt.Errorf("unsupported format: %s", dt.format)
+	}
+
+	options := formatOptions{header: true, delimiter: ','}
+	if header, exists := dt.parameters["header"]; exists {
+		h, ok := header.(bool)
+		if !ok {
+			return fmt.Errorf("header must be a boolean")
+		}
+		options.header = h
+	}
+	if delimiter, exists := dt.parameters["delimiter"]; exists {
+		d, ok := delimiter.(string)
+		if !ok || len([]rune(d)) != 1 || d == "\"" || d == "\r" || d == "\n" {
+			return fmt.Errorf("delimiter must be a single character other than a quote or line break")
+		}
+		options.delimiter = []rune(d)[0]
+	}
+	if coerce, exists := dt.parameters["coerce_types"]; exists {
+		c, ok := coerce.(bool)
+		if !ok {
+			return fmt.Errorf("coerce_types must be a boolean")
+		}
+		options.coerce = c
+	}
+	if columns, exists := dt.parameters["columns"]; exists {
+		list, ok := columns.([]interface{})
+		if !ok {
+			return fmt.Errorf("columns must be a list of strings")
+		}
+		options.columns = make([]string, len(list))
+		for i, column := range list {
+			if options.columns[i], ok = column.(string); !ok {
+				return fmt.Errorf("columns must be a list of strings")
+			}
+		}
+	}
+	if indent, exists := dt.parameters["indent"]; exists {
+		i, ok := indent.(string)
+		if !ok {
+			return fmt.Errorf("indent must be a string")
+		}
+		options.indent = i
+	}
+
+	dt.formatOptions = options
 	return nil
 }
 
@@ -72,6 +230,16 @@ func (dt *DataTransformerNode) Execute(ctx context.Context, inputs map[string]in
 		outputData = dt.applyFiltering(inputs)
 	case "custom":
 		outputData = dt.applyCustomOperation(inputs)
+	case "expression":
+		return dt.applyExpression(inputs)
+	case "flatten":
+		return dt.applyFlatten(inputs)
+	case "unflatten":
+		return dt.applyUnflatten(inputs)
+	case "parse":
+		return dt.applyParse(inputs)
+	case "serialize":
+		return dt.applySerialize(inputs)
 	default:
 		// Default behavior: return input data unchanged
 		outputData = inputs
@@ -93,6 +261,113 @@ func (dt *DataTransformerNode) applyMapping(inputData map[string]interface{}) ma
 	return output
 }
 
+// applyExpression evaluates a JSONPath, jq-style or gjson expression against
+// the input data. The expression and data can be supplied as inputs to
+// override the configured expression and the full input map respectively.
+func (dt *DataTransformerNode) applyExpression(inputs map[string]interface{}) (map[string]interface{}, error) {
+	expr := dt.expression
+	if inputExpr, ok := inputs["expression"].(string); ok && inputExpr != "" {
+		expr = inputExpr
+	}
+
+	result, err := evaluateExpression(expr, transformSource(inputs))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"result":     result,
+		"expression": expr,
+	}, nil
+}
+
+// applyFlatten flattens nested input data into a single-level map
+func (dt *DataTransformerNode) applyFlatten(inputs map[string]interface{}) (map[string]interface{}, error) {
+	data, ok := transformSource(inputs).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("flatten requires an object as input")
+	}
+
+	maxDepth, err := dt.intParameter("max_depth")
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenData(data, dt.separator(), maxDepth), nil
+}
+
+// applyUnflatten rebuilds nested data from a flattened map
+func (dt *DataTransformerNode) applyUnflatten(inputs map[string]interface{}) (map[string]interface{}, error) {
+	data, ok := transformSource(inputs).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unflatten requires an object as input")
+	}
+
+	return unflattenData(data, dt.separator())
+}
+
+// applyParse parses a JSON, YAML or CSV string into structured data
+func (dt *DataTransformerNode) applyParse(inputs map[string]interface{}) (map[string]interface{}, error) {
+	text, ok := transformSource(inputs).(string)
+	if !ok {
+		return nil, fmt.Errorf("parse requires a string as input")
+	}
+
+	result, err := parseFormat(dt.format, text, dt.formatOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"result": result,
+		"format": dt.format,
+	}, nil
+}
+
+// applySerialize serializes structured data as JSON, YAML or CSV
+func (dt *DataTransformerNode) applySerialize(inputs map[string]interface{}) (map[string]interface{}, error) {
+	result, err := serializeFormat(dt.format, transformSource(inputs), dt.formatOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"result": result,
+		"format": dt.format,
+	}, nil
+}
+
+// separator returns the key separator used by flatten and unflatten
+func (dt *DataTransformerNode) separator() string {
+	if sep, ok := dt.parameters["separator"].(string); ok && sep != "" {
+		return sep
+	}
+	return "."
+}
+
+// intParameter reads an optional non-negative integer parameter
+func (dt *DataTransformerNode) intParameter(name string) (int, error) {
+	value, exists := dt.parameters[name]
+	if !exists {
+		return 0, nil
+	}
+
+	f, err := toFloat64(value)
+	if err != nil || f < 0 || f != float64(int(f)) {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return int(f), nil
+}
+
+// transformSource returns the "data" input when present, otherwise the
+// full input map
+func transformSource(inputs map[string]interface{}) interface{} {
+	if data, exists := inputs["data"]; exists {
+		return data
+	}
+	return inputs
+}
+
 // applyFiltering filters input data based on criteria
 func (dt *DataTransformerNode) applyFiltering(inputData map[string]interface{}) map[string]interface{} {
 	output := make(map[string]interface{})
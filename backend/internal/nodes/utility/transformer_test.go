@@ -0,0 +1,338 @@
+package utility
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleTransformInput() map[string]interface{} {
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"user": map[string]interface{}{
+				"name":    "Ada",
+				"address": map[string]interface{}{"city": "London"},
+			},
+			"items": []interface{}{
+				map[string]interface{}{"id": 1, "price": 5},
+				map[string]interface{}{"id": 2, "price": 15},
+				map[string]interface{}{"id": 3, "price": 25},
+			},
+		},
+	}
+}
+
+func runExpression(t *testing.T, expr string) interface{} {
+	t.Helper()
+
+	node, err := NewTransformerNode(map[string]interface{}{
+		"transform_type": "expression",
+		"expression":     expr,
+	})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), sampleTransformInput())
+	require.NoError(t, err)
+	assert.Equal(t, expr, output["expression"])
+
+	return output["result"]
+}
+
+func TestExpressionExtraction(t *testing.T) {
+	assert.Equal(t, "London", runExpression(t, "user.address.city"))
+	assert.Equal(t, "London", runExpression(t, "$.user.address.city"))
+	assert.Equal(t, "Ada", runExpression(t, ".user.name"))
+	assert.Equal(t, float64(2), runExpression(t, "$.items[1].id"))
+	assert.Nil(t, runExpression(t, "user.missing"))
+}
+
+func TestExpressionArrayMapping(t *testing.T) {
+	expected := []interface{}{float64(1), float64(2), float64(3)}
+
+	assert.Equal(t, expected, runExpression(t, "items.#.id"))
+	assert.Equal(t, expected, runExpression(t, "$.items[*].id"))
+	assert.Equal(t, expected, runExpression(t, ".items[].id"))
+}
+
+func TestExpressionFilterAndReshape(t *testing.T) {
+	assert.Equal(t, []interface{}{float64(2), float64(3)}, runExpression(t, "$.items[?(@.price > 10)].id"))
+
+	assert.Equal(t, map[string]interface{}{
+		"customer": "Ada",
+		"ids":      []interface{}{float64(1), float64(2), float64(3)},
+	}, runExpression(t, "{customer:user.name,ids:items.#.id}"))
+}
+
+func TestExpressionMalformed(t *testing.T) {
+	for _, expr := range []string{"$.items[0", "{name:user.name", "$.items[?(@.price > 10]", "$..id", "user.name)"} {
+		_, err := NewTransformerNode(map[string]interface{}{
+			"transform_type": "expression",
+			"expression":     expr,
+		})
+		assert.Error(t, err, expr)
+	}
+
+	node, err := NewTransformerNode(map[string]interface{}{"transform_type": "expression"})
+	require.NoError(t, err)
+
+	_, err = node.Execute(context.Background(), map[string]interface{}{"expression": "items[0"})
+	assert.Error(t, err)
+
+	_, err = node.Execute(context.Background(), map[string]interface{}{})
+	assert.Error(t, err)
+}
+
+func TestFlattenNested(t *testing.T) {
+	node, err := NewTransformerNode(map[string]interface{}{"transform_type": "flatten"})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{
+		"user": map[string]interface{}{
+			"address": map[string]interface{}{
+				"geo": map[string]interface{}{"lat": 51.5},
+			},
+		},
+		"items": []interface{}{
+			map[string]interface{}{"id": 1, "tags": []interface{}{"a", "b"}},
+			map[string]interface{}{"id": 2, "tags": []interface{}{}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"user.address.geo.lat": 51.5,
+		"items[0].id":          1,
+		"items[0].tags[0]":     "a",
+		"items[0].tags[1]":     "b",
+		"items[1].id":          2,
+		"items[1].tags":        []interface{}{},
+	}, output)
+}
+
+func TestFlattenSeparatorAndMaxDepth(t *testing.T) {
+	node, err := NewTransformerNode(map[string]interface{}{
+		"transform_type": "flatten",
+		"parameters":     map[string]interface{}{"separator": "_", "max_depth": float64(2)},
+	})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{
+		"data": map[string]interface{}{
+			"user": map[string]interface{}{
+				"name":    "Ada",
+				"address": map[string]interface{}{"city": "London"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"user_name":    "Ada",
+		"user_address": map[string]interface{}{"city": "London"},
+	}, output)
+}
+
+func TestUnflattenRoundTrip(t *testing.T) {
+	original := map[string]interface{}{
+		"user": map[string]interface{}{
+			"address": map[string]interface{}{"city": "London"},
+		},
+		"items": []interface{}{
+			map[string]interface{}{"id": 1, "matrix": []interface{}{[]interface{}{1, 2}}},
+			map[string]interface{}{"id": 2},
+		},
+	}
+
+	flat := flattenData(original, ".", 0)
+	assert.Equal(t, 2, flat["items[0].matrix[0][1]"])
+
+	node, err := NewTransformerNode(map[string]interface{}{"transform_type": "unflatten"})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), flat)
+	require.NoError(t, err)
+	assert.Equal(t, original, output)
+}
+
+func TestUnflattenConflicts(t *testing.T) {
+	_, err := unflattenData(map[string]interface{}{"a": 1, "a.b": 2}, ".")
+	assert.Error(t, err)
+
+	_, err = unflattenData(map[string]interface{}{"a[x]": 1}, ".")
+	assert.Error(t, err)
+
+	_, err = unflattenData(map[string]interface{}{"a..b": 1}, ".")
+	assert.Error(t, err)
+}
+
+func runFormat(t *testing.T, transformType string, parameters map[string]interface{}, data interface{}) (interface{}, error) {
+	t.Helper()
+
+	node, err := NewTransformerNode(map[string]interface{}{
+		"transform_type": transformType,
+		"parameters":     parameters,
+	})
+	require.NoError(t, err)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{"data": data})
+	if err != nil {
+		return nil, err
+	}
+	assert.Equal(t, parameters["format"], output["format"])
+	return output["result"], nil
+}
+
+func TestParseAndSerializeRoundTrip(t *testing.T) {
+	data := map[string]interface{}{
+		"name":   "Zoë",
+		"age":    float64(36),
+		"active": true,
+		"tags":   []interface{}{"admin", "ops"},
+		"boss":   nil,
+		"limits": map[string]interface{}{"cpu": 0.5},
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		serialized, err := runFormat(t, "serialize", map[string]interface{}{"format": format}, data)
+		require.NoError(t, err, format)
+		require.IsType(t, "", serialized, format)
+
+		parsed, err := runFormat(t, "parse", map[string]interface{}{"format": format}, serialized)
+		require.NoError(t, err, format)
+		assert.Equal(t, data, parsed, format)
+	}
+
+	serialized, err := runFormat(t, "serialize", map[string]interface{}{"format": FormatJSON, "indent": "  "}, map[string]interface{}{"a": float64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"a\": 1\n}", serialized)
+}
+
+func TestCSVRoundTripWithHeader(t *testing.T) {
+	text := "id,name,score\n1,\"Smith, Jo\",9.5\n2,Lee,\n"
+
+	parsed, err := runFormat(t, "parse", map[string]interface{}{"format": FormatCSV}, text)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": "1", "name": "Smith, Jo", "score": "9.5"},
+		map[string]interface{}{"id": "2", "name": "Lee", "score": ""},
+	}, parsed)
+
+	serialized, err := runFormat(t, "serialize", map[string]interface{}{"format": FormatCSV}, parsed)
+	require.NoError(t, err)
+	assert.Equal(t, text, serialized)
+
+	// Coerced fields get their types, and columns can be chosen and ordered
+	parsed, err = runFormat(t, "parse", map[string]interface{}{"format": FormatCSV, "coerce_types": true}, "id,ok,note\n7,true,null\n")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": float64(7), "ok": true, "note": nil}}, parsed)
+
+	serialized, err = runFormat(t, "serialize", map[string]interface{}{"format": FormatCSV, "columns": []interface{}{"ok", "id"}}, parsed)
+	require.NoError(t, err)
+	assert.Equal(t, "ok,id\ntrue,7\n", serialized)
+}
+
+func TestCSVWithoutHeader(t *testing.T) {
+	parsed, err := runFormat(t, "parse", map[string]interface{}{"format": FormatCSV, "header": false, "delimiter": ";"}, "a;1\nb;2\n")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{"a", "1"}, []interface{}{"b", "2"}}, parsed)
+
+	serialized, err := runFormat(t, "serialize", map[string]interface{}{"format": FormatCSV, "header": false, "delimiter": ";"}, parsed)
+	require.NoError(t, err)
+	assert.Equal(t, "a;1\nb;2\n", serialized)
+}
+
+func TestParseReportsErrorPositions(t *testing.T) {
+	tests := []struct {
+		format string
+		text   string
+		err    string
+	}{
+		{FormatJSON, "{\n  \"a\": 1,\n  \"b\": }", "invalid JSON at line 3, column 8"},
+		{FormatJSON, `{"a": 1`, "invalid JSON at line 1, column 7"},
+		{FormatYAML, "a: 1\n\tb: 2\n", "invalid YAML: line 2"},
+		{FormatCSV, "a,b\n1,2,3\n", "invalid CSV at line 2, column 1"},
+		{FormatCSV, "a,b\n\"open,2\n", "invalid CSV at line 2"},
+		{FormatCSV, "a,a\n1,2\n", `invalid CSV at line 1: duplicate column "a"`},
+	}
+
+	for _, tt := range tests {
+		_, err := runFormat(t, "parse", map[string]interface{}{"format": tt.format}, tt.text)
+		require.Error(t, err, tt.text)
+		assert.Contains(t, err.Error(), tt.err, tt.text)
+	}
+
+	_, err := runFormat(t, "parse", map[string]interface{}{"format": FormatJSON}, map[string]interface{}{"a": 1})
+	assert.EqualError(t, err, "parse requires a string as input")
+	_, err = runFormat(t, "serialize", map[string]interface{}{"format": FormatCSV}, map[string]interface{}{"a": 1})
+	assert.EqualError(t, err, "CSV can only be serialized from an array of rows")
+
+	for _, parameters := range []map[string]interface{}{
+		{},
+		{"format": "xml"},
+		{"format": FormatCSV, "delimiter": ",,"},
+		{"format": FormatCSV, "header": "yes"},
+	} {
+		_, err := NewTransformerNode(map[string]interface{}{"transform_type": "parse", "parameters": parameters})
+		assert.Error(t, err, parameters)
+	}
+}
+
+func TestTransformerRejectsInvalidConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{"unknown transform type", map[string]interface{}{"transform_type": "pivot"}, "unsupported transform_type: pivot"},
+		{"custom without operation", map[string]interface{}{"transform_type": "custom"}, "custom transforms require an operation"},
+		{"unknown operation", map[string]interface{}{"transform_type": "custom", "operation": "base64"}, "unsupported operation: base64"},
+		{"operation not a string", map[string]interface{}{"transform_type": "custom", "operation": 3}, "operation must be a string"},
+		{"mapping not an object", map[string]interface{}{"transform_type": "mapping", "mapping": "a=b"}, "mapping must be an object"},
+		{"parameters not an object", map[string]interface{}{"transform_type": "flatten", "parameters": []interface{}{}}, "parameters must be an object"},
+		{"string operations missing", map[string]interface{}{
+			"transform_type": "custom", "operation": "string_operations",
+		}, "string_operations requires an operations parameter"},
+		{"string operations not a list", map[string]interface{}{
+			"transform_type": "custom", "operation": "string_operations",
+			"parameters": map[string]interface{}{"operations": "trim"},
+		}, "operations must be a list"},
+		{"unknown string operation", map[string]interface{}{
+			"transform_type": "custom", "operation": "string_operations",
+			"parameters": map[string]interface{}{"operations": []interface{}{
+				map[string]interface{}{"operation": "trim"},
+				map[string]interface{}{"operation": "reverse"},
+			}},
+		}, `string operation 1: unsupported operation "reverse"`},
+		{"replace without from", map[string]interface{}{
+			"transform_type": "custom", "operation": "string_operations",
+			"parameters": map[string]interface{}{"operations": []interface{}{
+				map[string]interface{}{"operation": "replace", "to": "x"},
+			}},
+		}, "string operation 0: replace requires a non-empty from"},
+		{"replace without to", map[string]interface{}{
+			"transform_type": "custom", "operation": "string_operations",
+			"parameters": map[string]interface{}{"operations": []interface{}{
+				map[string]interface{}{"operation": "replace", "from": "a"},
+			}},
+		}, "string operation 0: replace requires to"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewTransformerNode(tt.config)
+		assert.EqualError(t, err, tt.err, tt.name)
+	}
+
+	node, err := NewTransformerNode(map[string]interface{}{
+		"transform_type": "custom", "operation": "string_operations",
+		"parameters": map[string]interface{}{"operations": []interface{}{
+			map[string]interface{}{"operation": "trim"},
+			map[string]interface{}{"operation": "replace", "from": "-", "to": ""},
+		}},
+	})
+	require.NoError(t, err)
+	output, err := node.Execute(context.Background(), map[string]interface{}{"code": " A-1 "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"code": "A1"}, output)
+}
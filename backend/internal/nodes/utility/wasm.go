@@ -0,0 +1,313 @@
+package utility
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/pkg/resources"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// DefaultWasmTimeout bounds modules unless configured otherwise, like
+// sandbox.timeout of the application config
+const DefaultWasmTimeout = 30 * time.Second
+
+// DefaultWasmMaxMemory bounds the memory of modules unless configured
+// otherwise, like worker.resource_limits.max_memory_per_task of the
+// application config
+const DefaultWasmMaxMemory = 64 << 20
+
+// wasmPageSize is the size of a page of WebAssembly memory
+const wasmPageSize = 64 << 10
+
+// The ABI of modules: they export their memory, an alloc function that
+// reserves room for the input and the function the node calls
+const (
+	wasmMemoryExport   = "memory"
+	wasmAllocExport    = "alloc"
+	wasmDefaultRunName = "run"
+)
+
+// WasmPermissions are the host resources modules may use, like
+// sandbox.runtime_permissions of the application config. Modules never get
+// the network, since WASI gives them no sockets.
+type WasmPermissions struct {
+	// FileSystem mounts Root as the / of modules
+	FileSystem bool
+	Root       string
+	// EnvironmentVars lets nodes set environment variables of modules
+	EnvironmentVars bool
+}
+
+// WasmOptions holds the server-wide settings of WASM nodes
+type WasmOptions struct {
+	// Timeout bounds every run; nodes can only set a shorter one
+	Timeout time.Duration
+	// MaxMemory bounds the memory of modules in bytes; nodes can only set
+	// a lower limit
+	MaxMemory   int64
+	Permissions WasmPermissions
+}
+
+// WasmNode runs a WebAssembly module with wazero.
+//
+// The module is given base64-encoded in "module". It must export its
+// memory as "memory", an "alloc(size i32) i32" function returning where
+// size bytes may be written, and the function the node calls, "run" by
+// default, taking the address and length of the inputs as JSON and
+// returning the address of its JSON result in the upper 32 bits of an i64
+// and its length in the lower ones. A length of 0 returns no result.
+//
+// Modules may import WASI and nothing else. Every run gets a fresh
+// instance with no files, environment or network unless the permissions
+// grant them, within the memory limit and timeout of the node.
+type WasmNode struct {
+	id          string
+	nodeType    string
+	module      []byte
+	function    string
+	env         map[string]string
+	timeout     time.Duration
+	memoryPages uint32
+	options     WasmOptions
+	config      map[string]interface{}
+}
+
+// Initialize sets up the WASM node with configuration
+func (w *WasmNode) Initialize(config map[string]interface{}) error {
+	w.config = config
+
+	encoded, ok := config["module"].(string)
+	if !ok || encoded == "" {
+		return fmt.Errorf("module is required")
+	}
+	module, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("module must be base64-encoded: %w", err)
+	}
+	w.module = module
+
+	w.function = wasmDefaultRunName
+	if function, ok := config["function"]; ok {
+		name, ok := function.(string)
+		if !ok || name == "" {
+			return fmt.Errorf("function must be the name of an exported function")
+		}
+		w.function = name
+	}
+
+	w.env = make(map[string]string)
+	if env, ok := config["env"]; ok {
+		envMap, ok := env.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("env must be an object")
+		}
+		if len(envMap) > 0 && !w.options.Permissions.EnvironmentVars {
+			return fmt.Errorf("environment variables are not permitted for WASM modules")
+		}
+		for k, v := range envMap {
+			w.env[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	w.timeout = w.options.Timeout
+	if timeout, ok := config["timeout"]; ok {
+		t, ok := timeout.(float64)
+		if !ok || t <= 0 {
+			return fmt.Errorf("timeout must be a positive number of seconds")
+		}
+		if d := time.Duration(t * float64(time.Second)); d < w.timeout {
+			w.timeout = d
+		}
+	}
+
+	maxMemory := w.options.MaxMemory
+	if limit, ok := config["max_memory"]; ok {
+		s, _ := limit.(string)
+		bytes, err := resources.ParseMemory(s)
+		if err != nil || bytes == 0 {
+			return fmt.Errorf("max_memory must be a size such as 16MB")
+		}
+		maxMemory = min(maxMemory, bytes)
+	}
+	w.memoryPages = uint32(max(1, min(maxMemory/wasmPageSize, 1<<16)))
+
+	return w.validate()
+}
+
+// validate compiles the module to check that it follows the ABI, so that
+// broken modules are caught when the node is created rather than on first
+// run
+func (w *WasmNode) validate() error {
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter().WithMemoryLimitPages(w.memoryPages))
+	defer runtime.Close(ctx)
+
+	compiled, err := runtime.CompileModule(ctx, w.module)
+	if err != nil {
+		return fmt.Errorf("invalid module: %w", err)
+	}
+	for _, function := range compiled.ImportedFunctions() {
+		if module, name, _ := function.Import(); module != wasi_snapshot_preview1.ModuleName {
+			return fmt.Errorf("module imports %s.%s, which is not available", module, name)
+		}
+	}
+	if len(compiled.ImportedMemories()) > 0 {
+		return fmt.Errorf("module must not import its memory")
+	}
+	if _, ok := compiled.ExportedMemories()[wasmMemoryExport]; !ok {
+		return fmt.Errorf("module must export its memory as %q", wasmMemoryExport)
+	}
+
+	i32, i64 := api.ValueTypeI32, api.ValueTypeI64
+	exports := compiled.ExportedFunctions()
+	if alloc, ok := exports[wasmAllocExport]; !ok || !slices.Equal(alloc.ParamTypes(), []api.ValueType{i32}) || !slices.Equal(alloc.ResultTypes(), []api.ValueType{i32}) {
+		return fmt.Errorf("module must export %s(size i32) i32", wasmAllocExport)
+	}
+	if run, ok := exports[w.function]; !ok || !slices.Equal(run.ParamTypes(), []api.ValueType{i32, i32}) || !slices.Equal(run.ResultTypes(), []api.ValueType{i64}) {
+		return fmt.Errorf("module must export %s(ptr i32, len i32) i64", w.function)
+	}
+	return nil
+}
+
+// Execute runs the module on the inputs in a fresh instance. It is stopped
+// when its timeout passes or ctx is done.
+func (w *WasmNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	if inputs == nil {
+		inputs = map[string]interface{}{}
+	}
+	input, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pass inputs to the module: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := w.run(ctx, input)
+	if ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("module timed out after %s: %w", w.timeout, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"result":      result,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}, nil
+}
+
+// run instantiates the module, hands it input and reads back its result
+func (w *WasmNode) run(ctx context.Context, input []byte) (interface{}, error) {
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(w.memoryPages).
+		WithCloseOnContextDone(true))
+	defer runtime.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(ctx, w.module)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module: %w", err)
+	}
+
+	// Reactor modules initialize themselves in _initialize; _start would
+	// run a command module to its exit
+	moduleConfig := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	if permissions := w.options.Permissions; permissions.FileSystem && permissions.Root != "" {
+		moduleConfig = moduleConfig.WithFSConfig(wazero.NewFSConfig().WithDirMount(permissions.Root, "/"))
+	}
+	for k, v := range w.env {
+		moduleConfig = moduleConfig.WithEnv(k, v)
+	}
+	module, err := runtime.InstantiateModule(ctx, compiled, moduleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start module: %w", err)
+	}
+
+	results, err := module.ExportedFunction(wasmAllocExport).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("module failed to allocate its input: %w", err)
+	}
+	if !module.Memory().Write(uint32(results[0]), input) {
+		return nil, fmt.Errorf("%s returned memory out of range", wasmAllocExport)
+	}
+
+	results, err = module.ExportedFunction(w.function).Call(ctx, results[0], uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("module failed: %w", err)
+	}
+	offset, length := uint32(results[0]>>32), uint32(results[0])
+	if length == 0 {
+		return nil, nil
+	}
+	output, ok := module.Memory().Read(offset, length)
+	if !ok {
+		return nil, fmt.Errorf("module result is out of range of its memory")
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("module result is not JSON: %w", err)
+	}
+	return result, nil
+}
+
+// GetType returns the type of the node
+func (w *WasmNode) GetType() string {
+	return w.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (w *WasmNode) GetID() string {
+	return w.id
+}
+
+// NewWasmNode creates a new WASM node with the default options
+func NewWasmNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return NewWasmNodeWithOptions(WasmOptions{})(config)
+}
+
+// NewWasmNodeWithOptions returns the constructor of WASM nodes using
+// options
+func NewWasmNodeWithOptions(options WasmOptions) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultWasmTimeout
+	}
+	if options.MaxMemory <= 0 {
+		options.MaxMemory = DefaultWasmMaxMemory
+	}
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &WasmNode{
+			id:       fmt.Sprintf("wasm_%d", time.Now().UnixNano()),
+			nodeType: "wasm",
+			options:  options,
+		}
+
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	}
+}
@@ -0,0 +1,139 @@
+package utility
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wasmSection encodes a module section whose contents are under 128 bytes
+func wasmSection(id byte, contents ...byte) []byte {
+	return append([]byte{id, byte(len(contents))}, contents...)
+}
+
+// wasmName encodes a name of a module section
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// testWasmModule returns a module following the ABI of the WASM node: its
+// alloc hands out memory from 1024 onwards and run is given by body, the
+// code of a function (ptr i32, len i32) i64
+func testWasmModule(body ...byte) string {
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	// Types: (i32) i32 and (i32, i32) i64
+	module = append(module, wasmSection(1, 2, 0x60, 1, 0x7f, 1, 0x7f, 0x60, 2, 0x7f, 0x7f, 1, 0x7e)...)
+	// Functions: alloc and run
+	module = append(module, wasmSection(3, 2, 0, 1)...)
+	// One page of memory
+	module = append(module, wasmSection(5, 1, 0x00, 1)...)
+	// The next free address, 1024
+	module = append(module, wasmSection(6, 1, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b)...)
+
+	exports := []byte{3}
+	exports = append(append(exports, wasmName("memory")...), 0x02, 0)
+	exports = append(append(exports, wasmName("alloc")...), 0x00, 0)
+	exports = append(append(exports, wasmName("run")...), 0x00, 1)
+	module = append(module, wasmSection(7, exports...)...)
+
+	alloc := []byte{0x00, 0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b}
+	code := append([]byte{2, byte(len(alloc))}, alloc...)
+	code = append(code, byte(len(body)+1), 0x00)
+	code = append(code, body...)
+	module = append(module, wasmSection(10, code...)...)
+	return base64.StdEncoding.EncodeToString(module)
+}
+
+var (
+	// wasmEcho returns its input
+	wasmEcho = testWasmModule(0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b)
+	// wasmSpin never returns
+	wasmSpin = testWasmModule(0x03, 0x40, 0x0c, 0x00, 0x0b, 0x42, 0x00, 0x0b)
+	// wasmGrow traps unless its memory can grow by 2000 pages
+	wasmGrow = testWasmModule(0x41, 0xd0, 0x0f, 0x40, 0x00, 0x41, 0x7f, 0x46, 0x04, 0x40, 0x00, 0x0b, 0x42, 0x00, 0x0b)
+)
+
+func TestWasmNodeRunsModule(t *testing.T) {
+	node, err := NewWasmNode(map[string]interface{}{"module": wasmEcho})
+	require.NoError(t, err)
+
+	inputs := map[string]interface{}{"orders": []interface{}{"a", "b"}, "total": 42.5}
+	out, err := node.Execute(context.Background(), inputs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"orders": []interface{}{"a", "b"}, "total": 42.5}, out["result"])
+}
+
+func TestWasmNodeTimeout(t *testing.T) {
+	start := time.Now()
+	node, err := NewWasmNodeWithOptions(WasmOptions{Timeout: 100 * time.Millisecond})(map[string]interface{}{"module": wasmSpin, "timeout": 60.0})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err.Error())
+	assert.Less(t, time.Since(start), 2*time.Second, "nodes cannot extend the server-wide timeout")
+
+	// Cancelling the workflow stops the module too
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	node, err = NewWasmNode(map[string]interface{}{"module": wasmSpin})
+	require.NoError(t, err)
+	_, err = node.Execute(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWasmNodeMemoryLimit(t *testing.T) {
+	// 2000 more pages need more than the default 64MB
+	node, err := NewWasmNode(map[string]interface{}{"module": wasmGrow})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorContains(t, err, "unreachable")
+
+	options := WasmOptions{MaxMemory: 128 << 20}
+	node, err = NewWasmNodeWithOptions(options)(map[string]interface{}{"module": wasmGrow})
+	require.NoError(t, err)
+	out, err := node.Execute(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Nil(t, out["result"])
+
+	// Nodes can lower the limit but not raise it
+	node, err = NewWasmNodeWithOptions(options)(map[string]interface{}{"module": wasmGrow, "max_memory": "16MB"})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorContains(t, err, "unreachable")
+	node, err = NewWasmNode(map[string]interface{}{"module": wasmGrow, "max_memory": "1GB"})
+	require.NoError(t, err)
+	_, err = node.Execute(context.Background(), nil)
+	assert.ErrorContains(t, err, "unreachable")
+}
+
+func TestWasmNodeConfigValidation(t *testing.T) {
+	// A module importing a host function that is not provided
+	importing := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	importing = append(importing, wasmSection(1, 1, 0x60, 1, 0x7f, 1, 0x7f)...)
+	importing = append(importing, wasmSection(2, append(append([]byte{1}, wasmName("env")...), append(wasmName("http_get"), 0x00, 0)...)...)...)
+
+	for _, tc := range []struct {
+		config map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{}, "module is required"},
+		{map[string]interface{}{"module": "not base64!"}, "module must be base64-encoded"},
+		{map[string]interface{}{"module": "AGFzbQ=="}, "invalid module"},
+		{map[string]interface{}{"module": wasmEcho, "timeout": 0.0}, "timeout must be a positive number of seconds"},
+		{map[string]interface{}{"module": wasmEcho, "max_memory": "lots"}, "max_memory must be a size"},
+		{map[string]interface{}{"module": wasmEcho, "function": "main"}, "module must export main(ptr i32, len i32) i64"},
+		{map[string]interface{}{"module": wasmEcho, "env": map[string]interface{}{"A": 1}}, "environment variables are not permitted"},
+		{map[string]interface{}{"module": base64.StdEncoding.EncodeToString(importing)}, "module imports env.http_get, which is not available"},
+	} {
+		_, err := NewWasmNode(tc.config)
+		assert.ErrorContains(t, err, tc.err)
+	}
+
+	_, err := NewWasmNodeWithOptions(WasmOptions{Permissions: WasmPermissions{EnvironmentVars: true}})(map[string]interface{}{"module": wasmEcho, "env": map[string]interface{}{"A": 1}})
+	assert.NoError(t, err)
+}
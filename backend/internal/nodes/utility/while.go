@@ -0,0 +1,168 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+)
+
+// DefaultMaxIterations bounds while loops when the server sets no limit. It
+// matches the default of workflow.max_depth.
+const DefaultMaxIterations = 20
+
+// Reasons a while loop stops, reported in its "termination_reason" output
+const (
+	WhileConditionFalse = "condition_false"
+	WhileMaxIterations  = "max_iterations"
+)
+
+// WhileOptions holds the server-wide settings of while nodes
+type WhileOptions struct {
+	// MaxIterations bounds every loop; nodes can only set a lower bound. It
+	// mirrors workflow.max_depth of the application config.
+	MaxIterations int
+}
+
+// WhileNode implements a node that runs its body for as long as a condition
+// holds. The condition is configured and evaluated like that of the if_else
+// node. Each iteration's output is the input of the next one, and of the
+// condition checked before it.
+type WhileNode struct {
+	id            string
+	nodeType      string
+	condition     IfElseNode
+	maxIterations int
+	limit         int
+	iterate       func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)
+	config        map[string]interface{}
+}
+
+// Initialize sets up the while node with configuration
+func (w *WhileNode) Initialize(config map[string]interface{}) error {
+	w.config = config
+
+	if err := w.condition.Initialize(config); err != nil {
+		return err
+	}
+	if w.condition.condition == "" && w.condition.operator == "" {
+		return fmt.Errorf("condition or operator is required")
+	}
+
+	w.maxIterations = w.limit
+	if maxIterations, ok := config["max_iterations"]; ok {
+		n, err := toFloat64(maxIterations)
+		if err != nil || n < 1 || n != float64(int(n)) {
+			return fmt.Errorf("max_iterations must be a positive integer")
+		}
+		if int(n) > w.limit {
+			return fmt.Errorf("max_iterations cannot exceed %d", w.limit)
+		}
+		w.maxIterations = int(n)
+	}
+
+	return nil
+}
+
+// SetIterationFunc sets the loop body. The workflow executor uses it to run
+// the nodes connected to the "body" output port. Without a body, iterations
+// return their input unchanged.
+func (w *WhileNode) SetIterationFunc(fn func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)) {
+	w.iterate = fn
+}
+
+// Execute runs the body until the condition fails or the maximum number of
+// iterations is reached
+func (w *WhileNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	state := inputs
+	iterations := 0
+	reason := WhileConditionFalse
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !w.condition.evaluate(state) {
+			break
+		}
+		if iterations == w.maxIterations {
+			reason = WhileMaxIterations
+			break
+		}
+
+		// The body sees the current state and the iteration number
+		item := make(map[string]interface{}, len(state)+1)
+		for k, v := range state {
+			item[k] = v
+		}
+		item["iteration"] = iterations
+
+		result, err := w.runIteration(ctx, item)
+		if err != nil {
+			return nil, fmt.Errorf("iteration %d failed: %w", iterations, err)
+		}
+		state = result
+		iterations++
+	}
+
+	return map[string]interface{}{
+		"result":             state,
+		"iterations":         iterations,
+		"termination_reason": reason,
+		"original_input":     inputs,
+	}, nil
+}
+
+// runIteration executes the loop body once
+func (w *WhileNode) runIteration(ctx context.Context, item map[string]interface{}) (result map[string]interface{}, err error) {
+	if w.iterate == nil {
+		delete(item, "iteration")
+		return item, nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("iteration panicked: %v", r)
+		}
+	}()
+
+	return w.iterate(ctx, item)
+}
+
+// GetType returns the type of the node
+func (w *WhileNode) GetType() string {
+	return w.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (w *WhileNode) GetID() string {
+	return w.id
+}
+
+// NewWhileNode creates a new while node with the default options
+func NewWhileNode(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	return NewWhileNodeWithOptions(WhileOptions{})(config)
+}
+
+// NewWhileNodeWithOptions returns the constructor of while nodes using
+// options
+func NewWhileNodeWithOptions(options WhileOptions) func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+	limit := options.MaxIterations
+	if limit <= 0 {
+		limit = DefaultMaxIterations
+	}
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		node := &WhileNode{
+			id:       fmt.Sprintf("while_%d", time.Now().UnixNano()),
+			nodeType: "while",
+			limit:    limit,
+		}
+
+		if err := node.Initialize(config); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	}
+}
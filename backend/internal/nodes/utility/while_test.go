@@ -0,0 +1,99 @@
+package utility
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// increment is a loop body adding one to "count"
+func increment(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"count": item["count"].(float64) + 1}, nil
+}
+
+func newTestWhile(t *testing.T, options WhileOptions, config map[string]interface{}, body func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)) *WhileNode {
+	t.Helper()
+
+	node, err := NewWhileNodeWithOptions(options)(config)
+	require.NoError(t, err)
+
+	while := node.(*WhileNode)
+	while.SetIterationFunc(body)
+	return while
+}
+
+func TestWhileRunsUntilConditionFails(t *testing.T) {
+	var seen []interface{}
+	node := newTestWhile(t, WhileOptions{}, map[string]interface{}{"field": "count", "operator": "<", "value": float64(3)},
+		func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+			seen = append(seen, item["iteration"])
+			return increment(ctx, item)
+		})
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{"count": float64(0)})
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{0, 1, 2}, seen)
+	assert.Equal(t, map[string]interface{}{"count": float64(3)}, output["result"])
+	assert.Equal(t, 3, output["iterations"])
+	assert.Equal(t, WhileConditionFalse, output["termination_reason"])
+	assert.Equal(t, map[string]interface{}{"count": float64(0)}, output["original_input"])
+}
+
+func TestWhileStopsAtMaxIterations(t *testing.T) {
+	node := newTestWhile(t, WhileOptions{MaxIterations: 10}, map[string]interface{}{"condition": "true", "max_iterations": float64(4)}, increment)
+
+	output, err := node.Execute(context.Background(), map[string]interface{}{"count": float64(0)})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"count": float64(4)}, output["result"])
+	assert.Equal(t, 4, output["iterations"])
+	assert.Equal(t, WhileMaxIterations, output["termination_reason"])
+
+	// Without max_iterations, loops are bounded by the server
+	node = newTestWhile(t, WhileOptions{}, map[string]interface{}{"field": "count", "operator": ">=", "value": float64(0)}, increment)
+	output, err = node.Execute(context.Background(), map[string]interface{}{"count": float64(0)})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultMaxIterations, output["iterations"])
+	assert.Equal(t, WhileMaxIterations, output["termination_reason"])
+
+	_, err = NewWhileNodeWithOptions(WhileOptions{MaxIterations: 10})(map[string]interface{}{"condition": "true", "max_iterations": float64(11)})
+	assert.EqualError(t, err, "max_iterations cannot exceed 10")
+	_, err = NewWhileNode(map[string]interface{}{"condition": "true", "max_iterations": 1.5})
+	assert.Error(t, err)
+	_, err = NewWhileNode(map[string]interface{}{"max_iterations": float64(3)})
+	assert.Error(t, err, "a condition is required")
+}
+
+func TestWhileSkipsBodyWhenConditionIsFalse(t *testing.T) {
+	ran := false
+	node := newTestWhile(t, WhileOptions{}, map[string]interface{}{"field": "done", "operator": "!=", "value": true},
+		func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+			ran = true
+			return item, nil
+		})
+
+	inputs := map[string]interface{}{"done": true}
+	output, err := node.Execute(context.Background(), inputs)
+	require.NoError(t, err)
+
+	assert.False(t, ran)
+	assert.Equal(t, inputs, output["result"])
+	assert.Equal(t, 0, output["iterations"])
+	assert.Equal(t, WhileConditionFalse, output["termination_reason"])
+}
+
+func TestWhileStopsOnFailedIteration(t *testing.T) {
+	node := newTestWhile(t, WhileOptions{}, map[string]interface{}{"condition": "true"},
+		func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+			if item["iteration"] == 1 {
+				return nil, errors.New("boom")
+			}
+			return item, nil
+		})
+
+	_, err := node.Execute(context.Background(), map[string]interface{}{})
+	assert.EqualError(t, err, "iteration 1 failed: boom")
+}
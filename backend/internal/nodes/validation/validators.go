@@ -1,11 +1,17 @@
 package validation
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/mail"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"citadel-agent/backend/internal/nodes/base"
 )
@@ -69,7 +75,7 @@ func (n *EmailValidatorNode) Execute(ctx *base.ExecutionContext, inputs map[stri
 	}
 
 	// Validate email
-	_, err := mail.ParseAddress(email)
+	err := validateEmail(email)
 	valid := err == nil
 
 	result := map[string]interface{}{
@@ -137,8 +143,8 @@ func (n *URLValidatorNode) Execute(ctx *base.ExecutionContext, inputs map[string
 	}
 
 	// Validate URL
-	parsedURL, err := url.Parse(urlStr)
-	valid := err == nil && parsedURL.Scheme != "" && parsedURL.Host != ""
+	parsedURL, err := parseURL(urlStr)
+	valid := err == nil
 
 	result := map[string]interface{}{
 		"valid": valid,
@@ -149,7 +155,7 @@ func (n *URLValidatorNode) Execute(ctx *base.ExecutionContext, inputs map[string
 		result["scheme"] = parsedURL.Scheme
 		result["host"] = parsedURL.Host
 		result["path"] = parsedURL.Path
-	} else if err != nil {
+	} else {
 		result["error"] = err.Error()
 	}
 
@@ -251,3 +257,295 @@ func (n *RegexValidatorNode) Execute(ctx *base.ExecutionContext, inputs map[stri
 
 	return base.CreateSuccessResult(result, time.Since(startTime)), nil
 }
+
+// FormatValidatorNode validates a value as one of several formats
+type FormatValidatorNode struct {
+	*base.BaseNode
+}
+
+// FormatConfig holds format validator configuration
+type FormatConfig struct {
+	ValidateAs string `json:"validate_as"`
+}
+
+// formatValidators check values by the validate_as option naming them
+var formatValidators = map[string]func(string) error{
+	"email":       validateEmail,
+	"phone":       validatePhone,
+	"url":         func(value string) error { _, err := parseURL(value); return err },
+	"credit_card": validateCreditCard,
+	"iban":        validateIBAN,
+	"isbn":        validateISBN,
+	"json":        validateJSON,
+}
+
+// NewFormatValidatorNode creates format validator node
+func NewFormatValidatorNode() base.Node {
+	metadata := base.NodeMetadata{
+		ID:          "format_validator",
+		Name:        "Format Validator",
+		Category:    "validation",
+		Description: "Validate emails, phone numbers, URLs, card numbers, IBANs, ISBNs or JSON",
+		Version:     "1.0.0",
+		Author:      "Citadel Agent",
+		Icon:        "check-circle",
+		Color:       "#22c55e",
+		Inputs: []base.NodeInput{
+			{
+				ID:          "value",
+				Name:        "Value",
+				Type:        "string",
+				Required:    true,
+				Description: "Value to validate",
+			},
+		},
+		Outputs: []base.NodeOutput{
+			{
+				ID:          "valid",
+				Name:        "Valid",
+				Type:        "boolean",
+				Description: "Is valid",
+			},
+			{
+				ID:          "error",
+				Name:        "Error",
+				Type:        "string",
+				Description: "Validation error",
+			},
+		},
+		Config: []base.NodeConfig{
+			{
+				Name:        "validate_as",
+				Label:       "Validate As",
+				Description: "Format the value must have",
+				Type:        "select",
+				Required:    true,
+				Options: []base.ConfigOption{
+					{Label: "Email", Value: "email"},
+					{Label: "Phone number", Value: "phone"},
+					{Label: "URL", Value: "url"},
+					{Label: "Credit card", Value: "credit_card"},
+					{Label: "IBAN", Value: "iban"},
+					{Label: "ISBN", Value: "isbn"},
+					{Label: "JSON", Value: "json"},
+				},
+			},
+		},
+		Tags: []string{"validation", "email", "phone", "credit card", "iban", "isbn", "json"},
+	}
+
+	return &FormatValidatorNode{
+		BaseNode: base.NewBaseNode(metadata),
+	}
+}
+
+// Execute validates value as the configured format
+func (n *FormatValidatorNode) Execute(ctx *base.ExecutionContext, inputs map[string]interface{}) (*base.ExecutionResult, error) {
+	startTime := time.Now()
+
+	// Parse configuration
+	var config FormatConfig
+	if err := base.UnmarshalConfig(ctx.Variables, &config); err != nil {
+		return base.CreateErrorResult(err, time.Since(startTime)), err
+	}
+	validate, ok := formatValidators[config.ValidateAs]
+	if !ok {
+		err := fmt.Errorf("unknown validate_as %q", config.ValidateAs)
+		return base.CreateErrorResult(err, time.Since(startTime)), err
+	}
+
+	value, ok := inputs["value"].(string)
+	if !ok {
+		err := fmt.Errorf("value is required")
+		return base.CreateErrorResult(err, time.Since(startTime)), err
+	}
+
+	err := validate(value)
+	result := map[string]interface{}{
+		"valid":       err == nil,
+		"value":       value,
+		"validate_as": config.ValidateAs,
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+
+	return base.CreateSuccessResult(result, time.Since(startTime)), nil
+}
+
+// validateEmail accepts a bare address as RFC 5322 defines it, with the
+// UTF-8 local parts and domains of RFC 6532. Display names and comments
+// are not part of an address and are rejected.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return err
+	}
+	if addr.Name != "" || addr.Address != email {
+		return errors.New("mail: expected a bare address")
+	}
+	at := strings.LastIndexByte(email, '@')
+	local, domain := email[:at], email[at+1:]
+	if utf8.RuneCountInString(local) > 64 || utf8.RuneCountInString(email) > 254 {
+		return errors.New("mail: address too long")
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return errors.New("mail: invalid domain")
+		}
+	}
+	return nil
+}
+
+// parseURL parses an absolute URL with a host
+func parseURL(value string) (*url.URL, error) {
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, errors.New("url: expected a scheme and a host")
+	}
+	return parsedURL, nil
+}
+
+// validatePhone accepts international numbers of up to 15 digits, as E.164
+// allows, with an optional leading "+" and spaces, dots, dashes or
+// parentheses between the digits. Digits of any script count.
+func validatePhone(phone string) error {
+	digits := 0
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '.' || r == '-' || r == '(' || r == ')':
+		default:
+			return fmt.Errorf("phone: unexpected character %q", r)
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return fmt.Errorf("phone: expected 7 to 15 digits, got %d", digits)
+	}
+	return nil
+}
+
+// validateCreditCard accepts card numbers of 12 to 19 digits, which may be
+// grouped with spaces or dashes, whose Luhn checksum is correct
+func validateCreditCard(card string) error {
+	var digits []int
+	for _, r := range card {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, int(r-'0'))
+		case r == ' ' || r == '-':
+		default:
+			return fmt.Errorf("credit card: unexpected character %q", r)
+		}
+	}
+	if len(digits) < 12 || len(digits) > 19 {
+		return fmt.Errorf("credit card: expected 12 to 19 digits, got %d", len(digits))
+	}
+
+	sum := 0
+	for i := range digits {
+		digit := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	if sum%10 != 0 {
+		return errors.New("credit card: invalid checksum")
+	}
+	return nil
+}
+
+// validateIBAN accepts an IBAN, which may be grouped with spaces, whose
+// ISO 7064 mod 97-10 checksum is correct
+func validateIBAN(iban string) error {
+	iban = strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(iban) < 15 || len(iban) > 34 {
+		return fmt.Errorf("iban: expected 15 to 34 characters, got %d", len(iban))
+	}
+	if !isUpper(iban[0]) || !isUpper(iban[1]) || !isDigit(iban[2]) || !isDigit(iban[3]) {
+		return errors.New("iban: expected a country code and check digits")
+	}
+
+	// The country code and check digits move to the end, and letters
+	// become numbers from 10 for A to 35 for Z
+	var numeric strings.Builder
+	for _, c := range []byte(iban[4:] + iban[:4]) {
+		switch {
+		case isDigit(c):
+			numeric.WriteByte(c)
+		case isUpper(c):
+			fmt.Fprintf(&numeric, "%d", c-'A'+10)
+		default:
+			return fmt.Errorf("iban: unexpected character %q", c)
+		}
+	}
+	n, _ := new(big.Int).SetString(numeric.String(), 10)
+	if new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return errors.New("iban: invalid checksum")
+	}
+	return nil
+}
+
+// validateISBN accepts an ISBN-10 or ISBN-13, which may be hyphenated or
+// spaced, whose check digit is correct
+func validateISBN(isbn string) error {
+	isbn = strings.NewReplacer("-", "", " ", "").Replace(isbn)
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i := 0; i < 10; i++ {
+			var digit int
+			switch {
+			case isDigit(isbn[i]):
+				digit = int(isbn[i] - '0')
+			case i == 9 && (isbn[i] == 'X' || isbn[i] == 'x'):
+				digit = 10
+			default:
+				return fmt.Errorf("isbn: unexpected character %q", isbn[i])
+			}
+			sum += (10 - i) * digit
+		}
+		if sum%11 != 0 {
+			return errors.New("isbn: invalid check digit")
+		}
+	case 13:
+		sum := 0
+		for i := 0; i < 13; i++ {
+			if !isDigit(isbn[i]) {
+				return fmt.Errorf("isbn: unexpected character %q", isbn[i])
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(isbn[i]-'0')
+		}
+		if sum%10 != 0 {
+			return errors.New("isbn: invalid check digit")
+		}
+	default:
+		return fmt.Errorf("isbn: expected 10 or 13 digits, got %d characters", len(isbn))
+	}
+	return nil
+}
+
+// validateJSON accepts a value that parses as JSON
+func validateJSON(value string) error {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+	return nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
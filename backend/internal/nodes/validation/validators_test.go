@@ -0,0 +1,90 @@
+package validation
+
+import (
+	"testing"
+
+	"citadel-agent/backend/internal/nodes/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validateAs(t *testing.T, format, value string) map[string]interface{} {
+	t.Helper()
+	ctx := &base.ExecutionContext{Variables: map[string]interface{}{"validate_as": format}}
+	result, err := NewFormatValidatorNode().Execute(ctx, map[string]interface{}{"value": value})
+	require.NoError(t, err)
+	return result.Data
+}
+
+func TestFormatValidatorAcceptsInternationalInputs(t *testing.T) {
+	for _, tc := range []struct{ format, value string }{
+		{"email", "user@example.com"},
+		{"email", "first.last+tag@sub.example.co.uk"},
+		{"email", "用户@例子.广告"},
+		{"email", "José.Muñoz@correo.es"},
+		{"phone", "+1 (415) 555-2671"},
+		{"phone", "+44 20 7946 0958"},
+		{"phone", "+81-3-1234-5678"},
+		{"phone", "+91 98765 43210"},
+		{"phone", "+٩٧١ ٥٠ ١٢٣ ٤٥٦٧"},
+		{"url", "https://example.com/path?q=1"},
+		{"credit_card", "4111 1111 1111 1111"},
+		{"credit_card", "5500-0000-0000-0004"},
+		{"iban", "GB82 WEST 1234 5698 7654 32"},
+		{"iban", "de89370400440532013000"},
+		{"isbn", "0-306-40615-2"},
+		{"isbn", "080442957X"},
+		{"isbn", "978-3-16-148410-0"},
+		{"json", `{"items": [1, 2, {"nested": null}]}`},
+		{"json", `"just a string"`},
+	} {
+		data := validateAs(t, tc.format, tc.value)
+		assert.Equal(t, true, data["valid"], "%s %q: %v", tc.format, tc.value, data["error"])
+	}
+}
+
+func TestFormatValidatorRejectsMalformedInputs(t *testing.T) {
+	for _, tc := range []struct{ format, value, err string }{
+		{"email", "Jane Doe <jane@example.com>", "bare address"},
+		{"email", "no-at-sign.example.com", "mail:"},
+		{"email", "jane@example..com", "mail:"},
+		{"email", "jane@-example.com", "invalid domain"},
+		{"phone", "555-CALL-NOW", "unexpected character"},
+		{"phone", "12345", "7 to 15 digits"},
+		{"phone", "1+2345678", "unexpected character"},
+		{"url", "example.com", "scheme and a host"},
+		{"credit_card", "4111 1111 1111 1112", "invalid checksum"},
+		{"credit_card", "4111a1111111111", "unexpected character"},
+		{"credit_card", "4111１１１１11111111", "unexpected character"},
+		{"credit_card", "4242", "12 to 19 digits"},
+		{"iban", "GB82 WEST 1234 5698 7654 33", "invalid checksum"},
+		{"iban", "GB82-WEST-1234-5698-7654-32", "unexpected character"},
+		{"iban", "1282WEST12345698765432", "country code"},
+		{"isbn", "0-306-40615-3", "invalid check digit"},
+		{"isbn", "978-3-16-148410-1", "invalid check digit"},
+		{"isbn", "97831614841X0", "unexpected character"},
+		{"json", `{"unterminated": `, "json:"},
+		{"json", "", "json:"},
+	} {
+		data := validateAs(t, tc.format, tc.value)
+		assert.Equal(t, false, data["valid"], "%s %q", tc.format, tc.value)
+		assert.Contains(t, data["error"], tc.err, "%s %q", tc.format, tc.value)
+	}
+}
+
+func TestFormatValidatorRequiresKnownFormat(t *testing.T) {
+	ctx := &base.ExecutionContext{Variables: map[string]interface{}{"validate_as": "postcode"}}
+	_, err := NewFormatValidatorNode().Execute(ctx, map[string]interface{}{"value": "SW1A 1AA"})
+	assert.EqualError(t, err, `unknown validate_as "postcode"`)
+}
+
+func TestEmailValidatorRejectsDisplayNames(t *testing.T) {
+	node := NewEmailValidatorNode()
+	result, err := node.Execute(&base.ExecutionContext{}, map[string]interface{}{"email": "Ünïcode <ü@example.de>"})
+	require.NoError(t, err)
+	assert.Equal(t, false, result.Data["valid"])
+
+	result, err = node.Execute(&base.ExecutionContext{}, map[string]interface{}{"email": "ü@example.de"})
+	require.NoError(t, err)
+	assert.Equal(t, true, result.Data["valid"])
+}
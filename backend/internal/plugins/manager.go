@@ -0,0 +1,523 @@
+package plugins
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+)
+
+var (
+	// ErrFileTooLarge is returned for plugin files over Options.MaxFileSize
+	ErrFileTooLarge = errors.New("plugin file is too large")
+	// ErrNotAllowed is returned for plugins that are blacklisted, or not
+	// whitelisted when there is a whitelist
+	ErrNotAllowed = errors.New("plugin is not allowed")
+)
+
+// LoadError is the error of a plugin that could not be loaded. Other
+// plugins load regardless.
+type LoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("plugin %s: %v", e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Options configure where plugins are loaded from. Their fields match
+// config.PluginConfig.
+type Options struct {
+	// Directories are scanned for plugin executables, without descending
+	// into subdirectories. Missing directories are skipped.
+	Directories []string
+	// MaxFileSize bounds the size of plugin files in bytes; 0 is unlimited
+	MaxFileSize int64
+	// Whitelist and Blacklist are patterns, as for filepath.Match, of plugin
+	// names: file names without their extension. The blacklist wins.
+	Whitelist []string
+	Blacklist []string
+	// ScanInterval is how often Run scans for new and changed plugins; 0
+	// only scans at startup
+	ScanInterval time.Duration
+	// RequireSignature refuses plugins without a signature file. Plugins
+	// with a signature that does not verify with any of TrustedKeys are
+	// refused either way.
+	RequireSignature bool
+	TrustedKeys      []ed25519.PublicKey
+}
+
+// DefaultOptions loads plugins from ./plugins every 5 minutes
+func DefaultOptions() Options {
+	return Options{
+		Directories:  []string{"./plugins"},
+		MaxFileSize:  50 << 20,
+		ScanInterval: 5 * time.Minute,
+	}
+}
+
+// FromEnv overrides defaults with the CITADEL_PLUGIN_* environment
+// variables that also configure config.Plugin. CITADEL_PLUGIN_DIRECTORY and
+// CITADEL_PLUGIN_ALLOWED_DIRECTORIES are scanned together.
+// CITADEL_PLUGIN_TRUSTED_KEYS are base64-encoded Ed25519 public keys. Lists
+// are comma-separated.
+func FromEnv(defaults Options) Options {
+	options := defaults
+	directory, hasDirectory := os.LookupEnv("CITADEL_PLUGIN_DIRECTORY")
+	allowed, hasAllowed := os.LookupEnv("CITADEL_PLUGIN_ALLOWED_DIRECTORIES")
+	if hasDirectory || hasAllowed {
+		options.Directories = nil
+		for _, dir := range append(splitList(directory), splitList(allowed)...) {
+			if !contains(options.Directories, dir) {
+				options.Directories = append(options.Directories, dir)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("CITADEL_PLUGIN_WHITELIST"); ok {
+		options.Whitelist = splitList(v)
+	}
+	if v, ok := os.LookupEnv("CITADEL_PLUGIN_BLACKLIST"); ok {
+		options.Blacklist = splitList(v)
+	}
+	if v, err := strconv.ParseInt(os.Getenv("CITADEL_PLUGIN_MAX_FILE_SIZE"), 10, 64); err == nil {
+		options.MaxFileSize = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CITADEL_PLUGIN_SCAN_INTERVAL")); err == nil {
+		options.ScanInterval = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("CITADEL_PLUGIN_REQUIRE_SIGNATURE")); err == nil {
+		options.RequireSignature = v
+	}
+	if v, ok := os.LookupEnv("CITADEL_PLUGIN_TRUSTED_KEYS"); ok {
+		options.TrustedKeys = nil
+		for _, item := range splitList(v) {
+			key, err := ParsePublicKey(item)
+			if err != nil {
+				log.Printf("Ignoring trusted plugin key %q: %v", item, err)
+				continue
+			}
+			options.TrustedKeys = append(options.TrustedKeys, key)
+		}
+	}
+	return options
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry is where plugin node types are registered, such as
+// engine.NodeTypeRegistryImpl
+type Registry interface {
+	RegisterNodeType(id string, creator func() types.NodeInstance, metadata types.NodeMetadata) error
+}
+
+// fileState identifies a version of a plugin file and its signature
+type fileState struct {
+	size      int64
+	modTime   int64 // Unix nanoseconds
+	signature int64
+}
+
+// loadedPlugin is a running plugin process
+type loadedPlugin struct {
+	path     string
+	state    fileState
+	client   *plugin.Client
+	node     *rpcClient
+	metadata NodeMetadata
+}
+
+// NodeManager loads plugins and registers their node types. Changed plugin
+// files are reloaded in place on the next scan; node types of plugins that
+// were removed stay registered but fail to execute.
+type NodeManager struct {
+	options Options
+	logger  hclog.Logger
+
+	mu            sync.Mutex
+	loaded        map[string]*loadedPlugin // by path
+	nodes         map[string]*loadedPlugin // by node type
+	failed        map[string]fileState     // files that failed to load, by path
+	started       map[string]bool          // node types registered so far
+	verifications map[string]Verification  // by path
+}
+
+// NewNodeManager creates a node manager with the default options
+func NewNodeManager() *NodeManager {
+	return NewNodeManagerWithOptions(DefaultOptions())
+}
+
+// NewNodeManagerWithOptions creates a node manager loading plugins as
+// configured by options
+func NewNodeManagerWithOptions(options Options) *NodeManager {
+	return &NodeManager{
+		options: options,
+		logger:  hclog.New(&hclog.LoggerOptions{Name: "plugin", Level: hclog.Warn}),
+		loaded:  make(map[string]*loadedPlugin),
+		nodes:   make(map[string]*loadedPlugin),
+		failed:  make(map[string]fileState),
+		started: make(map[string]bool),
+
+		verifications: make(map[string]Verification),
+	}
+}
+
+// Run scans for plugins, then again every ScanInterval until ctx is done,
+// logging the plugins that fail to load
+func (m *NodeManager) Run(ctx context.Context, registry Registry) {
+	m.scanAndLog(registry)
+	if m.options.ScanInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.options.ScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.scanAndLog(registry)
+		}
+	}
+}
+
+func (m *NodeManager) scanAndLog(registry Registry) {
+	for _, err := range m.Scan(registry) {
+		log.Printf("Failed to load %v", err)
+	}
+}
+
+// Scan loads the plugins that are new or changed since the last scan and
+// registers their node types with registry. It returns an error for each
+// plugin that failed to load; files that keep failing are reported once.
+func (m *NodeManager) Scan(registry Registry) []*LoadError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var loadErrors []*LoadError
+	seen := make(map[string]bool)
+	for _, dir := range m.options.Directories {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			loadErrors = append(loadErrors, &LoadError{Path: dir, Err: err})
+			continue
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() || !isExecutable(info) {
+				continue
+			}
+			seen[path] = true
+
+			state := fileState{size: info.Size(), modTime: info.ModTime().UnixNano(), signature: signatureState(path)}
+			if loaded := m.loaded[path]; loaded != nil && loaded.state == state {
+				continue
+			}
+			if failed, ok := m.failed[path]; ok && failed == state {
+				continue
+			}
+
+			if err := m.load(registry, path, state); err != nil {
+				m.failed[path] = state
+				loadErrors = append(loadErrors, &LoadError{Path: path, Err: err})
+				continue
+			}
+			delete(m.failed, path)
+		}
+	}
+
+	// Stop the plugins whose files are gone
+	for path, loaded := range m.loaded {
+		if !seen[path] {
+			m.unload(loaded)
+		}
+	}
+	for path := range m.failed {
+		if !seen[path] {
+			delete(m.failed, path)
+		}
+	}
+	for path := range m.verifications {
+		if !seen[path] {
+			delete(m.verifications, path)
+		}
+	}
+
+	return loadErrors
+}
+
+// load starts the plugin at path and registers its node type, replacing
+// the plugin previously loaded from path
+func (m *NodeManager) load(registry Registry, path string, state fileState) error {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if !m.allowed(name) {
+		return ErrNotAllowed
+	}
+	if m.options.MaxFileSize > 0 && state.size > m.options.MaxFileSize {
+		return fmt.Errorf("%w: %d bytes, at most %d are allowed", ErrFileTooLarge, state.size, m.options.MaxFileSize)
+	}
+	if err := m.verify(path); err != nil {
+		return err
+	}
+
+	loaded, err := m.start(path)
+	if err != nil {
+		return err
+	}
+	loaded.state = state
+	id := loaded.metadata.ID
+
+	if other := m.nodes[id]; other != nil && other.path != path {
+		loaded.client.Kill()
+		return fmt.Errorf("node type %s is already served by %s", id, other.path)
+	}
+	if !m.started[id] {
+		schema, err := loaded.node.configSchema()
+		if err != nil {
+			loaded.client.Kill()
+			return fmt.Errorf("failed to get the config schema: %w", err)
+		}
+		category := loaded.metadata.Category
+		if category == "" {
+			category = "plugin"
+		}
+		metadata := types.NodeMetadata{
+			ID:          id,
+			Name:        loaded.metadata.Name,
+			Category:    category,
+			Description: loaded.metadata.Description,
+			Inputs:      schema,
+			Version:     loaded.metadata.Version,
+		}
+		if err := registry.RegisterNodeType(id, engine.AdaptNode(m.constructor(id), metadata), metadata); err != nil {
+			loaded.client.Kill()
+			return err
+		}
+		m.started[id] = true
+	}
+
+	if previous := m.loaded[path]; previous != nil {
+		m.unload(previous)
+	}
+	m.loaded[path] = loaded
+	m.nodes[id] = loaded
+	return nil
+}
+
+// start runs the plugin at path and asks it for its node
+func (m *NodeManager) start(path string) (*loadedPlugin, error) {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          plugin.PluginSet{PluginName: &NodePluginImpl{}},
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolNetRPC},
+		Logger:           m.logger,
+	})
+
+	protocol, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to start: %w", err)
+	}
+	raw, err := protocol.Dispense(PluginName)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to get the node: %w", err)
+	}
+	node, ok := raw.(*rpcClient)
+	if !ok {
+		client.Kill()
+		return nil, fmt.Errorf("plugin does not serve a node")
+	}
+
+	metadata, err := node.metadata()
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to get the node metadata: %w", err)
+	}
+	if metadata.ID == "" {
+		client.Kill()
+		return nil, fmt.Errorf("node metadata has no ID")
+	}
+
+	return &loadedPlugin{path: path, client: client, node: node, metadata: metadata}, nil
+}
+
+// unload stops a plugin
+func (m *NodeManager) unload(loaded *loadedPlugin) {
+	loaded.client.Kill()
+	if m.loaded[loaded.path] == loaded {
+		delete(m.loaded, loaded.path)
+	}
+	if m.nodes[loaded.metadata.ID] == loaded {
+		delete(m.nodes, loaded.metadata.ID)
+	}
+}
+
+// allowed applies the whitelist and blacklist to a plugin name
+func (m *NodeManager) allowed(name string) bool {
+	if matchAny(m.options.Blacklist, name) {
+		return false
+	}
+	return len(m.options.Whitelist) == 0 || matchAny(m.options.Whitelist, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isExecutable reports whether info is of a file that can be run as a
+// plugin
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+	}
+	return info.Mode().Perm()&0o111 != 0
+}
+
+// Plugins returns the metadata of the loaded plugins, sorted by node type
+func (m *NodeManager) Plugins() []NodeMetadata {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metadata := make([]NodeMetadata, 0, len(m.nodes))
+	for _, loaded := range m.nodes {
+		metadata = append(metadata, loaded.metadata)
+	}
+	sort.Slice(metadata, func(i, j int) bool { return metadata[i].ID < metadata[j].ID })
+	return metadata
+}
+
+// Verifications returns the result of the last signature check of each
+// plugin file, sorted by path
+func (m *NodeManager) Verifications() []Verification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	verifications := make([]Verification, 0, len(m.verifications))
+	for _, verification := range m.verifications {
+		verifications = append(verifications, verification)
+	}
+	sort.Slice(verifications, func(i, j int) bool { return verifications[i].Path < verifications[j].Path })
+	return verifications
+}
+
+// Close stops all plugins
+func (m *NodeManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, loaded := range m.loaded {
+		m.unload(loaded)
+	}
+}
+
+// node returns the node of the plugin currently serving nodeType
+func (m *NodeManager) node(nodeType string) (*rpcClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	loaded := m.nodes[nodeType]
+	if loaded == nil {
+		return nil, fmt.Errorf("the plugin of node type %s is not loaded", nodeType)
+	}
+	return loaded.node, nil
+}
+
+// constructor returns the node constructor of a plugin node type. Nodes
+// look the plugin up when they execute, so that they use the one loaded
+// last.
+func (m *NodeManager) constructor(nodeType string) engine.NodeConstructor {
+	return func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		return &pluginNode{
+			id:       fmt.Sprintf("%s_%d", nodeType, time.Now().UnixNano()),
+			nodeType: nodeType,
+			config:   config,
+			manager:  m,
+		}, nil
+	}
+}
+
+// pluginNode is a node executed by a plugin
+type pluginNode struct {
+	id       string
+	nodeType string
+	config   map[string]interface{}
+	manager  *NodeManager
+}
+
+// Execute runs the node in its plugin, with inputs merged over the node
+// configuration
+func (p *pluginNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	node, err := p.manager.node(p.nodeType)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]interface{}, len(p.config)+len(inputs))
+	for k, v := range p.config {
+		merged[k] = v
+	}
+	for k, v := range inputs {
+		merged[k] = v
+	}
+	return node.Execute(ctx, merged)
+}
+
+// GetType returns the type of the node
+func (p *pluginNode) GetType() string {
+	return p.nodeType
+}
+
+// GetID returns the unique identifier for this node instance
+func (p *pluginNode) GetID() string {
+	return p.id
+}
@@ -0,0 +1,184 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// greeterNode is the node of the sample plugin. Its ID comes from
+// GREETER_ID so that one binary can serve several plugins.
+type greeterNode struct {
+	id string
+}
+
+func (g *greeterNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	name, ok := inputs["name"].(string)
+	if !ok {
+		return nil, errors.New("name is required")
+	}
+	salutation, _ := inputs["salutation"].(string)
+	return map[string]interface{}{"greeting": salutation + ", " + name}, nil
+}
+
+func (g *greeterNode) GetConfigSchema() map[string]interface{} {
+	return map[string]interface{}{"salutation": map[string]interface{}{"type": "string"}}
+}
+
+func (g *greeterNode) GetMetadata() NodeMetadata {
+	return NodeMetadata{ID: g.id, Name: "Greeter", Description: "Greets by name", Version: "1.0.0"}
+}
+
+// TestMain serves the sample plugin when the test binary is started as one
+func TestMain(m *testing.M) {
+	if os.Getenv(Handshake.MagicCookieKey) == Handshake.MagicCookieValue {
+		plugin.Serve(&plugin.ServeConfig{
+			HandshakeConfig: Handshake,
+			Plugins:         plugin.PluginSet{PluginName: &NodePluginImpl{Impl: &greeterNode{id: os.Getenv("GREETER_ID")}}},
+		})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// writePlugin writes a plugin executable to dir serving the sample plugin
+// as node type id
+func writePlugin(t *testing.T, dir, name, id string) string {
+	t.Helper()
+	self, err := os.Executable()
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\nGREETER_ID=%s exec %q\n", id, self)
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+func executeNode(t *testing.T, registry *engine.NodeTypeRegistryImpl, nodeType string, config, inputs map[string]interface{}) types.NodeOutput {
+	t.Helper()
+	creator, ok := registry.GetNodeType(nodeType)
+	require.True(t, ok, "node type %s is not registered", nodeType)
+	node := creator()
+	require.NoError(t, node.Initialize(config))
+	return node.Execute(context.Background(), types.NodeInput{Data: inputs})
+}
+
+func TestNodeManagerLoadsPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sample plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "greeter", "greeter")
+	writePlugin(t, dir, "blocked", "blocked")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a plugin"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	large := make([]byte, 4096)
+	copy(large, "#!/bin/sh\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "large"), large, 0o755))
+
+	manager := NewNodeManagerWithOptions(Options{
+		Directories: []string{dir, filepath.Join(dir, "missing")},
+		MaxFileSize: 1024,
+		Blacklist:   []string{"block*"},
+	})
+	defer manager.Close()
+	registry := engine.NewNodeTypeRegistry()
+
+	// Plugins that fail to load are reported, without stopping the others
+	loadErrors := manager.Scan(registry)
+	require.Len(t, loadErrors, 3)
+	failed := make(map[string]error)
+	for _, err := range loadErrors {
+		failed[filepath.Base(err.Path)] = err
+	}
+	assert.ErrorIs(t, failed["blocked"], ErrNotAllowed)
+	assert.ErrorIs(t, failed["large"], ErrFileTooLarge)
+	assert.Contains(t, failed["broken"].Error(), "failed to start")
+
+	metadata, ok := registry.GetNodeMetadata("greeter")
+	require.True(t, ok)
+	assert.Equal(t, "plugin", metadata.Category)
+	assert.Contains(t, metadata.Inputs, "salutation")
+	assert.Equal(t, []NodeMetadata{{ID: "greeter", Name: "Greeter", Description: "Greets by name", Version: "1.0.0"}}, manager.Plugins())
+
+	// Inputs are merged over the node configuration
+	output := executeNode(t, registry, "greeter", map[string]interface{}{"salutation": "Hello"}, map[string]interface{}{"name": "Ada"})
+	require.NoError(t, output.Error)
+	assert.Equal(t, map[string]interface{}{"greeting": "Hello, Ada"}, output.Data)
+
+	output = executeNode(t, registry, "greeter", map[string]interface{}{"salutation": "Hello"}, nil)
+	require.Error(t, output.Error)
+	assert.Contains(t, output.Error.Error(), "name is required")
+
+	// Later scans only load new and changed plugins, and failing ones are
+	// not reported again
+	writePlugin(t, dir, "farewell", "farewell")
+	assert.Empty(t, manager.Scan(registry))
+	output = executeNode(t, registry, "farewell", map[string]interface{}{"salutation": "Goodbye", "name": "Ada"}, nil)
+	require.NoError(t, output.Error)
+	assert.Equal(t, "Goodbye, Ada", output.Data["greeting"])
+
+	// Plugins serving a node type that is taken are refused
+	writePlugin(t, dir, "impostor", "greeter")
+	loadErrors = manager.Scan(registry)
+	require.Len(t, loadErrors, 1)
+	assert.Contains(t, loadErrors[0].Error(), "node type greeter is already served by")
+
+	// Node types of removed plugins no longer execute
+	require.NoError(t, os.Remove(filepath.Join(dir, "farewell")))
+	assert.Empty(t, manager.Scan(registry))
+	output = executeNode(t, registry, "farewell", nil, map[string]interface{}{"name": "Ada"})
+	require.Error(t, output.Error)
+	assert.Contains(t, output.Error.Error(), "not loaded")
+}
+
+func TestNodeManagerWhitelist(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sample plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "greeter", "greeter")
+	writePlugin(t, dir, "other", "other")
+
+	manager := NewNodeManagerWithOptions(Options{Directories: []string{dir}, Whitelist: []string{"greeter"}})
+	defer manager.Close()
+	registry := engine.NewNodeTypeRegistry()
+
+	loadErrors := manager.Scan(registry)
+	require.Len(t, loadErrors, 1)
+	assert.ErrorIs(t, loadErrors[0], ErrNotAllowed)
+	assert.Equal(t, filepath.Join(dir, "other"), loadErrors[0].Path)
+	_, ok := registry.GetNodeType("greeter")
+	assert.True(t, ok)
+
+	// Run scans at startup and returns when ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	manager.options.ScanInterval = 10 * time.Millisecond
+	manager.Run(ctx, registry)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CITADEL_PLUGIN_DIRECTORY", "./plugins")
+	t.Setenv("CITADEL_PLUGIN_ALLOWED_DIRECTORIES", "./plugins, /opt/citadel-agent/plugins")
+	t.Setenv("CITADEL_PLUGIN_BLACKLIST", "legacy-*")
+	t.Setenv("CITADEL_PLUGIN_MAX_FILE_SIZE", "1048576")
+	t.Setenv("CITADEL_PLUGIN_SCAN_INTERVAL", "1m")
+
+	options := FromEnv(DefaultOptions())
+	assert.Equal(t, []string{"./plugins", "/opt/citadel-agent/plugins"}, options.Directories)
+	assert.Equal(t, []string{"legacy-*"}, options.Blacklist)
+	assert.Empty(t, options.Whitelist)
+	assert.Equal(t, int64(1048576), options.MaxFileSize)
+	assert.Equal(t, time.Minute, options.ScanInterval)
+}
@@ -0,0 +1,170 @@
+// Package plugins loads node types from plugin executables. Plugins run as
+// subprocesses speaking the hashicorp/go-plugin protocol, so that a plugin
+// crashing cannot take the server down with it. A plugin serves a single
+// node type:
+//
+//	func main() {
+//		plugin.Serve(&plugin.ServeConfig{
+//			HandshakeConfig: plugins.Handshake,
+//			Plugins: map[string]plugin.Plugin{
+//				plugins.PluginName: &plugins.NodePluginImpl{Impl: &MyNode{}},
+//			},
+//		})
+//	}
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"net/rpc"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// PluginName is the name plugins serve their node under
+const PluginName = "node"
+
+// Handshake is shared by the server and its plugins, so that plugin
+// executables refuse to run on their own and incompatible protocol versions
+// are detected
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "CITADEL_PLUGIN",
+	MagicCookieValue: "node",
+}
+
+// NodeMetadata describes the node type a plugin serves
+type NodeMetadata struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	Author      string `json:"author"`
+	Category    string `json:"category"`
+}
+
+// NodePlugin is implemented by the node of a plugin. Execute gets the node
+// configuration with the inputs of the node merged over it.
+type NodePlugin interface {
+	Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error)
+	GetConfigSchema() map[string]interface{}
+	GetMetadata() NodeMetadata
+}
+
+// NodePluginImpl is the plugin.Plugin of a node, served by plugins with
+// Impl set and used by the server without
+type NodePluginImpl struct {
+	Impl NodePlugin
+}
+
+// Server returns the RPC server of the plugin side
+func (p *NodePluginImpl) Server(*plugin.MuxBroker) (interface{}, error) {
+	return &rpcServer{impl: p.Impl}, nil
+}
+
+// Client returns the RPC client of the server side
+func (p *NodePluginImpl) Client(_ *plugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return &rpcClient{client: client}, nil
+}
+
+// ExecuteArgs are the arguments of the Execute call. Values cross the
+// process boundary as JSON, so plugins see numbers as float64 like nodes
+// running in process do.
+type ExecuteArgs struct {
+	Inputs []byte
+}
+
+// ExecuteReply is the reply to the Execute call
+type ExecuteReply struct {
+	Outputs []byte
+}
+
+// rpcServer calls the node of a plugin
+type rpcServer struct {
+	impl NodePlugin
+}
+
+func (s *rpcServer) Execute(args ExecuteArgs, reply *ExecuteReply) error {
+	var inputs map[string]interface{}
+	if err := json.Unmarshal(args.Inputs, &inputs); err != nil {
+		return err
+	}
+	outputs, err := s.impl.Execute(context.Background(), inputs)
+	if err != nil {
+		return err
+	}
+	reply.Outputs, err = json.Marshal(outputs)
+	return err
+}
+
+func (s *rpcServer) GetConfigSchema(_ struct{}, reply *[]byte) error {
+	schema, err := json.Marshal(s.impl.GetConfigSchema())
+	*reply = schema
+	return err
+}
+
+func (s *rpcServer) GetMetadata(_ struct{}, reply *NodeMetadata) error {
+	*reply = s.impl.GetMetadata()
+	return nil
+}
+
+// rpcClient is the NodePlugin of a running plugin
+type rpcClient struct {
+	client *rpc.Client
+}
+
+// Execute runs the node of the plugin. When ctx is done first, Execute
+// returns without waiting for the plugin.
+func (c *rpcClient) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply ExecuteReply
+	call := c.client.Go("Plugin.Execute", ExecuteArgs{Inputs: data}, &reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.Done:
+	}
+	if call.Error != nil {
+		return nil, call.Error
+	}
+
+	var outputs map[string]interface{}
+	if err := json.Unmarshal(reply.Outputs, &outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+func (c *rpcClient) GetConfigSchema() map[string]interface{} {
+	schema, _ := c.configSchema()
+	return schema
+}
+
+func (c *rpcClient) GetMetadata() NodeMetadata {
+	metadata, _ := c.metadata()
+	return metadata
+}
+
+// configSchema is GetConfigSchema with the error of the call
+func (c *rpcClient) configSchema() (map[string]interface{}, error) {
+	var data []byte
+	if err := c.client.Call("Plugin.GetConfigSchema", struct{}{}, &data); err != nil {
+		return nil, err
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// metadata is GetMetadata with the error of the call
+func (c *rpcClient) metadata() (NodeMetadata, error) {
+	var metadata NodeMetadata
+	err := c.client.Call("Plugin.GetMetadata", struct{}{}, &metadata)
+	return metadata, err
+}
@@ -0,0 +1,129 @@
+package plugins
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// SignatureExtension is appended to the path of a plugin for its detached
+// signature, which holds the base64-encoded Ed25519 signature of the plugin
+// file
+const SignatureExtension = ".sig"
+
+var (
+	// ErrUnsigned is returned for plugins without a signature file
+	ErrUnsigned = errors.New("plugin is not signed")
+	// ErrInvalidSignature is returned for plugins whose signature does not
+	// verify with any trusted key, because the plugin was changed after it
+	// was signed or signed by another key
+	ErrInvalidSignature = errors.New("plugin signature is not valid")
+)
+
+// Verification statuses
+const (
+	VerificationVerified = "verified"
+	VerificationUnsigned = "unsigned"
+	VerificationInvalid  = "invalid"
+)
+
+// Verification is the result of checking the signature of a plugin file
+type Verification struct {
+	Path      string    `json:"path"`
+	Status    string    `json:"status"`
+	KeyID     string    `json:"key_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ParsePublicKey parses a base64-encoded Ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("public key must be base64 encoded: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// KeyID identifies a public key in verification results by the first
+// bytes of its SHA-256 hash
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign returns the contents of the signature file of a plugin
+func Sign(key ed25519.PrivateKey, plugin []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, plugin)) + "\n")
+}
+
+// verifySignature checks the signature file of the plugin at path against
+// keys, returning the ID of the key that signed it
+func verifySignature(path string, keys []ed25519.PublicKey) (string, error) {
+	data, err := os.ReadFile(path + SignatureExtension)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrUnsigned
+	}
+	if err != nil {
+		return "", err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return "", fmt.Errorf("%w: malformed signature file", ErrInvalidSignature)
+	}
+
+	plugin, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, plugin, signature) {
+			return KeyID(key), nil
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+// verify checks and records the signature of the plugin at path. Unsigned
+// plugins are only refused when signatures are required, tampered ones
+// always.
+func (m *NodeManager) verify(path string) error {
+	verification := Verification{Path: path, CheckedAt: time.Now()}
+	keyID, err := verifySignature(path, m.options.TrustedKeys)
+	switch {
+	case err == nil:
+		verification.Status = VerificationVerified
+		verification.KeyID = keyID
+	case errors.Is(err, ErrUnsigned):
+		verification.Status = VerificationUnsigned
+		if !m.options.RequireSignature {
+			err = nil
+		}
+	default:
+		verification.Status = VerificationInvalid
+	}
+	if err != nil {
+		verification.Error = err.Error()
+	}
+	m.verifications[path] = verification
+	return err
+}
+
+// signatureState identifies a version of the signature file of the plugin
+// at path, 0 when there is none
+func signatureState(path string) int64 {
+	info, err := os.Stat(path + SignatureExtension)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
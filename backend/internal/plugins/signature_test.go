@@ -0,0 +1,118 @@
+package plugins
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signPlugin(t *testing.T, path string, key ed25519.PrivateKey) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path+SignatureExtension, Sign(key, data), 0o644))
+}
+
+func TestNodeManagerVerifiesSignatures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sample plugins are shell scripts")
+	}
+	trusted, trustedKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	signPlugin(t, writePlugin(t, dir, "signed", "signed"), trustedKey)
+	signPlugin(t, writePlugin(t, dir, "foreign", "foreign"), otherKey)
+	corrupted := writePlugin(t, dir, "corrupted", "corrupted")
+	signPlugin(t, corrupted, trustedKey)
+	f, err := os.OpenFile(corrupted, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	f.WriteString("# tampered\n")
+	f.Close()
+	unsigned := writePlugin(t, dir, "unsigned", "unsigned")
+
+	manager := NewNodeManagerWithOptions(Options{
+		Directories:      []string{dir},
+		RequireSignature: true,
+		TrustedKeys:      []ed25519.PublicKey{trusted},
+	})
+	defer manager.Close()
+	registry := engine.NewNodeTypeRegistry()
+
+	loadErrors := manager.Scan(registry)
+	require.Len(t, loadErrors, 3)
+	failed := make(map[string]error)
+	for _, err := range loadErrors {
+		failed[filepath.Base(err.Path)] = err
+	}
+	assert.ErrorIs(t, failed["foreign"], ErrInvalidSignature)
+	assert.ErrorIs(t, failed["corrupted"], ErrInvalidSignature)
+	assert.ErrorIs(t, failed["unsigned"], ErrUnsigned)
+	_, ok := registry.GetNodeType("signed")
+	assert.True(t, ok)
+
+	statuses := make(map[string]Verification)
+	for _, verification := range manager.Verifications() {
+		statuses[filepath.Base(verification.Path)] = verification
+	}
+	assert.Equal(t, VerificationVerified, statuses["signed"].Status)
+	assert.Equal(t, KeyID(trusted), statuses["signed"].KeyID)
+	assert.Equal(t, VerificationInvalid, statuses["foreign"].Status)
+	assert.Equal(t, VerificationInvalid, statuses["corrupted"].Status)
+	assert.Equal(t, VerificationUnsigned, statuses["unsigned"].Status)
+	assert.NotEmpty(t, statuses["unsigned"].Error)
+
+	// Signing a refused plugin gets it loaded on the next scan
+	signPlugin(t, unsigned, trustedKey)
+	assert.Empty(t, manager.Scan(registry))
+	_, ok = registry.GetNodeType("unsigned")
+	assert.True(t, ok)
+}
+
+func TestNodeManagerAllowsUnsignedPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sample plugins are shell scripts")
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "unsigned", "unsigned")
+	signPlugin(t, writePlugin(t, dir, "foreign", "foreign"), otherKey)
+
+	// Without RequireSignature unsigned plugins load, but ones with a bad
+	// signature still do not
+	manager := NewNodeManagerWithOptions(Options{Directories: []string{dir}})
+	defer manager.Close()
+	loadErrors := manager.Scan(engine.NewNodeTypeRegistry())
+	require.Len(t, loadErrors, 1)
+	assert.ErrorIs(t, loadErrors[0], ErrInvalidSignature)
+
+	verifications := manager.Verifications()
+	require.Len(t, verifications, 2)
+	assert.Equal(t, VerificationUnsigned, verifications[1].Status)
+	assert.Empty(t, verifications[1].Error)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	key, err := ParsePublicKey(base64.StdEncoding.EncodeToString(public))
+	require.NoError(t, err)
+	assert.Equal(t, public, key)
+
+	_, err = ParsePublicKey("not base64!")
+	assert.Error(t, err)
+	_, err = ParsePublicKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduleTriggerNodeType is the node type whose cron expression and
+// timezone the scheduler discovers from deployed workflows
+const ScheduleTriggerNodeType = "schedule_trigger"
+
+// cronParser accepts standard 5-field expressions plus descriptors such as
+// "@hourly" and "@every 5m"
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule parses a cron expression into a schedule
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("cron expression cannot be empty")
+	}
+
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	return schedule, nil
+}
+
+// starBit marks a cron field given as "*" in a parsed cron.SpecSchedule
+const starBit = 1 << 63
+
+// LoadTimezone loads an IANA timezone name, defaulting to UTC when empty
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// ValidateSchedule checks that expr is a valid cron expression that fires and
+// that timezone names a known location
+func ValidateSchedule(expr, timezone string) error {
+	if _, err := LoadTimezone(timezone); err != nil {
+		return err
+	}
+	_, err := NextRunTime(expr, time.Now())
+	return err
+}
+
+// NextRunTimeIn returns the first activation of expr strictly after from,
+// evaluating the expression in the given timezone.
+//
+// Schedules with fixed hours follow the wall clock across DST changes: a time
+// skipped when clocks go forward runs shifted by the length of the gap (02:30
+// becomes 03:30), and a time repeated when clocks go back runs only once.
+// Schedules with a wildcard hour and "@every" intervals follow elapsed time.
+func NextRunTimeIn(expr, timezone string, from time.Time) (time.Time, error) {
+	loc, err := LoadTimezone(timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	spec, ok := schedule.(*cron.SpecSchedule)
+	if !ok || spec.Hour&starBit != 0 || spec.Location != time.Local {
+		next := schedule.Next(from.In(loc))
+		if next.IsZero() {
+			return time.Time{}, fmt.Errorf("cron expression %q never fires", expr)
+		}
+		return next.In(from.Location()), nil
+	}
+
+	// Evaluate against the wall clock, then map the result back into loc
+	wall := wallClock(from.In(loc))
+	for {
+		wall = spec.Next(wall)
+		if wall.IsZero() {
+			return time.Time{}, fmt.Errorf("cron expression %q never fires", expr)
+		}
+
+		next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+		if gap := wall.Sub(wallClock(next)); gap > 0 {
+			// The wall time falls in a DST gap; run once the clocks have moved on
+			next = next.Add(gap)
+		}
+		if next.After(from) {
+			return next.In(from.Location()), nil
+		}
+	}
+}
+
+// wallClock returns t's local date and time as a UTC time, dropping the offset
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// NextRunTime returns the first activation of expr strictly after from
+func NextRunTime(expr string, from time.Time) (time.Time, error) {
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := schedule.Next(from)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", expr)
+	}
+
+	return next, nil
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func utc(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNextRunTimeInAcrossDST(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// Clocks in New York go forward on 8 March 2026 and back on 1 November
+		{"daily keeps local time after spring forward", "0 9 * * *", utc(3, 7, 14, 0), utc(3, 8, 13, 0)},
+		{"skipped time is shifted past the gap", "30 2 * * *", utc(3, 7, 8, 0), utc(3, 8, 7, 30)},
+		{"day after the gap is unaffected", "30 2 * * *", utc(3, 8, 7, 30), utc(3, 9, 6, 30)},
+		{"repeated time fires on first occurrence", "30 1 * * *", utc(10, 31, 12, 0), utc(11, 1, 5, 30)},
+		{"repeated time fires only once", "30 1 * * *", utc(11, 1, 5, 30), utc(11, 2, 6, 30)},
+		{"daily keeps local time after fall back", "0 9 * * *", utc(10, 31, 13, 0), utc(11, 1, 14, 0)},
+		{"hourly follows elapsed time", "0 * * * *", utc(11, 1, 5, 30), utc(11, 1, 6, 0)},
+		{"interval ignores timezone", "@every 5m", utc(3, 8, 6, 58), utc(3, 8, 7, 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := NextRunTimeIn(tt.expr, "America/New_York", tt.from)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, next)
+		})
+	}
+}
+
+func TestNextRunTimeInDefaultsToUTC(t *testing.T) {
+	next, err := NextRunTimeIn("0 9 * * *", "", utc(3, 7, 14, 0))
+	require.NoError(t, err)
+	assert.Equal(t, utc(3, 8, 9, 0), next)
+}
+
+func TestValidateSchedule(t *testing.T) {
+	assert.NoError(t, ValidateSchedule("*/15 * * * *", "Europe/Berlin"))
+	assert.NoError(t, ValidateSchedule("@every 5m", ""))
+	assert.Error(t, ValidateSchedule("61 * * * *", "UTC"))
+	assert.Error(t, ValidateSchedule("", "UTC"))
+	assert.Error(t, ValidateSchedule("0 9 * * *", "Mars/Olympus_Mons"))
+}
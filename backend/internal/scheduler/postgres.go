@@ -0,0 +1,220 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"citadel-agent/backend/internal/database/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore implements Store on top of the scheduled_workflows table
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore creates a new Postgres-backed schedule store
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+// DueSchedules implements Store
+func (s *PostgresStore) DueSchedules(ctx context.Context, now time.Time) ([]*models.ScheduledWorkflow, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, workflow_id, node_id, cron_expression, timezone, enabled, last_run_at, next_run_at, created_at, updated_at
+		FROM scheduled_workflows
+		WHERE enabled AND (next_run_at IS NULL OR next_run_at <= $1)
+		ORDER BY next_run_at NULLS FIRST`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*models.ScheduledWorkflow
+	for rows.Next() {
+		var sw models.ScheduledWorkflow
+		if err := rows.Scan(
+			&sw.ID,
+			&sw.WorkflowID,
+			&sw.NodeID,
+			&sw.CronExpression,
+			&sw.Timezone,
+			&sw.Enabled,
+			&sw.LastRunAt,
+			&sw.NextRunAt,
+			&sw.CreatedAt,
+			&sw.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, &sw)
+	}
+
+	return schedules, rows.Err()
+}
+
+// ClaimRun implements Store. The update only succeeds while next_run_at still
+// holds the value this instance read, so concurrent schedulers fire each
+// activation once.
+func (s *PostgresStore) ClaimRun(ctx context.Context, id int64, expectedNext *time.Time, lastRun *time.Time, nextRun time.Time) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE scheduled_workflows
+		SET last_run_at = $2, next_run_at = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND next_run_at IS NOT DISTINCT FROM $4`,
+		id, lastRun, nextRun, expectedNext,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// HasActiveExecution implements Store
+func (s *PostgresStore) HasActiveExecution(ctx context.Context, workflowID int64) (bool, error) {
+	var active bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM executions
+			WHERE workflow_id = $1 AND status IN ('queued', 'running')
+		)`,
+		workflowID,
+	).Scan(&active)
+
+	return active, err
+}
+
+// ScheduleTriggers implements Store by reading schedule_trigger nodes from
+// the nodes table
+func (s *PostgresStore) ScheduleTriggers(ctx context.Context) ([]*models.ScheduledWorkflow, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT n.id, n.workflow_id, n.config
+		FROM nodes n
+		JOIN workflows w ON w.id = n.workflow_id
+		WHERE n.type = $1 AND w.status = 'active'`,
+		ScheduleTriggerNodeType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var triggers []*models.ScheduledWorkflow
+	for rows.Next() {
+		var (
+			nodeID    int64
+			configRaw []byte
+			config    struct {
+				Cron     string `json:"cron"`
+				Timezone string `json:"timezone"`
+			}
+		)
+		sw := &models.ScheduledWorkflow{Enabled: true}
+		if err := rows.Scan(&nodeID, &sw.WorkflowID, &configRaw); err != nil {
+			return nil, err
+		}
+		if len(configRaw) > 0 {
+			if err := json.Unmarshal(configRaw, &config); err != nil {
+				return nil, fmt.Errorf("invalid config for node %d: %w", nodeID, err)
+			}
+		}
+
+		sw.NodeID = &nodeID
+		sw.CronExpression = config.Cron
+		sw.Timezone = config.Timezone
+		if sw.Timezone == "" {
+			sw.Timezone = "UTC"
+		}
+		triggers = append(triggers, sw)
+	}
+
+	return triggers, rows.Err()
+}
+
+// SyncSchedules implements Store. A schedule whose expression or timezone
+// changed has its next run reset so it is recomputed on the next tick.
+func (s *PostgresStore) SyncSchedules(ctx context.Context, schedules []*models.ScheduledWorkflow) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	nodeIDs := make([]int64, 0, len(schedules))
+	for _, sw := range schedules {
+		if sw.NodeID == nil {
+			continue
+		}
+		nodeIDs = append(nodeIDs, *sw.NodeID)
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO scheduled_workflows (workflow_id, node_id, cron_expression, timezone, enabled)
+			VALUES ($1, $2, $3, $4, TRUE)
+			ON CONFLICT (node_id) DO UPDATE SET
+				cron_expression = EXCLUDED.cron_expression,
+				timezone = EXCLUDED.timezone,
+				enabled = TRUE,
+				next_run_at = CASE
+					WHEN scheduled_workflows.enabled
+						AND scheduled_workflows.cron_expression = EXCLUDED.cron_expression
+						AND scheduled_workflows.timezone = EXCLUDED.timezone
+					THEN scheduled_workflows.next_run_at
+				END,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE NOT scheduled_workflows.enabled
+				OR scheduled_workflows.cron_expression <> EXCLUDED.cron_expression
+				OR scheduled_workflows.timezone <> EXCLUDED.timezone`,
+			sw.WorkflowID, *sw.NodeID, sw.CronExpression, sw.Timezone,
+		); err != nil {
+			return fmt.Errorf("failed to upsert schedule for node %d: %w", *sw.NodeID, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE scheduled_workflows
+		SET enabled = FALSE, updated_at = CURRENT_TIMESTAMP
+		WHERE node_id IS NOT NULL AND enabled AND NOT (node_id = ANY($1))`,
+		nodeIDs,
+	); err != nil {
+		return fmt.Errorf("failed to disable stale schedules: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PostgresRunner enqueues executions by inserting queued rows into the
+// executions table, where workers pick them up
+type PostgresRunner struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRunner creates a new Postgres-backed runner
+func NewPostgresRunner(pool *pgxpool.Pool) *PostgresRunner {
+	return &PostgresRunner{pool: pool}
+}
+
+// Enqueue implements Runner
+func (r *PostgresRunner) Enqueue(ctx context.Context, workflowID int64, params map[string]interface{}) (string, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode trigger params: %w", err)
+	}
+
+	var id int64
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO executions (workflow_id, status, triggered_by, trigger_params)
+		VALUES ($1, 'queued', 'schedule', $2)
+		RETURNING id`,
+		workflowID, paramsJSON,
+	).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"citadel-agent/backend/internal/database/models"
+)
+
+// OverlapPolicy controls what happens when a schedule fires while a previous
+// run of the same workflow is still queued or running
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the run and waits for the next activation
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue enqueues the run regardless of in-flight executions
+	OverlapQueue OverlapPolicy = "queue"
+)
+
+// ParseOverlapPolicy converts a configuration string into an OverlapPolicy
+func ParseOverlapPolicy(value string) (OverlapPolicy, error) {
+	switch OverlapPolicy(value) {
+	case "", OverlapSkip:
+		return OverlapSkip, nil
+	case OverlapQueue:
+		return OverlapQueue, nil
+	default:
+		return "", fmt.Errorf("unknown overlap policy %q (expected %q or %q)", value, OverlapSkip, OverlapQueue)
+	}
+}
+
+// Store provides access to persisted schedules
+type Store interface {
+	// DueSchedules returns enabled schedules whose next run is at or before now,
+	// as well as schedules that have not been initialized yet
+	DueSchedules(ctx context.Context, now time.Time) ([]*models.ScheduledWorkflow, error)
+
+	// ClaimRun advances a schedule from expectedNext to nextRun. It returns
+	// false when another scheduler instance already claimed the activation.
+	ClaimRun(ctx context.Context, id int64, expectedNext *time.Time, lastRun *time.Time, nextRun time.Time) (bool, error)
+
+	// HasActiveExecution reports whether the workflow has a queued or running execution
+	HasActiveExecution(ctx context.Context, workflowID int64) (bool, error)
+
+	// ScheduleTriggers returns the schedule_trigger nodes of active workflows,
+	// with NodeID, CronExpression and Timezone taken from each node
+	ScheduleTriggers(ctx context.Context) ([]*models.ScheduledWorkflow, error)
+
+	// SyncSchedules creates or updates the schedules of the given trigger
+	// nodes and disables the schedules of all other trigger nodes
+	SyncSchedules(ctx context.Context, schedules []*models.ScheduledWorkflow) error
+}
+
+// Runner enqueues workflow executions
+type Runner interface {
+	Enqueue(ctx context.Context, workflowID int64, params map[string]interface{}) (string, error)
+}
+
+// Config holds scheduler settings
+type Config struct {
+	PollInterval time.Duration
+	Overlap      OverlapPolicy
+}
+
+// Scheduler polls the store for due schedules and hands them to the runner
+type Scheduler struct {
+	store  Store
+	runner Runner
+	config Config
+}
+
+// New creates a new scheduler
+func New(store Store, runner Runner, config Config) *Scheduler {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 30 * time.Second
+	}
+	if config.Overlap == "" {
+		config.Overlap = OverlapSkip
+	}
+
+	return &Scheduler{
+		store:  store,
+		runner: runner,
+		config: config,
+	}
+}
+
+// Run processes due schedules every poll interval until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Discover(ctx); err != nil {
+			log.Printf("Scheduler discovery failed: %v", err)
+		}
+		if err := s.Tick(ctx, time.Now()); err != nil {
+			log.Printf("Scheduler tick failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Discover syncs schedules with the schedule_trigger nodes of active
+// workflows. Triggers with an invalid cron expression or timezone are logged
+// and left disabled.
+func (s *Scheduler) Discover(ctx context.Context) error {
+	triggers, err := s.store.ScheduleTriggers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load schedule triggers: %w", err)
+	}
+
+	valid := make([]*models.ScheduledWorkflow, 0, len(triggers))
+	for _, t := range triggers {
+		if err := ValidateSchedule(t.CronExpression, t.Timezone); err != nil {
+			log.Printf("Ignoring schedule trigger of workflow %d: %v", t.WorkflowID, err)
+			continue
+		}
+		valid = append(valid, t)
+	}
+
+	if err := s.store.SyncSchedules(ctx, valid); err != nil {
+		return fmt.Errorf("failed to sync schedules: %w", err)
+	}
+	return nil
+}
+
+// Tick processes all schedules that are due at now
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) error {
+	schedules, err := s.store.DueSchedules(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to load due schedules: %w", err)
+	}
+
+	for _, schedule := range schedules {
+		if err := s.process(ctx, schedule, now); err != nil {
+			log.Printf("Schedule %d (workflow %d): %v", schedule.ID, schedule.WorkflowID, err)
+		}
+	}
+
+	return nil
+}
+
+// process fires a single schedule if it is due and advances its next run time
+func (s *Scheduler) process(ctx context.Context, schedule *models.ScheduledWorkflow, now time.Time) error {
+	nextRun, err := NextRunTimeIn(schedule.CronExpression, schedule.Timezone, now)
+	if err != nil {
+		return err
+	}
+
+	// Newly created schedules only get their first activation computed
+	if schedule.NextRunAt == nil {
+		_, err := s.store.ClaimRun(ctx, schedule.ID, nil, schedule.LastRunAt, nextRun)
+		return err
+	}
+
+	if !schedule.IsDue(now) {
+		return nil
+	}
+
+	claimed, err := s.store.ClaimRun(ctx, schedule.ID, schedule.NextRunAt, &now, nextRun)
+	if err != nil {
+		return fmt.Errorf("failed to claim run: %w", err)
+	}
+	if !claimed {
+		return nil
+	}
+
+	if s.config.Overlap == OverlapSkip {
+		active, err := s.store.HasActiveExecution(ctx, schedule.WorkflowID)
+		if err != nil {
+			return fmt.Errorf("failed to check in-flight executions: %w", err)
+		}
+		if active {
+			log.Printf("Skipping scheduled run of workflow %d: previous run still in progress", schedule.WorkflowID)
+			return nil
+		}
+	}
+
+	params := map[string]interface{}{
+		"schedule_id":    schedule.ID,
+		"scheduled_time": schedule.NextRunAt.Format(time.RFC3339),
+		"cron":           schedule.CronExpression,
+		"timezone":       schedule.Timezone,
+	}
+	if schedule.NodeID != nil {
+		params["node_id"] = *schedule.NodeID
+	}
+
+	executionID, err := s.runner.Enqueue(ctx, schedule.WorkflowID, params)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue execution: %w", err)
+	}
+
+	log.Printf("Enqueued scheduled execution %s for workflow %d (next run %s)",
+		executionID, schedule.WorkflowID, nextRun.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/database/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store that records synced schedules
+type memoryStore struct {
+	triggers []*models.ScheduledWorkflow
+	synced   []*models.ScheduledWorkflow
+}
+
+func (m *memoryStore) DueSchedules(ctx context.Context, now time.Time) ([]*models.ScheduledWorkflow, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) ClaimRun(ctx context.Context, id int64, expectedNext *time.Time, lastRun *time.Time, nextRun time.Time) (bool, error) {
+	return true, nil
+}
+
+func (m *memoryStore) HasActiveExecution(ctx context.Context, workflowID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *memoryStore) ScheduleTriggers(ctx context.Context) ([]*models.ScheduledWorkflow, error) {
+	return m.triggers, nil
+}
+
+func (m *memoryStore) SyncSchedules(ctx context.Context, schedules []*models.ScheduledWorkflow) error {
+	m.synced = schedules
+	return nil
+}
+
+func TestDiscoverSkipsInvalidTriggers(t *testing.T) {
+	nodeIDs := []int64{1, 2, 3}
+	store := &memoryStore{triggers: []*models.ScheduledWorkflow{
+		{WorkflowID: 10, NodeID: &nodeIDs[0], CronExpression: "0 9 * * *", Timezone: "Europe/London"},
+		{WorkflowID: 11, NodeID: &nodeIDs[1], CronExpression: "not a cron", Timezone: "UTC"},
+		{WorkflowID: 12, NodeID: &nodeIDs[2], CronExpression: "@every 5m", Timezone: "Nowhere/Special"},
+	}}
+
+	require.NoError(t, New(store, nil, Config{}).Discover(context.Background()))
+
+	require.Len(t, store.synced, 1)
+	assert.Equal(t, int64(10), store.synced[0].WorkflowID)
+}
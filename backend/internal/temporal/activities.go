@@ -0,0 +1,67 @@
+package temporal
+
+import (
+	"context"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+)
+
+// Error types of the application errors activities fail with
+const (
+	planErrorType = "InvalidWorkflow"
+	nodeErrorType = "NodeFailed"
+)
+
+// NodeTask is the input of the RunNode activity
+type NodeTask struct {
+	Workflow *engine.Workflow       `json:"workflow"`
+	NodeID   string                 `json:"node_id"`
+	Input    map[string]interface{} `json:"input"`
+	// Response answers the prompt of nodes waiting for a person
+	Response *types.PromptResponse `json:"response,omitempty"`
+	Retry    engine.RetryPolicy    `json:"retry"`
+}
+
+// NodeOutcome is the result of the RunNode activity
+type NodeOutcome struct {
+	Output map[string]interface{} `json:"output"`
+	// Attempt is the attempt that succeeded, 1 for the first
+	Attempt int32 `json:"attempt"`
+}
+
+// Activities run the nodes of workflows on the executor of this server,
+// with its node types and credentials
+type Activities struct {
+	executor *engine.WorkflowExecutor
+}
+
+// NewActivities creates the activities running nodes on executor
+func NewActivities(executor *engine.WorkflowExecutor) *Activities {
+	return &Activities{executor: executor}
+}
+
+// PlanWorkflow checks that the nodes of a workflow can be created and
+// returns its plan. Invalid workflows are not retried.
+func (a *Activities) PlanWorkflow(ctx context.Context, workflow *engine.Workflow) (*engine.WorkflowPlan, error) {
+	plan, err := a.executor.PlanWorkflow(ctx, workflow)
+	if err != nil {
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), planErrorType, nil)
+	}
+	return plan, nil
+}
+
+// RunNode runs a node once. Temporal retries failures the retry policy of
+// the task retries; the others are non-retryable.
+func (a *Activities) RunNode(ctx context.Context, task NodeTask) (*NodeOutcome, error) {
+	output, err := a.executor.RunNode(ctx, task.Workflow, task.NodeID, task.Input, task.Response)
+	if err != nil {
+		if !task.Retry.ShouldRetry(err) {
+			return nil, temporal.NewNonRetryableApplicationError(err.Error(), nodeErrorType, nil)
+		}
+		return nil, temporal.NewApplicationError(err.Error(), nodeErrorType)
+	}
+	return &NodeOutcome{Output: output, Attempt: activity.GetInfo(ctx).Attempt}, nil
+}
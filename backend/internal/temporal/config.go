@@ -0,0 +1,54 @@
+// Package temporal runs workflows on Temporal, each node as an activity
+// with Temporal's retries and timeouts, and falls back to the in-process
+// engine when Temporal is not reachable
+package temporal
+
+import (
+	"os"
+	"time"
+)
+
+// Config holds the Temporal connection. It mirrors the temporal section of
+// the application config.
+type Config struct {
+	// Address of the Temporal frontend, such as localhost:7233; empty runs
+	// every execution in process
+	Address   string
+	Namespace string
+	// TaskQueue is the queue the workflows and activities of this server
+	// are scheduled on
+	TaskQueue string
+	// WorkflowTimeout bounds whole executions, including the time they wait
+	// for approvals; zero means no limit
+	WorkflowTimeout time.Duration
+}
+
+// DefaultConfig returns the settings of the default application config,
+// without an address
+func DefaultConfig() Config {
+	return Config{
+		Namespace:       "default",
+		TaskQueue:       "citadel-agent-workflows",
+		WorkflowTimeout: 60 * time.Minute,
+	}
+}
+
+// FromEnv overrides defaults with TEMPORAL_ADDRESS, TEMPORAL_NAMESPACE,
+// TEMPORAL_TASK_QUEUE and TEMPORAL_WORKFLOW_TIMEOUT. Durations use Go
+// syntax, such as "60m".
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if v := os.Getenv("TEMPORAL_ADDRESS"); v != "" {
+		config.Address = v
+	}
+	if v := os.Getenv("TEMPORAL_NAMESPACE"); v != "" {
+		config.Namespace = v
+	}
+	if v := os.Getenv("TEMPORAL_TASK_QUEUE"); v != "" {
+		config.TaskQueue = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TEMPORAL_WORKFLOW_TIMEOUT")); err == nil && v >= 0 {
+		config.WorkflowTimeout = v
+	}
+	return config
+}
@@ -0,0 +1,198 @@
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/google/uuid"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	temporallog "go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+// ExecutionIDPrefix starts the IDs of the executions running on Temporal.
+// Those of executions the in-process engine runs have none.
+const ExecutionIDPrefix = "temporal-"
+
+// ErrUnavailable is returned for executions on Temporal while it cannot be
+// reached
+var ErrUnavailable = errors.New("temporal is not reachable")
+
+// Service starts, signals, queries and cancels executions. They run on
+// Temporal when it is connected, and in process on the engine otherwise or
+// when Temporal cannot be reached as they start.
+type Service struct {
+	client   client.Client
+	worker   worker.Worker
+	executor *engine.WorkflowExecutor
+	config   Config
+}
+
+// Dial connects to the Temporal frontend at config.Address, failing when it
+// cannot be reached before ctx is done
+func Dial(ctx context.Context, config Config) (client.Client, error) {
+	return client.DialContext(ctx, client.Options{
+		HostPort:  config.Address,
+		Namespace: config.Namespace,
+		Logger:    temporallog.NewStructuredLogger(slog.Default()),
+	})
+}
+
+// NewService creates a service running executions on Temporal through c,
+// whose worker runs their nodes on executor, or in process on executor
+// when c is nil
+func NewService(c client.Client, config Config, executor *engine.WorkflowExecutor) *Service {
+	service := &Service{client: c, executor: executor, config: config}
+	if c != nil {
+		service.worker = worker.New(c, config.TaskQueue, worker.Options{})
+		service.worker.RegisterWorkflowWithOptions(RunWorkflow, workflow.RegisterOptions{Name: WorkflowName})
+		service.worker.RegisterActivity(NewActivities(executor))
+	}
+	return service
+}
+
+// StartWorker starts polling the task queue for the workflows and
+// activities this server runs
+func (s *Service) StartWorker() error {
+	if s.worker == nil {
+		return nil
+	}
+	return s.worker.Start()
+}
+
+// Close stops the worker and closes the connection to Temporal
+func (s *Service) Close() {
+	if s.worker != nil {
+		s.worker.Stop()
+	}
+	if s.client != nil {
+		s.client.Close()
+	}
+}
+
+// Connected reports whether executions are started on Temporal
+func (s *Service) Connected() bool {
+	return s.client != nil
+}
+
+// Start starts an execution of workflow and returns its ID. It runs in
+// process when Temporal is not connected or cannot be reached.
+func (s *Service) Start(ctx context.Context, workflow *engine.Workflow, inputs map[string]interface{}) (string, error) {
+	if s.client != nil {
+		retry, timeout := s.executor.Policies()
+		run, err := s.client.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+			ID:                       ExecutionIDPrefix + uuid.NewString(),
+			TaskQueue:                s.config.TaskQueue,
+			WorkflowExecutionTimeout: s.config.WorkflowTimeout,
+		}, WorkflowName, ExecutionRequest{
+			Workflow:    workflow,
+			Inputs:      inputs,
+			Retry:       retry,
+			NodeTimeout: timeout.NodeTimeout,
+		})
+		if err == nil {
+			return run.GetID(), nil
+		}
+		if !unreachable(err) {
+			return "", fmt.Errorf("failed to start execution on temporal: %w", err)
+		}
+		log.Printf("Temporal unavailable, running execution of workflow %s in process: %v", workflow.ID, err)
+	}
+	return s.executor.Start(ctx, workflow, inputs)
+}
+
+// Signal answers the prompt of nodeID, a node waiting for a person. In
+// process the node must already be waiting; on Temporal the answer is kept
+// until the node is reached.
+func (s *Service) Signal(ctx context.Context, executionID, nodeID string, response types.PromptResponse) error {
+	if onTemporal(executionID) {
+		if s.client == nil {
+			return ErrUnavailable
+		}
+		err := s.client.SignalWorkflow(ctx, executionID, "", RespondSignal, PromptSignal{NodeID: nodeID, Response: response})
+		return s.clientError(ctx, executionID, err)
+	}
+
+	for _, prompt := range s.executor.Interactions().Pending(executionID) {
+		if prompt.NodeID == nodeID {
+			return s.executor.Interactions().Respond(prompt.ID, response)
+		}
+	}
+	if _, err := s.executor.GetExecution(ctx, executionID); err != nil {
+		return err
+	}
+	return engine.ErrPromptNotFound
+}
+
+// Query returns the progress of an execution, including the results of
+// the nodes that have run so far
+func (s *Service) Query(ctx context.Context, executionID string) (*types.Execution, error) {
+	if !onTemporal(executionID) {
+		return s.executor.GetExecution(ctx, executionID)
+	}
+	if s.client == nil {
+		return nil, ErrUnavailable
+	}
+
+	value, err := s.client.QueryWorkflow(ctx, executionID, "", StatusQuery)
+	if err != nil {
+		return nil, s.clientError(ctx, executionID, err)
+	}
+	var execution types.Execution
+	if err := value.Get(&execution); err != nil {
+		return nil, fmt.Errorf("failed to read execution %s: %w", executionID, err)
+	}
+	return &execution, nil
+}
+
+// Cancel stops a running execution. The node in flight is cancelled and no
+// further nodes run.
+func (s *Service) Cancel(ctx context.Context, executionID string) error {
+	if !onTemporal(executionID) {
+		return s.executor.CancelExecution(ctx, executionID)
+	}
+	if s.client == nil {
+		return ErrUnavailable
+	}
+	return s.clientError(ctx, executionID, s.client.CancelWorkflow(ctx, executionID, ""))
+}
+
+// onTemporal reports whether executionID belongs to an execution started
+// on Temporal
+func onTemporal(executionID string) bool {
+	return strings.HasPrefix(executionID, ExecutionIDPrefix)
+}
+
+// clientError maps an error of Temporal about executionID to the errors of
+// the engine: ErrExecutionNotFound for unknown executions and
+// ErrExecutionNotRunning for those that have finished
+func (s *Service) clientError(ctx context.Context, executionID string, err error) error {
+	var notFound *serviceerror.NotFound
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &notFound):
+		if _, describeErr := s.client.DescribeWorkflowExecution(ctx, executionID, ""); describeErr == nil {
+			return engine.ErrExecutionNotRunning
+		}
+		return engine.ErrExecutionNotFound
+	case unreachable(err):
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
+
+// unreachable reports whether err means Temporal could not be reached
+func unreachable(err error) bool {
+	var unavailable *serviceerror.Unavailable
+	var deadlineExceeded *serviceerror.DeadlineExceeded
+	return errors.As(err, &unavailable) || errors.As(err, &deadlineExceeded) || errors.Is(err, context.DeadlineExceeded)
+}
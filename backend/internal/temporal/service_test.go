@@ -0,0 +1,72 @@
+package temporal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+)
+
+func TestServiceFallsBackToEngine(t *testing.T) {
+	var calls int32
+	ran := &recorded{}
+	executor := newTestExecutor(t, &flakyNode{calls: &calls}, ran)
+	service := NewService(nil, DefaultConfig(), executor)
+	require.False(t, service.Connected())
+	require.NoError(t, service.StartWorker())
+	defer service.Close()
+
+	ctx := context.Background()
+	id, err := service.Start(ctx, approvalWorkflow(), map[string]interface{}{"amount": 40.0})
+	require.NoError(t, err)
+	assert.NotContains(t, id, ExecutionIDPrefix)
+
+	// The approval node waits in process until it is signalled
+	require.Eventually(t, func() bool {
+		return service.Signal(ctx, id, "review", types.PromptResponse{Approved: false}) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		execution, err := service.Query(ctx, id)
+		return err == nil && execution.Status == types.ExecutionSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"notify"}, ran.list())
+
+	assert.ErrorIs(t, service.Cancel(ctx, id), engine.ErrExecutionNotRunning)
+	assert.ErrorIs(t, service.Signal(ctx, id, "review", types.PromptResponse{}), engine.ErrPromptNotFound)
+	_, err = service.Query(ctx, "exec_missing")
+	assert.ErrorIs(t, err, engine.ErrExecutionNotFound)
+
+	// Executions started on Temporal cannot be reached without it
+	_, err = service.Query(ctx, ExecutionIDPrefix+"1")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, service.Cancel(ctx, ExecutionIDPrefix+"1"), ErrUnavailable)
+}
+
+func TestServiceFallsBackWhenTemporalIsUnreachable(t *testing.T) {
+	var calls int32
+	ran := &recorded{}
+	executor := newTestExecutor(t, &flakyNode{calls: &calls}, ran)
+	c, err := client.NewLazyClient(client.Options{HostPort: "127.0.0.1:1"})
+	require.NoError(t, err)
+	service := NewService(c, DefaultConfig(), executor)
+	require.True(t, service.Connected())
+	defer service.Close()
+
+	ctx := context.Background()
+	id, err := service.Start(ctx, flakyWorkflow(), nil)
+	require.NoError(t, err)
+	assert.NotContains(t, id, ExecutionIDPrefix, "the execution runs in process")
+	require.Eventually(t, func() bool {
+		execution, err := service.Query(ctx, id)
+		return err == nil && execution.Status == types.ExecutionSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"store"}, ran.list())
+
+	_, err = service.Query(ctx, ExecutionIDPrefix+"1")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
@@ -0,0 +1,240 @@
+package temporal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// WorkflowName is the name RunWorkflow is registered under
+const WorkflowName = "citadel.workflow"
+
+// RespondSignal answers the prompt of a node waiting for a person, such as
+// an approval node, with a PromptSignal. Responses may arrive before the
+// node is reached.
+const RespondSignal = "respond"
+
+// StatusQuery returns the progress of an execution as a *types.Execution.
+// The node waiting for RespondSignal, if any, is pending and the execution
+// paused.
+const StatusQuery = "status"
+
+// planTimeout bounds planning a workflow, which only creates its nodes
+const planTimeout = time.Minute
+
+// ExecutionRequest is the input of RunWorkflow. It carries the policies of
+// the server that started the execution, so that every worker runs it
+// alike.
+type ExecutionRequest struct {
+	Workflow    *engine.Workflow       `json:"workflow"`
+	Inputs      map[string]interface{} `json:"inputs,omitempty"`
+	Retry       engine.RetryPolicy     `json:"retry"`
+	NodeTimeout time.Duration          `json:"node_timeout"`
+}
+
+// PromptSignal is the payload of RespondSignal
+type PromptSignal struct {
+	NodeID   string               `json:"node_id"`
+	Response types.PromptResponse `json:"response"`
+}
+
+// RunWorkflow runs an execution: it plans the workflow, then runs its nodes
+// in order as RunNode activities, following the edges their outputs select,
+// as the in-process engine does. Each activity is retried and timed out by
+// Temporal according to the policies of the request. Nodes waiting for a
+// person run once RespondSignal answered them.
+func RunWorkflow(ctx workflow.Context, request ExecutionRequest) (*engine.WorkflowRun, error) {
+	if request.Workflow == nil {
+		return nil, temporal.NewNonRetryableApplicationError("workflow is required", planErrorType, nil)
+	}
+
+	execution := &types.Execution{
+		ID:            workflow.GetInfo(ctx).WorkflowExecution.ID,
+		WorkflowID:    request.Workflow.ID,
+		Status:        types.ExecutionRunning,
+		StartedAt:     workflow.Now(ctx),
+		NodeResults:   make(map[string]*types.NodeResult),
+		TriggerParams: request.Inputs,
+	}
+	if err := workflow.SetQueryHandler(ctx, StatusQuery, func() (*types.Execution, error) {
+		return execution, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]types.PromptResponse)
+	signals := workflow.GetSignalChannel(ctx, RespondSignal)
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		for {
+			var signal PromptSignal
+			if !signals.Receive(ctx, &signal) {
+				return
+			}
+			responses[signal.NodeID] = signal.Response
+		}
+	})
+
+	var activities *Activities
+	var plan engine.WorkflowPlan
+	planCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: planTimeout})
+	if err := workflow.ExecuteActivity(planCtx, activities.PlanWorkflow, request.Workflow).Get(ctx, &plan); err != nil {
+		return nil, finish(ctx, execution, err)
+	}
+	walk, err := engine.NewGraphWalk(request.Workflow, &plan, request.Inputs)
+	if err != nil {
+		return nil, finish(ctx, execution, err)
+	}
+
+	run := &engine.WorkflowRun{
+		ExecutionID: execution.ID,
+		WorkflowID:  request.Workflow.ID,
+		Results:     make(map[string]interface{}),
+		NodeResults: execution.NodeResults,
+	}
+	nodeCtx := workflow.WithActivityOptions(ctx, activityOptions(request))
+	for {
+		step, ok := walk.Next()
+		for _, nodeID := range walk.Skipped() {
+			if _, seen := execution.NodeResults[nodeID]; !seen {
+				execution.NodeResults[nodeID] = &types.NodeResult{NodeID: nodeID, Status: types.NodeSkipped}
+			}
+		}
+		if !ok {
+			break
+		}
+
+		nodeID := step.NodeID
+		var response *types.PromptResponse
+		if plan.Prompts[nodeID] && step.Err == nil {
+			execution.Status = types.ExecutionPaused
+			execution.NodeResults[nodeID] = &types.NodeResult{NodeID: nodeID, Status: types.NodePending}
+			if err := workflow.Await(ctx, func() bool {
+				_, answered := responses[nodeID]
+				return answered
+			}); err != nil {
+				execution.NodeResults[nodeID].Status = types.NodeCancelled
+				return nil, finish(ctx, execution, err)
+			}
+			answer := responses[nodeID]
+			response = &answer
+			execution.Status = types.ExecutionRunning
+		}
+
+		result := &types.NodeResult{
+			NodeID:     nodeID,
+			Status:     types.NodeRunning,
+			StartedAt:  workflow.Now(ctx),
+			InputsUsed: step.Input,
+		}
+		execution.NodeResults[nodeID] = result
+
+		err := step.Err
+		var outcome NodeOutcome
+		if err == nil {
+			task := NodeTask{
+				Workflow: request.Workflow,
+				NodeID:   nodeID,
+				Input:    step.Input,
+				Response: response,
+				Retry:    request.Retry,
+			}
+			err = workflow.ExecuteActivity(nodeCtx, activities.RunNode, task).Get(ctx, &outcome)
+		}
+		completedAt := workflow.Now(ctx)
+		result.CompletedAt = &completedAt
+		result.ExecutionTime = completedAt.Sub(result.StartedAt)
+
+		if err != nil {
+			if temporal.IsCanceledError(err) || ctx.Err() != nil {
+				result.Status = types.NodeCancelled
+				return nil, finish(ctx, execution, err)
+			}
+			message := errorMessage(err)
+			result.Status = types.NodeFailed
+			var timeoutErr *temporal.TimeoutError
+			if errors.As(err, &timeoutErr) {
+				result.Status = types.NodeTimeout
+			}
+			result.Error = &message
+
+			// Branches merged by nodes that tolerate failed branches fail
+			// on their own
+			if walk.Fail(nodeID, errors.New(message)) {
+				continue
+			}
+			return nil, finish(ctx, execution, fmt.Errorf("error executing node %s: %s", nodeID, message))
+		}
+
+		result.Status = types.NodeCompleted
+		result.Output = outcome.Output
+		result.RetryCount = int(outcome.Attempt) - 1
+		run.Results[nodeID] = outcome.Output
+		walk.Complete(nodeID, outcome.Output)
+	}
+
+	finish(ctx, execution, nil)
+	return run, nil
+}
+
+// activityOptions maps the policies of the request onto the RunNode
+// activities: the node timeout bounds each attempt and the retry policy
+// becomes Temporal's. Errors the retry policy does not retry are made
+// non-retryable by the activity.
+func activityOptions(request ExecutionRequest) workflow.ActivityOptions {
+	timeout := request.NodeTimeout
+	if timeout <= 0 {
+		timeout = engine.DefaultTimeoutPolicy().NodeTimeout
+	}
+
+	retry := request.Retry
+	policy := &temporal.RetryPolicy{
+		InitialInterval:    time.Second,
+		BackoffCoefficient: max(retry.BackoffFactor, 1),
+		MaximumAttempts:    int32(retry.Attempts()),
+	}
+	if retry.InitialWait > 0 {
+		policy.InitialInterval = retry.InitialWait
+	}
+	if retry.MaxWaitTime >= policy.InitialInterval {
+		policy.MaximumInterval = retry.MaxWaitTime
+	}
+	return workflow.ActivityOptions{
+		StartToCloseTimeout: timeout,
+		RetryPolicy:         policy,
+	}
+}
+
+// finish records how execution ended and returns err
+func finish(ctx workflow.Context, execution *types.Execution, err error) error {
+	now := workflow.Now(ctx)
+	execution.CompletedAt = &now
+	execution.ExecutionTime = now.Sub(execution.StartedAt)
+	switch {
+	case err == nil:
+		execution.Status = types.ExecutionSucceeded
+		return nil
+	case temporal.IsCanceledError(err) || ctx.Err() != nil:
+		execution.Status = types.ExecutionCancelled
+		execution.CancelledAt = &now
+	default:
+		execution.Status = types.ExecutionFailed
+	}
+	message := errorMessage(err)
+	execution.Error = &message
+	return err
+}
+
+// errorMessage returns the message of the node error behind err, without
+// the activity error wrapping it
+func errorMessage(err error) string {
+	var applicationErr *temporal.ApplicationError
+	if errors.As(err, &applicationErr) {
+		return applicationErr.Error()
+	}
+	return err.Error()
+}
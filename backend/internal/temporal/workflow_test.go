@@ -0,0 +1,243 @@
+package temporal
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// flakyNode fails with err for the first `failures` executions, then
+// succeeds
+type flakyNode struct {
+	failures int32
+	err      error
+	calls    *int32
+}
+
+func (n *flakyNode) Initialize(config map[string]interface{}) error { return nil }
+func (n *flakyNode) Validate() error                                { return nil }
+func (n *flakyNode) Close() error                                   { return nil }
+func (n *flakyNode) GetMetadata() types.NodeMetadata                { return types.NodeMetadata{ID: "flaky"} }
+
+func (n *flakyNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	if call := atomic.AddInt32(n.calls, 1); call <= n.failures {
+		return types.NodeOutput{Error: n.err}
+	}
+	return types.NodeOutput{Data: map[string]interface{}{"ok": true}}
+}
+
+// recordNode records that it ran and passes its input through
+type recordNode struct {
+	ran *recorded
+	id  string
+}
+
+type recorded struct {
+	mu    sync.Mutex
+	nodes []string
+}
+
+func (r *recorded) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.nodes...)
+}
+
+func (n *recordNode) Initialize(config map[string]interface{}) error {
+	n.id, _ = config["name"].(string)
+	return nil
+}
+func (n *recordNode) Validate() error                 { return nil }
+func (n *recordNode) Close() error                    { return nil }
+func (n *recordNode) GetMetadata() types.NodeMetadata { return types.NodeMetadata{ID: "record"} }
+
+func (n *recordNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	n.ran.mu.Lock()
+	n.ran.nodes = append(n.ran.nodes, n.id)
+	n.ran.mu.Unlock()
+	return types.NodeOutput{Data: input.Data}
+}
+
+func newTestExecutor(t *testing.T, flaky *flakyNode, ran *recorded) *engine.WorkflowExecutor {
+	t.Helper()
+
+	registry := engine.NewNodeTypeRegistry()
+	approvalMeta := types.NodeMetadata{ID: "approval"}
+	require.NoError(t, registry.RegisterNodeType("approval", engine.AdaptNode(utility.NewApprovalNode, approvalMeta), approvalMeta))
+	require.NoError(t, registry.RegisterNodeType("flaky", func() types.NodeInstance { return flaky }, flaky.GetMetadata()))
+	require.NoError(t, registry.RegisterNodeType("record", func() types.NodeInstance {
+		return &recordNode{ran: ran}
+	}, types.NodeMetadata{ID: "record"}))
+
+	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+	executor.SetRetryPolicy(engine.RetryPolicy{
+		Enable:        true,
+		MaxAttempts:   3,
+		BackoffFactor: 2,
+		InitialWait:   time.Millisecond,
+		MaxWaitTime:   5 * time.Millisecond,
+		Conditions:    []string{engine.RetryOnNetworkError},
+	})
+	return executor
+}
+
+func newTestEnvironment(executor *engine.WorkflowExecutor) *testsuite.TestWorkflowEnvironment {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflowWithOptions(RunWorkflow, workflow.RegisterOptions{Name: WorkflowName})
+	env.RegisterActivity(NewActivities(executor))
+	return env
+}
+
+func testRequest(executor *engine.WorkflowExecutor, wf *engine.Workflow, inputs map[string]interface{}) ExecutionRequest {
+	retry, timeout := executor.Policies()
+	return ExecutionRequest{Workflow: wf, Inputs: inputs, Retry: retry, NodeTimeout: timeout.NodeTimeout}
+}
+
+func flakyWorkflow() *engine.Workflow {
+	return &engine.Workflow{
+		ID: "flaky",
+		Nodes: map[string]*engine.WorkflowNode{
+			"fetch": {ID: "fetch", Type: "flaky"},
+			"store": {ID: "store", Type: "record", Config: map[string]interface{}{"name": "store"}},
+		},
+		Edges: []engine.WorkflowEdge{{ID: "e1", Source: "fetch", Target: "store"}},
+	}
+}
+
+func approvalWorkflow() *engine.Workflow {
+	return &engine.Workflow{
+		ID: "approval",
+		Nodes: map[string]*engine.WorkflowNode{
+			"review": {ID: "review", Type: "approval", Config: map[string]interface{}{"message": "Refund {{.amount}}?"}},
+			"refund": {ID: "refund", Type: "record", Config: map[string]interface{}{"name": "refund"}},
+			"notify": {ID: "notify", Type: "record", Config: map[string]interface{}{"name": "notify"}},
+		},
+		Edges: []engine.WorkflowEdge{
+			{ID: "e1", Source: "review", Target: "refund", SourceHandle: "approved"},
+			{ID: "e2", Source: "review", Target: "notify", SourceHandle: "rejected"},
+		},
+	}
+}
+
+func TestRunWorkflowRetriesNodesAsActivities(t *testing.T) {
+	var calls int32
+	ran := &recorded{}
+	executor := newTestExecutor(t, &flakyNode{failures: 2, err: nodeerrors.NewNetworkError("unreachable", nil), calls: &calls}, ran)
+	env := newTestEnvironment(executor)
+
+	env.ExecuteWorkflow(RunWorkflow, testRequest(executor, flakyWorkflow(), nil))
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var run engine.WorkflowRun
+	require.NoError(t, env.GetWorkflowResult(&run))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "Temporal retried the node activity")
+	assert.Equal(t, 2, run.NodeResults["fetch"].RetryCount)
+	assert.Equal(t, types.NodeCompleted, run.NodeResults["store"].Status)
+	assert.Equal(t, map[string]interface{}{"ok": true}, run.Results["store"])
+	assert.Equal(t, []string{"store"}, ran.list())
+}
+
+func TestRunWorkflowDoesNotRetryPermanentErrors(t *testing.T) {
+	var calls int32
+	ran := &recorded{}
+	executor := newTestExecutor(t, &flakyNode{failures: 5, err: nodeerrors.NewValidationError("bad input", nil), calls: &calls}, ran)
+	env := newTestEnvironment(executor)
+
+	env.ExecuteWorkflow(RunWorkflow, testRequest(executor, flakyWorkflow(), nil))
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad input")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Empty(t, ran.list())
+
+	value, err := env.QueryWorkflow(StatusQuery)
+	require.NoError(t, err)
+	var execution types.Execution
+	require.NoError(t, value.Get(&execution))
+	assert.Equal(t, types.ExecutionFailed, execution.Status)
+	assert.Equal(t, types.NodeFailed, execution.NodeResults["fetch"].Status)
+}
+
+func TestRunWorkflowWaitsForSignal(t *testing.T) {
+	var calls int32
+	ran := &recorded{}
+	executor := newTestExecutor(t, &flakyNode{calls: &calls}, ran)
+	env := newTestEnvironment(executor)
+
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(StatusQuery)
+		require.NoError(t, err)
+		var execution types.Execution
+		require.NoError(t, value.Get(&execution))
+		assert.Equal(t, types.ExecutionPaused, execution.Status)
+		assert.Equal(t, types.NodePending, execution.NodeResults["review"].Status)
+		assert.Empty(t, ran.list())
+
+		env.SignalWorkflow(RespondSignal, PromptSignal{NodeID: "review", Response: types.PromptResponse{Approved: true, Comment: "fine"}})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(RunWorkflow, testRequest(executor, approvalWorkflow(), map[string]interface{}{"amount": 40.0}))
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var run engine.WorkflowRun
+	require.NoError(t, env.GetWorkflowResult(&run))
+	assert.Equal(t, []string{"refund"}, ran.list())
+	assert.Equal(t, "fine", run.Results["review"].(map[string]interface{})["comment"])
+	assert.Equal(t, types.NodeSkipped, run.NodeResults["notify"].Status)
+}
+
+func TestRunWorkflowCancel(t *testing.T) {
+	var calls int32
+	ran := &recorded{}
+	executor := newTestExecutor(t, &flakyNode{calls: &calls}, ran)
+	env := newTestEnvironment(executor)
+
+	env.RegisterDelayedCallback(env.CancelWorkflow, time.Minute)
+	env.ExecuteWorkflow(RunWorkflow, testRequest(executor, approvalWorkflow(), nil))
+	require.True(t, env.IsWorkflowCompleted())
+	assert.True(t, temporal.IsCanceledError(env.GetWorkflowError()))
+	assert.Empty(t, ran.list())
+
+	value, err := env.QueryWorkflow(StatusQuery)
+	require.NoError(t, err)
+	var execution types.Execution
+	require.NoError(t, value.Get(&execution))
+	assert.Equal(t, types.ExecutionCancelled, execution.Status)
+	assert.Equal(t, types.NodeCancelled, execution.NodeResults["review"].Status)
+}
+
+func TestActivityOptionsFollowPolicies(t *testing.T) {
+	options := activityOptions(ExecutionRequest{
+		Retry:       engine.RetryPolicy{Enable: true, MaxAttempts: 4, BackoffFactor: 3, InitialWait: 2 * time.Second, MaxWaitTime: time.Minute},
+		NodeTimeout: 30 * time.Second,
+	})
+	assert.Equal(t, 30*time.Second, options.StartToCloseTimeout)
+	assert.Equal(t, &temporal.RetryPolicy{
+		InitialInterval:    2 * time.Second,
+		BackoffCoefficient: 3,
+		MaximumInterval:    time.Minute,
+		MaximumAttempts:    4,
+	}, options.RetryPolicy)
+
+	// Disabled retries run nodes once, and nodes always have a timeout
+	options = activityOptions(ExecutionRequest{})
+	assert.Equal(t, int32(1), options.RetryPolicy.MaximumAttempts)
+	assert.Equal(t, engine.DefaultTimeoutPolicy().NodeTimeout, options.StartToCloseTimeout)
+}
@@ -0,0 +1,323 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresQueue is a DeadLetterQueue on the executions table: jobs are
+// executions with status queued, such as the ones the scheduler enqueues. A
+// claimed execution is running with the ID of its worker and the time of
+// its last heartbeat, so other workers take it over once the heartbeats
+// stop. Dead letters are the failed executions in dead_letter_executions.
+type PostgresQueue struct {
+	pool  engine.PostgresPool
+	lease time.Duration
+}
+
+// NewPostgresQueue creates a queue whose leases expire after lease without
+// a heartbeat
+func NewPostgresQueue(pool engine.PostgresPool, lease time.Duration) *PostgresQueue {
+	return &PostgresQueue{pool: pool, lease: lease}
+}
+
+// Enqueue implements Queue. Workflow IDs must be the IDs of rows of the
+// workflows table.
+func (q *PostgresQueue) Enqueue(ctx context.Context, job *Job) error {
+	workflowID, err := strconv.ParseInt(job.WorkflowID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid workflow ID %q", job.WorkflowID)
+	}
+	inputs, err := json.Marshal(job.Inputs)
+	if err != nil {
+		return fmt.Errorf("failed to encode job inputs: %w", err)
+	}
+
+	var id int64
+	err = q.pool.QueryRow(ctx, `
+		INSERT INTO executions (workflow_id, status, triggered_by, trigger_params)
+		VALUES ($1, 'queued', 'queue', $2)
+		RETURNING id`,
+		workflowID, inputs,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	job.ID = strconv.FormatInt(id, 10)
+	job.Status = types.ExecutionQueued
+	return nil
+}
+
+// Dequeue implements Queue. Workers skip the rows other workers are
+// claiming, so they never wait for each other.
+func (q *PostgresQueue) Dequeue(ctx context.Context, workerID string) (*Job, error) {
+	var (
+		job      = &Job{Status: types.ExecutionRunning}
+		id       int64
+		inputs   []byte
+		failures []byte
+	)
+	err := q.pool.QueryRow(ctx, `
+		UPDATE executions
+		SET status = 'running', worker_id = $1, heartbeat_at = CURRENT_TIMESTAMP,
+			started_at = COALESCE(started_at, CURRENT_TIMESTAMP), attempts = attempts + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM executions
+			WHERE (status = 'queued' AND (available_at IS NULL OR available_at <= CURRENT_TIMESTAMP))
+				OR (status = 'running' AND worker_id IS NOT NULL AND heartbeat_at < CURRENT_TIMESTAMP - $2 * INTERVAL '1 millisecond')
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, COALESCE(workflow_id::text, ''), trigger_params, attempts, COALESCE(error, ''), failures`,
+		workerID, q.lease.Milliseconds(),
+	).Scan(&id, &job.WorkflowID, &inputs, &job.Attempts, &job.Error, &failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job.ID = strconv.FormatInt(id, 10)
+	if err := decodeJob(job, inputs, failures); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Heartbeat implements Queue
+func (q *PostgresQueue) Heartbeat(ctx context.Context, workerID string, jobIDs []string) error {
+	ids := make([]int64, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			ids = append(ids, n)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := q.pool.Exec(ctx, `
+		UPDATE executions SET heartbeat_at = CURRENT_TIMESTAMP
+		WHERE worker_id = $1 AND status = 'running' AND id = ANY($2)`,
+		workerID, ids,
+	)
+	return err
+}
+
+// Ack implements Queue
+func (q *PostgresQueue) Ack(ctx context.Context, job *Job, result map[string]interface{}) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode job result: %w", err)
+	}
+	return q.finish(ctx, job, `
+		UPDATE executions
+		SET status = 'succeeded', result = $3, error = NULL, worker_id = NULL,
+			completed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND attempts = $2 AND status = 'running'`,
+		encoded,
+	)
+}
+
+// Nack implements Queue
+func (q *PostgresQueue) Nack(ctx context.Context, job *Job, cause error, retryAt time.Time) error {
+	failures, err := json.Marshal([]Failure{failure(job, cause)})
+	if err != nil {
+		return fmt.Errorf("failed to encode job failure: %w", err)
+	}
+	if retryAt.IsZero() {
+		return q.finish(ctx, job, `
+			UPDATE executions
+			SET status = 'failed', error = $3, failures = failures || $4::jsonb, worker_id = NULL,
+				completed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND attempts = $2 AND status = 'running'`,
+			cause.Error(), failures,
+		)
+	}
+	return q.finish(ctx, job, `
+		UPDATE executions
+		SET status = 'queued', error = $3, failures = failures || $4::jsonb, available_at = $5,
+			worker_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND attempts = $2 AND status = 'running'`,
+		cause.Error(), failures, retryAt,
+	)
+}
+
+// DeadLetter implements DeadLetterQueue
+func (q *PostgresQueue) DeadLetter(ctx context.Context, job *Job, cause error) error {
+	failures, err := json.Marshal([]Failure{failure(job, cause)})
+	if err != nil {
+		return fmt.Errorf("failed to encode job failure: %w", err)
+	}
+	return q.finish(ctx, job, `
+		WITH failed AS (
+			UPDATE executions
+			SET status = 'failed', error = $3, failures = failures || $4::jsonb, worker_id = NULL,
+				completed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND attempts = $2 AND status = 'running'
+			RETURNING id
+		)
+		INSERT INTO dead_letter_executions (execution_id, reason)
+		SELECT id, $3 FROM failed
+		ON CONFLICT (execution_id) DO UPDATE
+		SET reason = EXCLUDED.reason, dead_lettered_at = CURRENT_TIMESTAMP`,
+		cause.Error(), failures,
+	)
+}
+
+// DeadLetters implements DeadLetterQueue
+func (q *PostgresQueue) DeadLetters(ctx context.Context) ([]*DeadLetter, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT e.id, COALESCE(e.workflow_id::text, ''), e.trigger_params, e.attempts, e.status,
+			e.failures, d.reason, d.dead_lettered_at
+		FROM dead_letter_executions d
+		JOIN executions e ON e.id = d.execution_id
+		ORDER BY d.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []*DeadLetter
+	for rows.Next() {
+		var (
+			letter   = &DeadLetter{Job: &Job{}}
+			id       int64
+			status   string
+			inputs   []byte
+			failures []byte
+		)
+		if err := rows.Scan(&id, &letter.Job.WorkflowID, &inputs, &letter.Job.Attempts, &status, &failures, &letter.Reason, &letter.DeadLetteredAt); err != nil {
+			return nil, err
+		}
+		letter.Job.ID = strconv.FormatInt(id, 10)
+		letter.Job.Status = types.ExecutionStatus(status)
+		letter.Job.Error = letter.Reason
+		if err := decodeJob(letter.Job, inputs, failures); err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+// DeadLetterDepth implements DeadLetterQueue
+func (q *PostgresQueue) DeadLetterDepth(ctx context.Context) (int, error) {
+	var depth int
+	err := q.pool.QueryRow(ctx, `SELECT COUNT(*) FROM dead_letter_executions`).Scan(&depth)
+	return depth, err
+}
+
+// Requeue implements DeadLetterQueue
+func (q *PostgresQueue) Requeue(ctx context.Context, id string) (*Job, error) {
+	executionID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+
+	var (
+		job      = &Job{ID: id, Status: types.ExecutionQueued}
+		inputs   []byte
+		failures []byte
+	)
+	err = q.pool.QueryRow(ctx, `
+		WITH requeued AS (
+			DELETE FROM dead_letter_executions WHERE execution_id = $1
+			RETURNING execution_id
+		)
+		UPDATE executions
+		SET status = 'queued', attempts = 0, available_at = NULL, completed_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT execution_id FROM requeued)
+		RETURNING COALESCE(workflow_id::text, ''), trigger_params, COALESCE(error, ''), failures`,
+		executionID,
+	).Scan(&job.WorkflowID, &inputs, &job.Error, &failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeJob(job, inputs, failures); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// finish runs an update of a job that only applies while its attempt holds
+// the lease
+func (q *PostgresQueue) finish(ctx context.Context, job *Job, sql string, args ...any) error {
+	id, err := strconv.ParseInt(job.ID, 10, 64)
+	if err != nil {
+		return ErrJobNotFound
+	}
+	tag, err := q.pool.Exec(ctx, sql, append([]any{id, job.Attempts}, args...)...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// decodeJob decodes the inputs and failures columns of a job
+func decodeJob(job *Job, inputs, failures []byte) error {
+	if len(inputs) > 0 {
+		if err := json.Unmarshal(inputs, &job.Inputs); err != nil {
+			return fmt.Errorf("invalid inputs of job %s: %w", job.ID, err)
+		}
+	}
+	if len(failures) > 0 {
+		if err := json.Unmarshal(failures, &job.Failures); err != nil {
+			return fmt.Errorf("invalid failures of job %s: %w", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// PostgresWorkflows is a WorkflowSource reading the definitions of the
+// workflows table
+type PostgresWorkflows struct {
+	pool engine.PostgresPool
+}
+
+// NewPostgresWorkflows creates a Postgres-backed workflow source
+func NewPostgresWorkflows(pool engine.PostgresPool) *PostgresWorkflows {
+	return &PostgresWorkflows{pool: pool}
+}
+
+// Workflow implements WorkflowSource
+func (s *PostgresWorkflows) Workflow(ctx context.Context, id string) (*engine.Workflow, error) {
+	workflowID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, engine.ErrWorkflowNotFound
+	}
+
+	var definition []byte
+	err = s.pool.QueryRow(ctx, `SELECT definition FROM workflows WHERE id = $1 AND status = 'active'`, workflowID).Scan(&definition)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, engine.ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	workflow := &engine.Workflow{}
+	if err := json.Unmarshal(definition, workflow); err != nil {
+		return nil, fmt.Errorf("invalid definition of workflow %s: %w", id, err)
+	}
+	workflow.ID = id
+	return workflow, nil
+}
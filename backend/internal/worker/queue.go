@@ -0,0 +1,307 @@
+// Package worker runs queued workflow executions. A Worker pulls jobs from a
+// Queue, runs them with bounded concurrency and acknowledges them, retrying
+// failed jobs with backoff and moving the ones that exhaust their retries to
+// a dead-letter queue. While it runs jobs it sends heartbeats, so that the
+// jobs of a worker that died are handed to another one.
+package worker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// Task queue types, as in worker.task_queue_type of the application config
+const (
+	QueueRedis    = "redis"
+	QueueDatabase = "database"
+)
+
+// ErrLeaseLost is returned when acknowledging a job the worker no longer
+// holds, because it missed its heartbeats and the job was handed to another
+// worker
+var ErrLeaseLost = errors.New("job lease was lost")
+
+// ErrJobNotFound is returned for unknown job IDs
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a queued execution of a workflow
+type Job struct {
+	ID         string                 `json:"id"`
+	WorkflowID string                 `json:"workflow_id"`
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`
+	// Attempts counts the runs of the job, including the current one
+	Attempts int                    `json:"attempts"`
+	Status   types.ExecutionStatus  `json:"status"`
+	Result   map[string]interface{} `json:"result,omitempty"`
+	// Error is the error of the last failed attempt
+	Error string `json:"error,omitempty"`
+	// Failures lists the failed attempts, oldest first
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// Failure is a failed attempt of a job
+type Failure struct {
+	Attempt  int       `json:"attempt"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetter is a job that failed on every attempt it was allowed
+type DeadLetter struct {
+	Job *Job `json:"job"`
+	// Reason is the error of the last attempt
+	Reason         string    `json:"reason"`
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+}
+
+// Queue holds jobs for workers. A dequeued job is leased to the worker until
+// it is acknowledged; jobs whose worker stops sending heartbeats for longer
+// than the lease timeout of the queue are dequeued again.
+type Queue interface {
+	// Enqueue adds a job, assigning its ID
+	Enqueue(ctx context.Context, job *Job) error
+
+	// Dequeue leases the next ready job to workerID. It returns nil when no
+	// job is ready.
+	Dequeue(ctx context.Context, workerID string) (*Job, error)
+
+	// Heartbeat renews the leases of the jobs workerID is running
+	Heartbeat(ctx context.Context, workerID string, jobIDs []string) error
+
+	// Ack records the result of a job that succeeded
+	Ack(ctx context.Context, job *Job, result map[string]interface{}) error
+
+	// Nack records the failure of a job. The job is run again at retryAt,
+	// or never when retryAt is zero.
+	Nack(ctx context.Context, job *Job, cause error, retryAt time.Time) error
+}
+
+// DeadLetterQueue is a Queue that keeps the jobs that exhausted their
+// retries aside, so that they can be inspected and run again
+type DeadLetterQueue interface {
+	Queue
+
+	// DeadLetter records the final failure of a job and moves it to the
+	// dead-letter queue
+	DeadLetter(ctx context.Context, job *Job, cause error) error
+
+	// DeadLetters lists the dead-lettered jobs, oldest first
+	DeadLetters(ctx context.Context) ([]*DeadLetter, error)
+
+	// DeadLetterDepth counts the dead-lettered jobs
+	DeadLetterDepth(ctx context.Context) (int, error)
+
+	// Requeue moves a dead-lettered job back to the queue with its attempts
+	// reset, keeping its failures. It returns ErrJobNotFound for jobs that
+	// are not dead-lettered.
+	Requeue(ctx context.Context, id string) (*Job, error)
+}
+
+// failure records the attempt of job that failed with cause
+func failure(job *Job, cause error) Failure {
+	return Failure{Attempt: job.Attempts, Error: cause.Error(), FailedAt: time.Now().UTC()}
+}
+
+// memoryJob is a job in a MemoryQueue
+type memoryJob struct {
+	job            Job
+	availableAt    time.Time
+	workerID       string
+	leaseUntil     time.Time
+	deadLetteredAt time.Time
+}
+
+// MemoryQueue is an in-memory DeadLetterQueue, for tests and for running a
+// single server without Redis or a database. Jobs are lost when the process
+// exits.
+type MemoryQueue struct {
+	mu     sync.Mutex
+	lease  time.Duration
+	nextID int64
+	jobs   map[string]*memoryJob
+	order  []string
+	dead   []string
+}
+
+// NewMemoryQueue creates an empty in-memory queue whose leases expire after
+// lease without a heartbeat
+func NewMemoryQueue(lease time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		lease: lease,
+		jobs:  make(map[string]*memoryJob),
+	}
+}
+
+// Enqueue implements Queue
+func (q *MemoryQueue) Enqueue(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	job.ID = strconv.FormatInt(q.nextID, 10)
+	job.Status = types.ExecutionQueued
+	q.jobs[job.ID] = &memoryJob{job: *job}
+	q.order = append(q.order, job.ID)
+	return nil
+}
+
+// Dequeue implements Queue
+func (q *MemoryQueue) Dequeue(ctx context.Context, workerID string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range q.order {
+		entry := q.jobs[id]
+		ready := entry.job.Status == types.ExecutionQueued && !entry.availableAt.After(now)
+		expired := entry.job.Status == types.ExecutionRunning && entry.leaseUntil.Before(now)
+		if !ready && !expired {
+			continue
+		}
+		entry.job.Status = types.ExecutionRunning
+		entry.job.Attempts++
+		entry.workerID = workerID
+		entry.leaseUntil = now.Add(q.lease)
+		job := entry.job
+		return &job, nil
+	}
+	return nil, nil
+}
+
+// Heartbeat implements Queue
+func (q *MemoryQueue) Heartbeat(ctx context.Context, workerID string, jobIDs []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, id := range jobIDs {
+		if entry, ok := q.held(id, workerID); ok {
+			entry.leaseUntil = time.Now().Add(q.lease)
+		}
+	}
+	return nil
+}
+
+// Ack implements Queue
+func (q *MemoryQueue) Ack(ctx context.Context, job *Job, result map[string]interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.held(job.ID, "")
+	if !ok || entry.job.Attempts != job.Attempts {
+		return ErrLeaseLost
+	}
+	entry.job.Status = types.ExecutionSucceeded
+	entry.job.Result = result
+	entry.job.Error = ""
+	return nil
+}
+
+// Nack implements Queue
+func (q *MemoryQueue) Nack(ctx context.Context, job *Job, cause error, retryAt time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.held(job.ID, "")
+	if !ok || entry.job.Attempts != job.Attempts {
+		return ErrLeaseLost
+	}
+	entry.job.Error = cause.Error()
+	entry.job.Failures = append(entry.job.Failures, failure(job, cause))
+	if retryAt.IsZero() {
+		entry.job.Status = types.ExecutionFailed
+	} else {
+		entry.job.Status = types.ExecutionQueued
+		entry.availableAt = retryAt
+	}
+	return nil
+}
+
+// DeadLetter implements DeadLetterQueue
+func (q *MemoryQueue) DeadLetter(ctx context.Context, job *Job, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.held(job.ID, "")
+	if !ok || entry.job.Attempts != job.Attempts {
+		return ErrLeaseLost
+	}
+	entry.job.Status = types.ExecutionFailed
+	entry.job.Error = cause.Error()
+	entry.job.Failures = append(entry.job.Failures, failure(job, cause))
+	entry.deadLetteredAt = time.Now().UTC()
+	q.dead = append(q.dead, job.ID)
+	return nil
+}
+
+// DeadLetters implements DeadLetterQueue
+func (q *MemoryQueue) DeadLetters(ctx context.Context) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters := make([]*DeadLetter, len(q.dead))
+	for i, id := range q.dead {
+		entry := q.jobs[id]
+		job := entry.job
+		letters[i] = &DeadLetter{Job: &job, Reason: job.Error, DeadLetteredAt: entry.deadLetteredAt}
+	}
+	return letters, nil
+}
+
+// DeadLetterDepth implements DeadLetterQueue
+func (q *MemoryQueue) DeadLetterDepth(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.dead), nil
+}
+
+// Requeue implements DeadLetterQueue
+func (q *MemoryQueue) Requeue(ctx context.Context, id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, dead := range q.dead {
+		if dead != id {
+			continue
+		}
+		q.dead = append(q.dead[:i:i], q.dead[i+1:]...)
+		entry := q.jobs[id]
+		entry.job.Status = types.ExecutionQueued
+		entry.job.Attempts = 0
+		entry.availableAt = time.Time{}
+		entry.deadLetteredAt = time.Time{}
+		job := entry.job
+		return &job, nil
+	}
+	return nil, ErrJobNotFound
+}
+
+// Job returns a copy of the job with the given ID
+func (q *MemoryQueue) Job(ctx context.Context, id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	job := entry.job
+	return &job, nil
+}
+
+// held returns the running job with the given ID, leased to workerID unless
+// it is empty
+func (q *MemoryQueue) held(id, workerID string) (*memoryJob, bool) {
+	entry, ok := q.jobs[id]
+	if !ok || entry.job.Status != types.ExecutionRunning {
+		return nil, false
+	}
+	if workerID != "" && entry.workerID != workerID {
+		return nil, false
+	}
+	return entry, true
+}
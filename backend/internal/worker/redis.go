@@ -0,0 +1,374 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix prefixes the keys of a RedisQueue
+const DefaultRedisPrefix = "citadel:jobs"
+
+// DefaultRetention is how long a RedisQueue keeps finished jobs unless
+// configured otherwise
+const DefaultRetention = 24 * time.Hour
+
+// redisJobData is the part of a job that does not change once enqueued
+type redisJobData struct {
+	WorkflowID string                 `json:"workflow_id"`
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`
+}
+
+// dequeueScript moves due retries and jobs with an expired lease to the
+// ready list, then leases the oldest ready job to ARGV[3]. It returns the
+// ID, data, attempts and error of the job followed by its failures.
+var dequeueScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+for _, source in ipairs({KEYS[2], KEYS[3]}) do
+	for _, id in ipairs(redis.call('ZRANGEBYSCORE', source, '-inf', now)) do
+		redis.call('ZREM', source, id)
+		redis.call('RPUSH', KEYS[1], id)
+	end
+end
+local id = redis.call('LPOP', KEYS[1])
+if not id then
+	return false
+end
+local key = ARGV[4] .. ':job:' .. id
+redis.call('ZADD', KEYS[3], ARGV[2], id)
+local attempts = redis.call('HINCRBY', key, 'attempts', 1)
+redis.call('HSET', key, 'status', 'running', 'worker', ARGV[3])
+local job = redis.call('HMGET', key, 'data', 'error')
+local result = {id, job[1] or '', tostring(attempts), job[2] or ''}
+for _, failure in ipairs(redis.call('LRANGE', key .. ':failures', 0, -1)) do
+	table.insert(result, failure)
+end
+return result
+`)
+
+// holdsLease checks that job ARGV[1] is still leased for attempt ARGV[2],
+// rather than expired and dequeued again; it starts the scripts that
+// acknowledge jobs
+const holdsLease = `
+local id = ARGV[1]
+if not redis.call('ZSCORE', KEYS[1], id) or redis.call('HGET', KEYS[2], 'attempts') ~= ARGV[2] then
+	return 0
+end
+`
+
+// ackScript records the result ARGV[3] of a job and expires it after
+// ARGV[4] ms
+var ackScript = redis.NewScript(holdsLease + `
+redis.call('ZREM', KEYS[1], id)
+redis.call('HSET', KEYS[2], 'status', 'succeeded', 'result', ARGV[3])
+redis.call('HDEL', KEYS[2], 'error')
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[2] .. ':failures', ARGV[4])
+return 1
+`)
+
+// nackScript records the error ARGV[3] and failure ARGV[4] of a job and
+// schedules it again at ARGV[5], or fails it and expires it after ARGV[6] ms
+// when ARGV[5] is 0
+var nackScript = redis.NewScript(holdsLease + `
+redis.call('ZREM', KEYS[1], id)
+redis.call('HSET', KEYS[2], 'error', ARGV[3])
+redis.call('RPUSH', KEYS[2] .. ':failures', ARGV[4])
+if ARGV[5] == '0' then
+	redis.call('HSET', KEYS[2], 'status', 'failed')
+	redis.call('PEXPIRE', KEYS[2], ARGV[6])
+	redis.call('PEXPIRE', KEYS[2] .. ':failures', ARGV[6])
+else
+	redis.call('HSET', KEYS[2], 'status', 'queued')
+	redis.call('ZADD', KEYS[3], ARGV[5], id)
+end
+return 1
+`)
+
+// deadLetterScript records the error ARGV[3] and failure ARGV[4] of a job,
+// fails it at ARGV[5] ms and appends it to the dead-letter list. Dead
+// letters do not expire.
+var deadLetterScript = redis.NewScript(holdsLease + `
+redis.call('ZREM', KEYS[1], id)
+redis.call('RPUSH', KEYS[2] .. ':failures', ARGV[4])
+redis.call('HSET', KEYS[2], 'status', 'failed', 'error', ARGV[3], 'dead_lettered_at', ARGV[5])
+redis.call('RPUSH', KEYS[3], id)
+return 1
+`)
+
+// requeueScript moves job ARGV[1] from the dead-letter list back to the
+// ready list with its attempts reset
+var requeueScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[3], 'status', 'queued', 'attempts', 0)
+redis.call('HDEL', KEYS[3], 'dead_lettered_at')
+redis.call('RPUSH', KEYS[2], ARGV[1])
+return 1
+`)
+
+// heartbeatScript extends the leases that worker ARGV[1] holds on the jobs
+// ARGV[4..] until ARGV[2]
+var heartbeatScript = redis.NewScript(`
+for i = 4, #ARGV do
+	local id = ARGV[i]
+	if redis.call('ZSCORE', KEYS[1], id) and redis.call('HGET', ARGV[3] .. ':job:' .. id, 'worker') == ARGV[1] then
+		redis.call('ZADD', KEYS[1], ARGV[2], id)
+	end
+end
+return 0
+`)
+
+// RedisQueue is a DeadLetterQueue in Redis, shared by all workers using the
+// same prefix. Ready jobs are in the list <prefix>:ready, delayed retries
+// and leases in the sorted sets <prefix>:delayed and <prefix>:running,
+// scored by time, dead letters in the list <prefix>:dead, and each job in
+// the hash <prefix>:job:<id> with its failures in the list
+// <prefix>:job:<id>:failures. Finished jobs expire after the retention of
+// the queue, except for dead letters.
+type RedisQueue struct {
+	client    redis.UniversalClient
+	prefix    string
+	lease     time.Duration
+	retention time.Duration
+}
+
+// NewRedisQueue creates a queue whose leases expire after lease without a
+// heartbeat, keeping finished jobs for retention
+func NewRedisQueue(client redis.UniversalClient, prefix string, lease, retention time.Duration) *RedisQueue {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &RedisQueue{client: client, prefix: prefix, lease: lease, retention: retention}
+}
+
+func (q *RedisQueue) key(name string) string {
+	return q.prefix + ":" + name
+}
+
+func (q *RedisQueue) jobKey(id string) string {
+	return q.prefix + ":job:" + id
+}
+
+// Enqueue implements Queue
+func (q *RedisQueue) Enqueue(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(redisJobData{WorkflowID: job.WorkflowID, Inputs: job.Inputs})
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	id, err := q.client.Incr(ctx, q.key("seq")).Result()
+	if err != nil {
+		return err
+	}
+	job.ID = strconv.FormatInt(id, 10)
+	job.Status = types.ExecutionQueued
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, q.jobKey(job.ID), "data", data, "status", string(types.ExecutionQueued), "attempts", 0)
+		pipe.RPush(ctx, q.key("ready"), job.ID)
+		return nil
+	})
+	return err
+}
+
+// Dequeue implements Queue
+func (q *RedisQueue) Dequeue(ctx context.Context, workerID string) (*Job, error) {
+	now := time.Now()
+	keys := []string{q.key("ready"), q.key("delayed"), q.key("running")}
+	result, err := dequeueScript.Run(ctx, q.client, keys, now.UnixMilli(), now.Add(q.lease).UnixMilli(), workerID, q.prefix).StringSlice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 4 {
+		return nil, fmt.Errorf("unexpected dequeue script result: %v", result)
+	}
+
+	var data redisJobData
+	if err := json.Unmarshal([]byte(result[1]), &data); err != nil {
+		return nil, fmt.Errorf("invalid job %s: %w", result[0], err)
+	}
+	failures, err := decodeFailures(result[0], result[4:])
+	if err != nil {
+		return nil, err
+	}
+	attempts, _ := strconv.Atoi(result[2])
+	return &Job{
+		ID:         result[0],
+		WorkflowID: data.WorkflowID,
+		Inputs:     data.Inputs,
+		Attempts:   attempts,
+		Status:     types.ExecutionRunning,
+		Error:      result[3],
+		Failures:   failures,
+	}, nil
+}
+
+// Heartbeat implements Queue
+func (q *RedisQueue) Heartbeat(ctx context.Context, workerID string, jobIDs []string) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	args := []interface{}{workerID, time.Now().Add(q.lease).UnixMilli(), q.prefix}
+	for _, id := range jobIDs {
+		args = append(args, id)
+	}
+	return heartbeatScript.Run(ctx, q.client, []string{q.key("running")}, args...).Err()
+}
+
+// Ack implements Queue
+func (q *RedisQueue) Ack(ctx context.Context, job *Job, result map[string]interface{}) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode job result: %w", err)
+	}
+	keys := []string{q.key("running"), q.jobKey(job.ID)}
+	return q.acknowledge(ackScript.Run(ctx, q.client, keys, q.leaseArgs(job, encoded, q.retention.Milliseconds())...))
+}
+
+// Nack implements Queue
+func (q *RedisQueue) Nack(ctx context.Context, job *Job, cause error, retryAt time.Time) error {
+	encoded, err := json.Marshal(failure(job, cause))
+	if err != nil {
+		return fmt.Errorf("failed to encode job failure: %w", err)
+	}
+	var at int64
+	if !retryAt.IsZero() {
+		at = retryAt.UnixMilli()
+	}
+	keys := []string{q.key("running"), q.jobKey(job.ID), q.key("delayed")}
+	return q.acknowledge(nackScript.Run(ctx, q.client, keys, q.leaseArgs(job, cause.Error(), encoded, at, q.retention.Milliseconds())...))
+}
+
+// DeadLetter implements DeadLetterQueue
+func (q *RedisQueue) DeadLetter(ctx context.Context, job *Job, cause error) error {
+	encoded, err := json.Marshal(failure(job, cause))
+	if err != nil {
+		return fmt.Errorf("failed to encode job failure: %w", err)
+	}
+	keys := []string{q.key("running"), q.jobKey(job.ID), q.key("dead")}
+	return q.acknowledge(deadLetterScript.Run(ctx, q.client, keys, q.leaseArgs(job, cause.Error(), encoded, time.Now().UnixMilli())...))
+}
+
+// DeadLetters implements DeadLetterQueue
+func (q *RedisQueue) DeadLetters(ctx context.Context) ([]*DeadLetter, error) {
+	ids, err := q.client.LRange(ctx, q.key("dead"), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]*DeadLetter, 0, len(ids))
+	for _, id := range ids {
+		job, err := q.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		at, err := q.client.HGet(ctx, q.jobKey(id), "dead_lettered_at").Int64()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		letters = append(letters, &DeadLetter{Job: job, Reason: job.Error, DeadLetteredAt: time.UnixMilli(at).UTC()})
+	}
+	return letters, nil
+}
+
+// DeadLetterDepth implements DeadLetterQueue
+func (q *RedisQueue) DeadLetterDepth(ctx context.Context) (int, error) {
+	n, err := q.client.LLen(ctx, q.key("dead")).Result()
+	return int(n), err
+}
+
+// Requeue implements DeadLetterQueue
+func (q *RedisQueue) Requeue(ctx context.Context, id string) (*Job, error) {
+	keys := []string{q.key("dead"), q.key("ready"), q.jobKey(id)}
+	requeued, err := requeueScript.Run(ctx, q.client, keys, id).Int()
+	if err != nil {
+		return nil, err
+	}
+	if requeued == 0 {
+		return nil, ErrJobNotFound
+	}
+	return q.Job(ctx, id)
+}
+
+// Job returns the job with the given ID, until it expires after finishing
+func (q *RedisQueue) Job(ctx context.Context, id string) (*Job, error) {
+	fields, err := q.client.HGetAll(ctx, q.jobKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	var data redisJobData
+	if err := json.Unmarshal([]byte(fields["data"]), &data); err != nil {
+		return nil, fmt.Errorf("invalid job %s: %w", id, err)
+	}
+	encoded, err := q.client.LRange(ctx, q.jobKey(id)+":failures", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	failures, err := decodeFailures(id, encoded)
+	if err != nil {
+		return nil, err
+	}
+	attempts, _ := strconv.Atoi(fields["attempts"])
+	job := &Job{
+		ID:         id,
+		WorkflowID: data.WorkflowID,
+		Inputs:     data.Inputs,
+		Attempts:   attempts,
+		Status:     types.ExecutionStatus(fields["status"]),
+		Error:      fields["error"],
+		Failures:   failures,
+	}
+	if result := fields["result"]; result != "" {
+		if err := json.Unmarshal([]byte(result), &job.Result); err != nil {
+			return nil, fmt.Errorf("invalid result of job %s: %w", id, err)
+		}
+	}
+	return job, nil
+}
+
+// leaseArgs returns the script arguments identifying the lease of job,
+// followed by args
+func (q *RedisQueue) leaseArgs(job *Job, args ...interface{}) []interface{} {
+	return append([]interface{}{job.ID, strconv.Itoa(job.Attempts)}, args...)
+}
+
+// acknowledge interprets the result of the ack and nack scripts
+func (q *RedisQueue) acknowledge(cmd *redis.Cmd) error {
+	held, err := cmd.Int()
+	if err != nil {
+		return err
+	}
+	if held == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// decodeFailures decodes the failures of job id
+func decodeFailures(id string, encoded []string) ([]Failure, error) {
+	var failures []Failure
+	for _, e := range encoded {
+		var f Failure
+		if err := json.Unmarshal([]byte(e), &f); err != nil {
+			return nil, fmt.Errorf("invalid failure of job %s: %w", id, err)
+		}
+		failures = append(failures, f)
+	}
+	return failures, nil
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+)
+
+// WorkflowSource looks up the workflows jobs refer to
+type WorkflowSource interface {
+	Workflow(ctx context.Context, id string) (*engine.Workflow, error)
+}
+
+// WorkflowSourceFunc adapts a function to a WorkflowSource
+type WorkflowSourceFunc func(ctx context.Context, id string) (*engine.Workflow, error)
+
+// Workflow implements WorkflowSource
+func (f WorkflowSourceFunc) Workflow(ctx context.Context, id string) (*engine.Workflow, error) {
+	return f(ctx, id)
+}
+
+// WorkflowRunner runs jobs with a workflow executor, with the job inputs as
+// the workflow inputs
+type WorkflowRunner struct {
+	executor  *engine.WorkflowExecutor
+	workflows WorkflowSource
+}
+
+// NewWorkflowRunner creates a runner for the workflows of source
+func NewWorkflowRunner(executor *engine.WorkflowExecutor, workflows WorkflowSource) *WorkflowRunner {
+	return &WorkflowRunner{executor: executor, workflows: workflows}
+}
+
+// Run implements Runner
+func (r *WorkflowRunner) Run(ctx context.Context, job *Job) (map[string]interface{}, error) {
+	workflow, err := r.workflows.Workflow(ctx, job.WorkflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflow %s: %w", job.WorkflowID, err)
+	}
+
+	inputs := job.Inputs
+	if inputs == nil {
+		inputs = make(map[string]interface{})
+	}
+	return r.executor.ExecuteWorkflow(ctx, workflow, inputs)
+}
@@ -0,0 +1,404 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+)
+
+// Backoff strategies, as in worker.error_handling.backoff_strategy of the
+// application config
+const (
+	BackoffExponential = "exponential"
+	BackoffLinear      = "linear"
+	BackoffFixed       = "fixed"
+)
+
+// Config holds worker settings. It mirrors the worker section of the
+// application config.
+type Config struct {
+	// ID identifies the worker in job leases; defaults to host name and PID
+	ID string
+	// PoolSize and MaxConcurrentTasks both bound the jobs run at once; the
+	// smaller one applies
+	PoolSize           int
+	MaxConcurrentTasks int
+	// PollInterval is the wait between dequeues while the queue is empty
+	PollInterval time.Duration
+	// HeartbeatInterval is how often the leases of running jobs are renewed
+	HeartbeatInterval time.Duration
+	// GracefulShutdownTime is how long running jobs get to finish when the
+	// worker stops; jobs still running after it are cancelled and requeued
+	GracefulShutdownTime time.Duration
+	// TaskTimeout bounds each attempt of a job; zero means no limit
+	TaskTimeout time.Duration
+	// MaxRetries is how many times a failed job is run again
+	MaxRetries int
+	// BackoffStrategy spaces the retries of a job: exponential, linear or
+	// fixed multiples of RetryDelay, capped at MaxRetryDelay
+	BackoffStrategy string
+	RetryDelay      time.Duration
+	MaxRetryDelay   time.Duration
+	// LogFailedTasks logs jobs that failed for good
+	LogFailedTasks bool
+	// DeadLetterEnabled moves jobs that failed for good to the dead-letter
+	// queue, when the queue has one
+	DeadLetterEnabled bool
+	// DeadLetterAlertThreshold is the dead-letter queue depth that raises an
+	// alert; zero disables the alert
+	DeadLetterAlertThreshold int
+}
+
+// DefaultConfig returns the settings of the default application config
+func DefaultConfig() Config {
+	return Config{
+		PoolSize:                 10,
+		MaxConcurrentTasks:       10,
+		PollInterval:             time.Second,
+		HeartbeatInterval:        10 * time.Second,
+		GracefulShutdownTime:     30 * time.Second,
+		TaskTimeout:              10 * time.Minute,
+		MaxRetries:               3,
+		BackoffStrategy:          BackoffExponential,
+		RetryDelay:               time.Second,
+		MaxRetryDelay:            5 * time.Minute,
+		LogFailedTasks:           true,
+		DeadLetterEnabled:        true,
+		DeadLetterAlertThreshold: 5,
+	}
+}
+
+// FromEnv overrides defaults with the environment variables of the worker
+// section of the application config: CITADEL_WORKER_POOL_SIZE,
+// CITADEL_WORKER_MAX_CONCURRENT_TASKS, CITADEL_WORKER_HEARTBEAT_INTERVAL,
+// CITADEL_WORKER_GRACEFUL_SHUTDOWN_TIME, CITADEL_WORKER_TASK_TIMEOUT,
+// CITADEL_WORKER_ERROR_HANDLING_MAX_RETRIES,
+// CITADEL_WORKER_ERROR_HANDLING_BACKOFF_STRATEGY,
+// CITADEL_WORKER_ERROR_HANDLING_LOG_FAILED_TASKS and
+// CITADEL_WORKER_ERROR_HANDLING_ALERT_THRESHOLD, plus
+// CITADEL_SCHEDULER_DEAD_LETTER_ENABLED of the scheduler section. Invalid
+// values are ignored.
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if n, err := strconv.Atoi(os.Getenv("CITADEL_WORKER_POOL_SIZE")); err == nil && n > 0 {
+		config.PoolSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CITADEL_WORKER_MAX_CONCURRENT_TASKS")); err == nil && n > 0 {
+		config.MaxConcurrentTasks = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("CITADEL_WORKER_HEARTBEAT_INTERVAL")); err == nil && d > 0 {
+		config.HeartbeatInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CITADEL_WORKER_GRACEFUL_SHUTDOWN_TIME")); err == nil && d >= 0 {
+		config.GracefulShutdownTime = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CITADEL_WORKER_TASK_TIMEOUT")); err == nil && d >= 0 {
+		config.TaskTimeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("CITADEL_WORKER_ERROR_HANDLING_MAX_RETRIES")); err == nil && n >= 0 {
+		config.MaxRetries = n
+	}
+	switch strategy := strings.ToLower(os.Getenv("CITADEL_WORKER_ERROR_HANDLING_BACKOFF_STRATEGY")); strategy {
+	case BackoffExponential, BackoffLinear, BackoffFixed:
+		config.BackoffStrategy = strategy
+	}
+	if b, err := strconv.ParseBool(os.Getenv("CITADEL_WORKER_ERROR_HANDLING_LOG_FAILED_TASKS")); err == nil {
+		config.LogFailedTasks = b
+	}
+	if n, err := strconv.Atoi(os.Getenv("CITADEL_WORKER_ERROR_HANDLING_ALERT_THRESHOLD")); err == nil && n >= 0 {
+		config.DeadLetterAlertThreshold = n
+	}
+	if b, err := strconv.ParseBool(os.Getenv("CITADEL_SCHEDULER_DEAD_LETTER_ENABLED")); err == nil {
+		config.DeadLetterEnabled = b
+	}
+	return config
+}
+
+// Lease returns how long a job stays leased without a heartbeat: three
+// heartbeat intervals, so that a worker has to miss three heartbeats before
+// its jobs are handed to another worker
+func (c Config) Lease() time.Duration {
+	return 3 * c.HeartbeatInterval
+}
+
+// concurrency returns the number of jobs run at once
+func (c Config) concurrency() int {
+	n := c.PoolSize
+	if c.MaxConcurrentTasks > 0 && (n <= 0 || c.MaxConcurrentTasks < n) {
+		n = c.MaxConcurrentTasks
+	}
+	if n <= 0 {
+		n = 1
+	}
+	return n
+}
+
+// backoff returns the wait before running a job again after its attempt-th
+// run failed
+func (c Config) backoff(attempt int) time.Duration {
+	var wait time.Duration
+	switch c.BackoffStrategy {
+	case BackoffFixed:
+		wait = c.RetryDelay
+	case BackoffLinear:
+		wait = c.RetryDelay * time.Duration(attempt)
+	default:
+		wait = c.RetryDelay
+		for i := 1; i < attempt && (c.MaxRetryDelay <= 0 || wait < c.MaxRetryDelay); i++ {
+			wait *= 2
+		}
+	}
+	if c.MaxRetryDelay > 0 && wait > c.MaxRetryDelay {
+		return c.MaxRetryDelay
+	}
+	return wait
+}
+
+// Runner runs the workflow of a job
+type Runner interface {
+	Run(ctx context.Context, job *Job) (map[string]interface{}, error)
+}
+
+// RunnerFunc adapts a function to a Runner
+type RunnerFunc func(ctx context.Context, job *Job) (map[string]interface{}, error)
+
+// Run implements Runner
+func (f RunnerFunc) Run(ctx context.Context, job *Job) (map[string]interface{}, error) {
+	return f(ctx, job)
+}
+
+// Worker pulls jobs from a queue and runs them
+type Worker struct {
+	queue   Queue
+	runner  Runner
+	config  Config
+	alerter engine.Alerter
+
+	mu      sync.Mutex
+	running map[string]*Job
+	// alerted is set while the dead-letter queue depth is over the alert
+	// threshold, so that crossing it raises a single alert
+	alerted bool
+}
+
+// New creates a new worker
+func New(queue Queue, runner Runner, config Config) *Worker {
+	if config.ID == "" {
+		host, _ := os.Hostname()
+		config.ID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = 10 * time.Second
+	}
+
+	return &Worker{
+		queue:   queue,
+		runner:  runner,
+		config:  config,
+		running: make(map[string]*Job),
+	}
+}
+
+// SetAlerter sets where the dead-letter queue depth alert is sent; by
+// default it is logged
+func (w *Worker) SetAlerter(alerter engine.Alerter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.alerter = alerter
+}
+
+// Run processes jobs until ctx is cancelled. It then stops taking jobs and
+// waits up to GracefulShutdownTime for the running ones, cancelling and
+// requeueing those that do not finish in time.
+func (w *Worker) Run(ctx context.Context) error {
+	// Jobs outlive ctx for the graceful shutdown
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	heartbeatCtx, stopHeartbeats := context.WithCancel(jobCtx)
+	heartbeatsDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatsDone)
+		w.heartbeat(heartbeatCtx)
+	}()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, w.config.concurrency())
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		job, err := w.queue.Dequeue(ctx, w.config.ID)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Worker %s failed to dequeue: %v", w.config.ID, err)
+		}
+		if job == nil {
+			<-slots
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.config.PollInterval):
+			}
+			continue
+		}
+
+		w.track(job, true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer w.track(job, false)
+			w.process(jobCtx, job)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(w.config.GracefulShutdownTime):
+		log.Printf("Worker %s: cancelling %d jobs still running after %s", w.config.ID, len(w.Running()), w.config.GracefulShutdownTime)
+		cancelJobs()
+		<-done
+	}
+
+	stopHeartbeats()
+	<-heartbeatsDone
+	return ctx.Err()
+}
+
+// process runs a job and acknowledges it. Failed jobs are retried with
+// backoff until MaxRetries, then dead-lettered when enabled; jobs cancelled
+// by a shutdown are requeued right away for another worker.
+func (w *Worker) process(ctx context.Context, job *Job) {
+	runCtx := ctx
+	if w.config.TaskTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, w.config.TaskTimeout)
+		defer cancel()
+	}
+
+	result, err := w.runner.Run(runCtx, job)
+
+	// Acknowledge even when the job was cancelled
+	ackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case err == nil:
+		err = w.queue.Ack(ackCtx, job, result)
+	case ctx.Err() != nil:
+		err = w.queue.Nack(ackCtx, job, fmt.Errorf("worker shut down: %w", err), time.Now())
+	case job.Attempts <= w.config.MaxRetries:
+		err = w.queue.Nack(ackCtx, job, err, time.Now().Add(w.config.backoff(job.Attempts)))
+	default:
+		if w.config.LogFailedTasks {
+			log.Printf("Job %s (workflow %s) failed after %d attempts: %v", job.ID, job.WorkflowID, job.Attempts, err)
+		}
+		if dlq, ok := w.queue.(DeadLetterQueue); ok && w.config.DeadLetterEnabled {
+			if err = dlq.DeadLetter(ackCtx, job, err); err == nil {
+				w.checkDeadLetters(ackCtx, dlq)
+			}
+		} else {
+			err = w.queue.Nack(ackCtx, job, err, time.Time{})
+		}
+	}
+	if err != nil {
+		log.Printf("Worker %s failed to acknowledge job %s: %v", w.config.ID, job.ID, err)
+	}
+}
+
+// checkDeadLetters alerts when the depth of the dead-letter queue crosses
+// DeadLetterAlertThreshold
+func (w *Worker) checkDeadLetters(ctx context.Context, dlq DeadLetterQueue) {
+	if w.config.DeadLetterAlertThreshold <= 0 {
+		return
+	}
+	depth, err := dlq.DeadLetterDepth(ctx)
+	if err != nil {
+		log.Printf("Worker %s failed to check the dead-letter queue: %v", w.config.ID, err)
+		return
+	}
+
+	w.mu.Lock()
+	over := depth >= w.config.DeadLetterAlertThreshold
+	crossed := over && !w.alerted
+	w.alerted = over
+	alerter := w.alerter
+	w.mu.Unlock()
+	if !crossed {
+		return
+	}
+
+	message := fmt.Sprintf("%d jobs are in the dead-letter queue (threshold %d)", depth, w.config.DeadLetterAlertThreshold)
+	if alerter == nil {
+		log.Printf("ALERT: %s", message)
+		return
+	}
+	metadata := map[string]interface{}{"worker_id": w.config.ID, "depth": depth, "threshold": w.config.DeadLetterAlertThreshold}
+	if err := alerter.SendAlert("Dead-letter queue depth", message, "warning", metadata); err != nil {
+		log.Printf("Worker %s failed to send the dead-letter alert: %v", w.config.ID, err)
+	}
+}
+
+// heartbeat renews the leases of the running jobs every HeartbeatInterval
+// until ctx is done
+func (w *Worker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(w.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs := w.Running()
+		ids := make([]string, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.ID
+		}
+		if err := w.queue.Heartbeat(ctx, w.config.ID, ids); err != nil && ctx.Err() == nil {
+			log.Printf("Worker %s failed to send a heartbeat: %v", w.config.ID, err)
+		}
+	}
+}
+
+// track adds a job to or removes it from the running jobs
+func (w *Worker) track(job *Job, running bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if running {
+		w.running[job.ID] = job
+	} else {
+		delete(w.running, job.ID)
+	}
+}
+
+// Running returns the jobs the worker is running
+func (w *Worker) Running() []*Job {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(w.running))
+	for _, job := range w.running {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
@@ -0,0 +1,439 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig returns settings for fast tests
+func testConfig() Config {
+	return Config{
+		ID:                   "test-worker",
+		MaxConcurrentTasks:   4,
+		PollInterval:         5 * time.Millisecond,
+		HeartbeatInterval:    10 * time.Millisecond,
+		GracefulShutdownTime: time.Second,
+		MaxRetries:           2,
+		BackoffStrategy:      BackoffFixed,
+		RetryDelay:           time.Millisecond,
+	}
+}
+
+func enqueue(t *testing.T, queue Queue, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		job := &Job{WorkflowID: "wf", Inputs: map[string]interface{}{"n": float64(i)}}
+		require.NoError(t, queue.Enqueue(context.Background(), job))
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+// waitForStatus waits until the job has status
+func waitForStatus(t *testing.T, queue *MemoryQueue, id string, status types.ExecutionStatus) *Job {
+	t.Helper()
+	var job *Job
+	require.Eventually(t, func() bool {
+		job, _ = queue.Job(context.Background(), id)
+		return job.Status == status
+	}, 5*time.Second, 5*time.Millisecond, "job %s never became %s", id, status)
+	return job
+}
+
+// startWorker runs a worker until the returned function stops it. Stopping
+// again returns the same error.
+func startWorker(queue Queue, runner Runner, config Config) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- New(queue, runner, config).Run(ctx)
+	}()
+
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() {
+			cancel()
+			err = <-done
+		})
+		return err
+	}
+}
+
+func TestWorkerRunsJobs(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 5)
+
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		return map[string]interface{}{"doubled": job.Inputs["n"].(float64) * 2}, nil
+	}), testConfig())
+	defer stop()
+
+	for i, id := range ids {
+		job := waitForStatus(t, queue, id, types.ExecutionSucceeded)
+		assert.Equal(t, map[string]interface{}{"doubled": float64(i * 2)}, job.Result)
+		assert.Equal(t, 1, job.Attempts)
+	}
+	assert.ErrorIs(t, stop(), context.Canceled)
+}
+
+func TestWorkerBoundsConcurrency(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 8)
+
+	var running, peak atomic.Int32
+	config := testConfig()
+	config.PoolSize = 5
+	config.MaxConcurrentTasks = 2
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	}), config)
+	defer stop()
+
+	for _, id := range ids {
+		waitForStatus(t, queue, id, types.ExecutionSucceeded)
+	}
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestWorkerRetriesFailedJobs(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 2)
+
+	var calls sync.Map
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		n, _ := calls.LoadOrStore(job.ID, new(atomic.Int32))
+		attempt := n.(*atomic.Int32).Add(1)
+		// The first job succeeds on its second attempt, the second never
+		if job.ID == ids[0] && attempt == 2 {
+			return map[string]interface{}{"ok": true}, nil
+		}
+		return nil, errors.New("boom")
+	}), testConfig())
+	defer stop()
+
+	job := waitForStatus(t, queue, ids[0], types.ExecutionSucceeded)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Empty(t, job.Error)
+
+	// MaxRetries 2 means three attempts in all
+	job = waitForStatus(t, queue, ids[1], types.ExecutionFailed)
+	assert.Equal(t, 3, job.Attempts)
+	assert.Equal(t, "boom", job.Error)
+}
+
+// recordingAlerter records the alerts it is sent
+type recordingAlerter struct {
+	mu     sync.Mutex
+	alerts []map[string]interface{}
+}
+
+func (a *recordingAlerter) SendAlert(title, message string, severity string, metadata map[string]interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts = append(a.alerts, metadata)
+	return nil
+}
+
+func (a *recordingAlerter) RegisterAlertHandler(handler engine.AlertHandler) error {
+	return nil
+}
+
+func (a *recordingAlerter) sent() []map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]map[string]interface{}(nil), a.alerts...)
+}
+
+func TestWorkerDeadLettersExhaustedJobs(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 3)
+
+	config := testConfig()
+	config.DeadLetterEnabled = true
+	config.DeadLetterAlertThreshold = 2
+	alerter := &recordingAlerter{}
+	w := New(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		return nil, fmt.Errorf("attempt %d failed", job.Attempts)
+	}), config)
+	w.SetAlerter(alerter)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool {
+		depth, _ := queue.DeadLetterDepth(context.Background())
+		return depth == len(ids)
+	}, 5*time.Second, 5*time.Millisecond)
+
+	letters, err := queue.DeadLetters(context.Background())
+	require.NoError(t, err)
+	for _, letter := range letters {
+		assert.Equal(t, types.ExecutionFailed, letter.Job.Status)
+		assert.Equal(t, "attempt 3 failed", letter.Reason)
+		assert.False(t, letter.DeadLetteredAt.IsZero())
+		require.Len(t, letter.Job.Failures, 3)
+		for i, failure := range letter.Job.Failures {
+			assert.Equal(t, i+1, failure.Attempt)
+			assert.Equal(t, fmt.Sprintf("attempt %d failed", i+1), failure.Error)
+		}
+	}
+
+	// Crossing the threshold alerts once, not for every job over it
+	alerts := alerter.sent()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, 2, alerts[0]["depth"])
+}
+
+func TestWorkerFailsJobsWithoutDeadLetters(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 1)
+
+	config := testConfig()
+	config.DeadLetterEnabled = false
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		return nil, errors.New("boom")
+	}), config)
+	defer stop()
+
+	job := waitForStatus(t, queue, ids[0], types.ExecutionFailed)
+	assert.Len(t, job.Failures, 3)
+	depth, err := queue.DeadLetterDepth(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+}
+
+func TestMemoryQueueRequeuesDeadLetters(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 1)
+	ctx := context.Background()
+
+	job, err := queue.Dequeue(ctx, "worker")
+	require.NoError(t, err)
+	require.NoError(t, queue.DeadLetter(ctx, job, errors.New("boom")))
+
+	requeued, err := queue.Requeue(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionQueued, requeued.Status)
+	assert.Zero(t, requeued.Attempts)
+	assert.Len(t, requeued.Failures, 1)
+
+	_, err = queue.Requeue(ctx, ids[0])
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	next, err := queue.Dequeue(ctx, "worker")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.Equal(t, 1, next.Attempts)
+}
+
+func TestWorkerFinishesJobsOnShutdown(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 1)
+
+	started := make(chan struct{})
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		close(started)
+		select {
+		case <-time.After(100 * time.Millisecond):
+			return map[string]interface{}{"finished": true}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}), testConfig())
+
+	<-started
+	enqueue(t, queue, 1)
+	require.ErrorIs(t, stop(), context.Canceled)
+
+	// The running job completed; the one queued during shutdown was left
+	job, err := queue.Job(context.Background(), ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionSucceeded, job.Status)
+	job, err = queue.Job(context.Background(), "2")
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionQueued, job.Status)
+	assert.Zero(t, job.Attempts)
+}
+
+func TestWorkerRequeuesJobsAfterShutdownTimeout(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	ids := enqueue(t, queue, 1)
+
+	config := testConfig()
+	config.GracefulShutdownTime = 20 * time.Millisecond
+	started := make(chan struct{})
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), config)
+
+	<-started
+	start := time.Now()
+	require.ErrorIs(t, stop(), context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// The cancelled job is ready for another worker right away
+	job, err := queue.Job(context.Background(), ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionQueued, job.Status)
+	assert.Contains(t, job.Error, "worker shut down")
+	next, err := queue.Dequeue(context.Background(), "other-worker")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.Equal(t, ids[0], next.ID)
+}
+
+func TestWorkerHeartbeatsKeepLeases(t *testing.T) {
+	queue := NewMemoryQueue(30 * time.Millisecond)
+	ids := enqueue(t, queue, 1)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stop := startWorker(queue, RunnerFunc(func(ctx context.Context, job *Job) (map[string]interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}), testConfig())
+	defer stop()
+
+	// The job outlives its lease several times over without being taken
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	job, err := queue.Dequeue(context.Background(), "other-worker")
+	require.NoError(t, err)
+	assert.Nil(t, job)
+
+	close(release)
+	job = waitForStatus(t, queue, ids[0], types.ExecutionSucceeded)
+	assert.Equal(t, 1, job.Attempts)
+}
+
+func TestMemoryQueueReclaimsExpiredLeases(t *testing.T) {
+	queue := NewMemoryQueue(10 * time.Millisecond)
+	enqueue(t, queue, 1)
+	ctx := context.Background()
+
+	first, err := queue.Dequeue(ctx, "dead-worker")
+	require.NoError(t, err)
+	require.NotNil(t, first)
+
+	time.Sleep(20 * time.Millisecond)
+	second, err := queue.Dequeue(ctx, "live-worker")
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 2, second.Attempts)
+
+	// The first worker can no longer settle the job
+	assert.ErrorIs(t, queue.Ack(ctx, first, nil), ErrLeaseLost)
+	assert.NoError(t, queue.Ack(ctx, second, nil))
+}
+
+func TestBackoff(t *testing.T) {
+	config := Config{RetryDelay: time.Second, MaxRetryDelay: 10 * time.Second}
+
+	config.BackoffStrategy = BackoffExponential
+	assert.Equal(t, time.Second, config.backoff(1))
+	assert.Equal(t, 4*time.Second, config.backoff(3))
+	assert.Equal(t, 10*time.Second, config.backoff(50))
+
+	config.BackoffStrategy = BackoffLinear
+	assert.Equal(t, 3*time.Second, config.backoff(3))
+	assert.Equal(t, 10*time.Second, config.backoff(50))
+
+	config.BackoffStrategy = BackoffFixed
+	assert.Equal(t, time.Second, config.backoff(3))
+}
+
+func TestRedisQueue(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	queue := NewRedisQueue(client, "", time.Minute, time.Hour)
+	ctx := context.Background()
+
+	ids := enqueue(t, queue, 2)
+	first, err := queue.Dequeue(ctx, "worker-a")
+	require.NoError(t, err)
+	require.NotNil(t, first)
+	assert.Equal(t, ids[0], first.ID)
+	assert.Equal(t, "wf", first.WorkflowID)
+	assert.Equal(t, map[string]interface{}{"n": float64(0)}, first.Inputs)
+	assert.Equal(t, 1, first.Attempts)
+
+	require.NoError(t, queue.Ack(ctx, first, map[string]interface{}{"ok": true}))
+	job, err := queue.Job(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionSucceeded, job.Status)
+	assert.Equal(t, map[string]interface{}{"ok": true}, job.Result)
+
+	// A failed job comes back once its retry is due
+	second, err := queue.Dequeue(ctx, "worker-a")
+	require.NoError(t, err)
+	require.NoError(t, queue.Nack(ctx, second, errors.New("boom"), time.Now().Add(-time.Millisecond)))
+	retried, err := queue.Dequeue(ctx, "worker-b")
+	require.NoError(t, err)
+	require.NotNil(t, retried)
+	assert.Equal(t, second.ID, retried.ID)
+	assert.Equal(t, 2, retried.Attempts)
+	assert.Equal(t, "boom", retried.Error)
+
+	// The earlier attempt can no longer settle it
+	assert.ErrorIs(t, queue.Ack(ctx, second, nil), ErrLeaseLost)
+	require.NoError(t, queue.DeadLetter(ctx, retried, errors.New("boom again")))
+	letters, err := queue.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, second.ID, letters[0].Job.ID)
+	assert.Equal(t, types.ExecutionFailed, letters[0].Job.Status)
+	assert.Equal(t, "boom again", letters[0].Reason)
+	require.Len(t, letters[0].Job.Failures, 2)
+	assert.Equal(t, Failure{Attempt: 1, Error: "boom", FailedAt: letters[0].Job.Failures[0].FailedAt}, letters[0].Job.Failures[0])
+	assert.Equal(t, 2, letters[0].Job.Failures[1].Attempt)
+
+	next, err := queue.Dequeue(ctx, "worker-a")
+	require.NoError(t, err)
+	assert.Nil(t, next)
+
+	// A requeued dead letter runs again from its first attempt
+	requeued, err := queue.Requeue(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionQueued, requeued.Status)
+	depth, err := queue.DeadLetterDepth(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+	next, err = queue.Dequeue(ctx, "worker-a")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.Equal(t, 1, next.Attempts)
+	assert.Len(t, next.Failures, 2)
+	_, err = queue.Requeue(ctx, second.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// NodeConstructor builds a node from its configuration, as used by the node
+// factory in internal/nodes
+type NodeConstructor func(config map[string]interface{}) (interfaces.NodeInstance, error)
+
+// IterationFunc runs a loop body once for a single item
+type IterationFunc = func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error)
+
+// loopNode is implemented by nodes that execute a body per iteration, such
+// as utility.ForEachNode
+type loopNode interface {
+	SetIterationFunc(fn IterationFunc)
+}
+
+// asLoopNode returns the loop node behind instance, looking through adapters
+func asLoopNode(instance types.NodeInstance) (loopNode, bool) {
+	if adapted, ok := instance.(*adaptedNode); ok {
+		loop, ok := adapted.node.(loopNode)
+		return loop, ok
+	}
+	loop, ok := instance.(loopNode)
+	return loop, ok
+}
+
+// adaptedNode lets nodes written against interfaces.NodeInstance run in the
+// WorkflowExecutor. The wrapped node is constructed in Initialize, once its
+// configuration is known.
+type adaptedNode struct {
+	constructor NodeConstructor
+	metadata    types.NodeMetadata
+	node        interfaces.NodeInstance
+}
+
+// AdaptNode returns a registry creator for a node constructor from the node
+// factory, e.g. RegisterNodeType("if_else", AdaptNode(utility.NewIfElseNode, meta), meta)
+func AdaptNode(constructor NodeConstructor, metadata types.NodeMetadata) func() types.NodeInstance {
+	return func() types.NodeInstance {
+		return &adaptedNode{constructor: constructor, metadata: metadata}
+	}
+}
+
+// Initialize constructs the wrapped node
+func (a *adaptedNode) Initialize(config map[string]interface{}) error {
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+
+	node, err := a.constructor(config)
+	if err != nil {
+		return err
+	}
+	a.node = node
+	return nil
+}
+
+// Execute runs the wrapped node
+func (a *adaptedNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	if a.node == nil {
+		return types.NodeOutput{Error: fmt.Errorf("node %s is not initialized", a.metadata.ID)}
+	}
+
+	data, err := a.node.Execute(ctx, input.Data)
+	return types.NodeOutput{Data: data, Error: err}
+}
+
+// Validate is a no-op; constructors validate their configuration
+func (a *adaptedNode) Validate() error {
+	return nil
+}
+
+// Close releases the wrapped node if it holds resources
+func (a *adaptedNode) Close() error {
+	if closer, ok := a.node.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata the node was registered with
+func (a *adaptedNode) GetMetadata() types.NodeMetadata {
+	return a.metadata
+}
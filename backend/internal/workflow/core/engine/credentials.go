@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CredentialResolver looks up the secrets node configs refer to as
+// {{credentials.<name>}}
+type CredentialResolver interface {
+	ResolveCredential(ctx context.Context, name string) (string, error)
+}
+
+// credentialReference matches {{credentials.<name>}} in config strings
+var credentialReference = regexp.MustCompile(`\{\{\s*credentials\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// redactedValue replaces secrets in logs and execution records
+const redactedValue = "[REDACTED]"
+
+// SetCredentials sets where the credentials referred to by node configs are
+// resolved; nil leaves references unresolved, which fails the nodes using
+// them
+func (we *WorkflowExecutor) SetCredentials(resolver CredentialResolver) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.credentials = resolver
+}
+
+// resolveCredentials returns a copy of config with its credential
+// references replaced by their values, which are added to redact. config
+// itself is left untouched, so the secrets never end up in the stored
+// workflow.
+func resolveCredentials(ctx context.Context, resolver CredentialResolver, config map[string]interface{}, redact *redactor) (map[string]interface{}, error) {
+	resolved, err := resolveValue(ctx, resolver, config, redact)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := resolved.(map[string]interface{})
+	return result, nil
+}
+
+func resolveValue(ctx context.Context, resolver CredentialResolver, value interface{}, redact *redactor) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return resolveString(ctx, resolver, v, redact)
+	case map[string]interface{}:
+		if v == nil {
+			return v, nil
+		}
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := resolveValue(ctx, resolver, item, redact)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = r
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := resolveValue(ctx, resolver, item, redact)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+func resolveString(ctx context.Context, resolver CredentialResolver, s string, redact *redactor) (string, error) {
+	matches := credentialReference.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		name := s[match[2]:match[3]]
+		if resolver == nil {
+			return "", fmt.Errorf("credential %q is referenced but no credential store is configured", name)
+		}
+		value, err := resolver.ResolveCredential(ctx, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve credential %q: %w", name, err)
+		}
+		redact.add(value)
+		b.WriteString(s[last:match[0]])
+		b.WriteString(value)
+		last = match[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// redactor replaces the secrets resolved for a run wherever they could leak:
+// log records, node results and errors
+type redactor struct {
+	mu       sync.RWMutex
+	secrets  []string
+	replacer *strings.Replacer
+}
+
+// add registers a secret to redact
+func (r *redactor) add(secret string) {
+	if r == nil || secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+	// Longest first, so a secret containing another is redacted whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	pairs := make([]string, 0, 2*len(r.secrets))
+	for _, s := range r.secrets {
+		pairs = append(pairs, s, redactedValue)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// active reports whether there is anything to redact
+func (r *redactor) active() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replacer != nil
+}
+
+// string redacts s
+func (r *redactor) string(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	replacer := r.replacer
+	r.mu.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// value returns a redacted copy of v. Maps and slices are copied, errors
+// and other values holding a secret become redacted strings.
+func (r *redactor) value(v interface{}) interface{} {
+	if !r.active() {
+		return v
+	}
+	switch v := v.(type) {
+	case string:
+		return r.string(v)
+	case map[string]interface{}:
+		return r.fields(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.value(item)
+		}
+		return redacted
+	case error:
+		if msg := v.Error(); r.string(msg) != msg {
+			return r.string(msg)
+		}
+		return v
+	case fmt.Stringer:
+		if s := v.String(); r.string(s) != s {
+			return r.string(s)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// fields returns a redacted copy of fields
+func (r *redactor) fields(fields map[string]interface{}) map[string]interface{} {
+	if fields == nil || !r.active() {
+		return fields
+	}
+	redacted := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		redacted[k] = r.value(v)
+	}
+	return redacted
+}
+
+// error redacts the message of err, keeping it unwrappable
+func (r *redactor) error(err error) error {
+	if err == nil || !r.active() {
+		return err
+	}
+	msg := err.Error()
+	if redacted := r.string(msg); redacted != msg {
+		return &redactedError{msg: redacted, err: err}
+	}
+	return err
+}
+
+// redactedError is an error whose message had secrets removed
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactingLogger redacts the secrets of a run from its log records
+type redactingLogger struct {
+	logger Logger
+	redact *redactor
+}
+
+// newRedactingLogger wraps logger to redact the secrets known to redact
+func newRedactingLogger(logger Logger, redact *redactor) Logger {
+	return &redactingLogger{logger: logger, redact: redact}
+}
+
+func (l *redactingLogger) Debug(msg string, fields ...map[string]interface{}) {
+	l.logger.Debug(l.redact.string(msg), l.redactFields(fields)...)
+}
+
+func (l *redactingLogger) Info(msg string, fields ...map[string]interface{}) {
+	l.logger.Info(l.redact.string(msg), l.redactFields(fields)...)
+}
+
+func (l *redactingLogger) Warn(msg string, fields ...map[string]interface{}) {
+	l.logger.Warn(l.redact.string(msg), l.redactFields(fields)...)
+}
+
+func (l *redactingLogger) Error(msg string, fields ...map[string]interface{}) {
+	l.logger.Error(l.redact.string(msg), l.redactFields(fields)...)
+}
+
+// With returns a logger that adds fields, redacted, to every record
+func (l *redactingLogger) With(fields map[string]interface{}) Logger {
+	return &redactingLogger{logger: l.logger.With(l.redact.fields(fields)), redact: l.redact}
+}
+
+func (l *redactingLogger) redactFields(fields []map[string]interface{}) []map[string]interface{} {
+	redacted := make([]map[string]interface{}, len(fields))
+	for i, f := range fields {
+		redacted[i] = l.redact.fields(f)
+	}
+	return redacted
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errNoSuchCredential = errors.New("credential not found")
+
+// staticCredentials resolves credentials from a map
+type staticCredentials map[string]string
+
+func (c staticCredentials) ResolveCredential(ctx context.Context, name string) (string, error) {
+	value, ok := c[name]
+	if !ok {
+		return "", errNoSuchCredential
+	}
+	return value, nil
+}
+
+// tokenNode uses the token of its config, logging it and returning it in its
+// output, or in its error when configured to fail. It records the tokens it
+// used and the inputs it got in used.
+type tokenNode struct {
+	token string
+	fail  bool
+	used  *[]string
+}
+
+func (n *tokenNode) Initialize(config map[string]interface{}) error {
+	n.token, _ = config["token"].(string)
+	n.fail, _ = config["fail"].(bool)
+	return nil
+}
+func (n *tokenNode) Validate() error                 { return nil }
+func (n *tokenNode) Close() error                    { return nil }
+func (n *tokenNode) GetMetadata() types.NodeMetadata { return types.NodeMetadata{ID: "token"} }
+
+func (n *tokenNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	if received, ok := input.Data["authorization"].(string); ok {
+		*n.used = append(*n.used, received)
+	}
+	*n.used = append(*n.used, n.token)
+	LoggerFromContext(ctx).Info("calling with "+n.token, map[string]interface{}{"header": n.token})
+	if n.fail {
+		return types.NodeOutput{Error: fmt.Errorf("request with %s rejected", n.token)}
+	}
+	return types.NodeOutput{Data: map[string]interface{}{"authorization": n.token}}
+}
+
+func newTokenExecutor(t *testing.T, resolver CredentialResolver, buf *bytes.Buffer, used *[]string) *WorkflowExecutor {
+	t.Helper()
+
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("token", func() types.NodeInstance { return &tokenNode{used: used} }, types.NodeMetadata{ID: "token"}))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(NewMemoryExecutionStore())
+	executor.SetLogger(NewSlogLoggerFrom(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	executor.SetCredentials(resolver)
+	return executor
+}
+
+func tokenWorkflow(config map[string]interface{}) *Workflow {
+	return &Workflow{
+		ID: "wf",
+		Nodes: map[string]*WorkflowNode{
+			"call": {ID: "call", Type: "token", Config: config},
+			"next": {ID: "next", Type: "token"},
+		},
+		Edges: []WorkflowEdge{{Source: "call", Target: "next"}},
+	}
+}
+
+func TestExecutorResolvesCredentialReferences(t *testing.T) {
+	var buf bytes.Buffer
+	var used []string
+	executor := newTokenExecutor(t, staticCredentials{"github_token": "ghp_secret"}, &buf, &used)
+	workflow := tokenWorkflow(map[string]interface{}{"token": "Bearer {{ credentials.github_token }}"})
+
+	run, err := executor.Run(context.Background(), workflow, nil)
+	require.NoError(t, err)
+
+	// The node used the secret, and the next one got it as input
+	assert.Equal(t, []string{"Bearer ghp_secret", "Bearer ghp_secret", ""}, used)
+	assert.Equal(t, "Bearer {{ credentials.github_token }}", workflow.Nodes["call"].Config["token"], "the workflow keeps the reference")
+
+	// The records of the run hold it redacted
+	assert.Equal(t, "Bearer [REDACTED]", run.NodeResults["call"].Output["authorization"])
+	assert.Equal(t, "Bearer [REDACTED]", run.NodeResults["next"].InputsUsed["authorization"])
+	assert.Equal(t, map[string]interface{}{"authorization": "Bearer [REDACTED]"}, run.Results["call"])
+
+	execution, err := executor.GetExecution(context.Background(), run.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer [REDACTED]", execution.NodeResults["call"].Output["authorization"])
+
+	// And so do the logs
+	assert.NotContains(t, buf.String(), "ghp_secret")
+	assert.Contains(t, buf.String(), "calling with Bearer [REDACTED]")
+}
+
+func TestExecutorRedactsCredentialsFromErrors(t *testing.T) {
+	var buf bytes.Buffer
+	executor := newTokenExecutor(t, staticCredentials{"api_key": "sk-12345"}, &buf, new([]string))
+
+	run, err := executor.Run(context.Background(), tokenWorkflow(map[string]interface{}{
+		"token": "{{credentials.api_key}}",
+		"fail":  true,
+	}), nil)
+	require.Error(t, err)
+
+	assert.NotContains(t, err.Error(), "sk-12345")
+	require.NotNil(t, run.NodeResults["call"].Error)
+	assert.Equal(t, "request with [REDACTED] rejected", *run.NodeResults["call"].Error)
+
+	execution, getErr := executor.GetExecution(context.Background(), run.ExecutionID)
+	require.NoError(t, getErr)
+	require.NotNil(t, execution.Error)
+	assert.NotContains(t, *execution.Error, "sk-12345")
+	assert.NotContains(t, buf.String(), "sk-12345")
+}
+
+func TestResumeRerunsNodesWithRedactedOutput(t *testing.T) {
+	var buf bytes.Buffer
+	var used []string
+	executor := newTokenExecutor(t, staticCredentials{"github_token": "ghp_secret"}, &buf, &used)
+	workflow := tokenWorkflow(map[string]interface{}{"token": "Bearer {{ credentials.github_token }}"})
+	ctx := context.Background()
+
+	run, err := executor.Run(ctx, workflow, nil)
+	require.NoError(t, err)
+	call := run.NodeResults["call"]
+	assert.True(t, call.Redacted)
+	assert.False(t, run.NodeResults["next"].Redacted)
+
+	// State left behind by a process killed after "call" completed
+	store := NewMemoryExecutionStore()
+	executor.SetExecutionStore(store)
+	execution := &types.Execution{WorkflowID: workflow.ID, Status: types.ExecutionRunning}
+	require.NoError(t, store.CreateExecution(ctx, execution, workflow))
+	stored := *call
+	stored.ExecutionID = execution.ID
+	require.NoError(t, store.SaveNodeResult(ctx, &stored))
+	require.NoError(t, store.SaveNodeResult(ctx, &types.NodeResult{
+		ExecutionID: execution.ID, NodeID: "next", Status: types.NodeRunning,
+	}))
+	abandon(store, execution.ID)
+
+	// "call" runs again rather than handing on its redacted output
+	used = nil
+	_, err = executor.ResumeExecution(ctx, execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer ghp_secret", "Bearer ghp_secret", ""}, used)
+	assert.NotContains(t, buf.String(), "ghp_secret")
+}
+
+func TestExecutorFailsOnMissingCredential(t *testing.T) {
+	var buf bytes.Buffer
+	executor := newTokenExecutor(t, staticCredentials{}, &buf, new([]string))
+
+	_, err := executor.Run(context.Background(), tokenWorkflow(map[string]interface{}{"token": "{{credentials.missing}}"}), nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errNoSuchCredential)
+	assert.Contains(t, err.Error(), `"missing"`)
+
+	// Without a resolver, references cannot be resolved either
+	executor.SetCredentials(nil)
+	_, err = executor.Run(context.Background(), tokenWorkflow(map[string]interface{}{"token": "{{credentials.missing}}"}), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no credential store is configured")
+}
+
+func TestResolveCredentialsInNestedConfig(t *testing.T) {
+	redact := &redactor{}
+	config := map[string]interface{}{
+		"headers": map[string]interface{}{"Authorization": "token {{credentials.a}}"},
+		"args":    []interface{}{"{{credentials.b}}", 3},
+		"plain":   "{{input.value}}",
+	}
+
+	resolved, err := resolveCredentials(context.Background(), staticCredentials{"a": "aaa", "b": "bbb"}, config, redact)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"headers": map[string]interface{}{"Authorization": "token aaa"},
+		"args":    []interface{}{"bbb", 3},
+		"plain":   "{{input.value}}",
+	}, resolved)
+	assert.Equal(t, "token {{credentials.a}}", config["headers"].(map[string]interface{})["Authorization"])
+	assert.Equal(t, "[REDACTED] and [REDACTED]", redact.string("aaa and bbb"))
+}
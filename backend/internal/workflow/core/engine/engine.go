@@ -44,8 +44,8 @@ type MonitoringSystem struct {
 // Config for the engine
 type Config struct {
 	Parallelism  int
-	Logger       Logger
-	Storage      Storage
+	Logger       Logger  // defaults to a no-op logger
+	Storage      Storage // defaults to an in-memory storage
 	NodeRegistry interfaces.NodeFactory
 }
 
@@ -68,6 +68,16 @@ func NewEngine(config *Config) *Engine {
 		alerter:          NewAlerter(),
 	}
 
+	logger := config.Logger
+	if logger == nil {
+		logger = NewNopLogger()
+	}
+
+	storage := config.Storage
+	if storage == nil {
+		storage = NewMemoryStorage()
+	}
+
 	nodeRegistry := config.NodeRegistry
 	if nodeRegistry == nil {
 		nodeRegistry = interfaces.NewNodeRegistry()
@@ -83,11 +93,11 @@ func NewEngine(config *Config) *Engine {
 
 	engine := &Engine{
 		executions:            make(map[string]*types.Execution),
-		storage:               config.Storage,
+		storage:               storage,
 		scheduler:             nil, // TODO: Implement scheduler
 		nodeRegistry:          nodeRegistry,
 		parallelism:           config.Parallelism,
-		logger:                config.Logger,
+		logger:                logger,
 		securityMgr:           securityMgr,
 		monitoring:            monitoring,
 		aiAgentMgr:            NewAIManager(),
@@ -100,10 +110,8 @@ func NewEngine(config *Config) *Engine {
 
 // ExecuteWorkflow executes a workflow
 func (e *Engine) ExecuteWorkflow(ctx context.Context, workflow *types.Workflow, triggerParams map[string]interface{}) (string, error) {
-	executionID := uuid.New().String()
-
 	execution := &types.Execution{
-		ID:            executionID,
+		ID:            uuid.New().String(),
 		WorkflowID:    workflow.ID,
 		Status:        types.ExecutionCreated,
 		StartedAt:     time.Now(),
@@ -118,10 +126,16 @@ func (e *Engine) ExecuteWorkflow(ctx context.Context, workflow *types.Workflow,
 		execution.Variables[k] = v
 	}
 
-	// Save execution to storage
-	if err := e.storage.CreateExecution(execution); err != nil {
+	// Save execution to storage; the storage may assign its own ID
+	if err := e.storage.CreateExecution(ctx, execution, nil); err != nil {
 		return "", fmt.Errorf("failed to create execution: %w", err)
 	}
+	executionID := execution.ID
+
+	e.logger.Info("Execution created", map[string]interface{}{
+		LogFieldWorkflowID:  workflow.ID,
+		LogFieldExecutionID: executionID,
+	})
 
 	// Add to in-memory cache
 	e.mutex.Lock()
@@ -151,7 +165,7 @@ func (e *Engine) GetExecution(id string) (*types.Execution, error) {
 	}
 
 	// Try to get from storage
-	return e.storage.GetExecution(id)
+	return e.storage.GetExecution(context.Background(), id)
 }
 
 // RegisterCoreNodes registers all core node types
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// EventType identifies an ExecutionEvent
+type EventType string
+
+const (
+	EventNodeStarted   EventType = "node_started"
+	EventNodeCompleted EventType = "node_completed"
+	EventNodeFailed    EventType = "node_failed"
+	// EventPromptRequested announces a Prompt a node waits on; answer it
+	// with InteractionManager.Respond
+	EventPromptRequested EventType = "prompt_requested"
+	// EventExecutionFinished is the last event of an execution; its Status
+	// is the final status of the execution
+	EventExecutionFinished EventType = "execution_finished"
+)
+
+// ExecutionEvent reports the progress of a persisted execution. Node events
+// carry the node ID and, once the node has run, its status and error; prompt
+// events carry the prompt's ID and message.
+type ExecutionEvent struct {
+	Type        EventType `json:"type"`
+	ExecutionID string    `json:"execution_id"`
+	WorkflowID  string    `json:"workflow_id"`
+	NodeID      string    `json:"node_id,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Error       *string   `json:"error,omitempty"`
+	PromptID    string    `json:"prompt_id,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// eventBufferSize is the number of events a subscriber may fall behind by
+const eventBufferSize = 64
+
+// EventBus fans the events of each execution out to its subscribers
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan ExecutionEvent]struct{} // by execution ID
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[string]map[chan ExecutionEvent]struct{})}
+}
+
+// Subscribe returns the events published for an execution from now on, and
+// a function that ends the subscription. The channel is closed after the
+// EventExecutionFinished event, on unsubscribe, and when the subscriber
+// falls more than a buffer behind, since events are never dropped silently.
+func (b *EventBus) Subscribe(executionID string) (<-chan ExecutionEvent, func()) {
+	events := make(chan ExecutionEvent, eventBufferSize)
+
+	b.mu.Lock()
+	if b.subscribers[executionID] == nil {
+		b.subscribers[executionID] = make(map[chan ExecutionEvent]struct{})
+	}
+	b.subscribers[executionID][events] = struct{}{}
+	b.mu.Unlock()
+
+	return events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.removeLocked(executionID, events)
+	}
+}
+
+// Publish delivers event to the subscribers of its execution without
+// blocking
+func (b *EventBus) Publish(event ExecutionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for events := range b.subscribers[event.ExecutionID] {
+		select {
+		case events <- event:
+			if event.Type == EventExecutionFinished {
+				b.removeLocked(event.ExecutionID, events)
+			}
+		default:
+			b.removeLocked(event.ExecutionID, events)
+		}
+	}
+}
+
+// removeLocked closes a subscription unless it was already removed
+func (b *EventBus) removeLocked(executionID string, events chan ExecutionEvent) {
+	subscribers := b.subscribers[executionID]
+	if _, ok := subscribers[events]; !ok {
+		return
+	}
+	delete(subscribers, events)
+	close(events)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, executionID)
+	}
+}
+
+// Events returns the bus the executor publishes execution events on. Only
+// runs with an execution ID, that is with an execution store set, publish
+// events.
+func (we *WorkflowExecutor) Events() *EventBus {
+	return we.events
+}
+
+// publish sends an event of the run tracked by tracker, if any
+func (we *WorkflowExecutor) publish(tracker *executionTracker, event ExecutionEvent) {
+	if tracker == nil {
+		return
+	}
+	event.ExecutionID = tracker.execution.ID
+	event.WorkflowID = tracker.execution.WorkflowID
+	event.Timestamp = time.Now()
+	we.events.Publish(event)
+}
+
+// publishNode sends the event matching the state of a node result
+func (we *WorkflowExecutor) publishNode(tracker *executionTracker, result *types.NodeResult) {
+	eventType := EventNodeCompleted
+	switch result.Status {
+	case types.NodeRunning:
+		eventType = EventNodeStarted
+	case types.NodeFailed, types.NodeTimeout:
+		eventType = EventNodeFailed
+	}
+	we.publish(tracker, ExecutionEvent{
+		Type:   eventType,
+		NodeID: result.NodeID,
+		Status: string(result.Status),
+		Error:  result.Error,
+	})
+}
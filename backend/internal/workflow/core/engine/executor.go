@@ -3,10 +3,14 @@ package engine
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"reflect"
+	"sort"
 	"sync"
+	"time"
 
 	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
 )
 
 // Workflow represents a workflow with nodes and connections
@@ -23,19 +27,65 @@ type WorkflowNode struct {
 	Type     string                 `json:"type"`
 	Config   map[string]interface{} `json:"config"`
 	Position map[string]float64     `json:"position"`
+	// Version is the version of the node type Config is written for;
+	// configs of older versions are migrated when the workflow is loaded
+	Version string `json:"version,omitempty"`
 }
 
-// WorkflowEdge represents a connection between nodes
+// WorkflowEdge represents a connection between nodes. SourceHandle names the
+// output port the edge leaves from; edges without a handle are always followed.
+// Edges with a Mapping give their target the fields it builds from the output
+// of their source, such as {"userId": "source.user.id"}, instead of the whole
+// output; see edgeMapping for the expressions it may use.
 type WorkflowEdge struct {
-	ID     string `json:"id"`
-	Source string `json:"source"`
-	Target string `json:"target"`
+	ID           string            `json:"id"`
+	Source       string            `json:"source"`
+	Target       string            `json:"target"`
+	SourceHandle string            `json:"source_handle,omitempty"`
+	Mapping      map[string]string `json:"mapping,omitempty"`
+}
+
+// BranchOutputKey is the output field a node sets to select which output port
+// its outgoing edges are followed from. The if_else node sets it to "true" or
+// "false", and the switch node to the port of the case that matched; only
+// edges whose SourceHandle matches are followed.
+const BranchOutputKey = "branch"
+
+// LoopBodyHandle is the output port of a looping node (such as for_each) that
+// leads to its body. The nodes reachable from it run once per iteration, as a
+// separate subgraph, instead of as part of the enclosing workflow.
+const LoopBodyHandle = "body"
+
+// WorkflowRun holds the outcome of a workflow execution
+type WorkflowRun struct {
+	ExecutionID string                       `json:"execution_id,omitempty"`
+	WorkflowID  string                       `json:"workflow_id"`
+	Results     map[string]interface{}       `json:"results"`
+	NodeResults map[string]*types.NodeResult `json:"node_results"`
+	// Stubbed lists the nodes a simulated run stubbed, in execution order
+	Stubbed []string `json:"stubbed,omitempty"`
+	// RecordingID identifies the calls of a recorded or replayed run
+	RecordingID string `json:"recording_id,omitempty"`
 }
 
 // WorkflowExecutor executes workflows
 type WorkflowExecutor struct {
-	registry *NodeTypeRegistryImpl
-	mu       sync.Mutex
+	registry      *NodeTypeRegistryImpl
+	retryPolicy   RetryPolicy
+	timeoutPolicy TimeoutPolicy
+	store         ExecutionStore
+	logger        Logger
+	metrics       ExecutionMetrics
+	tracer        ExecutionTracer
+	active        map[string]int                // running executions per workflow ID
+	cancels       map[string]context.CancelFunc // by execution ID
+	events        *EventBus
+	interactions  *InteractionManager
+	credentials   CredentialResolver
+	calls         CallStore
+	// maxRecordedPayload bounds the recorded inputs and outputs, in bytes
+	maxRecordedPayload int
+	mu                 sync.Mutex
 }
 
 // NewWorkflowExecutor creates a new workflow executor
@@ -43,84 +93,646 @@ func NewWorkflowExecutor(registry *NodeTypeRegistryImpl) *WorkflowExecutor {
 	if registry == nil {
 		registry = globalRegistry
 	}
+	events := NewEventBus()
 	return &WorkflowExecutor{
-		registry: registry,
+		registry:      registry,
+		retryPolicy:   DefaultRetryPolicy(),
+		timeoutPolicy: DefaultTimeoutPolicy(),
+		logger:        NewSlogLoggerFrom(slog.Default()),
+		metrics:       NewMetricsCollector(),
+		tracer:        noopTracer{},
+		active:        make(map[string]int),
+		cancels:       make(map[string]context.CancelFunc),
+		events:        events,
+		interactions:  NewInteractionManager(events),
+	}
+}
+
+// SetMetrics sets where execution metrics are recorded; nil disables them
+func (we *WorkflowExecutor) SetMetrics(metrics ExecutionMetrics) {
+	if metrics == nil {
+		metrics = NewMetricsCollector()
+	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.metrics = metrics
+}
+
+// SetTracer sets where execution traces are recorded; nil disables them
+func (we *WorkflowExecutor) SetTracer(tracer ExecutionTracer) {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.tracer = tracer
+}
+
+// SetLogger sets the logger for execution logs; nil disables logging
+func (we *WorkflowExecutor) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NewNopLogger()
 	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.logger = logger
+}
+
+// Registry returns the node types the executor runs
+func (we *WorkflowExecutor) Registry() *NodeTypeRegistryImpl {
+	return we.registry
+}
+
+// SetRetryPolicy sets the policy used to retry failed node executions
+func (we *WorkflowExecutor) SetRetryPolicy(policy RetryPolicy) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.retryPolicy = policy
+}
+
+// SetTimeoutPolicy sets the per-node execution timeout
+func (we *WorkflowExecutor) SetTimeoutPolicy(policy TimeoutPolicy) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.timeoutPolicy = policy
+}
+
+// Policies returns the retry and timeout policies nodes run with
+func (we *WorkflowExecutor) Policies() (RetryPolicy, TimeoutPolicy) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	return we.retryPolicy, we.timeoutPolicy
 }
 
 // ExecuteWorkflow executes a workflow with the given inputs
 func (we *WorkflowExecutor) ExecuteWorkflow(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) (map[string]interface{}, error) {
-	log.Printf("Executing workflow: %s", workflow.ID)
+	run, err := we.Run(ctx, workflow, inputs)
+	if err != nil {
+		return nil, err
+	}
+	return run.Results, nil
+}
 
-	// Initialize all nodes
-	nodeInstances := make(map[string]types.NodeInstance)
-	for nodeID, node := range workflow.Nodes {
-		creator, exists := we.registry.GetNodeType(node.Type)
-		if !exists {
-			return nil, fmt.Errorf("unknown node type: %s", node.Type)
+// Run executes a workflow and returns per-node results, including attempt
+// counts, errors and skipped branches. If a node fails, the partial run is
+// returned along with the error. When an execution store is set, the run is
+// persisted and can be resumed with ResumeExecution.
+func (we *WorkflowExecutor) Run(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) (*WorkflowRun, error) {
+	we.mu.Lock()
+	store := we.store
+	we.mu.Unlock()
+
+	var tracker *executionTracker
+	if store != nil {
+		var err error
+		if tracker, err = startExecution(ctx, store, workflow, inputs); err != nil {
+			return nil, err
 		}
+	}
 
-		instance := creator()
-		if err := instance.Initialize(node.Config); err != nil {
-			return nil, fmt.Errorf("failed to initialize node %s: %v", nodeID, err)
+	ctx, release := we.cancellable(ctx, tracker)
+	defer release()
+	return we.execute(ctx, workflow, inputs, tracker)
+}
+
+// Start runs a workflow in the background and returns its execution ID,
+// with which the run can be looked up with GetExecution and stopped with
+// CancelExecution. It requires an execution store. The run is not cancelled
+// along with ctx.
+func (we *WorkflowExecutor) Start(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) (string, error) {
+	return we.start(ctx, workflow, inputs, nil)
+}
+
+// StartAndSubscribe is Start, subscribing to the run's events before it
+// begins so that none are missed. See EventBus.Subscribe.
+func (we *WorkflowExecutor) StartAndSubscribe(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) (string, <-chan ExecutionEvent, func(), error) {
+	var events <-chan ExecutionEvent
+	var unsubscribe func()
+	id, err := we.start(ctx, workflow, inputs, func(id string) {
+		events, unsubscribe = we.events.Subscribe(id)
+	})
+	return id, events, unsubscribe, err
+}
+
+// start records and launches a run, calling beforeRun, when set, with the
+// execution ID first
+func (we *WorkflowExecutor) start(ctx context.Context, workflow *Workflow, inputs map[string]interface{}, beforeRun func(id string)) (string, error) {
+	we.mu.Lock()
+	store, logger := we.store, we.logger
+	we.mu.Unlock()
+	if store == nil {
+		return "", fmt.Errorf("execution persistence is not configured")
+	}
+
+	tracker, err := startExecution(ctx, store, workflow, inputs)
+	if err != nil {
+		return "", err
+	}
+	if beforeRun != nil {
+		beforeRun(tracker.id())
+	}
+
+	// Registered before returning, so the ID can be cancelled right away
+	ctx, release := we.cancellable(context.WithoutCancel(ctx), tracker)
+	go func() {
+		defer release()
+		if _, err := we.execute(ctx, workflow, inputs, tracker); err != nil {
+			fields := executionLogFields(workflow, tracker)
+			fields["error"] = err
+			logger.Error("Workflow execution failed", fields)
 		}
+	}()
+	return tracker.id(), nil
+}
+
+// execute runs a workflow, recording its progress with tracker when set.
+// Nodes the tracker reports as completed are not run again.
+func (we *WorkflowExecutor) execute(ctx context.Context, workflow *Workflow, inputs map[string]interface{}, tracker *executionTracker) (*WorkflowRun, error) {
+	we.mu.Lock()
+	metrics, tracer := we.metrics, we.tracer
+	we.mu.Unlock()
 
-		if err := instance.Validate(); err != nil {
-			return nil, fmt.Errorf("invalid configuration for node %s: %v", nodeID, err)
+	// Loop bodies are part of the enclosing execution
+	nested := isNestedRun(ctx)
+	if tracker != nil {
+		ctx = contextWithExecutionID(ctx, tracker.id())
+	}
+	startedAt := time.Now()
+	if !nested {
+		we.setActive(workflow.ID, 1)
+		defer we.setActive(workflow.ID, -1)
+		metrics.RecordExecutionStart(workflow.ID, tracker.id())
+	}
+
+	// The run's span is the parent of its nodes' spans, and a child of the
+	// loop node's span for loop bodies
+	span := tracer.StartSpan(SpanFromContext(ctx), SpanWorkflowRun, executionLogFields(workflow, tracker))
+	ctx = ContextWithSpan(ctx, span)
+
+	// Secrets resolved for the run are kept out of its logs and records
+	redact := &redactor{}
+	run, err := we.runGraph(ctx, workflow, inputs, tracker, redact)
+	err = redact.error(err)
+	tracer.EndSpan(span, nil, err)
+	tracker.finish(ctx, err)
+	if tracker != nil {
+		if run != nil {
+			run.ExecutionID = tracker.execution.ID
+		}
+		we.publish(tracker, ExecutionEvent{
+			Type:   EventExecutionFinished,
+			Status: string(tracker.execution.Status),
+			Error:  tracker.execution.Error,
+		})
+	}
+
+	if !nested {
+		metrics.RecordExecutionEnd(workflow.ID, tracker.id(), err == nil, time.Since(startedAt).Seconds())
+	}
+	return run, err
+}
+
+// ActiveExecutions returns the number of executions of a workflow that are
+// running
+func (we *WorkflowExecutor) ActiveExecutions(workflowID string) int {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	return we.active[workflowID]
+}
+
+// cancellable derives the context of a persisted run that CancelExecution
+// cancels, and keeps up the run's heartbeat. release must be called once
+// the run has finished.
+func (we *WorkflowExecutor) cancellable(ctx context.Context, tracker *executionTracker) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if tracker == nil {
+		return ctx, cancel
+	}
+
+	id := tracker.id()
+	we.mu.Lock()
+	we.cancels[id] = cancel
+	we.mu.Unlock()
+	stop := make(chan struct{})
+	go tracker.heartbeat(ctx, stop)
+	return ctx, func() {
+		close(stop)
+		we.mu.Lock()
+		delete(we.cancels, id)
+		we.mu.Unlock()
+		cancel()
+	}
+}
+
+// CancelExecution stops a running execution. Its context is cancelled, so
+// the node in flight sees ctx.Done() and no further nodes run; the execution
+// then finishes with status cancelled. It returns ErrExecutionNotFound for
+// unknown IDs and ErrExecutionNotRunning for executions that have finished
+// or are not running in this executor.
+func (we *WorkflowExecutor) CancelExecution(ctx context.Context, executionID string) error {
+	we.mu.Lock()
+	cancel, running := we.cancels[executionID]
+	we.mu.Unlock()
+	if running {
+		cancel()
+		return nil
+	}
+
+	if _, err := we.GetExecution(ctx, executionID); err != nil {
+		return err
+	}
+	return ErrExecutionNotRunning
+}
+
+func (we *WorkflowExecutor) setActive(workflowID string, delta int) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.active[workflowID] += delta
+	if we.active[workflowID] <= 0 {
+		delete(we.active, workflowID)
+	}
+}
+
+// nestedRunContextKey marks the contexts of loop body runs. Only
+// iterationFunc sets it, so callers' contexts never pass for nested runs.
+type nestedRunContextKey struct{}
+
+// isNestedRun reports whether ctx belongs to a node of an enclosing run,
+// as it does for loop bodies
+func isNestedRun(ctx context.Context) bool {
+	nested, _ := ctx.Value(nestedRunContextKey{}).(bool)
+	return nested
+}
+
+func (we *WorkflowExecutor) runGraph(ctx context.Context, workflow *Workflow, inputs map[string]interface{}, tracker *executionTracker, redact *redactor) (*WorkflowRun, error) {
+	run := &WorkflowRun{
+		WorkflowID:  workflow.ID,
+		Results:     make(map[string]interface{}),
+		NodeResults: make(map[string]*types.NodeResult),
+	}
+
+	we.mu.Lock()
+	retryPolicy, timeoutPolicy, logger, metrics, tracer := we.retryPolicy, we.timeoutPolicy, we.logger, we.metrics, we.tracer
+	we.mu.Unlock()
+
+	logger = newRedactingLogger(logger, redact).With(executionLogFields(workflow, tracker))
+
+	// Loop bodies run inside a node of an enclosing run, so their start and
+	// end are only logged at debug level
+	logRun := logger.Info
+	if isNestedRun(ctx) {
+		logRun = logger.Debug
+	}
+	logRun("Executing workflow")
+
+	// Loop bodies are executed by their loop node, so set them aside
+	workflow, bodies := splitLoopBodies(workflow)
+
+	// Initialize all nodes
+	nodeInstances := make(map[string]types.NodeInstance)
+	for nodeID := range workflow.Nodes {
+		instance, err := we.initializeNode(ctx, workflow, nodeID, bodies, tracker, redact, logger)
+		if err != nil {
+			return nil, err
 		}
 
 		nodeInstances[nodeID] = instance
 		defer func(nodeID string, instance types.NodeInstance) {
 			if err := instance.Close(); err != nil {
-				log.Printf("Error closing node %s: %v", nodeID, err)
+				logger.Warn("Error closing node", map[string]interface{}{LogFieldNodeID: nodeID, "error": err})
 			}
 		}(nodeID, instance)
 	}
 
-	// Execute the workflow - for now, execute in a simple order
-	// TODO: Implement proper DAG execution with parallel execution
-	results := make(map[string]interface{})
-	
-	// Execute nodes in order - this is a simplified approach
-	// In a real implementation, we would need to build a dependency graph
-	for nodeID := range workflow.Nodes {
+	order, err := topologicalOrder(workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := newGraphState(workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute nodes in dependency order, following only the edges leaving
+	// the output port each node selected. Nodes get the outputs of their
+	// predecessors as they are; the run returns them with secrets redacted.
+	completed := tracker.completed()
+
+	for _, nodeID := range order {
+		// A cancelled run stops before its next node
+		if err := ctx.Err(); err != nil {
+			logRun("Workflow cancelled")
+			return run, fmt.Errorf("workflow execution stopped before node %s: %w", nodeID, err)
+		}
+
 		instance := nodeInstances[nodeID]
+		nodeLogger := logger.With(map[string]interface{}{
+			LogFieldNodeID: nodeID,
+			"node_type":    workflow.Nodes[nodeID].Type,
+		})
 
-		// Prepare input for this node
-		input := types.NodeInput{Data: make(map[string]interface{})}
+		// Nodes that completed before the execution was interrupted keep
+		// their stored output. Those whose output had secrets redacted run
+		// again, as their successors need the real values.
+		if previous, ok := completed[nodeID]; ok && !previous.Redacted {
+			run.NodeResults[nodeID] = previous
+			run.Results[nodeID] = previous.Output
+			graph.complete(nodeID, previous.Output)
+			continue
+		}
 
-		// Find edges that point to this node and collect their results
-		for _, edge := range workflow.Edges {
-			if edge.Target == nodeID {
-				// Get result from source node
-				sourceResult := results[edge.Source]
-				if sourceResult != nil {
-					// Merge the results from source nodes
-					if sourceMap, ok := sourceResult.(map[string]interface{}); ok {
-						for k, v := range sourceMap {
-							input.Data[k] = v
-						}
-					} else {
-						// If source result is not a map, store under a default key
-						input.Data["result"] = sourceResult
-					}
-				}
+		// Collect results from the edges that lead here and were taken.
+		// Nodes only reachable through untaken branches are skipped.
+		_, isFanIn := asFanInNode(instance)
+		input, skip, mappingErr := graph.input(nodeID, isFanIn, inputs)
+		if skip {
+			run.NodeResults[nodeID] = &types.NodeResult{
+				NodeID: nodeID,
+				Status: types.NodeSkipped,
 			}
+			tracker.saveNode(ctx, run.NodeResults[nodeID])
+			nodeLogger.Debug("Skipping node on untaken branch")
+			continue
 		}
 
-		// If this is a starting node, use provided inputs
-		if len(input.Data) == 0 {
-			input.Data = inputs
+		// Execute the node, applying the timeout and retry policies and checking
+		// its input and output against the schemas of its type. Simulated
+		// runs stub nodes with side effects instead, and replayed runs
+		// serve the recorded outputs of external nodes.
+		nodeLogger.Debug("Executing node")
+		startedAt := time.Now()
+		started := &types.NodeResult{NodeID: nodeID, Status: types.NodeRunning, StartedAt: startedAt}
+		tracker.saveNode(ctx, started)
+		we.publishNode(tracker, started)
+		nodeSpan := tracer.StartSpan(SpanFromContext(ctx), SpanNodeExecution, map[string]interface{}{
+			LogFieldNodeID: nodeID,
+			"node_type":    workflow.Nodes[nodeID].Type,
+		})
+		nodeCtx := ContextWithSpan(ContextWithLogger(ctx, nodeLogger), nodeSpan)
+		var output types.NodeOutput
+		attempts, stubbed := 1, false
+		if mappingErr != nil {
+			output.Error = nodeerrors.NewValidationError("invalid edge mapping", mappingErr)
+		} else {
+			output, attempts, stubbed = executeOrStub(nodeCtx, nodeID, instance, input, retryPolicy, timeoutPolicy, redact)
+		}
+		completedAt := time.Now()
+		metrics.RecordNodeExecution(workflow.Nodes[nodeID].Type, tracker.id(), output.Error == nil, completedAt.Sub(startedAt).Seconds())
+		nodeFields := map[string]interface{}{
+			"attempts":    attempts,
+			"duration_ms": completedAt.Sub(startedAt).Milliseconds(),
+		}
+		tracer.EndSpan(nodeSpan, map[string]interface{}{"attempts": attempts, "simulated": stubbed}, redact.error(output.Error))
+
+		redactedOutput := redact.fields(output.Data)
+		nodeResult := &types.NodeResult{
+			NodeID:        nodeID,
+			Status:        types.NodeCompleted,
+			Output:        redactedOutput,
+			Redacted:      redact.active() && !reflect.DeepEqual(redactedOutput, output.Data),
+			StartedAt:     startedAt,
+			CompletedAt:   &completedAt,
+			ExecutionTime: completedAt.Sub(startedAt),
+			RetryCount:    attempts - 1,
+			InputsUsed:    redact.fields(input.Data),
+			Simulated:     stubbed,
+		}
+		run.NodeResults[nodeID] = nodeResult
+		if stubbed {
+			run.Stubbed = append(run.Stubbed, nodeID)
+			nodeFields["simulated"] = true
 		}
 
-		// Execute the node
-		output := instance.Execute(ctx, input)
 		if output.Error != nil {
-			return nil, fmt.Errorf("error executing node %s: %v", nodeID, output.Error)
+			errMsg := redact.string(output.Error.Error())
+			nodeResult.Status = types.NodeFailed
+			code := classify(output.Error)
+			if code == nodeerrors.CodeTimeout {
+				nodeResult.Status = types.NodeTimeout
+			}
+			nodeResult.Error = &errMsg
+			metrics.RecordError(workflow.ID, tracker.id(), nodeID, string(nodeResult.Status))
+			tracker.saveNode(ctx, nodeResult)
+			we.publishNode(tracker, nodeResult)
+			nodeFields["error"] = errMsg
+			if code != "" {
+				nodeFields["error_code"] = code
+			}
+
+			// Branches merged by nodes that tolerate failed branches fail
+			// on their own
+			if toleratesFailure(workflow, nodeInstances, nodeID) {
+				nodeLogger.Warn("Node failed; continuing with the other branches", nodeFields)
+				graph.fail(nodeID, errMsg)
+				continue
+			}
+			nodeLogger.Error("Node failed", nodeFields)
+			return run, fmt.Errorf("error executing node %s after %d attempt(s): %w", nodeID, attempts, output.Error)
+		}
+
+		tracker.saveNode(ctx, nodeResult)
+		we.publishNode(tracker, nodeResult)
+		nodeLogger.Debug("Node completed", nodeFields)
+		run.Results[nodeID] = nodeResult.Output
+		graph.complete(nodeID, output.Data)
+	}
+
+	logRun("Workflow completed")
+	return run, nil
+}
+
+// executionLogFields returns the fields identifying a run in log records
+func executionLogFields(workflow *Workflow, tracker *executionTracker) map[string]interface{} {
+	fields := map[string]interface{}{LogFieldWorkflowID: workflow.ID}
+	if tracker != nil {
+		fields[LogFieldExecutionID] = tracker.execution.ID
+	}
+	return fields
+}
+
+// takeEdges marks which of nodeID's outgoing edges are followed, given the
+// node's output
+func takeEdges(workflow *Workflow, takenEdges map[int]bool, nodeID string, output map[string]interface{}) {
+	branch, hasBranch := output[BranchOutputKey].(string)
+	for i, edge := range workflow.Edges {
+		if edge.Source == nodeID {
+			takenEdges[i] = !hasBranch || edge.SourceHandle == "" || edge.SourceHandle == branch
+		}
+	}
+}
+
+// iterationFunc returns a loop body that runs the body subgraph with the
+// iteration context as its input. The outputs of the subgraph's final nodes
+// are merged into the iteration result.
+func (we *WorkflowExecutor) iterationFunc(body *Workflow) IterationFunc {
+	return func(ctx context.Context, item map[string]interface{}) (map[string]interface{}, error) {
+		run, err := we.execute(context.WithValue(ctx, nestedRunContextKey{}, true), body, item, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		hasOutgoing := make(map[string]bool, len(body.Edges))
+		for _, edge := range body.Edges {
+			hasOutgoing[edge.Source] = true
+		}
+
+		sinks := make([]string, 0, len(body.Nodes))
+		for nodeID := range body.Nodes {
+			if !hasOutgoing[nodeID] {
+				sinks = append(sinks, nodeID)
+			}
+		}
+		sort.Strings(sinks)
+
+		result := make(map[string]interface{})
+		for _, nodeID := range sinks {
+			if output, ok := run.Results[nodeID].(map[string]interface{}); ok {
+				for k, v := range output {
+					result[k] = v
+				}
+			}
+		}
+		return result, nil
+	}
+}
+
+// splitLoopBodies separates the nodes reachable from each loop node's body
+// port into their own subgraphs, keyed by loop node ID. The returned workflow
+// holds the remaining nodes and the edges between them. Nested loops stay
+// inside their enclosing body and are split again when that body runs.
+func splitLoopBodies(workflow *Workflow) (*Workflow, map[string]*Workflow) {
+	outgoing := make(map[string][]string)
+	var loops []string
+	for _, edge := range workflow.Edges {
+		outgoing[edge.Source] = append(outgoing[edge.Source], edge.Target)
+		if edge.SourceHandle == LoopBodyHandle {
+			loops = append(loops, edge.Source)
+		}
+	}
+	if len(loops) == 0 {
+		return workflow, nil
+	}
+
+	bodies := make(map[string]*Workflow)
+	inBody := make(map[string]bool)
+	for _, loopID := range loops {
+		if _, done := bodies[loopID]; done || inBody[loopID] {
+			continue
+		}
+
+		// Collect everything reachable from the body port
+		members := make(map[string]bool)
+		var queue []string
+		for _, edge := range workflow.Edges {
+			if edge.Source == loopID && edge.SourceHandle == LoopBodyHandle {
+				queue = append(queue, edge.Target)
+			}
+		}
+		for len(queue) > 0 {
+			nodeID := queue[0]
+			queue = queue[1:]
+			if nodeID == loopID || members[nodeID] {
+				continue
+			}
+			members[nodeID] = true
+			queue = append(queue, outgoing[nodeID]...)
+		}
+
+		body := &Workflow{
+			ID:    fmt.Sprintf("%s/%s", workflow.ID, loopID),
+			Name:  workflow.Name,
+			Nodes: make(map[string]*WorkflowNode, len(members)),
+		}
+		for nodeID := range members {
+			if node, ok := workflow.Nodes[nodeID]; ok {
+				body.Nodes[nodeID] = node
+			}
+			inBody[nodeID] = true
+		}
+		for _, edge := range workflow.Edges {
+			if members[edge.Source] && members[edge.Target] {
+				body.Edges = append(body.Edges, edge)
+			}
+		}
+		bodies[loopID] = body
+	}
+
+	// Loops nested inside another body are handled by that body's run
+	for loopID := range bodies {
+		if inBody[loopID] {
+			delete(bodies, loopID)
+		}
+	}
+
+	rest := &Workflow{
+		ID:    workflow.ID,
+		Name:  workflow.Name,
+		Nodes: make(map[string]*WorkflowNode, len(workflow.Nodes)),
+	}
+	for nodeID, node := range workflow.Nodes {
+		if !inBody[nodeID] {
+			rest.Nodes[nodeID] = node
+		}
+	}
+	for _, edge := range workflow.Edges {
+		if !inBody[edge.Source] && !inBody[edge.Target] {
+			rest.Edges = append(rest.Edges, edge)
+		}
+	}
+
+	return rest, bodies
+}
+
+// topologicalOrder returns the workflow's node IDs ordered so that every node
+// comes after the sources of its incoming edges. Ties are broken by node ID to
+// keep execution order deterministic.
+func topologicalOrder(workflow *Workflow) ([]string, error) {
+	inDegree := make(map[string]int, len(workflow.Nodes))
+	for nodeID := range workflow.Nodes {
+		inDegree[nodeID] = 0
+	}
+
+	dependents := make(map[string][]string)
+	for _, edge := range workflow.Edges {
+		if _, ok := workflow.Nodes[edge.Source]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown source node %s", edge.ID, edge.Source)
 		}
+		if _, ok := workflow.Nodes[edge.Target]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown target node %s", edge.ID, edge.Target)
+		}
+		dependents[edge.Source] = append(dependents[edge.Source], edge.Target)
+		inDegree[edge.Target]++
+	}
+
+	var ready []string
+	for nodeID, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, nodeID)
+		}
+	}
+	sort.Strings(ready)
+
+	order := make([]string, 0, len(workflow.Nodes))
+	for len(ready) > 0 {
+		nodeID := ready[0]
+		ready = ready[1:]
+		order = append(order, nodeID)
+
+		var unlocked []string
+		for _, target := range dependents[nodeID] {
+			inDegree[target]--
+			if inDegree[target] == 0 {
+				unlocked = append(unlocked, target)
+			}
+		}
+		sort.Strings(unlocked)
+		ready = append(ready, unlocked...)
+	}
 
-		results[nodeID] = output.Data
+	if len(order) != len(workflow.Nodes) {
+		return nil, fmt.Errorf("workflow %s contains a cycle", workflow.ID)
 	}
 
-	return results, nil
+	return order, nil
 }
\ No newline at end of file
@@ -0,0 +1,474 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyNode fails with err for the first `failures` executions, then succeeds
+type flakyNode struct {
+	failures int32
+	err      error
+	delay    time.Duration
+	calls    *int32
+}
+
+func (n *flakyNode) Initialize(config map[string]interface{}) error { return nil }
+func (n *flakyNode) Validate() error                                { return nil }
+func (n *flakyNode) Close() error                                   { return nil }
+func (n *flakyNode) GetMetadata() types.NodeMetadata                { return types.NodeMetadata{ID: "flaky"} }
+
+func (n *flakyNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	call := atomic.AddInt32(n.calls, 1)
+	if n.delay > 0 {
+		select {
+		case <-time.After(n.delay):
+		case <-ctx.Done():
+			return types.NodeOutput{Error: ctx.Err()}
+		}
+	}
+	if call <= n.failures {
+		return types.NodeOutput{Error: n.err}
+	}
+	return types.NodeOutput{Data: map[string]interface{}{"call": call}}
+}
+
+func newFlakyExecutor(t *testing.T, node *flakyNode) *WorkflowExecutor {
+	t.Helper()
+
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("flaky", func() types.NodeInstance { return node }, node.GetMetadata()))
+
+	executor := NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(RetryPolicy{
+		Enable:        true,
+		MaxAttempts:   3,
+		BackoffFactor: 2,
+		InitialWait:   time.Millisecond,
+		MaxWaitTime:   5 * time.Millisecond,
+		Conditions:    []string{RetryOnNetworkError, RetryOnTimeout},
+	})
+	return executor
+}
+
+func flakyWorkflow() *Workflow {
+	return &Workflow{
+		ID:    "wf",
+		Nodes: map[string]*WorkflowNode{"n1": {ID: "n1", Type: "flaky"}},
+	}
+}
+
+func TestExecutorRetriesTransientFailures(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{failures: 2, err: syscall.ECONNREFUSED, calls: &calls})
+
+	run, err := executor.Run(context.Background(), flakyWorkflow(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, types.NodeCompleted, run.NodeResults["n1"].Status)
+	assert.Equal(t, 2, run.NodeResults["n1"].RetryCount)
+	assert.Equal(t, map[string]interface{}{"call": int32(3)}, run.Results["n1"])
+}
+
+func TestExecutorGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{failures: 5, err: syscall.ECONNRESET, calls: &calls})
+
+	run, err := executor.Run(context.Background(), flakyWorkflow(), nil)
+	require.Error(t, err)
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, types.NodeFailed, run.NodeResults["n1"].Status)
+	assert.Equal(t, 2, run.NodeResults["n1"].RetryCount)
+	require.NotNil(t, run.NodeResults["n1"].Error)
+	assert.Contains(t, *run.NodeResults["n1"].Error, "connection reset")
+}
+
+func TestExecutorDoesNotRetryPermanentErrors(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{failures: 1, err: errors.New("invalid config"), calls: &calls})
+
+	_, err := executor.Run(context.Background(), flakyWorkflow(), nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestExecutorEnforcesNodeTimeout(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{delay: time.Second, calls: &calls})
+	executor.SetTimeoutPolicy(TimeoutPolicy{NodeTimeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	run, err := executor.Run(context.Background(), flakyWorkflow(), nil)
+	require.Error(t, err)
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "timeouts are retried")
+	assert.Equal(t, types.NodeTimeout, run.NodeResults["n1"].Status)
+}
+
+func TestRetryPolicyBackoffIsCapped(t *testing.T) {
+	policy := RetryPolicy{BackoffFactor: 2, InitialWait: time.Second, MaxWaitTime: 5 * time.Second}
+
+	assert.Equal(t, time.Second, policy.backoff(1))
+	assert.Equal(t, 2*time.Second, policy.backoff(2))
+	assert.Equal(t, 4*time.Second, policy.backoff(3))
+	assert.Equal(t, 5*time.Second, policy.backoff(4))
+}
+
+func TestRetryPolicyRetriesByErrorCode(t *testing.T) {
+	policy := RetryPolicy{Conditions: []string{RetryOnNetworkError, RetryOnTimeout}}
+
+	assert.True(t, policy.ShouldRetry(nodeerrors.NewNetworkError("unreachable", nil)))
+	assert.True(t, policy.ShouldRetry(fmt.Errorf("step: %w", nodeerrors.NewTimeoutError("slow", nil))))
+	assert.False(t, policy.ShouldRetry(nodeerrors.NewResourceError("rate limited", nil)), "not a configured condition")
+	assert.False(t, policy.ShouldRetry(nodeerrors.NewValidationError("bad input", nil)))
+	assert.False(t, policy.ShouldRetry(nodeerrors.NewAuthError("bad key", syscall.ECONNREFUSED)), "the code wins over the cause")
+	assert.True(t, policy.ShouldRetry(syscall.ECONNREFUSED), "unclassified errors fall back to their cause")
+}
+
+func TestExecutorRecordsTimeoutErrorCode(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{failures: 5, err: nodeerrors.NewTimeoutError("upstream timed out", nil), calls: &calls})
+
+	run, err := executor.Run(context.Background(), flakyWorkflow(), nil)
+	require.Error(t, err)
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, types.NodeTimeout, run.NodeResults["n1"].Status)
+	assert.Equal(t, nodeerrors.CodeTimeout, nodeerrors.CodeOf(err))
+}
+
+// recordNode records that it ran and passes its input through
+type recordNode struct {
+	ran *[]string
+	id  string
+}
+
+func (n *recordNode) Initialize(config map[string]interface{}) error {
+	n.id, _ = config["name"].(string)
+	return nil
+}
+func (n *recordNode) Validate() error                 { return nil }
+func (n *recordNode) Close() error                    { return nil }
+func (n *recordNode) GetMetadata() types.NodeMetadata { return types.NodeMetadata{ID: "record"} }
+
+func (n *recordNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	*n.ran = append(*n.ran, n.id)
+	return types.NodeOutput{Data: input.Data}
+}
+
+func branchingWorkflow() *Workflow {
+	return &Workflow{
+		ID: "branching",
+		Nodes: map[string]*WorkflowNode{
+			"check": {ID: "check", Type: "if_else", Config: map[string]interface{}{
+				"field": "order.total", "operator": "gt", "value": float64(100),
+			}},
+			"approve":  {ID: "approve", Type: "record", Config: map[string]interface{}{"name": "approve"}},
+			"notify":   {ID: "notify", Type: "record", Config: map[string]interface{}{"name": "notify"}},
+			"reject":   {ID: "reject", Type: "record", Config: map[string]interface{}{"name": "reject"}},
+			"finalize": {ID: "finalize", Type: "record", Config: map[string]interface{}{"name": "finalize"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "check", Target: "approve", SourceHandle: "true"},
+			{ID: "e2", Source: "approve", Target: "notify"},
+			{ID: "e3", Source: "check", Target: "reject", SourceHandle: "false"},
+			{ID: "e4", Source: "notify", Target: "finalize"},
+			{ID: "e5", Source: "reject", Target: "finalize"},
+		},
+	}
+}
+
+func newBranchingExecutor(t *testing.T, ran *[]string) *WorkflowExecutor {
+	t.Helper()
+
+	registry := NewNodeTypeRegistry()
+	ifElseMeta := types.NodeMetadata{ID: "if_else"}
+	require.NoError(t, registry.RegisterNodeType("if_else", AdaptNode(utility.NewIfElseNode, ifElseMeta), ifElseMeta))
+	require.NoError(t, registry.RegisterNodeType("record", func() types.NodeInstance {
+		return &recordNode{ran: ran}
+	}, types.NodeMetadata{ID: "record"}))
+
+	return NewWorkflowExecutor(registry)
+}
+
+func TestExecutorFollowsTakenBranchOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   float64
+		ran     []string
+		skipped []string
+	}{
+		{"true branch", 250, []string{"approve", "notify", "finalize"}, []string{"reject"}},
+		{"false branch", 20, []string{"reject", "finalize"}, []string{"approve", "notify"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			executor := newBranchingExecutor(t, &ran)
+
+			run, err := executor.Run(context.Background(), branchingWorkflow(), map[string]interface{}{
+				"order": map[string]interface{}{"total": tt.total},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.ran, ran)
+			for _, nodeID := range tt.skipped {
+				assert.Equal(t, types.NodeSkipped, run.NodeResults[nodeID].Status, nodeID)
+				assert.NotContains(t, run.Results, nodeID)
+			}
+			assert.Equal(t, types.NodeCompleted, run.NodeResults["finalize"].Status)
+		})
+	}
+}
+
+func TestExecutorRejectsCycles(t *testing.T) {
+	var ran []string
+	executor := newBranchingExecutor(t, &ran)
+
+	workflow := &Workflow{
+		ID: "cyclic",
+		Nodes: map[string]*WorkflowNode{
+			"a": {ID: "a", Type: "record"},
+			"b": {ID: "b", Type: "record"},
+		},
+		Edges: []WorkflowEdge{{ID: "e1", Source: "a", Target: "b"}, {ID: "e2", Source: "b", Target: "a"}},
+	}
+
+	_, err := executor.Run(context.Background(), workflow, nil)
+	require.Error(t, err)
+	assert.Empty(t, ran)
+}
+
+// scaleNode multiplies the "item" input by its configured factor
+type scaleNode struct {
+	factor float64
+}
+
+func (n *scaleNode) Initialize(config map[string]interface{}) error {
+	n.factor, _ = config["factor"].(float64)
+	return nil
+}
+func (n *scaleNode) Validate() error                 { return nil }
+func (n *scaleNode) Close() error                    { return nil }
+func (n *scaleNode) GetMetadata() types.NodeMetadata { return types.NodeMetadata{ID: "scale"} }
+
+func (n *scaleNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	value, ok := input.Data["item"].(float64)
+	if !ok {
+		value, ok = input.Data["scaled"].(float64)
+	}
+	if !ok {
+		return types.NodeOutput{Error: errors.New("missing item")}
+	}
+	return types.NodeOutput{Data: map[string]interface{}{"scaled": value * n.factor}}
+}
+
+func TestExecutorFollowsMatchedSwitchPortOnly(t *testing.T) {
+	var ran []string
+	executor := newBranchingExecutor(t, &ran)
+	switchMeta := types.NodeMetadata{ID: "switch"}
+	require.NoError(t, executor.Registry().RegisterNodeType("switch", AdaptNode(utility.NewSwitchNode, switchMeta), switchMeta))
+
+	workflow := &Workflow{
+		ID: "routing",
+		Nodes: map[string]*WorkflowNode{
+			"route": {ID: "route", Type: "switch", Config: map[string]interface{}{
+				"field":   "region",
+				"default": true,
+				"cases": []interface{}{
+					map[string]interface{}{"port": "eu", "operator": "==", "value": "eu"},
+					map[string]interface{}{"port": "us", "operator": "==", "value": "us"},
+				},
+			}},
+			"eu":       {ID: "eu", Type: "record", Config: map[string]interface{}{"name": "eu"}},
+			"us":       {ID: "us", Type: "record", Config: map[string]interface{}{"name": "us"}},
+			"fallback": {ID: "fallback", Type: "record", Config: map[string]interface{}{"name": "fallback"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "route", Target: "eu", SourceHandle: "eu"},
+			{ID: "e2", Source: "route", Target: "us", SourceHandle: "us"},
+			{ID: "e3", Source: "route", Target: "fallback", SourceHandle: utility.SwitchDefaultPort},
+		},
+	}
+
+	for region, want := range map[string]string{"eu": "eu", "us": "us", "apac": "fallback"} {
+		ran = nil
+		run, err := executor.Run(context.Background(), workflow, map[string]interface{}{"region": region})
+		require.NoError(t, err)
+		assert.Equal(t, []string{want}, ran, region)
+		for _, nodeID := range []string{"eu", "us", "fallback"} {
+			if nodeID != want {
+				assert.Equal(t, types.NodeSkipped, run.NodeResults[nodeID].Status, nodeID)
+			}
+		}
+	}
+}
+
+func TestExecutorRunsLoopBodyPerItem(t *testing.T) {
+	var ran []string
+	registry := NewNodeTypeRegistry()
+	forEachMeta := types.NodeMetadata{ID: "for_each"}
+	require.NoError(t, registry.RegisterNodeType("for_each", AdaptNode(utility.NewForEachNode, forEachMeta), forEachMeta))
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+	require.NoError(t, registry.RegisterNodeType("record", func() types.NodeInstance {
+		return &recordNode{ran: &ran}
+	}, types.NodeMetadata{ID: "record"}))
+
+	workflow := &Workflow{
+		ID: "loop",
+		Nodes: map[string]*WorkflowNode{
+			"loop": {ID: "loop", Type: "for_each", Config: map[string]interface{}{
+				"collection_key": "values", "max_concurrency": float64(2),
+			}},
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": float64(2)}},
+			"offset": {ID: "offset", Type: "scale", Config: map[string]interface{}{"factor": float64(10)}},
+			"done":   {ID: "done", Type: "record", Config: map[string]interface{}{"name": "done"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "loop", Target: "double", SourceHandle: LoopBodyHandle},
+			{ID: "e2", Source: "double", Target: "offset"},
+			{ID: "e3", Source: "loop", Target: "done"},
+		},
+	}
+
+	run, err := NewWorkflowExecutor(registry).Run(context.Background(), workflow, map[string]interface{}{
+		"values": []interface{}{float64(1), float64(2), float64(3)},
+	})
+	require.NoError(t, err)
+
+	loopOutput := run.Results["loop"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"scaled": float64(20)},
+		map[string]interface{}{"scaled": float64(40)},
+		map[string]interface{}{"scaled": float64(60)},
+	}, loopOutput["results"])
+
+	// Body nodes run inside the loop, not as part of the workflow
+	assert.NotContains(t, run.NodeResults, "double")
+	assert.NotContains(t, run.NodeResults, "offset")
+	assert.Equal(t, []string{"done"}, ran)
+}
+
+func TestExecutorRunsWhileBodyUntilConditionFails(t *testing.T) {
+	registry := NewNodeTypeRegistry()
+	whileMeta := types.NodeMetadata{ID: "while"}
+	require.NoError(t, registry.RegisterNodeType("while", AdaptNode(utility.NewWhileNode, whileMeta), whileMeta))
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+
+	workflow := &Workflow{
+		ID: "while",
+		Nodes: map[string]*WorkflowNode{
+			"loop": {ID: "loop", Type: "while", Config: map[string]interface{}{
+				"field": "scaled", "operator": "<", "value": float64(100),
+			}},
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": float64(2)}},
+		},
+		Edges: []WorkflowEdge{{ID: "e1", Source: "loop", Target: "double", SourceHandle: LoopBodyHandle}},
+	}
+
+	run, err := NewWorkflowExecutor(registry).Run(context.Background(), workflow, map[string]interface{}{"scaled": float64(3)})
+	require.NoError(t, err)
+
+	loopOutput := run.Results["loop"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"scaled": float64(192)}, loopOutput["result"])
+	assert.Equal(t, 6, loopOutput["iterations"])
+	assert.Equal(t, utility.WhileConditionFalse, loopOutput["termination_reason"])
+}
+
+func TestExecutorRejectsBodyOnNonLoopNode(t *testing.T) {
+	var ran []string
+	executor := newBranchingExecutor(t, &ran)
+
+	workflow := &Workflow{
+		ID: "bad-loop",
+		Nodes: map[string]*WorkflowNode{
+			"a": {ID: "a", Type: "record"},
+			"b": {ID: "b", Type: "record"},
+		},
+		Edges: []WorkflowEdge{{ID: "e1", Source: "a", Target: "b", SourceHandle: LoopBodyHandle}},
+	}
+
+	_, err := executor.Run(context.Background(), workflow, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not support a loop body")
+}
+
+// countingMetrics records what the executor reports
+type countingMetrics struct {
+	mu      sync.Mutex
+	started int
+	ended   []bool
+	nodes   []string
+	errors  []string
+}
+
+func (m *countingMetrics) RecordExecutionStart(workflowID, executionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started++
+}
+
+func (m *countingMetrics) RecordExecutionEnd(workflowID, executionID string, success bool, duration float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ended = append(m.ended, success)
+}
+
+func (m *countingMetrics) RecordNodeExecution(nodeType, executionID string, success bool, duration float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes = append(m.nodes, nodeType)
+}
+
+func (m *countingMetrics) RecordError(workflowID, executionID, nodeID, errorType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, errorType)
+}
+
+func TestExecutorRecordsMetrics(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{delay: time.Second, calls: &calls})
+	executor.SetTimeoutPolicy(TimeoutPolicy{NodeTimeout: 10 * time.Millisecond})
+	metrics := &countingMetrics{}
+	executor.SetMetrics(metrics)
+
+	_, err := executor.Run(context.Background(), flakyWorkflow(), nil)
+	require.Error(t, err)
+
+	assert.Equal(t, 1, metrics.started)
+	assert.Equal(t, []bool{false}, metrics.ended)
+	assert.Equal(t, []string{"flaky"}, metrics.nodes)
+	assert.Equal(t, []string{string(types.NodeTimeout)}, metrics.errors)
+}
+
+func TestExecutorRecordsRunsOfContextsWithLogger(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{calls: &calls})
+	metrics := &countingMetrics{}
+	executor.SetMetrics(metrics)
+
+	// Callers may attach their own logger; that does not make a run nested
+	ctx := ContextWithLogger(context.Background(), NewNopLogger())
+	_, err := executor.Run(ctx, flakyWorkflow(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, metrics.started)
+	assert.Equal(t, []bool{true}, metrics.ended)
+}
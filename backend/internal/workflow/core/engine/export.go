@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportFormatVersion is the version of the workflow export format written
+// by ExportWorkflow. Imports of later versions are rejected.
+const ExportFormatVersion = 1
+
+// DefaultNodeTypeVersion is the version of node types that declare none
+const DefaultNodeTypeVersion = "1.0.0"
+
+// ErrIncompatibleExport is wrapped by the errors of exports that cannot be
+// imported, such as ones using node types that are not registered
+var ErrIncompatibleExport = errors.New("incompatible workflow export")
+
+// WorkflowExport is the portable form of a workflow, shared between
+// instances
+type WorkflowExport struct {
+	FormatVersion int       `json:"format_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Workflow      *Workflow `json:"workflow"`
+	// NodeTypes maps the node types the workflow uses to the versions it
+	// was exported with. Importing instances need the same major versions.
+	NodeTypes map[string]string `json:"node_types"`
+	// Credentials are the names of the credentials the workflow refers to
+	// as {{credentials.<name>}}. Their values are not exported; importers
+	// bind each name to one of their own credentials.
+	Credentials []string `json:"credentials"`
+}
+
+// credentialName matches the names credential references can use
+var credentialName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// UnboundCredentialsError is returned by ImportWorkflow when credentials
+// the workflow refers to are not bound
+type UnboundCredentialsError struct {
+	Names []string
+}
+
+func (e *UnboundCredentialsError) Error() string {
+	return fmt.Sprintf("credentials %s must be bound", strings.Join(e.Names, ", "))
+}
+
+// nodeTypeVersion returns the version of a registered node type
+func (r *NodeTypeRegistryImpl) nodeTypeVersion(nodeType string) (string, bool) {
+	metadata, exists := r.GetNodeMetadata(nodeType)
+	if !exists {
+		return "", false
+	}
+	if metadata.Version == "" {
+		return DefaultNodeTypeVersion, true
+	}
+	return metadata.Version, true
+}
+
+// ExportWorkflow returns the export of workflow, which may only use node
+// types registered with registry
+func ExportWorkflow(registry *NodeTypeRegistryImpl, workflow *Workflow) (*WorkflowExport, error) {
+	nodeTypes := make(map[string]string)
+	for nodeID, node := range workflow.Nodes {
+		version, exists := registry.nodeTypeVersion(node.Type)
+		if !exists {
+			return nil, fmt.Errorf("node %s has unknown type %s", nodeID, node.Type)
+		}
+		nodeTypes[node.Type] = version
+	}
+
+	return &WorkflowExport{
+		FormatVersion: ExportFormatVersion,
+		ExportedAt:    time.Now().UTC(),
+		Workflow:      workflow,
+		NodeTypes:     nodeTypes,
+		Credentials:   credentialNames(workflow),
+	}, nil
+}
+
+// ImportWorkflow checks that export can run with the node types of registry,
+// at their versions or by migrating to them, and returns its workflow under
+// id, with its credential references rebound as bindings maps them, from
+// exported to local names. Every credential the workflow refers to must be
+// bound. The returned workflow shares nothing with export; its nodes keep
+// the versions they were exported with, for MigrateWorkflow to upgrade.
+func ImportWorkflow(registry *NodeTypeRegistryImpl, export *WorkflowExport, id string, bindings map[string]string) (*Workflow, error) {
+	if export.FormatVersion < 1 || export.FormatVersion > ExportFormatVersion {
+		return nil, fmt.Errorf("%w: format version %d is not supported, at most %d is", ErrIncompatibleExport, export.FormatVersion, ExportFormatVersion)
+	}
+	if export.Workflow == nil {
+		return nil, fmt.Errorf("%w: it has no workflow", ErrIncompatibleExport)
+	}
+
+	nodeIDs := make([]string, 0, len(export.Workflow.Nodes))
+	for nodeID := range export.Workflow.Nodes {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	for _, nodeID := range nodeIDs {
+		node := export.Workflow.Nodes[nodeID]
+		if node == nil {
+			return nil, fmt.Errorf("%w: node %s has no type", ErrIncompatibleExport, nodeID)
+		}
+		if _, exists := registry.nodeTypeVersion(node.Type); !exists {
+			return nil, fmt.Errorf("%w: node %s has unknown type %s", ErrIncompatibleExport, nodeID, node.Type)
+		}
+		if _, _, err := registry.migrationPath(node.Type, exportedVersion(export, node)); err != nil {
+			return nil, fmt.Errorf("%w: node %s: %v", ErrIncompatibleExport, nodeID, err)
+		}
+	}
+
+	var unbound []string
+	for _, name := range credentialNames(export.Workflow) {
+		bound := bindings[name]
+		if bound == "" {
+			unbound = append(unbound, name)
+		} else if !credentialName.MatchString(bound) {
+			return nil, fmt.Errorf("credential %s is bound to invalid name %q", name, bound)
+		}
+	}
+	if len(unbound) > 0 {
+		return nil, &UnboundCredentialsError{Names: unbound}
+	}
+
+	// Rebinding copies the configs
+	rebind := credentialRebinder(bindings)
+	workflow := &Workflow{
+		ID:    id,
+		Name:  export.Workflow.Name,
+		Nodes: make(map[string]*WorkflowNode, len(export.Workflow.Nodes)),
+		Edges: append([]WorkflowEdge(nil), export.Workflow.Edges...),
+	}
+	for i, edge := range workflow.Edges {
+		if edge.Mapping != nil {
+			workflow.Edges[i].Mapping = make(map[string]string, len(edge.Mapping))
+			for target, expr := range edge.Mapping {
+				workflow.Edges[i].Mapping[target] = expr
+			}
+		}
+	}
+	for nodeID, node := range export.Workflow.Nodes {
+		config, err := resolveCredentials(context.Background(), rebind, node.Config, nil)
+		if err != nil {
+			return nil, err
+		}
+		imported := *node
+		imported.Config = config
+		imported.Version = exportedVersion(export, node)
+		if node.Position != nil {
+			imported.Position = make(map[string]float64, len(node.Position))
+			for axis, value := range node.Position {
+				imported.Position[axis] = value
+			}
+		}
+		workflow.Nodes[nodeID] = &imported
+	}
+	return workflow, nil
+}
+
+// exportedVersion returns the version of the node type the config of node
+// was exported for
+func exportedVersion(export *WorkflowExport, node *WorkflowNode) string {
+	if node.Version != "" {
+		return node.Version
+	}
+	return export.NodeTypes[node.Type]
+}
+
+// credentialNames returns the sorted names of the credentials the node
+// configs of workflow refer to
+func credentialNames(workflow *Workflow) []string {
+	seen := make(map[string]bool)
+	collect := credentialResolverFunc(func(name string) string {
+		seen[name] = true
+		return ""
+	})
+	for _, node := range workflow.Nodes {
+		if node != nil {
+			resolveCredentials(context.Background(), collect, node.Config, nil)
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// credentialRebinder replaces credential references by references to the
+// credentials they are bound to
+func credentialRebinder(bindings map[string]string) CredentialResolver {
+	return credentialResolverFunc(func(name string) string {
+		return "{{credentials." + bindings[name] + "}}"
+	})
+}
+
+// credentialResolverFunc resolves credentials with a function
+type credentialResolverFunc func(name string) string
+
+func (f credentialResolverFunc) ResolveCredential(ctx context.Context, name string) (string, error) {
+	return f(name), nil
+}
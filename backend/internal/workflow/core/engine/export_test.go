@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportRegistry(t *testing.T, version string) *NodeTypeRegistryImpl {
+	t.Helper()
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("token", func() types.NodeInstance { return &tokenNode{} }, types.NodeMetadata{ID: "token", Version: version}))
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+	return registry
+}
+
+func TestWorkflowExportRoundTrip(t *testing.T) {
+	workflow := &Workflow{
+		ID:   "wf1",
+		Name: "sync",
+		Nodes: map[string]*WorkflowNode{
+			"call": {ID: "call", Type: "token", Config: map[string]interface{}{
+				"token":   "{{credentials.api_key}}",
+				"headers": map[string]interface{}{"X-Other": "{{ credentials.other }}"},
+			}, Position: map[string]float64{"x": 1, "y": 2}},
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": 2.0}},
+		},
+		Edges: []WorkflowEdge{{ID: "e1", Source: "call", Target: "double", Mapping: map[string]string{"item": "source.count ?? 0"}}},
+	}
+
+	export, err := ExportWorkflow(exportRegistry(t, "2.1.0"), workflow)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"token": "2.1.0", "scale": DefaultNodeTypeVersion}, export.NodeTypes)
+	assert.Equal(t, []string{"api_key", "other"}, export.Credentials)
+
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	var decoded WorkflowExport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	// Another instance with a compatible version of the node types
+	imported, err := ImportWorkflow(exportRegistry(t, "2.4.0"), &decoded, "wf2", map[string]string{"api_key": "prod_key", "other": "other"})
+	require.NoError(t, err)
+	assert.Equal(t, "wf2", imported.ID)
+	assert.Equal(t, "sync", imported.Name)
+	assert.Equal(t, "{{credentials.prod_key}}", imported.Nodes["call"].Config["token"])
+	assert.Equal(t, map[string]interface{}{"X-Other": "{{credentials.other}}"}, imported.Nodes["call"].Config["headers"])
+	assert.Equal(t, map[string]float64{"x": 1, "y": 2}, imported.Nodes["call"].Position)
+	assert.Equal(t, 2.0, imported.Nodes["double"].Config["factor"])
+	assert.Equal(t, workflow.Edges, imported.Edges)
+
+	// The import shares nothing with the export
+	imported.Nodes["call"].Position["x"] = 5
+	assert.Equal(t, 1.0, decoded.Workflow.Nodes["call"].Position["x"])
+	imported.Edges[0].Mapping["item"] = "0"
+	assert.Equal(t, "source.count ?? 0", decoded.Workflow.Edges[0].Mapping["item"])
+	assert.Equal(t, "{{credentials.api_key}}", decoded.Workflow.Nodes["call"].Config["token"])
+}
+
+func TestImportWorkflowRejectsIncompatibleExports(t *testing.T) {
+	workflow := &Workflow{ID: "wf1", Nodes: map[string]*WorkflowNode{"call": {ID: "call", Type: "token", Config: map[string]interface{}{"token": "{{credentials.api_key}}"}}}}
+	export, err := ExportWorkflow(exportRegistry(t, "1.0.0"), workflow)
+	require.NoError(t, err)
+	bindings := map[string]string{"api_key": "api_key"}
+
+	_, err = ImportWorkflow(NewNodeTypeRegistry(), export, "wf2", bindings)
+	assert.ErrorIs(t, err, ErrIncompatibleExport)
+	assert.Contains(t, err.Error(), "unknown type token")
+
+	_, err = ImportWorkflow(exportRegistry(t, "2.0.0"), export, "wf2", bindings)
+	assert.ErrorIs(t, err, ErrIncompatibleExport)
+	assert.Contains(t, err.Error(), "no migration from version 1.0.0")
+
+	_, err = ImportWorkflow(exportRegistry(t, "0.9.0"), export, "wf2", bindings)
+	assert.ErrorIs(t, err, ErrIncompatibleExport)
+	assert.Contains(t, err.Error(), "newer than version 0.9.0")
+
+	future := *export
+	future.FormatVersion = ExportFormatVersion + 1
+	_, err = ImportWorkflow(exportRegistry(t, "1.0.0"), &future, "wf2", bindings)
+	assert.ErrorIs(t, err, ErrIncompatibleExport)
+
+	_, err = ImportWorkflow(exportRegistry(t, "1.0.0"), export, "wf2", nil)
+	var unbound *UnboundCredentialsError
+	require.ErrorAs(t, err, &unbound)
+	assert.Equal(t, []string{"api_key"}, unbound.Names)
+
+	_, err = ImportWorkflow(exportRegistry(t, "1.0.0"), export, "wf2", map[string]string{"api_key": "bad name"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// BranchesInputKey is the input field fan-in nodes, such as the merge node,
+// receive their inbound branches in. It holds one entry per taken edge
+// leading to the node, in edge order, with the "source" node ID, its
+// "status" and its "output", or the "error" it failed with.
+const BranchesInputKey = "branches"
+
+// fanInNode is implemented by nodes that combine the outputs of several
+// branches, such as utility.MergeNode. Nodes run once all their
+// predecessors have, so fan-in nodes always see every branch leading to
+// them.
+type fanInNode interface {
+	// ToleratesFailedBranches reports whether the node runs when some of
+	// the branches leading to it fail, instead of failing the run
+	ToleratesFailedBranches() bool
+}
+
+// asFanInNode returns the fan-in node behind instance, looking through
+// adapters
+func asFanInNode(instance types.NodeInstance) (fanInNode, bool) {
+	if adapted, ok := instance.(*adaptedNode); ok {
+		fanIn, ok := adapted.node.(fanInNode)
+		return fanIn, ok
+	}
+	fanIn, ok := instance.(fanInNode)
+	return fanIn, ok
+}
+
+// branchResult is the entry of BranchesInputKey for the edge from source
+func branchResult(source string, output interface{}, failure *string) map[string]interface{} {
+	if failure != nil {
+		return map[string]interface{}{"source": source, "status": string(types.NodeFailed), "error": *failure}
+	}
+	return map[string]interface{}{"source": source, "status": string(types.NodeCompleted), "output": output}
+}
+
+// toleratesFailure reports whether a run goes on when nodeID fails: every
+// edge leaving it must lead to a fan-in node that tolerates failed branches
+func toleratesFailure(workflow *Workflow, instances map[string]types.NodeInstance, nodeID string) bool {
+	tolerated := false
+	for _, edge := range workflow.Edges {
+		if edge.Source != nodeID {
+			continue
+		}
+		fanIn, ok := asFanInNode(instances[edge.Target])
+		if !ok || !fanIn.ToleratesFailedBranches() {
+			return false
+		}
+		tolerated = true
+	}
+	return tolerated
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runFanIn runs a workflow in which two scale nodes, and one that fails for
+// lack of an item, are merged by a merge node with config
+func runFanIn(t *testing.T, config map[string]interface{}) (*WorkflowRun, []string, error) {
+	t.Helper()
+
+	var ran []string
+	registry := NewNodeTypeRegistry()
+	mergeMeta := types.NodeMetadata{ID: "merge"}
+	require.NoError(t, registry.RegisterNodeType("merge", AdaptNode(utility.NewMergeNode, mergeMeta), mergeMeta))
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+	require.NoError(t, registry.RegisterNodeType("output", func() types.NodeInstance { return &outputNode{} }, types.NodeMetadata{ID: "output"}))
+	require.NoError(t, registry.RegisterNodeType("record", func() types.NodeInstance { return &recordNode{ran: &ran} }, types.NodeMetadata{ID: "record"}))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	workflow := &Workflow{
+		ID: "fan-in",
+		Nodes: map[string]*WorkflowNode{
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": float64(2)}},
+			"triple": {ID: "triple", Type: "scale", Config: map[string]interface{}{"factor": float64(3)}},
+			"empty":  {ID: "empty", Type: "output", Config: map[string]interface{}{"output": map[string]interface{}{"other": true}}},
+			"broken": {ID: "broken", Type: "scale", Config: map[string]interface{}{"factor": float64(4)}},
+			"join":   {ID: "join", Type: "merge", Config: config},
+			"done":   {ID: "done", Type: "record", Config: map[string]interface{}{"name": "done"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "double", Target: "join"},
+			{ID: "e2", Source: "empty", Target: "broken"},
+			{ID: "e3", Source: "broken", Target: "join"},
+			{ID: "e4", Source: "triple", Target: "join"},
+			{ID: "e5", Source: "join", Target: "done"},
+		},
+	}
+	run, err := executor.Run(context.Background(), workflow, map[string]interface{}{"item": float64(5)})
+	return run, ran, err
+}
+
+func TestMergeNodeReceivesEveryBranch(t *testing.T) {
+	run, ran, err := runFanIn(t, map[string]interface{}{"strategy": utility.MergeAppend, "key": "scaled", "continue_on_error": true})
+	require.NoError(t, err)
+
+	join := run.Results["join"].(map[string]interface{})
+	assert.Equal(t, []interface{}{float64(10), float64(15)}, join["result"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"source": "broken", "error": "missing item"}}, join["errors"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"source": "double", "status": "completed", "output": map[string]interface{}{"scaled": float64(10)}},
+		map[string]interface{}{"source": "broken", "status": "failed", "error": "missing item"},
+		map[string]interface{}{"source": "triple", "status": "completed", "output": map[string]interface{}{"scaled": float64(15)}},
+	}, run.NodeResults["join"].InputsUsed[BranchesInputKey], "branches come in edge order")
+	assert.Equal(t, types.NodeFailed, run.NodeResults["broken"].Status)
+	assert.Equal(t, []string{"done"}, ran)
+}
+
+func TestFailedBranchFailsRunUnlessMergeContinues(t *testing.T) {
+	run, ran, err := runFanIn(t, map[string]interface{}{"strategy": utility.MergeAppend, "key": "scaled"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error executing node broken")
+	assert.NotContains(t, run.NodeResults, "join")
+	assert.Empty(t, ran)
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// graphState is the progress of a run through its graph: the outputs of the
+// nodes that ran, the edges that were taken and the nodes that failed
+type graphState struct {
+	workflow   *Workflow
+	mappings   map[int]edgeMapping
+	results    map[string]interface{}
+	takenEdges map[int]bool
+	failures   map[string]*string
+}
+
+// newGraphState starts a run of workflow. Edge mappings are parsed before
+// any node runs.
+func newGraphState(workflow *Workflow) (*graphState, error) {
+	mappings := make(map[int]edgeMapping)
+	for i, edge := range workflow.Edges {
+		if len(edge.Mapping) == 0 {
+			continue
+		}
+		mapping, err := compileEdgeMapping(edge.Mapping)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping on edge %s: %w", edge.ID, err)
+		}
+		mappings[i] = mapping
+	}
+
+	return &graphState{
+		workflow:   workflow,
+		mappings:   mappings,
+		results:    make(map[string]interface{}, len(workflow.Nodes)),
+		takenEdges: make(map[int]bool, len(workflow.Edges)),
+		failures:   make(map[string]*string),
+	}, nil
+}
+
+// input assembles the input of nodeID from the results of the edges that
+// lead to it and were taken, mapped when the edge has a mapping. Fan-in
+// nodes get them as separate branches instead, and starting nodes get the
+// inputs of the run. skip reports nodes only reachable through untaken
+// branches; mappingErr is the first mapping that failed.
+func (g *graphState) input(nodeID string, isFanIn bool, inputs map[string]interface{}) (input types.NodeInput, skip bool, mappingErr error) {
+	input = types.NodeInput{Data: make(map[string]interface{})}
+
+	incoming, taken := 0, 0
+	mapped := false
+	var branches []interface{}
+	for i, edge := range g.workflow.Edges {
+		if edge.Target != nodeID {
+			continue
+		}
+		incoming++
+		if !g.takenEdges[i] {
+			continue
+		}
+		taken++
+
+		// Only fan-in nodes are reached from nodes that failed
+		if failure, failed := g.failures[edge.Source]; failed {
+			branches = append(branches, branchResult(edge.Source, nil, failure))
+			continue
+		}
+
+		// Merge the results from source nodes
+		sourceResult := g.results[edge.Source]
+		if mapping, ok := g.mappings[i]; ok {
+			fields, err := mapping.apply(sourceResult)
+			if err != nil && mappingErr == nil {
+				mappingErr = fmt.Errorf("edge %s: %w", edge.ID, err)
+			}
+			sourceResult, mapped = fields, true
+		}
+		if isFanIn {
+			branches = append(branches, branchResult(edge.Source, sourceResult, nil))
+			continue
+		}
+		if sourceMap, ok := sourceResult.(map[string]interface{}); ok {
+			for k, v := range sourceMap {
+				input.Data[k] = v
+			}
+		} else if sourceResult != nil {
+			// If source result is not a map, store under a default key
+			input.Data["result"] = sourceResult
+		}
+	}
+
+	if incoming > 0 && taken == 0 {
+		return input, true, nil
+	}
+
+	if isFanIn && taken > 0 {
+		input.Data = map[string]interface{}{BranchesInputKey: branches}
+	}
+
+	// If this is a starting node, use provided inputs
+	if len(input.Data) == 0 && !mapped {
+		input.Data = inputs
+	}
+	return input, false, mappingErr
+}
+
+// complete records the output of nodeID and follows the edges leaving the
+// output port it selected
+func (g *graphState) complete(nodeID string, output map[string]interface{}) {
+	g.results[nodeID] = output
+	takeEdges(g.workflow, g.takenEdges, nodeID, output)
+}
+
+// fail records that nodeID failed with message. All its edges are followed,
+// so that the fan-in nodes they lead to see the failed branch.
+func (g *graphState) fail(nodeID, message string) {
+	g.failures[nodeID] = &message
+	for i, edge := range g.workflow.Edges {
+		if edge.Source == nodeID {
+			g.takenEdges[i] = true
+		}
+	}
+}
+
+// initializeNode creates the instance of nodeID, migrating its config and
+// resolving its credentials. Loop nodes are given their body from bodies
+// and prompt nodes ask through the interaction manager.
+func (we *WorkflowExecutor) initializeNode(ctx context.Context, workflow *Workflow, nodeID string, bodies map[string]*Workflow, tracker *executionTracker, redact *redactor, logger Logger) (types.NodeInstance, error) {
+	we.mu.Lock()
+	credentials := we.credentials
+	we.mu.Unlock()
+
+	node := workflow.Nodes[nodeID]
+	creator, exists := we.registry.GetNodeType(node.Type)
+	if !exists {
+		return nil, fmt.Errorf("unknown node type: %s", node.Type)
+	}
+
+	// Configs written for an older version of the node type are
+	// migrated, and credential references resolved, into a copy
+	config, _, migrations, err := we.registry.migrateNode(nodeID, node)
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range migrations {
+		logger.Debug("Migrated node config", map[string]interface{}{LogFieldNodeID: nodeID, "from": migration.From, "to": migration.To})
+	}
+	config, err = resolveCredentials(ctx, credentials, config, redact)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure node %s: %w", nodeID, err)
+	}
+
+	instance := creator()
+	if err := instance.Initialize(config); err != nil {
+		return nil, fmt.Errorf("failed to initialize node %s: %v", nodeID, err)
+	}
+
+	if err := instance.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration for node %s: %v", nodeID, err)
+	}
+
+	if body, ok := bodies[nodeID]; ok {
+		loop, ok := asLoopNode(instance)
+		if !ok {
+			return nil, fmt.Errorf("node %s of type %s does not support a loop body", nodeID, node.Type)
+		}
+		loop.SetIterationFunc(we.iterationFunc(body))
+	}
+	if prompt, ok := asPromptNode(instance); ok {
+		prompt.SetPromptFunc(we.promptFunc(tracker, workflow.ID, nodeID))
+	}
+	return instance, nil
+}
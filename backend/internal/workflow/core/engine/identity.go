@@ -0,0 +1,33 @@
+package engine
+
+import "context"
+
+type userIDContextKey struct{}
+
+type executionIDContextKey struct{}
+
+// ContextWithUserID returns a context carrying the ID of the user a run is
+// started for, which nodes such as the AI nodes hold to their quotas
+func ContextWithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDContextKey{}, userID)
+}
+
+// UserIDFromContext returns the user ID carried by ctx, or "" for runs not
+// started by a user
+func UserIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDContextKey{}).(string)
+	return userID
+}
+
+// contextWithExecutionID returns a context carrying the ID of the persisted
+// execution its nodes run in
+func contextWithExecutionID(ctx context.Context, executionID string) context.Context {
+	return context.WithValue(ctx, executionIDContextKey{}, executionID)
+}
+
+// ExecutionIDFromContext returns the ID of the execution a node runs in, or
+// "" when the run is not persisted
+func ExecutionIDFromContext(ctx context.Context) string {
+	executionID, _ := ctx.Value(executionIDContextKey{}).(string)
+	return executionID
+}
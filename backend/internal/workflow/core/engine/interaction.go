@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// ErrPromptNotFound is returned when responding to a prompt that is unknown
+// or was already answered
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// Prompt is a question a running node puts to a person, such as an
+// approval step
+type Prompt struct {
+	ID          string    `json:"id"`
+	ExecutionID string    `json:"execution_id"`
+	WorkflowID  string    `json:"workflow_id"`
+	NodeID      string    `json:"node_id"`
+	Message     string    `json:"message"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PromptFunc asks a person to respond to message and waits for the answer
+// or for ctx to be done
+type PromptFunc = func(ctx context.Context, message string) (types.PromptResponse, error)
+
+// promptNode is implemented by nodes that wait for a person, such as
+// utility.ApprovalNode
+type promptNode interface {
+	SetPromptFunc(fn PromptFunc)
+}
+
+// asPromptNode returns the prompt node behind instance, looking through
+// adapters
+func asPromptNode(instance types.NodeInstance) (promptNode, bool) {
+	if adapted, ok := instance.(*adaptedNode); ok {
+		prompt, ok := adapted.node.(promptNode)
+		return prompt, ok
+	}
+	prompt, ok := instance.(promptNode)
+	return prompt, ok
+}
+
+// InteractionManager holds the prompts of running executions until someone
+// responds to them. Each new prompt is announced on the event bus as an
+// EventPromptRequested event.
+type InteractionManager struct {
+	events  *EventBus
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]*pendingPrompt
+}
+
+type pendingPrompt struct {
+	prompt   Prompt
+	response chan types.PromptResponse
+}
+
+// NewInteractionManager creates a manager announcing prompts on events
+func NewInteractionManager(events *EventBus) *InteractionManager {
+	return &InteractionManager{
+		events:  events,
+		pending: make(map[string]*pendingPrompt),
+	}
+}
+
+// Ask registers prompt and waits until it is answered or ctx is done. The
+// prompt's ID and creation time are assigned here.
+func (m *InteractionManager) Ask(ctx context.Context, prompt Prompt) (types.PromptResponse, error) {
+	m.mu.Lock()
+	m.nextID++
+	prompt.ID = fmt.Sprintf("prompt_%d", m.nextID)
+	prompt.CreatedAt = time.Now()
+	pending := &pendingPrompt{prompt: prompt, response: make(chan types.PromptResponse, 1)}
+	m.pending[prompt.ID] = pending
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, prompt.ID)
+		m.mu.Unlock()
+	}()
+
+	m.events.Publish(PromptEvent(prompt))
+
+	select {
+	case response := <-pending.response:
+		return response, nil
+	case <-ctx.Done():
+		return types.PromptResponse{}, ctx.Err()
+	}
+}
+
+// Respond answers a pending prompt
+func (m *InteractionManager) Respond(promptID string, response types.PromptResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending, ok := m.pending[promptID]
+	if !ok {
+		return ErrPromptNotFound
+	}
+	delete(m.pending, promptID)
+	pending.response <- response
+	return nil
+}
+
+// Pending returns the unanswered prompts of an execution, oldest first
+func (m *InteractionManager) Pending(executionID string) []Prompt {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var prompts []Prompt
+	for _, pending := range m.pending {
+		if pending.prompt.ExecutionID == executionID {
+			prompts = append(prompts, pending.prompt)
+		}
+	}
+	sort.Slice(prompts, func(i, j int) bool {
+		return prompts[i].CreatedAt.Before(prompts[j].CreatedAt)
+	})
+	return prompts
+}
+
+// PromptEvent returns the EventPromptRequested event announcing a prompt,
+// also for subscribers that missed the announcement
+func PromptEvent(prompt Prompt) ExecutionEvent {
+	return ExecutionEvent{
+		Type:        EventPromptRequested,
+		ExecutionID: prompt.ExecutionID,
+		WorkflowID:  prompt.WorkflowID,
+		NodeID:      prompt.NodeID,
+		PromptID:    prompt.ID,
+		Message:     prompt.Message,
+		Timestamp:   prompt.CreatedAt,
+	}
+}
+
+// Interactions returns the manager holding the prompts of running
+// executions
+func (we *WorkflowExecutor) Interactions() *InteractionManager {
+	return we.interactions
+}
+
+// promptFunc returns the prompt function of a node of the run tracked by
+// tracker. Prompts need an execution ID to be answered, so runs without an
+// execution store cannot prompt.
+func (we *WorkflowExecutor) promptFunc(tracker *executionTracker, workflowID, nodeID string) PromptFunc {
+	return func(ctx context.Context, message string) (types.PromptResponse, error) {
+		if tracker == nil {
+			return types.PromptResponse{}, fmt.Errorf("prompts require execution persistence")
+		}
+		return we.interactions.Ask(ctx, Prompt{
+			ExecutionID: tracker.id(),
+			WorkflowID:  workflowID,
+			NodeID:      nodeID,
+			Message:     message,
+		})
+	}
+}
@@ -6,74 +6,31 @@ import (
 	"citadel-agent/backend/internal/workflow/core/types"
 )
 
-// Storage interface for storing and retrieving workflow data
+// Storage persists the engine's workflows, executions and node outputs.
+// It extends ExecutionStore, so a Storage can also be given to
+// WorkflowExecutor.SetExecutionStore to make executions resumable.
 type Storage interface {
-	// Execution operations
-	CreateExecution(execution *types.Execution) error
-	UpdateExecution(execution *types.Execution) error
-	GetExecution(id string) (*types.Execution, error)
-	DeleteExecution(id string) error
-	ListExecutions(workflowID string, limit, offset int) ([]*types.Execution, error)
-	GetExecutionHistory(workflowID string, limit, offset int) ([]*types.Execution, error)
-	GetLastExecution(workflowID string) (*types.Execution, error)
-	GetRecentExecutions(limit int) ([]*types.Execution, error)
-	GetExecutionCount(workflowID string) (int64, error)
-	GetExecutionCountByStatus(workflowID string, status types.ExecutionStatus) (int64, error)
-
-	// Node result operations
-	CreateNodeResult(result *types.NodeResult) error
-	UpdateNodeResult(result *types.NodeResult) error
-	GetNodeResult(executionID, nodeID string) (*types.NodeResult, error)
-	GetNodeResults(executionID string) (map[string]*types.NodeResult, error) // Get all node results for an execution
-	DeleteNodeResult(id string) error
-	ListNodeResults(executionID string, limit, offset int) ([]*types.NodeResult, error)
-
-	// Workflow operations
-	CreateWorkflow(workflow *types.Workflow) error
-	UpdateWorkflow(workflow *types.Workflow) error
-	GetWorkflow(id string) (*types.Workflow, error)
-	DeleteWorkflow(id string) error
-	ListWorkflows(limit, offset int) ([]*types.Workflow, error)
-	GetWorkflowByName(name string) (*types.Workflow, error)
-
-	// Variable operations
-	GetVariable(executionID, key string) (interface{}, error)
-	SetVariable(executionID, key string, value interface{}) error
-	DeleteVariable(executionID, key string) error
-
-	// Statistics operations
-	GetWorkflowStatistics(workflowID string) (*types.WorkflowStatistics, error)
-	GetExecutionStatistics(from, to string) (*types.WorkflowStatistics, error)
-	GetNodeExecutionStats(nodeType string) (*types.WorkflowStatistics, error)
-
-	// Cleanup operations
-	CleanupExecutions(olderThanDays int) error
-	CleanupNodeResults(olderThanDays int) error
-	CleanupVariables(olderThanDays int) error
-
-	// Batch operations
-	BatchCreateExecutions(executions []*types.Execution) error
-	BatchUpdateExecutions(executions []*types.Execution) error
-	BatchDeleteExecutions(executionIDs []string) error
-
-	// Index operations (for performance)
-	IndexExecutionByStatus(status types.ExecutionStatus, workflowID string) error
-	IndexExecutionByDate(dateRange string) error
-	IndexExecutionByTrigger(triggerType string) error
-
-	// Transaction support
-	BeginTransaction() (Tx, error)
-	InTransaction(fn func(Tx) error) error
-
-	// Health check
-	HealthCheck() error
-}
-
-// Tx represents a database transaction
-type Tx interface {
-	Storage
-	Commit() error
-	Rollback() error
+	ExecutionStore
+
+	// GetExecution returns an execution with its node results
+	GetExecution(ctx context.Context, id string) (*types.Execution, error)
+
+	// ListExecutions returns executions of a workflow, newest first, without
+	// their node results. An empty workflowID lists executions of all workflows.
+	ListExecutions(ctx context.Context, workflowID string, limit, offset int) ([]*types.Execution, error)
+
+	// SaveWorkflow creates the workflow when its ID is empty, assigning one,
+	// and otherwise updates the stored workflow with that ID
+	SaveWorkflow(ctx context.Context, workflow *types.Workflow) error
+
+	// GetWorkflow returns a workflow by ID
+	GetWorkflow(ctx context.Context, id string) (*types.Workflow, error)
+
+	// ListWorkflows returns workflows ordered by ID
+	ListWorkflows(ctx context.Context, limit, offset int) ([]*types.Workflow, error)
+
+	// DeleteWorkflow removes a workflow together with its executions
+	DeleteWorkflow(ctx context.Context, id string) error
 }
 
 // RetryManager manages retry logic for failed operations
@@ -88,6 +45,10 @@ type Logger interface {
 	Info(msg string, fields ...map[string]interface{})
 	Warn(msg string, fields ...map[string]interface{})
 	Error(msg string, fields ...map[string]interface{})
+
+	// With returns a logger that adds fields to every record, such as the
+	// workflow, execution and node a record belongs to
+	With(fields map[string]interface{}) Logger
 }
 
 // Scheduler interface for scheduling jobs
@@ -138,12 +99,17 @@ type ResourceLimiter interface {
 	GetResourceQuota(userID, resourceType string) (int64, error)
 }
 
-// MetricsCollector interface for collecting workflow metrics
-type MetricsCollector interface {
+// ExecutionMetrics records execution telemetry; durations are in seconds
+type ExecutionMetrics interface {
 	RecordExecutionStart(workflowID, executionID string)
 	RecordExecutionEnd(workflowID, executionID string, success bool, duration float64)
 	RecordNodeExecution(nodeType, executionID string, success bool, duration float64)
 	RecordError(workflowID, executionID, nodeID, errorType string)
+}
+
+// MetricsCollector interface for collecting workflow metrics
+type MetricsCollector interface {
+	ExecutionMetrics
 	GetWorkflowMetrics(workflowID string) *WorkflowMetrics
 	GetSystemMetrics() *SystemMetrics
 }
@@ -21,6 +21,7 @@ const (
 type BasicLogger struct {
 	level   LogLevel
 	logger  *log.Logger
+	fields  map[string]interface{}
 }
 
 // NewBasicLogger creates a new basic logger instance
@@ -31,6 +32,18 @@ func NewBasicLogger(level LogLevel) *BasicLogger {
 	}
 }
 
+// With returns a logger that adds fields to every message
+func (bl *BasicLogger) With(fields map[string]interface{}) Logger {
+	merged := make(map[string]interface{}, len(bl.fields)+len(fields))
+	for k, v := range bl.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &BasicLogger{level: bl.level, logger: bl.logger, fields: merged}
+}
+
 // Debug logs a debug message
 func (bl *BasicLogger) Debug(msg string, fields ...map[string]interface{}) {
 	if bl.level > DebugLevel {
@@ -69,8 +82,11 @@ func (bl *BasicLogger) logMessage(level LogLevel, msg string, fields ...map[stri
 	levelStr := bl.levelToString(level)
 
 	fieldStr := ""
-	if len(fields) > 0 {
+	if len(fields) > 0 || len(bl.fields) > 0 {
 		combinedFields := make(map[string]interface{})
+		for k, v := range bl.fields {
+			combinedFields[k] = v
+		}
 		for _, fieldMap := range fields {
 			for k, v := range fieldMap {
 				combinedFields[k] = v
@@ -97,4 +113,18 @@ func (bl *BasicLogger) levelToString(level LogLevel) string {
 	default:
 		return "UNKNOWN"
 	}
-}
\ No newline at end of file
+}
+
+// nopLogger discards all messages
+type nopLogger struct{}
+
+// NewNopLogger returns a logger that discards all messages
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, fields ...map[string]interface{}) {}
+func (nopLogger) Info(msg string, fields ...map[string]interface{})  {}
+func (nopLogger) Warn(msg string, fields ...map[string]interface{})  {}
+func (nopLogger) Error(msg string, fields ...map[string]interface{}) {}
+func (l nopLogger) With(fields map[string]interface{}) Logger        { return l }
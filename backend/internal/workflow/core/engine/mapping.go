@@ -0,0 +1,454 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MappingSource is the name mapping expressions refer to the output of the
+// source node of their edge by
+const MappingSource = "source"
+
+// edgeMapping is a compiled WorkflowEdge.Mapping. Edge mappings build the
+// input an edge gives its target from the output of its source. Their keys
+// are the fields of the input to set, as dot separated paths such as
+// "user.id", optionally prefixed with "target.". Their values are
+// expressions made of:
+//
+//   - references to the source output, such as source.user.id or
+//     source.items[0].name; source alone is the whole output
+//   - literals: numbers, 'single' or "double" quoted strings, true, false
+//     and null
+//   - the arithmetic operators + - * / on numbers, and + on strings, which
+//     concatenates them with the other operand
+//   - a ?? b, which is b when a is missing or null
+//
+// Fields whose expression refers to a missing part of the output are left
+// unset, unless a ?? default applies. Arithmetic on missing values fails.
+type edgeMapping []fieldMapping
+
+type fieldMapping struct {
+	target []string
+	expr   mappingExpr
+}
+
+// ValidateEdgeMapping checks the syntax of an edge mapping
+func ValidateEdgeMapping(mapping map[string]string) error {
+	_, err := compileEdgeMapping(mapping)
+	return err
+}
+
+// compileEdgeMapping parses an edge mapping. Fields are set in the order of
+// their paths, so that "user" is set before "user.id".
+func compileEdgeMapping(mapping map[string]string) (edgeMapping, error) {
+	targets := make([]string, 0, len(mapping))
+	for target := range mapping {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	compiled := make(edgeMapping, 0, len(mapping))
+	for _, target := range targets {
+		path := strings.Split(strings.TrimPrefix(target, "target."), ".")
+		for _, key := range path {
+			if key == "" {
+				return nil, fmt.Errorf("invalid mapping target %q", target)
+			}
+		}
+		expr, err := parseMappingExpr(mapping[target])
+		if err != nil {
+			return nil, fmt.Errorf("mapping of %s: %w", target, err)
+		}
+		compiled = append(compiled, fieldMapping{target: path, expr: expr})
+	}
+	return compiled, nil
+}
+
+// apply returns the input built from the output of the source node
+func (m edgeMapping) apply(source interface{}) (map[string]interface{}, error) {
+	input := make(map[string]interface{}, len(m))
+	for _, field := range m {
+		value, err := field.expr.eval(source)
+		if err != nil {
+			return nil, fmt.Errorf("mapping of %s: %w", strings.Join(field.target, "."), err)
+		}
+		if value == missing {
+			continue
+		}
+
+		parent := input
+		for _, key := range field.target[:len(field.target)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[key]; exists {
+					return nil, fmt.Errorf("mapping of %s: %s is not an object", strings.Join(field.target, "."), key)
+				}
+				child = make(map[string]interface{})
+				parent[key] = child
+			}
+			parent = child
+		}
+		parent[field.target[len(field.target)-1]] = value
+	}
+	return input, nil
+}
+
+// missing is the value of references to parts of the output that do not
+// exist, as opposed to ones that are null
+var missing = &struct{ name string }{"missing"}
+
+// mappingExpr is a parsed mapping expression
+type mappingExpr interface {
+	eval(source interface{}) (interface{}, error)
+}
+
+type literalExpr struct{ value interface{} }
+
+func (e literalExpr) eval(source interface{}) (interface{}, error) { return e.value, nil }
+
+// referenceExpr selects part of the source output by keys and indexes
+type referenceExpr struct {
+	path []interface{}
+}
+
+func (e referenceExpr) eval(source interface{}) (interface{}, error) {
+	value := source
+	for _, step := range e.path {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return missing, nil
+			}
+			if value, ok = object[step]; !ok {
+				return missing, nil
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok || step >= len(array) {
+				return missing, nil
+			}
+			value = array[step]
+		}
+	}
+	return value, nil
+}
+
+type negateExpr struct{ operand mappingExpr }
+
+func (e negateExpr) eval(source interface{}) (interface{}, error) {
+	value, err := e.operand.eval(source)
+	if err != nil {
+		return nil, err
+	}
+	number, ok := toNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", describeValue(value))
+	}
+	return -number, nil
+}
+
+type binaryExpr struct {
+	op          string
+	left, right mappingExpr
+}
+
+func (e binaryExpr) eval(source interface{}) (interface{}, error) {
+	left, err := e.left.eval(source)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "??" {
+		if left != missing && left != nil {
+			return left, nil
+		}
+		return e.right.eval(source)
+	}
+	right, err := e.right.eval(source)
+	if err != nil {
+		return nil, err
+	}
+	if left == missing || right == missing {
+		return nil, fmt.Errorf("%s applied to a missing value", e.op)
+	}
+
+	if e.op == "+" {
+		leftString, leftIsString := left.(string)
+		rightString, rightIsString := right.(string)
+		if leftIsString || rightIsString {
+			if !leftIsString {
+				leftString = fmt.Sprint(left)
+			}
+			if !rightIsString {
+				rightString = fmt.Sprint(right)
+			}
+			return leftString + rightString, nil
+		}
+	}
+
+	x, ok := toNumber(left)
+	y, ok2 := toNumber(right)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", e.op, describeValue(left), describeValue(right))
+	}
+	switch e.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	default:
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	}
+}
+
+// toNumber converts the numbers nodes output to float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	}
+	if value == missing {
+		return "a missing value"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// mappingParser parses mapping expressions by recursive descent
+type mappingParser struct {
+	text string
+	pos  int
+}
+
+func parseMappingExpr(text string) (mappingExpr, error) {
+	p := &mappingParser{text: text}
+	expr, err := p.coalesce()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.text) {
+		return nil, fmt.Errorf("unexpected %q at offset %d of %q", p.text[p.pos:], p.pos, text)
+	}
+	return expr, nil
+}
+
+func (p *mappingParser) skipSpace() {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume skips token if it comes next
+func (p *mappingParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.text[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *mappingParser) coalesce() (mappingExpr, error) {
+	return p.binary([]string{"??"}, p.additive)
+}
+
+func (p *mappingParser) additive() (mappingExpr, error) {
+	return p.binary([]string{"+", "-"}, p.multiplicative)
+}
+
+func (p *mappingParser) multiplicative() (mappingExpr, error) {
+	return p.binary([]string{"*", "/"}, p.unary)
+}
+
+// binary parses operands joined by left-associative operators
+func (p *mappingParser) binary(ops []string, operand func() (mappingExpr, error)) (mappingExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range ops {
+			if p.consume(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *mappingParser) unary() (mappingExpr, error) {
+	if p.consume("-") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *mappingParser) primary() (mappingExpr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return nil, fmt.Errorf("unexpected end of %q", p.text)
+	}
+
+	switch c := p.text[p.pos]; {
+	case c == '(':
+		p.pos++
+		expr, err := p.coalesce()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) in %q", p.text)
+		}
+		return expr, nil
+	case c == '"' || c == '\'':
+		value, err := p.quoted(c)
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr{value: value}, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.text) && (p.text[p.pos] >= '0' && p.text[p.pos] <= '9' || p.text[p.pos] == '.') {
+			p.pos++
+		}
+		number, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.text[start:p.pos])
+		}
+		return literalExpr{value: number}, nil
+	}
+
+	word := p.identifier()
+	switch word {
+	case "true":
+		return literalExpr{value: true}, nil
+	case "false":
+		return literalExpr{value: false}, nil
+	case "null":
+		return literalExpr{value: nil}, nil
+	case MappingSource:
+		return p.reference()
+	case "":
+		return nil, fmt.Errorf("unexpected %q at offset %d of %q", p.text[p.pos:], p.pos, p.text)
+	}
+	return nil, fmt.Errorf("unknown name %q in %q; references start with %s", word, p.text, MappingSource)
+}
+
+// reference parses the keys and indexes following source
+func (p *mappingParser) reference() (mappingExpr, error) {
+	var path []interface{}
+	for p.pos < len(p.text) {
+		switch p.text[p.pos] {
+		case '.':
+			p.pos++
+			key := p.identifier()
+			if key == "" {
+				return nil, fmt.Errorf("missing key after . in %q", p.text)
+			}
+			path = append(path, key)
+			continue
+		case '[':
+			p.pos++
+			p.skipSpace()
+			if p.pos < len(p.text) && (p.text[p.pos] == '"' || p.text[p.pos] == '\'') {
+				key, err := p.quoted(p.text[p.pos])
+				if err != nil {
+					return nil, err
+				}
+				path = append(path, key)
+			} else {
+				digits := p.pos
+				for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+					p.pos++
+				}
+				index, err := strconv.Atoi(p.text[digits:p.pos])
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in %q", p.text)
+				}
+				path = append(path, index)
+			}
+			if !p.consume("]") {
+				return nil, fmt.Errorf("missing ] in %q", p.text)
+			}
+			continue
+		}
+		break
+	}
+	return referenceExpr{path: path}, nil
+}
+
+func (p *mappingParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := rune(p.text[p.pos])
+		if c != '_' && !unicode.IsLetter(c) && !(p.pos > start && unicode.IsDigit(c)) {
+			break
+		}
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// quoted parses a string literal delimited by quote, in which backslashes
+// escape the next character
+func (p *mappingParser) quoted(quote byte) (string, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.text); p.pos++ {
+		switch c := p.text[p.pos]; c {
+		case '\\':
+			if p.pos++; p.pos < len(p.text) {
+				b.WriteByte(p.text[p.pos])
+			}
+		case quote:
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string in %q", p.text)
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outputNode returns the output of its config
+type outputNode struct {
+	output map[string]interface{}
+}
+
+func (n *outputNode) Initialize(config map[string]interface{}) error {
+	n.output, _ = config["output"].(map[string]interface{})
+	return nil
+}
+func (n *outputNode) Validate() error                 { return nil }
+func (n *outputNode) Close() error                    { return nil }
+func (n *outputNode) GetMetadata() types.NodeMetadata { return types.NodeMetadata{ID: "output"} }
+
+func (n *outputNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	return types.NodeOutput{Data: n.output}
+}
+
+// runMapped runs a workflow in which the output of a user lookup is mapped
+// to the input of a record node, and returns the run and what ran
+func runMapped(t *testing.T, mapping map[string]string) (*WorkflowRun, []string, error) {
+	t.Helper()
+
+	var ran []string
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("output", func() types.NodeInstance { return &outputNode{} }, types.NodeMetadata{ID: "output"}))
+	require.NoError(t, registry.RegisterNodeType("record", func() types.NodeInstance { return &recordNode{ran: &ran} }, types.NodeMetadata{ID: "record"}))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	workflow := &Workflow{
+		ID: "mapped",
+		Nodes: map[string]*WorkflowNode{
+			"lookup": {ID: "lookup", Type: "output", Config: map[string]interface{}{"output": map[string]interface{}{
+				"user":  map[string]interface{}{"id": float64(7), "name": "Ada", "country": nil},
+				"items": []interface{}{map[string]interface{}{"sku": "A-1"}},
+			}}},
+			"notify": {ID: "notify", Type: "record", Config: map[string]interface{}{"name": "notify"}},
+		},
+		Edges: []WorkflowEdge{{ID: "e1", Source: "lookup", Target: "notify", Mapping: mapping}},
+	}
+	run, err := executor.Run(context.Background(), workflow, map[string]interface{}{"trigger": "manual"})
+	return run, ran, err
+}
+
+func TestEdgeMappingRemapsFields(t *testing.T) {
+	run, _, err := runMapped(t, map[string]string{
+		"userId":               "source.user.id",
+		"target.customer.name": "source.user.name",
+		"customer.tier":        "source['user'][\"id\"] * 2 + 1",
+		"firstSku":             "source.items[0].sku",
+		"user":                 "source.user",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"userId":   float64(7),
+		"customer": map[string]interface{}{"name": "Ada", "tier": float64(15)},
+		"firstSku": "A-1",
+		"user":     map[string]interface{}{"id": float64(7), "name": "Ada", "country": nil},
+	}, run.NodeResults["notify"].InputsUsed)
+}
+
+func TestEdgeMappingInjectsLiterals(t *testing.T) {
+	run, _, err := runMapped(t, map[string]string{
+		"channel":  "'email'",
+		"subject":  `"Order \"shipped\""`,
+		"retries":  "3",
+		"delay":    "-1.5",
+		"urgent":   "true",
+		"cc":       "null",
+		"greeting": "'Hello, ' + source.user.name + ' #' + source.user.id",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"channel":  "email",
+		"subject":  `Order "shipped"`,
+		"retries":  float64(3),
+		"delay":    float64(-1.5),
+		"urgent":   true,
+		"cc":       nil,
+		"greeting": "Hello, Ada #7",
+	}, run.NodeResults["notify"].InputsUsed)
+}
+
+func TestEdgeMappingHandlesMissingSources(t *testing.T) {
+	run, ran, err := runMapped(t, map[string]string{
+		"phone":   "source.user.phone",
+		"zip":     "source.address.zip",
+		"sku":     "source.items[3].sku",
+		"country": "source.user.country ?? 'NL'",
+		"contact": "source.user.phone ?? source.user.name",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notify"}, ran)
+	assert.Equal(t, map[string]interface{}{"country": "NL", "contact": "Ada"}, run.NodeResults["notify"].InputsUsed,
+		"missing fields are left unset, and mapped nodes do not get the workflow inputs")
+
+	// Computing with missing values fails the target node
+	run, ran, err = runMapped(t, map[string]string{"total": "source.order.total * 2"})
+	require.Error(t, err)
+	assert.Empty(t, ran)
+	assert.Equal(t, nodeerrors.CodeValidation, nodeerrors.CodeOf(err))
+	assert.Contains(t, err.Error(), "edge e1: mapping of total: * applied to a missing value")
+	assert.Equal(t, types.NodeFailed, run.NodeResults["notify"].Status)
+}
+
+func TestEdgeMappingsAreParsedBeforeRunning(t *testing.T) {
+	for _, expr := range []string{"", "source.", "user.id", "'open", "source.user +", "(1 + 2", "source.items[x]", "1 2"} {
+		assert.Error(t, ValidateEdgeMapping(map[string]string{"field": expr}), expr)
+	}
+	assert.Error(t, ValidateEdgeMapping(map[string]string{"user..id": "1"}))
+	assert.NoError(t, ValidateEdgeMapping(map[string]string{"a.b": "(source.x ?? 0) / 2 - -1", "c": "source"}))
+
+	run, ran, err := runMapped(t, map[string]string{"userId": "user.id"})
+	require.Error(t, err)
+	assert.Nil(t, run)
+	assert.Empty(t, ran)
+	assert.Contains(t, err.Error(), `invalid mapping on edge e1: mapping of userId: unknown name "user"`)
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNodeVersionUnsupported is wrapped by the errors of nodes written for a
+// version of their type the server cannot run, either because it is newer
+// than the registered one or because no migration leads from it
+var ErrNodeVersionUnsupported = errors.New("unsupported node version")
+
+// NodeMigration upgrades the config of a node type written for version From
+// to version To. Migrate gets a copy of the config it may modify.
+type NodeMigration struct {
+	From    string
+	To      string
+	Migrate func(config map[string]interface{}) (map[string]interface{}, error)
+}
+
+// MigrationRecord is a migration that ran on a node of a loaded workflow
+type MigrationRecord struct {
+	NodeID   string `json:"node_id"`
+	NodeType string `json:"node_type"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+// RegisterMigration registers a migration of the configs of nodeType. Node
+// types changing the shape of their config in a new major version register
+// one from each earlier version they can upgrade.
+func (r *NodeTypeRegistryImpl) RegisterMigration(nodeType string, migration NodeMigration) error {
+	if migration.Migrate == nil {
+		return fmt.Errorf("migration of %s from %s has no function", nodeType, migration.From)
+	}
+	if compareVersions(migration.From, migration.To) >= 0 {
+		return fmt.Errorf("migration of %s must go to a later version than %s, not %s", nodeType, migration.From, migration.To)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.migrations[nodeType] {
+		if compareVersions(existing.From, migration.From) == 0 {
+			return fmt.Errorf("migration of %s from %s already registered", nodeType, migration.From)
+		}
+	}
+	r.migrations[nodeType] = append(r.migrations[nodeType], migration)
+	return nil
+}
+
+// migrationPath returns the migrations taking configs of nodeType written
+// for version to the registered version of the type, which it returns too.
+// Versions of the same major version as the registered one need no
+// migration. Unregistered types have no path and no version.
+func (r *NodeTypeRegistryImpl) migrationPath(nodeType, version string) ([]NodeMigration, string, error) {
+	current, exists := r.nodeTypeVersion(nodeType)
+	if !exists {
+		return nil, "", nil
+	}
+	if version == "" {
+		version = DefaultNodeTypeVersion
+	}
+	if compareVersions(version, current) > 0 {
+		return nil, "", fmt.Errorf("%w: node type %s is written for version %s, newer than version %s of this server", ErrNodeVersionUnsupported, nodeType, version, current)
+	}
+
+	r.mu.RLock()
+	migrations := r.migrations[nodeType]
+	r.mu.RUnlock()
+
+	var path []NodeMigration
+	for compareVersions(version, current) < 0 {
+		next := -1
+		for i, migration := range migrations {
+			if compareVersions(migration.From, version) == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			if majorVersion(version) == majorVersion(current) {
+				break
+			}
+			return nil, "", fmt.Errorf("%w: node type %s has no migration from version %s to version %s", ErrNodeVersionUnsupported, nodeType, version, current)
+		}
+		path = append(path, migrations[next])
+		version = migrations[next].To
+	}
+	return path, current, nil
+}
+
+// migrateNode returns the config of node upgraded to the registered version
+// of its type, that version, and the migrations that ran. The node itself
+// is left untouched.
+func (r *NodeTypeRegistryImpl) migrateNode(nodeID string, node *WorkflowNode) (map[string]interface{}, string, []MigrationRecord, error) {
+	path, current, err := r.migrationPath(node.Type, node.Version)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("node %s: %w", nodeID, err)
+	}
+	if current == "" {
+		current = node.Version
+	}
+
+	config := node.Config
+	var records []MigrationRecord
+	for _, migration := range path {
+		migrated, err := migration.Migrate(copyConfig(config))
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("node %s: failed to migrate %s from version %s to %s: %w", nodeID, node.Type, migration.From, migration.To, err)
+		}
+		config = migrated
+		records = append(records, MigrationRecord{NodeID: nodeID, NodeType: node.Type, From: migration.From, To: migration.To})
+	}
+	return config, current, records, nil
+}
+
+// MigrateWorkflow upgrades the configs of the nodes of workflow to the
+// registered versions of their types, as when it is loaded, and returns the
+// migrations that ran. Nodes without a version are taken to be written for
+// DefaultNodeTypeVersion; nodes of unregistered types are left as they are.
+// A workflow with a node written for a newer version than the registered
+// one is rejected, and left untouched.
+func MigrateWorkflow(registry *NodeTypeRegistryImpl, workflow *Workflow) ([]MigrationRecord, error) {
+	nodeIDs := make([]string, 0, len(workflow.Nodes))
+	for nodeID, node := range workflow.Nodes {
+		if node != nil {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+	}
+	sort.Strings(nodeIDs)
+
+	type migrated struct {
+		config  map[string]interface{}
+		version string
+	}
+	upgrades := make(map[string]migrated, len(nodeIDs))
+	var records []MigrationRecord
+	for _, nodeID := range nodeIDs {
+		config, version, ran, err := registry.migrateNode(nodeID, workflow.Nodes[nodeID])
+		if err != nil {
+			return nil, err
+		}
+		upgrades[nodeID] = migrated{config: config, version: version}
+		records = append(records, ran...)
+	}
+
+	for nodeID, upgrade := range upgrades {
+		workflow.Nodes[nodeID].Config = upgrade.config
+		workflow.Nodes[nodeID].Version = upgrade.version
+	}
+	return records, nil
+}
+
+// compareVersions compares two versions such as "1.2.0" numerically, part
+// by part, returning -1, 0 or 1. Missing parts count as 0.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// majorVersion returns the major version of a semantic version such as
+// "v1.2.0"
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	return major
+}
+
+// copyConfig returns a deep copy of a node config
+func copyConfig(config map[string]interface{}) map[string]interface{} {
+	copied, _ := copyConfigValue(config).(map[string]interface{})
+	return copied
+}
+
+func copyConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyConfigValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyConfigValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// httpV2Node records the config it is initialized with. Version 2 of the
+// HTTP node type nests the target of the request under "request".
+type httpV2Node struct {
+	configs *[]map[string]interface{}
+}
+
+func (n *httpV2Node) Initialize(config map[string]interface{}) error {
+	*n.configs = append(*n.configs, config)
+	return nil
+}
+func (n *httpV2Node) Validate() error { return nil }
+func (n *httpV2Node) Close() error    { return nil }
+func (n *httpV2Node) GetMetadata() types.NodeMetadata {
+	return types.NodeMetadata{ID: "http_request", Version: "2.0.0"}
+}
+
+func (n *httpV2Node) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	return types.NodeOutput{Data: map[string]interface{}{}}
+}
+
+// migrateHTTPRequestV1 moves the url and method of version 1 configs under
+// request
+func migrateHTTPRequestV1(config map[string]interface{}) (map[string]interface{}, error) {
+	method, _ := config["method"].(string)
+	if method == "" {
+		method = "GET"
+	}
+	config["request"] = map[string]interface{}{
+		"url":    config["url"],
+		"method": strings.ToUpper(method),
+	}
+	delete(config, "url")
+	delete(config, "method")
+	return config, nil
+}
+
+func newHTTPV2Registry(t *testing.T, configs *[]map[string]interface{}) *NodeTypeRegistryImpl {
+	t.Helper()
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("http_request", func() types.NodeInstance { return &httpV2Node{configs: configs} }, types.NodeMetadata{ID: "http_request", Version: "2.0.0"}))
+	require.NoError(t, registry.RegisterMigration("http_request", NodeMigration{From: "1.0.0", To: "2.0.0", Migrate: migrateHTTPRequestV1}))
+	return registry
+}
+
+func httpV1Workflow() *Workflow {
+	return &Workflow{
+		ID: "wf",
+		Nodes: map[string]*WorkflowNode{
+			"fetch": {ID: "fetch", Type: "http_request", Config: map[string]interface{}{
+				"url":     "https://example.com/orders",
+				"method":  "post",
+				"headers": map[string]interface{}{"Accept": "application/json"},
+			}},
+			"current": {ID: "current", Type: "http_request", Version: "2.0.0", Config: map[string]interface{}{
+				"request": map[string]interface{}{"url": "https://example.com", "method": "GET"},
+			}},
+		},
+	}
+}
+
+func TestMigrateWorkflowUpgradesV1HTTPNodes(t *testing.T) {
+	registry := newHTTPV2Registry(t, new([]map[string]interface{}))
+	workflow := httpV1Workflow()
+	original := workflow.Nodes["fetch"].Config
+
+	migrations, err := MigrateWorkflow(registry, workflow)
+	require.NoError(t, err)
+	assert.Equal(t, []MigrationRecord{{NodeID: "fetch", NodeType: "http_request", From: "1.0.0", To: "2.0.0"}}, migrations)
+
+	fetch := workflow.Nodes["fetch"]
+	assert.Equal(t, "2.0.0", fetch.Version)
+	assert.Equal(t, map[string]interface{}{
+		"request": map[string]interface{}{"url": "https://example.com/orders", "method": "POST"},
+		"headers": map[string]interface{}{"Accept": "application/json"},
+	}, fetch.Config)
+	assert.Equal(t, "post", original["method"], "migrations work on a copy")
+
+	// Migrated workflows are current
+	migrations, err = MigrateWorkflow(registry, workflow)
+	require.NoError(t, err)
+	assert.Empty(t, migrations)
+}
+
+func TestMigrateWorkflowRejectsNewerNodeVersions(t *testing.T) {
+	registry := newHTTPV2Registry(t, new([]map[string]interface{}))
+	workflow := httpV1Workflow()
+	workflow.Nodes["current"].Version = "3.0.0"
+
+	_, err := MigrateWorkflow(registry, workflow)
+	assert.ErrorIs(t, err, ErrNodeVersionUnsupported)
+	assert.Contains(t, err.Error(), "newer than version 2.0.0")
+	assert.Empty(t, workflow.Nodes["fetch"].Version, "a rejected workflow is left untouched")
+	assert.Equal(t, "post", workflow.Nodes["fetch"].Config["method"])
+
+	// Versions without a migration from them cannot be loaded either
+	workflow.Nodes["current"].Version = "2.0.0"
+	workflow.Nodes["fetch"].Version = "0.9.0"
+	_, err = MigrateWorkflow(registry, workflow)
+	assert.ErrorIs(t, err, ErrNodeVersionUnsupported)
+	assert.Contains(t, err.Error(), "no migration from version 0.9.0")
+}
+
+func TestExecutorMigratesConfigsOfOlderNodes(t *testing.T) {
+	var configs []map[string]interface{}
+	executor := NewWorkflowExecutor(newHTTPV2Registry(t, &configs))
+	workflow := httpV1Workflow()
+	delete(workflow.Nodes, "current")
+
+	_, err := executor.Run(context.Background(), workflow, nil)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, map[string]interface{}{"url": "https://example.com/orders", "method": "POST"}, configs[0]["request"])
+	assert.Empty(t, workflow.Nodes["fetch"].Version, "the workflow itself is not changed")
+}
+
+func TestRegisterMigrationRejectsDowngrades(t *testing.T) {
+	registry := NewNodeTypeRegistry()
+	assert.Error(t, registry.RegisterMigration("http_request", NodeMigration{From: "2.0.0", To: "1.0.0", Migrate: migrateHTTPRequestV1}))
+	assert.Error(t, registry.RegisterMigration("http_request", NodeMigration{From: "1.0.0", To: "2.0.0"}))
+	require.NoError(t, registry.RegisterMigration("http_request", NodeMigration{From: "1.0.0", To: "2.0.0", Migrate: migrateHTTPRequestV1}))
+	assert.Error(t, registry.RegisterMigration("http_request", NodeMigration{From: "1.0", To: "3.0.0", Migrate: migrateHTTPRequestV1}))
+}
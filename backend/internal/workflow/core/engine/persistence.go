@@ -0,0 +1,344 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// ErrExecutionNotFound is returned by an ExecutionStore for unknown IDs
+var ErrExecutionNotFound = errors.New("execution not found")
+
+// ErrExecutionNotRunning is returned when cancelling an execution that is
+// not running
+var ErrExecutionNotRunning = errors.New("execution is not running")
+
+// ErrExecutionRunning is returned when resuming an execution that is still
+// running, in this process or another one
+var ErrExecutionRunning = errors.New("execution is still running")
+
+// heartbeatInterval is how often running executions are written to the
+// store, showing other processes that their owner is alive
+const heartbeatInterval = 30 * time.Second
+
+// ownerTimeout is how long a running execution must have gone without a
+// heartbeat before it is taken to be abandoned and can be resumed
+const ownerTimeout = 3 * heartbeatInterval
+
+// ExecutionStore persists the progress of workflow executions so that an
+// interrupted execution can be resumed from its last completed node
+type ExecutionStore interface {
+	// CreateExecution records a new execution together with the workflow
+	// definition it runs, assigning execution.ID when it is empty
+	CreateExecution(ctx context.Context, execution *types.Execution, workflow *Workflow) error
+
+	// UpdateExecution records the execution's status, error and completion time
+	UpdateExecution(ctx context.Context, execution *types.Execution) error
+
+	// SaveNodeResult creates or replaces the result of a node
+	SaveNodeResult(ctx context.Context, result *types.NodeResult) error
+
+	// LoadExecution returns an execution with its node results and the
+	// workflow definition it was started with
+	LoadExecution(ctx context.Context, executionID string) (*types.Execution, *Workflow, error)
+}
+
+// MemoryExecutionStore is an in-memory ExecutionStore, for tests and for
+// running without a database
+type MemoryExecutionStore struct {
+	mu         sync.Mutex
+	nextID     int64
+	executions map[string]*types.Execution
+	workflows  map[string]*Workflow
+}
+
+// NewMemoryExecutionStore creates an empty in-memory execution store
+func NewMemoryExecutionStore() *MemoryExecutionStore {
+	return &MemoryExecutionStore{
+		executions: make(map[string]*types.Execution),
+		workflows:  make(map[string]*Workflow),
+	}
+}
+
+// CreateExecution implements ExecutionStore
+func (m *MemoryExecutionStore) CreateExecution(ctx context.Context, execution *types.Execution, workflow *Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if execution.ID == "" {
+		m.nextID++
+		execution.ID = fmt.Sprintf("exec_%d", m.nextID)
+	}
+
+	stored := copyExecution(execution)
+	updatedAt := time.Now()
+	stored.UpdatedAt = &updatedAt
+	stored.NodeResults = make(map[string]*types.NodeResult)
+	m.executions[execution.ID] = stored
+	m.workflows[execution.ID] = workflow
+	return nil
+}
+
+// UpdateExecution implements ExecutionStore
+func (m *MemoryExecutionStore) UpdateExecution(ctx context.Context, execution *types.Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.executions[execution.ID]
+	if !ok {
+		return ErrExecutionNotFound
+	}
+
+	updated := copyExecution(execution)
+	updated.NodeResults = stored.NodeResults
+	updatedAt := time.Now()
+	updated.UpdatedAt = &updatedAt
+	m.executions[execution.ID] = updated
+	return nil
+}
+
+// SaveNodeResult implements ExecutionStore
+func (m *MemoryExecutionStore) SaveNodeResult(ctx context.Context, result *types.NodeResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.executions[result.ExecutionID]
+	if !ok {
+		return ErrExecutionNotFound
+	}
+
+	saved := *result
+	stored.NodeResults[result.NodeID] = &saved
+	return nil
+}
+
+// LoadExecution implements ExecutionStore
+func (m *MemoryExecutionStore) LoadExecution(ctx context.Context, executionID string) (*types.Execution, *Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.executions[executionID]
+	if !ok {
+		return nil, nil, ErrExecutionNotFound
+	}
+
+	execution := copyExecution(stored)
+	execution.NodeResults = make(map[string]*types.NodeResult, len(stored.NodeResults))
+	for nodeID, result := range stored.NodeResults {
+		r := *result
+		execution.NodeResults[nodeID] = &r
+	}
+	return execution, m.workflows[executionID], nil
+}
+
+func copyExecution(execution *types.Execution) *types.Execution {
+	c := *execution
+	return &c
+}
+
+// SetExecutionStore enables execution persistence. Each run is recorded
+// in the store and every node result is saved as it finishes, so
+// interrupted executions can be continued with ResumeExecution.
+func (we *WorkflowExecutor) SetExecutionStore(store ExecutionStore) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.store = store
+}
+
+// GetExecution returns the stored state of an execution, including the
+// results of the nodes that have run so far
+func (we *WorkflowExecutor) GetExecution(ctx context.Context, executionID string) (*types.Execution, error) {
+	we.mu.Lock()
+	store := we.store
+	we.mu.Unlock()
+	if store == nil {
+		return nil, fmt.Errorf("execution persistence is not configured")
+	}
+
+	execution, _, err := store.LoadExecution(ctx, executionID)
+	return execution, err
+}
+
+// ResumeExecution continues a persisted execution that was interrupted.
+// Nodes that already completed are not run again; their stored outputs feed
+// the remaining nodes. Executions that are still running, here or in a
+// process that has kept up its heartbeat, are refused with
+// ErrExecutionRunning. Failed and cancelled executions are refused too; see
+// RetryExecution.
+func (we *WorkflowExecutor) ResumeExecution(ctx context.Context, executionID string) (*WorkflowRun, error) {
+	return we.resume(ctx, executionID, false)
+}
+
+// RetryExecution is ResumeExecution, also continuing executions that failed,
+// timed out or were cancelled
+func (we *WorkflowExecutor) RetryExecution(ctx context.Context, executionID string) (*WorkflowRun, error) {
+	return we.resume(ctx, executionID, true)
+}
+
+func (we *WorkflowExecutor) resume(ctx context.Context, executionID string, retry bool) (*WorkflowRun, error) {
+	we.mu.Lock()
+	store := we.store
+	_, running := we.cancels[executionID]
+	we.mu.Unlock()
+	if store == nil {
+		return nil, fmt.Errorf("execution persistence is not configured")
+	}
+	if running {
+		return nil, fmt.Errorf("execution %s: %w", executionID, ErrExecutionRunning)
+	}
+
+	execution, workflow, err := store.LoadExecution(ctx, executionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load execution %s: %w", executionID, err)
+	}
+	if workflow == nil {
+		return nil, fmt.Errorf("execution %s has no stored workflow definition", executionID)
+	}
+	switch execution.Status {
+	case types.ExecutionSucceeded:
+		return nil, fmt.Errorf("execution %s already completed", executionID)
+	case types.ExecutionRunning, types.ExecutionResuming:
+		// Another process may still be running it
+		if since := time.Since(lastHeartbeat(execution)); since < ownerTimeout {
+			return nil, fmt.Errorf("execution %s was running %s ago: %w", executionID, since.Round(time.Second), ErrExecutionRunning)
+		}
+	case types.ExecutionFailed, types.ExecutionTimeout, types.ExecutionCancelled:
+		if !retry {
+			return nil, fmt.Errorf("execution %s %s; it can only be retried", executionID, execution.Status)
+		}
+	}
+
+	execution.Status = types.ExecutionRunning
+	execution.CompletedAt = nil
+	execution.CancelledAt = nil
+	execution.Error = nil
+	if err := store.UpdateExecution(ctx, execution); err != nil {
+		return nil, fmt.Errorf("failed to update execution %s: %w", executionID, err)
+	}
+
+	tracker := &executionTracker{store: store, execution: execution}
+	ctx, release := we.cancellable(ctx, tracker)
+	defer release()
+	return we.execute(ctx, workflow, execution.TriggerParams, tracker)
+}
+
+// lastHeartbeat returns when the process running an execution last wrote it
+func lastHeartbeat(execution *types.Execution) time.Time {
+	if execution.UpdatedAt != nil {
+		return *execution.UpdatedAt
+	}
+	return execution.StartedAt
+}
+
+// executionTracker writes the progress of one execution to the store
+type executionTracker struct {
+	store     ExecutionStore
+	execution *types.Execution
+	mu        sync.Mutex // guards writes of execution
+}
+
+// startExecution records a new execution of workflow
+func startExecution(ctx context.Context, store ExecutionStore, workflow *Workflow, inputs map[string]interface{}) (*executionTracker, error) {
+	execution := &types.Execution{
+		WorkflowID:    workflow.ID,
+		Status:        types.ExecutionRunning,
+		StartedAt:     time.Now(),
+		TriggerParams: inputs,
+	}
+	if err := store.CreateExecution(ctx, execution, workflow); err != nil {
+		return nil, fmt.Errorf("failed to record execution: %w", err)
+	}
+	return &executionTracker{store: store, execution: execution}, nil
+}
+
+// id returns the execution ID, or "" when the run is not persisted
+func (t *executionTracker) id() string {
+	if t == nil {
+		return ""
+	}
+	return t.execution.ID
+}
+
+// completed returns the results of nodes that completed in an earlier attempt
+func (t *executionTracker) completed() map[string]*types.NodeResult {
+	if t == nil {
+		return nil
+	}
+	completed := make(map[string]*types.NodeResult)
+	for nodeID, result := range t.execution.NodeResults {
+		if result.Status == types.NodeCompleted {
+			completed[nodeID] = result
+		}
+	}
+	return completed
+}
+
+// saveNode persists a node result. Storage is written with a context that
+// outlives cancellation of the run, so the final state is still recorded.
+func (t *executionTracker) saveNode(ctx context.Context, result *types.NodeResult) {
+	if t == nil {
+		return
+	}
+	result.ExecutionID = t.execution.ID
+	if err := t.store.SaveNodeResult(context.WithoutCancel(ctx), result); err != nil {
+		logPersistenceError(t.execution.ID, err)
+	}
+}
+
+// heartbeat writes the execution every heartbeatInterval while it is
+// running, until stop is closed
+func (t *executionTracker) heartbeat(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		if t.execution.Status == types.ExecutionRunning {
+			if err := t.store.UpdateExecution(context.WithoutCancel(ctx), t.execution); err != nil {
+				logPersistenceError(t.execution.ID, err)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// finish records the final status of the execution
+func (t *executionTracker) finish(ctx context.Context, runErr error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	completedAt := time.Now()
+	t.execution.CompletedAt = &completedAt
+	t.execution.ExecutionTime = completedAt.Sub(t.execution.StartedAt)
+	t.execution.Status = types.ExecutionSucceeded
+	if runErr != nil {
+		msg := runErr.Error()
+		t.execution.Error = &msg
+		t.execution.Status = types.ExecutionFailed
+		if errors.Is(runErr, context.Canceled) {
+			t.execution.Status = types.ExecutionCancelled
+			t.execution.CancelledAt = &completedAt
+		}
+	}
+
+	if err := t.store.UpdateExecution(context.WithoutCancel(ctx), t.execution); err != nil {
+		logPersistenceError(t.execution.ID, err)
+	}
+}
+
+func logPersistenceError(executionID string, err error) {
+	log.Printf("Failed to persist state of execution %s: %v", executionID, err)
+}
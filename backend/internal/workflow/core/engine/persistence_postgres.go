@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgresPool is the part of a connection pool the Postgres stores use. It
+// is implemented by *pgxpool.Pool and by *database.Pool, which bounds each
+// query by a timeout.
+type PostgresPool interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Close()
+}
+
+// PostgresExecutionStore implements ExecutionStore on top of the executions
+// and node_executions tables
+type PostgresExecutionStore struct {
+	pool  PostgresPool
+	codec *StateCodec
+}
+
+// NewPostgresExecutionStore creates a new Postgres-backed execution store
+func NewPostgresExecutionStore(pool PostgresPool) *PostgresExecutionStore {
+	return &PostgresExecutionStore{pool: pool}
+}
+
+// SetStateCodec sets how trigger inputs and node outputs are written, so
+// that they can be compressed and encrypted at rest; nil writes plain JSON.
+// State written with a different codec is still read, as long as it was
+// not encrypted with another key.
+func (s *PostgresExecutionStore) SetStateCodec(codec *StateCodec) {
+	s.codec = codec
+}
+
+// CreateExecution implements ExecutionStore. The execution ID is the row's
+// serial ID; workflow IDs that are not numeric are kept only in the stored
+// definition.
+func (s *PostgresExecutionStore) CreateExecution(ctx context.Context, execution *types.Execution, workflow *Workflow) error {
+	var definition []byte
+	if workflow != nil {
+		encoded, err := json.Marshal(workflow)
+		if err != nil {
+			return fmt.Errorf("failed to encode workflow: %w", err)
+		}
+		definition = encoded
+	}
+	params, err := s.codec.Encode(execution.TriggerParams)
+	if err != nil {
+		return fmt.Errorf("failed to encode trigger params: %w", err)
+	}
+
+	var id int64
+	err = s.pool.QueryRow(ctx, `
+		INSERT INTO executions (workflow_id, status, triggered_by, trigger_params, state_sealed, definition, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		numericID(execution.WorkflowID), execution.Status, execution.TriggeredBy, params, s.codec.Seals(), definition, execution.StartedAt,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	execution.ID = strconv.FormatInt(id, 10)
+	return nil
+}
+
+// UpdateExecution implements ExecutionStore. The updated_at it sets is
+// loaded as the execution's UpdatedAt, its heartbeat.
+func (s *PostgresExecutionStore) UpdateExecution(ctx context.Context, execution *types.Execution) error {
+	id, err := strconv.ParseInt(execution.ID, 10, 64)
+	if err != nil {
+		return ErrExecutionNotFound
+	}
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE executions
+		SET status = $2, error = $3, completed_at = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id, execution.Status, execution.Error, execution.CompletedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrExecutionNotFound
+	}
+	return nil
+}
+
+// SaveNodeResult implements ExecutionStore
+func (s *PostgresExecutionStore) SaveNodeResult(ctx context.Context, result *types.NodeResult) error {
+	id, err := strconv.ParseInt(result.ExecutionID, 10, 64)
+	if err != nil {
+		return ErrExecutionNotFound
+	}
+
+	var output []byte
+	if result.Output != nil {
+		if output, err = s.codec.Encode(result.Output); err != nil {
+			return fmt.Errorf("failed to encode output of node %s: %w", result.NodeID, err)
+		}
+	}
+
+	var startedAt *time.Time
+	if !result.StartedAt.IsZero() {
+		startedAt = &result.StartedAt
+	}
+
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO node_executions (execution_id, node_id, status, output, output_redacted, state_sealed, error, retry_count, started_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (execution_id, node_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			output = EXCLUDED.output,
+			output_redacted = EXCLUDED.output_redacted,
+			state_sealed = EXCLUDED.state_sealed,
+			error = EXCLUDED.error,
+			retry_count = EXCLUDED.retry_count,
+			started_at = EXCLUDED.started_at,
+			completed_at = EXCLUDED.completed_at,
+			updated_at = CURRENT_TIMESTAMP`,
+		id, result.NodeID, result.Status, output, result.Redacted, s.codec.Seals(), result.Error, result.RetryCount, startedAt, result.CompletedAt,
+	)
+	return err
+}
+
+// LoadExecution implements ExecutionStore
+func (s *PostgresExecutionStore) LoadExecution(ctx context.Context, executionID string) (*types.Execution, *Workflow, error) {
+	id, err := strconv.ParseInt(executionID, 10, 64)
+	if err != nil {
+		return nil, nil, ErrExecutionNotFound
+	}
+
+	var (
+		execution   = &types.Execution{ID: executionID, NodeResults: make(map[string]*types.NodeResult)}
+		triggeredBy *string
+		startedAt   *time.Time
+		params      []byte
+		sealed      bool
+		definition  []byte
+	)
+	err = s.pool.QueryRow(ctx, `
+		SELECT COALESCE(workflow_id::text, ''), status, triggered_by, trigger_params, state_sealed, definition, error, COALESCE(started_at, created_at), completed_at, updated_at
+		FROM executions WHERE id = $1`,
+		id,
+	).Scan(&execution.WorkflowID, &execution.Status, &triggeredBy, &params, &sealed, &definition, &execution.Error, &startedAt, &execution.CompletedAt, &execution.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if triggeredBy != nil {
+		execution.TriggeredBy = *triggeredBy
+	}
+	if startedAt != nil {
+		execution.StartedAt = *startedAt
+	}
+	if len(params) > 0 {
+		if err := s.codec.Decode(params, sealed, &execution.TriggerParams); err != nil {
+			return nil, nil, fmt.Errorf("invalid trigger params: %w", err)
+		}
+	}
+
+	var workflow *Workflow
+	if len(definition) > 0 {
+		workflow = &Workflow{}
+		if err := json.Unmarshal(definition, workflow); err != nil {
+			return nil, nil, fmt.Errorf("invalid workflow definition: %w", err)
+		}
+		execution.WorkflowID = workflow.ID
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT node_id, status, output, output_redacted, state_sealed, error, retry_count, started_at, completed_at
+		FROM node_executions WHERE execution_id = $1`,
+		id,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			result    = &types.NodeResult{ExecutionID: executionID}
+			output    []byte
+			sealed    bool
+			startedAt *time.Time
+		)
+		if err := rows.Scan(&result.NodeID, &result.Status, &output, &result.Redacted, &sealed, &result.Error, &result.RetryCount, &startedAt, &result.CompletedAt); err != nil {
+			return nil, nil, err
+		}
+		if len(output) > 0 {
+			if err := s.codec.Decode(output, sealed, &result.Output); err != nil {
+				return nil, nil, fmt.Errorf("invalid output of node %s: %w", result.NodeID, err)
+			}
+		}
+		if startedAt != nil {
+			result.StartedAt = *startedAt
+		}
+		execution.NodeResults[result.NodeID] = result
+	}
+
+	return execution, workflow, rows.Err()
+}
+
+// numericID returns id as an integer, or nil when it is not numeric
+func numericID(id string) *int64 {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stepNode counts its executions and appends its name to the "path" input.
+// While crash is set it blocks until the run is cancelled, simulating a
+// process that dies mid-node.
+type stepNode struct {
+	name    string
+	calls   map[string]*int32
+	crash   *atomic.Bool
+	crashed chan struct{}
+}
+
+func (n *stepNode) Initialize(config map[string]interface{}) error {
+	n.name, _ = config["name"].(string)
+	return nil
+}
+func (n *stepNode) Validate() error                 { return nil }
+func (n *stepNode) Close() error                    { return nil }
+func (n *stepNode) GetMetadata() types.NodeMetadata { return types.NodeMetadata{ID: "step"} }
+
+func (n *stepNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	atomic.AddInt32(n.calls[n.name], 1)
+	if n.name == "charge" && n.crash.Load() {
+		close(n.crashed)
+		<-ctx.Done()
+		return types.NodeOutput{Error: ctx.Err()}
+	}
+
+	path, _ := input.Data["path"].(string)
+	return types.NodeOutput{Data: map[string]interface{}{"path": path + "/" + n.name}}
+}
+
+func newStepExecutor(t *testing.T, store ExecutionStore, calls map[string]*int32, crash *atomic.Bool, crashed chan struct{}) *WorkflowExecutor {
+	t.Helper()
+
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("step", func() types.NodeInstance {
+		return &stepNode{calls: calls, crash: crash, crashed: crashed}
+	}, types.NodeMetadata{ID: "step"}))
+
+	executor := NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(RetryPolicy{})
+	executor.SetExecutionStore(store)
+	return executor
+}
+
+func checkoutWorkflow() *Workflow {
+	return &Workflow{
+		ID: "checkout",
+		Nodes: map[string]*WorkflowNode{
+			"reserve": {ID: "reserve", Type: "step", Config: map[string]interface{}{"name": "reserve"}},
+			"charge":  {ID: "charge", Type: "step", Config: map[string]interface{}{"name": "charge"}},
+			"ship":    {ID: "ship", Type: "step", Config: map[string]interface{}{"name": "ship"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "reserve", Target: "charge"},
+			{ID: "e2", Source: "charge", Target: "ship"},
+		},
+	}
+}
+
+func TestResumeAfterCrashSkipsCompletedNodes(t *testing.T) {
+	calls := map[string]*int32{"reserve": new(int32), "charge": new(int32), "ship": new(int32)}
+	crash := &atomic.Bool{}
+	crash.Store(true)
+	store := NewMemoryExecutionStore()
+
+	// Interrupt the run while "charge" is executing
+	crashed := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-crashed
+		cancel()
+	}()
+
+	run, err := newStepExecutor(t, store, calls, crash, crashed).Run(ctx, checkoutWorkflow(), map[string]interface{}{"path": ""})
+	require.Error(t, err)
+	require.NotEmpty(t, run.ExecutionID)
+
+	execution, _, err := store.LoadExecution(context.Background(), run.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionCancelled, execution.Status)
+	assert.Equal(t, types.NodeCompleted, execution.NodeResults["reserve"].Status)
+	assert.Equal(t, types.NodeFailed, execution.NodeResults["charge"].Status)
+	assert.NotContains(t, execution.NodeResults, "ship")
+
+	// Cancelled runs are only continued when asked to retry them
+	crash.Store(false)
+	_, err = newStepExecutor(t, store, calls, crash, nil).ResumeExecution(context.Background(), run.ExecutionID)
+	require.Error(t, err)
+
+	// A fresh executor, as after a restart, picks up where the run stopped
+	resumed, err := newStepExecutor(t, store, calls, crash, nil).RetryExecution(context.Background(), run.ExecutionID)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls["reserve"]))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls["charge"]))
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls["ship"]))
+	assert.Equal(t, "/reserve/charge/ship", resumed.Results["ship"].(map[string]interface{})["path"])
+
+	execution, _, err = store.LoadExecution(context.Background(), run.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ExecutionSucceeded, execution.Status)
+	assert.Nil(t, execution.Error)
+
+	_, err = newStepExecutor(t, store, calls, crash, nil).RetryExecution(context.Background(), run.ExecutionID)
+	assert.Error(t, err, "completed executions cannot be resumed")
+}
+
+// abandon makes a stored execution look like its process died long enough
+// ago for it to be resumed
+func abandon(store *MemoryExecutionStore, executionID string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	lastSeen := time.Now().Add(-ownerTimeout - time.Second)
+	store.executions[executionID].UpdatedAt = &lastSeen
+}
+
+func TestResumeRequiresKnownExecution(t *testing.T) {
+	calls := map[string]*int32{}
+	executor := newStepExecutor(t, NewMemoryExecutionStore(), calls, &atomic.Bool{}, nil)
+
+	_, err := executor.ResumeExecution(context.Background(), "exec_404")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrExecutionNotFound))
+}
+
+func TestResumeAfterHardCrash(t *testing.T) {
+	calls := map[string]*int32{"reserve": new(int32), "charge": new(int32), "ship": new(int32)}
+	store := NewMemoryExecutionStore()
+	ctx := context.Background()
+
+	// State left behind by a process killed while "charge" was running
+	execution := &types.Execution{
+		WorkflowID:    "checkout",
+		Status:        types.ExecutionRunning,
+		TriggerParams: map[string]interface{}{"path": ""},
+	}
+	require.NoError(t, store.CreateExecution(ctx, execution, checkoutWorkflow()))
+	require.NoError(t, store.SaveNodeResult(ctx, &types.NodeResult{
+		ExecutionID: execution.ID, NodeID: "reserve", Status: types.NodeCompleted,
+		Output: map[string]interface{}{"path": "/reserve"},
+	}))
+	require.NoError(t, store.SaveNodeResult(ctx, &types.NodeResult{
+		ExecutionID: execution.ID, NodeID: "charge", Status: types.NodeRunning,
+	}))
+
+	// Until its heartbeat is overdue, the process may still be running it
+	executor := newStepExecutor(t, store, calls, &atomic.Bool{}, nil)
+	_, err := executor.ResumeExecution(ctx, execution.ID)
+	assert.ErrorIs(t, err, ErrExecutionRunning)
+	assert.Equal(t, int32(0), atomic.LoadInt32(calls["charge"]))
+
+	abandon(store, execution.ID)
+	run, err := executor.ResumeExecution(ctx, execution.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(calls["reserve"]))
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls["charge"]))
+	assert.Equal(t, "/reserve/charge/ship", run.Results["ship"].(map[string]interface{})["path"])
+}
+
+func TestCancelExecutionStopsInFlightNode(t *testing.T) {
+	calls := map[string]*int32{"reserve": new(int32), "charge": new(int32), "ship": new(int32)}
+	crash := &atomic.Bool{}
+	crash.Store(true)
+	crashed := make(chan struct{})
+	executor := newStepExecutor(t, NewMemoryExecutionStore(), calls, crash, crashed)
+	ctx := context.Background()
+
+	id, err := executor.Start(ctx, checkoutWorkflow(), map[string]interface{}{"path": ""})
+	require.NoError(t, err)
+	<-crashed
+	require.NoError(t, executor.CancelExecution(ctx, id))
+
+	require.Eventually(t, func() bool {
+		execution, err := executor.GetExecution(ctx, id)
+		return err == nil && execution.Status == types.ExecutionCancelled
+	}, time.Second, time.Millisecond)
+	execution, err := executor.GetExecution(ctx, id)
+	require.NoError(t, err)
+	assert.NotNil(t, execution.CancelledAt)
+	assert.Contains(t, *execution.NodeResults["charge"].Error, "cancelled")
+	assert.NotContains(t, execution.NodeResults, "ship")
+	assert.Equal(t, int32(0), atomic.LoadInt32(calls["ship"]))
+
+	assert.ErrorIs(t, executor.CancelExecution(ctx, id), ErrExecutionNotRunning)
+	assert.ErrorIs(t, executor.CancelExecution(ctx, "exec_404"), ErrExecutionNotFound)
+}
+
+func TestResumeRefusesExecutionRunningHere(t *testing.T) {
+	calls := map[string]*int32{"reserve": new(int32), "charge": new(int32), "ship": new(int32)}
+	crash := &atomic.Bool{}
+	crash.Store(true)
+	crashed := make(chan struct{})
+	store := NewMemoryExecutionStore()
+	executor := newStepExecutor(t, store, calls, crash, crashed)
+	ctx := context.Background()
+
+	id, err := executor.Start(ctx, checkoutWorkflow(), map[string]interface{}{"path": ""})
+	require.NoError(t, err)
+	<-crashed
+
+	// Even with an overdue heartbeat, the run in flight is not started twice
+	abandon(store, id)
+	_, err = executor.ResumeExecution(ctx, id)
+	assert.ErrorIs(t, err, ErrExecutionRunning)
+	_, err = executor.RetryExecution(ctx, id)
+	assert.ErrorIs(t, err, ErrExecutionRunning)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls["charge"]))
+
+	require.NoError(t, executor.CancelExecution(ctx, id))
+}
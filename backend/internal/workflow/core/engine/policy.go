@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/middleware"
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+)
+
+// Retry conditions understood by RetryPolicy.Conditions
+const (
+	RetryOnNetworkError        = "network_error"
+	RetryOnTimeout             = "timeout"
+	RetryOnResourceUnavailable = "resource_unavailable"
+)
+
+// RetryPolicy controls how failed node executions are retried. It mirrors
+// the workflow.retry_policy section of the application config.
+type RetryPolicy struct {
+	Enable        bool
+	MaxAttempts   int
+	BackoffFactor float64
+	InitialWait   time.Duration
+	MaxWaitTime   time.Duration
+	Conditions    []string
+}
+
+// TimeoutPolicy bounds how long a single node execution may take. It mirrors
+// the workflow.timeout_policy section of the application config.
+type TimeoutPolicy struct {
+	NodeTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Enable:        true,
+		MaxAttempts:   3,
+		BackoffFactor: 2.0,
+		InitialWait:   1 * time.Second,
+		MaxWaitTime:   30 * time.Second,
+		Conditions:    []string{RetryOnNetworkError, RetryOnTimeout, RetryOnResourceUnavailable},
+	}
+}
+
+// DefaultTimeoutPolicy returns the timeout policy used when none is configured
+func DefaultTimeoutPolicy() TimeoutPolicy {
+	return TimeoutPolicy{
+		NodeTimeout: 10 * time.Minute,
+	}
+}
+
+// Attempts returns the number of times a node may be executed
+func (p RetryPolicy) Attempts() int {
+	if !p.Enable || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the wait before the given retry (1 for the first retry),
+// growing exponentially and capped at MaxWaitTime
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	factor := p.BackoffFactor
+	if factor < 1 {
+		factor = 1
+	}
+
+	wait := float64(p.InitialWait) * math.Pow(factor, float64(retry-1))
+	if p.MaxWaitTime > 0 && wait > float64(p.MaxWaitTime) {
+		return p.MaxWaitTime
+	}
+	return time.Duration(wait)
+}
+
+// conditionCodes are the error codes each retry condition matches
+var conditionCodes = map[string]string{
+	RetryOnTimeout:             nodeerrors.CodeTimeout,
+	RetryOnNetworkError:        nodeerrors.CodeNetwork,
+	RetryOnResourceUnavailable: nodeerrors.CodeResource,
+}
+
+// ShouldRetry reports whether the code of err matches one of the configured
+// conditions. Errors explicitly marked with middleware.RetryableError
+// override the conditions either way.
+func (p RetryPolicy) ShouldRetry(err error) bool {
+	var retryable *middleware.RetryableError
+	if errors.As(err, &retryable) {
+		return retryable.Retryable
+	}
+
+	code := classify(err)
+	if code == "" {
+		return false
+	}
+	for _, condition := range p.Conditions {
+		if conditionCodes[condition] == code {
+			return true
+		}
+	}
+	return false
+}
+
+// classify returns the error code of err: the code of the node error it
+// wraps, or else the one its cause suggests, or "" when unknown
+func classify(err error) string {
+	if code := nodeerrors.CodeOf(err); code != "" {
+		return code
+	}
+	switch {
+	case isTimeoutError(err):
+		return nodeerrors.CodeTimeout
+	case isNetworkError(err):
+		return nodeerrors.CodeNetwork
+	case isResourceUnavailableError(err):
+		return nodeerrors.CodeResource
+	}
+	return ""
+}
+
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func isResourceUnavailableError(err error) bool {
+	if errors.Is(err, middleware.ErrCircuitOpen) || errors.Is(err, middleware.ErrTooManyRequests) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "service unavailable") || strings.Contains(msg, "too many requests")
+}
+
+// executeWithPolicy runs a node, enforcing the node timeout on each attempt
+// and retrying failures that match the retry policy. It returns the final
+// output and the number of attempts made.
+func executeWithPolicy(ctx context.Context, instance types.NodeInstance, input types.NodeInput, retry RetryPolicy, timeout TimeoutPolicy) (types.NodeOutput, int) {
+	maxAttempts := retry.Attempts()
+
+	var output types.NodeOutput
+	for attempt := 1; ; attempt++ {
+		output = executeOnce(ctx, instance, input, timeout.NodeTimeout)
+		if output.Error == nil || attempt >= maxAttempts || !retry.ShouldRetry(output.Error) {
+			return output, attempt
+		}
+
+		wait := retry.backoff(attempt)
+		select {
+		case <-ctx.Done():
+			output.Error = fmt.Errorf("%w (retry aborted: %v)", output.Error, ctx.Err())
+			return output, attempt
+		case <-time.After(wait):
+		}
+	}
+}
+
+// executeOnce runs a single attempt bounded by the node timeout. Nodes that
+// ignore context cancellation are abandoned once the timeout expires.
+func executeOnce(ctx context.Context, instance types.NodeInstance, input types.NodeInput, timeout time.Duration) types.NodeOutput {
+	if timeout <= 0 {
+		return instance.Execute(ctx, input)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan types.NodeOutput, 1)
+	go func() {
+		done <- instance.Execute(attemptCtx, input)
+	}()
+
+	select {
+	case output := <-done:
+		return output
+	case <-attemptCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return types.NodeOutput{Error: fmt.Errorf("node execution cancelled: %w", err)}
+		}
+		return types.NodeOutput{
+			Error: fmt.Errorf("node execution timed out after %s: %w", timeout, attemptCtx.Err()),
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultMaxRecordedPayload bounds the size of the JSON of each recorded
+// node input and output unless configured otherwise
+const DefaultMaxRecordedPayload = 1 << 20
+
+// ErrCallNotRecorded is returned by call stores without the requested call
+var ErrCallNotRecorded = errors.New("call not recorded")
+
+// RecordedCall is one execution of an external node in a recorded run: the
+// input it was given and the output or error it returned, as JSON. Payloads
+// larger than the recording limit are left out and marked truncated.
+type RecordedCall struct {
+	RecordingID string `json:"recording_id"`
+	NodeID      string `json:"node_id"`
+	// Sequence numbers the executions of a node within a run from 0, as
+	// nodes in loop bodies run more than once
+	Sequence        int             `json:"sequence"`
+	Input           json.RawMessage `json:"input,omitempty"`
+	Output          json.RawMessage `json:"output,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	InputTruncated  bool            `json:"input_truncated,omitempty"`
+	OutputTruncated bool            `json:"output_truncated,omitempty"`
+	RecordedAt      time.Time       `json:"recorded_at"`
+}
+
+// CallStore keeps the calls of recorded runs
+type CallStore interface {
+	SaveCall(ctx context.Context, call *RecordedCall) error
+	// LoadCall returns ErrCallNotRecorded when there is no such call
+	LoadCall(ctx context.Context, recordingID, nodeID string, sequence int) (*RecordedCall, error)
+}
+
+// External is implemented by nodes that call services outside Citadel
+// depending on their config. Node types that always do set the External
+// flag of their metadata instead.
+type External interface {
+	IsExternal() bool
+}
+
+// isExternal reports whether instance calls services outside Citadel, as
+// declared by its metadata or by the node behind it, looking through
+// adapters
+func isExternal(instance types.NodeInstance) bool {
+	if instance.GetMetadata().External {
+		return true
+	}
+	var node interface{} = instance
+	if adapted, ok := instance.(*adaptedNode); ok {
+		node = adapted.node
+	}
+	declared, ok := node.(External)
+	return ok && declared.IsExternal()
+}
+
+// SetCallStore enables the recording and replay of runs, which keep the
+// calls of their external nodes in store. Recorded inputs and outputs are
+// limited to maxPayload bytes of JSON each, or DefaultMaxRecordedPayload
+// when it is 0.
+func (we *WorkflowExecutor) SetCallStore(store CallStore, maxPayload int) {
+	if maxPayload <= 0 {
+		maxPayload = DefaultMaxRecordedPayload
+	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.calls = store
+	we.maxRecordedPayload = maxPayload
+}
+
+// Record runs a workflow as Run does, keeping the input and output of each
+// execution of its external nodes, such as HTTP requests and database
+// queries, in the call store. The calls are keyed by the RecordingID of the
+// run: its execution ID when runs are persisted.
+func (we *WorkflowExecutor) Record(ctx context.Context, workflow *Workflow, inputs map[string]interface{}) (*WorkflowRun, error) {
+	we.mu.Lock()
+	store, calls, maxPayload := we.store, we.calls, we.maxRecordedPayload
+	we.mu.Unlock()
+	if calls == nil {
+		return nil, fmt.Errorf("call recording is not configured")
+	}
+
+	var tracker *executionTracker
+	if store != nil {
+		var err error
+		if tracker, err = startExecution(ctx, store, workflow, inputs); err != nil {
+			return nil, err
+		}
+	}
+	recordingID := tracker.id()
+	if recordingID == "" {
+		recordingID = fmt.Sprintf("rec_%d", time.Now().UnixNano())
+	}
+
+	ctx = context.WithValue(ctx, recorderContextKey{}, newCallRecorder(calls, recordingID, false, maxPayload))
+	ctx, release := we.cancellable(ctx, tracker)
+	defer release()
+	run, err := we.execute(ctx, workflow, inputs, tracker)
+	if run != nil {
+		run.RecordingID = recordingID
+	}
+	return run, err
+}
+
+// Replay runs a workflow as Run does, except that its external nodes
+// return the outputs recorded by the run with recordingID instead of
+// calling their services, so that a recorded run can be reproduced. Nodes
+// run in the same order, so each gets the output of its execution with the
+// same sequence. Replayed runs are not persisted.
+func (we *WorkflowExecutor) Replay(ctx context.Context, workflow *Workflow, inputs map[string]interface{}, recordingID string) (*WorkflowRun, error) {
+	we.mu.Lock()
+	calls := we.calls
+	we.mu.Unlock()
+	if calls == nil {
+		return nil, fmt.Errorf("call recording is not configured")
+	}
+
+	ctx = context.WithValue(ctx, recorderContextKey{}, newCallRecorder(calls, recordingID, true, 0))
+	ctx, release := we.cancellable(ctx, nil)
+	defer release()
+	run, err := we.execute(ctx, workflow, inputs, nil)
+	if run != nil {
+		run.RecordingID = recordingID
+	}
+	return run, err
+}
+
+type recorderContextKey struct{}
+
+// callRecorder records or replays the calls of the external nodes of a
+// run, loop bodies included
+type callRecorder struct {
+	store       CallStore
+	recordingID string
+	replay      bool
+	maxPayload  int
+
+	mu        sync.Mutex
+	sequences map[string]int
+}
+
+func newCallRecorder(store CallStore, recordingID string, replay bool, maxPayload int) *callRecorder {
+	return &callRecorder{
+		store:       store,
+		recordingID: recordingID,
+		replay:      replay,
+		maxPayload:  maxPayload,
+		sequences:   make(map[string]int),
+	}
+}
+
+// next returns the sequence of the next execution of nodeID
+func (r *callRecorder) next(nodeID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sequence := r.sequences[nodeID]
+	r.sequences[nodeID]++
+	return sequence
+}
+
+// execute runs instance as executeValidated does and records the call with
+// the secrets of redact removed, or when replaying returns the recorded
+// output instead
+func (r *callRecorder) execute(ctx context.Context, nodeID string, instance types.NodeInstance, input types.NodeInput, retry RetryPolicy, timeout TimeoutPolicy, redact *redactor) (types.NodeOutput, int) {
+	sequence := r.next(nodeID)
+	if r.replay {
+		return r.load(ctx, nodeID, sequence), 1
+	}
+
+	output, attempts := executeValidated(ctx, instance, input, retry, timeout)
+	call := &RecordedCall{
+		RecordingID: r.recordingID,
+		NodeID:      nodeID,
+		Sequence:    sequence,
+		RecordedAt:  time.Now(),
+	}
+	call.Input, call.InputTruncated = r.payload(redact.fields(input.Data))
+	if output.Error != nil {
+		call.Error = redact.string(output.Error.Error())
+	} else {
+		call.Output, call.OutputTruncated = r.payload(redact.fields(output.Data))
+	}
+	if err := r.store.SaveCall(ctx, call); err != nil {
+		LoggerFromContext(ctx).Warn("Failed to record node call", map[string]interface{}{"error": err, "sequence": sequence})
+	}
+	return output, attempts
+}
+
+// payload returns the JSON of data, or nil and true when it is larger than
+// the recording limit
+func (r *callRecorder) payload(data map[string]interface{}) (json.RawMessage, bool) {
+	encoded, err := json.Marshal(data)
+	if err != nil || len(encoded) > r.maxPayload {
+		return nil, true
+	}
+	return encoded, false
+}
+
+// load returns the recorded output of the execution of nodeID with sequence
+func (r *callRecorder) load(ctx context.Context, nodeID string, sequence int) types.NodeOutput {
+	call, err := r.store.LoadCall(ctx, r.recordingID, nodeID, sequence)
+	if err != nil {
+		return types.NodeOutput{Error: nodeerrors.NewValidationError(
+			fmt.Sprintf("cannot replay call %d of node %s from recording %s", sequence, nodeID, r.recordingID), err)}
+	}
+	if call.Error != "" {
+		return types.NodeOutput{Error: errors.New(call.Error)}
+	}
+	if call.OutputTruncated {
+		return types.NodeOutput{Error: nodeerrors.NewValidationError(
+			fmt.Sprintf("call %d of node %s in recording %s was too large to record", sequence, nodeID, r.recordingID), nil)}
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(call.Output, &data); err != nil {
+		return types.NodeOutput{Error: fmt.Errorf("invalid recorded output of node %s: %w", nodeID, err)}
+	}
+	return types.NodeOutput{Data: data}
+}
+
+// MemoryCallStore keeps recorded calls in process memory. They are lost on
+// restart; use PostgresCallStore to keep them.
+type MemoryCallStore struct {
+	mu    sync.RWMutex
+	calls map[string]*RecordedCall
+}
+
+// NewMemoryCallStore creates an empty in-memory call store
+func NewMemoryCallStore() *MemoryCallStore {
+	return &MemoryCallStore{calls: make(map[string]*RecordedCall)}
+}
+
+func callKey(recordingID, nodeID string, sequence int) string {
+	return fmt.Sprintf("%s/%s/%d", recordingID, nodeID, sequence)
+}
+
+// SaveCall implements CallStore
+func (s *MemoryCallStore) SaveCall(ctx context.Context, call *RecordedCall) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *call
+	s.calls[callKey(call.RecordingID, call.NodeID, call.Sequence)] = &stored
+	return nil
+}
+
+// LoadCall implements CallStore
+func (s *MemoryCallStore) LoadCall(ctx context.Context, recordingID, nodeID string, sequence int) (*RecordedCall, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	call, ok := s.calls[callKey(recordingID, nodeID, sequence)]
+	if !ok {
+		return nil, ErrCallNotRecorded
+	}
+	loaded := *call
+	return &loaded, nil
+}
+
+// PostgresCallStore keeps recorded calls in the recorded_calls table
+type PostgresCallStore struct {
+	pool  PostgresPool
+	codec *StateCodec
+}
+
+// NewPostgresCallStore creates a call store on pool
+func NewPostgresCallStore(pool PostgresPool) *PostgresCallStore {
+	return &PostgresCallStore{pool: pool}
+}
+
+// SetStateCodec sets how recorded inputs and outputs are written, like
+// PostgresExecutionStore.SetStateCodec
+func (s *PostgresCallStore) SetStateCodec(codec *StateCodec) {
+	s.codec = codec
+}
+
+// SaveCall implements CallStore
+func (s *PostgresCallStore) SaveCall(ctx context.Context, call *RecordedCall) error {
+	input, err := s.codec.Encode(call.Input)
+	if err != nil {
+		return fmt.Errorf("failed to encode input: %w", err)
+	}
+	output, err := s.codec.Encode(call.Output)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO recorded_calls (recording_id, node_id, sequence, input, output, state_sealed, error, input_truncated, output_truncated, recorded_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (recording_id, node_id, sequence) DO UPDATE
+		SET input = EXCLUDED.input, output = EXCLUDED.output, state_sealed = EXCLUDED.state_sealed, error = EXCLUDED.error,
+			input_truncated = EXCLUDED.input_truncated, output_truncated = EXCLUDED.output_truncated,
+			recorded_at = EXCLUDED.recorded_at`,
+		call.RecordingID, call.NodeID, call.Sequence, input, output, s.codec.Seals(), call.Error,
+		call.InputTruncated, call.OutputTruncated, call.RecordedAt,
+	)
+	return err
+}
+
+// LoadCall implements CallStore
+func (s *PostgresCallStore) LoadCall(ctx context.Context, recordingID, nodeID string, sequence int) (*RecordedCall, error) {
+	call := &RecordedCall{RecordingID: recordingID, NodeID: nodeID, Sequence: sequence}
+	var input, output []byte
+	var sealed bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT input, output, state_sealed, error, input_truncated, output_truncated, recorded_at
+		FROM recorded_calls WHERE recording_id = $1 AND node_id = $2 AND sequence = $3`,
+		recordingID, nodeID, sequence,
+	).Scan(&input, &output, &sealed, &call.Error, &call.InputTruncated, &call.OutputTruncated, &call.RecordedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCallNotRecorded
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.codec.Decode(input, sealed, &call.Input); err != nil {
+		return nil, fmt.Errorf("failed to decode input: %w", err)
+	}
+	if err := s.codec.Decode(output, sealed, &call.Output); err != nil {
+		return nil, fmt.Errorf("failed to decode output: %w", err)
+	}
+	return call, nil
+}
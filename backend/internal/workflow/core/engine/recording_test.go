@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	httpnode "citadel-agent/backend/internal/nodes/http"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecordingExecutor(t *testing.T, store CallStore, maxPayload int) *WorkflowExecutor {
+	t.Helper()
+
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+	httpMeta := types.NodeMetadata{ID: "http_request", External: true}
+	require.NoError(t, registry.RegisterNodeType("http_request", AdaptNode(httpnode.NewHTTPRequestNode, httpMeta), httpMeta))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetCallStore(store, maxPayload)
+	return executor
+}
+
+func recordingWorkflow(url string) *Workflow {
+	return &Workflow{
+		ID: "quote",
+		Nodes: map[string]*WorkflowNode{
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": float64(2)}},
+			"fetch":  {ID: "fetch", Type: "http_request", Config: map[string]interface{}{"method": "POST", "url": url}},
+		},
+		Edges: []WorkflowEdge{{ID: "e1", Source: "double", Target: "fetch"}},
+	}
+}
+
+func TestRecordAndReplayHTTPCall(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"quote": 1.25, "request": %d}`, requests)
+	}))
+
+	store := NewMemoryCallStore()
+	executor := newRecordingExecutor(t, store, 0)
+	workflow := recordingWorkflow(server.URL)
+	inputs := map[string]interface{}{"item": float64(21)}
+
+	recorded, err := executor.Record(context.Background(), workflow, inputs)
+	require.NoError(t, err)
+	require.NotEmpty(t, recorded.RecordingID)
+	assert.Equal(t, 1, requests)
+
+	call, err := store.LoadCall(context.Background(), recorded.RecordingID, "fetch", 0)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"scaled": 42}`, string(call.Input))
+	assert.Contains(t, string(call.Output), `"quote":1.25`)
+	_, err = store.LoadCall(context.Background(), recorded.RecordingID, "double", 0)
+	assert.ErrorIs(t, err, ErrCallNotRecorded, "only external nodes are recorded")
+
+	// The service is gone, and would answer differently anyway
+	server.Close()
+	for i := 0; i < 2; i++ {
+		replayed, err := executor.Replay(context.Background(), workflow, inputs, recorded.RecordingID)
+		require.NoError(t, err)
+		body := replayed.Results["fetch"].(map[string]interface{})["body"]
+		assert.Equal(t, map[string]interface{}{"quote": 1.25, "request": float64(1)}, body)
+		assert.Equal(t, map[string]interface{}{"scaled": float64(42)}, replayed.Results["double"], "other nodes run")
+	}
+	assert.Equal(t, 1, requests)
+
+	_, err = executor.Replay(context.Background(), workflow, inputs, "rec_unknown")
+	assert.ErrorContains(t, err, "cannot replay call 0 of node fetch from recording rec_unknown")
+}
+
+func TestRecordingCapsPayloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1024)))
+	}))
+	defer server.Close()
+
+	store := NewMemoryCallStore()
+	executor := newRecordingExecutor(t, store, 256)
+	workflow := recordingWorkflow(server.URL)
+
+	inputs := map[string]interface{}{"item": float64(1)}
+	recorded, err := executor.Record(context.Background(), workflow, inputs)
+	require.NoError(t, err)
+	call, err := store.LoadCall(context.Background(), recorded.RecordingID, "fetch", 0)
+	require.NoError(t, err)
+	assert.False(t, call.InputTruncated)
+	assert.True(t, call.OutputTruncated)
+	assert.Nil(t, call.Output)
+
+	_, err = executor.Replay(context.Background(), workflow, inputs, recorded.RecordingID)
+	assert.ErrorContains(t, err, "was too large to record")
+}
+
+func TestRecordRequiresCallStore(t *testing.T) {
+	executor := NewWorkflowExecutor(NewNodeTypeRegistry())
+	_, err := executor.Record(context.Background(), &Workflow{ID: "w"}, nil)
+	assert.EqualError(t, err, "call recording is not configured")
+	_, err = executor.Replay(context.Background(), &Workflow{ID: "w"}, nil, "rec_1")
+	assert.EqualError(t, err, "call recording is not configured")
+}
+
+// externalTokenNode is a tokenNode that calls a service outside Citadel
+type externalTokenNode struct{ tokenNode }
+
+func (n *externalTokenNode) IsExternal() bool { return true }
+
+func TestRecordingRedactsCredentials(t *testing.T) {
+	registry := NewNodeTypeRegistry()
+	newNode := func() types.NodeInstance { return &externalTokenNode{tokenNode{used: new([]string)}} }
+	require.NoError(t, registry.RegisterNodeType("token", newNode, types.NodeMetadata{ID: "token"}))
+	store := NewMemoryCallStore()
+	executor := NewWorkflowExecutor(registry)
+	executor.SetCallStore(store, 0)
+	executor.SetCredentials(staticCredentials{"github_token": "ghp_secret"})
+
+	recorded, err := executor.Record(context.Background(), tokenWorkflow(map[string]interface{}{
+		"token": "Bearer {{ credentials.github_token }}",
+	}), nil)
+	require.NoError(t, err)
+	call, err := store.LoadCall(context.Background(), recorded.RecordingID, "call", 0)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"authorization": "Bearer [REDACTED]"}`, string(call.Output))
+	next, err := store.LoadCall(context.Background(), recorded.RecordingID, "next", 0)
+	require.NoError(t, err)
+	assert.NotContains(t, string(next.Input), "ghp_secret")
+
+	failed, err := executor.Record(context.Background(), tokenWorkflow(map[string]interface{}{
+		"token": "{{credentials.github_token}}",
+		"fail":  true,
+	}), nil)
+	require.Error(t, err)
+	call, err = store.LoadCall(context.Background(), failed.RecordingID, "call", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "request with [REDACTED] rejected", call.Error)
+}
@@ -12,6 +12,7 @@ type NodeTypeRegistryImpl struct {
 	mu      sync.RWMutex
 	nodeTypes map[string]func() types.NodeInstance
 	metadata map[string]types.NodeMetadata
+	migrations map[string][]NodeMigration
 }
 
 // NewNodeTypeRegistry creates a new node type registry
@@ -19,6 +20,7 @@ func NewNodeTypeRegistry() *NodeTypeRegistryImpl {
 	return &NodeTypeRegistryImpl{
 		nodeTypes: make(map[string]func() types.NodeInstance),
 		metadata:  make(map[string]types.NodeMetadata),
+		migrations: make(map[string][]NodeMigration),
 	}
 }
 
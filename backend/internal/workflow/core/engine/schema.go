@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"context"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"citadel-agent/backend/pkg/jsonschema"
+)
+
+// executeValidated runs instance under the policies, checking its input
+// against the input schema of its node type first and its output against
+// the output schema once it succeeds. A node given invalid input is not
+// run, and counts as a single failed attempt.
+func executeValidated(ctx context.Context, instance types.NodeInstance, input types.NodeInput, retry RetryPolicy, timeout TimeoutPolicy) (types.NodeOutput, int) {
+	metadata := instance.GetMetadata()
+	if err := validateData(metadata.InputSchema, input.Data); err != nil {
+		return types.NodeOutput{Error: nodeerrors.NewValidationError("invalid input", err)}, 1
+	}
+
+	output, attempts := executeWithPolicy(ctx, instance, input, retry, timeout)
+	if output.Error == nil {
+		if err := validateData(metadata.OutputSchema, output.Data); err != nil {
+			output.Error = nodeerrors.NewValidationError("invalid output", err)
+		}
+	}
+	return output, attempts
+}
+
+// validateData checks node data against schema. Nodes without data are
+// checked as having an empty object.
+func validateData(schema jsonschema.Schema, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return jsonschema.Validate(schema, data)
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sendEmailMeta = types.NodeMetadata{
+	ID: "send_email",
+	InputSchema: map[string]interface{}{
+		"type":     "object",
+		"required": []string{"to", "priority"},
+		"properties": map[string]interface{}{
+			"to":       map[string]interface{}{"type": "string"},
+			"retries":  map[string]interface{}{"type": "integer"},
+			"priority": map[string]interface{}{"type": "string", "enum": []string{"low", "high"}},
+		},
+	},
+	OutputSchema: map[string]interface{}{
+		"type":     "object",
+		"required": []string{"message_id"},
+		"properties": map[string]interface{}{
+			"message_id": map[string]interface{}{"type": "string"},
+		},
+	},
+}
+
+// sendEmailNode returns the output of its config, counting its runs
+type sendEmailNode struct {
+	output map[string]interface{}
+	runs   *int
+}
+
+func (n *sendEmailNode) Initialize(config map[string]interface{}) error {
+	n.output, _ = config["output"].(map[string]interface{})
+	return nil
+}
+func (n *sendEmailNode) Validate() error                 { return nil }
+func (n *sendEmailNode) Close() error                    { return nil }
+func (n *sendEmailNode) GetMetadata() types.NodeMetadata { return sendEmailMeta }
+
+func (n *sendEmailNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	*n.runs++
+	return types.NodeOutput{Data: n.output}
+}
+
+func runSendEmail(t *testing.T, inputs, output map[string]interface{}) (*WorkflowRun, int, error) {
+	t.Helper()
+
+	var runs int
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("send_email", func() types.NodeInstance { return &sendEmailNode{runs: &runs} }, sendEmailMeta))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(DefaultRetryPolicy())
+
+	run, err := executor.Run(context.Background(), &Workflow{
+		ID: "wf",
+		Nodes: map[string]*WorkflowNode{
+			"email": {ID: "email", Type: "send_email", Config: map[string]interface{}{"output": output}},
+		},
+	}, inputs)
+	return run, runs, err
+}
+
+func TestExecutorValidatesInputAgainstSchema(t *testing.T) {
+	output := map[string]interface{}{"message_id": "m-1"}
+	tests := []struct {
+		name    string
+		inputs  map[string]interface{}
+		message string
+	}{
+		{"missing required field", map[string]interface{}{"to": "a@example.com"}, "$.priority: is required"},
+		{"type mismatch", map[string]interface{}{"to": "a@example.com", "priority": "low", "retries": "3"}, "$.retries: expected integer, got string"},
+		{"enum constraint", map[string]interface{}{"to": "a@example.com", "priority": "urgent"}, `$.priority: must be one of ["low", "high"], got "urgent"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run, runs, err := runSendEmail(t, tt.inputs, output)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid input: "+tt.message)
+			assert.Equal(t, nodeerrors.CodeValidation, nodeerrors.CodeOf(err))
+			assert.Zero(t, runs, "a node given invalid input is not run, nor retried")
+
+			result := run.NodeResults["email"]
+			assert.Equal(t, types.NodeFailed, result.Status)
+			assert.Zero(t, result.RetryCount)
+		})
+	}
+
+	_, runs, err := runSendEmail(t, map[string]interface{}{"to": "a@example.com", "priority": "high", "retries": 2}, output)
+	require.NoError(t, err)
+	assert.Equal(t, 1, runs)
+}
+
+func TestExecutorValidatesOutputAgainstSchema(t *testing.T) {
+	inputs := map[string]interface{}{"to": "a@example.com", "priority": "low"}
+
+	_, runs, err := runSendEmail(t, inputs, map[string]interface{}{"message_id": 42})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid output: $.message_id: expected string, got integer")
+	assert.Equal(t, 1, runs)
+
+	_, _, err = runSendEmail(t, inputs, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid output: $.message_id: is required")
+}
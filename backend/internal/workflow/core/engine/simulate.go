@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+)
+
+// SimulatedOutputKey is set in the output of nodes stubbed by a simulated
+// run without a mocked output
+const SimulatedOutputKey = "simulated"
+
+// Simulation configures a simulated run, in which nodes with side effects
+// are stubbed instead of executed while the others run as usual.
+type Simulation struct {
+	// Mocks are the outputs stubbed nodes return, by node ID. Stubbed nodes
+	// without one pass their input on, with SimulatedOutputKey set.
+	Mocks map[string]map[string]interface{}
+}
+
+// SideEffecting is implemented by nodes whose effects outside the workflow
+// depend on their config, such as HTTP nodes, which only change the remote
+// resource with some methods. Node types that always have side effects set
+// the SideEffects flag of their metadata instead.
+type SideEffecting interface {
+	HasSideEffects() bool
+}
+
+type simulationContextKey struct{}
+
+// Simulate runs a workflow as Run does, but stubs the nodes with side
+// effects, which are listed in the Stubbed field of the run. Loop bodies are
+// simulated too. Simulated runs are not persisted.
+func (we *WorkflowExecutor) Simulate(ctx context.Context, workflow *Workflow, inputs map[string]interface{}, simulation Simulation) (*WorkflowRun, error) {
+	ctx = context.WithValue(ctx, simulationContextKey{}, &simulation)
+	ctx, release := we.cancellable(ctx, nil)
+	defer release()
+	return we.execute(ctx, workflow, inputs, nil)
+}
+
+// hasSideEffects reports whether instance acts outside the workflow, as
+// declared by its metadata or by the node behind it, looking through
+// adapters
+func hasSideEffects(instance types.NodeInstance) bool {
+	if instance.GetMetadata().SideEffects {
+		return true
+	}
+	var node interface{} = instance
+	if adapted, ok := instance.(*adaptedNode); ok {
+		node = adapted.node
+	}
+	declared, ok := node.(SideEffecting)
+	return ok && declared.HasSideEffects()
+}
+
+// executeOrStub runs instance as executeValidated does, unless ctx belongs
+// to a simulated run and the node has side effects, in which case it
+// returns the stubbed output of nodeID and reports it was stubbed. The
+// external nodes of recorded and replayed runs go through their recorder.
+func executeOrStub(ctx context.Context, nodeID string, instance types.NodeInstance, input types.NodeInput, retry RetryPolicy, timeout TimeoutPolicy, redact *redactor) (types.NodeOutput, int, bool) {
+	simulation, ok := ctx.Value(simulationContextKey{}).(*Simulation)
+	if !ok || !hasSideEffects(instance) {
+		if recorder, ok := ctx.Value(recorderContextKey{}).(*callRecorder); ok && isExternal(instance) {
+			output, attempts := recorder.execute(ctx, nodeID, instance, input, retry, timeout, redact)
+			return output, attempts, false
+		}
+		output, attempts := executeValidated(ctx, instance, input, retry, timeout)
+		return output, attempts, false
+	}
+
+	if mock, ok := simulation.Mocks[nodeID]; ok {
+		return types.NodeOutput{Data: copyConfig(mock)}, 1, true
+	}
+	data := make(map[string]interface{}, len(input.Data)+1)
+	for key, value := range input.Data {
+		data[key] = value
+	}
+	data[SimulatedOutputKey] = true
+	return types.NodeOutput{Data: data}, 1, true
+}
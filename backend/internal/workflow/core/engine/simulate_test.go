@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"citadel-agent/backend/internal/interfaces"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// callNode counts the requests it sends with its configured method, which
+// only has side effects when it is not GET
+type callNode struct {
+	method string
+	calls  *int
+}
+
+func (n *callNode) Execute(ctx context.Context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	*n.calls++
+	return map[string]interface{}{"status": float64(200)}, nil
+}
+
+func (n *callNode) HasSideEffects() bool { return n.method != "GET" }
+func (n *callNode) GetType() string      { return "call" }
+func (n *callNode) GetID() string        { return "call" }
+
+func newSimulationExecutor(t *testing.T, calls, commands *int) *WorkflowExecutor {
+	t.Helper()
+
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+	callMeta := types.NodeMetadata{ID: "call"}
+	require.NoError(t, registry.RegisterNodeType("call", AdaptNode(func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		method, _ := config["method"].(string)
+		return &callNode{method: method, calls: calls}, nil
+	}, callMeta), callMeta))
+	commandMeta := types.NodeMetadata{ID: "command", SideEffects: true}
+	require.NoError(t, registry.RegisterNodeType("command", AdaptNode(func(config map[string]interface{}) (interfaces.NodeInstance, error) {
+		return &callNode{method: "GET", calls: commands}, nil
+	}, commandMeta), commandMeta))
+	return NewWorkflowExecutor(registry)
+}
+
+func simulationWorkflow() *Workflow {
+	return &Workflow{
+		ID: "notify",
+		Nodes: map[string]*WorkflowNode{
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": float64(2)}},
+			"notify": {ID: "notify", Type: "call", Config: map[string]interface{}{"method": "POST"}},
+			"status": {ID: "status", Type: "call", Config: map[string]interface{}{"method": "GET"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "double", Target: "notify"},
+			{ID: "e2", Source: "notify", Target: "status"},
+		},
+	}
+}
+
+func TestSimulateStubsNodesWithSideEffects(t *testing.T) {
+	var calls, commands int
+	executor := newSimulationExecutor(t, &calls, &commands)
+	workflow := simulationWorkflow()
+	workflow.Nodes["cleanup"] = &WorkflowNode{ID: "cleanup", Type: "command"}
+	workflow.Edges = append(workflow.Edges, WorkflowEdge{ID: "e3", Source: "status", Target: "cleanup"})
+
+	run, err := executor.Simulate(context.Background(), workflow, map[string]interface{}{"item": float64(21)}, Simulation{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "only the GET request is sent")
+	assert.Zero(t, commands, "node types declaring side effects are stubbed whatever their config")
+	assert.Equal(t, []string{"notify", "cleanup"}, run.Stubbed)
+
+	assert.Equal(t, map[string]interface{}{"scaled": float64(42)}, run.Results["double"], "transform nodes run")
+	assert.Equal(t, map[string]interface{}{"scaled": float64(42), SimulatedOutputKey: true}, run.Results["notify"])
+	assert.True(t, run.NodeResults["notify"].Simulated)
+	assert.False(t, run.NodeResults["status"].Simulated)
+	assert.Equal(t, types.NodeCompleted, run.NodeResults["cleanup"].Status)
+
+	// Real runs execute every node
+	run, err = executor.Run(context.Background(), workflow, map[string]interface{}{"item": float64(21)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1, commands)
+	assert.Empty(t, run.Stubbed)
+}
+
+func TestSimulateReturnsMockedOutputs(t *testing.T) {
+	var calls, commands int
+	executor := newSimulationExecutor(t, &calls, &commands)
+	mock := map[string]interface{}{"status": float64(202), "id": "msg-1"}
+
+	run, err := executor.Simulate(context.Background(), simulationWorkflow(), map[string]interface{}{"item": float64(1)}, Simulation{
+		Mocks: map[string]map[string]interface{}{"notify": mock},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, mock, run.Results["notify"])
+	assert.Equal(t, map[string]interface{}{"status": float64(202), "id": "msg-1"}, run.NodeResults["status"].InputsUsed, "downstream nodes get the mocked output")
+
+	run.Results["notify"].(map[string]interface{})["id"] = "changed"
+	assert.Equal(t, "msg-1", mock["id"], "mocks are copied")
+}
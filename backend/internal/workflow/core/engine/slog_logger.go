@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"citadel-agent/backend/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Field names used for the execution context of log records
+const (
+	LogFieldWorkflowID  = "workflow_id"
+	LogFieldExecutionID = "execution_id"
+	LogFieldNodeID      = "node_id"
+)
+
+// SlogLogger implements Logger on top of log/slog
+type SlogLogger struct {
+	logger *slog.Logger
+	closer io.Closer
+}
+
+// NewSlogLogger creates a logger from the logging configuration: level
+// (debug, info, warn, error), format (json, text) and output (stdout,
+// stderr, file, or both for stdout and file). File output is rotated
+// according to MaxSize, MaxBackups, MaxAge and Compress.
+func NewSlogLogger(cfg *config.LoggingConfig) (*SlogLogger, error) {
+	if cfg == nil {
+		cfg = config.DefaultEngineConfig().LoggingConfig
+	}
+
+	level, err := parseLogLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out    io.Writer
+		closer io.Closer
+	)
+	switch strings.ToLower(cfg.Output) {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	case "file", "both":
+		if cfg.Filepath == "" {
+			return nil, fmt.Errorf("logging output %q requires a filepath", cfg.Output)
+		}
+		file := &lumberjack.Logger{
+			Filename:   cfg.Filepath,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+			Compress:   cfg.Compress,
+		}
+		out, closer = file, file
+		if strings.EqualFold(cfg.Output, "both") {
+			out = io.MultiWriter(os.Stdout, file)
+		}
+	default:
+		return nil, fmt.Errorf("unknown logging output: %s", cfg.Output)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(out, options)
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	default:
+		return nil, fmt.Errorf("unknown logging format: %s", cfg.Format)
+	}
+
+	return &SlogLogger{logger: slog.New(handler), closer: closer}, nil
+}
+
+// NewSlogLoggerFrom wraps an existing slog logger, such as slog.Default()
+func NewSlogLoggerFrom(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger: logger}
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level: %s", level)
+	}
+}
+
+// Debug logs a debug message
+func (l *SlogLogger) Debug(msg string, fields ...map[string]interface{}) {
+	l.log(slog.LevelDebug, msg, fields)
+}
+
+// Info logs an info message
+func (l *SlogLogger) Info(msg string, fields ...map[string]interface{}) {
+	l.log(slog.LevelInfo, msg, fields)
+}
+
+// Warn logs a warning message
+func (l *SlogLogger) Warn(msg string, fields ...map[string]interface{}) {
+	l.log(slog.LevelWarn, msg, fields)
+}
+
+// Error logs an error message
+func (l *SlogLogger) Error(msg string, fields ...map[string]interface{}) {
+	l.log(slog.LevelError, msg, fields)
+}
+
+// With returns a logger that adds fields to every record
+func (l *SlogLogger) With(fields map[string]interface{}) Logger {
+	return &SlogLogger{logger: l.logger.With(attrs(fields)...), closer: l.closer}
+}
+
+// Close closes the log file, if any
+func (l *SlogLogger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+func (l *SlogLogger) log(level slog.Level, msg string, fields []map[string]interface{}) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	var args []any
+	for _, f := range fields {
+		args = append(args, attrs(f)...)
+	}
+	l.logger.Log(ctx, level, msg, args...)
+}
+
+// attrs converts fields to slog attributes, sorted by key so that records
+// are written in a stable order
+func attrs(fields map[string]interface{}) []any {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]any, 0, len(keys))
+	for _, k := range keys {
+		value := fields[k]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		args = append(args, slog.Any(k, value))
+	}
+	return args
+}
+
+type loggerContextKey struct{}
+
+// ContextWithLogger returns a context carrying logger. The executor passes
+// each node a logger scoped to its workflow, execution and node.
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the logger carried by ctx, or a no-op logger
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(Logger); ok && logger != nil {
+		return logger
+	}
+	return NewNopLogger()
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"citadel-agent/backend/config"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// greetNode logs through the logger the executor puts in its context
+type greetNode struct{}
+
+func (n *greetNode) Initialize(config map[string]interface{}) error { return nil }
+func (n *greetNode) Validate() error                                { return nil }
+func (n *greetNode) Close() error                                   { return nil }
+func (n *greetNode) GetMetadata() types.NodeMetadata                { return types.NodeMetadata{ID: "greet"} }
+
+func (n *greetNode) Execute(ctx context.Context, input types.NodeInput) types.NodeOutput {
+	LoggerFromContext(ctx).Info("hello", map[string]interface{}{"name": "citadel"})
+	return types.NodeOutput{Data: map[string]interface{}{}}
+}
+
+func TestExecutorLogsCarryExecutionContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLoggerFrom(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	registry := NewNodeTypeRegistry()
+	require.NoError(t, registry.RegisterNodeType("greet", func() types.NodeInstance { return &greetNode{} }, types.NodeMetadata{ID: "greet"}))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(NewMemoryExecutionStore())
+	executor.SetLogger(logger)
+
+	run, err := executor.Run(context.Background(), &Workflow{
+		ID:    "greeting",
+		Nodes: map[string]*WorkflowNode{"greet": {ID: "greet", Type: "greet"}},
+	}, nil)
+	require.NoError(t, err)
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	require.NotEmpty(t, records)
+
+	for _, record := range records {
+		assert.Equal(t, "greeting", record[LogFieldWorkflowID], record["msg"])
+		assert.Equal(t, run.ExecutionID, record[LogFieldExecutionID], record["msg"])
+	}
+
+	var hello map[string]interface{}
+	for _, record := range records {
+		if record["msg"] == "hello" {
+			hello = record
+		}
+	}
+	require.NotNil(t, hello, "node log record")
+	assert.Equal(t, "greet", hello[LogFieldNodeID])
+	assert.Equal(t, "citadel", hello["name"])
+	assert.Equal(t, "INFO", hello["level"])
+}
+
+func TestSlogLoggerWritesConfiguredFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.log")
+	logger, err := NewSlogLogger(&config.LoggingConfig{
+		Level:    "warn",
+		Format:   "text",
+		Output:   "file",
+		Filepath: path,
+		MaxSize:  1,
+	})
+	require.NoError(t, err)
+
+	scoped := logger.With(map[string]interface{}{LogFieldExecutionID: "exec_1"})
+	scoped.Info("dropped below warn")
+	scoped.Warn("disk almost full", map[string]interface{}{"free_mb": 12})
+	require.NoError(t, logger.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "dropped below warn")
+	assert.Contains(t, string(data), `msg="disk almost full"`)
+	assert.Contains(t, string(data), "execution_id=exec_1")
+	assert.Contains(t, string(data), "free_mb=12")
+}
+
+func TestNewSlogLoggerRejectsInvalidConfig(t *testing.T) {
+	_, err := NewSlogLogger(&config.LoggingConfig{Level: "loud"})
+	assert.Error(t, err)
+
+	_, err = NewSlogLogger(&config.LoggingConfig{Format: "xml"})
+	assert.Error(t, err)
+
+	_, err = NewSlogLogger(&config.LoggingConfig{Output: "file"})
+	assert.Error(t, err, "file output without a filepath")
+}
+
+func TestNilLoggerIsReplacedWithNop(t *testing.T) {
+	e := NewEngine(&Config{})
+	assert.NotPanics(t, func() {
+		_, err := e.ExecuteWorkflow(context.Background(), &types.Workflow{ID: "wf"}, nil)
+		require.NoError(t, err)
+	})
+	assert.NotPanics(t, func() { LoggerFromContext(context.Background()).Info("ignored") })
+}
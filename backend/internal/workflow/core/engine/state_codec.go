@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MinStateKeyLength is the shortest encryption key accepted for execution
+// state
+const MinStateKeyLength = 32
+
+// PersistenceConfig selects how execution state is written at rest
+type PersistenceConfig struct {
+	// Compression gzips node outputs and trigger inputs
+	Compression bool
+	// Encryption seals them with AES-GCM under a key derived from
+	// EncryptionKey
+	Encryption    bool
+	EncryptionKey string
+}
+
+// Encodings of sealed state
+const (
+	stateGzip       = "gzip"
+	stateAESGCM     = "aes-gcm"
+	stateGzipAESGCM = "gzip+aes-gcm"
+)
+
+// maxStateSize bounds decompressed state, so that a small compressed row
+// cannot expand without limit
+const maxStateSize = 64 << 20
+
+// stateEnvelope is how compressed or encrypted state is stored, so that it
+// remains a JSON document. Stores keep whether a row is sealed in a column
+// of its own, since plain JSON can look just like an envelope.
+type stateEnvelope struct {
+	Encoding string `json:"$state"`
+	Data     []byte `json:"data"`
+}
+
+// StateCodec encodes the execution state PostgresExecutionStore writes. A
+// nil codec writes plain JSON.
+type StateCodec struct {
+	compress bool
+	aead     cipher.AEAD
+}
+
+// NewStateCodec creates the codec for config. It returns nil when config
+// neither compresses nor encrypts.
+func NewStateCodec(config PersistenceConfig) (*StateCodec, error) {
+	if !config.Compression && !config.Encryption {
+		return nil, nil
+	}
+
+	codec := &StateCodec{compress: config.Compression}
+	if config.Encryption {
+		if len(config.EncryptionKey) < MinStateKeyLength {
+			return nil, fmt.Errorf("state encryption key must be at least %d characters", MinStateKeyLength)
+		}
+		key, err := hkdf.Key(sha256.New, []byte(config.EncryptionKey), nil, "citadel execution state", 32)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if codec.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return codec, nil
+}
+
+// Seals reports whether Encode writes sealed state, which must be read
+// back with sealed set
+func (c *StateCodec) Seals() bool {
+	return c != nil
+}
+
+// Encode returns v as JSON, compressed and then encrypted as configured
+func (c *StateCodec) Encode(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || c == nil {
+		return data, err
+	}
+
+	var encodings []string
+	if c.compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+		encodings = append(encodings, stateGzip)
+	}
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		data = c.aead.Seal(nonce, nonce, data, nil)
+		encodings = append(encodings, stateAESGCM)
+	}
+	return json.Marshal(stateEnvelope{Encoding: strings.Join(encodings, "+"), Data: data})
+}
+
+// Decode reads what Encode wrote into v; sealed tells whether it was
+// written by a codec that Seals. Plain JSON is read as it is, so state
+// written before encoding was enabled stays readable; encrypted state
+// cannot be read without the key it was written with.
+func (c *StateCodec) Decode(data []byte, sealed bool, v interface{}) error {
+	if !sealed {
+		return json.Unmarshal(data, v)
+	}
+	var envelope stateEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid sealed state: %w", err)
+	}
+
+	plain := envelope.Data
+	switch envelope.Encoding {
+	case stateGzip:
+	case stateAESGCM, stateGzipAESGCM:
+		if c == nil || c.aead == nil {
+			return errors.New("state is encrypted but no encryption key is configured")
+		}
+		size := c.aead.NonceSize()
+		if len(plain) < size {
+			return errors.New("encrypted state is truncated")
+		}
+		var err error
+		if plain, err = c.aead.Open(nil, plain[:size], plain[size:], nil); err != nil {
+			return fmt.Errorf("failed to decrypt state: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown state encoding %q", envelope.Encoding)
+	}
+
+	if envelope.Encoding == stateGzip || envelope.Encoding == stateGzipAESGCM {
+		zr, err := gzip.NewReader(bytes.NewReader(plain))
+		if err != nil {
+			return fmt.Errorf("failed to decompress state: %w", err)
+		}
+		defer zr.Close()
+		if plain, err = io.ReadAll(io.LimitReader(zr, maxStateSize+1)); err != nil {
+			return fmt.Errorf("failed to decompress state: %w", err)
+		}
+		if len(plain) > maxStateSize {
+			return fmt.Errorf("decompressed state exceeds %d bytes", maxStateSize)
+		}
+	}
+	return json.Unmarshal(plain, v)
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testStateKey = "0123456789abcdef0123456789abcdef"
+
+func TestStateCodecRoundTripsEncryptedCompressedState(t *testing.T) {
+	codec, err := NewStateCodec(PersistenceConfig{Compression: true, Encryption: true, EncryptionKey: testStateKey})
+	require.NoError(t, err)
+
+	output := map[string]interface{}{
+		"customer": "alice@example.com",
+		"notes":    strings.Repeat("confidential ", 100),
+	}
+	data, err := codec.Encode(output)
+	require.NoError(t, err)
+
+	// What is stored is a JSON document that gives nothing away
+	assert.True(t, json.Valid(data))
+	assert.False(t, bytes.Contains(data, []byte("alice@example.com")))
+	assert.False(t, bytes.Contains(data, []byte("confidential")))
+	assert.Contains(t, string(data), stateGzipAESGCM)
+	assert.Less(t, len(data), len(output["notes"].(string)), "compressed before encryption")
+
+	var decoded map[string]interface{}
+	require.NoError(t, codec.Decode(data, codec.Seals(), &decoded))
+	assert.Equal(t, output, decoded)
+}
+
+func TestStateCodecCompressionOnly(t *testing.T) {
+	codec, err := NewStateCodec(PersistenceConfig{Compression: true})
+	require.NoError(t, err)
+
+	data, err := codec.Encode(map[string]interface{}{"n": 1.0})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"$state":"gzip"`)
+
+	// Compressed state is readable without a key
+	var decoded map[string]interface{}
+	require.NoError(t, (*StateCodec)(nil).Decode(data, true, &decoded))
+	assert.Equal(t, map[string]interface{}{"n": 1.0}, decoded)
+}
+
+func TestStateCodecReadsPlainState(t *testing.T) {
+	codec, err := NewStateCodec(PersistenceConfig{Encryption: true, EncryptionKey: testStateKey})
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, codec.Decode([]byte(`{"written":"before encryption"}`), false, &decoded))
+	assert.Equal(t, "before encryption", decoded["written"])
+}
+
+func TestStateCodecReadsPlainStateThatLooksSealed(t *testing.T) {
+	codec, err := NewStateCodec(PersistenceConfig{Encryption: true, EncryptionKey: testStateKey})
+	require.NoError(t, err)
+
+	output := map[string]interface{}{"$state": "aes-gcm", "data": "bm90IHNlYWxlZA=="}
+	data, err := (*StateCodec)(nil).Encode(output)
+	require.NoError(t, err)
+	assert.False(t, (*StateCodec)(nil).Seals())
+	for _, c := range []*StateCodec{nil, codec} {
+		var decoded map[string]interface{}
+		require.NoError(t, c.Decode(data, false, &decoded))
+		assert.Equal(t, output, decoded)
+	}
+}
+
+func TestStateCodecBoundsDecompressedState(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(make([]byte, maxStateSize+1))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	data, err := json.Marshal(stateEnvelope{Encoding: stateGzip, Data: buf.Bytes()})
+	require.NoError(t, err)
+
+	var decoded interface{}
+	err = (*StateCodec)(nil).Decode(data, true, &decoded)
+	assert.EqualError(t, err, fmt.Sprintf("decompressed state exceeds %d bytes", maxStateSize))
+}
+
+func TestStateCodecRequiresTheKeyItWasWrittenWith(t *testing.T) {
+	codec, err := NewStateCodec(PersistenceConfig{Encryption: true, EncryptionKey: testStateKey})
+	require.NoError(t, err)
+	data, err := codec.Encode(map[string]interface{}{"secret": "value"})
+	require.NoError(t, err)
+
+	other, err := NewStateCodec(PersistenceConfig{Encryption: true, EncryptionKey: strings.Repeat("k", MinStateKeyLength)})
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	assert.Error(t, other.Decode(data, true, &decoded))
+	assert.Error(t, (*StateCodec)(nil).Decode(data, true, &decoded))
+}
+
+func TestNewStateCodec(t *testing.T) {
+	codec, err := NewStateCodec(PersistenceConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, codec, "plain JSON needs no codec")
+
+	_, err = NewStateCodec(PersistenceConfig{Encryption: true, EncryptionKey: "short"})
+	assert.Error(t, err)
+}
@@ -1,179 +1,203 @@
 package engine
 
 import (
-	"sync"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrWorkflowNotFound is returned by a Storage for unknown workflow IDs
+var ErrWorkflowNotFound = errors.New("workflow not found")
 
+// Storage drivers accepted by NewStorage
+const (
+	StorageMemory   = "memory"
+	StoragePostgres = "postgres"
+)
 
-// BasicStorage provides a basic in-memory implementation for testing
-type BasicStorage struct {
-	executions    map[string]*types.Execution
-	nodeResults   map[string]*types.NodeResult
-	workflows     map[string]*types.Workflow
-	variables     map[string]map[string]interface{} // execution_id -> key -> value
-	mutex         sync.RWMutex
-}
-
-// NewBasicStorage creates a new in-memory storage for testing
-func NewBasicStorage() *BasicStorage {
-	return &BasicStorage{
-		executions:  make(map[string]*types.Execution),
-		nodeResults: make(map[string]*types.NodeResult),
-		workflows:   make(map[string]*types.Workflow),
-		variables:   make(map[string]map[string]interface{}),
+// NewStorage creates the Storage selected by driver. The postgres driver
+// connects to databaseURL; call Close on the returned PostgresStorage to
+// release the connection pool.
+func NewStorage(ctx context.Context, driver, databaseURL string) (Storage, error) {
+	switch strings.ToLower(driver) {
+	case "", StorageMemory:
+		return NewMemoryStorage(), nil
+	case StoragePostgres:
+		pool, err := pgxpool.New(ctx, databaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		if err := pool.Ping(ctx); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return NewPostgresStorage(pool), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", driver)
 	}
 }
 
-// Implementation of Storage interface methods would go here
-// For brevity, I'll implement the most essential ones:
+// MemoryStorage is an in-memory Storage, for tests and for running without
+// a database. Its contents are lost when the process exits.
+type MemoryStorage struct {
+	*MemoryExecutionStore
 
-func (bs *BasicStorage) CreateExecution(execution *types.Execution) error {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-	
-	bs.executions[execution.ID] = execution
-	return nil
+	nextWorkflowID int64
+	workflows      map[string]*types.Workflow
 }
 
-func (bs *BasicStorage) UpdateExecution(execution *types.Execution) error {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-	
-	bs.executions[execution.ID] = execution
-	return nil
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		MemoryExecutionStore: NewMemoryExecutionStore(),
+		workflows:            make(map[string]*types.Workflow),
+	}
 }
 
-func (bs *BasicStorage) GetExecution(id string) (*types.Execution, error) {
-	bs.mutex.RLock()
-	defer bs.mutex.RUnlock()
-	
-	execution, exists := bs.executions[id]
-	if !exists {
-		return nil, &types.WorkflowValidationError{
-			Errors: []types.ValidationError{
-				{
-					Field:   "execution_id",
-					Message: "execution not found",
-					Code:    "EXECUTION_NOT_FOUND",
-					Value:   id,
-				},
-			},
+// GetExecution implements Storage
+func (m *MemoryStorage) GetExecution(ctx context.Context, id string) (*types.Execution, error) {
+	execution, _, err := m.LoadExecution(ctx, id)
+	return execution, err
+}
+
+// ListExecutions implements Storage
+func (m *MemoryStorage) ListExecutions(ctx context.Context, workflowID string, limit, offset int) ([]*types.Execution, error) {
+	m.mu.Lock()
+	var executions []*types.Execution
+	for _, stored := range m.executions {
+		if workflowID == "" || stored.WorkflowID == workflowID {
+			execution := copyExecution(stored)
+			execution.NodeResults = nil
+			executions = append(executions, execution)
 		}
 	}
-	
-	return execution, nil
+	m.mu.Unlock()
+
+	sort.Slice(executions, func(i, j int) bool {
+		if !executions[i].StartedAt.Equal(executions[j].StartedAt) {
+			return executions[i].StartedAt.After(executions[j].StartedAt)
+		}
+		return executions[i].ID > executions[j].ID
+	})
+	return paginate(executions, limit, offset), nil
 }
 
-func (bs *BasicStorage) ListExecutions(workflowID string, limit, offset int) ([]*types.Execution, error) {
-	bs.mutex.RLock()
-	defer bs.mutex.RUnlock()
-	
-	var results []*types.Execution
-	for _, exec := range bs.executions {
-		if exec.WorkflowID == workflowID {
-			results = append(results, exec)
+// SaveWorkflow implements Storage
+func (m *MemoryStorage) SaveWorkflow(ctx context.Context, workflow *types.Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if workflow.ID == "" {
+		m.nextWorkflowID++
+		workflow.ID = strconv.FormatInt(m.nextWorkflowID, 10)
+		workflow.CreatedAt = now
+	} else {
+		stored, ok := m.workflows[workflow.ID]
+		if !ok {
+			return ErrWorkflowNotFound
 		}
+		workflow.CreatedAt = stored.CreatedAt
 	}
-	
-	// Apply pagination
-	if offset < len(results) {
-		results = results[offset:]
+	workflow.UpdatedAt = now
+	if workflow.Status == "" {
+		workflow.Status = types.WorkflowActive
 	}
-	if limit > 0 && limit < len(results) {
-		results = results[:limit]
+
+	stored, err := copyWorkflow(workflow)
+	if err != nil {
+		return err
 	}
-	
-	return results, nil
+	m.workflows[workflow.ID] = stored
+	return nil
 }
 
-func (bs *BasicStorage) CreateNodeResult(result *types.NodeResult) error {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-	
-	bs.nodeResults[result.ID] = result
-	return nil
+// GetWorkflow implements Storage
+func (m *MemoryStorage) GetWorkflow(ctx context.Context, id string) (*types.Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.workflows[id]
+	if !ok {
+		return nil, ErrWorkflowNotFound
+	}
+	return copyWorkflow(stored)
 }
 
-func (bs *BasicStorage) GetNodeResult(executionID, nodeID string) (*types.NodeResult, error) {
-	bs.mutex.RLock()
-	defer bs.mutex.RUnlock()
-	
-	for _, result := range bs.nodeResults {
-		if result.ExecutionID == executionID && result.NodeID == nodeID {
-			return result, nil
+// ListWorkflows implements Storage
+func (m *MemoryStorage) ListWorkflows(ctx context.Context, limit, offset int) ([]*types.Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workflows := make([]*types.Workflow, 0, len(m.workflows))
+	for _, stored := range m.workflows {
+		workflow, err := copyWorkflow(stored)
+		if err != nil {
+			return nil, err
 		}
+		workflows = append(workflows, workflow)
 	}
-	
-	return nil, &types.WorkflowValidationError{
-		Errors: []types.ValidationError{
-			{
-				Field:   "node_result",
-				Message: "node result not found",
-				Code:    "NODE_RESULT_NOT_FOUND",
-				Value:   map[string]string{"execution_id": executionID, "node_id": nodeID},
-			},
-		},
-	}
-}
 
-func (bs *BasicStorage) CreateWorkflow(workflow *types.Workflow) error {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-	
-	bs.workflows[workflow.ID] = workflow
-	return nil
+	sort.Slice(workflows, func(i, j int) bool {
+		a, _ := strconv.ParseInt(workflows[i].ID, 10, 64)
+		b, _ := strconv.ParseInt(workflows[j].ID, 10, 64)
+		return a < b
+	})
+	return paginate(workflows, limit, offset), nil
 }
 
-func (bs *BasicStorage) GetWorkflow(id string) (*types.Workflow, error) {
-	bs.mutex.RLock()
-	defer bs.mutex.RUnlock()
-	
-	workflow, exists := bs.workflows[id]
-	if !exists {
-		return nil, &types.WorkflowValidationError{
-			Errors: []types.ValidationError{
-				{
-					Field:   "workflow_id",
-					Message: "workflow not found",
-					Code:    "WORKFLOW_NOT_FOUND",
-					Value:   id,
-				},
-			},
+// DeleteWorkflow implements Storage
+func (m *MemoryStorage) DeleteWorkflow(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.workflows[id]; !ok {
+		return ErrWorkflowNotFound
+	}
+	delete(m.workflows, id)
+
+	for executionID, execution := range m.executions {
+		if execution.WorkflowID == id {
+			delete(m.executions, executionID)
+			delete(m.MemoryExecutionStore.workflows, executionID)
 		}
 	}
-	
-	return workflow, nil
+	return nil
 }
 
-func (bs *BasicStorage) GetVariable(executionID, key string) (interface{}, error) {
-	bs.mutex.RLock()
-	defer bs.mutex.RUnlock()
-	
-	varMap, exists := bs.variables[executionID]
-	if !exists {
-		return nil, nil
+// copyWorkflow deep-copies a workflow so that callers cannot modify the
+// stored definition
+func copyWorkflow(workflow *types.Workflow) (*types.Workflow, error) {
+	data, err := json.Marshal(workflow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode workflow: %w", err)
 	}
-	
-	value, exists := varMap[key]
-	if !exists {
-		return nil, nil
+	var c types.Workflow
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode workflow: %w", err)
 	}
-	
-	return value, nil
+	return &c, nil
 }
 
-func (bs *BasicStorage) SetVariable(executionID, key string, value interface{}) error {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-	
-	if bs.variables[executionID] == nil {
-		bs.variables[executionID] = make(map[string]interface{})
+// paginate returns the page of items starting at offset. A limit of zero or
+// less returns all remaining items.
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
 	}
-	
-	bs.variables[executionID][key] = value
-	return nil
+	if offset > 0 {
+		items = items[offset:]
+	}
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
 }
-
@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresStorage implements Storage on top of the workflows, executions and
+// node_executions tables created by cmd/migrate
+type PostgresStorage struct {
+	*PostgresExecutionStore
+}
+
+// NewPostgresStorage creates a new Postgres-backed storage
+func NewPostgresStorage(pool PostgresPool) *PostgresStorage {
+	return &PostgresStorage{PostgresExecutionStore: NewPostgresExecutionStore(pool)}
+}
+
+// Close releases the connection pool
+func (s *PostgresStorage) Close() {
+	s.pool.Close()
+}
+
+// GetExecution implements Storage
+func (s *PostgresStorage) GetExecution(ctx context.Context, id string) (*types.Execution, error) {
+	execution, _, err := s.LoadExecution(ctx, id)
+	return execution, err
+}
+
+// ListExecutions implements Storage
+func (s *PostgresStorage) ListExecutions(ctx context.Context, workflowID string, limit, offset int) ([]*types.Execution, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, COALESCE(definition->>'id', workflow_id::text, ''), status, triggered_by, error, COALESCE(started_at, created_at), completed_at
+		FROM executions
+		WHERE $1 = '' OR COALESCE(definition->>'id', workflow_id::text) = $1
+		ORDER BY COALESCE(started_at, created_at) DESC, id DESC
+		LIMIT $2 OFFSET $3`,
+		workflowID, sqlLimit(limit), offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []*types.Execution{}
+	for rows.Next() {
+		var (
+			execution   = &types.Execution{}
+			id          int64
+			triggeredBy *string
+		)
+		if err := rows.Scan(&id, &execution.WorkflowID, &execution.Status, &triggeredBy, &execution.Error, &execution.StartedAt, &execution.CompletedAt); err != nil {
+			return nil, err
+		}
+		execution.ID = strconv.FormatInt(id, 10)
+		if triggeredBy != nil {
+			execution.TriggeredBy = *triggeredBy
+		}
+		executions = append(executions, execution)
+	}
+	return executions, rows.Err()
+}
+
+// SaveWorkflow implements Storage. Workflow IDs are the row's serial ID, so
+// a workflow with an ID that is not one is reported as not found.
+func (s *PostgresStorage) SaveWorkflow(ctx context.Context, workflow *types.Workflow) error {
+	if workflow.Status == "" {
+		workflow.Status = types.WorkflowActive
+	}
+	definition, err := json.Marshal(workflow)
+	if err != nil {
+		return fmt.Errorf("failed to encode workflow: %w", err)
+	}
+
+	if workflow.ID == "" {
+		var id int64
+		err := s.pool.QueryRow(ctx, `
+			INSERT INTO workflows (name, description, definition, status)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, updated_at`,
+			workflow.Name, workflow.Description, definition, workflow.Status,
+		).Scan(&id, &workflow.CreatedAt, &workflow.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		workflow.ID = strconv.FormatInt(id, 10)
+		return nil
+	}
+
+	id := numericID(workflow.ID)
+	if id == nil {
+		return ErrWorkflowNotFound
+	}
+	err = s.pool.QueryRow(ctx, `
+		UPDATE workflows
+		SET name = $2, description = $3, definition = $4, status = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING created_at, updated_at`,
+		*id, workflow.Name, workflow.Description, definition, workflow.Status,
+	).Scan(&workflow.CreatedAt, &workflow.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWorkflowNotFound
+	}
+	return err
+}
+
+// GetWorkflow implements Storage
+func (s *PostgresStorage) GetWorkflow(ctx context.Context, id string) (*types.Workflow, error) {
+	workflowID := numericID(id)
+	if workflowID == nil {
+		return nil, ErrWorkflowNotFound
+	}
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT id, name, description, definition, status, created_at, updated_at
+		FROM workflows WHERE id = $1`,
+		*workflowID,
+	)
+	workflow, err := scanWorkflow(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWorkflowNotFound
+	}
+	return workflow, err
+}
+
+// ListWorkflows implements Storage
+func (s *PostgresStorage) ListWorkflows(ctx context.Context, limit, offset int) ([]*types.Workflow, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, name, description, definition, status, created_at, updated_at
+		FROM workflows
+		ORDER BY id
+		LIMIT $1 OFFSET $2`,
+		sqlLimit(limit), offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workflows := []*types.Workflow{}
+	for rows.Next() {
+		workflow, err := scanWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		workflows = append(workflows, workflow)
+	}
+	return workflows, rows.Err()
+}
+
+// DeleteWorkflow implements Storage. Executions of the workflow are removed
+// by the foreign key's ON DELETE CASCADE.
+func (s *PostgresStorage) DeleteWorkflow(ctx context.Context, id string) error {
+	workflowID := numericID(id)
+	if workflowID == nil {
+		return ErrWorkflowNotFound
+	}
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM workflows WHERE id = $1`, *workflowID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+// scanWorkflow reads a workflow row. The columns take precedence over the
+// matching fields of the stored definition.
+func scanWorkflow(row pgx.Row) (*types.Workflow, error) {
+	var (
+		id          int64
+		name        string
+		description *string
+		definition  []byte
+		status      *string
+		createdAt   time.Time
+		updatedAt   time.Time
+	)
+	if err := row.Scan(&id, &name, &description, &definition, &status, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	workflow := &types.Workflow{}
+	if len(definition) > 0 {
+		if err := json.Unmarshal(definition, workflow); err != nil {
+			return nil, fmt.Errorf("invalid definition of workflow %d: %w", id, err)
+		}
+	}
+	workflow.ID = strconv.FormatInt(id, 10)
+	workflow.Name = name
+	workflow.Description = ""
+	if description != nil {
+		workflow.Description = *description
+	}
+	if status != nil {
+		workflow.Status = types.WorkflowStatus(*status)
+	}
+	workflow.CreatedAt = createdAt
+	workflow.UpdatedAt = updatedAt
+	return workflow, nil
+}
+
+// sqlLimit converts a limit where zero or less means "no limit" into a
+// LIMIT argument; Postgres treats a NULL limit as unbounded
+func sqlLimit(limit int) *int {
+	if limit <= 0 {
+		return nil
+	}
+	return &limit
+}
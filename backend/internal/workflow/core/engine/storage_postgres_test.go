@@ -0,0 +1,24 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresStorage runs against the database in TEST_DATABASE_URL, which
+// must have the schema from cmd/migrate applied. It is skipped when unset.
+func TestPostgresStorage(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	storage, err := NewStorage(context.Background(), StoragePostgres, databaseURL)
+	require.NoError(t, err)
+	defer storage.(*PostgresStorage).Close()
+
+	testStorage(t, storage)
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorage exercises the Storage contract; it is shared by the in-memory
+// and Postgres implementations
+func testStorage(t *testing.T, storage Storage) {
+	ctx := context.Background()
+
+	workflow := &types.Workflow{
+		Name:        "storage test",
+		Description: "created by testStorage",
+		Nodes:       []*types.Node{{ID: "fetch", Type: "http_request", Config: map[string]interface{}{"url": "https://example.com"}}},
+	}
+	require.NoError(t, storage.SaveWorkflow(ctx, workflow))
+	require.NotEmpty(t, workflow.ID)
+	t.Cleanup(func() { _ = storage.DeleteWorkflow(context.Background(), workflow.ID) })
+
+	stored, err := storage.GetWorkflow(ctx, workflow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "storage test", stored.Name)
+	assert.Equal(t, types.WorkflowActive, stored.Status)
+	require.Len(t, stored.Nodes, 1)
+	assert.Equal(t, "https://example.com", stored.Nodes[0].Config["url"])
+
+	workflow.Name = "storage test v2"
+	require.NoError(t, storage.SaveWorkflow(ctx, workflow))
+	stored, err = storage.GetWorkflow(ctx, workflow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "storage test v2", stored.Name)
+
+	workflows, err := storage.ListWorkflows(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Contains(t, workflowIDs(workflows), workflow.ID)
+
+	err = storage.SaveWorkflow(ctx, &types.Workflow{ID: "999999999", Name: "missing"})
+	assert.True(t, errors.Is(err, ErrWorkflowNotFound))
+
+	// Two executions with node outputs
+	var executionIDs []string
+	for i := 0; i < 2; i++ {
+		execution := &types.Execution{
+			WorkflowID:    workflow.ID,
+			Status:        types.ExecutionRunning,
+			StartedAt:     time.Now().Add(time.Duration(i) * time.Second),
+			TriggeredBy:   "api",
+			TriggerParams: map[string]interface{}{"run": float64(i)},
+		}
+		require.NoError(t, storage.CreateExecution(ctx, execution, nil))
+		require.NotEmpty(t, execution.ID)
+		executionIDs = append(executionIDs, execution.ID)
+
+		require.NoError(t, storage.SaveNodeResult(ctx, &types.NodeResult{
+			ExecutionID: execution.ID,
+			NodeID:      "fetch",
+			Status:      types.NodeCompleted,
+			Output:      map[string]interface{}{"status_code": float64(200)},
+			StartedAt:   execution.StartedAt,
+		}))
+
+		completedAt := execution.StartedAt.Add(time.Millisecond)
+		execution.Status = types.ExecutionSucceeded
+		execution.CompletedAt = &completedAt
+		require.NoError(t, storage.UpdateExecution(ctx, execution))
+	}
+
+	execution, err := storage.GetExecution(ctx, executionIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, workflow.ID, execution.WorkflowID)
+	assert.Equal(t, types.ExecutionSucceeded, execution.Status)
+	assert.Equal(t, "api", execution.TriggeredBy)
+	assert.Equal(t, float64(0), execution.TriggerParams["run"])
+	require.Contains(t, execution.NodeResults, "fetch")
+	assert.Equal(t, float64(200), execution.NodeResults["fetch"].Output["status_code"])
+
+	executions, err := storage.ListExecutions(ctx, workflow.ID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, executions, 2)
+	assert.Equal(t, executionIDs[1], executions[0].ID, "newest first")
+	assert.Equal(t, executionIDs[0], executions[1].ID)
+
+	executions, err = storage.ListExecutions(ctx, workflow.ID, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	assert.Equal(t, executionIDs[0], executions[0].ID)
+
+	// Deleting the workflow removes its executions
+	require.NoError(t, storage.DeleteWorkflow(ctx, workflow.ID))
+	_, err = storage.GetWorkflow(ctx, workflow.ID)
+	assert.True(t, errors.Is(err, ErrWorkflowNotFound))
+	_, err = storage.GetExecution(ctx, executionIDs[0])
+	assert.True(t, errors.Is(err, ErrExecutionNotFound))
+	assert.True(t, errors.Is(storage.DeleteWorkflow(ctx, workflow.ID), ErrWorkflowNotFound))
+}
+
+func workflowIDs(workflows []*types.Workflow) []string {
+	ids := make([]string, len(workflows))
+	for i, workflow := range workflows {
+		ids[i] = workflow.ID
+	}
+	return ids
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestNewStorageSelectsDriver(t *testing.T) {
+	storage, err := NewStorage(context.Background(), "", "")
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStorage{}, storage)
+
+	_, err = NewStorage(context.Background(), "sqlite", "")
+	assert.Error(t, err)
+}
+
+func TestEngineRecordsExecutionsInStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	e := NewEngine(&Config{Storage: storage})
+
+	executionID, err := e.ExecuteWorkflow(context.Background(), &types.Workflow{ID: "wf"}, map[string]interface{}{"a": 1})
+	require.NoError(t, err)
+
+	execution, err := storage.GetExecution(context.Background(), executionID)
+	require.NoError(t, err)
+	assert.Equal(t, "wf", execution.WorkflowID)
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"citadel-agent/backend/pkg/tracecontext"
+)
+
+// Names of the spans the executor records
+const (
+	SpanWorkflowRun   = "workflow.run"
+	SpanNodeExecution = "node.execute"
+)
+
+// SpanContext identifies a span of a trace. The zero value identifies none.
+type SpanContext = tracecontext.SpanContext
+
+// ExecutionTracer records traces of workflow runs. Each run is a span with
+// a child span per node it executes. Loop bodies run inside their loop
+// node's span, so a run and its loops form a single trace. Spans started
+// without a valid parent begin a new trace.
+type ExecutionTracer interface {
+	StartSpan(parent SpanContext, name string, attributes map[string]interface{}) SpanContext
+	// EndSpan ends span, adding attributes to those it was started with.
+	// err is the error the span failed with, if any.
+	EndSpan(span SpanContext, attributes map[string]interface{}, err error)
+}
+
+// noopTracer records nothing. Its spans are those of their parents, so
+// trace context received from callers is still passed on to the services
+// nodes call.
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(parent SpanContext, name string, attributes map[string]interface{}) SpanContext {
+	return parent
+}
+
+func (noopTracer) EndSpan(span SpanContext, attributes map[string]interface{}, err error) {}
+
+// ContextWithSpan returns a copy of ctx carrying span, under which the runs
+// and nodes executed with it record their spans
+func ContextWithSpan(ctx context.Context, span SpanContext) context.Context {
+	return tracecontext.ContextWithSpan(ctx, span)
+}
+
+// SpanFromContext returns the span carried by ctx, such as that of the node
+// being executed, or the zero SpanContext
+func SpanFromContext(ctx context.Context) SpanContext {
+	return tracecontext.SpanFromContext(ctx)
+}
+
+// RecordedSpan is a span kept by a SpanRecorder
+type RecordedSpan struct {
+	SpanContext
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	StartedAt  time.Time              `json:"started_at"`
+	EndedAt    time.Time              `json:"ended_at"`
+	Ended      bool                   `json:"ended"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Duration returns how long the span lasted, or has lasted so far
+func (s RecordedSpan) Duration() time.Duration {
+	if !s.Ended {
+		return time.Since(s.StartedAt)
+	}
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+// SpanRecorder is an ExecutionTracer keeping spans in memory, for tests and
+// debugging. Trace and span IDs follow the W3C Trace Context format.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+	byID  map[SpanContext]*RecordedSpan
+}
+
+// NewSpanRecorder creates an empty span recorder
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{byID: make(map[SpanContext]*RecordedSpan)}
+}
+
+// StartSpan records the start of a span
+func (r *SpanRecorder) StartSpan(parent SpanContext, name string, attributes map[string]interface{}) SpanContext {
+	span := &RecordedSpan{
+		SpanContext: SpanContext{TraceID: parent.TraceID, SpanID: randomHex(8)},
+		Name:        name,
+		Attributes:  make(map[string]interface{}, len(attributes)),
+		StartedAt:   time.Now(),
+	}
+	if parent.IsValid() {
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+	for key, value := range attributes {
+		span.Attributes[key] = value
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+	r.byID[span.SpanContext] = span
+	return span.SpanContext
+}
+
+// EndSpan records the end of a span; unknown spans are ignored
+func (r *SpanRecorder) EndSpan(sc SpanContext, attributes map[string]interface{}, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	span, ok := r.byID[sc]
+	if !ok || span.Ended {
+		return
+	}
+	span.Ended = true
+	span.EndedAt = time.Now()
+	for key, value := range attributes {
+		span.Attributes[key] = value
+	}
+	if err != nil {
+		span.Error = err.Error()
+	}
+}
+
+// Spans returns copies of the recorded spans, in the order they started
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, span := range r.spans {
+		spans[i] = *span
+		spans[i].Attributes = make(map[string]interface{}, len(span.Attributes))
+		for key, value := range span.Attributes {
+			spans[i].Attributes[key] = value
+		}
+	}
+	return spans
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
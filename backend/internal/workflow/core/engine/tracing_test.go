@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/workflow/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTracedExecutor(t *testing.T, recorder *SpanRecorder) *WorkflowExecutor {
+	t.Helper()
+
+	var ran []string
+	registry := NewNodeTypeRegistry()
+	forEachMeta := types.NodeMetadata{ID: "for_each"}
+	require.NoError(t, registry.RegisterNodeType("for_each", AdaptNode(utility.NewForEachNode, forEachMeta), forEachMeta))
+	require.NoError(t, registry.RegisterNodeType("scale", func() types.NodeInstance { return &scaleNode{} }, types.NodeMetadata{ID: "scale"}))
+	require.NoError(t, registry.RegisterNodeType("record", func() types.NodeInstance { return &recordNode{ran: &ran} }, types.NodeMetadata{ID: "record"}))
+	executor := NewWorkflowExecutor(registry)
+	executor.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	executor.SetTracer(recorder)
+	return executor
+}
+
+// spansNamed returns the recorded spans with name
+func spansNamed(spans []RecordedSpan, name string) []RecordedSpan {
+	var named []RecordedSpan
+	for _, span := range spans {
+		if span.Name == name {
+			named = append(named, span)
+		}
+	}
+	return named
+}
+
+func TestExecutorTracesRunsAsOneTrace(t *testing.T) {
+	recorder := NewSpanRecorder()
+	workflow := &Workflow{
+		ID: "traced",
+		Nodes: map[string]*WorkflowNode{
+			"loop":   {ID: "loop", Type: "for_each", Config: map[string]interface{}{"collection_key": "values"}},
+			"double": {ID: "double", Type: "scale", Config: map[string]interface{}{"factor": float64(2)}},
+			"done":   {ID: "done", Type: "record", Config: map[string]interface{}{"name": "done"}},
+		},
+		Edges: []WorkflowEdge{
+			{ID: "e1", Source: "loop", Target: "double", SourceHandle: LoopBodyHandle},
+			{ID: "e2", Source: "loop", Target: "done"},
+		},
+	}
+
+	_, err := newTracedExecutor(t, recorder).Run(context.Background(), workflow, map[string]interface{}{
+		"values": []interface{}{float64(1), float64(2)},
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Spans()
+	runs := spansNamed(spans, SpanWorkflowRun)
+	require.Len(t, runs, 3, "the workflow and each loop iteration")
+	root := runs[0]
+	assert.Empty(t, root.ParentID)
+	assert.Equal(t, "traced", root.Attributes[LogFieldWorkflowID])
+
+	nodeSpans := spansNamed(spans, SpanNodeExecution)
+	require.Len(t, nodeSpans, 4, "loop and done, and double per iteration")
+
+	parents := make(map[string]RecordedSpan, len(spans))
+	for _, span := range spans {
+		assert.Equal(t, root.TraceID, span.TraceID, "span %s belongs to the run's trace", span.Name)
+		assert.True(t, span.Ended)
+		assert.Empty(t, span.Error)
+		parents[span.SpanID] = span
+	}
+	for _, span := range nodeSpans {
+		parent := parents[span.ParentID]
+		assert.Equal(t, SpanWorkflowRun, parent.Name)
+		assert.Equal(t, 1, span.Attributes["attempts"])
+		if span.Attributes[LogFieldNodeID] == "double" {
+			// Body runs are children of the loop node
+			loop := parents[parent.ParentID]
+			assert.Equal(t, SpanNodeExecution, loop.Name)
+			assert.Equal(t, "loop", loop.Attributes[LogFieldNodeID])
+			assert.Equal(t, "scale", span.Attributes["node_type"])
+		} else {
+			assert.Equal(t, root.SpanID, span.ParentID)
+		}
+	}
+}
+
+func TestExecutorTracesNodeFailures(t *testing.T) {
+	recorder := NewSpanRecorder()
+	workflow := &Workflow{
+		ID:    "failing",
+		Nodes: map[string]*WorkflowNode{"double": {ID: "double", Type: "scale"}},
+	}
+
+	_, err := newTracedExecutor(t, recorder).Run(context.Background(), workflow, nil)
+	require.Error(t, err)
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, SpanWorkflowRun, spans[0].Name)
+	assert.Contains(t, spans[0].Error, "error executing node double")
+	assert.Equal(t, SpanNodeExecution, spans[1].Name)
+	assert.Equal(t, "missing item", spans[1].Error)
+	assert.Equal(t, spans[0].SpanID, spans[1].ParentID)
+}
+
+func TestRunsContinueTracesOfTheirContext(t *testing.T) {
+	recorder := NewSpanRecorder()
+	request := recorder.StartSpan(SpanContext{}, "http.request", nil)
+	workflow := &Workflow{
+		ID:    "child",
+		Nodes: map[string]*WorkflowNode{"done": {ID: "done", Type: "record"}},
+	}
+
+	_, err := newTracedExecutor(t, recorder).Run(ContextWithSpan(context.Background(), request), workflow, nil)
+	require.NoError(t, err)
+
+	run := spansNamed(recorder.Spans(), SpanWorkflowRun)[0]
+	assert.Equal(t, request.TraceID, run.TraceID)
+	assert.Equal(t, request.SpanID, run.ParentID)
+}
@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"citadel-agent/backend/internal/workflow/core/types"
+	nodeerrors "citadel-agent/backend/pkg/errors"
+)
+
+// WorkflowPlan is what orchestrators running the nodes of a workflow one at
+// a time, such as Temporal, need to know about it: the order its nodes run
+// in, and which of them merge branches, wait for a person or may fail
+// without failing the run. Loop bodies are not part of it; their loop node
+// runs them.
+type WorkflowPlan struct {
+	Order            []string        `json:"order"`
+	FanIn            map[string]bool `json:"fan_in,omitempty"`
+	Prompts          map[string]bool `json:"prompts,omitempty"`
+	ToleratesFailure map[string]bool `json:"tolerates_failure,omitempty"`
+}
+
+// PlanWorkflow checks that every node of workflow can be created, as Run
+// does before running any, and returns the plan of the workflow
+func (we *WorkflowExecutor) PlanWorkflow(ctx context.Context, workflow *Workflow) (*WorkflowPlan, error) {
+	we.mu.Lock()
+	logger := we.logger
+	we.mu.Unlock()
+
+	redact := &redactor{}
+	logger = newRedactingLogger(logger, redact).With(executionLogFields(workflow, nil))
+	workflow, bodies := splitLoopBodies(workflow)
+
+	plan := &WorkflowPlan{
+		FanIn:            make(map[string]bool),
+		Prompts:          make(map[string]bool),
+		ToleratesFailure: make(map[string]bool),
+	}
+	instances := make(map[string]types.NodeInstance, len(workflow.Nodes))
+	for nodeID := range workflow.Nodes {
+		instance, err := we.initializeNode(ctx, workflow, nodeID, bodies, nil, redact, logger)
+		if err != nil {
+			return nil, redact.error(err)
+		}
+		instances[nodeID] = instance
+		defer instance.Close()
+
+		if _, ok := asFanInNode(instance); ok {
+			plan.FanIn[nodeID] = true
+		}
+		if _, ok := asPromptNode(instance); ok {
+			plan.Prompts[nodeID] = true
+		}
+	}
+	for nodeID := range workflow.Nodes {
+		if toleratesFailure(workflow, instances, nodeID) {
+			plan.ToleratesFailure[nodeID] = true
+		}
+	}
+
+	order, err := topologicalOrder(workflow)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newGraphState(workflow); err != nil {
+		return nil, err
+	}
+	plan.Order = order
+	return plan, nil
+}
+
+// RunNode runs nodeID of workflow once on input, within the node timeout and
+// checked against the schemas of its type, for orchestrators that retry
+// nodes themselves. Prompt nodes get response as their answer instead of
+// asking; without one they fail. Secrets are redacted from the output and
+// error, which orchestrators may persist.
+func (we *WorkflowExecutor) RunNode(ctx context.Context, workflow *Workflow, nodeID string, input map[string]interface{}, response *types.PromptResponse) (map[string]interface{}, error) {
+	workflow, bodies := splitLoopBodies(workflow)
+	if _, ok := workflow.Nodes[nodeID]; !ok {
+		return nil, fmt.Errorf("node %s not found in workflow %s", nodeID, workflow.ID)
+	}
+
+	we.mu.Lock()
+	timeoutPolicy, logger := we.timeoutPolicy, we.logger
+	we.mu.Unlock()
+
+	redact := &redactor{}
+	logger = newRedactingLogger(logger, redact).With(map[string]interface{}{
+		LogFieldWorkflowID: workflow.ID,
+		LogFieldNodeID:     nodeID,
+		"node_type":        workflow.Nodes[nodeID].Type,
+	})
+	instance, err := we.initializeNode(ctx, workflow, nodeID, bodies, nil, redact, logger)
+	if err != nil {
+		return nil, redact.error(err)
+	}
+	defer func() {
+		if err := instance.Close(); err != nil {
+			logger.Warn("Error closing node", map[string]interface{}{"error": err})
+		}
+	}()
+
+	if prompt, ok := asPromptNode(instance); ok {
+		prompt.SetPromptFunc(func(ctx context.Context, message string) (types.PromptResponse, error) {
+			if response == nil {
+				return types.PromptResponse{}, fmt.Errorf("node %s has no response to its prompt", nodeID)
+			}
+			return *response, nil
+		})
+	}
+
+	// Retries are up to the caller
+	output, _ := executeValidated(ContextWithLogger(ctx, logger), instance, types.NodeInput{Data: input}, RetryPolicy{}, timeoutPolicy)
+	if output.Error != nil {
+		return nil, redact.error(output.Error)
+	}
+	return redact.fields(output.Data), nil
+}
+
+// NodeStep is a node a GraphWalk has reached, with its input. Err is set
+// when the input could not be assembled; the node then fails with it
+// without running.
+type NodeStep struct {
+	NodeID string
+	Input  map[string]interface{}
+	Err    error
+}
+
+// GraphWalk steps through a workflow by its plan the way Run does, for
+// orchestrators that run the nodes themselves. It does no I/O, so it may be
+// used in deterministic code such as Temporal workflows.
+type GraphWalk struct {
+	plan    *WorkflowPlan
+	inputs  map[string]interface{}
+	graph   *graphState
+	next    int
+	skipped []string
+}
+
+// NewGraphWalk starts a walk through workflow, whose starting nodes get
+// inputs
+func NewGraphWalk(workflow *Workflow, plan *WorkflowPlan, inputs map[string]interface{}) (*GraphWalk, error) {
+	workflow, _ = splitLoopBodies(workflow)
+	graph, err := newGraphState(workflow)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphWalk{plan: plan, inputs: inputs, graph: graph}, nil
+}
+
+// Next returns the next node to run, passing over nodes only reachable
+// through untaken branches. It returns false once every node was visited.
+func (w *GraphWalk) Next() (NodeStep, bool) {
+	for w.next < len(w.plan.Order) {
+		nodeID := w.plan.Order[w.next]
+		w.next++
+
+		input, skip, mappingErr := w.graph.input(nodeID, w.plan.FanIn[nodeID], w.inputs)
+		if skip {
+			w.skipped = append(w.skipped, nodeID)
+			continue
+		}
+		step := NodeStep{NodeID: nodeID, Input: input.Data}
+		if mappingErr != nil {
+			step.Err = nodeerrors.NewValidationError("invalid edge mapping", mappingErr)
+		}
+		return step, true
+	}
+	return NodeStep{}, false
+}
+
+// Complete records the output of a node, selecting the edges followed
+// from it
+func (w *GraphWalk) Complete(nodeID string, output map[string]interface{}) {
+	w.graph.complete(nodeID, output)
+}
+
+// Fail records that a node failed and reports whether the walk goes on,
+// which it does when all its edges lead to fan-in nodes tolerating failed
+// branches
+func (w *GraphWalk) Fail(nodeID string, err error) bool {
+	if !w.plan.ToleratesFailure[nodeID] {
+		return false
+	}
+	w.graph.fail(nodeID, err.Error())
+	return true
+}
+
+// Results returns the outputs of the nodes that completed, by node ID
+func (w *GraphWalk) Results() map[string]interface{} {
+	return w.graph.results
+}
+
+// Skipped returns the nodes passed over so far, in order
+func (w *GraphWalk) Skipped() []string {
+	return w.skipped
+}
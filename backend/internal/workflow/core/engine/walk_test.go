@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	nodeerrors "citadel-agent/backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphWalkFollowsTakenBranchOnly(t *testing.T) {
+	var ran []string
+	executor := newBranchingExecutor(t, &ran)
+	ctx := context.Background()
+	workflow := branchingWorkflow()
+
+	plan, err := executor.PlanWorkflow(ctx, workflow)
+	require.NoError(t, err)
+	assert.Len(t, plan.Order, 5)
+	assert.Empty(t, plan.Prompts)
+
+	inputs := map[string]interface{}{"order": map[string]interface{}{"total": 20.0}}
+	walk, err := NewGraphWalk(workflow, plan, inputs)
+	require.NoError(t, err)
+
+	var visited []string
+	for {
+		step, ok := walk.Next()
+		if !ok {
+			break
+		}
+		require.NoError(t, step.Err)
+		visited = append(visited, step.NodeID)
+		output, err := executor.RunNode(ctx, workflow, step.NodeID, step.Input, nil)
+		require.NoError(t, err)
+		walk.Complete(step.NodeID, output)
+	}
+
+	assert.Equal(t, []string{"check", "reject", "finalize"}, visited)
+	assert.Equal(t, []string{"reject", "finalize"}, ran)
+	assert.ElementsMatch(t, []string{"approve", "notify"}, walk.Skipped())
+	assert.Contains(t, walk.Results(), "finalize")
+	assert.NotContains(t, walk.Results(), "approve")
+}
+
+func TestRunNodeRunsOnce(t *testing.T) {
+	var calls int32
+	executor := newFlakyExecutor(t, &flakyNode{failures: 1, err: nodeerrors.NewNetworkError("unreachable", nil), calls: &calls})
+
+	_, err := executor.RunNode(context.Background(), flakyWorkflow(), "n1", nil, nil)
+	assert.Equal(t, nodeerrors.CodeNetwork, nodeerrors.CodeOf(err))
+	assert.Equal(t, int32(1), calls, "retries are up to the caller")
+
+	_, err = executor.RunNode(context.Background(), flakyWorkflow(), "missing", nil, nil)
+	assert.ErrorContains(t, err, "node missing not found")
+
+	plan, err := executor.PlanWorkflow(context.Background(), &Workflow{
+		ID:    "unknown",
+		Nodes: map[string]*WorkflowNode{"n1": {ID: "n1", Type: "nope"}},
+	})
+	assert.Nil(t, plan)
+	assert.ErrorContains(t, err, "unknown node type")
+}
@@ -100,7 +100,8 @@ func (cb *CircuitBreaker) beforeRequest() error {
 		// Check if we should transition to half-open
 		if time.Since(cb.lastFailTime) > cb.resetTimeout {
 			cb.setState(StateHalfOpen)
-			cb.halfOpenCalls = 0
+			// This request is the first probe
+			cb.halfOpenCalls = 1
 			return nil
 		}
 		return ErrCircuitOpen
@@ -121,6 +122,27 @@ func (cb *CircuitBreaker) beforeRequest() error {
 	}
 }
 
+// Allow reports whether a call may go ahead, returning ErrCircuitOpen while
+// the circuit is open and ErrTooManyRequests while it is half-open with
+// all probes in flight. Every call allowed must be followed by Done. It
+// is for callers that decide for themselves what counts as a failure and
+// need no timeout of the breaker; a nil breaker allows every call.
+func (cb *CircuitBreaker) Allow() error {
+	if cb == nil {
+		return nil
+	}
+	return cb.beforeRequest()
+}
+
+// Done records the outcome of a call let through by Allow, err being nil
+// when it succeeded
+func (cb *CircuitBreaker) Done(err error) {
+	if cb == nil {
+		return
+	}
+	cb.afterRequest(err)
+}
+
 // afterRequest updates circuit breaker state after request
 func (cb *CircuitBreaker) afterRequest(err error) {
 	cb.mu.Lock()
@@ -175,7 +197,7 @@ func (cb *CircuitBreaker) setState(newState CircuitState) {
 	cb.state = newState
 
 	if cb.onStateChange != nil {
-		go cb.onStateChange(oldState, newState)
+		cb.onStateChange(oldState, newState)
 	}
 }
 
@@ -202,7 +224,8 @@ func (cb *CircuitBreaker) Reset() {
 	cb.halfOpenCalls = 0
 }
 
-// OnStateChange sets callback for state changes
+// OnStateChange sets callback for state changes. It is called in order,
+// with the breaker locked, so it must not call the breaker itself.
 func (cb *CircuitBreaker) OnStateChange(fn func(from, to CircuitState)) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
@@ -222,3 +245,86 @@ func (s CircuitState) String() string {
 		return "unknown"
 	}
 }
+
+// CircuitBreakers holds a circuit breaker per endpoint, such as the host of
+// an HTTP request, created with the same configuration on first use
+type CircuitBreakers struct {
+	mu            sync.Mutex
+	config        CircuitBreakerConfig
+	disabled      bool
+	breakers      map[string]*CircuitBreaker
+	onStateChange func(endpoint string, from, to CircuitState)
+}
+
+// NewCircuitBreakers creates an empty set of circuit breakers
+func NewCircuitBreakers(config CircuitBreakerConfig) *CircuitBreakers {
+	return &CircuitBreakers{
+		config:   config,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get returns the circuit breaker of endpoint, or nil, which allows every
+// call, when the breakers are disabled or c is nil
+func (c *CircuitBreakers) Get(endpoint string) *CircuitBreaker {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.disabled {
+		return nil
+	}
+	cb, ok := c.breakers[endpoint]
+	if !ok {
+		cb = NewCircuitBreaker(c.config)
+		if c.onStateChange != nil {
+			fn := c.onStateChange
+			cb.onStateChange = func(from, to CircuitState) { fn(endpoint, from, to) }
+		}
+		c.breakers[endpoint] = cb
+	}
+	return cb
+}
+
+// Configure sets the configuration of the breakers and enables or disables
+// them. Existing breakers are dropped, closing their circuits.
+func (c *CircuitBreakers) Configure(config CircuitBreakerConfig, enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+	c.disabled = !enabled
+	c.breakers = make(map[string]*CircuitBreaker)
+}
+
+// OnStateChange sets the callback of the state changes of every breaker,
+// like CircuitBreaker.OnStateChange. It applies to breakers created
+// afterwards.
+func (c *CircuitBreakers) OnStateChange(fn func(endpoint string, from, to CircuitState)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStateChange = fn
+}
+
+// States returns the state of the breaker of each endpoint called so far
+func (c *CircuitBreakers) States() map[string]CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := make(map[string]CircuitState, len(c.breakers))
+	for endpoint, cb := range c.breakers {
+		states[endpoint] = cb.GetState()
+	}
+	return states
+}
+
+// outbound holds the breakers of the calls nodes make to external services
+var outbound = NewCircuitBreakers(CircuitBreakerConfig{})
+
+// OutboundCircuitBreakers returns the circuit breakers, one per endpoint,
+// guarding the calls nodes make to external services such as HTTP APIs and
+// AI providers. They are shared by the whole process and enabled with the
+// defaults of NewCircuitBreaker until configured.
+func OutboundCircuitBreakers() *CircuitBreakers {
+	return outbound
+}
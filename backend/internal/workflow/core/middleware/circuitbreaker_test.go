@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("service down")
+
+// call makes a call through cb that fails with err
+func call(cb *CircuitBreaker, err error) error {
+	if allowErr := cb.Allow(); allowErr != nil {
+		return allowErr
+	}
+	cb.Done(err)
+	return err
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MaxFailures: 3, ResetTimeout: 20 * time.Millisecond})
+	var transitions []string
+	cb.OnStateChange(func(from, to CircuitState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	})
+
+	// Failures below the threshold, or interrupted by a success, keep it closed
+	assert.ErrorIs(t, call(cb, errDown), errDown)
+	assert.ErrorIs(t, call(cb, errDown), errDown)
+	assert.NoError(t, call(cb, nil))
+	assert.Equal(t, StateClosed, cb.GetState())
+
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, call(cb, errDown), errDown)
+	}
+	assert.Equal(t, StateOpen, cb.GetState())
+	assert.ErrorIs(t, call(cb, nil), ErrCircuitOpen, "open circuits short-circuit calls")
+
+	// After the reset timeout one probe is let through
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, cb.Allow())
+	assert.Equal(t, StateHalfOpen, cb.GetState())
+	assert.ErrorIs(t, cb.Allow(), ErrTooManyRequests, "one probe at a time")
+	cb.Done(nil)
+	assert.Equal(t, StateClosed, cb.GetState())
+	assert.Equal(t, 0, cb.GetFailures())
+
+	assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, transitions)
+}
+
+func TestCircuitBreakerReopensWhenProbeFails(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: 20 * time.Millisecond})
+	assert.ErrorIs(t, call(cb, errDown), errDown)
+	assert.Equal(t, StateOpen, cb.GetState())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.ErrorIs(t, call(cb, errDown), errDown)
+	assert.Equal(t, StateOpen, cb.GetState())
+	assert.ErrorIs(t, call(cb, nil), ErrCircuitOpen, "the reset timeout starts over")
+
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, call(cb, nil))
+	assert.Equal(t, StateClosed, cb.GetState())
+}
+
+func TestCircuitBreakersPerEndpoint(t *testing.T) {
+	breakers := NewCircuitBreakers(CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Minute})
+	var changes []string
+	breakers.OnStateChange(func(endpoint string, from, to CircuitState) {
+		changes = append(changes, endpoint+" "+to.String())
+	})
+
+	assert.ErrorIs(t, call(breakers.Get("a.example.com"), errDown), errDown)
+	assert.ErrorIs(t, call(breakers.Get("a.example.com"), nil), ErrCircuitOpen)
+	assert.NoError(t, call(breakers.Get("b.example.com"), nil), "other endpoints are unaffected")
+	assert.Equal(t, map[string]CircuitState{"a.example.com": StateOpen, "b.example.com": StateClosed}, breakers.States())
+	assert.Equal(t, []string{"a.example.com open"}, changes)
+
+	// Disabled breakers let every call through
+	breakers.Configure(CircuitBreakerConfig{MaxFailures: 1}, false)
+	assert.Nil(t, breakers.Get("a.example.com"))
+	assert.ErrorIs(t, call(breakers.Get("a.example.com"), errDown), errDown)
+	assert.NoError(t, call(breakers.Get("a.example.com"), nil))
+
+	var none *CircuitBreakers
+	assert.NoError(t, call(none.Get("a.example.com"), nil))
+}
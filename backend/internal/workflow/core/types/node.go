@@ -15,7 +15,17 @@ type NodeOutput struct {
 	Error error
 }
 
-// NodeMetadata contains metadata about a node type
+// PromptResponse is a person's answer to a node waiting for them, such as
+// an approval node
+type PromptResponse struct {
+	Approved bool                   `json:"approved"`
+	Comment  string                 `json:"comment,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// NodeMetadata contains metadata about a node type. Inputs is the JSON
+// Schema of its configuration parameters, with their defaults, that the
+// frontend property panel is built from.
 type NodeMetadata struct {
 	ID          string                 `json:"id"`
 	Name        string                 `json:"name"`
@@ -24,6 +34,19 @@ type NodeMetadata struct {
 	Inputs      map[string]interface{} `json:"inputs"`
 	Outputs     map[string]interface{} `json:"outputs"`
 	Icon        string                 `json:"icon"`
+	Version     string                 `json:"version,omitempty"`
+	// InputSchema and OutputSchema are JSON Schemas the executor checks the
+	// node's input and output data against, and the frontend renders forms
+	// from. Nodes without them accept and return any data.
+	InputSchema  map[string]interface{} `json:"input_schema,omitempty"`
+	OutputSchema map[string]interface{} `json:"output_schema,omitempty"`
+	// SideEffects marks node types acting outside the workflow, such as by
+	// running commands, which simulated runs stub instead of executing
+	SideEffects bool `json:"side_effects,omitempty"`
+	// External marks node types calling services outside Citadel, such as
+	// HTTP APIs and databases, whose calls recorded runs keep and replayed
+	// runs answer from the recording
+	External bool `json:"external,omitempty"`
 }
 
 // NodeInstance is the interface that all nodes must implement
@@ -71,6 +71,7 @@ type Execution struct {
 	Retries       int                    `json:"retries"`
 	ParentID      *string                `json:"parent_id,omitempty"` // For sub-workflows
 	CancelledAt   *time.Time             `json:"cancelled_at,omitempty"`
+	UpdatedAt     *time.Time             `json:"updated_at,omitempty"` // Last written by the process running it
 }
 
 // NodeResult represents the result of a single node execution
@@ -80,6 +81,7 @@ type NodeResult struct {
 	NodeID        string                 `json:"node_id"`
 	Status        NodeStatus             `json:"status"`
 	Output        map[string]interface{} `json:"output"`
+	Redacted      bool                   `json:"redacted,omitempty"` // Output had secrets replaced
 	Error         *string                `json:"error,omitempty"`
 	StartedAt     time.Time              `json:"started_at"`
 	CompletedAt   *time.Time             `json:"completed_at,omitempty"`
@@ -87,6 +89,7 @@ type NodeResult struct {
 	RetryCount    int                    `json:"retry_count"`
 	InputsUsed    map[string]interface{} `json:"inputs_used"`
 	OutputsCached bool                   `json:"outputs_cached"`
+	Simulated     bool                   `json:"simulated,omitempty"`
 }
 
 // WorkflowStatus represents the status of a workflow definition
@@ -98,6 +101,7 @@ const (
 	WorkflowInactive  WorkflowStatus = "inactive"
 	WorkflowArchived  WorkflowStatus = "archived"
 	WorkflowDeleting  WorkflowStatus = "deleting"
+	WorkflowDeleted   WorkflowStatus = "deleted"
 )
 
 // ExecutionStatus represents the status of a workflow execution
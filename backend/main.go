@@ -1,136 +1,418 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"citadel-agent/backend/internal/api/handlers"
-	httpnode "citadel-agent/backend/internal/nodes/http"
-	"citadel-agent/backend/internal/nodes/utility"
+	"citadel-agent/backend/internal/api/middleware"
+	"citadel-agent/backend/internal/auth"
+	"citadel-agent/backend/internal/credentials"
+	"citadel-agent/backend/internal/nodes/ai"
+	"citadel-agent/backend/internal/nodes/builtin"
+	"citadel-agent/backend/internal/plugins"
+	"citadel-agent/backend/internal/temporal"
+	"citadel-agent/backend/internal/worker"
 	"citadel-agent/backend/internal/workflow/core/engine"
+	"citadel-agent/backend/pkg/accounts"
+	"citadel-agent/backend/pkg/cors"
+	"citadel-agent/backend/pkg/database"
+	"citadel-agent/backend/pkg/metrics"
+	"citadel-agent/backend/pkg/profiling"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	// Initialize the node registry
 	registry := engine.NewNodeTypeRegistry()
 
+	// Message broker of the message_queue node, from RABBITMQ_URL
+	broker := builtin.NewMessageBroker(os.Getenv("RABBITMQ_URL"))
+
 	// Register node types
-	registerNodes(registry)
+	builtin.Register(registry, broker)
+
+	// AI nodes hold each user to CITADEL_AI_TOKEN_BUDGET tokens, 0 being
+	// unlimited. Usage is kept in memory.
+	aiTokenBudget, _ := strconv.ParseInt(os.Getenv("CITADEL_AI_TOKEN_BUDGET"), 10, 64)
+	ai.SetUsageTracker(ai.NewUsageTracker(ai.NewMemoryUsageStore(), aiTokenBudget))
+
+	// Load node types from plugin executables, as configured by the
+	// CITADEL_PLUGIN_* variables, and rescan for new and changed ones.
+	// Plugins with a bad signature are refused, unsigned ones too when
+	// CITADEL_PLUGIN_REQUIRE_SIGNATURE is set.
+	pluginManager := plugins.NewNodeManagerWithOptions(plugins.FromEnv(plugins.DefaultOptions()))
+	defer pluginManager.Close()
+	go pluginManager.Run(context.Background(), registry)
 
-	// Initialize workflow executor
+	// Initialize workflow executor. Executions are recorded in memory so
+	// their status can be queried and running ones cancelled.
 	executor := engine.NewWorkflowExecutor(registry)
+	executor.SetExecutionStore(engine.NewMemoryExecutionStore())
+
+	// Executions run with ?record=true keep the calls of their external
+	// nodes, up to CITADEL_RECORDING_MAX_PAYLOAD bytes each, for ?replay=
+	maxRecordedPayload, _ := strconv.Atoi(os.Getenv("CITADEL_RECORDING_MAX_PAYLOAD"))
+	executor.SetCallStore(engine.NewMemoryCallStore(), maxRecordedPayload)
+
+	// Prometheus metrics from the CITADEL_MONITORING_* variables
+	metricsConfig := metrics.FromEnv(metrics.DefaultConfig())
+	var serverMetrics *metrics.Metrics
+	var authMetrics middleware.AuthMetrics
+	if metricsConfig.CollectMetrics {
+		serverMetrics = metrics.New()
+		authMetrics = serverMetrics
+		executor.SetMetrics(serverMetrics)
+	}
 
 	// Initialize handlers
-	workflowHandler := handlers.NewWorkflowHandler(executor)
+	webhookHandler := handlers.NewWebhookHandler(executor)
+	queueConsumers := handlers.NewQueueConsumers(executor, broker)
+	workflowHandler := handlers.NewWorkflowHandler(executor, webhookHandler, queueConsumers)
 	nodeHandler := handlers.NewNodeHandler(registry)
+	executionHandler := handlers.NewExecutionHandler(executor)
+
+	// Executions started through the Temporal routes run on Temporal at
+	// TEMPORAL_ADDRESS, or in process when it is not set or unreachable
+	temporalService := newTemporalService(executor)
+	defer temporalService.Close()
+	temporalHandler := handlers.NewTemporalHandler(temporalService, workflowHandler)
+
+	// CORS from the CITADEL_SERVER_CORS_* variables, which also decide the
+	// origins the WebSocket gateway accepts
+	corsConfig := cors.FromEnv(cors.DefaultConfig())
+	if err := corsConfig.Validate(); err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
+	corsPolicy := cors.New(corsConfig)
+	webSocketHandler := handlers.NewWebSocketHandler(executor, workflowHandler, corsPolicy.AllowOrigin)
+
+	// Set up routes. They get a ServeMux of their own since importing
+	// net/http/pprof registers the profiles on http.DefaultServeMux.
+	mux := http.NewServeMux()
+	setupRoutes(mux, workflowHandler, nodeHandler, webhookHandler, executionHandler, webSocketHandler, handlers.NewPluginHandler(pluginManager), handlers.NewHealthHandler(registry), temporalHandler)
 
-	// Set up routes
-	setupRoutes(workflowHandler, nodeHandler)
+	// The database at DATABASE_URL, shared by everything kept there
+	db := newDatabasePool()
+	if db != nil {
+		defer db.Close()
+	}
+
+	// Credentials node configs refer to as {{credentials.<name>}}, when a
+	// master key is set
+	if vault := newCredentialVault(db); vault != nil {
+		executor.SetCredentials(vault)
+		credentialsHandler := handlers.NewCredentialsHandler(vault)
+		mux.Handle(handlers.CredentialsPath, credentialsHandler)
+		mux.Handle(handlers.CredentialsPath+"/", credentialsHandler)
+	}
+
+	// Dead-letter queue of the workers, when their queue is reachable
+	if dlq := newDeadLetterQueue(db); dlq != nil {
+		deadLetterHandler := handlers.NewDeadLetterHandler(dlq)
+		mux.Handle(handlers.DeadLetterPath, deadLetterHandler)
+		mux.Handle(handlers.DeadLetterPath+"/", deadLetterHandler)
+	}
+
+	// pprof profiles from the CITADEL_MONITORING_* variables, behind
+	// authentication and never in production unless allowed
+	profilingConfig := profiling.FromEnv(profiling.DefaultConfig())
+	adminPaths := []string{handlers.CredentialsPath, handlers.AdminPathPrefix}
+	if profilingConfig.Active(os.Getenv("APP_ENV")) {
+		endpoint := strings.TrimRight(profilingConfig.Endpoint, "/")
+		mux.Handle(endpoint+"/", profiling.Handler(endpoint))
+		adminPaths = append(adminPaths, endpoint)
+		log.Printf("Serving profiles on %s/", endpoint)
+	} else if profilingConfig.Enabled {
+		log.Println("Profiling is disabled in production; set CITADEL_MONITORING_ALLOW_PROFILING_IN_PRODUCTION to enable it")
+	}
+
+	// Require a JWT or an API key on every route except the public ones,
+	// and the role the route needs
+	var handler http.Handler = mux
+	if auth, apiKeys := newJWTAuth(authMetrics, db); auth != nil {
+		mux.HandleFunc("/auth/logout", auth.LogoutHTTP)
+		mux.HandleFunc(streamTokenPath, auth.StreamTokenHTTP)
+		if apiKeys != nil {
+			apiKeyHandler := handlers.NewAPIKeyHandler(apiKeys)
+			mux.Handle(handlers.APIKeysPath, apiKeyHandler)
+			mux.Handle(handlers.APIKeysPath+"/", apiKeyHandler)
+		}
+		handler = auth.HTTP(requireRoles(auth, adminPaths, handler))
+	}
+
+	// Bound request bodies by CITADEL_API_MAX_REQUEST_SIZE (bytes)
+	maxRequestSize, _ := strconv.ParseInt(os.Getenv("CITADEL_API_MAX_REQUEST_SIZE"), 10, 64)
+	handler = middleware.LimitRequestBody(maxRequestSize, handler)
+
+	// Preflights are answered before authentication
+	handler = corsPolicy.Handler(handler)
+
+	// Metrics are scraped without a token, like /health
+	if serverMetrics != nil && metricsConfig.ExportMetrics {
+		root := http.NewServeMux()
+		root.Handle(metricsConfig.MetricsEndpoint, serverMetrics.Handler())
+		root.Handle("/", handler)
+		handler = root
+		log.Printf("Serving metrics on %s", metricsConfig.MetricsEndpoint)
+	}
 
 	// Start server
 	port := getPort()
 	log.Printf("Starting Citadel Agent API server on port %s", port)
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
 		log.Fatal("Server failed to start:", err)
 	}
 }
 
-func registerNodes(registry *engine.NodeTypeRegistryImpl) {
-	// Register the HTTP Request node
-	httpMetadata := httpnode.NewHTTPRequestNode().GetMetadata()
-	registry.RegisterNodeType(
-		"http_request",
-		httpnode.NewHTTPRequestNode,
-		httpMetadata,
-	)
-
-	// Register the Logger node
-	loggerMetadata := utility.NewLoggerNode().GetMetadata()
-	registry.RegisterNodeType(
-		"logger",
-		utility.NewLoggerNode,
-		loggerMetadata,
-	)
-
-	// Register the Data Transformer node
-	transformerMetadata := utility.NewDataTransformerNode().GetMetadata()
-	registry.RegisterNodeType(
-		"data_transformer",
-		utility.NewDataTransformerNode,
-		transformerMetadata,
-	)
-
-	// Register the If/Else node
-	ifelseMetadata := utility.NewIfElseNode().GetMetadata()
-	registry.RegisterNodeType(
-		"if_else",
-		utility.NewIfElseNode,
-		ifelseMetadata,
-	)
-
-	// Register the For Each node
-	foreachMetadata := utility.NewForEachNode().GetMetadata()
-	registry.RegisterNodeType(
-		"for_each",
-		utility.NewForEachNode,
-		foreachMetadata,
-	)
-
-	log.Printf("Registered %d node types", len(registry.ListNodeTypes()))
-}
-
-func setupRoutes(workflowHandler *handlers.WorkflowHandler, nodeHandler *handlers.NodeHandler) {
-	// CORS middleware
-	corsMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			// Allow requests from frontend
-			origin := r.Header.Get("Origin")
-			allowedOrigins := []string{
-				"http://localhost:3000",
-				"http://localhost:5173",
-				"http://localhost:8080",
-			}
-
-			for _, allowed := range allowedOrigins {
-				if origin == allowed {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					break
-				}
-			}
-
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-			// Handle preflight requests
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next(w, r)
+func setupRoutes(mux *http.ServeMux, workflowHandler *handlers.WorkflowHandler, nodeHandler *handlers.NodeHandler, webhookHandler *handlers.WebhookHandler, executionHandler *handlers.ExecutionHandler, webSocketHandler *handlers.WebSocketHandler, pluginHandler *handlers.PluginHandler, healthHandler *handlers.HealthHandler, temporalHandler *handlers.TemporalHandler) {
+	// Workflow routes
+	mux.HandleFunc("/api/workflows/execute", workflowHandler.ExecuteWorkflowHandler)
+	mux.HandleFunc(handlers.WorkflowImportPath, workflowHandler.ImportWorkflowHandler)
+	mux.HandleFunc(handlers.WorkflowPathPrefix, workflowHandler.WorkflowByIDHandler)
+	mux.HandleFunc("/api/workflows", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			workflowHandler.DeployWorkflowHandler(w, r)
+			return
 		}
-	}
+		workflowHandler.ListWorkflowsHandler(w, r)
+	})
 
-	// Workflow routes
-	http.HandleFunc("/api/workflows/execute", corsMiddleware(workflowHandler.ExecuteWorkflowHandler))
-	http.HandleFunc("/api/workflows/", corsMiddleware(workflowHandler.GetWorkflowHandler))
-	http.HandleFunc("/api/workflows", corsMiddleware(workflowHandler.ListWorkflowsHandler))
+	// Execution status and cancellation
+	mux.Handle(handlers.ExecutionPathPrefix, executionHandler)
+
+	// Executions on Temporal: start, signal, query and cancel
+	mux.Handle(handlers.TemporalExecutionPath, temporalHandler)
+	mux.Handle(handlers.TemporalExecutionPath+"/", temporalHandler)
+
+	// WebSocket gateway to watch executions, trigger workflows and answer
+	// approval prompts
+	mux.Handle(handlers.WebSocketPath, webSocketHandler)
+
+	// Inbound webhooks for workflows with a webhook_trigger node
+	mux.HandleFunc(handlers.WebhookPathPrefix, webhookHandler.HandleWebhook)
 
 	// Node routes
-	http.HandleFunc("/api/nodes/", corsMiddleware(nodeHandler.GetNodeHandler))
-	http.HandleFunc("/api/nodes", corsMiddleware(nodeHandler.ListNodesHandler))
+	mux.HandleFunc("/api/nodes/", nodeHandler.GetNodeHandler)
+	mux.HandleFunc("/api/nodes", nodeHandler.ListNodesHandler)
 
 	// Registry routes (for frontend node palette)
-	http.HandleFunc("/api/v1/registry/nodes", corsMiddleware(nodeHandler.ListNodesHandler))
+	mux.HandleFunc("/api/v1/registry/nodes", nodeHandler.ListNodesHandler)
+
+	// Loaded plugins and their signature checks
+	mux.HandleFunc(handlers.PluginAdminPath, pluginHandler.ListPluginsHandler)
+
+	// Health checks, public like the root
+	mux.Handle(handlers.HealthPath, healthHandler)
 
 	// Root endpoint
-	http.HandleFunc("/", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"message": "Welcome to Citadel Agent API", "version": "0.1.0"}`))
-	}))
+	})
+}
+
+// requireRoles enforces the role of each route: admin under adminPaths,
+// viewer for reading and editor for changing or executing anything else.
+// Users manage their own API keys and get stream tokens whatever their
+// role; both act with their roles. Public routes need no role.
+func requireRoles(auth *middleware.JWTAuth, adminPaths []string, next http.Handler) http.Handler {
+	admin := middleware.RequireRole(accounts.RoleAdmin, next)
+	viewer := middleware.RequireRole(accounts.RoleViewer, next)
+	byMethod := middleware.RequireRoleByMethod(accounts.RoleViewer, accounts.RoleEditor, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodOptions || auth.IsPublic(path):
+			next.ServeHTTP(w, r)
+		case underPath(path, handlers.APIKeysPath) || path == streamTokenPath:
+			viewer.ServeHTTP(w, r)
+		case slices.ContainsFunc(adminPaths, func(prefix string) bool { return underPath(path, prefix) }):
+			admin.ServeHTTP(w, r)
+		default:
+			byMethod.ServeHTTP(w, r)
+		}
+	})
+}
+
+// underPath reports whether path is prefix or below it
+func underPath(path, prefix string) bool {
+	prefix = strings.TrimRight(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// streamTokenPath is where browsers get the short-lived tokens they open
+// event streams and the WebSocket gateway with, since neither EventSource
+// nor the WebSocket handshake can set headers
+const streamTokenPath = "/api/v1/stream-token"
+
+// newJWTAuth configures authentication from JWT_SECRET and JWT_ALGORITHM.
+// Webhooks are public since they carry their own signatures. Without a
+// secret authentication is disabled, which is refused in production.
+// Execution event streams and the WebSocket gateway also take stream
+// tokens in their query, since browsers cannot set headers on them. Logged
+// out tokens are blacklisted in Redis when REDIS_URL is set. The API keys
+// it also accepts are kept in db and managed by the returned service, which
+// is nil when API keys are disabled.
+func newJWTAuth(authMetrics middleware.AuthMetrics, db *database.Pool) (*middleware.JWTAuth, *auth.APIKeyService) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		if os.Getenv("APP_ENV") == "production" {
+			log.Fatal("JWT_SECRET must be set in production")
+		}
+		log.Println("JWT_SECRET is not set; API authentication is disabled")
+		return nil, nil
+	}
+
+	config := middleware.JWTConfig{
+		Secret:      secret,
+		Algorithm:   os.Getenv("JWT_ALGORITHM"),
+		PublicPaths: append([]string{handlers.WebhookPathPrefix + "*"}, middleware.DefaultPublicPaths...),
+		Blacklist:   newTokenBlacklist(os.Getenv("REDIS_URL")),
+		Metrics:     authMetrics,
+		StreamPaths: []string{handlers.ExecutionPathPrefix + "*", handlers.WebSocketPath},
+	}
+	apiKeys := newAPIKeyService(db)
+	if apiKeys != nil {
+		config.APIKeys = apiKeys
+	}
+
+	jwtAuth, err := middleware.NewJWTAuth(config)
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	return jwtAuth, apiKeys
+}
+
+// newTokenBlacklist returns a Redis token blacklist for redisURL, or an
+// in-memory one when it is empty or unreachable
+func newTokenBlacklist(redisURL string) middleware.TokenBlacklist {
+	if redisURL == "" {
+		return middleware.NewMemoryTokenBlacklist()
+	}
+	client := redis.NewClient(builtin.RedisOptions(redisURL))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis unavailable for the token blacklist, revocations are kept in memory: %v", err)
+		client.Close()
+		return middleware.NewMemoryTokenBlacklist()
+	}
+	return middleware.NewRedisTokenBlacklist(client)
+}
+
+// newTemporalService connects to Temporal as configured by the TEMPORAL_*
+// variables and starts the worker running executions there on executor.
+// Without TEMPORAL_ADDRESS, or when Temporal is unreachable, executions run
+// in process.
+func newTemporalService(executor *engine.WorkflowExecutor) *temporal.Service {
+	config := temporal.FromEnv(temporal.DefaultConfig())
+	if config.Address == "" {
+		return temporal.NewService(nil, config, executor)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := temporal.Dial(ctx, config)
+	if err != nil {
+		log.Printf("Temporal unavailable at %s, executions run in process: %v", config.Address, err)
+		return temporal.NewService(nil, config, executor)
+	}
+	service := temporal.NewService(client, config, executor)
+	if err := service.StartWorker(); err != nil {
+		log.Printf("Failed to start the Temporal worker, executions run in process: %v", err)
+		service.Close()
+		return temporal.NewService(nil, config, executor)
+	}
+	log.Printf("Running executions on Temporal at %s, task queue %s", config.Address, config.TaskQueue)
+	return service
+}
+
+// newDatabasePool connects to the database at DATABASE_URL, with the pool
+// settings of the CITADEL_DATABASE_* variables. It returns nil when
+// DATABASE_URL is not set.
+func newDatabasePool() *database.Pool {
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dbConfig := database.FromEnv(database.DefaultConfig())
+	dbConfig.URL = dbURL
+	pool, err := database.NewPool(ctx, dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	return pool
+}
+
+// newDeadLetterQueue opens the queue of the workers, as selected by
+// CITADEL_WORKER_TASK_QUEUE_TYPE: Redis at REDIS_URL, or the executions
+// table of db. It returns nil when the queue is not configured or
+// unreachable.
+func newDeadLetterQueue(db *database.Pool) worker.DeadLetterQueue {
+	config := worker.FromEnv(worker.DefaultConfig())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	switch queueType := os.Getenv("CITADEL_WORKER_TASK_QUEUE_TYPE"); queueType {
+	case worker.QueueRedis:
+		client := redis.NewClient(builtin.RedisOptions(os.Getenv("REDIS_URL")))
+		if err := client.Ping(ctx).Err(); err != nil {
+			log.Printf("Redis unavailable, the dead-letter queue is not served: %v", err)
+			client.Close()
+			return nil
+		}
+		return worker.NewRedisQueue(client, worker.DefaultRedisPrefix, config.Lease(), worker.DefaultRetention)
+	case worker.QueueDatabase, "":
+		if db == nil {
+			return nil
+		}
+		return worker.NewPostgresQueue(db, config.Lease())
+	default:
+		log.Printf("Invalid CITADEL_WORKER_TASK_QUEUE_TYPE %q, the dead-letter queue is not served", queueType)
+		return nil
+	}
+}
+
+// newCredentialVault opens the credentials encrypted with
+// CREDENTIALS_MASTER_KEY, in db or else in memory. It returns nil when no
+// master key is set.
+func newCredentialVault(db *database.Pool) *credentials.Vault {
+	masterKey := os.Getenv("CREDENTIALS_MASTER_KEY")
+	if masterKey == "" {
+		log.Println("CREDENTIALS_MASTER_KEY is not set; credentials are disabled")
+		return nil
+	}
+	cipher, err := credentials.NewCipher(masterKey)
+	if err != nil {
+		log.Fatalf("Invalid CREDENTIALS_MASTER_KEY: %v", err)
+	}
+
+	if db == nil {
+		log.Println("DATABASE_URL is not set; credentials are kept in memory")
+		return credentials.NewVault(credentials.NewMemoryStore(), cipher)
+	}
+	return credentials.NewVault(credentials.NewPostgresStore(db), cipher)
+}
+
+// newAPIKeyService keeps API keys in db, whose users table has the roles
+// they act with. Without a database there are no roles to look up, so it
+// returns nil and API keys are disabled.
+func newAPIKeyService(db *database.Pool) *auth.APIKeyService {
+	if db == nil {
+		log.Println("DATABASE_URL is not set; API keys are disabled")
+		return nil
+	}
+	return auth.NewAPIKeyService(auth.NewPostgresAPIKeyStore(db), accounts.NewAuthenticator(accounts.NewPostgresStore(db), 0))
 }
 
 func getPort() string {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citadel-agent/backend/internal/api/handlers"
+	"citadel-agent/backend/internal/nodes/builtin"
+	"citadel-agent/backend/internal/plugins"
+	"citadel-agent/backend/internal/temporal"
+	"citadel-agent/backend/internal/workflow/core/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthIsServedWithoutToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "health-test-secret")
+	t.Setenv("DATABASE_URL", "")
+
+	registry := engine.NewNodeTypeRegistry()
+	builtin.Register(registry, nil)
+	executor := engine.NewWorkflowExecutor(registry)
+	webhookHandler := handlers.NewWebhookHandler(executor)
+	workflowHandler := handlers.NewWorkflowHandler(executor, webhookHandler)
+	mux := http.NewServeMux()
+	setupRoutes(mux, workflowHandler, handlers.NewNodeHandler(registry), webhookHandler,
+		handlers.NewExecutionHandler(executor), handlers.NewWebSocketHandler(executor, workflowHandler, nil),
+		handlers.NewPluginHandler(plugins.NewNodeManager()), handlers.NewHealthHandler(registry),
+		handlers.NewTemporalHandler(temporal.NewService(nil, temporal.DefaultConfig(), executor), workflowHandler))
+	auth, _ := newJWTAuth(nil, nil)
+	require.NotNil(t, auth)
+	server := httptest.NewServer(auth.HTTP(requireRoles(auth, nil, mux)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var health map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	assert.Equal(t, "ok", health["status"])
+	assert.Equal(t, "0s", health["uptime"])
+	assert.Equal(t, float64(len(registry.ListNodeTypes())), health["node_types_registered"])
+	assert.NotZero(t, health["node_types_registered"])
+
+	// Other API routes still need a token
+	resp, err = http.Get(server.URL + "/api/workflows")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,13 @@
+-- Migration: 000001_initial_schema
+-- Description: Drop every table of the initial schema
+
+BEGIN;
+
+DROP TABLE IF EXISTS scheduled_workflows;
+DROP TABLE IF EXISTS node_executions;
+DROP TABLE IF EXISTS executions;
+DROP TABLE IF EXISTS nodes;
+DROP TABLE IF EXISTS workflows;
+DROP TABLE IF EXISTS users;
+
+COMMIT;
@@ -0,0 +1,90 @@
+-- Migration: 000001_initial_schema
+-- Description: Tables previously created by cmd/migrate on every run. The
+-- statements are idempotent so that databases created that way can adopt
+-- versioned migrations.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    username VARCHAR(255) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    first_name VARCHAR(255),
+    last_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS workflows (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    definition JSONB,
+    status VARCHAR(50) DEFAULT 'active',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS nodes (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER REFERENCES workflows(id) ON DELETE CASCADE,
+    type VARCHAR(255) NOT NULL,
+    config JSONB,
+    status VARCHAR(50) DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS executions (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER REFERENCES workflows(id) ON DELETE CASCADE,
+    status VARCHAR(50) DEFAULT 'running',
+    result JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- How queued executions were triggered
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS triggered_by VARCHAR(50);
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS trigger_params JSONB;
+
+-- Persisted execution state, used to resume interrupted executions
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS definition JSONB;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS error TEXT;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS node_executions (
+    id SERIAL PRIMARY KEY,
+    execution_id INTEGER NOT NULL REFERENCES executions(id) ON DELETE CASCADE,
+    node_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    output JSONB,
+    error TEXT,
+    retry_count INTEGER DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (execution_id, node_id)
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_workflows (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER REFERENCES workflows(id) ON DELETE CASCADE,
+    cron_expression VARCHAR(255) NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_scheduled_workflows_next_run ON scheduled_workflows (next_run_at) WHERE enabled;
+
+-- Schedules discovered from schedule_trigger nodes
+ALTER TABLE scheduled_workflows ADD COLUMN IF NOT EXISTS node_id INTEGER REFERENCES nodes(id) ON DELETE CASCADE;
+ALTER TABLE scheduled_workflows ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scheduled_workflows_node ON scheduled_workflows (node_id);
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- Migration: 000002_add_user_providers
+-- Description: Remove the OAuth provider columns of users
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_users_provider;
+
+-- OAuth users keep their rows but can no longer sign in, since no password
+-- matches an empty hash
+UPDATE users SET password_hash = '' WHERE password_hash IS NULL;
+ALTER TABLE users ALTER COLUMN password_hash SET NOT NULL;
+
+ALTER TABLE users DROP COLUMN last_login_at;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN provider_id;
+ALTER TABLE users DROP COLUMN provider;
+
+COMMIT;
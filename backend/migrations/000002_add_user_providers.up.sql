@@ -0,0 +1,18 @@
+-- Migration: 000002_add_user_providers
+-- Description: Let users sign in with an OAuth provider (github, google)
+-- instead of a password
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN provider VARCHAR(50) NOT NULL DEFAULT 'local';
+ALTER TABLE users ADD COLUMN provider_id VARCHAR(255);
+ALTER TABLE users ADD COLUMN avatar_url TEXT;
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMP WITH TIME ZONE;
+
+-- OAuth users have no password
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+
+-- A provider account belongs to a single user
+CREATE UNIQUE INDEX idx_users_provider ON users (provider, provider_id) WHERE provider_id IS NOT NULL;
+
+COMMIT;
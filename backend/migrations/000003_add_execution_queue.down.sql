@@ -0,0 +1,13 @@
+-- Migration: 000003_add_execution_queue
+-- Description: Remove the worker queue columns of executions
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_executions_queue;
+
+ALTER TABLE executions DROP COLUMN heartbeat_at;
+ALTER TABLE executions DROP COLUMN worker_id;
+ALTER TABLE executions DROP COLUMN available_at;
+ALTER TABLE executions DROP COLUMN attempts;
+
+COMMIT;
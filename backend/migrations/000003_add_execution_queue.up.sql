@@ -0,0 +1,15 @@
+-- Migration: 000003_add_execution_queue
+-- Description: Let workers claim queued executions, retry failed ones and
+-- take over the executions of workers that stopped sending heartbeats
+
+BEGIN;
+
+ALTER TABLE executions ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE executions ADD COLUMN available_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE executions ADD COLUMN worker_id VARCHAR(255);
+ALTER TABLE executions ADD COLUMN heartbeat_at TIMESTAMP WITH TIME ZONE;
+
+-- Workers look for queued executions and expired leases
+CREATE INDEX idx_executions_queue ON executions (status, id) WHERE status IN ('queued', 'running');
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Migration: 000004_add_dead_letter_executions
+-- Description: Remove the dead-letter queue and failed attempts of executions
+
+BEGIN;
+
+DROP TABLE IF EXISTS dead_letter_executions;
+
+ALTER TABLE executions DROP COLUMN failures;
+
+COMMIT;
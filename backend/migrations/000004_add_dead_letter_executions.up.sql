@@ -0,0 +1,16 @@
+-- Migration: 000004_add_dead_letter_executions
+-- Description: Record the failed attempts of executions and keep the ones
+-- that exhausted their retries in a dead-letter queue
+
+BEGIN;
+
+ALTER TABLE executions ADD COLUMN failures JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS dead_letter_executions (
+    id SERIAL PRIMARY KEY,
+    execution_id INTEGER NOT NULL UNIQUE REFERENCES executions(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    dead_lettered_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Migration: 000005_add_credentials
+-- Description: Remove the credentials
+
+BEGIN;
+
+DROP TABLE IF EXISTS credentials;
+
+COMMIT;
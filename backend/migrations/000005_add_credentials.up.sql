@@ -0,0 +1,15 @@
+-- Migration: 000005_add_credentials
+-- Description: Keep the secrets node configs refer to with
+-- {{credentials.<name>}}, encrypted with the master key
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS credentials (
+    name VARCHAR(128) PRIMARY KEY,
+    encrypted_value BYTEA NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
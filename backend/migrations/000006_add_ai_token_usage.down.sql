@@ -0,0 +1,8 @@
+-- Migration: 000006_add_ai_token_usage
+-- Description: Remove the AI token usage
+
+BEGIN;
+
+DROP TABLE IF EXISTS ai_token_usage;
+
+COMMIT;
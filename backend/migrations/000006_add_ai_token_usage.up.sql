@@ -0,0 +1,20 @@
+-- Migration: 000006_add_ai_token_usage
+-- Description: Record the tokens of each AI model request, totalled per
+-- execution and per user to hold users to their token budget
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS ai_token_usage (
+    id BIGSERIAL PRIMARY KEY,
+    execution_id VARCHAR(255) NOT NULL DEFAULT '',
+    user_id VARCHAR(255) NOT NULL DEFAULT '',
+    prompt_tokens BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    total_tokens BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_token_usage_execution_id ON ai_token_usage (execution_id);
+CREATE INDEX IF NOT EXISTS idx_ai_token_usage_user_id ON ai_token_usage (user_id);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Migration: 000007_add_recorded_calls
+-- Description: Remove the recorded calls
+
+BEGIN;
+
+DROP TABLE IF EXISTS recorded_calls;
+
+COMMIT;
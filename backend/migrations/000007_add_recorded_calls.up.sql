@@ -0,0 +1,20 @@
+-- Migration: 000007_add_recorded_calls
+-- Description: Keep the inputs and outputs of the external nodes of
+-- recorded runs, so that the runs can be replayed without the services
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS recorded_calls (
+    recording_id VARCHAR(255) NOT NULL,
+    node_id VARCHAR(255) NOT NULL,
+    sequence INTEGER NOT NULL,
+    input JSONB,
+    output JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    input_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    output_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    recorded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recording_id, node_id, sequence)
+);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Migration: 000008_add_password_reset_tokens
+-- Description: Remove the password reset tokens
+
+BEGIN;
+
+DROP TABLE IF EXISTS password_reset_tokens;
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Migration: 000009_add_two_factor_auth
+-- Description: Remove two-factor authentication
+
+BEGIN;
+
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
+
+COMMIT;
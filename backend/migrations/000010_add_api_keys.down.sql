@@ -0,0 +1,8 @@
+-- Migration: 000010_add_api_keys
+-- Description: Remove API keys
+
+BEGIN;
+
+DROP TABLE IF EXISTS api_keys;
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Migration: 000011_add_user_roles
+-- Description: Remove the roles of users
+
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS roles;
+
+COMMIT;
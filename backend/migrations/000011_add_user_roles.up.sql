@@ -0,0 +1,11 @@
+-- Migration: 000011_add_user_roles
+-- Description: Roles of users (viewer, editor or admin), which their API
+-- keys also act with. Existing users keep write access as editors; new
+-- users start as viewers.
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN roles TEXT[] NOT NULL DEFAULT '{editor}';
+ALTER TABLE users ALTER COLUMN roles SET DEFAULT '{viewer}';
+
+COMMIT;
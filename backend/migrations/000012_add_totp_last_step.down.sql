@@ -0,0 +1,8 @@
+-- Migration: 000012_add_totp_last_step
+-- Description: Forget the last accepted TOTP time steps
+
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+
+COMMIT;
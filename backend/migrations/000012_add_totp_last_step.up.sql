@@ -0,0 +1,9 @@
+-- Migration: 000012_add_totp_last_step
+-- Description: Remember the time step of the last accepted TOTP code of
+-- each user, so that codes cannot be replayed
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT;
+
+COMMIT;
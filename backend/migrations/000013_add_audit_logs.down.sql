@@ -0,0 +1,8 @@
+-- Migration: 000013_add_audit_logs
+-- Description: Remove the audit trail
+
+BEGIN;
+
+DROP TABLE IF EXISTS audit_logs;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Migration: 000013_add_audit_logs
+-- Description: Audit trail of user actions, recorded by the audit
+-- middleware. Users are referred to by the IDs of their tokens, like
+-- api_keys does, or "anonymous".
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id VARCHAR(255),
+    action VARCHAR(100) NOT NULL,
+    resource VARCHAR(50) NOT NULL,
+    resource_id VARCHAR(255),
+    changes JSONB,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    status VARCHAR(20) NOT NULL,
+    error_msg TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs(resource, resource_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_status ON audit_logs(status);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_action ON audit_logs(user_id, action, created_at DESC);
+
+COMMIT;
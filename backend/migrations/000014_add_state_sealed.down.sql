@@ -0,0 +1,10 @@
+-- Migration: 000014_add_state_sealed
+-- Description: Stop marking sealed execution state
+
+BEGIN;
+
+ALTER TABLE recorded_calls DROP COLUMN IF EXISTS state_sealed;
+ALTER TABLE node_executions DROP COLUMN IF EXISTS state_sealed;
+ALTER TABLE executions DROP COLUMN IF EXISTS state_sealed;
+
+COMMIT;
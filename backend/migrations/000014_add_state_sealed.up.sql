@@ -0,0 +1,19 @@
+-- Migration: 000014_add_state_sealed
+-- Description: Mark the execution state written compressed or encrypted,
+-- which plain JSON could otherwise be mistaken for. Rows written in the
+-- sealed format before the column existed are marked from their envelope.
+
+BEGIN;
+
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS state_sealed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE node_executions ADD COLUMN IF NOT EXISTS state_sealed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE recorded_calls ADD COLUMN IF NOT EXISTS state_sealed BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE executions SET state_sealed = TRUE
+WHERE trigger_params->>'$state' IN ('gzip', 'aes-gcm', 'gzip+aes-gcm') AND jsonb_typeof(trigger_params->'data') = 'string';
+UPDATE node_executions SET state_sealed = TRUE
+WHERE output->>'$state' IN ('gzip', 'aes-gcm', 'gzip+aes-gcm') AND jsonb_typeof(output->'data') = 'string';
+UPDATE recorded_calls SET state_sealed = TRUE
+WHERE output->>'$state' IN ('gzip', 'aes-gcm', 'gzip+aes-gcm') AND jsonb_typeof(output->'data') = 'string';
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Migration: 000015_add_output_redacted
+-- Description: Stop marking redacted node outputs
+
+BEGIN;
+
+ALTER TABLE node_executions DROP COLUMN IF EXISTS output_redacted;
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Migration: 000015_add_output_redacted
+-- Description: Mark node outputs stored with secrets redacted, so resumed
+-- executions run those nodes again instead of passing the redacted values
+-- on. Plain outputs written before the column existed are marked from their
+-- content; sealed ones cannot be told apart.
+
+BEGIN;
+
+ALTER TABLE node_executions ADD COLUMN IF NOT EXISTS output_redacted BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE node_executions SET output_redacted = TRUE
+WHERE NOT state_sealed AND output::text LIKE '%[REDACTED]%';
+
+COMMIT;
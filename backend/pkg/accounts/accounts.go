@@ -0,0 +1,434 @@
+// Package accounts registers local users with bcrypt-hashed passwords and
+// verifies their credentials
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Lengths of the passwords Register accepts, in bytes. bcrypt hashes at
+// most 72.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var (
+	// ErrInvalidCredentials is returned by Login for an unknown email or a
+	// wrong password alike, so that callers cannot tell them apart
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrEmailTaken is returned by Register for an email already in use
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrInvalidEmail is returned by Register for a malformed email
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrWeakPassword is returned by Register for passwords shorter than
+	// MinPasswordLength
+	ErrWeakPassword = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	// ErrPasswordTooLong is returned by Register for passwords longer than
+	// MaxPasswordLength
+	ErrPasswordTooLong = fmt.Errorf("password must be at most %d bytes", MaxPasswordLength)
+	// ErrNotFound is returned by stores without the requested account
+	ErrNotFound = errors.New("account not found")
+)
+
+// Account is a user of the users table
+type Account struct {
+	ID       int64
+	Email    string
+	Username string
+	Provider string
+	// PasswordHash is the bcrypt hash of the password, empty for users who
+	// sign in with an OAuth provider
+	PasswordHash string
+	// TwoFactorEnabled is set once the account confirmed a TOTP enrollment,
+	// and logins need a code from then on
+	TwoFactorEnabled bool
+	// Roles decide what the account may do, see HasRole
+	Roles       []string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+// Store keeps accounts
+type Store interface {
+	// FindByEmail returns ErrNotFound when no account has email
+	FindByEmail(ctx context.Context, email string) (*Account, error)
+	// Create adds account, setting its ID and CreatedAt, and returns
+	// ErrEmailTaken when its email or username is in use
+	Create(ctx context.Context, account *Account) error
+	// RecordLogin sets the last login time of the account with id
+	RecordLogin(ctx context.Context, id int64, at time.Time) error
+	// SetPassword replaces the password hash of the account with id
+	SetPassword(ctx context.Context, id int64, passwordHash string) error
+
+	// SaveResetToken keeps the hash of a password reset token of the
+	// account with id until expiresAt
+	SaveResetToken(ctx context.Context, tokenHash string, id int64, expiresAt time.Time) error
+	// ResetPassword uses the token with tokenHash to replace the password
+	// hash of its account, and invalidates the other unused reset tokens of
+	// the account, all in one transaction. It returns the ID of the
+	// account, or ErrInvalidResetToken when the token is unknown, used or
+	// expired at now.
+	ResetPassword(ctx context.Context, tokenHash string, now time.Time, passwordHash string) (int64, error)
+
+	// SetTOTPSecret keeps the encrypted TOTP secret of a pending enrollment
+	// of the account with id, disabling two-factor authentication until it
+	// is confirmed
+	SetTOTPSecret(ctx context.Context, id int64, encryptedSecret []byte) error
+	// TOTPSecret returns the encrypted TOTP secret of the account with id,
+	// nil when it has none
+	TOTPSecret(ctx context.Context, id int64) ([]byte, error)
+	// EnableTwoFactor enables two-factor authentication of the account with
+	// id and replaces its recovery codes with those with codeHashes
+	EnableTwoFactor(ctx context.Context, id int64, codeHashes []string) error
+	// UseRecoveryCode uses up the recovery code with codeHash of the account
+	// with id, and returns ErrInvalidCode when it has no such unused code
+	UseRecoveryCode(ctx context.Context, id int64, codeHash string) error
+	// UseTOTPStep records step as the last time step a TOTP code of the
+	// account with id was accepted for, and returns ErrInvalidCode unless
+	// it is after the last one, so that codes cannot be replayed
+	UseTOTPStep(ctx context.Context, id int64, step int64) error
+
+	// SetRoles replaces the roles of the account with id
+	SetRoles(ctx context.Context, id int64, roles []string) error
+	// Roles returns the roles of the account with id, or ErrNotFound
+	Roles(ctx context.Context, id int64) ([]string, error)
+}
+
+// Authenticator registers and logs in local users
+type Authenticator struct {
+	store    Store
+	cost     int
+	resetTTL time.Duration
+	cipher   SecretCipher
+	issuer   string
+	now      func() time.Time
+
+	dummyOnce sync.Once
+	dummyHash []byte
+}
+
+// NewAuthenticator creates an authenticator hashing passwords with bcrypt
+// cost, or bcrypt.DefaultCost when it is 0
+func NewAuthenticator(store Store, cost int) *Authenticator {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &Authenticator{store: store, cost: cost, resetTTL: DefaultResetTokenTTL, issuer: DefaultIssuer, now: time.Now}
+}
+
+// normalizeEmail makes emails case-insensitive
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Register creates a local account for email with a hash of password and
+// DefaultRole. The username defaults to the email.
+func (a *Authenticator) Register(ctx context.Context, email, username, password string) (*Account, error) {
+	email = normalizeEmail(email)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return nil, ErrInvalidEmail
+	}
+	hash, err := a.hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	if username = strings.TrimSpace(username); username == "" {
+		username = email
+	}
+	account := &Account{
+		Email:        email,
+		Username:     username,
+		Provider:     "local",
+		PasswordHash: hash,
+		Roles:        []string{DefaultRole},
+	}
+	if err := a.store.Create(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// hashPassword checks the length of password and hashes it
+func (a *Authenticator) hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Login returns the account of email when password matches it, and
+// ErrInvalidCredentials otherwise. Unknown emails and accounts without a
+// password are checked against a dummy hash, so that they take as long as
+// a wrong password and do not reveal which emails are registered.
+func (a *Authenticator) Login(ctx context.Context, email, password string) (*Account, error) {
+	account, err := a.store.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if account == nil || account.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(a.dummy(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	account.LastLoginAt = a.now()
+	if err := a.store.RecordLogin(ctx, account.ID, account.LastLoginAt); err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+	return account, nil
+}
+
+// dummy returns a hash with the cost of real ones, made on first use
+func (a *Authenticator) dummy() []byte {
+	a.dummyOnce.Do(func() {
+		a.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("citadel-dummy-password"), a.cost)
+	})
+	return a.dummyHash
+}
+
+// MemoryStore keeps accounts in process memory. They are lost on restart;
+// use PostgresStore to keep them.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	accounts      map[string]*Account
+	resetTokens   map[string]*resetToken
+	totpSecrets   map[int64][]byte
+	recoveryCodes map[int64]map[string]bool
+	totpSteps     map[int64]int64
+	nextID        int64
+}
+
+type resetToken struct {
+	accountID int64
+	expiresAt time.Time
+	used      bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts:      make(map[string]*Account),
+		resetTokens:   make(map[string]*resetToken),
+		totpSecrets:   make(map[int64][]byte),
+		recoveryCodes: make(map[int64]map[string]bool),
+		totpSteps:     make(map[int64]int64),
+	}
+}
+
+// FindByEmail implements Store
+func (s *MemoryStore) FindByEmail(ctx context.Context, email string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	account, ok := s.accounts[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *account
+	found.Roles = append([]string(nil), account.Roles...)
+	return &found, nil
+}
+
+// Create implements Store
+func (s *MemoryStore) Create(ctx context.Context, account *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.accounts {
+		if existing.Email == account.Email || existing.Username == account.Username {
+			return ErrEmailTaken
+		}
+	}
+	s.nextID++
+	account.ID = s.nextID
+	account.CreatedAt = time.Now()
+	stored := *account
+	stored.Roles = append([]string(nil), account.Roles...)
+	s.accounts[account.Email] = &stored
+	return nil
+}
+
+// RecordLogin implements Store
+func (s *MemoryStore) RecordLogin(ctx context.Context, id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.byID(id)
+	if account == nil {
+		return ErrNotFound
+	}
+	account.LastLoginAt = at
+	return nil
+}
+
+// SetPassword implements Store
+func (s *MemoryStore) SetPassword(ctx context.Context, id int64, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.byID(id)
+	if account == nil {
+		return ErrNotFound
+	}
+	account.PasswordHash = passwordHash
+	return nil
+}
+
+// byID returns the account with id, or nil. s.mu must be held.
+func (s *MemoryStore) byID(id int64) *Account {
+	for _, account := range s.accounts {
+		if account.ID == id {
+			return account
+		}
+	}
+	return nil
+}
+
+// SaveResetToken implements Store
+func (s *MemoryStore) SaveResetToken(ctx context.Context, tokenHash string, id int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetTokens[tokenHash] = &resetToken{accountID: id, expiresAt: expiresAt}
+	return nil
+}
+
+// ResetPassword implements Store
+func (s *MemoryStore) ResetPassword(ctx context.Context, tokenHash string, now time.Time, passwordHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.resetTokens[tokenHash]
+	if !ok || token.used || !now.Before(token.expiresAt) {
+		return 0, ErrInvalidResetToken
+	}
+	account := s.byID(token.accountID)
+	if account == nil {
+		return 0, ErrInvalidResetToken
+	}
+	for _, other := range s.resetTokens {
+		if other.accountID == token.accountID {
+			other.used = true
+		}
+	}
+	account.PasswordHash = passwordHash
+	return account.ID, nil
+}
+
+// Querier runs queries, as database.Pool does
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// PostgresStore keeps accounts in the users table
+type PostgresStore struct {
+	db Querier
+}
+
+// NewPostgresStore creates a store on db
+func NewPostgresStore(db Querier) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// FindByEmail implements Store
+func (s *PostgresStore) FindByEmail(ctx context.Context, email string) (*Account, error) {
+	account := &Account{}
+	var passwordHash *string
+	var lastLoginAt *time.Time
+	err := s.db.QueryRow(ctx, `
+		SELECT id, email, username, provider, password_hash, totp_enabled, roles, created_at, last_login_at
+		FROM users WHERE lower(email) = $1`,
+		email,
+	).Scan(&account.ID, &account.Email, &account.Username, &account.Provider, &passwordHash,
+		&account.TwoFactorEnabled, &account.Roles, &account.CreatedAt, &lastLoginAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if passwordHash != nil {
+		account.PasswordHash = *passwordHash
+	}
+	if lastLoginAt != nil {
+		account.LastLoginAt = *lastLoginAt
+	}
+	return account, nil
+}
+
+// Create implements Store
+func (s *PostgresStore) Create(ctx context.Context, account *Account) error {
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO users (email, username, password_hash, provider, roles)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		account.Email, account.Username, account.PasswordHash, account.Provider, account.Roles,
+	).Scan(&account.ID, &account.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// RecordLogin implements Store
+func (s *PostgresStore) RecordLogin(ctx context.Context, id int64, at time.Time) error {
+	_, err := s.db.Exec(ctx, `UPDATE users SET last_login_at = $2 WHERE id = $1`, id, at)
+	return err
+}
+
+// SetPassword implements Store
+func (s *PostgresStore) SetPassword(ctx context.Context, id int64, passwordHash string) error {
+	_, err := s.db.Exec(ctx, `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, id, passwordHash)
+	return err
+}
+
+// SaveResetToken implements Store
+func (s *PostgresStore) SaveResetToken(ctx context.Context, tokenHash string, id int64, expiresAt time.Time) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)`,
+		tokenHash, id, expiresAt,
+	)
+	return err
+}
+
+// ResetPassword implements Store. A single statement is a transaction of
+// its own: the password only changes if the token is used up along with
+// the other tokens of the account.
+func (s *PostgresStore) ResetPassword(ctx context.Context, tokenHash string, now time.Time, passwordHash string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(ctx, `
+		WITH used AS (
+			UPDATE password_reset_tokens SET used_at = $2
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+			RETURNING user_id
+		), others AS (
+			UPDATE password_reset_tokens SET used_at = $2
+			WHERE user_id IN (SELECT user_id FROM used) AND token_hash <> $1 AND used_at IS NULL
+		)
+		UPDATE users SET password_hash = $3, updated_at = NOW()
+		WHERE id IN (SELECT user_id FROM used)
+		RETURNING id`,
+		tokenHash, now, passwordHash,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInvalidResetToken
+	}
+	return id, err
+}
@@ -0,0 +1,75 @@
+package accounts
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestAuthenticator() *Authenticator {
+	return NewAuthenticator(NewMemoryStore(), bcrypt.MinCost)
+}
+
+func TestLoginVerifiesPassword(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+
+	registered, err := auth.Register(ctx, "Alice@Example.com", "", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", registered.Email)
+	assert.Equal(t, "alice@example.com", registered.Username)
+	assert.NotEqual(t, "correct horse", registered.PasswordHash)
+
+	account, err := auth.Login(ctx, "alice@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, registered.ID, account.ID)
+	assert.False(t, account.LastLoginAt.IsZero())
+
+	account, err = auth.Login(ctx, " ALICE@example.com", "correct horse")
+	require.NoError(t, err, "emails are case-insensitive")
+	assert.Equal(t, registered.ID, account.ID)
+
+	_, err = auth.Login(ctx, "alice@example.com", "battery staple")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = auth.Login(ctx, "alice@example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestLoginDoesNotRevealUnknownEmails(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	auth := NewAuthenticator(store, bcrypt.MinCost)
+
+	_, err := auth.Login(ctx, "nobody@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// OAuth users have no password to log in with
+	require.NoError(t, store.Create(ctx, &Account{Email: "octocat@example.com", Username: "octocat", Provider: "github"}))
+	_, err = auth.Login(ctx, "octocat@example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestRegisterValidates(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+
+	_, err := auth.Register(ctx, "not an email", "", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	_, err = auth.Register(ctx, "Bob <bob@example.com>", "", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	_, err = auth.Register(ctx, "bob@example.com", "", "short")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	_, err = auth.Register(ctx, "bob@example.com", "", strings.Repeat("x", MaxPasswordLength+1))
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+
+	_, err = auth.Register(ctx, "bob@example.com", "bob", "correct horse")
+	require.NoError(t, err)
+	_, err = auth.Register(ctx, "BOB@example.com", "", "another password")
+	assert.ErrorIs(t, err, ErrEmailTaken)
+	_, err = auth.Register(ctx, "robert@example.com", "bob", "another password")
+	assert.ErrorIs(t, err, ErrEmailTaken, "usernames are unique too")
+}
@@ -0,0 +1,86 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultResetTokenTTL is how long password reset tokens are valid unless
+// configured otherwise
+const DefaultResetTokenTTL = time.Hour
+
+// ErrInvalidResetToken is returned for password reset tokens that are
+// unknown, already used or expired
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordReset is a password reset token issued for an account. Only its
+// hash is stored, so the token can only be handed to the user now.
+type PasswordReset struct {
+	Email     string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// SetResetTokenTTL sets how long the password reset tokens issued from now
+// on are valid
+func (a *Authenticator) SetResetTokenTTL(ttl time.Duration) {
+	a.resetTTL = ttl
+}
+
+// RequestPasswordReset issues a single-use password reset token for the
+// local account of email. It returns nil without an error when there is no
+// such account, which callers should not reveal.
+func (a *Authenticator) RequestPasswordReset(ctx context.Context, email string) (*PasswordReset, error) {
+	account, err := a.store.FindByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Users of OAuth providers have no password to reset
+	if account.PasswordHash == "" {
+		return nil, nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	reset := &PasswordReset{
+		Email:     account.Email,
+		Token:     base64.RawURLEncoding.EncodeToString(raw),
+		ExpiresAt: a.now().Add(a.resetTTL),
+	}
+	if err := a.store.SaveResetToken(ctx, hashToken(reset.Token), account.ID, reset.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to save reset token: %w", err)
+	}
+	return reset, nil
+}
+
+// ResetPassword sets the password of the account token was issued for, and
+// uses up the token along with every other reset token of the account, so
+// that the links of earlier requests stop working too. A password that is
+// too short or too long is refused before the token is used.
+func (a *Authenticator) ResetPassword(ctx context.Context, token, password string) error {
+	hash, err := a.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = a.store.ResetPassword(ctx, hashToken(token), a.now(), hash)
+	return err
+}
+
+// hashToken returns the SHA-256 of a reset token or recovery code,
+// hex-encoded. With 256 and 80 random bits they cannot be brute-forced
+// from the hash, so unlike passwords they need no slow, salted hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,96 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordResetCycle(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	_, err := auth.Register(ctx, "alice@example.com", "", "old password")
+	require.NoError(t, err)
+
+	reset, err := auth.RequestPasswordReset(ctx, "Alice@Example.com")
+	require.NoError(t, err)
+	require.NotNil(t, reset)
+	assert.Equal(t, "alice@example.com", reset.Email)
+	assert.NotEmpty(t, reset.Token)
+
+	assert.ErrorIs(t, auth.ResetPassword(ctx, reset.Token, "short"), ErrWeakPassword)
+	require.NoError(t, auth.ResetPassword(ctx, reset.Token, "new password"), "refused passwords do not use the token up")
+
+	_, err = auth.Login(ctx, "alice@example.com", "old password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = auth.Login(ctx, "alice@example.com", "new password")
+	assert.NoError(t, err)
+
+	// Tokens are single-use
+	assert.ErrorIs(t, auth.ResetPassword(ctx, reset.Token, "another password"), ErrInvalidResetToken)
+	_, err = auth.Login(ctx, "alice@example.com", "new password")
+	assert.NoError(t, err)
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+	auth.SetResetTokenTTL(15 * time.Minute)
+	_, err := auth.Register(ctx, "alice@example.com", "", "old password")
+	require.NoError(t, err)
+
+	reset, err := auth.RequestPasswordReset(ctx, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), reset.ExpiresAt)
+
+	now = now.Add(15 * time.Minute)
+	assert.ErrorIs(t, auth.ResetPassword(ctx, reset.Token, "new password"), ErrInvalidResetToken)
+	_, err = auth.Login(ctx, "alice@example.com", "old password")
+	assert.NoError(t, err)
+}
+
+func TestPasswordResetOfUnknownAccounts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	auth := NewAuthenticator(store, bcrypt.MinCost)
+	require.NoError(t, store.Create(ctx, &Account{Email: "octocat@example.com", Username: "octocat", Provider: "github"}))
+
+	for _, email := range []string{"nobody@example.com", "octocat@example.com"} {
+		reset, err := auth.RequestPasswordReset(ctx, email)
+		assert.NoError(t, err)
+		assert.Nil(t, reset, email)
+	}
+	assert.ErrorIs(t, auth.ResetPassword(ctx, "made-up", "new password"), ErrInvalidResetToken)
+}
+
+func TestPasswordResetInvalidatesOtherTokens(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	_, err := auth.Register(ctx, "alice@example.com", "", "old password")
+	require.NoError(t, err)
+	_, err = auth.Register(ctx, "bob@example.com", "", "old password")
+	require.NoError(t, err)
+
+	first, err := auth.RequestPasswordReset(ctx, "alice@example.com")
+	require.NoError(t, err)
+	second, err := auth.RequestPasswordReset(ctx, "alice@example.com")
+	require.NoError(t, err)
+	other, err := auth.RequestPasswordReset(ctx, "bob@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, auth.ResetPassword(ctx, second.Token, "new password"))
+
+	// The link of the earlier request no longer works
+	assert.ErrorIs(t, auth.ResetPassword(ctx, first.Token, "stolen password"), ErrInvalidResetToken)
+	_, err = auth.Login(ctx, "alice@example.com", "new password")
+	assert.NoError(t, err)
+
+	// Other accounts keep theirs
+	require.NoError(t, auth.ResetPassword(ctx, other.Token, "bob's new password"))
+}
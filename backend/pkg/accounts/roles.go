@@ -0,0 +1,124 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles of accounts. Each role includes those below it: admins can do all
+// editors can, and editors all viewers can.
+const (
+	// RoleViewer reads workflows and executions
+	RoleViewer = "viewer"
+	// RoleEditor also creates, updates and executes workflows
+	RoleEditor = "editor"
+	// RoleAdmin also manages users, plugins and credentials
+	RoleAdmin = "admin"
+)
+
+// DefaultRole is the role of newly registered accounts
+const DefaultRole = RoleViewer
+
+// ErrInvalidRole is returned by SetRoles for unknown or missing roles
+var ErrInvalidRole = errors.New("invalid role")
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is viewer, editor or admin
+func ValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// HasRole reports whether roles include role or a role above it
+func HasRole(roles []string, role string) bool {
+	required := roleRanks[role]
+	if required == 0 {
+		return false
+	}
+	for _, r := range roles {
+		if roleRanks[r] >= required {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRoles replaces the roles of the account with id
+func (a *Authenticator) SetRoles(ctx context.Context, id int64, roles []string) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("%w: at least one is required", ErrInvalidRole)
+	}
+	seen := make(map[string]bool, len(roles))
+	var unique []string
+	for _, role := range roles {
+		if !ValidRole(role) {
+			return fmt.Errorf("%w %q, want viewer, editor or admin", ErrInvalidRole, role)
+		}
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+	sort.Strings(unique)
+	return a.store.SetRoles(ctx, id, unique)
+}
+
+// Roles returns the current roles of the user with userID, the account ID
+// in the "sub" claim of AccessToken, or ErrNotFound for unknown users
+func (a *Authenticator) Roles(ctx context.Context, userID string) ([]string, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return a.store.Roles(ctx, id)
+}
+
+// SetRoles implements Store
+func (s *MemoryStore) SetRoles(ctx context.Context, id int64, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.byID(id)
+	if account == nil {
+		return ErrNotFound
+	}
+	account.Roles = append([]string(nil), roles...)
+	return nil
+}
+
+// Roles implements Store
+func (s *MemoryStore) Roles(ctx context.Context, id int64) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	account := s.byID(id)
+	if account == nil {
+		return nil, ErrNotFound
+	}
+	return append([]string(nil), account.Roles...), nil
+}
+
+// SetRoles implements Store
+func (s *PostgresStore) SetRoles(ctx context.Context, id int64, roles []string) error {
+	tag, err := s.db.Exec(ctx, `UPDATE users SET roles = $2, updated_at = NOW() WHERE id = $1`, id, roles)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Roles implements Store
+func (s *PostgresStore) Roles(ctx context.Context, id int64) ([]string, error) {
+	var roles []string
+	err := s.db.QueryRow(ctx, `SELECT roles FROM users WHERE id = $1`, id).Scan(&roles)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return roles, err
+}
@@ -0,0 +1,48 @@
+package accounts
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolesIncludeLowerRoles(t *testing.T) {
+	assert.True(t, HasRole([]string{RoleAdmin}, RoleEditor))
+	assert.True(t, HasRole([]string{RoleAdmin}, RoleViewer))
+	assert.True(t, HasRole([]string{RoleViewer, RoleEditor}, RoleEditor))
+	assert.False(t, HasRole([]string{RoleViewer}, RoleEditor))
+	assert.False(t, HasRole([]string{RoleEditor}, RoleAdmin))
+	assert.False(t, HasRole(nil, RoleViewer))
+	assert.False(t, HasRole([]string{"owner"}, RoleViewer))
+	assert.False(t, HasRole([]string{RoleAdmin}, "owner"))
+}
+
+func TestSetRoles(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+
+	registered, err := auth.Register(ctx, "alice@example.com", "", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultRole}, registered.Roles)
+
+	require.NoError(t, auth.SetRoles(ctx, registered.ID, []string{RoleEditor, RoleAdmin, RoleEditor}))
+	account, err := auth.Login(ctx, "alice@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleAdmin, RoleEditor}, account.Roles)
+
+	assert.ErrorIs(t, auth.SetRoles(ctx, registered.ID, nil), ErrInvalidRole)
+	assert.ErrorIs(t, auth.SetRoles(ctx, registered.ID, []string{"owner"}), ErrInvalidRole)
+	assert.ErrorIs(t, auth.SetRoles(ctx, 42, []string{RoleViewer}), ErrNotFound)
+
+	// Roles are looked up by the user ID of access tokens
+	roles, err := auth.Roles(ctx, strconv.FormatInt(registered.ID, 10))
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleAdmin, RoleEditor}, roles)
+	_, err = auth.Roles(ctx, "42")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = auth.Roles(ctx, "alice")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
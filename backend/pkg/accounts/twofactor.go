@@ -0,0 +1,360 @@
+package accounts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TOTP parameters, the defaults of authenticator apps: 6-digit codes of
+// HMAC-SHA1 over 30-second steps
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// TOTPSkew is how many steps a code may be ahead or behind, for clocks
+	// that are slightly off
+	TOTPSkew = 1
+)
+
+// DefaultIssuer names Citadel in authenticator apps
+const DefaultIssuer = "Citadel Agent"
+
+// RecoveryCodeCount is how many recovery codes a confirmed enrollment gets
+const RecoveryCodeCount = 10
+
+// recoveryCodeBytes is the randomness of a recovery code: 80 bits, too
+// many to brute-force from its stored hash
+const recoveryCodeBytes = 10
+
+var (
+	// ErrInvalidCode is returned for a wrong TOTP or recovery code
+	ErrInvalidCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorNotConfigured is returned when no SecretCipher is set
+	ErrTwoFactorNotConfigured = errors.New("two-factor authentication is not configured")
+	// ErrTwoFactorEnabled is returned by Enroll for accounts that already
+	// have two-factor authentication
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrNoEnrollment is returned by ConfirmEnrollment without Enroll first
+	ErrNoEnrollment = errors.New("no pending two-factor enrollment")
+)
+
+// SecretCipher encrypts TOTP secrets at rest, as secretbox.Cipher does
+type SecretCipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// Enrollment is a TOTP secret to add to an authenticator app, as its
+// base32 encoding or as an otpauth:// URL for a QR code
+type Enrollment struct {
+	Secret string
+	URL    string
+}
+
+// SetSecretCipher enables two-factor authentication, with TOTP secrets
+// encrypted by cipher. issuer names the service in authenticator apps, or
+// DefaultIssuer when it is empty.
+func (a *Authenticator) SetSecretCipher(cipher SecretCipher, issuer string) {
+	if issuer == "" {
+		issuer = DefaultIssuer
+	}
+	a.cipher = cipher
+	a.issuer = issuer
+}
+
+// Enroll starts the TOTP enrollment of the account with id and email. It
+// takes effect once confirmed with a code from the app by
+// ConfirmEnrollment.
+func (a *Authenticator) Enroll(ctx context.Context, id int64, email string) (*Enrollment, error) {
+	if a.cipher == nil {
+		return nil, ErrTwoFactorNotConfigured
+	}
+	account, err := a.store.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	if account.ID != id {
+		return nil, ErrNotFound
+	}
+	if account.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	encrypted, err := a.cipher.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	if err := a.store.SetTOTPSecret(ctx, id, encrypted); err != nil {
+		return nil, err
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	query := url.Values{
+		"secret":    {encoded},
+		"issuer":    {a.issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	otpauth := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + a.issuer + ":" + account.Email,
+		RawQuery: query.Encode(),
+	}
+	return &Enrollment{Secret: encoded, URL: otpauth.String()}, nil
+}
+
+// ConfirmEnrollment enables two-factor authentication of the account with
+// id when code is valid for its pending secret, and returns its recovery
+// codes. They are shown once: only their hashes are kept.
+func (a *Authenticator) ConfirmEnrollment(ctx context.Context, id int64, code string) ([]string, error) {
+	secret, err := a.totpSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, code, a.now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+	// The code cannot be used again to log in
+	if err := a.store.UseTOTPStep(ctx, id, step); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+		codes[i] = encoded[:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:]
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	if err := a.store.EnableTwoFactor(ctx, id, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactor checks the second factor of a login of account, which
+// Login returned: a TOTP code or an unused recovery code, which is used up.
+// A TOTP code is only accepted once, and not after a code of a later time
+// step. It reports whether a recovery code was used.
+func (a *Authenticator) VerifyTwoFactor(ctx context.Context, account *Account, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		secret, err := a.totpSecret(ctx, account.ID)
+		if err != nil {
+			return false, err
+		}
+		step, ok := matchTOTP(secret, code, a.now())
+		if !ok {
+			return false, ErrInvalidCode
+		}
+		return false, a.store.UseTOTPStep(ctx, account.ID, step)
+	}
+	if code == "" {
+		return false, ErrInvalidCode
+	}
+	if err := a.store.UseRecoveryCode(ctx, account.ID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// totpSecret returns the decrypted TOTP secret of the account with id
+func (a *Authenticator) totpSecret(ctx context.Context, id int64) ([]byte, error) {
+	if a.cipher == nil {
+		return nil, ErrTwoFactorNotConfigured
+	}
+	encrypted, err := a.store.TOTPSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted == nil {
+		return nil, ErrNoEnrollment
+	}
+	secret, err := a.cipher.Decrypt(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return secret, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// totpCode returns the HOTP code of secret for counter (RFC 4226)
+func totpCode(secret []byte, counter uint64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// matchTOTP reports whether code is the TOTP code of secret at now, or at
+// up to TOTPSkew steps before or after it (RFC 6238), and returns the time
+// step it is the code of
+func matchTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	step := now.Unix() / int64(totpPeriod.Seconds())
+	matched, valid := int64(0), false
+	for skew := int64(-TOTPSkew); skew <= TOTPSkew; skew++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, uint64(step+skew))), []byte(code)) == 1 {
+			matched, valid = step+skew, true
+		}
+	}
+	return matched, valid
+}
+
+// SetTOTPSecret implements Store
+func (s *MemoryStore) SetTOTPSecret(ctx context.Context, id int64, encryptedSecret []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.byID(id)
+	if account == nil {
+		return ErrNotFound
+	}
+	account.TwoFactorEnabled = false
+	s.totpSecrets[id] = encryptedSecret
+	return nil
+}
+
+// TOTPSecret implements Store
+func (s *MemoryStore) TOTPSecret(ctx context.Context, id int64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.totpSecrets[id], nil
+}
+
+// EnableTwoFactor implements Store
+func (s *MemoryStore) EnableTwoFactor(ctx context.Context, id int64, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.byID(id)
+	if account == nil {
+		return ErrNotFound
+	}
+	account.TwoFactorEnabled = true
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = true
+	}
+	s.recoveryCodes[id] = codes
+	return nil
+}
+
+// UseRecoveryCode implements Store
+func (s *MemoryStore) UseRecoveryCode(ctx context.Context, id int64, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.recoveryCodes[id][codeHash] {
+		return ErrInvalidCode
+	}
+	delete(s.recoveryCodes[id], codeHash)
+	return nil
+}
+
+// UseTOTPStep implements Store
+func (s *MemoryStore) UseTOTPStep(ctx context.Context, id int64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.totpSteps[id]; ok && step <= last {
+		return ErrInvalidCode
+	}
+	s.totpSteps[id] = step
+	return nil
+}
+
+// SetTOTPSecret implements Store
+func (s *PostgresStore) SetTOTPSecret(ctx context.Context, id int64, encryptedSecret []byte) error {
+	_, err := s.db.Exec(ctx, `UPDATE users SET totp_secret = $2, totp_enabled = FALSE, updated_at = NOW() WHERE id = $1`, id, encryptedSecret)
+	return err
+}
+
+// TOTPSecret implements Store
+func (s *PostgresStore) TOTPSecret(ctx context.Context, id int64) ([]byte, error) {
+	var secret []byte
+	err := s.db.QueryRow(ctx, `SELECT totp_secret FROM users WHERE id = $1`, id).Scan(&secret)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return secret, err
+}
+
+// EnableTwoFactor implements Store. The recovery codes are replaced in the
+// same statement as two-factor authentication is enabled.
+func (s *PostgresStore) EnableTwoFactor(ctx context.Context, id int64, codeHashes []string) error {
+	_, err := s.db.Exec(ctx, `
+		WITH enabled AS (
+			UPDATE users SET totp_enabled = TRUE, updated_at = NOW() WHERE id = $1 RETURNING id
+		), cleared AS (
+			DELETE FROM recovery_codes WHERE user_id = $1
+		)
+		INSERT INTO recovery_codes (code_hash, user_id)
+		SELECT code_hash, id FROM enabled, unnest($2::text[]) AS code_hash`,
+		id, codeHashes,
+	)
+	return err
+}
+
+// UseRecoveryCode implements Store
+func (s *PostgresStore) UseRecoveryCode(ctx context.Context, id int64, codeHash string) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		id, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// UseTOTPStep implements Store. The step is compared and recorded in one
+// statement, so concurrent logins cannot both use a code.
+func (s *PostgresStore) UseTOTPStep(ctx context.Context, id int64, step int64) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET totp_last_step = $2
+		WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`,
+		id, step,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
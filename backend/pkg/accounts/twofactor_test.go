@@ -0,0 +1,170 @@
+package accounts
+
+import (
+	"context"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/pkg/secretbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCodesMatchRFC6238(t *testing.T) {
+	// The SHA-1 test vectors of RFC 6238, cut to 6 digits
+	secret := []byte("12345678901234567890")
+	for unix, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		assert.Equal(t, code, totpCode(secret, uint64(unix/30)), unix)
+	}
+}
+
+// enrolledAccount registers alice with two-factor authentication enabled
+// and returns her account, TOTP secret and recovery codes
+func enrolledAccount(t *testing.T, auth *Authenticator) (*Account, []byte, []string) {
+	t.Helper()
+	ctx := context.Background()
+	cipher, err := secretbox.NewCipher(strings.Repeat("k", secretbox.MinMasterKeyLength))
+	require.NoError(t, err)
+	auth.SetSecretCipher(cipher, "")
+
+	account, err := auth.Register(ctx, "alice@example.com", "", "correct horse")
+	require.NoError(t, err)
+	enrollment, err := auth.Enroll(ctx, account.ID, account.Email)
+	require.NoError(t, err)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	// Enrollment is confirmed a few steps back, so the current codes are
+	// unused
+	now := auth.now
+	confirmedAt := now().Add(-4 * totpPeriod)
+	auth.now = func() time.Time { return confirmedAt }
+	codes, err := auth.ConfirmEnrollment(ctx, account.ID, totpCode(secret, uint64(confirmedAt.Unix()/30)))
+	auth.now = now
+	require.NoError(t, err)
+	account, err = auth.Login(ctx, "alice@example.com", "correct horse")
+	require.NoError(t, err)
+	return account, secret, codes
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	_, err := auth.Enroll(ctx, 1, "alice@example.com")
+	assert.ErrorIs(t, err, ErrTwoFactorNotConfigured)
+
+	cipher, err := secretbox.NewCipher(strings.Repeat("k", secretbox.MinMasterKeyLength))
+	require.NoError(t, err)
+	auth.SetSecretCipher(cipher, "Citadel Test")
+	account, err := auth.Register(ctx, "alice@example.com", "", "correct horse")
+	require.NoError(t, err)
+
+	_, err = auth.ConfirmEnrollment(ctx, account.ID, "123456")
+	assert.ErrorIs(t, err, ErrNoEnrollment)
+
+	enrollment, err := auth.Enroll(ctx, account.ID, account.Email)
+	require.NoError(t, err)
+	otpauth, err := url.Parse(enrollment.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", otpauth.Scheme)
+	assert.Equal(t, "totp", otpauth.Host)
+	assert.Equal(t, "/Citadel Test:alice@example.com", otpauth.Path)
+	assert.Equal(t, enrollment.Secret, otpauth.Query().Get("secret"))
+	assert.Equal(t, "Citadel Test", otpauth.Query().Get("issuer"))
+
+	// The secret is only kept encrypted
+	stored, err := auth.store.TOTPSecret(ctx, account.ID)
+	require.NoError(t, err)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), string(secret))
+
+	// Logins need no code until the enrollment is confirmed
+	pending, err := auth.Login(ctx, "alice@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.False(t, pending.TwoFactorEnabled)
+
+	_, err = auth.ConfirmEnrollment(ctx, account.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	code := totpCode(secret, uint64(time.Now().Unix()/30))
+	codes, err := auth.ConfirmEnrollment(ctx, account.ID, code)
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`, codes[0], "recovery codes have 80 bits")
+
+	enabled, err := auth.Login(ctx, "alice@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.True(t, enabled.TwoFactorEnabled)
+	_, err = auth.VerifyTwoFactor(ctx, enabled, code)
+	assert.ErrorIs(t, err, ErrInvalidCode, "the code confirming the enrollment cannot log in")
+	_, err = auth.Enroll(ctx, account.ID, account.Email)
+	assert.ErrorIs(t, err, ErrTwoFactorEnabled)
+}
+
+func TestTwoFactorCodesAllowClockSkew(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	now := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return now }
+	account, secret, _ := enrolledAccount(t, auth)
+	step := uint64(now.Unix() / 30)
+
+	for _, counter := range []uint64{step - 1, step, step + 1} {
+		recovery, err := auth.VerifyTwoFactor(ctx, account, totpCode(secret, counter))
+		assert.NoError(t, err, counter)
+		assert.False(t, recovery)
+	}
+	for _, counter := range []uint64{step - 2, step + 2} {
+		_, err := auth.VerifyTwoFactor(ctx, account, totpCode(secret, counter))
+		assert.ErrorIs(t, err, ErrInvalidCode, counter)
+	}
+	_, err := auth.VerifyTwoFactor(ctx, account, "")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestTOTPCodesCannotBeReplayed(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	now := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return now }
+	account, secret, _ := enrolledAccount(t, auth)
+	step := uint64(now.Unix() / 30)
+
+	code := totpCode(secret, step)
+	_, err := auth.VerifyTwoFactor(ctx, account, code)
+	require.NoError(t, err)
+	_, err = auth.VerifyTwoFactor(ctx, account, code)
+	assert.ErrorIs(t, err, ErrInvalidCode, "the same code twice")
+
+	// Nor are the codes of earlier steps still within the skew
+	_, err = auth.VerifyTwoFactor(ctx, account, totpCode(secret, step-1))
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	_, err = auth.VerifyTwoFactor(ctx, account, totpCode(secret, step+1))
+	assert.NoError(t, err)
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthenticator()
+	account, _, codes := enrolledAccount(t, auth)
+
+	recovery, err := auth.VerifyTwoFactor(ctx, account, strings.ToUpper(codes[0]))
+	require.NoError(t, err, "recovery codes ignore case")
+	assert.True(t, recovery)
+	_, err = auth.VerifyTwoFactor(ctx, account, codes[0])
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	recovery, err = auth.VerifyTwoFactor(ctx, account, strings.ReplaceAll(codes[1], "-", ""))
+	require.NoError(t, err)
+	assert.True(t, recovery)
+	_, err = auth.VerifyTwoFactor(ctx, account, "aaaa-aaaa")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+}
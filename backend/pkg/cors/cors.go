@@ -0,0 +1,256 @@
+// Package cors implements the CORS policy shared by the Citadel API servers,
+// for net/http and Fiber alike
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Config defines the CORS policy. Its fields match config.CORSConfig, which
+// converts to it directly.
+type Config struct {
+	// AllowOrigins are exact origins ("https://app.example.com"), subdomain
+	// patterns ("https://*.example.com") or "*" for any origin
+	AllowOrigins []string
+	AllowMethods []string
+	AllowHeaders []string
+	// AllowCredentials lets allowed origins send cookies and Authorization
+	// headers. It cannot be combined with the "*" origin.
+	AllowCredentials bool
+	ExposeHeaders    []string
+	MaxAge           int // seconds preflight responses may be cached
+}
+
+// ErrWildcardCredentials is returned by Validate for configs allowing
+// credentials from any origin, which would let every site make
+// authenticated requests
+var ErrWildcardCredentials = errors.New(`CORS credentials cannot be allowed for the "*" origin`)
+
+// DefaultConfig allows the local development frontends, without credentials
+func DefaultConfig() Config {
+	return Config{
+		AllowOrigins: []string{
+			"http://localhost:3000",
+			"http://localhost:5173",
+			"http://localhost:8080",
+		},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		MaxAge:       3600,
+	}
+}
+
+// Validate reports configs New would not apply as written
+func (c Config) Validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	for _, origin := range c.AllowOrigins {
+		if strings.TrimSpace(origin) == "*" {
+			return ErrWildcardCredentials
+		}
+	}
+	return nil
+}
+
+// FromEnv overrides defaults with the CITADEL_SERVER_CORS_* environment
+// variables that also configure config.Server.CORS. Lists are
+// comma-separated.
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if v, ok := os.LookupEnv("CITADEL_SERVER_CORS_ALLOW_ORIGINS"); ok {
+		config.AllowOrigins = splitList(v)
+	}
+	if v, ok := os.LookupEnv("CITADEL_SERVER_CORS_ALLOW_METHODS"); ok {
+		config.AllowMethods = splitList(v)
+	}
+	if v, ok := os.LookupEnv("CITADEL_SERVER_CORS_ALLOW_HEADERS"); ok {
+		config.AllowHeaders = splitList(v)
+	}
+	if v, ok := os.LookupEnv("CITADEL_SERVER_CORS_EXPOSE_HEADERS"); ok {
+		config.ExposeHeaders = splitList(v)
+	}
+	if v, err := strconv.ParseBool(os.Getenv("CITADEL_SERVER_CORS_ALLOW_CREDENTIALS")); err == nil {
+		config.AllowCredentials = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CITADEL_SERVER_CORS_MAX_AGE")); err == nil {
+		config.MaxAge = v
+	}
+	return config
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// CORS applies a CORS policy to requests
+type CORS struct {
+	allowAll      bool
+	origins       map[string]bool
+	patterns      []string
+	methods       string
+	headers       string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// New creates a CORS policy. Methods and headers default to those of
+// DefaultConfig; without AllowOrigins no cross-origin request is allowed.
+// Credentials are never allowed together with the "*" origin, see Validate.
+func New(config Config) *CORS {
+	defaults := DefaultConfig()
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = defaults.AllowMethods
+	}
+	if len(config.AllowHeaders) == 0 {
+		config.AllowHeaders = defaults.AllowHeaders
+	}
+
+	c := &CORS{
+		origins:       make(map[string]bool),
+		methods:       strings.ToUpper(strings.Join(config.AllowMethods, ", ")),
+		headers:       strings.Join(config.AllowHeaders, ", "),
+		exposeHeaders: strings.Join(config.ExposeHeaders, ", "),
+		credentials:   config.AllowCredentials,
+	}
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(config.MaxAge)
+	}
+	for _, origin := range config.AllowOrigins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.Contains(origin, "*"):
+			c.patterns = append(c.patterns, origin)
+		case origin != "":
+			c.origins[origin] = true
+		}
+	}
+	if c.allowAll {
+		c.credentials = false
+	}
+	return c
+}
+
+// AllowOrigin reports whether origin may make cross-origin requests
+func (c *CORS) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if c.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if c.origins[origin] {
+		return true
+	}
+	for _, pattern := range c.patterns {
+		if matchPattern(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches origin against a pattern with a single "*" that
+// stands for one or more subdomain labels
+func matchPattern(pattern, origin string) bool {
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	for _, r := range origin[len(prefix) : len(origin)-len(suffix)] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// apply sets the CORS response headers for a request and reports whether it
+// is a preflight request, which the caller answers itself with status
+func (c *CORS) apply(set func(key, value string), method, origin, requestMethod string) (preflight bool, status int) {
+	set("Vary", "Origin")
+
+	preflight = method == http.MethodOptions && requestMethod != ""
+	if !c.AllowOrigin(origin) {
+		return preflight, http.StatusForbidden
+	}
+
+	// Any origin gets "*", which browsers never send credentials to.
+	// Listed origins are echoed, as browsers refuse "*" with credentials.
+	if c.allowAll {
+		set("Access-Control-Allow-Origin", "*")
+	} else {
+		set("Access-Control-Allow-Origin", origin)
+		if c.credentials {
+			set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if !preflight {
+		if c.exposeHeaders != "" {
+			set("Access-Control-Expose-Headers", c.exposeHeaders)
+		}
+		return false, 0
+	}
+
+	set("Access-Control-Allow-Methods", c.methods)
+	set("Access-Control-Allow-Headers", c.headers)
+	if c.maxAge != "" {
+		set("Access-Control-Max-Age", c.maxAge)
+	}
+	return true, http.StatusNoContent
+}
+
+// Handler wraps a net/http handler with the CORS policy. Preflight requests
+// are answered directly; other requests are passed on, with CORS headers
+// only when their origin is allowed.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		preflight, status := c.apply(func(key, value string) {
+			if key == "Vary" {
+				header.Add(key, value)
+			} else {
+				header.Set(key, value)
+			}
+		}, r.Method, r.Header.Get("Origin"), r.Header.Get("Access-Control-Request-Method"))
+		if preflight {
+			w.WriteHeader(status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Fiber returns a Fiber handler applying the CORS policy
+func (c *CORS) Fiber() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		preflight, status := c.apply(func(key, value string) {
+			if key == fiber.HeaderVary {
+				ctx.Vary(value)
+			} else {
+				ctx.Set(key, value)
+			}
+		}, ctx.Method(), ctx.Get(fiber.HeaderOrigin), ctx.Get(fiber.HeaderAccessControlRequestMethod))
+		if preflight {
+			return ctx.SendStatus(status)
+		}
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,122 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{
+	AllowOrigins:     []string{"https://app.example.com", "https://*.citadel.dev"},
+	AllowMethods:     []string{"GET", "POST"},
+	AllowHeaders:     []string{"Content-Type", "Authorization"},
+	AllowCredentials: true,
+	ExposeHeaders:    []string{"X-Request-ID"},
+	MaxAge:           600,
+}
+
+func serve(t *testing.T, method, origin, requestMethod string) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := New(testConfig).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(method, "/api/workflows", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if requestMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", requestMethod)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAllowedOriginIsEchoed(t *testing.T) {
+	for _, origin := range []string{"https://app.example.com", "https://staging.citadel.dev", "https://eu.api.citadel.dev"} {
+		rec := serve(t, "GET", origin, "")
+		assert.Equal(t, http.StatusOK, rec.Code, origin)
+		assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "X-Request-ID", rec.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+	}
+}
+
+func TestDisallowedOriginGetsNoCORSHeaders(t *testing.T) {
+	for _, origin := range []string{"https://evil.com", "https://citadel.dev", "http://staging.citadel.dev", "https://app.example.com.evil.com", "https://a/b.citadel.dev"} {
+		rec := serve(t, "GET", origin, "")
+		assert.Equal(t, http.StatusOK, rec.Code, origin)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"), origin)
+	}
+
+	rec := serve(t, "OPTIONS", "https://evil.com", "POST")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestPreflightIsAnsweredDirectly(t *testing.T) {
+	rec := serve(t, "OPTIONS", "https://app.example.com", "POST")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Expose-Headers"))
+
+	// A plain OPTIONS request is not a preflight and reaches the handler
+	rec = serve(t, "OPTIONS", "https://app.example.com", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestWildcardAllowsAnyOrigin(t *testing.T) {
+	c := New(Config{AllowOrigins: []string{"*"}})
+	assert.True(t, c.AllowOrigin("https://anything.example"))
+	assert.False(t, c.AllowOrigin(""))
+
+	assert.False(t, New(Config{}).AllowOrigin("http://localhost:3000"))
+}
+
+func TestWildcardNeverAllowsCredentials(t *testing.T) {
+	config := Config{AllowOrigins: []string{"*"}, AllowCredentials: true}
+	assert.ErrorIs(t, config.Validate(), ErrWildcardCredentials)
+	assert.NoError(t, testConfig.Validate())
+	assert.NoError(t, DefaultConfig().Validate())
+	assert.False(t, DefaultConfig().AllowCredentials)
+
+	// New still refuses credentials for configs that were not validated
+	handler := New(config).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/api/workflows", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestFiberHandlerMatchesHTTP(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(testConfig).Fiber())
+	app.Post("/api/workflows", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusCreated) })
+
+	req := httptest.NewRequest("OPTIONS", "/api/workflows", nil)
+	req.Header.Set("Origin", "https://dev.citadel.dev")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "https://dev.citadel.dev", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest("POST", "/api/workflows", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CITADEL_DATABASE_MAX_OPEN_CONNS", "50")
+	t.Setenv("CITADEL_DATABASE_QUERY_TIMEOUT", "2s")
+
+	config := FromEnv(DefaultConfig())
+	assert.Equal(t, 50, config.MaxOpenConns)
+	assert.Equal(t, 5, config.MaxIdleConns)
+	assert.Equal(t, 5*time.Minute, config.ConnMaxLifetime)
+	assert.Equal(t, 2*time.Second, config.QueryTimeout)
+}
+
+func TestNewPoolRejectsInvalidURL(t *testing.T) {
+	_, err := NewPool(context.Background(), Config{URL: "postgres://localhost:notaport/db"})
+	assert.Error(t, err)
+}
+
+// TestPoolAppliesSettings runs against the database in TEST_DATABASE_URL and
+// is skipped when unset
+func TestPoolAppliesSettings(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	pool, err := NewPool(ctx, Config{
+		URL:          databaseURL,
+		MaxOpenConns: 3,
+		MaxIdleConns: 1,
+		QueryTimeout: 200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer pool.Close()
+
+	assert.Equal(t, int32(3), pool.Config().MaxConns)
+	assert.Equal(t, int32(1), pool.Config().MinConns)
+	assert.NoError(t, pool.HealthCheck(ctx))
+
+	var one int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT 1").Scan(&one))
+	assert.Equal(t, 1, one)
+
+	_, err = pool.Exec(ctx, "SELECT pg_sleep(1)")
+	assert.Error(t, err, "queries are bounded by the query timeout")
+}
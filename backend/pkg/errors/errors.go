@@ -45,7 +45,6 @@ const (
 	NodeExecutionError      = "NODE_EXEC_ERROR"
 	WorkflowValidationError = "WORKFLOW_VALIDATION_ERROR"
 	ConnectionError         = "CONNECTION_ERROR"
-	TimeoutError            = "TIMEOUT_ERROR"
 )
 
 // Helper functions for common error types
@@ -64,7 +63,3 @@ func NewWorkflowValidationError(message string) *WorkflowError {
 func NewConnectionError(message string, cause error) *WorkflowError {
 	return WrapWorkflowError(ConnectionError, message, cause)
 }
-
-func NewTimeoutError(message string) *WorkflowError {
-	return NewWorkflowError(TimeoutError, message)
-}
\ No newline at end of file
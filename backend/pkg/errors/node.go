@@ -0,0 +1,201 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Codes of the node errors
+const (
+	CodeValidation = "VALIDATION_ERROR"
+	CodeTimeout    = "TIMEOUT_ERROR"
+	CodeNetwork    = "NETWORK_ERROR"
+	CodeAuth       = "AUTH_ERROR"
+	CodeResource   = "RESOURCE_ERROR"
+	CodeQuota      = "QUOTA_EXCEEDED"
+	CodeCircuit    = "CIRCUIT_OPEN"
+)
+
+// NodeError is a node execution error classified by a code, so that the
+// executor can tell what is worth retrying
+type NodeError interface {
+	error
+	Code() string
+	// Retryable reports whether running the node again may succeed
+	Retryable() bool
+}
+
+// nodeError holds the message and cause of the node errors
+type nodeError struct {
+	Message string
+	Cause   error
+}
+
+// Error returns the error message
+func (e *nodeError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *nodeError) Unwrap() error {
+	return e.Cause
+}
+
+// ValidationError is a node given configuration or inputs it cannot run
+// with. It is not retryable.
+type ValidationError struct{ nodeError }
+
+// Code returns CodeValidation
+func (e *ValidationError) Code() string { return CodeValidation }
+
+// Retryable is false
+func (e *ValidationError) Retryable() bool { return false }
+
+// TimeoutError is a node that ran out of time. It is retryable.
+type TimeoutError struct{ nodeError }
+
+// Code returns CodeTimeout
+func (e *TimeoutError) Code() string { return CodeTimeout }
+
+// Retryable is true
+func (e *TimeoutError) Retryable() bool { return true }
+
+// NetworkError is a node that could not reach a service. It is retryable.
+type NetworkError struct{ nodeError }
+
+// Code returns CodeNetwork
+func (e *NetworkError) Code() string { return CodeNetwork }
+
+// Retryable is true
+func (e *NetworkError) Retryable() bool { return true }
+
+// AuthError is a node refused by a service for its credentials. It is not
+// retryable.
+type AuthError struct{ nodeError }
+
+// Code returns CodeAuth
+func (e *AuthError) Code() string { return CodeAuth }
+
+// Retryable is false
+func (e *AuthError) Retryable() bool { return false }
+
+// ResourceError is a node that found a service overloaded, rate limited or
+// otherwise unavailable. It is retryable.
+type ResourceError struct{ nodeError }
+
+// Code returns CodeResource
+func (e *ResourceError) Code() string { return CodeResource }
+
+// Retryable is true
+func (e *ResourceError) Retryable() bool { return true }
+
+// QuotaExceededError is a node stopped because its user has used up an
+// allowance, such as their AI token budget. It is not retryable.
+type QuotaExceededError struct{ nodeError }
+
+// Code returns CodeQuota
+func (e *QuotaExceededError) Code() string { return CodeQuota }
+
+// Retryable is false
+func (e *QuotaExceededError) Retryable() bool { return false }
+
+// CircuitOpenError is a call to a service that was not made because too
+// many calls to it failed recently. It is not retryable: the circuit stays
+// open for longer than a retry would wait.
+type CircuitOpenError struct{ nodeError }
+
+// Code returns CodeCircuit
+func (e *CircuitOpenError) Code() string { return CodeCircuit }
+
+// Retryable is false
+func (e *CircuitOpenError) Retryable() bool { return false }
+
+// NewValidationError creates a validation error
+func NewValidationError(message string, cause error) *ValidationError {
+	return &ValidationError{nodeError{Message: message, Cause: cause}}
+}
+
+// NewTimeoutError creates a timeout error
+func NewTimeoutError(message string, cause error) *TimeoutError {
+	return &TimeoutError{nodeError{Message: message, Cause: cause}}
+}
+
+// NewNetworkError creates a network error
+func NewNetworkError(message string, cause error) *NetworkError {
+	return &NetworkError{nodeError{Message: message, Cause: cause}}
+}
+
+// NewAuthError creates an authentication error
+func NewAuthError(message string, cause error) *AuthError {
+	return &AuthError{nodeError{Message: message, Cause: cause}}
+}
+
+// NewResourceError creates a resource error
+func NewResourceError(message string, cause error) *ResourceError {
+	return &ResourceError{nodeError{Message: message, Cause: cause}}
+}
+
+// NewQuotaExceededError creates a quota exceeded error
+func NewQuotaExceededError(message string, cause error) *QuotaExceededError {
+	return &QuotaExceededError{nodeError{Message: message, Cause: cause}}
+}
+
+// NewCircuitOpenError creates a circuit open error
+func NewCircuitOpenError(message string, cause error) *CircuitOpenError {
+	return &CircuitOpenError{nodeError{Message: message, Cause: cause}}
+}
+
+// CodeOf returns the code of the first NodeError in err's chain, or "" when
+// there is none
+func CodeOf(err error) string {
+	var nodeErr NodeError
+	if stderrors.As(err, &nodeErr) {
+		return nodeErr.Code()
+	}
+	return ""
+}
+
+// IsRetryable reports whether err is a retryable NodeError
+func IsRetryable(err error) bool {
+	var nodeErr NodeError
+	return stderrors.As(err, &nodeErr) && nodeErr.Retryable()
+}
+
+// FromTransport classifies the error of a request to a service that got no
+// response: a timeout, a cancellation, which stays unclassified, or else a
+// network error
+func FromTransport(message string, err error) error {
+	var netErr net.Error
+	switch {
+	case stderrors.Is(err, context.DeadlineExceeded), stderrors.As(err, &netErr) && netErr.Timeout():
+		return NewTimeoutError(message, err)
+	case stderrors.Is(err, context.Canceled):
+		return fmt.Errorf("%s: %w", message, err)
+	default:
+		return NewNetworkError(message, err)
+	}
+}
+
+// FromHTTPStatus classifies a request that a service answered with an error
+// status. Server errors other than the ones listed stay unclassified, since
+// they may or may not be worth retrying.
+func FromHTTPStatus(status int, message string) error {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return NewAuthError(message, nil)
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return NewTimeoutError(message, nil)
+	case status == http.StatusTooManyRequests, status == http.StatusBadGateway, status == http.StatusServiceUnavailable:
+		return NewResourceError(message, nil)
+	case status >= 400 && status < 500:
+		return NewValidationError(message, nil)
+	default:
+		return stderrors.New(message)
+	}
+}
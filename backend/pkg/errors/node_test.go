@@ -0,0 +1,76 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeErrorCodes(t *testing.T) {
+	cause := stderrors.New("boom")
+
+	tests := []struct {
+		err       NodeError
+		code      string
+		retryable bool
+	}{
+		{NewValidationError("bad input", cause), CodeValidation, false},
+		{NewTimeoutError("too slow", cause), CodeTimeout, true},
+		{NewNetworkError("unreachable", cause), CodeNetwork, true},
+		{NewAuthError("bad key", cause), CodeAuth, false},
+		{NewResourceError("rate limited", cause), CodeResource, true},
+		{NewQuotaExceededError("over budget", cause), CodeQuota, false},
+		{NewCircuitOpenError("circuit open", cause), CodeCircuit, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			wrapped := fmt.Errorf("node n1: %w", tt.err)
+
+			assert.Equal(t, tt.code, CodeOf(wrapped))
+			assert.Equal(t, tt.retryable, IsRetryable(wrapped))
+			assert.ErrorIs(t, wrapped, cause)
+			assert.Contains(t, wrapped.Error(), "boom")
+		})
+	}
+}
+
+func TestCodeOfUnclassifiedError(t *testing.T) {
+	assert.Equal(t, "", CodeOf(stderrors.New("boom")))
+	assert.Equal(t, "", CodeOf(nil))
+	assert.False(t, IsRetryable(stderrors.New("boom")))
+}
+
+func TestFromTransport(t *testing.T) {
+	assert.Equal(t, CodeTimeout, CodeOf(FromTransport("request failed", context.DeadlineExceeded)))
+	assert.Equal(t, CodeNetwork, CodeOf(FromTransport("request failed", syscall.ECONNREFUSED)))
+
+	canceled := FromTransport("request failed", context.Canceled)
+	assert.Equal(t, "", CodeOf(canceled))
+	assert.ErrorIs(t, canceled, context.Canceled)
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	tests := map[int]string{
+		http.StatusBadRequest:          CodeValidation,
+		http.StatusNotFound:            CodeValidation,
+		http.StatusUnauthorized:        CodeAuth,
+		http.StatusForbidden:           CodeAuth,
+		http.StatusRequestTimeout:      CodeTimeout,
+		http.StatusGatewayTimeout:      CodeTimeout,
+		http.StatusTooManyRequests:     CodeResource,
+		http.StatusServiceUnavailable:  CodeResource,
+		http.StatusInternalServerError: "",
+	}
+
+	for status, code := range tests {
+		err := FromHTTPStatus(status, "request failed")
+		assert.Equal(t, code, CodeOf(err), "status %d", status)
+		assert.EqualError(t, err, "request failed")
+	}
+}
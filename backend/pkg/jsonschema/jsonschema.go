@@ -0,0 +1,236 @@
+// Package jsonschema validates data against the subset of JSON Schema node
+// types use to describe their inputs and outputs: type, properties,
+// required, additionalProperties, items, enum, minimum, maximum, minLength,
+// maxLength, minItems and maxItems.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema document, as it is served to the frontend
+type Schema = map[string]interface{}
+
+// Error is the first place a value does not match its schema. Path is a
+// JSONPath to the offending value, such as $.user.tags[2].
+type Error struct {
+	Path    string
+	Message string
+}
+
+// Error returns the path and what is wrong there
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Validate reports whether value matches schema. Values are compared as the
+// JSON they encode to, so Go types such as ints and string slices validate
+// like the numbers and arrays they become. A nil schema accepts anything.
+func Validate(schema Schema, value interface{}) error {
+	if schema == nil {
+		return nil
+	}
+
+	var normalizedSchema map[string]interface{}
+	if err := normalize(schema, &normalizedSchema); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	var normalized interface{}
+	if err := normalize(value, &normalized); err != nil {
+		return &Error{Path: "$", Message: fmt.Sprintf("value cannot be encoded as JSON: %v", err)}
+	}
+	return validate(normalizedSchema, normalized, "$")
+}
+
+// normalize converts v to the generic values encoding/json decodes into
+func normalize(v interface{}, into interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := typeOf(value)
+		matched := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return &Error{Path: path, Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), actual)}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &Error{Path: path, Message: fmt.Sprintf("must be one of %s, got %s", formatValues(enum), formatValue(value))}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schema, v, path)
+	case []interface{}:
+		return validateArray(schema, v, path)
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			return &Error{Path: path, Message: fmt.Sprintf("must be at least %v characters long", min)}
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			return &Error{Path: path, Message: fmt.Sprintf("must be at most %v characters long", max)}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return &Error{Path: path, Message: fmt.Sprintf("must be at least %v, got %v", min, v)}
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return &Error{Path: path, Message: fmt.Sprintf("must be at most %v, got %v", max, v)}
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string) error {
+	required, _ := schema["required"].([]interface{})
+	for _, name := range required {
+		if key, ok := name.(string); ok {
+			if _, present := value[key]; !present {
+				return &Error{Path: joinPath(path, key), Message: "is required"}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, restricted := schema["additionalProperties"].(bool)
+
+	// Keys are checked in order so that the same value always reports the
+	// same error
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		property, declared := properties[key].(map[string]interface{})
+		if !declared {
+			if restricted && !additional {
+				return &Error{Path: joinPath(path, key), Message: "is not allowed"}
+			}
+			continue
+		}
+		if err := validate(property, value[key], joinPath(path, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateArray(schema map[string]interface{}, value []interface{}, path string) error {
+	count := float64(len(value))
+	if min, ok := schema["minItems"].(float64); ok && count < min {
+		return &Error{Path: path, Message: fmt.Sprintf("must have at least %v items, got %d", min, len(value))}
+	}
+	if max, ok := schema["maxItems"].(float64); ok && count > max {
+		return &Error{Path: path, Message: fmt.Sprintf("must have at most %v items, got %d", max, len(value))}
+	}
+
+	items, ok := schema["items"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for i, item := range value {
+		if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaTypes returns the types a "type" keyword allows
+func schemaTypes(keyword interface{}) []string {
+	switch t := keyword.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// typeOf returns the JSON Schema type of a decoded JSON value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// joinPath appends an object key to path, quoting keys that are not plain
+// identifiers
+func joinPath(path, key string) string {
+	for _, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return fmt.Sprintf("%s[%q]", path, key)
+		}
+	}
+	if key == "" {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	return path + "." + key
+}
+
+func formatValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func formatValues(values []interface{}) string {
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		formatted[i] = formatValue(v)
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
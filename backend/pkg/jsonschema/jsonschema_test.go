@@ -0,0 +1,78 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var userSchema = Schema{
+	"type":     "object",
+	"required": []string{"name", "role"},
+	"properties": map[string]interface{}{
+		"name": map[string]interface{}{"type": "string", "minLength": 1},
+		"age":  map[string]interface{}{"type": "integer", "minimum": 0},
+		"role": map[string]interface{}{"type": "string", "enum": []string{"admin", "member"}},
+		"tags": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+		},
+		"address": map[string]interface{}{
+			"type":                 "object",
+			"required":             []string{"city"},
+			"additionalProperties": false,
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{"type": "string"},
+			},
+		},
+	},
+}
+
+func TestValidateAcceptsMatchingValues(t *testing.T) {
+	assert.NoError(t, Validate(userSchema, map[string]interface{}{
+		"name":    "Ada",
+		"age":     36,
+		"role":    "admin",
+		"tags":    []string{"a", "b"},
+		"address": map[string]interface{}{"city": "London"},
+		"extra":   true,
+	}))
+	assert.NoError(t, Validate(nil, "anything"))
+	assert.NoError(t, Validate(Schema{"type": "number"}, 1.5))
+	assert.NoError(t, Validate(Schema{"type": "number"}, 2))
+	assert.NoError(t, Validate(Schema{"type": []string{"string", "null"}}, nil))
+}
+
+func TestValidateReportsPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   map[string]interface{}
+		message string
+	}{
+		{"missing required", map[string]interface{}{"name": "Ada"}, "$.role: is required"},
+		{"type mismatch", map[string]interface{}{"name": "Ada", "role": "admin", "age": "36"}, "$.age: expected integer, got string"},
+		{"not an integer", map[string]interface{}{"name": "Ada", "role": "admin", "age": 36.5}, "$.age: expected integer, got number"},
+		{"enum", map[string]interface{}{"name": "Ada", "role": "owner"}, `$.role: must be one of ["admin", "member"], got "owner"`},
+		{"minimum", map[string]interface{}{"name": "Ada", "role": "admin", "age": -1}, "$.age: must be at least 0, got -1"},
+		{"minLength", map[string]interface{}{"name": "", "role": "admin"}, "$.name: must be at least 1 characters long"},
+		{"array item", map[string]interface{}{"name": "Ada", "role": "admin", "tags": []interface{}{"a", 2}}, "$.tags[1]: expected string, got integer"},
+		{"nested required", map[string]interface{}{"name": "Ada", "role": "admin", "address": map[string]interface{}{}}, "$.address.city: is required"},
+		{"additional property", map[string]interface{}{"name": "Ada", "role": "admin", "address": map[string]interface{}{"city": "x", "zip code": "1"}}, `$.address["zip code"]: is not allowed`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(userSchema, tt.value)
+			require.Error(t, err)
+			assert.EqualError(t, err, tt.message)
+
+			var schemaErr *Error
+			require.ErrorAs(t, err, &schemaErr)
+		})
+	}
+}
+
+func TestValidateRootType(t *testing.T) {
+	assert.EqualError(t, Validate(userSchema, []string{"a"}), "$: expected object, got array")
+}
@@ -0,0 +1,275 @@
+// Package lockout locks out the accounts and addresses behind repeated
+// failures, such as the failed logins of a brute-force attack
+package lockout
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Config defines when keys are locked out
+type Config struct {
+	// MaxAttempts failures of a key within Window lock it out; 0 disables
+	// lockouts
+	MaxAttempts int
+	Window      time.Duration
+	// Cooldown is how long a key stays locked out
+	Cooldown time.Duration
+}
+
+// DefaultConfig locks a key out for 15 minutes after 5 failures in 15
+// minutes
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts: 5,
+		Window:      15 * time.Minute,
+		Cooldown:    15 * time.Minute,
+	}
+}
+
+// FromEnv overrides defaults with the CITADEL_AUTH_LOCKOUT_* environment
+// variables. Durations use Go syntax, such as "15m".
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if v, err := strconv.Atoi(os.Getenv("CITADEL_AUTH_LOCKOUT_MAX_ATTEMPTS")); err == nil {
+		config.MaxAttempts = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CITADEL_AUTH_LOCKOUT_WINDOW")); err == nil {
+		config.Window = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CITADEL_AUTH_LOCKOUT_COOLDOWN")); err == nil {
+		config.Cooldown = v
+	}
+	return config
+}
+
+// Store counts the failures of keys and keeps their lockouts
+type Store interface {
+	// Fail counts a failure of key and returns its failures within window
+	// of the first one
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock locks key out for cooldown and clears its failures
+	Lock(ctx context.Context, key string, cooldown time.Duration) error
+	// Locked returns how long key stays locked out, 0 when it is not
+	Locked(ctx context.Context, key string) (time.Duration, error)
+	// Reset clears the failures of key
+	Reset(ctx context.Context, key string) error
+}
+
+// Guard locks keys out after Config.MaxAttempts failures. A nil Guard
+// never locks anything out.
+type Guard struct {
+	store  Store
+	config Config
+}
+
+// New creates a guard keeping its counters in store
+func New(store Store, config Config) *Guard {
+	return &Guard{store: store, config: config}
+}
+
+func (g *Guard) enabled() bool {
+	return g != nil && g.config.MaxAttempts > 0
+}
+
+// Check returns how long the longest locked out of keys stays locked out,
+// 0 when none is
+func (g *Guard) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	if !g.enabled() {
+		return 0, nil
+	}
+	var longest time.Duration
+	for _, key := range keys {
+		remaining, err := g.store.Locked(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+// Fail counts a failure of each of keys, locking out those that reach
+// MaxAttempts, and returns how long they are locked out as Check does
+func (g *Guard) Fail(ctx context.Context, keys ...string) (time.Duration, error) {
+	if !g.enabled() {
+		return 0, nil
+	}
+	for _, key := range keys {
+		failures, err := g.store.Fail(ctx, key, g.config.Window)
+		if err != nil {
+			return 0, err
+		}
+		if failures >= g.config.MaxAttempts {
+			if err := g.store.Lock(ctx, key, g.config.Cooldown); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return g.Check(ctx, keys...)
+}
+
+// Succeed clears the failures of keys
+func (g *Guard) Succeed(ctx context.Context, keys ...string) error {
+	if !g.enabled() {
+		return nil
+	}
+	for _, key := range keys {
+		if err := g.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryStore keeps counters in process memory. They are not shared
+// between instances; use RedisStore for that.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	failures    int
+	windowEnd   time.Time
+	lockedUntil time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+// Fail implements Store
+func (s *MemoryStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	// Entries past their window and lockout can go
+	for k, entry := range s.entries {
+		if !now.Before(entry.windowEnd) && !now.Before(entry.lockedUntil) {
+			delete(s.entries, k)
+		}
+	}
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	if !now.Before(entry.windowEnd) {
+		entry.failures = 0
+		entry.windowEnd = now.Add(window)
+	}
+	entry.failures++
+	return entry.failures, nil
+}
+
+// Lock implements Store
+func (s *MemoryStore) Lock(ctx context.Context, key string, cooldown time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &memoryEntry{lockedUntil: s.now().Add(cooldown)}
+	return nil
+}
+
+// Locked implements Store
+func (s *MemoryStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	if remaining := entry.lockedUntil.Sub(s.now()); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// Reset implements Store
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		entry.failures = 0
+		entry.windowEnd = time.Time{}
+	}
+	return nil
+}
+
+// RedisStore keeps counters in Redis so that failures count, and lockouts
+// apply, across instances. Counters and lockouts expire on their own.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Fail implements Store
+func (s *RedisStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	var failures *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.Incr(ctx, failuresKey(key))
+		// The window starts with the first failure
+		pipe.ExpireNX(ctx, failuresKey(key), window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(failures.Val()), nil
+}
+
+// Lock implements Store
+func (s *RedisStore) Lock(ctx context.Context, key string, cooldown time.Duration) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, lockedKey(key), 1, cooldown)
+		pipe.Del(ctx, failuresKey(key))
+		return nil
+	})
+	return err
+}
+
+// Locked implements Store
+func (s *RedisStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	remaining, err := s.client.PTTL(ctx, lockedKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Negative for keys that do not exist
+	if remaining < 0 {
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// Reset implements Store
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, failuresKey(key)).Err()
+}
+
+func failuresKey(key string) string {
+	return "lockout:failures:" + key
+}
+
+func lockedKey(key string) string {
+	return "lockout:locked:" + key
+}
@@ -0,0 +1,123 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore is a store with a clock the test can move forward
+type testStore struct {
+	store   Store
+	advance func(time.Duration)
+}
+
+func lockoutStores(t *testing.T) map[string]testStore {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	memory := NewMemoryStore()
+	now := time.Now()
+	memory.now = func() time.Time { return now }
+
+	return map[string]testStore{
+		"memory": {store: memory, advance: func(d time.Duration) { now = now.Add(d) }},
+		"redis":  {store: NewRedisStore(client), advance: server.FastForward},
+	}
+}
+
+func TestGuardLocksOutAtThreshold(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range lockoutStores(t) {
+		t.Run(name, func(t *testing.T) {
+			guard := New(s.store, Config{MaxAttempts: 3, Window: time.Minute, Cooldown: 10 * time.Minute})
+
+			for i := 0; i < 2; i++ {
+				locked, err := guard.Fail(ctx, "email:alice@example.com", "ip:10.0.0.1")
+				require.NoError(t, err)
+				assert.Zero(t, locked)
+			}
+			locked, err := guard.Fail(ctx, "email:alice@example.com", "ip:10.0.0.1")
+			require.NoError(t, err)
+			assert.Equal(t, 10*time.Minute, locked.Round(time.Minute))
+
+			locked, err = guard.Check(ctx, "email:alice@example.com", "ip:10.0.0.2")
+			require.NoError(t, err)
+			assert.Positive(t, locked, "any locked out key locks the request out")
+			locked, err = guard.Check(ctx, "email:bob@example.com", "ip:10.0.0.2")
+			require.NoError(t, err)
+			assert.Zero(t, locked)
+		})
+	}
+}
+
+func TestGuardCooldownAndWindowExpire(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range lockoutStores(t) {
+		t.Run(name, func(t *testing.T) {
+			guard := New(s.store, Config{MaxAttempts: 2, Window: time.Minute, Cooldown: 5 * time.Minute})
+
+			_, err := guard.Fail(ctx, "ip:10.0.0.1")
+			require.NoError(t, err)
+			locked, err := guard.Fail(ctx, "ip:10.0.0.1")
+			require.NoError(t, err)
+			require.Positive(t, locked)
+
+			s.advance(4 * time.Minute)
+			locked, err = guard.Check(ctx, "ip:10.0.0.1")
+			require.NoError(t, err)
+			assert.Equal(t, time.Minute, locked.Round(time.Minute))
+
+			s.advance(2 * time.Minute)
+			locked, err = guard.Check(ctx, "ip:10.0.0.1")
+			require.NoError(t, err)
+			assert.Zero(t, locked, "the cooldown is over")
+
+			// The lockout cleared the failures, and old ones fall out of the window
+			locked, err = guard.Fail(ctx, "ip:10.0.0.1")
+			require.NoError(t, err)
+			assert.Zero(t, locked)
+			s.advance(2 * time.Minute)
+			locked, err = guard.Fail(ctx, "ip:10.0.0.1")
+			require.NoError(t, err)
+			assert.Zero(t, locked)
+		})
+	}
+}
+
+func TestGuardSuccessResetsFailures(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range lockoutStores(t) {
+		t.Run(name, func(t *testing.T) {
+			guard := New(s.store, Config{MaxAttempts: 2, Window: time.Minute, Cooldown: time.Minute})
+
+			_, err := guard.Fail(ctx, "email:alice@example.com")
+			require.NoError(t, err)
+			require.NoError(t, guard.Succeed(ctx, "email:alice@example.com"))
+			locked, err := guard.Fail(ctx, "email:alice@example.com")
+			require.NoError(t, err)
+			assert.Zero(t, locked)
+		})
+	}
+}
+
+func TestDisabledGuard(t *testing.T) {
+	ctx := context.Background()
+	guard := New(NewMemoryStore(), Config{MaxAttempts: 0})
+	for i := 0; i < 10; i++ {
+		locked, err := guard.Fail(ctx, "ip:10.0.0.1")
+		require.NoError(t, err)
+		assert.Zero(t, locked)
+	}
+
+	var none *Guard
+	locked, err := none.Fail(ctx, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Zero(t, locked)
+}
@@ -0,0 +1,142 @@
+// Package mailer sends email through an SMTP server. The send_email node
+// and the password reset emails of the lite server share it.
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrNotConfigured is returned by Send without an SMTP host
+var ErrNotConfigured = errors.New("SMTP host is not configured")
+
+// Config of an SMTP server
+type Config struct {
+	Host string
+	Port int
+	// Username and Password log in with PLAIN auth when Username is set
+	Username string
+	Password string
+	From     string
+	// UseTLS connects with TLS from the start, as on port 465. Otherwise
+	// the connection is upgraded with STARTTLS when the server offers it.
+	UseTLS bool
+}
+
+// DefaultConfig sends from a no-reply address on the submission port
+func DefaultConfig() Config {
+	return Config{Port: 587, From: "no-reply@citadel-agent.local"}
+}
+
+// FromEnv overrides defaults with the SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD, SMTP_FROM and SMTP_USE_TLS environment variables
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if v := os.Getenv("SMTP_HOST"); v != "" {
+		config.Host = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil {
+		config.Port = v
+	}
+	if v := os.Getenv("SMTP_USERNAME"); v != "" {
+		config.Username = v
+	}
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		config.Password = v
+	}
+	if v := os.Getenv("SMTP_FROM"); v != "" {
+		config.From = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("SMTP_USE_TLS")); err == nil {
+		config.UseTLS = v
+	}
+	return config
+}
+
+// Message is a plain text email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Send delivers msg through the SMTP server of c
+func (c Config) Send(ctx context.Context, msg Message) error {
+	if c.Host == "" {
+		return ErrNotConfigured
+	}
+	if len(msg.To) == 0 {
+		return errors.New("no recipients")
+	}
+	// Line breaks would let values add headers of their own
+	for _, value := range append([]string{c.From, msg.Subject}, msg.To...) {
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.New("header values cannot contain line breaks")
+		}
+	}
+
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	var conn net.Conn
+	var err error
+	if c.UseTLS {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: c.Host}}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && !c.UseTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+			return err
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("From: %s\r\n", c.From)
+	message += fmt.Sprintf("To: %s\r\n", strings.Join(msg.To, ", "))
+	message += fmt.Sprintf("Subject: %s\r\n", msg.Subject)
+	message += "\r\n" + msg.Body
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTP accepts one message and sends its envelope and data on the
+// returned channel
+func fakeSMTP(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		var transcript strings.Builder
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				text.PrintfLine("250 fake")
+			case strings.HasPrefix(command, "MAIL"), strings.HasPrefix(command, "RCPT"):
+				transcript.WriteString(line + "\n")
+				text.PrintfLine("250 OK")
+			case command == "DATA":
+				text.PrintfLine("354 Go ahead")
+				data, _ := text.ReadDotBytes()
+				transcript.Write(data)
+				text.PrintfLine("250 Queued")
+			case command == "QUIT":
+				text.PrintfLine("221 Bye")
+				received <- transcript.String()
+				return
+			default:
+				text.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, received
+}
+
+func TestSendDeliversMessage(t *testing.T) {
+	host, port, received := fakeSMTP(t)
+	config := Config{Host: host, Port: port, From: "citadel@example.com"}
+
+	err := config.Send(context.Background(), Message{
+		To:      []string{"alice@example.com", "bob@example.com"},
+		Subject: "Hello",
+		Body:    "First line\r\nSecond line\r\n",
+	})
+	require.NoError(t, err)
+
+	transcript := <-received
+	assert.Contains(t, transcript, "MAIL FROM:<citadel@example.com>")
+	assert.Contains(t, transcript, "RCPT TO:<alice@example.com>")
+	assert.Contains(t, transcript, "RCPT TO:<bob@example.com>")
+	assert.Contains(t, transcript, "To: alice@example.com, bob@example.com\n")
+	assert.Contains(t, transcript, "Subject: Hello\n\nFirst line\nSecond line\n")
+}
+
+func TestSendRefusesBadMessages(t *testing.T) {
+	ctx := context.Background()
+	msg := Message{To: []string{"alice@example.com"}, Subject: "Hello"}
+
+	assert.ErrorIs(t, DefaultConfig().Send(ctx, msg), ErrNotConfigured)
+
+	config := Config{Host: "127.0.0.1", Port: 1, From: "citadel@example.com"}
+	assert.Error(t, config.Send(ctx, Message{Subject: "Nobody"}))
+	injected := msg
+	injected.Subject = "Hello\r\nBcc: mallory@example.com"
+	assert.EqualError(t, config.Send(ctx, injected), "header values cannot contain line breaks")
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "465")
+	t.Setenv("SMTP_USE_TLS", "true")
+
+	config := FromEnv(DefaultConfig())
+	assert.Equal(t, Config{Host: "smtp.example.com", Port: 465, From: "no-reply@citadel-agent.local", UseTLS: true}, config)
+}
@@ -0,0 +1,184 @@
+// Package metrics exports Prometheus metrics for workflow executions,
+// authentication and circuit breakers, shared by the Citadel API servers
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config decides whether metrics are recorded and where they are served.
+// Its fields match those of config.MonitoringConfig.
+type Config struct {
+	CollectMetrics  bool
+	ExportMetrics   bool   // serve metrics on MetricsEndpoint
+	MetricsEndpoint string // e.g. "/metrics"
+}
+
+// DefaultConfig collects metrics and serves them on /metrics
+func DefaultConfig() Config {
+	return Config{
+		CollectMetrics:  true,
+		ExportMetrics:   true,
+		MetricsEndpoint: "/metrics",
+	}
+}
+
+// FromEnv overrides defaults with the CITADEL_MONITORING_* environment
+// variables that also configure config.Monitoring
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if v, err := strconv.ParseBool(os.Getenv("CITADEL_MONITORING_COLLECT_METRICS")); err == nil {
+		config.CollectMetrics = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("CITADEL_MONITORING_EXPORT_METRICS")); err == nil {
+		config.ExportMetrics = v
+	}
+	if v := os.Getenv("CITADEL_MONITORING_METRICS_ENDPOINT"); v != "" {
+		config.MetricsEndpoint = v
+	}
+	return config
+}
+
+// Outcomes used as the status or result label
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// Metrics holds the Prometheus metrics of a server in their own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	workflowExecutions *prometheus.CounterVec
+	workflowDuration   *prometheus.HistogramVec
+	activeExecutions   prometheus.Gauge
+	nodeExecutions     *prometheus.CounterVec
+	nodeDuration       *prometheus.HistogramVec
+	nodeErrors         *prometheus.CounterVec
+	authAttempts       *prometheus.CounterVec
+	circuitState       *prometheus.GaugeVec
+	circuitChanges     *prometheus.CounterVec
+}
+
+// New creates the metrics, along with the standard Go runtime and process
+// collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		workflowExecutions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "citadel_workflow_executions_total",
+			Help: "Workflow executions by outcome.",
+		}, []string{"status"}),
+		workflowDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "citadel_workflow_execution_duration_seconds",
+			Help:    "Duration of workflow executions.",
+			Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+		}, []string{"status"}),
+		activeExecutions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "citadel_workflow_active_executions",
+			Help: "Workflow executions currently running.",
+		}),
+		nodeExecutions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "citadel_node_executions_total",
+			Help: "Node executions by node type and outcome.",
+		}, []string{"node_type", "status"}),
+		nodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "citadel_node_execution_duration_seconds",
+			Help:    "Duration of node executions, including retries.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"node_type"}),
+		nodeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "citadel_node_errors_total",
+			Help: "Failed node executions by kind of error.",
+		}, []string{"error_type"}),
+		authAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "citadel_auth_attempts_total",
+			Help: "Authentication attempts by method (jwt, local, github, google, ...) and result.",
+		}, []string{"method", "result"}),
+		circuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "citadel_circuit_breaker_state",
+			Help: "State of the circuit breaker of each external endpoint: 0 closed, 1 open, 2 half-open.",
+		}, []string{"endpoint"}),
+		circuitChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "citadel_circuit_breaker_transitions_total",
+			Help: "Circuit breaker state changes by endpoint and new state.",
+		}, []string{"endpoint", "state"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.workflowExecutions,
+		m.workflowDuration,
+		m.activeExecutions,
+		m.nodeExecutions,
+		m.nodeDuration,
+		m.nodeErrors,
+		m.authAttempts,
+		m.circuitState,
+		m.circuitChanges,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RecordExecutionStart counts a workflow execution as active
+func (m *Metrics) RecordExecutionStart(workflowID, executionID string) {
+	m.activeExecutions.Inc()
+}
+
+// RecordExecutionEnd records a finished workflow execution; duration is in
+// seconds
+func (m *Metrics) RecordExecutionEnd(workflowID, executionID string, success bool, duration float64) {
+	m.activeExecutions.Dec()
+	status := outcome(success)
+	m.workflowExecutions.WithLabelValues(status).Inc()
+	m.workflowDuration.WithLabelValues(status).Observe(duration)
+}
+
+// RecordNodeExecution records a node execution; duration is in seconds
+func (m *Metrics) RecordNodeExecution(nodeType, executionID string, success bool, duration float64) {
+	m.nodeExecutions.WithLabelValues(nodeType, outcome(success)).Inc()
+	m.nodeDuration.WithLabelValues(nodeType).Observe(duration)
+}
+
+// RecordError counts a node failure by error type, such as "timeout"
+func (m *Metrics) RecordError(workflowID, executionID, nodeID, errorType string) {
+	m.nodeErrors.WithLabelValues(errorType).Inc()
+}
+
+// RecordAuth counts an authentication attempt
+func (m *Metrics) RecordAuth(method string, success bool) {
+	m.authAttempts.WithLabelValues(method, outcome(success)).Inc()
+}
+
+// circuitStates are the values of the circuit breaker state gauge
+var circuitStates = map[string]float64{
+	"closed":    0,
+	"open":      1,
+	"half-open": 2,
+}
+
+// RecordCircuitBreakerState records that the circuit breaker of endpoint
+// changed to state: "closed", "open" or "half-open"
+func (m *Metrics) RecordCircuitBreakerState(endpoint, state string) {
+	m.circuitState.WithLabelValues(endpoint).Set(circuitStates[state])
+	m.circuitChanges.WithLabelValues(endpoint, state).Inc()
+}
+
+func outcome(success bool) string {
+	if success {
+		return StatusSuccess
+	}
+	return StatusFailure
+}
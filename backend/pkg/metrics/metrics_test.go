@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsAreExported(t *testing.T) {
+	m := New()
+	m.RecordExecutionStart("wf", "exec_1")
+	m.RecordNodeExecution("http_request", "exec_1", true, 0.2)
+	m.RecordNodeExecution("http_request", "exec_1", false, 1.5)
+	m.RecordError("wf", "exec_1", "fetch", "timeout")
+	m.RecordExecutionEnd("wf", "exec_1", false, 1.7)
+	m.RecordExecutionStart("wf", "exec_2")
+	m.RecordAuth("github", true)
+	m.RecordAuth("jwt", false)
+	m.RecordCircuitBreakerState("api.example.com", "open")
+	m.RecordCircuitBreakerState("api.example.com", "half-open")
+
+	body := scrape(t, m)
+	for _, line := range []string{
+		`citadel_workflow_executions_total{status="failure"} 1`,
+		`citadel_workflow_execution_duration_seconds_count{status="failure"} 1`,
+		`citadel_workflow_active_executions 1`,
+		`citadel_node_executions_total{node_type="http_request",status="success"} 1`,
+		`citadel_node_executions_total{node_type="http_request",status="failure"} 1`,
+		`citadel_node_errors_total{error_type="timeout"} 1`,
+		`citadel_auth_attempts_total{method="github",result="success"} 1`,
+		`citadel_auth_attempts_total{method="jwt",result="failure"} 1`,
+		`citadel_circuit_breaker_state{endpoint="api.example.com"} 2`,
+		`citadel_circuit_breaker_transitions_total{endpoint="api.example.com",state="open"} 1`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, line)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CITADEL_MONITORING_EXPORT_METRICS", "false")
+	t.Setenv("CITADEL_MONITORING_METRICS_ENDPOINT", "/internal/metrics")
+
+	config := FromEnv(DefaultConfig())
+	assert.True(t, config.CollectMetrics)
+	assert.False(t, config.ExportMetrics)
+	assert.Equal(t, "/internal/metrics", config.MetricsEndpoint)
+}
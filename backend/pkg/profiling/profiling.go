@@ -0,0 +1,101 @@
+// Package profiling serves the net/http/pprof profiles of the Citadel API
+// servers, to diagnose the goroutine and memory behavior of long-running
+// workflows without a rebuild.
+//
+// Profiling is off by default and stays off in production unless explicitly
+// allowed. Having it enabled costs nothing until a profile is requested:
+//   - heap, allocs and goroutine profiles take a snapshot per request; a
+//     goroutine dump briefly stops the world, longer with more goroutines
+//   - CPU profiles (?seconds=, 30 by default) and execution traces
+//     (?seconds=, 1 by default) slow the process by a few percent while they
+//     run, and traces can be large
+//   - block and mutex profiles stay empty, since enabling them with
+//     runtime.SetBlockProfileRate or runtime.SetMutexProfileFraction adds
+//     overhead to every contended operation; this package leaves them alone
+//
+// Profiles expose internals such as the command line, so servers keep them
+// behind authentication. Importing net/http/pprof also registers its
+// handlers on http.DefaultServeMux, which servers must therefore not serve.
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config decides whether profiles are served and where. Its fields match
+// those of config.MonitoringConfig.
+type Config struct {
+	Enabled  bool
+	Endpoint string // e.g. "/debug/pprof"
+	// AllowInProduction serves profiles even in production
+	AllowInProduction bool
+}
+
+// DefaultConfig disables profiling, with profiles under /debug/pprof when
+// enabled
+func DefaultConfig() Config {
+	return Config{Endpoint: "/debug/pprof"}
+}
+
+// FromEnv overrides defaults with the CITADEL_MONITORING_* environment
+// variables that also configure config.Monitoring
+func FromEnv(defaults Config) Config {
+	config := defaults
+	if v, err := strconv.ParseBool(os.Getenv("CITADEL_MONITORING_PROFILING_ENABLED")); err == nil {
+		config.Enabled = v
+	}
+	if v := os.Getenv("CITADEL_MONITORING_PROFILING_ENDPOINT"); v != "" {
+		config.Endpoint = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("CITADEL_MONITORING_ALLOW_PROFILING_IN_PRODUCTION")); err == nil {
+		config.AllowInProduction = v
+	}
+	return config
+}
+
+// Active reports whether profiles should be served in environment, such as
+// "development" or "production"
+func (c Config) Active(environment string) bool {
+	if !c.Enabled || c.Endpoint == "" {
+		return false
+	}
+	return !strings.EqualFold(environment, "production") || c.AllowInProduction
+}
+
+// Handler serves the pprof index on endpoint and each profile below it, e.g.
+// endpoint+"/heap". Mount it on endpoint and every path under it.
+func Handler(endpoint string) http.Handler {
+	root := strings.TrimRight(endpoint, "/")
+	prefix := root + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == root {
+			// The index links to profiles relative to the trailing slash
+			http.Redirect(w, r, prefix, http.StatusMovedPermanently)
+			return
+		}
+		name, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch name {
+		case "":
+			pprof.Index(w, r)
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Handler(name).ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveNeverInProductionUnlessAllowed(t *testing.T) {
+	config := Config{Enabled: true, Endpoint: "/debug/pprof"}
+	assert.True(t, config.Active("development"))
+	assert.False(t, config.Active("production"))
+	assert.False(t, config.Active("Production"))
+
+	config.AllowInProduction = true
+	assert.True(t, config.Active("production"))
+
+	assert.False(t, DefaultConfig().Active("development"), "profiling is off by default")
+}
+
+func TestHandlerServesProfilesUnderEndpoint(t *testing.T) {
+	handler := Handler("/internal/pprof/")
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	rec := get("/internal/pprof/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine")
+
+	rec = get("/internal/pprof/goroutine?debug=1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine profile:")
+
+	rec = get("/internal/pprof")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/internal/pprof/", rec.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, get("/internal/pprof/unknown").Code)
+	assert.Equal(t, http.StatusNotFound, get("/debug/pprof/heap").Code)
+}
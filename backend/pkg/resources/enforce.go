@@ -0,0 +1,41 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrMemoryExceeded is wrapped by the violations of tasks killed for using
+// more memory than their limit
+var ErrMemoryExceeded = errors.New("memory limit exceeded")
+
+// Violation reports a task that was killed for exceeding its memory limit
+type Violation struct {
+	// Limit and Used are in bytes
+	Limit int64
+	Used  int64
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%v: task used %s, over its limit of %s", ErrMemoryExceeded, FormatMemory(v.Used), FormatMemory(v.Limit))
+}
+
+// Unwrap returns ErrMemoryExceeded
+func (v *Violation) Unwrap() error {
+	return ErrMemoryExceeded
+}
+
+// FormatMemory formats a memory size in bytes with the largest unit of
+// ParseMemory it is a whole or decimal multiple of, e.g. "256MB"
+func FormatMemory(bytes int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if bytes >= unit.size {
+			return strconv.FormatFloat(float64(bytes)/float64(unit.size), 'f', -1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10) + "B"
+}
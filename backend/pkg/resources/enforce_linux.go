@@ -0,0 +1,113 @@
+package resources
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// enforceInterval is how often Enforce samples the usage of a task
+const enforceInterval = 100 * time.Millisecond
+
+// clockTicks is the rate of the CPU times in /proc/<pid>/stat, USER_HZ,
+// which is 100 on every Linux architecture Go supports
+const clockTicks = 100
+
+// Enforce keeps the process group pgid within limits until ctx is done or
+// the group has exited. It throttles the group to limits.CPU by stopping it
+// whenever it got ahead of its share, and kills it once its resident memory
+// exceeds limits.Memory, returning a *Violation. Usage is sampled from
+// /proc, so short spikes between samples go unnoticed.
+func Enforce(ctx context.Context, pgid int, limits Limits) error {
+	if limits.Memory <= 0 && limits.CPU <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(enforceInterval)
+	defer ticker.Stop()
+
+	lastAt := time.Now()
+	var lastCPU int64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		rss, cpu, alive := groupUsage(pgid)
+		if !alive {
+			return nil
+		}
+		if limits.Memory > 0 && rss > limits.Memory {
+			syscall.Kill(-pgid, syscall.SIGKILL)
+			return &Violation{Limit: limits.Memory, Used: rss}
+		}
+
+		if limits.CPU > 0 {
+			used := time.Duration(cpu-lastCPU) * time.Second / clockTicks
+			ahead := time.Duration(float64(used)/limits.CPU) - time.Since(lastAt)
+			if ahead > 0 {
+				throttle(ctx, pgid, ahead)
+			}
+			lastAt, lastCPU = time.Now(), cpu
+		}
+	}
+}
+
+// throttle stops the process group pgid for d, or until ctx is done
+func throttle(ctx context.Context, pgid int, d time.Duration) {
+	if err := syscall.Kill(-pgid, syscall.SIGSTOP); err != nil {
+		return
+	}
+	defer syscall.Kill(-pgid, syscall.SIGCONT)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// groupUsage sums the resident memory in bytes and the CPU time in clock
+// ticks of the processes in group pgid. alive is false once none is left.
+func groupUsage(pgid int) (rss, cpu int64, alive bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, 0, false
+	}
+	pageSize := int64(os.Getpagesize())
+	group := strconv.Itoa(pgid)
+
+	for _, entry := range entries {
+		if entry.Name()[0] < '0' || entry.Name()[0] > '9' {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// The fields after the parenthesized command name, starting with
+		// the state; see proc(5)
+		end := strings.LastIndexByte(string(stat), ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[end+1:]))
+		if len(fields) < 22 || fields[2] != group || fields[0] == "Z" {
+			continue
+		}
+
+		alive = true
+		utime, _ := strconv.ParseInt(fields[11], 10, 64)
+		stime, _ := strconv.ParseInt(fields[12], 10, 64)
+		pages, _ := strconv.ParseInt(fields[21], 10, 64)
+		cpu += utime + stime
+		rss += pages * pageSize
+	}
+	return rss, cpu, alive
+}
@@ -0,0 +1,71 @@
+package resources
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startGroup starts a shell script in a process group of its own
+func startGroup(t *testing.T, script string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+	})
+	return cmd
+}
+
+func TestEnforceKillsTasksOverTheMemoryLimit(t *testing.T) {
+	// tail buffers its input until a newline, which /dev/zero never sends
+	cmd := startGroup(t, "tail /dev/zero")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := Enforce(ctx, cmd.Process.Pid, Limits{Memory: 32 << 20})
+
+	var violation *Violation
+	require.ErrorAs(t, err, &violation)
+	assert.ErrorIs(t, err, ErrMemoryExceeded)
+	assert.Equal(t, int64(32<<20), violation.Limit)
+	assert.Greater(t, violation.Used, violation.Limit)
+
+	state, _ := cmd.Process.Wait()
+	status := state.Sys().(syscall.WaitStatus)
+	assert.Equal(t, syscall.SIGKILL, status.Signal())
+}
+
+func TestEnforceThrottlesCPU(t *testing.T) {
+	cmd := startGroup(t, "while :; do :; done")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, Enforce(ctx, cmd.Process.Pid, Limits{CPU: 0.2}))
+
+	// A busy loop left alone would use the whole second
+	_, cpu, alive := groupUsage(cmd.Process.Pid)
+	require.True(t, alive)
+	assert.Less(t, time.Duration(cpu)*time.Second/clockTicks, 500*time.Millisecond)
+}
+
+func TestEnforceReturnsWhenTheGroupExits(t *testing.T) {
+	cmd := startGroup(t, "exit 0")
+	cmd.Wait()
+
+	done := make(chan error, 1)
+	go func() { done <- Enforce(context.Background(), cmd.Process.Pid, Limits{Memory: 1 << 30}) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Enforce did not return after the group exited")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package resources
+
+import "context"
+
+// Enforce does not limit tasks without /proc; limits are then only enforced
+// by container runtimes
+func Enforce(ctx context.Context, pgid int, limits Limits) error {
+	return nil
+}
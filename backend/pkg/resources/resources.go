@@ -0,0 +1,91 @@
+// Package resources parses the human-readable resource limits of the
+// application config, such as worker.resource_limits.max_memory_per_task
+// ("256MB") and max_cpu_per_task ("50%")
+package resources
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Limits bounds the resources of a task. Zero values are unlimited.
+type Limits struct {
+	// Memory is in bytes
+	Memory int64
+	// CPU is in cores, 0.5 being half of one
+	CPU float64
+}
+
+// memoryUnits are the suffixes ParseMemory accepts. Like Docker, decimal
+// and binary suffixes both count in powers of 1024.
+var memoryUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"tb", 1 << 40},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseMemory parses a memory size such as "256MB", "1.5G" or "1048576"
+// (bytes). The empty string is 0, no limit.
+func ParseMemory(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	if value == "" {
+		return 0, nil
+	}
+
+	size := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			size = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q", s)
+	}
+	return int64(n * float64(size)), nil
+}
+
+// ParseCPU parses a CPU share, either a percentage of one core ("50%") or
+// a number of cores ("1.5"). The empty string is 0, no limit.
+func ParseCPU(s string) (float64, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return 0, nil
+	}
+
+	scale := 1.0
+	if strings.HasSuffix(value, "%") {
+		value = strings.TrimSpace(strings.TrimSuffix(value, "%"))
+		scale = 0.01
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid CPU share %q", s)
+	}
+	return n * scale, nil
+}
+
+// FromEnv parses the per-task limits of worker.resource_limits from
+// CITADEL_WORKER_RESOURCE_LIMITS_MAX_MEMORY_PER_TASK and
+// CITADEL_WORKER_RESOURCE_LIMITS_MAX_CPU_PER_TASK
+func FromEnv() (Limits, error) {
+	memory, err := ParseMemory(os.Getenv("CITADEL_WORKER_RESOURCE_LIMITS_MAX_MEMORY_PER_TASK"))
+	if err != nil {
+		return Limits{}, fmt.Errorf("CITADEL_WORKER_RESOURCE_LIMITS_MAX_MEMORY_PER_TASK: %w", err)
+	}
+	cpu, err := ParseCPU(os.Getenv("CITADEL_WORKER_RESOURCE_LIMITS_MAX_CPU_PER_TASK"))
+	if err != nil {
+		return Limits{}, fmt.Errorf("CITADEL_WORKER_RESOURCE_LIMITS_MAX_CPU_PER_TASK: %w", err)
+	}
+	return Limits{Memory: memory, CPU: cpu}, nil
+}
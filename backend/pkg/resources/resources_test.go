@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMemory(t *testing.T) {
+	for input, want := range map[string]int64{
+		"":        0,
+		"1048576": 1 << 20,
+		"256MB":   256 << 20,
+		"256mb":   256 << 20,
+		"1.5G":    3 << 29,
+		"2 GiB":   2 << 30,
+		"512k":    512 << 10,
+	} {
+		got, err := ParseMemory(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"MB", "-1GB", "0", "lots", "12XB"} {
+		_, err := ParseMemory(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseCPU(t *testing.T) {
+	for input, want := range map[string]float64{
+		"":     0,
+		"50%":  0.5,
+		"200%": 2,
+		"1.5":  1.5,
+	} {
+		got, err := ParseCPU(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"%", "-50%", "0", "half"} {
+		_, err := ParseCPU(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	for bytes, want := range map[int64]string{
+		512:       "512B",
+		256 << 20: "256MB",
+		3 << 29:   "1.5GB",
+		2 << 40:   "2TB",
+	} {
+		assert.Equal(t, want, FormatMemory(bytes), bytes)
+		parsed, err := ParseMemory(want)
+		assert.NoError(t, err)
+		assert.Equal(t, bytes, parsed)
+	}
+}
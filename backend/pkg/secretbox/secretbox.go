@@ -0,0 +1,58 @@
+// Package secretbox encrypts secrets at rest, such as credentials and
+// two-factor authentication secrets, under a key derived from a master key
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// MinMasterKeyLength is the shortest master key accepted
+const MinMasterKeyLength = 32
+
+// Cipher encrypts secrets with AES-256-GCM under a key derived from the
+// master key
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a cipher from a master key of at least
+// MinMasterKeyLength characters
+func NewCipher(masterKey string) (*Cipher, error) {
+	if len(masterKey) < MinMasterKeyLength {
+		return nil, fmt.Errorf("master key must be at least %d characters", MinMasterKeyLength)
+	}
+	key := sha256.Sum256([]byte(masterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt returns the nonce followed by the sealed plaintext
+func (c *Cipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt opens what Encrypt returned. It fails for data encrypted with
+// another master key.
+func (c *Cipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, errors.New("ciphertext too short")
+	}
+	return c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+}
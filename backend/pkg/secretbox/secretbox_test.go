@@ -0,0 +1,31 @@
+package secretbox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipherRoundTrip(t *testing.T) {
+	cipher, err := NewCipher(strings.Repeat("k", MinMasterKeyLength))
+	require.NoError(t, err)
+
+	sealed, err := cipher.Encrypt([]byte("secret"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+	opened, err := cipher.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(opened))
+
+	other, err := NewCipher(strings.Repeat("x", MinMasterKeyLength))
+	require.NoError(t, err)
+	_, err = other.Decrypt(sealed)
+	assert.Error(t, err, "another master key cannot decrypt")
+	_, err = cipher.Decrypt([]byte("short"))
+	assert.Error(t, err)
+
+	_, err = NewCipher("short")
+	assert.Error(t, err)
+}
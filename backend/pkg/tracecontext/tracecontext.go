@@ -0,0 +1,87 @@
+// Package tracecontext carries the span of a trace through contexts and
+// across services in the W3C Trace Context traceparent header.
+package tracecontext
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Header is the HTTP header carrying the span of the caller
+const Header = "traceparent"
+
+// SpanContext identifies a span of a trace. The zero value identifies none.
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// IsValid reports whether sc identifies a span
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+type contextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or the zero SpanContext
+func SpanFromContext(ctx context.Context) SpanContext {
+	span, _ := ctx.Value(contextKey{}).(SpanContext)
+	return span
+}
+
+// Format returns the traceparent header value of span, flagged as sampled
+func Format(span SpanContext) string {
+	return "00-" + span.TraceID + "-" + span.SpanID + "-01"
+}
+
+// Parse parses a traceparent header value. Values of later versions are
+// read as far as version 00 defines them, as the specification requires.
+func Parse(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	span := SpanContext{TraceID: parts[1], SpanID: parts[2]}
+	if !isHex(span.TraceID, 32) || !isHex(span.SpanID, 16) || !isHex(parts[3], 2) {
+		return SpanContext{}, false
+	}
+	if strings.Trim(span.TraceID, "0") == "" || strings.Trim(span.SpanID, "0") == "" {
+		return SpanContext{}, false
+	}
+	return span, true
+}
+
+// Inject sets the traceparent header of an outbound request to the span
+// carried by ctx, unless the header is already set or ctx carries no span
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span.IsValid() && header.Get(Header) == "" {
+		header.Set(Header, Format(span))
+	}
+}
+
+// Extract returns a copy of ctx carrying the span of the caller, as set in
+// the traceparent header of an inbound request. Requests without a valid
+// header leave ctx as it is.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if span, ok := Parse(header.Get(Header)); ok {
+		return ContextWithSpan(ctx, span)
+	}
+	return ctx
+}
+
+// isHex reports whether s is n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
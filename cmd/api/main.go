@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	engineconfig "citadel-agent/backend/config"
 	"citadel-agent/backend/internal/api"
 	"citadel-agent/backend/internal/startup"
 	"citadel-agent/backend/internal/temporal"
@@ -15,10 +17,31 @@ import (
 )
 
 func main() {
+	// Initialize storage: "memory" (default) or "postgres"
+	storageDriver := getEnv("STORAGE_DRIVER", engine.StorageMemory)
+	storage, err := engine.NewStorage(context.Background(), storageDriver, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", storageDriver, err)
+	}
+	if pg, ok := storage.(*engine.PostgresStorage); ok {
+		defer pg.Close()
+	}
+
+	// Initialize engine logger
+	loggingConfig := engineconfig.DefaultEngineConfig().LoggingConfig
+	loggingConfig.Level = getEnv("LOG_LEVEL", loggingConfig.Level)
+	loggingConfig.Format = getEnv("LOG_FORMAT", loggingConfig.Format)
+	engineLogger, err := engine.NewSlogLogger(loggingConfig)
+	if err != nil {
+		log.Fatal("Failed to initialize logger:", err)
+	}
+	defer engineLogger.Close()
+
 	// Initialize base engine
 	baseEngine := engine.NewEngine(&engine.Config{
-		// Logger and Storage need to be configured in a real implementation
 		Parallelism: 10,
+		Logger:      engineLogger,
+		Storage:     storage,
 	})
 
 	// Initialize plugin manager
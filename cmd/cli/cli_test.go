@@ -141,6 +141,37 @@ func TestLogout(t *testing.T) {
 	assert.Error(t, err)
 }
 
+// Test bahwa logout mencabut token di server
+func TestLogoutRevokesServerSession(t *testing.T) {
+	tempDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	os.Setenv("HOME", tempDir)
+	defer os.Setenv("HOME", originalHome)
+
+	var revoked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/auth/logout", r.URL.Path)
+		revoked = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	auth := NewCLIAuth(server.URL)
+	auth.saveCredentials(&Credentials{
+		AccessToken: "session-token",
+		Expiry:      time.Now().Add(1 * time.Hour),
+	})
+
+	err := auth.Logout()
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer session-token", revoked, "Token harus dikirim ke server untuk dicabut")
+
+	// Credentials lokal tetap dihapus
+	_, err = auth.loadCredentials()
+	assert.Error(t, err)
+}
+
 // Test untuk command line arguments
 func TestCommandLineArguments(t *testing.T) {
 	originalArgs := os.Args
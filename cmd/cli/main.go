@@ -252,7 +252,7 @@ func (c *CLIAuth) GetAccessToken() (string, error) {
 	return credentials.AccessToken, nil
 }
 
-// Logout removes stored credentials
+// Logout revokes the session on the server and removes stored credentials
 func (c *CLIAuth) Logout() error {
 	usr, err := user.Current()
 	if err != nil {
@@ -261,6 +261,14 @@ func (c *CLIAuth) Logout() error {
 	
 	credsPath := filepath.Join(usr.HomeDir, ".config", "citadel-agent", "creds")
 	
+	// Revoke the token server-side; the local credentials are removed
+	// even when the server cannot be reached
+	if credentials, err := c.loadCredentials(); err == nil && time.Now().Before(credentials.Expiry) {
+		if err := c.revokeToken(credentials.AccessToken); err != nil {
+			fmt.Printf("⚠️  Could not revoke the session on the server: %v\n", err)
+		}
+	}
+	
 	// Remove the credentials file
 	if err := os.Remove(credsPath); err != nil {
 		if os.IsNotExist(err) {
@@ -273,6 +281,31 @@ func (c *CLIAuth) Logout() error {
 	return nil
 }
 
+// revokeToken asks the server to blacklist the access token
+func (c *CLIAuth) revokeToken(accessToken string) error {
+	url := fmt.Sprintf("%s/auth/logout", c.apiURL)
+	
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	// An already revoked or expired token is as good as logged out
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 func main() {
 	cliAuth := NewCLIAuth("")
 	
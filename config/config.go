@@ -2,7 +2,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -10,6 +12,10 @@ import (
 	"strings"
 	"time"
 
+	"citadel-agent/backend/pkg/cors"
+	"citadel-agent/backend/pkg/database"
+	"citadel-agent/backend/pkg/metrics"
+	"citadel-agent/backend/pkg/profiling"
 	"github.com/spf13/viper"
 	"github.com/redis/go-redis/v9"
 )
@@ -193,6 +199,7 @@ type PersistenceConfig struct {
 	SnapshotInterval time.Duration `mapstructure:"snapshot_interval" json:"snapshot_interval"`
 	Compression      bool          `mapstructure:"compression" json:"compression"`
 	Encryption       bool          `mapstructure:"encryption" json:"encryption"`
+	EncryptionKey    string        `mapstructure:"encryption_key" json:"-"` // secret the AES-GCM key is derived from
 	StorageType      string        `mapstructure:"storage_type" json:"storage_type"` // database, file, cloud
 	StoragePath      string        `mapstructure:"storage_path" json:"storage_path"`
 }
@@ -309,6 +316,8 @@ type SandboxConfig struct {
 	WhitelistedSyscalls []string           `mapstructure:"whitelisted_syscalls" json:"whitelisted_syscalls"`
 	BlacklistedSyscalls []string           `mapstructure:"blacklisted_syscalls" json:"blacklisted_syscalls"`
 	RuntimePermissions  RuntimePermissions `mapstructure:"runtime_permissions" json:"runtime_permissions"`
+	Timeout             time.Duration      `mapstructure:"timeout" json:"timeout"`     // of WASM modules
+	WasmRoot            string             `mapstructure:"wasm_root" json:"wasm_root"` // mounted as / of WASM modules with file_system permission
 }
 
 // RuntimePermissions defines permissions for different runtimes
@@ -337,6 +346,9 @@ type MonitoringConfig struct {
 	RetentionPeriod   time.Duration    `mapstructure:"retention_period" json:"retention_period"`
 	AlertRules        []AlertRule      `mapstructure:"alert_rules" json:"alert_rules"`
 	AlertChannels     []AlertChannel   `mapstructure:"alert_channels" json:"alert_channels"`
+
+	// Profiles are never served in production unless this is set
+	AllowProfilingInProduction bool `mapstructure:"allow_profiling_in_production" json:"allow_profiling_in_production"`
 }
 
 // AlertRule defines a monitoring alert rule
@@ -544,6 +556,8 @@ func DefaultConfig() *Config {
 			AppArmorEnabled:      false,
 			WhitelistedSyscalls:  []string{"read", "write", "open", "close", "brk"},
 			BlacklistedSyscalls:  []string{"execve", "fork", "clone"},
+			Timeout:              30 * time.Second,
+			WasmRoot:             "data/wasm",
 			RuntimePermissions: RuntimePermissions{
 				Network:        false,
 				FileSystem:     true,
@@ -715,34 +729,88 @@ func applyEnvOverrides(cfg *Config, v *viper.Viper) {
 	}
 }
 
-// Validate validates the configuration
+// Validate validates the configuration. Every problem found is reported,
+// one per line.
 func (c *Config) Validate() error {
+	var errs []error
+
 	// Validate server configuration
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
-		return fmt.Errorf("server port must be between 1 and 65535, got %d", c.Server.Port)
+		errs = append(errs, fmt.Errorf("server port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.Server.SSL.Enabled {
+		if err := checkFileExists(c.Server.SSL.CertFile); err != nil {
+			errs = append(errs, fmt.Errorf("ssl cert file: %w", err))
+		}
+		if err := checkFileExists(c.Server.SSL.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("ssl key file: %w", err))
+		}
 	}
 
 	// Validate database configuration
 	if c.Database.Host == "" {
-		return fmt.Errorf("database host cannot be empty")
+		errs = append(errs, fmt.Errorf("database host cannot be empty"))
 	}
 	if c.Database.Port <= 0 || c.Database.Port > 65535 {
-		return fmt.Errorf("database port must be between 1 and 65535, got %d", c.Database.Port)
+		errs = append(errs, fmt.Errorf("database port must be between 1 and 65535, got %d", c.Database.Port))
+	}
+
+	// Validate Redis configuration
+	if err := validateAddress(c.Redis.Address); err != nil {
+		errs = append(errs, fmt.Errorf("redis address: %w", err))
+	}
+
+	// Validate JWT configuration
+	if c.IsProduction() && c.Security.JWT.Secret == "" {
+		errs = append(errs, fmt.Errorf("jwt secret must be set in production"))
 	}
 
 	// Validate workflow configuration
 	if c.Workflow.MaxConcurrentExecutions <= 0 {
-		return fmt.Errorf("max concurrent executions must be greater than 0")
+		errs = append(errs, fmt.Errorf("max concurrent executions must be greater than 0"))
 	}
 	if c.Workflow.MaxNodesPerWorkflow <= 0 {
-		return fmt.Errorf("max nodes per workflow must be greater than 0")
+		errs = append(errs, fmt.Errorf("max nodes per workflow must be greater than 0"))
+	}
+	if c.Workflow.Persistence.Encryption && len(c.Workflow.Persistence.EncryptionKey) < 32 {
+		errs = append(errs, fmt.Errorf("persistence encryption key must be at least 32 characters when encryption is enabled"))
 	}
 
 	// Validate plugin configuration
 	if c.Plugin.Directory == "" {
-		return fmt.Errorf("plugin directory cannot be empty")
+		errs = append(errs, fmt.Errorf("plugin directory cannot be empty"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateAddress checks that address has the form host:port
+func validateAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%q is not host:port: %w", address, err)
+	}
+	if host == "" {
+		return fmt.Errorf("%q has no host", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%q has an invalid port", address)
 	}
+	return nil
+}
 
+// checkFileExists returns an error unless path names an existing file
+func checkFileExists(path string) error {
+	if path == "" {
+		return fmt.Errorf("must be set when SSL is enabled")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
 	return nil
 }
 
@@ -758,6 +826,17 @@ func (c *DatabaseConfig) GetConnectionString() string {
 	)
 }
 
+// GetPoolOptions returns the settings of the shared database connection pool
+func (c *DatabaseConfig) GetPoolOptions() database.Config {
+	return database.Config{
+		URL:             c.GetConnectionString(),
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: c.ConnMaxLifetime,
+		QueryTimeout:    c.QueryTimeout,
+	}
+}
+
 // GetRedisOptions returns Redis options
 func (c *RedisConfig) GetRedisOptions() *redis.Options {
 	return &redis.Options{
@@ -773,6 +852,29 @@ func (c *RedisConfig) GetRedisOptions() *redis.Options {
 	}
 }
 
+// GetCORSOptions returns the CORS policy for the shared CORS middleware
+func (c *CORSConfig) GetCORSOptions() cors.Config {
+	return cors.Config(*c)
+}
+
+// GetMetricsOptions returns the settings of the metrics exporter
+func (c *MonitoringConfig) GetMetricsOptions() metrics.Config {
+	return metrics.Config{
+		CollectMetrics:  c.Enabled && c.CollectMetrics,
+		ExportMetrics:   c.ExportMetrics,
+		MetricsEndpoint: c.MetricsEndpoint,
+	}
+}
+
+// GetProfilingOptions returns the settings of the pprof endpoints
+func (c *MonitoringConfig) GetProfilingOptions() profiling.Config {
+	return profiling.Config{
+		Enabled:           c.Enabled && c.ProfilingEnabled,
+		Endpoint:          c.ProfilingEndpoint,
+		AllowInProduction: c.AllowProfilingInProduction,
+	}
+}
+
 // GetJWTExpirationTime returns the JWT expiration time
 func (c *JWTConfig) GetJWTExpirationTime() time.Duration {
 	if c.ExpirationTime == 0 {
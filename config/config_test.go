@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	assert.NoError(t, DefaultConfig().Validate())
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Environment = "production"
+	cfg.Security.JWT.Secret = ""
+	cfg.Redis.Address = "localhost"
+	cfg.Server.SSL = SSLConfig{Enabled: true, CertFile: filepath.Join(t.TempDir(), "missing.pem")}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{"jwt secret", "redis address", "ssl cert file", "ssl key file"} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestValidateAcceptsExistingSSLFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Server.SSL = SSLConfig{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	require.NoError(t, os.WriteFile(cfg.Server.SSL.CertFile, []byte("cert"), 0600))
+	require.NoError(t, os.WriteFile(cfg.Server.SSL.KeyFile, []byte("key"), 0600))
+
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citadel-agent/backend/pkg/accounts"
+	"citadel-agent/backend/pkg/lockout"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp serves the auth routes for in-memory users, locking logins out
+// after maxAttempts failures for cooldown
+func newTestApp(t *testing.T, maxAttempts int, cooldown time.Duration) *fiber.App {
+	t.Helper()
+	previousLockout, previousLimit, previousKey := loginLockout, authRateLimitMax, twoFactorKey
+	t.Cleanup(func() {
+		loginLockout, authRateLimitMax, twoFactorKey = previousLockout, previousLimit, previousKey
+	})
+
+	loginLockout = lockout.New(lockout.NewMemoryStore(), lockout.Config{
+		MaxAttempts: maxAttempts,
+		Window:      time.Minute,
+		Cooldown:    cooldown,
+	})
+	authRateLimitMax = 1000
+	twoFactorKey = strings.Repeat("k", 32)
+
+	app := fiber.New()
+	setupAuthRoutes(app, accounts.NewMemoryStore())
+	return app
+}
+
+// post sends body to path as JSON, with token as bearer token when set, and
+// returns the status and decoded response
+func post(t *testing.T, app *fiber.App, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&decoded))
+	return resp.StatusCode, decoded
+}
+
+func register(t *testing.T, app *fiber.App, email, password string) {
+	t.Helper()
+	status, body := post(t, app, "/auth/register", "", map[string]string{"email": email, "username": "alice", "password": password})
+	require.Equal(t, fiber.StatusCreated, status, body)
+}
+
+func login(t *testing.T, app *fiber.App, email, password, code string) (int, map[string]interface{}) {
+	t.Helper()
+	return post(t, app, "/auth/login", "", map[string]string{"email": email, "password": password, "code": code})
+}
+
+// totp returns the current code of an enrollment's base32 secret
+func totp(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	require.NoError(t, err)
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, uint64(time.Now().Unix()/30))
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestLogin(t *testing.T) {
+	app := newTestApp(t, 5, time.Minute)
+	register(t, app, "alice@example.com", "correct horse battery")
+
+	status, body := login(t, app, "alice@example.com", "correct horse battery", "")
+	require.Equal(t, fiber.StatusOK, status, body)
+	assert.NotEmpty(t, body["access_token"])
+
+	status, body = login(t, app, "alice@example.com", "wrong password", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, "INVALID_CREDENTIALS", body["code"])
+
+	status, body = login(t, app, "nobody@example.com", "correct horse battery", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, "INVALID_CREDENTIALS", body["code"], "unknown emails get the same answer")
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApp(t, 3, 200*time.Millisecond)
+	register(t, app, "alice@example.com", "correct horse battery")
+
+	for i := 0; i < 2; i++ {
+		status, _ := login(t, app, "alice@example.com", "wrong password", "")
+		require.Equal(t, fiber.StatusUnauthorized, status)
+	}
+	status, body := login(t, app, "alice@example.com", "wrong password", "")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.Equal(t, "ACCOUNT_LOCKED", body["code"])
+
+	// The right password is refused too until the cooldown ends
+	status, body = login(t, app, "alice@example.com", "correct horse battery", "")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.Equal(t, "ACCOUNT_LOCKED", body["code"])
+
+	time.Sleep(250 * time.Millisecond)
+	status, body = login(t, app, "alice@example.com", "correct horse battery", "")
+	require.Equal(t, fiber.StatusOK, status, body)
+
+	// A successful login resets the failures
+	for i := 0; i < 2; i++ {
+		status, _ := login(t, app, "alice@example.com", "wrong password", "")
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	}
+}
+
+func TestLoginWithTwoFactor(t *testing.T) {
+	app := newTestApp(t, 5, time.Minute)
+	register(t, app, "alice@example.com", "correct horse battery")
+	_, body := login(t, app, "alice@example.com", "correct horse battery", "")
+	token, _ := body["access_token"].(string)
+	require.NotEmpty(t, token)
+
+	status, body := post(t, app, "/auth/2fa/enroll", token, map[string]string{})
+	require.Equal(t, fiber.StatusOK, status, body)
+	secret, _ := body["secret"].(string)
+	status, body = post(t, app, "/auth/2fa/verify", token, map[string]string{"code": totp(t, secret)})
+	require.Equal(t, fiber.StatusOK, status, body)
+	recoveryCodes, _ := body["recovery_codes"].([]interface{})
+	require.NotEmpty(t, recoveryCodes)
+
+	status, body = login(t, app, "alice@example.com", "correct horse battery", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, "TWO_FACTOR_REQUIRED", body["code"])
+
+	status, body = login(t, app, "alice@example.com", "correct horse battery", "000000")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, "INVALID_TWO_FACTOR_CODE", body["code"])
+
+	status, body = login(t, app, "alice@example.com", "correct horse battery", recoveryCodes[0].(string))
+	require.Equal(t, fiber.StatusOK, status, body)
+	assert.NotEmpty(t, body["access_token"])
+
+	status, body = login(t, app, "alice@example.com", "correct horse battery", recoveryCodes[0].(string))
+	assert.Equal(t, fiber.StatusUnauthorized, status, "recovery codes work once")
+	assert.Equal(t, "INVALID_TWO_FACTOR_CODE", body["code"])
+}